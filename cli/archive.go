@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Migration archive: move the original aside, or copy it across devices
+// ---------------------------------------------------------------------------
+//
+// migrate archives the source directory by renaming it, which the kernel
+// refuses with EXDEV when the source and the archive sit on different
+// filesystems, as with a bind-mounted source. The archive is then copied
+// with byte-level progress and the original deleted. Rolling back reverses
+// whichever strategy was used.
+
+// archiveRename moves the source to the archive; tests replace it to
+// simulate a cross-device source.
+var archiveRename = os.Rename
+
+// archivePlan is where the original goes and how it gets there.
+type archivePlan struct {
+	dir  string
+	copy bool // copy then delete, since a rename cannot cross devices
+}
+
+func (p archivePlan) strategy() string {
+	if p.copy {
+		return "copy, then delete the original (different filesystem)"
+	}
+	return "rename"
+}
+
+// planArchive picks the archive path, archiveTo or <source>.archive by
+// default, and whether the original can be renamed there.
+func planArchive(sourceDir, archiveTo string) (archivePlan, error) {
+	dir := sourceDir + ".archive"
+	if archiveTo != "" {
+		dir = archiveTo
+	}
+	if rel, err := filepath.Rel(sourceDir, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return archivePlan{}, fmt.Errorf("archive path %s is inside %s", dir, sourceDir)
+	}
+	src, err := deviceOf(sourceDir)
+	if err != nil {
+		return archivePlan{}, err
+	}
+	dst, err := deviceOf(filepath.Dir(dir))
+	if err != nil {
+		return archivePlan{}, fmt.Errorf("archive directory: %w", err)
+	}
+	return archivePlan{dir: dir, copy: src != dst}, nil
+}
+
+// deviceOf returns the ID of the filesystem holding path.
+func deviceOf(path string) (uint64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("cannot determine the filesystem of %s", path)
+	}
+	return uint64(st.Dev), nil
+}
+
+// copyProgress counts the bytes copied into an archive.
+type copyProgress struct {
+	Bytes int64
+	Total int64
+}
+
+func (p copyProgress) summary() string {
+	if p.Total == 0 {
+		return formatBytes(p.Bytes)
+	}
+	return fmt.Sprintf("%s of %s (%d%%)", formatBytes(p.Bytes), formatBytes(p.Total), p.Bytes*100/p.Total)
+}
+
+// archiveDirectory moves src to plan.dir. A rename that fails with EXDEV
+// falls back to copying, and plan is updated so a rollback knows which
+// way to go back.
+func archiveDirectory(src string, plan *archivePlan, onProgress func(copyProgress)) error {
+	if !plan.copy {
+		err := archiveRename(src, plan.dir)
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+		plan.copy = true
+	}
+	if err := copyDirectory(src, plan.dir, onProgress); err != nil {
+		_ = os.RemoveAll(plan.dir)
+		return err
+	}
+	if err := removeTree(src); err != nil {
+		return fmt.Errorf("%w\n%s holds a complete copy of the original", err, plan.dir)
+	}
+	return nil
+}
+
+// restoreArchive puts the archived original back at sourceDir, replacing
+// whatever is there.
+func restoreArchive(plan archivePlan, sourceDir string) error {
+	if !plan.copy {
+		_ = os.RemoveAll(sourceDir)
+		return archiveRename(plan.dir, sourceDir)
+	}
+	if err := removeTree(sourceDir); err != nil {
+		return err
+	}
+	if err := copyDirectory(plan.dir, sourceDir, nil); err != nil {
+		return err
+	}
+	return os.RemoveAll(plan.dir)
+}
+
+// removeTree deletes dir and everything in it. A directory that is itself
+// a mountpoint cannot be removed; emptying it is enough.
+func removeTree(dir string) error {
+	err := os.RemoveAll(dir)
+	if err == nil {
+		return nil
+	}
+	if empty, _ := isEmptyDir(dir); empty {
+		return nil
+	}
+	return err
+}
+
+// walkTree calls fn for every entry below root, with its path relative to
+// root, in lexical order.
+func walkTree(root string, fn func(path, rel string, d os.DirEntry) error) error {
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		return fn(path, rel, d)
+	})
+}
+
+// copyDirectory copies the tree at src to dst, keeping modes and times,
+// and owners when running as root. dst may exist as an empty directory.
+func copyDirectory(src, dst string, onProgress func(copyProgress)) error {
+	var progress copyProgress
+	err := walkTree(src, func(path, rel string, d os.DirEntry) error {
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			progress.Total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(dst, 0o700); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	// Directories get their mode and times once everything inside them
+	// has been written.
+	dirs := []string{""}
+	err = walkTree(src, func(path, rel string, d os.DirEntry) error {
+		target := filepath.Join(dst, rel)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			return copyOwner(target, info)
+		case info.IsDir():
+			dirs = append(dirs, rel)
+			return os.Mkdir(target, 0o700)
+		case info.Mode().IsRegular():
+			if err := copyFile(path, target, &progress, onProgress); err != nil {
+				return err
+			}
+			return copyMetadata(target, info)
+		default:
+			return fmt.Errorf("cannot archive %s: unsupported file type %s", path, info.Mode().Type())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Lstat(filepath.Join(src, dirs[i]))
+		if err != nil {
+			return err
+		}
+		if err := copyMetadata(filepath.Join(dst, dirs[i]), info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile copies one regular file, reporting bytes as they are written.
+func copyFile(src, dst string, progress *copyProgress, onProgress func(copyProgress)) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, &progressReader{r: in, progress: progress, onProgress: onProgress})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type progressReader struct {
+	r          io.Reader
+	progress   *copyProgress
+	onProgress func(copyProgress)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.progress.Bytes += int64(n)
+	if n > 0 && p.onProgress != nil {
+		p.onProgress(*p.progress)
+	}
+	return n, err
+}
+
+// copyMetadata gives path the mode, owner, and times recorded in info.
+func copyMetadata(path string, info os.FileInfo) error {
+	if err := copyOwner(path, info); err != nil {
+		return err
+	}
+	if err := os.Chmod(path, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		aSec, aNsec := statAtime(st)
+		mSec, mNsec := statMtime(st)
+		return os.Chtimes(path, time.Unix(aSec, aNsec), time.Unix(mSec, mNsec))
+	}
+	return nil
+}
+
+// copyOwner gives path the owner recorded in info. Only root can, so for
+// anyone else the copy keeps their ownership.
+func copyOwner(path string, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Lchown(path, int(st.Uid), int(st.Gid))
+}
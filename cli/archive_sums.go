@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Archive checksums: SHA256SUMS at the root of a migration archive
+// ---------------------------------------------------------------------------
+//
+// An archive may sit untouched for months before anyone deletes it, and by
+// then nobody remembers whether it is still good. After archiving, migrate
+// writes a SHA-256 for every regular file into SHA256SUMS at the archive's
+// root, in the format sha256sum -c reads, and `rfs archive verify` checks
+// it. The digest of SHA256SUMS itself and the bytes it covers go into the
+// archive registry, so a damaged sums file is caught as well.
+//
+// Generation streams one file at a time into SHA256SUMS.partial. An
+// interrupted run leaves the partial file behind and `rfs archive
+// checksum` picks up after the last file it finished.
+
+const (
+	archiveSumsName    = "SHA256SUMS"
+	archiveSumsPartial = archiveSumsName + ".partial"
+)
+
+// archiveSums describes a completed SHA256SUMS.
+type archiveSums struct {
+	Digest string `json:"digest"` // SHA-256 of the SHA256SUMS file
+	Files  int    `json:"files"`
+	Bytes  int64  `json:"bytes"` // total size of the files it covers
+}
+
+// sumsLine formats one entry as sha256sum does, escaping a name that
+// contains a backslash or newline and marking the line with a leading
+// backslash.
+func sumsLine(sum, rel string) string {
+	if !strings.ContainsAny(rel, "\\\n") {
+		return sum + "  " + rel + "\n"
+	}
+	rel = strings.ReplaceAll(rel, "\\", "\\\\")
+	rel = strings.ReplaceAll(rel, "\n", "\\n")
+	return "\\" + sum + "  " + rel + "\n"
+}
+
+// parseSumsLine reverses sumsLine.
+func parseSumsLine(line string) (sum, rel string, err error) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+	sum, rel, ok := strings.Cut(line, "  ")
+	if !ok || len(sum) != sha256.Size*2 {
+		return "", "", fmt.Errorf("malformed line %q", line)
+	}
+	if escaped {
+		var b strings.Builder
+		for i := 0; i < len(rel); i++ {
+			if rel[i] == '\\' && i+1 < len(rel) {
+				i++
+				if rel[i] == 'n' {
+					b.WriteByte('\n')
+					continue
+				}
+			}
+			b.WriteByte(rel[i])
+		}
+		rel = b.String()
+	}
+	return sum, rel, nil
+}
+
+// readSums parses a sums file into relative path → hex digest. The file
+// is read only up to its last complete line; complete is how many bytes
+// that is, so an interrupted write can be cut back to it.
+func readSums(path string) (sums map[string]string, complete int64, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	sums = map[string]string{}
+	for len(b) > 0 {
+		i := strings.IndexByte(string(b), '\n')
+		if i < 0 {
+			break
+		}
+		sum, rel, err := parseSumsLine(string(b[:i]))
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", path, err)
+		}
+		sums[rel] = sum
+		complete += int64(i + 1)
+		b = b[i+1:]
+	}
+	return sums, complete, nil
+}
+
+// archiveFiles lists the regular files in an archive, with their total
+// size, leaving out its own checksum files. Symlinks and directories carry
+// no content to check.
+func archiveFiles(dir string) (files []string, total int64, err error) {
+	err = walkTree(dir, func(path, rel string, d os.DirEntry) error {
+		if !d.Type().IsRegular() || rel == archiveSumsName || rel == archiveSumsPartial {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		total += info.Size()
+		return nil
+	})
+	return files, total, err
+}
+
+// ---------------------------------------------------------------------------
+// Generation
+// ---------------------------------------------------------------------------
+
+// writeArchiveSums checksums every file in dir into dir/SHA256SUMS,
+// resuming from SHA256SUMS.partial when an earlier run was interrupted.
+// Cancelling ctx stops it with the partial file kept.
+func writeArchiveSums(ctx context.Context, dir string, onProgress func(copyProgress)) (archiveSums, error) {
+	files, total, err := archiveFiles(dir)
+	if err != nil {
+		return archiveSums{}, err
+	}
+	partial := filepath.Join(dir, archiveSumsPartial)
+	done, complete, err := readSums(partial)
+	if errors.Is(err, os.ErrNotExist) {
+		done, complete, err = map[string]string{}, 0, nil
+	}
+	if err != nil {
+		return archiveSums{}, err
+	}
+
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return archiveSums{}, err
+	}
+	defer f.Close()
+	// Drop a line the interrupted run was halfway through writing.
+	if err := f.Truncate(complete); err != nil {
+		return archiveSums{}, err
+	}
+	if _, err := f.Seek(complete, io.SeekStart); err != nil {
+		return archiveSums{}, err
+	}
+	w := bufio.NewWriter(f)
+
+	progress := copyProgress{Total: total}
+	for _, rel := range files {
+		path := filepath.Join(dir, rel)
+		if _, ok := done[rel]; ok {
+			if info, err := os.Stat(path); err == nil {
+				progress.Bytes += info.Size()
+			}
+			continue
+		}
+		sum, err := hashFileProgress(ctx, path, &progress, onProgress)
+		if err == nil {
+			_, err = w.WriteString(sumsLine(sum, rel))
+		}
+		if err == nil {
+			// Flushed per file, so an interruption loses at most the file
+			// being hashed.
+			err = w.Flush()
+		}
+		if err != nil {
+			return archiveSums{}, err
+		}
+		done[rel] = sum
+	}
+	if err := f.Sync(); err != nil {
+		return archiveSums{}, err
+	}
+	if err := f.Close(); err != nil {
+		return archiveSums{}, err
+	}
+
+	// Resumed runs append out of order; the final file is sorted like a
+	// fresh one, and drops files that have gone since.
+	var b strings.Builder
+	for _, rel := range files {
+		b.WriteString(sumsLine(done[rel], rel))
+	}
+	out := filepath.Join(dir, archiveSumsName)
+	if err := os.WriteFile(partial, []byte(b.String()), 0o644); err != nil {
+		return archiveSums{}, err
+	}
+	if err := os.Rename(partial, out); err != nil {
+		return archiveSums{}, err
+	}
+	digest := sha256.Sum256([]byte(b.String()))
+	return archiveSums{Digest: hex.EncodeToString(digest[:]), Files: len(files), Bytes: total}, nil
+}
+
+// ---------------------------------------------------------------------------
+// Verification
+// ---------------------------------------------------------------------------
+
+// archiveProblem is one file that fails verification.
+type archiveProblem struct {
+	Path    string
+	Problem string
+}
+
+// archiveCheck is the outcome of verifying an archive.
+type archiveCheck struct {
+	Files    int
+	Bytes    int64
+	Problems []archiveProblem
+	// SumsChanged is set when SHA256SUMS no longer has the digest the
+	// registry recorded for it.
+	SumsChanged bool
+}
+
+// verifyArchiveSums re-hashes every file SHA256SUMS lists and reports
+// files that differ or are missing, and files it does not list. With a
+// registry record, the sums file is checked against it first.
+func verifyArchiveSums(ctx context.Context, dir string, rec *archiveRecord, onProgress func(copyProgress)) (archiveCheck, error) {
+	var check archiveCheck
+	sumsPath := filepath.Join(dir, archiveSumsName)
+	raw, err := os.ReadFile(sumsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			if _, perr := os.Stat(filepath.Join(dir, archiveSumsPartial)); perr == nil {
+				return check, fmt.Errorf("%s has not finished being checksummed\nRun '%s archive checksum %s' to finish", dir, filepath.Base(os.Args[0]), dir)
+			}
+			return check, fmt.Errorf("%s has no %s\nRun '%s archive checksum %s' to create one", dir, archiveSumsName, filepath.Base(os.Args[0]), dir)
+		}
+		return check, err
+	}
+	if rec != nil && rec.Sums != nil {
+		digest := sha256.Sum256(raw)
+		check.SumsChanged = hex.EncodeToString(digest[:]) != rec.Sums.Digest
+	}
+	want, _, err := readSums(sumsPath)
+	if err != nil {
+		return check, err
+	}
+
+	files, _, err := archiveFiles(dir)
+	if err != nil {
+		return check, err
+	}
+	present := map[string]bool{}
+	for _, rel := range files {
+		present[rel] = true
+	}
+	listed := make([]string, 0, len(want))
+	var progress copyProgress
+	for rel := range want {
+		listed = append(listed, rel)
+		if info, err := os.Stat(filepath.Join(dir, rel)); err == nil {
+			progress.Total += info.Size()
+		}
+	}
+	sort.Strings(listed)
+
+	for _, rel := range listed {
+		if !present[rel] {
+			check.Problems = append(check.Problems, archiveProblem{Path: rel, Problem: "missing"})
+			continue
+		}
+		before := progress.Bytes
+		sum, err := hashFileProgress(ctx, filepath.Join(dir, rel), &progress, onProgress)
+		if ctx.Err() != nil {
+			return check, ctx.Err()
+		}
+		switch {
+		case err != nil:
+			check.Problems = append(check.Problems, archiveProblem{Path: rel, Problem: err.Error()})
+		case sum != want[rel]:
+			check.Problems = append(check.Problems, archiveProblem{Path: rel, Problem: "checksum mismatch"})
+		default:
+			check.Files++
+			check.Bytes += progress.Bytes - before
+		}
+	}
+	for _, rel := range files {
+		if _, ok := want[rel]; !ok {
+			check.Problems = append(check.Problems, archiveProblem{Path: rel, Problem: "not in " + archiveSumsName})
+		}
+	}
+	return check, nil
+}
+
+// ---------------------------------------------------------------------------
+// Archive registry
+// ---------------------------------------------------------------------------
+
+// archiveRecord is what rfs knows about an archive it created. Unlike
+// state.json it outlives down, since the archive does.
+type archiveRecord struct {
+	Source    string       `json:"source"`
+	Key       string       `json:"key"`
+	CreatedAt time.Time    `json:"created_at"`
+	Sums      *archiveSums `json:"sums,omitempty"`
+	// Reconciled is the latest reconcile's conclusion; archive rm checks it.
+	Reconciled *reconcileSummary `json:"reconciled,omitempty"`
+}
+
+// archiveRegistry maps an archive's absolute path to its record.
+type archiveRegistry map[string]*archiveRecord
+
+func archiveRegistryPath() string {
+	return filepath.Join(stateDir(), "archives.json")
+}
+
+// withArchiveRegistry runs fn on the registry under an exclusive lock and
+// saves what fn leaves behind, unless it fails.
+func withArchiveRegistry(fn func(reg archiveRegistry) error) error {
+	if err := os.MkdirAll(stateDir(), 0o700); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(archiveRegistryPath()+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock archive registry: %w", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	reg := archiveRegistry{}
+	b, err := os.ReadFile(archiveRegistryPath())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(b, &reg); err != nil {
+			return fmt.Errorf("parse %s: %w", archiveRegistryPath(), err)
+		}
+	}
+	if err := fn(reg); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := archiveRegistryPath() + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, archiveRegistryPath())
+}
+
+// lookupArchive returns the registry record for dir, or nil.
+func lookupArchive(dir string) (*archiveRecord, error) {
+	var rec *archiveRecord
+	err := withArchiveRegistry(func(reg archiveRegistry) error {
+		rec = reg[dir]
+		return nil
+	})
+	return rec, err
+}
+
+// recordArchiveSums stores sums on dir's record, creating a bare record
+// for an archive rfs did not register, such as one from an older version.
+func recordArchiveSums(dir string, sums archiveSums) error {
+	return withArchiveRegistry(func(reg archiveRegistry) error {
+		rec := reg[dir]
+		if rec == nil {
+			rec = &archiveRecord{CreatedAt: time.Now().UTC()}
+			reg[dir] = rec
+		}
+		rec.Sums = &sums
+		return nil
+	})
+}
+
+// checksumArchive writes SHA256SUMS for dir with a progress step and
+// records it. Ctrl-C stops it resumably.
+func checksumArchive(dir string) (archiveSums, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	step := startStep("Checksumming archive")
+	sums, err := writeArchiveSums(ctx, dir, func(p copyProgress) {
+		step.update("Checksumming archive · " + p.summary())
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			step.fail("interrupted")
+			return sums, fmt.Errorf("checksumming interrupted\nRun '%s archive checksum %s' to resume", filepath.Base(os.Args[0]), dir)
+		}
+		step.fail(err.Error())
+		return sums, err
+	}
+	if err := recordArchiveSums(dir, sums); err != nil {
+		step.fail(err.Error())
+		return sums, err
+	}
+	step.update("Checksumming archive")
+	step.succeed(fmt.Sprintf("%d files, %s", sums.Files, formatBytes(sums.Bytes)))
+	return sums, nil
+}
+
+// ---------------------------------------------------------------------------
+// archive — checksum and verify migration archives
+// ---------------------------------------------------------------------------
+
+func cmdArchive(args []string) error {
+	bin := filepath.Base(os.Args[0])
+	usage := fmt.Sprintf("Usage: %s archive verify <path>\n       %s archive checksum <path>\n       %s archive rm <path> [--yes] [--force]", bin, bin, bin)
+	if len(args) > 1 && args[1] == "rm" {
+		return cmdArchiveRm(args[2:])
+	}
+	if len(args) != 3 {
+		return errors.New(usage)
+	}
+	dir, err := expandPath(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("cannot access %s: %w", dir, err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	switch args[1] {
+	case "verify":
+		return cmdArchiveVerify(dir)
+	case "checksum":
+		_, err := checksumArchive(dir)
+		return err
+	default:
+		return fmt.Errorf("unknown archive command %q\n\n%s", args[1], usage)
+	}
+}
+
+func cmdArchiveVerify(dir string) error {
+	rec, err := lookupArchive(dir)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	step := startStep("Verifying archive")
+	check, err := verifyArchiveSums(ctx, dir, rec, func(p copyProgress) {
+		step.update("Verifying archive · " + p.summary())
+	})
+	step.update("Verifying archive")
+	if err != nil {
+		if ctx.Err() != nil {
+			step.fail("interrupted")
+			return errors.New("verification interrupted")
+		}
+		step.fail(err.Error())
+		return err
+	}
+	if check.SumsChanged {
+		fmt.Printf("  %s %s has changed since it was written; the results below check against its current contents\n",
+			clr(ansiYellow, "!"), archiveSumsName)
+	} else if rec == nil || rec.Sums == nil {
+		fmt.Printf("  %s No digest of %s was recorded for this archive, so the file itself cannot be checked\n",
+			clr(ansiYellow, "!"), archiveSumsName)
+	}
+	if len(check.Problems) == 0 {
+		step.succeed(fmt.Sprintf("%d files, %s intact", check.Files, formatBytes(check.Bytes)))
+		if check.SumsChanged {
+			return fmt.Errorf("%s does not match the digest recorded when it was written", archiveSumsName)
+		}
+		return nil
+	}
+	step.fail(fmt.Sprintf("%d problem(s)", len(check.Problems)))
+
+	const maxRows = 20
+	var rows []boxRow
+	for i, p := range check.Problems {
+		if i == maxRows {
+			rows = append(rows, boxRow{Value: clr(ansiDim, fmt.Sprintf("… and %d more", len(check.Problems)-maxRows))})
+			break
+		}
+		rows = append(rows, boxRow{Label: p.Path, Value: p.Problem})
+	}
+	printBox(clr(ansiBold, "Archive verification failures"), rows)
+	return fmt.Errorf("archive verification failed: %d of %d files intact", check.Files, check.Files+len(check.Problems))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveSumsResumeAfterInterrupt(t *testing.T) {
+	dir := writeFixtureTree(t)
+	if err := os.WriteFile(filepath.Join(dir, "odd\nname\\"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := writeArchiveSums(context.Background(), copyTree(t, dir), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = writeArchiveSums(ctx, dir, func(p copyProgress) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, archiveSumsName)); !os.IsNotExist(err) {
+		t.Fatalf("SHA256SUMS written by an interrupted run: %v", err)
+	}
+	// A line torn by the interruption is dropped on resume.
+	partial := filepath.Join(dir, archiveSumsPartial)
+	f, err := os.OpenFile(partial, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("0123abc")
+	f.Close()
+
+	sums, err := writeArchiveSums(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sums != fresh {
+		t.Fatalf("resumed %+v, fresh %+v", sums, fresh)
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Fatalf("partial file left behind: %v", err)
+	}
+	if got, err := exec.Command("sha256sum", "--version").Output(); err == nil && len(got) > 0 {
+		cmd := exec.Command("sha256sum", "--quiet", "-c", archiveSumsName)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("sha256sum -c: %v\n%s", err, out)
+		}
+	}
+}
+
+func TestVerifyArchiveSums(t *testing.T) {
+	dir := writeFixtureTree(t)
+	sums, err := writeArchiveSums(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &archiveRecord{Sums: &sums}
+	check, err := verifyArchiveSums(context.Background(), dir, rec, nil)
+	if err != nil || len(check.Problems) != 0 || check.SumsChanged || check.Files != sums.Files || check.Bytes != sums.Bytes {
+		t.Fatalf("intact archive: %+v, %v", check, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("# hellO\n"), 0o644)
+	os.Remove(filepath.Join(dir, "src", "run.sh"))
+	os.WriteFile(filepath.Join(dir, "new.txt"), nil, 0o644)
+	check, err = verifyArchiveSums(context.Background(), dir, rec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []archiveProblem{
+		{Path: "README.md", Problem: "checksum mismatch"},
+		{Path: "src/run.sh", Problem: "missing"},
+		{Path: "new.txt", Problem: "not in SHA256SUMS"},
+	}
+	if len(check.Problems) != len(want) {
+		t.Fatalf("problems: %+v", check.Problems)
+	}
+	for i := range want {
+		if check.Problems[i] != want[i] {
+			t.Fatalf("problem %d: %+v, want %+v", i, check.Problems[i], want[i])
+		}
+	}
+
+	sumsPath := filepath.Join(dir, archiveSumsName)
+	b, _ := os.ReadFile(sumsPath)
+	b[0] ^= 1 // another hex digit
+	os.WriteFile(sumsPath, b, 0o644)
+	if check, _ := verifyArchiveSums(context.Background(), dir, rec, nil); !check.SumsChanged {
+		t.Fatal("a modified SHA256SUMS was not noticed")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/redis-fs/mount/client"
+)
+
+// crossDevice makes archive renames fail as they do when the source is on
+// another filesystem.
+func crossDevice(t *testing.T) {
+	t.Helper()
+	orig := archiveRename
+	t.Cleanup(func() { archiveRename = orig })
+	archiveRename = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+}
+
+func TestArchiveFallsBackToCopyAcrossDevices(t *testing.T) {
+	crossDevice(t)
+	src := writeFixtureTree(t)
+	want := copyTree(t, src)
+	plan := archivePlan{dir: filepath.Join(t.TempDir(), "src.archive")}
+
+	var last copyProgress
+	if err := archiveDirectory(src, &plan, func(p copyProgress) { last = p }); err != nil {
+		t.Fatal(err)
+	}
+	if !plan.copy {
+		t.Fatal("plan not switched to copying after EXDEV")
+	}
+	if last.Total == 0 || last.Bytes != last.Total {
+		t.Fatalf("final progress %+v", last)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Fatalf("original left behind: %v", err)
+	}
+	report, err := runSmokeTest(plan.dir, want, 100, rand.New(rand.NewSource(1)), nil)
+	if err != nil || len(report.Mismatches) != 0 {
+		t.Fatalf("archive differs from the original: %+v, %v", report.Mismatches, err)
+	}
+	info, err := os.Stat(filepath.Join(plan.dir, "src", "deep"))
+	if err != nil || info.Mode().Perm() != 0o750 || !info.ModTime().Equal(fixtureTime) {
+		t.Fatalf("directory metadata not kept: %v, %v", info, err)
+	}
+}
+
+func TestRestoreCopiedArchive(t *testing.T) {
+	crossDevice(t)
+	src := writeFixtureTree(t)
+	want := copyTree(t, src)
+	plan := archivePlan{dir: filepath.Join(t.TempDir(), "src.archive")}
+	if err := archiveDirectory(src, &plan, nil); err != nil {
+		t.Fatal(err)
+	}
+	// The failed migration left an empty mountpoint behind.
+	if err := os.Mkdir(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restoreArchive(plan, src); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(plan.dir); !os.IsNotExist(err) {
+		t.Fatalf("archive left behind after restore: %v", err)
+	}
+	report, err := runSmokeTest(src, want, 100, rand.New(rand.NewSource(1)), nil)
+	if err != nil || len(report.Mismatches) != 0 {
+		t.Fatalf("restored tree differs: %+v, %v", report.Mismatches, err)
+	}
+}
+
+func TestPlanArchive(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "data")
+	if err := os.Mkdir(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planArchive(src, "")
+	if err != nil || plan.dir != src+".archive" || plan.copy {
+		t.Fatalf("default plan %+v, %v", plan, err)
+	}
+	if plan.strategy() != "rename" {
+		t.Fatalf("strategy %q", plan.strategy())
+	}
+	if _, err := planArchive(src, filepath.Join(src, "old")); err == nil {
+		t.Fatal("archive inside the source accepted")
+	}
+	if _, err := planArchive(src, filepath.Join(root, "missing", "old")); err == nil {
+		t.Fatal("archive under a missing directory accepted")
+	}
+}
+
+func TestMigrationUndo(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	key := testKey(t, rdb)
+	src := writeFixtureTree(t)
+	want := copyTree(t, src)
+	// An interrupted import stops before writing anything more.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := importDirectory(cancelled, client.New(rdb, key), src, importOptions{}, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("import after cancel: %v", err)
+	}
+	if _, err := importDirectory(ctx, client.New(rdb, key), src, importOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := archivePlan{dir: filepath.Join(t.TempDir(), "src.archive")}
+	if err := archiveDirectory(src, &plan, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	undo := migrationUndo{sourceDir: src, plan: &plan, dropKey: func() error { return deleteNamespace(ctx, rdb, key) }}
+	undo.run()
+
+	report, err := runSmokeTest(src, want, 100, rand.New(rand.NewSource(1)), nil)
+	if err != nil || len(report.Mismatches) != 0 {
+		t.Fatalf("restored tree differs: %+v, %v", report.Mismatches, err)
+	}
+	if n, _ := rdb.Keys(ctx, fsNamespacePattern(key)).Result(); len(n) != 0 {
+		t.Fatalf("partial key left behind: %v", n)
+	}
+}
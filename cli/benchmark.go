@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+)
+
+// ---------------------------------------------------------------------------
+// benchmark — measure throughput through Redis and through the mount
+// ---------------------------------------------------------------------------
+
+type benchResult struct {
+	Scenario  string  `json:"scenario"`
+	Target    string  `json:"target"`
+	Ops       int     `json:"ops"`
+	Bytes     int64   `json:"bytes"`
+	Seconds   float64 `json:"seconds"`
+	OpsPerSec float64 `json:"ops_per_sec"`
+	MBPerSec  float64 `json:"mb_per_sec,omitempty"`
+	P50Ms     float64 `json:"p50_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+}
+
+func cmdBenchmark(args []string) error {
+	fs := newFlagSet("benchmark")
+	files := fs.Int("files", 100, "number of files for the sequential read/write scenarios")
+	size := byteSizeFlag(64 << 10)
+	fs.Var(&size, "size", "size of each file (e.g. 4k, 1m)")
+	metaFiles := fs.Int("meta-files", 500, "number of empty files for the metadata scenario")
+	key := fs.String("key", "", "benchmark key (must contain \"bench\"; defaults to a temporary key)")
+	mount := fs.Bool("mount", false, "also benchmark through the mountpoint, in a temporary directory inside it")
+	jsonOut := fs.Bool("json", false, "print results as JSON")
+	if _, err := parseInterspersed(fs, args[1:]); err != nil {
+		return fmt.Errorf("%w\n\nUsage: %s benchmark [--files n] [--size s] [--meta-files n] [--key name] [--mount] [--json]", err, filepath.Base(os.Args[0]))
+	}
+	if *files <= 0 || *metaFiles <= 0 {
+		return errors.New("--files and --meta-files must be positive")
+	}
+
+	benchKey := *key
+	if benchKey == "" {
+		benchKey = "rfs-bench-" + randomHex(4)
+	} else if !strings.Contains(benchKey, "bench") {
+		return fmt.Errorf("refusing to benchmark key %q: the name must contain \"bench\" so production data is never touched", benchKey)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return err
+	}
+	if benchKey == cfg.RedisKey {
+		return fmt.Errorf("refusing to benchmark the configured filesystem key %q", benchKey)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	rdb := newRedisClient(cfg, 4)
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("cannot connect to Redis at %s: %w", cfg.RedisAddr, err)
+	}
+
+	fsClient := client.New(rdb, benchKey)
+	if st, err := fsClient.Stat(ctx, "/"); err != nil {
+		return err
+	} else if st != nil {
+		return fmt.Errorf("key %q already exists; choose another --key", benchKey)
+	}
+	defer func() {
+		cctx, ccancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer ccancel()
+		_ = deleteNamespace(cctx, rdb, benchKey)
+	}()
+
+	payload := make([]byte, int64(size))
+	_, _ = rand.Read(payload)
+
+	var results []benchResult
+	run := func(label string, fn func() (benchResult, error)) error {
+		var s *uiStep
+		if !*jsonOut {
+			s = startStep(label)
+		}
+		r, err := fn()
+		if err != nil {
+			if s != nil {
+				s.fail(err.Error())
+			}
+			return err
+		}
+		if s != nil {
+			s.succeed(fmt.Sprintf("%.0f ops/s", r.OpsPerSec))
+		}
+		results = append(results, r)
+		return nil
+	}
+
+	redisOps := fsBenchOps{
+		write:  func(p string, b []byte) error { return fsClient.Echo(ctx, p, b) },
+		read:   func(p string) error { _, err := fsClient.Cat(ctx, p); return err },
+		create: func(p string) error { return fsClient.Touch(ctx, p) },
+		stat:   func(p string) error { _, err := fsClient.Stat(ctx, p); return err },
+		remove: func(p string) error { return fsClient.Rm(ctx, p) },
+	}
+	if err := runBenchSuite("redis", "/", redisOps, *files, *metaFiles, payload, run); err != nil {
+		return err
+	}
+
+	// The mount scenarios write into the live filesystem, so they only run
+	// when asked for. Failing to write there skips them rather than throwing
+	// away the Redis results.
+	var mountSkipped string
+	if *mount {
+		if err := benchMount(func(dir string) error {
+			mountOps := fsBenchOps{
+				write:  func(p string, b []byte) error { return os.WriteFile(p, b, 0o644) },
+				read:   func(p string) error { _, err := os.ReadFile(p); return err },
+				create: func(p string) error { return os.WriteFile(p, nil, 0o644) },
+				stat:   func(p string) error { _, err := os.Stat(p); return err },
+				remove: os.Remove,
+			}
+			return runBenchSuite("mount", dir, mountOps, *files, *metaFiles, payload, run)
+		}); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			mountSkipped = err.Error()
+			if !*jsonOut {
+				fmt.Printf("  %s mount scenarios skipped: %s\n", clr(ansiYellow, "!"), mountSkipped)
+			}
+		}
+	}
+
+	if *jsonOut {
+		out := map[string]interface{}{
+			"key":        benchKey,
+			"files":      *files,
+			"size":       int64(size),
+			"meta_files": *metaFiles,
+			"results":    results,
+		}
+		if mountSkipped != "" {
+			out["mount_skipped"] = mountSkipped
+		}
+		b, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+
+	rows := []boxRow{
+		{Label: "key", Value: benchKey + clr(ansiDim, " (deleted)")},
+		{Label: "workload", Value: fmt.Sprintf("%d × %s, %d metadata ops", *files, formatBytes(int64(size)), *metaFiles)},
+		{},
+	}
+	for _, r := range results {
+		v := fmt.Sprintf("%8.0f ops/s", r.OpsPerSec)
+		if r.MBPerSec > 0 {
+			v += fmt.Sprintf("  %7.1f MB/s", r.MBPerSec)
+		}
+		v += clr(ansiDim, fmt.Sprintf("  p50 %.2fms  p95 %.2fms", r.P50Ms, r.P95Ms))
+		rows = append(rows, boxRow{Label: r.Target + " " + r.Scenario, Value: v})
+	}
+	printBox(clr(ansiBold, "Benchmark results"), rows)
+	return nil
+}
+
+// benchMount runs fn on a fresh directory inside the active mountpoint and
+// removes the directory afterwards.
+func benchMount(fn func(dir string) error) error {
+	sts, err := loadState()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	st, ok := sts.running()
+	if !ok {
+		return errors.New("nothing is mounted")
+	}
+	backend, _, err := backendForState(st)
+	if err != nil {
+		return err
+	}
+	if !backend.IsMounted(st.Mountpoint) {
+		return fmt.Errorf("%s is not mounted", st.Mountpoint)
+	}
+	dir := filepath.Join(st.Mountpoint, ".rfs-bench-"+randomHex(4))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return fmt.Errorf("cannot write to %s: %w", st.Mountpoint, err)
+	}
+	defer os.RemoveAll(dir)
+	return fn(dir)
+}
+
+// fsBenchOps abstracts one benchmark target so the Redis client and the
+// mountpoint run identical scenarios.
+type fsBenchOps struct {
+	write  func(path string, data []byte) error
+	read   func(path string) error
+	create func(path string) error
+	stat   func(path string) error
+	remove func(path string) error
+}
+
+func runBenchSuite(target, dir string, ops fsBenchOps, files, metaFiles int, payload []byte,
+	run func(string, func() (benchResult, error)) error) error {
+	dataPath := func(i int) string { return filepath.Join(dir, fmt.Sprintf("data-%05d", i)) }
+	metaPath := func(i int) string { return filepath.Join(dir, fmt.Sprintf("meta-%05d", i)) }
+	size := int64(len(payload))
+
+	scenarios := []struct {
+		name  string
+		n     int
+		bytes int64
+		op    func(i int) error
+	}{
+		{"write", files, size, func(i int) error { return ops.write(dataPath(i), payload) }},
+		{"read", files, size, func(i int) error { return ops.read(dataPath(i)) }},
+		{"create", metaFiles, 0, func(i int) error { return ops.create(metaPath(i)) }},
+		{"stat", metaFiles, 0, func(i int) error { return ops.stat(metaPath(i)) }},
+		{"delete", metaFiles, 0, func(i int) error { return ops.remove(metaPath(i)) }},
+	}
+	for _, sc := range scenarios {
+		sc := sc
+		label := fmt.Sprintf("Benchmarking %s %s", target, sc.name)
+		if err := run(label, func() (benchResult, error) {
+			return measure(sc.name, target, sc.n, sc.bytes, sc.op)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func measure(scenario, target string, n int, bytesPerOp int64, op func(i int) error) (benchResult, error) {
+	lat := make([]time.Duration, n)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		t0 := time.Now()
+		if err := op(i); err != nil {
+			return benchResult{}, fmt.Errorf("%s %s #%d: %w", target, scenario, i, err)
+		}
+		lat[i] = time.Since(t0)
+	}
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1e-9
+	}
+
+	r := benchResult{
+		Scenario:  scenario,
+		Target:    target,
+		Ops:       n,
+		Bytes:     bytesPerOp * int64(n),
+		Seconds:   elapsed,
+		OpsPerSec: float64(n) / elapsed,
+		P50Ms:     percentileMs(lat, 0.50),
+		P95Ms:     percentileMs(lat, 0.95),
+	}
+	if r.Bytes > 0 {
+		r.MBPerSec = float64(r.Bytes) / (1 << 20) / elapsed
+	}
+	return r, nil
+}
+
+func percentileMs(samples []time.Duration, q float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(q*float64(len(sorted)-1) + 0.5)
+	return float64(sorted[idx]) / float64(time.Millisecond)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]int64{
+		"512":  512,
+		"64k":  64 << 10,
+		"64KB": 64 << 10,
+		"8MB":  8 << 20,
+		"1GiB": 1 << 30,
+	}
+	for in, want := range cases {
+		got, err := parseByteSize(in)
+		if err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "k", "-1", "1.5m", "12x"} {
+		if _, err := parseByteSize(bad); err == nil {
+			t.Errorf("parseByteSize(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestPercentileMs(t *testing.T) {
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	if got := percentileMs(samples, 0.50); got < 50 || got > 51 {
+		t.Errorf("p50 = %v, want ~50", got)
+	}
+	if got := percentileMs(samples, 0.95); got < 95 || got > 96 {
+		t.Errorf("p95 = %v, want ~95", got)
+	}
+	if samples[0] != 100*time.Millisecond {
+		t.Error("percentileMs reordered its input")
+	}
+}
+
+func TestBenchMountWithoutMount(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	called := false
+	err := benchMount(func(string) error { called = true; return nil })
+	if err == nil || called {
+		t.Fatalf("benchMount with nothing mounted: %v, ran %v", err, called)
+	}
+}
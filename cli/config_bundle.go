@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// config export/import — a portable configuration bundle
+// ---------------------------------------------------------------------------
+
+// configBundleVersion is bumped whenever the bundle layout changes in a way
+// older releases cannot read.
+const configBundleVersion = 1
+
+// maxBundleBytes bounds a bundle fetched with --from-url.
+const maxBundleBytes = 1 << 20
+
+type configBundle struct {
+	BundleVersion int       `json:"bundleVersion"`
+	ExportedAt    time.Time `json:"exportedAt"`
+	ExportedFrom  string    `json:"exportedFrom,omitempty"`
+	// PasswordOmitted marks a bundle exported without --include-secrets
+	// from a config that had a password, so import knows to ask for it.
+	PasswordOmitted bool   `json:"passwordOmitted,omitempty"`
+	Config          config `json:"config"`
+}
+
+func cmdConfig(args []string) error {
+	bin := filepath.Base(os.Args[0])
+	usage := fmt.Sprintf(`Usage: %[1]s config show [--json]
+       %[1]s config get <field>
+       %[1]s config set <field> <value>
+       %[1]s config validate
+       %[1]s config export <file> [--include-secrets]
+       %[1]s config import <file> | --from-url <https-url> [--force]`, bin)
+	if len(args) < 2 {
+		return errors.New(usage)
+	}
+	switch args[1] {
+	case "show":
+		return cmdConfigShow(args[1:], usage)
+	case "get":
+		return cmdConfigGet(args[1:], usage)
+	case "set":
+		return cmdConfigSet(args[1:], usage)
+	case "validate":
+		return cmdConfigValidate(args[1:], usage)
+	case "export":
+		return cmdConfigExport(args[1:], usage)
+	case "import":
+		return cmdConfigImport(args[1:], usage)
+	default:
+		return fmt.Errorf("unknown config command %q\n\n%s", args[1], usage)
+	}
+}
+
+func cmdConfigExport(args []string, usage string) error {
+	fs := newFlagSet("config export")
+	includeSecrets := fs.Bool("include-secrets", false, "include the Redis password in the bundle")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 1 {
+		return errors.New(usage)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return err
+	}
+
+	bundle := exportBundle(cfg, *includeSecrets)
+	b, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if pos[0] == "-" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	perm := os.FileMode(0o644)
+	if *includeSecrets {
+		perm = 0o600
+	}
+	if err := os.WriteFile(pos[0], b, perm); err != nil {
+		return err
+	}
+
+	fmt.Printf("  %s Exported configuration to %s\n", clr(ansiGreen, "✓"), clr(ansiCyan, pos[0]))
+	if bundle.PasswordOmitted {
+		fmt.Printf("  %s\n", clr(ansiDim, "The Redis password was left out; import will ask for it (or re-export with --include-secrets)"))
+	}
+	return nil
+}
+
+// exportBundle strips everything specific to this machine: resolved binary
+// paths are looked up again on import, and paths under the home directory
+// are written relative to ~ so they follow the importing user.
+func exportBundle(cfg config, includeSecrets bool) configBundle {
+	out := config{
+		UseExistingRedis: cfg.UseExistingRedis,
+		RedisAddr:        cfg.RedisAddr,
+		RedisUsername:    cfg.RedisUsername,
+		RedisDB:          cfg.RedisDB,
+		RedisKey:         cfg.RedisKey,
+		Mountpoint:       homeRelative(cfg.Mountpoint),
+		MountpointMode:   cfg.MountpointMode,
+		MountBackend:     cfg.MountBackend,
+		ReadOnly:         cfg.ReadOnly,
+		AllowOther:       cfg.AllowOther,
+		NFSHost:          cfg.NFSHost,
+		NFSPort:          cfg.NFSPort,
+		RedisLog:         homeRelative(cfg.RedisLog),
+		MountLog:         homeRelative(cfg.MountLog),
+		Persistence:      cfg.Persistence,
+		DataDir:          homeRelative(cfg.DataDir),
+		BindAddress:      cfg.BindAddress,
+
+		RedisTLS:           cfg.RedisTLS,
+		RedisTLSCACert:     homeRelative(cfg.RedisTLSCACert),
+		RedisTLSCert:       homeRelative(cfg.RedisTLSCert),
+		RedisTLSKey:        homeRelative(cfg.RedisTLSKey),
+		RedisTLSSkipVerify: cfg.RedisTLSSkipVerify,
+	}
+	for _, e := range cfg.Filesystems {
+		e.Mountpoint = homeRelative(e.Mountpoint)
+		out.Filesystems = append(out.Filesystems, e)
+	}
+	bundle := configBundle{
+		BundleVersion: configBundleVersion,
+		ExportedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	if host, err := os.Hostname(); err == nil {
+		bundle.ExportedFrom = host
+	}
+	if includeSecrets {
+		out.RedisPassword = cfg.RedisPassword
+	} else {
+		bundle.PasswordOmitted = cfg.RedisPassword != ""
+	}
+	bundle.Config = out
+	return bundle
+}
+
+func homeRelative(p string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || p == "" {
+		return p
+	}
+	if rel, err := filepath.Rel(home, p); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		return "~/" + filepath.ToSlash(rel)
+	}
+	return p
+}
+
+func cmdConfigImport(args []string, usage string) error {
+	fs := newFlagSet("config import")
+	fromURL := fs.String("from-url", "", "fetch the bundle over HTTPS")
+	force := fs.Bool("force", false, "replace an existing configuration without asking")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if (*fromURL == "" && len(pos) != 1) || (*fromURL != "" && len(pos) != 0) {
+		return errors.New(usage)
+	}
+
+	sts, err := loadState()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if _, ok := sts.running(); ok {
+		return fmt.Errorf("redis-fs is currently running\nRun '%s down' first", filepath.Base(os.Args[0]))
+	}
+
+	var raw []byte
+	var source string
+	if *fromURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		raw, err = fetchBundle(ctx, http.DefaultClient, *fromURL)
+		source = *fromURL
+	} else {
+		raw, err = os.ReadFile(pos[0])
+		source = pos[0]
+	}
+	if err != nil {
+		return err
+	}
+
+	bundle, err := parseBundle(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+
+	r := bufio.NewReader(os.Stdin)
+	if _, err := os.Stat(configPath()); err == nil && !*force {
+		ok, err := promptYesNo(r, os.Stdout, fmt.Sprintf("  Replace the existing configuration at %s?", configPath()), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("import cancelled")
+		}
+	}
+
+	cfg, err := applyBundle(bundle, r, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if err := saveConfig(cfg); err != nil {
+		return err
+	}
+
+	from := ""
+	if bundle.ExportedFrom != "" {
+		from = " from " + bundle.ExportedFrom
+	}
+	fmt.Printf("  %s Imported configuration%s\n", clr(ansiGreen, "✓"), from)
+	fmt.Printf("  %s Saved to %s\n", clr(ansiDim, "▸"), clr(ansiCyan, configPath()))
+	fmt.Printf("  %s\n", clr(ansiDim, "Run '"+filepath.Base(os.Args[0])+" up' to mount "+cfg.RedisKey+" at "+cfg.Mountpoint))
+	return nil
+}
+
+func fetchBundle(ctx context.Context, hc *http.Client, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --from-url: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("refusing to fetch %s: bundles may carry credentials, so only https URLs are accepted", rawURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch bundle: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch bundle: %s returned %s", rawURL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxBundleBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch bundle: %w", err)
+	}
+	if len(b) > maxBundleBytes {
+		return nil, fmt.Errorf("fetch bundle: response exceeds %s", formatBytes(maxBundleBytes))
+	}
+	return b, nil
+}
+
+// parseBundle decodes a bundle and checks it describes a usable
+// configuration before anything on this machine is touched.
+func parseBundle(raw []byte) (configBundle, error) {
+	var b configBundle
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return b, fmt.Errorf("not a configuration bundle: %w", err)
+	}
+	switch {
+	case b.BundleVersion <= 0:
+		return b, errors.New("not a configuration bundle: missing bundleVersion")
+	case b.BundleVersion > configBundleVersion:
+		return b, fmt.Errorf("bundle version %d is newer than this release supports (%d); upgrade %s", b.BundleVersion, configBundleVersion, filepath.Base(os.Args[0]))
+	}
+
+	c := b.Config
+	if len(c.Filesystems) > 0 {
+		if err := c.checkFilesystems(); err != nil {
+			return b, fmt.Errorf("bundle: %w", err)
+		}
+	} else if strings.TrimSpace(c.RedisKey) == "" {
+		return b, errors.New("bundle has no redisKey")
+	} else if strings.TrimSpace(c.Mountpoint) == "" {
+		return b, errors.New("bundle has no mountpoint")
+	}
+	if _, _, err := splitAddr(c.RedisAddr); err != nil {
+		return b, fmt.Errorf("bundle redisAddr: %w", err)
+	}
+	if _, err := normalizeMountBackend(c.MountBackend); err != nil {
+		return b, err
+	}
+	if _, err := parseMountpointMode(c.MountpointMode); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// applyBundle turns a parsed bundle into a config for this machine. Binary
+// paths are resolved fresh, and whatever cannot be resolved or was left
+// out of the bundle is asked for.
+func applyBundle(b configBundle, r *bufio.Reader, out io.Writer) (config, error) {
+	cfg := b.Config
+	cfg.RedisServerBin, cfg.MountBin, cfg.NFSBin, cfg.ModulePath = "", "", "", ""
+	if cfg.RedisLog == "" {
+		cfg.RedisLog = "/tmp/rfs-redis.log"
+	}
+	if cfg.MountLog == "" {
+		cfg.MountLog = "/tmp/rfs-mount.log"
+	}
+	cfg.Filesystems = append([]fsEntry(nil), cfg.Filesystems...)
+	paths := []*string{&cfg.Mountpoint, &cfg.RedisLog, &cfg.MountLog, &cfg.RedisTLSCACert, &cfg.RedisTLSCert, &cfg.RedisTLSKey}
+	for i := range cfg.Filesystems {
+		paths = append(paths, &cfg.Filesystems[i].Mountpoint)
+	}
+	for _, p := range paths {
+		v, err := expandPath(*p)
+		if err != nil {
+			return cfg, err
+		}
+		*p = v
+	}
+
+	if b.PasswordOmitted && cfg.RedisPassword == "" && !cfg.UseExistingRedis {
+		// A managed server's password was this machine's own; use ours.
+		pwd, err := managedRedisPassword()
+		if err != nil {
+			return cfg, err
+		}
+		cfg.RedisPassword = pwd
+	} else if b.PasswordOmitted && cfg.RedisPassword == "" {
+		pwd, err := promptString(r, out, "  Redis password for "+cfg.RedisAddr, "")
+		if err != nil {
+			return cfg, err
+		}
+		cfg.RedisPassword = pwd
+	}
+
+	for {
+		err := resolveConfigPaths(&cfg)
+		var missing *missingBinaryError
+		if !errors.As(err, &missing) {
+			return cfg, err
+		}
+		fmt.Fprintf(out, "  %s %s\n", clr(ansiYellow, "!"), strings.ReplaceAll(err.Error(), "\n", " —"))
+		p, err := promptString(r, out, "  Path to "+missing.name, "")
+		if err != nil {
+			return cfg, err
+		}
+		if p == "" {
+			return cfg, missing
+		}
+		resolved, err := resolveBinary(p)
+		if err != nil {
+			return cfg, err
+		}
+		if _, err := os.Stat(resolved); err != nil {
+			return cfg, err
+		}
+		switch missing.field {
+		case "mountBin":
+			cfg.MountBin = resolved
+		case "nfsBin":
+			cfg.NFSBin = resolved
+		case "redisServerBin":
+			cfg.RedisServerBin = resolved
+		}
+	}
+}
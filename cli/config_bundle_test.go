@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportBundleSanitizes(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfg := config{
+		UseExistingRedis: true,
+		RedisAddr:        "redis.internal:6380",
+		RedisPassword:    "hunter2",
+		RedisKey:         "team",
+		Mountpoint:       filepath.Join(home, "team-fs"),
+		MountBackend:     mountBackendFuse,
+		RedisServerBin:   "/opt/redis/bin/redis-server",
+		MountBin:         "/opt/rfs/redis-fs-mount",
+		NFSBin:           "/opt/rfs/redis-fs-nfs",
+		RedisLog:         "/tmp/rfs-redis.log",
+	}
+
+	b := exportBundle(cfg, false)
+	if b.BundleVersion != configBundleVersion {
+		t.Errorf("bundle version = %d", b.BundleVersion)
+	}
+	if b.Config.RedisPassword != "" || !b.PasswordOmitted {
+		t.Errorf("password exported without --include-secrets: %+v", b)
+	}
+	if b.Config.RedisServerBin != "" || b.Config.MountBin != "" || b.Config.NFSBin != "" {
+		t.Errorf("local binary paths exported: %+v", b.Config)
+	}
+	if b.Config.Mountpoint != "~/team-fs" {
+		t.Errorf("mountpoint = %q, want ~/team-fs", b.Config.Mountpoint)
+	}
+	if b.Config.RedisLog != "/tmp/rfs-redis.log" {
+		t.Errorf("redis log = %q", b.Config.RedisLog)
+	}
+
+	withSecrets := exportBundle(cfg, true)
+	if withSecrets.Config.RedisPassword != "hunter2" || withSecrets.PasswordOmitted {
+		t.Errorf("--include-secrets bundle = %+v", withSecrets)
+	}
+}
+
+func TestParseBundleRejects(t *testing.T) {
+	valid := configBundle{BundleVersion: 1, Config: config{RedisAddr: "localhost:6379", RedisKey: "k", Mountpoint: "~/k"}}
+	cases := map[string]func(b *configBundle){
+		"missing version": func(b *configBundle) { b.BundleVersion = 0 },
+		"newer version":   func(b *configBundle) { b.BundleVersion = configBundleVersion + 1 },
+		"no key":          func(b *configBundle) { b.Config.RedisKey = "" },
+		"no mountpoint":   func(b *configBundle) { b.Config.Mountpoint = "" },
+		"bad addr":        func(b *configBundle) { b.Config.RedisAddr = "localhost" },
+		"bad backend":     func(b *configBundle) { b.Config.MountBackend = "smb" },
+		"bad mode":        func(b *configBundle) { b.Config.MountpointMode = "rwx" },
+	}
+	for name, mutate := range cases {
+		b := valid
+		mutate(&b)
+		raw, _ := json.Marshal(b)
+		if _, err := parseBundle(raw); err == nil {
+			t.Errorf("%s: parseBundle succeeded", name)
+		}
+	}
+	raw, _ := json.Marshal(valid)
+	if _, err := parseBundle(raw); err != nil {
+		t.Errorf("valid bundle rejected: %v", err)
+	}
+	if _, err := parseBundle([]byte("not json")); err == nil {
+		t.Error("garbage accepted")
+	}
+}
+
+func TestApplyBundlePromptsForUnresolvable(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", t.TempDir())
+	mountBin := filepath.Join(t.TempDir(), "redis-fs-mount")
+	if err := os.WriteFile(mountBin, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	b := configBundle{
+		BundleVersion:   1,
+		PasswordOmitted: true,
+		Config: config{
+			UseExistingRedis: true,
+			RedisAddr:        "redis.internal:6380",
+			RedisKey:         "team",
+			Mountpoint:       "~/team-fs",
+			MountBackend:     mountBackendFuse,
+			MountBin:         "/somewhere/else/redis-fs-mount",
+		},
+	}
+	in := bufio.NewReader(strings.NewReader("s3cret\n" + mountBin + "\n"))
+	cfg, err := applyBundle(b, in, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RedisPassword != "s3cret" {
+		t.Errorf("password = %q", cfg.RedisPassword)
+	}
+	if cfg.MountBin != mountBin {
+		t.Errorf("mount bin = %q, want the prompted %q", cfg.MountBin, mountBin)
+	}
+	if cfg.Mountpoint != filepath.Join(home, "team-fs") {
+		t.Errorf("mountpoint = %q", cfg.Mountpoint)
+	}
+
+	// An empty answer gives up with the original resolution error.
+	b.PasswordOmitted = false
+	_, err = applyBundle(b, bufio.NewReader(strings.NewReader("\n")), io.Discard)
+	var missing *missingBinaryError
+	if !errors.As(err, &missing) || missing.name != "redis-fs-mount" {
+		t.Errorf("err = %v, want missing redis-fs-mount", err)
+	}
+}
+
+func TestFetchBundle(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bundle.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"bundleVersion":1}`))
+	}))
+	defer ts.Close()
+
+	b, err := fetchBundle(context.Background(), ts.Client(), ts.URL+"/bundle.json")
+	if err != nil || string(b) != `{"bundleVersion":1}` {
+		t.Fatalf("fetch = %q, %v", b, err)
+	}
+	if _, err := fetchBundle(context.Background(), ts.Client(), ts.URL+"/missing"); err == nil {
+		t.Error("404 accepted")
+	}
+	if _, err := fetchBundle(context.Background(), ts.Client(), "http://example.com/bundle.json"); err == nil {
+		t.Error("plain http accepted")
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// config show / get / set / validate — read and edit the config by field
+// ---------------------------------------------------------------------------
+//
+// Fields go by their names in the config file, such as redisAddr. show and
+// get report the effective config, RFS_* variables included; set changes
+// the file, so scripts can tweak a setting without knowing where the file
+// is, and checks the value before saving it.
+
+// configFieldNames lists the config file's fields, in file order.
+func configFieldNames() []string {
+	var names []string
+	t := reflect.TypeOf(config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := jsonFieldName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// jsonFieldName is f's name in the config file, or "" when f is not saved.
+func jsonFieldName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// configField returns the field of cfg called name in the config file.
+func configField(cfg *config, name string) (reflect.Value, error) {
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if jsonFieldName(v.Type().Field(i)) == name {
+			return v.Field(i), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("unknown config field %q\nValid fields: %s", name, strings.Join(configFieldNames(), ", "))
+}
+
+// fieldEnvVar names the RFS_* variable that set field of cfg, if one did.
+func fieldEnvVar(cfg *config, field reflect.Value) string {
+	for _, e := range envFields {
+		if reflect.ValueOf(e.field(cfg)).Pointer() == field.Addr().Pointer() {
+			if slices.Contains(cfg.fromEnv, e.name) {
+				return e.name
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// formatConfigValue renders a field as get prints it: strings as they are,
+// everything else as JSON.
+func formatConfigValue(field reflect.Value) string {
+	if field.Kind() == reflect.String {
+		return field.String()
+	}
+	b, _ := json.Marshal(field.Interface())
+	return string(b)
+}
+
+// loadConfigForEdit loads the config for show, get and validate, which
+// need one.
+func loadConfigForEdit() (config, error) {
+	cfg, err := loadConfig()
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("no configuration found at %s\nRun '%s setup' first", configPath(), filepath.Base(os.Args[0]))
+	}
+	return cfg, err
+}
+
+func cmdConfigShow(args []string, usage string) error {
+	fs := newFlagSet("config show")
+	asJSON := fs.Bool("json", false, "print the config as JSON")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 0 {
+		return errors.New(usage)
+	}
+	cfg, err := loadConfigForEdit()
+	if err != nil {
+		return err
+	}
+	shown := cfg
+	if shown.RedisPassword != "" {
+		shown.RedisPassword = "********"
+	}
+	shown.RedisURL = redactURL(shown.RedisURL)
+
+	if *asJSON {
+		b, err := json.MarshalIndent(shown, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	var rows []boxRow
+	for _, name := range configFieldNames() {
+		field, _ := configField(&shown, name)
+		if field.IsZero() && field.Kind() != reflect.Bool {
+			continue
+		}
+		value := formatConfigValue(field)
+		if env := fieldEnvVar(&shown, field); env != "" {
+			value += " " + clr(ansiDim, "("+env+")")
+		}
+		rows = append(rows, boxRow{Label: name, Value: value})
+	}
+	fmt.Println()
+	printBox(clr(ansiBold, "Config")+" "+clr(ansiDim, configPathLabel()), rows)
+	return nil
+}
+
+func cmdConfigGet(args []string, usage string) error {
+	if len(args) != 2 {
+		return errors.New(usage)
+	}
+	cfg, err := loadConfigForEdit()
+	if err != nil {
+		return err
+	}
+	field, err := configField(&cfg, args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Println(formatConfigValue(field))
+	return nil
+}
+
+func cmdConfigSet(args []string, usage string) error {
+	if len(args) != 3 {
+		return errors.New(usage)
+	}
+	name, value := args[1], args[2]
+
+	// A missing file is created from the defaults.
+	cfg, err := loadConfig()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	field, err := configField(&cfg, name)
+	if err != nil {
+		return err
+	}
+	env := fieldEnvVar(&cfg, field)
+	// Edit what the file holds, not what the environment put over it.
+	cfg = cfg.withoutEnv()
+	cfg.fromEnv, cfg.beforeEnv = nil, nil
+	field, _ = configField(&cfg, name)
+
+	// Values parse as they do from RFS_* variables.
+	switch p := field.Addr().Interface().(type) {
+	case *string, *bool, *int:
+		if err := setEnvField(p, name, value); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s cannot be set with config set; edit %s", name, configPath())
+	}
+	if err := checkConfigField(cfg, name); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := saveConfig(cfg); err != nil {
+		return err
+	}
+	shown := formatConfigValue(field)
+	switch name {
+	case "redisPassword":
+		shown = "********"
+	case "redisURL":
+		shown = redactURL(shown)
+	}
+	fmt.Printf("  %s %s = %s %s\n", clr(ansiGreen, "✓"), name, shown, clr(ansiDim, "in "+configPath()))
+	if env != "" {
+		fmt.Printf("  %s %s is set and wins over this value\n", clr(ansiYellow, "!"), env)
+	}
+	return nil
+}
+
+// checkConfigField checks the value config set just gave the field name,
+// as far as it can be checked without the rest of the machine.
+func checkConfigField(cfg config, name string) error {
+	var err error
+	switch name {
+	case "redisAddr":
+		_, _, err = splitAddr(cfg.RedisAddr)
+	case "redisURL":
+		if cfg.RedisURL != "" {
+			err = applyRedisURL(&cfg, cfg.RedisURL)
+		}
+	case "redisSocket":
+		err = applyRedisSocket(&cfg)
+	case "redisPassword":
+		if cfg.RedisPasswordFile != "" && cfg.RedisPassword != "" {
+			err = fmt.Errorf("redisPasswordFile is set, so the password is read from %s\nWrite it there, or clear redisPasswordFile first", cfg.RedisPasswordFile)
+		}
+	case "redisPasswordFile":
+		if cfg.RedisPasswordFile != "" {
+			err = readRedisPasswordFile(&cfg)
+		}
+	case "redisKey":
+		if strings.TrimSpace(cfg.RedisKey) == "" {
+			err = errors.New("must not be empty")
+		}
+	case "mountBackend":
+		_, err = normalizeMountBackend(cfg.MountBackend)
+	case "mountpointMode":
+		_, err = parseMountpointMode(cfg.MountpointMode)
+	case "persistence":
+		err = checkPersistence(cfg.Persistence)
+	case "nfsPort":
+		if cfg.NFSPort > 65535 {
+			err = errors.New("must be a port number, at most 65535")
+		}
+	}
+	return err
+}
+
+func cmdConfigValidate(args []string, usage string) error {
+	if len(args) != 1 {
+		return errors.New(usage)
+	}
+	cfg, err := loadConfigForEdit()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	s := startStep("Checking the config")
+	if err := cfg.checkFilesystems(); err != nil {
+		s.fail(err.Error())
+		return fmt.Errorf("%s: %w", configPath(), err)
+	}
+	for _, e := range cfg.filesystems() {
+		fsCfg := cfg.forFilesystem(e)
+		if err := resolveConfigPaths(&fsCfg); err != nil {
+			s.fail(err.Error())
+			return err
+		}
+	}
+	s.succeed(configPath())
+
+	s = startStep("Connecting to Redis")
+	rdb := newRedisClient(cfg, 1)
+	defer rdb.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = rdb.Ping(ctx).Err()
+	var reply redis.Error
+	switch {
+	case err == nil:
+		s.succeed(cfg.RedisAddr)
+	case !cfg.UseExistingRedis && !errors.As(err, &reply):
+		s.succeed(clr(ansiDim, "managed Redis is not running; up starts it"))
+	default:
+		s.fail(redisConnectFailure(cfg, err))
+		return fmt.Errorf("cannot reach Redis at %s: %w", cfg.RedisAddr, err)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rfs.config.json")
+	t.Setenv(configEnv, path)
+
+	// A missing file is created from the defaults.
+	if err := cmdConfigSet([]string{"set", "redisKey", "notes"}, "usage"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range [][]string{
+		{"set", "redisDB", "2"},
+		{"set", "readOnly", "true"},
+		{"set", "mountBackend", "nfs"},
+	} {
+		if err := cmdConfigSet(c, "usage"); err != nil {
+			t.Fatalf("%q: %v", c, err)
+		}
+	}
+
+	for _, c := range []struct{ field, value, want string }{
+		{"redisKy", "x", "Valid fields: useExistingRedis, redisAddr"},
+		{"redisDB", "two", `redisDB="two"`},
+		{"readOnly", "yes", `readOnly="yes"`},
+		{"mountBackend", "smb", "mountBackend:"},
+		{"redisKey", " ", "must not be empty"},
+		{"filesystems", "[]", "cannot be set"},
+	} {
+		if err := cmdConfigSet([]string{"set", c.field, c.value}, "usage"); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("set %s %q: %v, want an error with %q", c.field, c.value, err, c.want)
+		}
+	}
+
+	// The environment wins when loading, but set edits the file.
+	t.Setenv("RFS_REDIS_DB", "7")
+	if err := cmdConfigSet([]string{"set", "redisKey", "docs"}, "usage"); err != nil {
+		t.Fatal(err)
+	}
+	var saved config
+	if b, err := os.ReadFile(path); err != nil || json.Unmarshal(b, &saved) != nil {
+		t.Fatalf("saved config: %s, %v", b, err)
+	}
+	if saved.RedisKey != "docs" || saved.RedisDB != 2 || !saved.ReadOnly || saved.MountBackend != "nfs" || saved.RedisAddr != "localhost:6379" {
+		t.Fatalf("saved: %+v", saved)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _ := configField(&cfg, "redisDB")
+	key, _ := configField(&cfg, "redisKey")
+	if formatConfigValue(db) != "7" || fieldEnvVar(&cfg, db) != "RFS_REDIS_DB" || formatConfigValue(key) != "docs" || fieldEnvVar(&cfg, key) != "" {
+		t.Fatalf("get: redisDB %s (%s), redisKey %s", formatConfigValue(db), fieldEnvVar(&cfg, db), formatConfigValue(key))
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// Client-side encryption of file contents at rest in Redis
+// ---------------------------------------------------------------------------
+
+// Encryption fields in the info hash. They name the scheme and identify
+// the key by fingerprint; the key itself is never written to Redis.
+const (
+	encryptionField            = "encryption"
+	encryptionFingerprintField = "encryption_key_fingerprint"
+)
+
+const encryptionScheme = "aes-256-gcm"
+
+// sealedMagic starts every encrypted file's contents. It marks the file as
+// ciphertext and versions the layout that follows: a 12-byte nonce, then
+// the GCM-sealed contents.
+var sealedMagic = []byte("RFSENC1\x00")
+
+// fileCipher seals file contents with AES-256-GCM. Each file gets a fresh
+// random nonce, and its path is bound in as additional data, so ciphertext
+// copied from one file onto another fails to open.
+type fileCipher struct {
+	aead        cipher.AEAD
+	fingerprint string
+}
+
+func newFileCipher(key []byte) (*fileCipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &fileCipher{aead: aead, fingerprint: keyFingerprint(key)}, nil
+}
+
+// keyFingerprint identifies a key without revealing it: a truncated,
+// domain-separated SHA-256.
+func keyFingerprint(key []byte) string {
+	sum := sha256.Sum256(append([]byte("rfs-key-fingerprint\x00"), key...))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+func (c *fileCipher) seal(path string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sealedMagic)+len(nonce)+len(plaintext)+c.aead.Overhead())
+	out = append(out, sealedMagic...)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, plaintext, []byte(path)), nil
+}
+
+// overhead is how many bytes sealing adds to a file's contents.
+func (c *fileCipher) overhead() int64 {
+	return int64(len(sealedMagic) + c.aead.NonceSize() + c.aead.Overhead())
+}
+
+func (c *fileCipher) open(path string, sealed []byte) ([]byte, error) {
+	if !bytes.HasPrefix(sealed, sealedMagic) {
+		return nil, fmt.Errorf("%s: not encrypted, although the filesystem is; it may have been written without the key", path)
+	}
+	body := sealed[len(sealedMagic):]
+	if len(body) < c.aead.NonceSize()+c.aead.Overhead() {
+		return nil, fmt.Errorf("%s: ciphertext is truncated", path)
+	}
+	nonce, body := body[:c.aead.NonceSize()], body[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, body, []byte(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: ciphertext failed authentication; it was modified, moved from another path, or sealed with a different key", path)
+	}
+	return plaintext, nil
+}
+
+// parseKeyMaterial accepts a raw 32-byte key, or 64 hex digits, or base64
+// of 32 bytes, ignoring surrounding whitespace.
+func parseKeyMaterial(b []byte) ([]byte, error) {
+	if len(b) == 32 {
+		return b, nil
+	}
+	s := strings.TrimSpace(string(b))
+	if k, err := hex.DecodeString(s); err == nil && len(k) == 32 {
+		return k, nil
+	}
+	if k, err := base64.StdEncoding.DecodeString(s); err == nil && len(k) == 32 {
+		return k, nil
+	}
+	return nil, errors.New("expected 32 raw bytes, 64 hex digits, or base64 of 32 bytes (try: openssl rand -hex 32)")
+}
+
+// keyFlags are the encryption flags shared by the mount-less commands.
+type keyFlags struct {
+	encrypt    bool
+	keyFile    string
+	keyCommand string
+}
+
+func (k *keyFlags) register(fs *flag.FlagSet, withEncrypt bool) {
+	if withEncrypt {
+		fs.BoolVar(&k.encrypt, "encrypt", false, "encrypt file contents before they reach Redis")
+	}
+	fs.StringVar(&k.keyFile, "key-file", "", "read the encryption key from this file")
+	fs.StringVar(&k.keyCommand, "key-command", "", "run this shell command and read the encryption key from its output")
+}
+
+// load reads the key from --key-file or --key-command; nil when neither
+// was given.
+func (k keyFlags) load() (*fileCipher, error) {
+	var raw []byte
+	var err error
+	switch {
+	case k.keyFile != "" && k.keyCommand != "":
+		return nil, errors.New("--key-file and --key-command are mutually exclusive")
+	case k.keyFile != "":
+		path, perr := expandPath(k.keyFile)
+		if perr != nil {
+			return nil, perr
+		}
+		if raw, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("read key file: %w", err)
+		}
+	case k.keyCommand != "":
+		cmd := exec.Command("sh", "-c", k.keyCommand)
+		cmd.Stderr = os.Stderr
+		if raw, err = cmd.Output(); err != nil {
+			return nil, fmt.Errorf("key command: %w", err)
+		}
+	default:
+		if k.encrypt {
+			return nil, errors.New("--encrypt needs --key-file or --key-command")
+		}
+		return nil, nil
+	}
+	key, err := parseKeyMaterial(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return newFileCipher(key)
+}
+
+// keyEncryption is what a filesystem's info hash says about encryption.
+type keyEncryption struct {
+	Scheme      string `json:"scheme"`
+	Fingerprint string `json:"key_fingerprint"`
+}
+
+func readKeyEncryption(ctx context.Context, rdb *redis.Client, fsKey string) (*keyEncryption, error) {
+	vals, err := rdb.HMGet(ctx, infoKey(fsKey), encryptionField, encryptionFingerprintField).Result()
+	if err != nil {
+		return nil, err
+	}
+	scheme, _ := vals[0].(string)
+	if scheme == "" {
+		return nil, nil
+	}
+	fp, _ := vals[1].(string)
+	return &keyEncryption{Scheme: scheme, Fingerprint: fp}, nil
+}
+
+func recordKeyEncryption(ctx context.Context, rdb *redis.Client, fsKey string, c *fileCipher) error {
+	return rdb.HSet(ctx, infoKey(fsKey), encryptionField, encryptionScheme, encryptionFingerprintField, c.fingerprint).Err()
+}
+
+// cipherForKey reconciles the key the user supplied (c, possibly nil) with
+// the filesystem's recorded encryption, and returns the cipher to read and
+// write contents with: nil for a plaintext filesystem.
+func cipherForKey(ctx context.Context, rdb *redis.Client, fsKey string, c *fileCipher) (*fileCipher, error) {
+	enc, err := readKeyEncryption(ctx, rdb, fsKey)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return nil, nil
+	}
+	if enc.Scheme != encryptionScheme {
+		return nil, fmt.Errorf("filesystem %q is encrypted with %q, which this version does not support", fsKey, enc.Scheme)
+	}
+	if c == nil {
+		return nil, fmt.Errorf("filesystem %q is encrypted (key %s)\nPass the key with --key-file or --key-command", fsKey, enc.Fingerprint)
+	}
+	if c.fingerprint != enc.Fingerprint {
+		return nil, fmt.Errorf("wrong key for filesystem %q: it was encrypted with key %s, not %s", fsKey, enc.Fingerprint, c.fingerprint)
+	}
+	return c, nil
+}
+
+// checkMountable refuses to mount an encrypted filesystem. The mount
+// daemon serves stored bytes as they are and cannot decrypt them, so a
+// mount would present ciphertext as file contents.
+func checkMountable(ctx context.Context, rdb *redis.Client, fsKey string) error {
+	enc, err := readKeyEncryption(ctx, rdb, fsKey)
+	if err != nil || enc == nil {
+		return err
+	}
+	bin := filepath.Base(os.Args[0])
+	return fmt.Errorf("filesystem %q is encrypted at rest (%s, key %s) and the mount daemon cannot decrypt it\nRead it without mounting: '%s cat' or '%s export' with --key-file or --key-command",
+		fsKey, enc.Scheme, enc.Fingerprint, bin, bin)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/redis-fs/mount/client"
+	"github.com/redis/go-redis/v9"
+)
+
+func testCipher(t *testing.T, fill byte) *fileCipher {
+	t.Helper()
+	c, err := newFileCipher(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// importEncrypted imports the fixture tree into a fresh key encrypted with c.
+func importEncrypted(t *testing.T, c *fileCipher) (context.Context, *fsTestEnv) {
+	t.Helper()
+	ctx := context.Background()
+	rdb := testRedis(t)
+	key := testKey(t, rdb)
+	env := &fsTestEnv{rdb: rdb, key: key, fsClient: client.New(rdb, key), root: writeFixtureTree(t)}
+	var opts importOptions
+	if err := prepareImportTarget(ctx, rdb, env.fsClient, key, true, c, &opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.cipher != c {
+		t.Fatal("import did not pick up the cipher")
+	}
+	if _, err := importDirectory(ctx, env.fsClient, env.root, opts, nil); err != nil {
+		t.Fatal(err)
+	}
+	return ctx, env
+}
+
+func TestEncryptedImportExportRoundTrip(t *testing.T) {
+	c := testCipher(t, 7)
+	ctx, env := importEncrypted(t, c)
+
+	raw, err := env.fsClient.Cat(ctx, "/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, sealedMagic) || bytes.Contains(raw, []byte("hello")) {
+		t.Fatalf("stored contents %q are not ciphertext", raw)
+	}
+	enc, err := readKeyEncryption(ctx, env.rdb, env.key)
+	if err != nil || enc == nil || enc.Scheme != encryptionScheme || enc.Fingerprint != c.fingerprint {
+		t.Fatalf("recorded encryption %+v, %v", enc, err)
+	}
+	fields, _ := env.rdb.HGetAll(ctx, infoKey(env.key)).Result()
+	for name, v := range fields {
+		if strings.Contains(v, hex.EncodeToString(bytes.Repeat([]byte{7}, 32))) {
+			t.Fatalf("info field %s holds the key", name)
+		}
+	}
+
+	got, err := cipherForKey(ctx, env.rdb, env.key, testCipher(t, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	stats, err := exportTree(ctx, env.fsClient, got, out, exportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 4 || stats.Dirs != 4 || stats.Symlinks != 1 {
+		t.Fatalf("export stats %+v", stats)
+	}
+	assertSameTree(t, env.root, out)
+}
+
+func TestEncryptedTamperDetection(t *testing.T) {
+	c := testCipher(t, 7)
+	ctx, env := importEncrypted(t, c)
+	sealed, err := env.fsClient.Cat(ctx, "/README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := env.fsClient.Cat(ctx, "/src/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 1
+	cases := []struct {
+		name   string
+		stored []byte
+		want   string
+	}{
+		{"flipped bit", flipped, "failed authentication"},
+		{"moved from another path", other, "failed authentication"},
+		{"truncated", sealed[:len(sealedMagic)+4], "truncated"},
+		{"plaintext", []byte("# hello\n"), "not encrypted"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := env.fsClient.Echo(ctx, "/README.md", tc.stored); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readContents(ctx, env.fsClient, c, "/README.md"); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("read: %v, want %q", err, tc.want)
+			}
+			if _, err := exportTree(ctx, env.fsClient, c, filepath.Join(t.TempDir(), "out"), exportOptions{}); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("export: %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestEncryptedKeyChecks(t *testing.T) {
+	c := testCipher(t, 7)
+	ctx, env := importEncrypted(t, c)
+
+	if _, err := cipherForKey(ctx, env.rdb, env.key, nil); err == nil || !strings.Contains(err.Error(), "--key-file") {
+		t.Fatalf("no key: %v", err)
+	}
+	if _, err := cipherForKey(ctx, env.rdb, env.key, testCipher(t, 8)); err == nil || !strings.Contains(err.Error(), "wrong key") {
+		t.Fatalf("wrong key: %v", err)
+	}
+	if err := checkMountable(ctx, env.rdb, env.key); err == nil || !strings.Contains(err.Error(), "cannot decrypt") {
+		t.Fatalf("mount check: %v", err)
+	}
+
+	// A merge into the encrypted key needs its key; --encrypt cannot merge
+	// into a plaintext one.
+	opts := importOptions{merge: true}
+	if err := prepareImportTarget(ctx, env.rdb, env.fsClient, env.key, false, nil, &opts); err == nil {
+		t.Fatal("merge without the key was allowed")
+	}
+	plainKey := testKey(t, env.rdb)
+	plain := client.New(env.rdb, plainKey)
+	if _, err := importDirectory(ctx, plain, writeFixtureTree(t), importOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkMountable(ctx, env.rdb, plainKey); err != nil {
+		t.Fatalf("plaintext key refused: %v", err)
+	}
+	if err := prepareImportTarget(ctx, env.rdb, plain, plainKey, true, c, &opts); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+		t.Fatalf("encrypted merge into plaintext: %v", err)
+	}
+}
+
+func TestParseKeyMaterial(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+	for _, in := range [][]byte{
+		key,
+		[]byte(hex.EncodeToString(key) + "\n"),
+		[]byte("q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s=\n"),
+	} {
+		got, err := parseKeyMaterial(in)
+		if err != nil || !bytes.Equal(got, key) {
+			t.Errorf("parseKeyMaterial(%q) = %x, %v", in, got, err)
+		}
+	}
+	if _, err := parseKeyMaterial([]byte("too short")); err == nil {
+		t.Error("short key accepted")
+	}
+}
+
+type fsTestEnv struct {
+	rdb      *redis.Client
+	key      string
+	fsClient client.Client
+	root     string
+}
+
+// assertSameTree checks that got holds the same entries, contents, modes
+// and modification times as want.
+func assertSameTree(t *testing.T, want, got string) {
+	t.Helper()
+	err := filepath.WalkDir(want, func(p string, d os.DirEntry, err error) error {
+		if err != nil || p == want {
+			return err
+		}
+		rel, _ := filepath.Rel(want, p)
+		wi, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		gi, err := os.Lstat(filepath.Join(got, rel))
+		if err != nil {
+			t.Errorf("%s: %v", rel, err)
+			return nil
+		}
+		if wi.Mode() != gi.Mode() {
+			t.Errorf("%s: mode %v, want %v", rel, gi.Mode(), wi.Mode())
+		}
+		switch {
+		case wi.Mode()&os.ModeSymlink != 0:
+			wt, _ := os.Readlink(p)
+			gt, _ := os.Readlink(filepath.Join(got, rel))
+			if wt != gt {
+				t.Errorf("%s: target %q, want %q", rel, gt, wt)
+			}
+			return nil
+		case wi.Mode().IsRegular():
+			wb, _ := os.ReadFile(p)
+			gb, _ := os.ReadFile(filepath.Join(got, rel))
+			if !bytes.Equal(wb, gb) {
+				t.Errorf("%s: content %q, want %q", rel, gb, wb)
+			}
+		}
+		if !gi.ModTime().Equal(fixtureTime) {
+			t.Errorf("%s: mtime %v, want %v", rel, gi.ModTime(), fixtureTime)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,790 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+)
+
+// ---------------------------------------------------------------------------
+// daemon — a long-lived supervisor other invocations talk to
+// ---------------------------------------------------------------------------
+//
+// `rfs daemon` listens on a unix socket in the state dir. up, down, status
+// and remount send it newline-delimited JSON requests when it is running
+// and fall back to acting directly when it is not. The daemon handles one
+// lifecycle request at a time, so racing invocations cannot interleave
+// PID and state-file updates.
+//
+// The daemon acts on the config it was started with. A request made with
+// another config file, or other RFS_* variables, is refused rather than
+// carried out on the daemon's config.
+
+// controlProtocolVersion is bumped on incompatible request or response
+// changes. Each side rejects a version it does not speak.
+const controlProtocolVersion = 3
+
+// Control operations.
+const (
+	opPing     = "ping"
+	opStatus   = "status"
+	opUp       = "up"
+	opDown     = "down"
+	opRemount  = "remount"
+	opShutdown = "shutdown"
+)
+
+type controlRequest struct {
+	Version int          `json:"version"`
+	Op      string       `json:"op"`
+	Name    string       `json:"name,omitempty"` // the filesystem up, down or remount acts on; empty for all
+	Key     string       `json:"key,omitempty"`  // the key remount switches Name to
+	Up      *upOverrides `json:"up,omitempty"`
+	Force   bool         `json:"force,omitempty"`
+
+	PurgeData bool `json:"purge_data,omitempty"`
+
+	// Config and Env are the client's config file and a digest of its
+	// RFS_* variables; the daemon refuses a request made with others.
+	Config string `json:"config"`
+	Env    string `json:"env,omitempty"`
+}
+
+// controlConfig returns this process's config file, as an absolute path,
+// and a digest of its RFS_* variables, which may hold a password.
+func controlConfig() (path, env string) {
+	path = configPath()
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	names := envConfigNames()
+	if len(names) == 0 {
+		return path, ""
+	}
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s\n", name, os.Getenv(name))
+	}
+	return path, hex.EncodeToString(h.Sum(nil))
+}
+
+// checkControlConfig fails when req was made with a config other than the
+// daemon's.
+func checkControlConfig(req controlRequest) error {
+	path, env := controlConfig()
+	switch {
+	case req.Config != path:
+		return fmt.Errorf("the rfs daemon uses the config %s, not %s\nRun '%s daemon stop' to act on %s without it", path, req.Config, filepath.Base(os.Args[0]), req.Config)
+	case req.Env != env:
+		return fmt.Errorf("the rfs daemon was started with other RFS_* variables than this command\nRun '%s daemon stop' to act without it, or use the variables it was started with", filepath.Base(os.Args[0]))
+	}
+	return nil
+}
+
+type controlResponse struct {
+	Version int            `json:"version"`
+	Error   string         `json:"error,omitempty"`
+	Status  *controlStatus `json:"status,omitempty"`
+}
+
+// controlStatus is the daemon's view of the filesystems it supervises.
+type controlStatus struct {
+	DaemonPID   int        `json:"daemon_pid"`
+	Filesystems []fsStatus `json:"filesystems,omitempty"`
+}
+
+// fsStatus is one filesystem that is up, as probed.
+type fsStatus struct {
+	Name       string `json:"name"`
+	Mounted    bool   `json:"mounted"`
+	MountAlive bool   `json:"mount_alive"`
+	State      state  `json:"state"`
+}
+
+var errNoDaemon = errors.New("rfs daemon is not running")
+
+func controlSocketPath() string {
+	return filepath.Join(runDir(), "rfs.sock")
+}
+
+func daemonLogPath() string {
+	return filepath.Join(runDir(), "daemon.log")
+}
+
+// supervisorOps are the lifecycle operations the daemon performs.
+type supervisorOps interface {
+	status() (controlStatus, error)
+	up(name string, ov upOverrides) (controlStatus, error)
+	down(name string, force, purgeData bool) error
+	remount(name, key string) (controlStatus, error)
+	tend() (string, error)
+}
+
+// supervisor performs lifecycle operations in this process, exactly as
+// the commands do without a daemon.
+type supervisor struct{}
+
+func (supervisor) status() (controlStatus, error) {
+	cs := controlStatus{DaemonPID: os.Getpid()}
+	sts, err := loadState()
+	if errors.Is(err, os.ErrNotExist) {
+		return cs, nil
+	}
+	if err != nil {
+		return cs, err
+	}
+	cs.Filesystems, err = probeStates(sts)
+	return cs, err
+}
+
+func (s supervisor) up(name string, ov upOverrides) (controlStatus, error) {
+	var cfgs []config
+	err := withState(func(store *stateStore) error {
+		var err error
+		cfgs, err = prepareUp(store, name, ov)
+		return err
+	})
+	if err != nil {
+		return controlStatus{}, err
+	}
+	for _, cfg := range cfgs {
+		if err := startServices(cfg); err != nil {
+			return controlStatus{}, err
+		}
+	}
+	return s.status()
+}
+
+func (supervisor) down(name string, force, purgeData bool) error {
+	return withState(func(store *stateStore) error {
+		sts, err := store.load()
+		if errors.Is(err, os.ErrNotExist) {
+			rels, err := releaseOrphanedRedis(redisProfile())
+			for _, rel := range rels {
+				reportRedisRelease(rel)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		names, err := downTargets(sts, name)
+		if err != nil {
+			return err
+		}
+		return stopServices(store, sts, names, force, purgeData)
+	})
+}
+
+// remount restarts the mount daemon of the running filesystem called
+// name, or of each one, leaving Redis alone. It uses the saved config with
+// the key, mountpoint, and database recorded when each filesystem was
+// brought up; a non-empty key mounts that key instead.
+func (s supervisor) remount(name, key string) (controlStatus, error) {
+	err := withState(func(store *stateStore) error { return remountIn(store, name, key) })
+	if err != nil {
+		return controlStatus{}, err
+	}
+	return s.status()
+}
+
+// remountIn restarts the mount daemons recorded in store.
+func remountIn(store *stateStore, name, key string) error {
+	sts, err := store.load()
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New("redis-fs is not running")
+	}
+	if err != nil {
+		return err
+	}
+	names, err := downTargets(sts, name)
+	if err != nil {
+		return err
+	}
+	if key != "" && len(names) > 1 {
+		return fmt.Errorf("--key switches one filesystem\nName it: %s remount <name> --key %s", filepath.Base(os.Args[0]), key)
+	}
+	base, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		st, err := remountOne(base, sts[name], key)
+		if err != nil {
+			// Keep the daemons already restarted on record.
+			if serr := store.save(sts); serr != nil {
+				return fmt.Errorf("remount %s: %w (and saving the state failed: %v)", name, err, serr)
+			}
+			return fmt.Errorf("remount %s: %w", name, err)
+		}
+		sts[name] = st
+	}
+	return store.save(sts)
+}
+
+// configForState is the config st was brought up with: its filesystem's
+// entry in base, or base made into a run of its own for up's --key and
+// --mountpoint, with what st recorded taking precedence.
+func configForState(base config, st state) (config, error) {
+	cfg := base
+	if entries, err := base.selectFilesystems(st.Name); err == nil {
+		cfg = base.forFilesystem(entries[0])
+	} else if len(st.Overrides) > 0 {
+		base.asOverrideRun(&cfg, st.Name)
+	}
+	cfg.RedisKey, cfg.Mountpoint, cfg.RedisDB, cfg.RedisAddr = st.RedisKey, st.Mountpoint, st.RedisDB, st.RedisAddr
+	cfg.MountBackend = st.MountBackend
+	if st.MountLog != "" {
+		cfg.MountLog = st.MountLog
+	}
+	if st.RedisLog != "" {
+		cfg.RedisLog = st.RedisLog
+	}
+	err := resolveConfigPaths(&cfg)
+	return cfg, err
+}
+
+// remountOne restarts st's mount daemon, on key when it is not empty, and
+// returns its updated state. Redis must answer first: a mount taken down
+// while it cannot would not come back.
+func remountOne(base config, st state, key string) (state, error) {
+	cfg, err := configForState(base, st)
+	if err != nil {
+		return st, err
+	}
+	if key != "" {
+		cfg.RedisKey = key
+	}
+	backend, _, err := backendForState(st)
+	if err != nil {
+		return st, err
+	}
+	versions, err := checkRemountKey(cfg)
+	if err != nil {
+		return st, err
+	}
+
+	if backend.IsMounted(st.Mountpoint) {
+		if err := checkMountOwnership(st); err != nil {
+			return st, fmt.Errorf("refusing to remount: %w", err)
+		}
+		if err := backend.Unmount(st.Mountpoint); err != nil {
+			return st, fmt.Errorf("unmount %s: %w", st.Mountpoint, err)
+		}
+	}
+	if st.MountPID > 0 && processAlive(st.MountPID) {
+		_ = terminatePID(st.MountPID, 2*time.Second)
+	}
+
+	started, err := backend.Start(cfg)
+	if err != nil {
+		return st, err
+	}
+	if err := backend.WaitForMount(cfg, started, 6*time.Second); err != nil {
+		return st, fmt.Errorf("mount did not become ready: %w", err)
+	}
+	st.MountPID = started.PID
+	st.MountEndpoint = started.Endpoint
+	st.MountSource = backend.MountSource(cfg, started)
+	st.ModuleVersion, st.KeyModuleVersion = versions.Loaded, versions.Key
+	if cfg.RedisKey != st.RedisKey {
+		st.RedisKey = cfg.RedisKey
+		if !slices.Contains(st.Overrides, "key") {
+			st.Overrides = append(st.Overrides, "key")
+		}
+	}
+	return st, nil
+}
+
+// checkRemountKey makes sure cfg's Redis answers and its key can be
+// mounted, creating the key when it is new, before anything is unmounted.
+func checkRemountKey(cfg config) (moduleVersions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rdb := newRedisClient(cfg, 2)
+	defer rdb.Close()
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return moduleVersions{}, fmt.Errorf("%s; the mount is left as it is", redisConnectFailure(cfg, err))
+	}
+	if err := checkMountable(ctx, rdb, cfg.RedisKey); err != nil {
+		return moduleVersions{}, err
+	}
+	if err := client.New(rdb, cfg.RedisKey).Touch(ctx, "/.mount-check"); err != nil {
+		return moduleVersions{}, fmt.Errorf("failed to initialize key %q: %w", cfg.RedisKey, err)
+	}
+	versions, err := readModuleVersions(ctx, rdb, cfg.RedisKey)
+	if err != nil {
+		return moduleVersions{}, fmt.Errorf("read module version for key %q: %w", cfg.RedisKey, err)
+	}
+	return versions, checkModuleCompatible(cfg, versions.Loaded)
+}
+
+// superviseInterval is how often the daemon checks on the mount daemon and
+// managed Redis server it supervises.
+const superviseInterval = 5 * time.Second
+
+// tend binds a managed Redis server's lifetime to the mounts it serves:
+// a filesystem whose mount daemon has died is brought down, and when the
+// server itself has died, every filesystem is, so nothing lingers. Redis
+// is released through the registry with the last filesystem, so a server
+// other profiles still use keeps running. It returns what it found dead,
+// or "" when all is well or there is nothing to supervise.
+func (supervisor) tend() (died string, err error) {
+	err = withState(func(store *stateStore) error {
+		sts, err := store.load()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var names, dead []string
+		for _, name := range sts.names() {
+			st := sts[name]
+			if !st.ManageRedis {
+				continue
+			}
+			if st.RedisPID > 0 && !processAlive(st.RedisPID) {
+				names, dead = sts.names(), []string{fmt.Sprintf("redis-server pid %d", st.RedisPID)}
+				break
+			}
+			if st.MountPID > 0 && !processAlive(st.MountPID) {
+				names = append(names, name)
+				dead = append(dead, fmt.Sprintf("%s mount daemon pid %d", name, st.MountPID))
+			}
+		}
+		if len(names) == 0 {
+			return nil
+		}
+		died = strings.Join(dead, ", ")
+		return stopServices(store, sts, names, false, false)
+	})
+	return died, err
+}
+
+// controlServer answers control requests, running at most one at a time.
+type controlServer struct {
+	mu       sync.Mutex
+	ops      supervisorOps
+	shutdown func()
+}
+
+// serve accepts connections until ln is closed.
+func (s *controlServer) serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *controlServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req controlRequest
+		var resp controlResponse
+		if err := json.Unmarshal(line, &req); err != nil {
+			resp = controlResponse{Version: controlProtocolVersion, Error: "malformed request: " + err.Error()}
+		} else {
+			resp = s.handle(req)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+		if req.Op == opShutdown && resp.Error == "" && s.shutdown != nil {
+			s.shutdown()
+		}
+	}
+}
+
+func (s *controlServer) handle(req controlRequest) controlResponse {
+	resp := controlResponse{Version: controlProtocolVersion}
+	if req.Version != controlProtocolVersion {
+		resp.Error = fmt.Sprintf("unsupported control protocol version %d (daemon speaks %d)", req.Version, controlProtocolVersion)
+		return resp
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req.Op != opPing && req.Op != opShutdown {
+		if err := checkControlConfig(req); err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+	}
+
+	var cs controlStatus
+	var err error
+	switch req.Op {
+	case opPing, opShutdown:
+		cs = controlStatus{DaemonPID: os.Getpid()}
+	case opStatus:
+		cs, err = s.ops.status()
+	case opUp:
+		var ov upOverrides
+		if req.Up != nil {
+			ov = *req.Up
+		}
+		cs, err = s.ops.up(req.Name, ov)
+	case opDown:
+		if err = s.ops.down(req.Name, req.Force, req.PurgeData); err == nil {
+			cs, err = s.ops.status()
+		}
+	case opRemount:
+		cs, err = s.ops.remount(req.Name, req.Key)
+	default:
+		err = fmt.Errorf("unknown operation %q", req.Op)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Status = &cs
+	return resp
+}
+
+// supervise tends the supervised processes every interval until done is
+// closed. It takes the request lock, so it never races a lifecycle request.
+func (s *controlServer) supervise(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		s.mu.Lock()
+		died, err := s.ops.tend()
+		s.mu.Unlock()
+		if died != "" {
+			fmt.Printf("%s %s exited; brought the affected filesystems down\n", time.Now().Format(time.RFC3339), died)
+		}
+		if err != nil {
+			fmt.Printf("%s supervise: %v\n", time.Now().Format(time.RFC3339), err)
+		}
+	}
+}
+
+// controlClient sends requests to a daemon over one connection.
+type controlClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newControlClient(conn net.Conn) *controlClient {
+	return &controlClient{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// dialDaemon connects to a running daemon and checks that it speaks this
+// protocol version. It returns errNoDaemon when none is listening.
+func dialDaemon() (*controlClient, error) {
+	conn, err := net.DialTimeout("unix", controlSocketPath(), 500*time.Millisecond)
+	if err != nil {
+		return nil, errNoDaemon
+	}
+	c := newControlClient(conn)
+	if _, err := c.call(controlRequest{Op: opPing}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("rfs daemon: %w", err)
+	}
+	return c, nil
+}
+
+func (c *controlClient) call(req controlRequest) (controlStatus, error) {
+	req.Version = controlProtocolVersion
+	req.Config, req.Env = controlConfig()
+	b, err := json.Marshal(req)
+	if err != nil {
+		return controlStatus{}, err
+	}
+	if _, err := c.conn.Write(append(b, '\n')); err != nil {
+		return controlStatus{}, err
+	}
+	line, err := c.r.ReadBytes('\n')
+	if err != nil {
+		return controlStatus{}, fmt.Errorf("read daemon response: %w", err)
+	}
+	var resp controlResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return controlStatus{}, fmt.Errorf("malformed daemon response: %w", err)
+	}
+	if resp.Version != controlProtocolVersion {
+		return controlStatus{}, fmt.Errorf("daemon speaks control protocol version %d, this rfs speaks %d; restart the daemon", resp.Version, controlProtocolVersion)
+	}
+	if resp.Error != "" {
+		return controlStatus{}, errors.New(resp.Error)
+	}
+	if resp.Status == nil {
+		return controlStatus{}, errors.New("daemon response carries no status")
+	}
+	return *resp.Status, nil
+}
+
+func (c *controlClient) Close() error {
+	return c.conn.Close()
+}
+
+// daemonRow identifies the daemon in status output.
+func daemonRow(pid int) boxRow {
+	return boxRow{Label: "daemon", Value: fmt.Sprintf("pid %d %s", pid, clr(ansiDim, controlSocketPath()))}
+}
+
+func upViaDaemon(c *controlClient, name string, ov upOverrides) error {
+	printBanner()
+	s := startStep("Starting through the rfs daemon")
+	cs, err := c.call(controlRequest{Op: opUp, Name: name, Up: &ov})
+	if err != nil {
+		s.fail(err.Error())
+		return fmt.Errorf("%w\nSee %s for details", err, daemonLogPath())
+	}
+	s.succeed(fmt.Sprintf("pid %d", cs.DaemonPID))
+	if len(cs.Filesystems) == 0 {
+		return errors.New("daemon reported success but no running filesystem")
+	}
+	return printStatuses(cs.Filesystems, name, nil, []boxRow{daemonRow(cs.DaemonPID)})
+}
+
+func downViaDaemon(c *controlClient, name string, force, purgeData bool) error {
+	fmt.Println()
+	s := startStep("Stopping through the rfs daemon")
+	cs, err := c.call(controlRequest{Op: opDown, Name: name, Force: force, PurgeData: purgeData})
+	if err != nil {
+		s.fail(err.Error())
+		return err
+	}
+	s.succeed(fmt.Sprintf("pid %d", cs.DaemonPID))
+	fmt.Printf("\n  %s %s stopped\n\n", clr(ansiDim, "■"), stoppedLabel(name))
+	return nil
+}
+
+func statusViaDaemon(c *controlClient, sa statusArgs) error {
+	cs, err := c.call(controlRequest{Op: opStatus})
+	if err != nil {
+		return err
+	}
+	if sa.json {
+		return printStatusJSON(cs.Filesystems, sa.name)
+	}
+	row := daemonRow(cs.DaemonPID)
+	return printStatuses(cs.Filesystems, sa.name, []boxRow{row}, []boxRow{row})
+}
+
+// cmdRemount restarts the mount daemons, through the rfs daemon when one
+// is running.
+func cmdRemount(args []string) error {
+	fs := newFlagSet("remount")
+	key := fs.String("key", "", "mount this key at the same mountpoint instead")
+	usage := fmt.Sprintf("Usage: %s remount [name] [--key name]", filepath.Base(os.Args[0]))
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 1 {
+		return errors.New(usage)
+	}
+	var name string
+	if len(pos) == 1 {
+		name = pos[0]
+	}
+
+	var cs controlStatus
+	c, err := dialDaemon()
+	switch {
+	case err == nil:
+		defer c.Close()
+		s := startStep("Remounting through the rfs daemon")
+		if cs, err = c.call(controlRequest{Op: opRemount, Name: name, Key: *key}); err != nil {
+			s.fail(err.Error())
+			return err
+		}
+		s.succeed(mountPIDs(cs))
+	case errors.Is(err, errNoDaemon):
+		s := startStep("Remounting")
+		if cs, err = (supervisor{}).remount(name, *key); err != nil {
+			s.fail(err.Error())
+			return err
+		}
+		s.succeed(mountPIDs(cs))
+	default:
+		return err
+	}
+	return nil
+}
+
+// mountPIDs lists the mount daemons in cs.
+func mountPIDs(cs controlStatus) string {
+	var pids []string
+	for _, fs := range cs.Filesystems {
+		pid := fmt.Sprintf("mount pid %d", fs.State.MountPID)
+		if len(cs.Filesystems) > 1 {
+			pid = fs.Name + " " + pid
+		}
+		pids = append(pids, pid)
+	}
+	return strings.Join(pids, ", ")
+}
+
+// cmdDaemon starts the supervisor in the background, runs it in the
+// foreground, or stops a running one.
+func cmdDaemon(args []string) error {
+	usage := fmt.Sprintf("Usage: %s daemon [--foreground] | daemon stop", filepath.Base(os.Args[0]))
+	fs := newFlagSet("daemon")
+	foreground := fs.Bool("foreground", false, "run in this process instead of detaching")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 0 {
+		if pos[0] != "stop" || len(pos) > 1 {
+			return fmt.Errorf("unexpected arguments %v\n\n%s", pos, usage)
+		}
+		return stopDaemon()
+	}
+	if *foreground {
+		return runDaemon()
+	}
+	return spawnDaemon()
+}
+
+func stopDaemon() error {
+	c, err := dialDaemon()
+	if errors.Is(err, errNoDaemon) {
+		fmt.Println("  The rfs daemon is not running.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	cs, err := c.call(controlRequest{Op: opShutdown})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  %s rfs daemon (pid %d) stopped; the filesystem keeps running\n", clr(ansiDim, "■"), cs.DaemonPID)
+	return nil
+}
+
+// spawnDaemon re-executes rfs as a detached daemon and waits for its
+// socket to answer.
+func spawnDaemon() error {
+	if c, err := dialDaemon(); err == nil {
+		c.Close()
+		return fmt.Errorf("the rfs daemon is already running (%s)", controlSocketPath())
+	}
+	if err := os.MkdirAll(runDir(), 0o700); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(daemonLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var args []string
+	if cfgPathOverride != "" || cfgProfile != "" {
+		args = append(args, "--config", configPath())
+	}
+	cmd := exec.Command(exe, append(args, "daemon", "--foreground")...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start daemon: %w", err)
+	}
+	pid := cmd.Process.Pid
+	_ = cmd.Process.Release()
+
+	s := startStep("Starting rfs daemon")
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if c, err := dialDaemon(); err == nil {
+			c.Close()
+			s.succeed(fmt.Sprintf("pid %d", pid))
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	s.fail("timeout")
+	return fmt.Errorf("daemon did not start listening; see %s", daemonLogPath())
+}
+
+// runDaemon serves the control socket until interrupted or told to shut
+// down. Stopping the daemon leaves the filesystem running.
+func runDaemon() error {
+	ln, err := listenControl()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(controlSocketPath())
+
+	var once sync.Once
+	stop := func() { once.Do(func() { ln.Close() }) }
+	restore := onInterrupt(stop)
+	defer restore()
+
+	fmt.Printf("%s rfs daemon pid %d listening on %s\n", time.Now().Format(time.RFC3339), os.Getpid(), controlSocketPath())
+	srv := &controlServer{ops: supervisor{}, shutdown: stop}
+	done := make(chan struct{})
+	defer close(done)
+	go srv.supervise(superviseInterval, done)
+	return srv.serve(ln)
+}
+
+// listenControl binds the control socket, replacing a stale one left by a
+// daemon that did not exit cleanly.
+func listenControl() (net.Listener, error) {
+	if err := os.MkdirAll(runDir(), 0o700); err != nil {
+		return nil, err
+	}
+	path := controlSocketPath()
+	if conn, err := net.DialTimeout("unix", path, 500*time.Millisecond); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("the rfs daemon is already running (%s)", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// The socket controls mounts; keep it private to the owner.
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
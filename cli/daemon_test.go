@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/redis-fs/mount/client"
+)
+
+type fakeSupervisor struct {
+	running  bool
+	lastUp   upOverrides
+	lastName string
+	forced   bool
+	failOn   string
+}
+
+func (f *fakeSupervisor) status() (controlStatus, error) {
+	cs := controlStatus{DaemonPID: 42}
+	if f.running {
+		cs.Filesystems = []fsStatus{{Name: "myfs", Mounted: true, MountAlive: true, State: state{RedisKey: "myfs", Mountpoint: "/mnt/rfs"}}}
+	}
+	return cs, nil
+}
+
+func (f *fakeSupervisor) up(name string, ov upOverrides) (controlStatus, error) {
+	if f.failOn == opUp {
+		return controlStatus{}, errors.New("redis-fs is already running")
+	}
+	f.lastName, f.lastUp, f.running = name, ov, true
+	return f.status()
+}
+
+func (f *fakeSupervisor) down(name string, force, purgeData bool) error {
+	f.lastName, f.forced, f.running = name, force, false
+	return nil
+}
+
+func (f *fakeSupervisor) remount(name, key string) (controlStatus, error) {
+	f.lastName = name
+	return f.status()
+}
+
+func (f *fakeSupervisor) tend() (string, error) {
+	return "", nil
+}
+
+// socketpairClient connects a client to a control server over a
+// socketpair, so no socket file or daemon process is involved.
+func socketpairClient(t *testing.T, ops supervisorOps) *controlClient {
+	t.Helper()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := func(fd int, name string) net.Conn {
+		f := os.NewFile(uintptr(fd), name)
+		defer f.Close()
+		c, err := net.FileConn(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	srv := &controlServer{ops: ops}
+	go srv.serveConn(conn(fds[0], "server"))
+	c := newControlClient(conn(fds[1], "client"))
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestControlRoundTrip(t *testing.T) {
+	sup := &fakeSupervisor{}
+	c := socketpairClient(t, sup)
+
+	cs, err := c.call(controlRequest{Op: opStatus})
+	if err != nil || len(cs.Filesystems) != 0 || cs.DaemonPID != 42 {
+		t.Fatalf("status before up = %+v, %v", cs, err)
+	}
+
+	key := "other"
+	ro := true
+	cs, err = c.call(controlRequest{Op: opUp, Name: "notes", Up: &upOverrides{Key: &key, ReadOnly: &ro, AllowOther: &ro}})
+	if err != nil || len(cs.Filesystems) != 1 || cs.Filesystems[0].State.RedisKey != "myfs" || !cs.Filesystems[0].Mounted {
+		t.Fatalf("up = %+v, %v", cs, err)
+	}
+	if sup.lastName != "notes" {
+		t.Fatalf("up named %q", sup.lastName)
+	}
+	if sup.lastUp.Key == nil || *sup.lastUp.Key != "other" || sup.lastUp.ReadOnly == nil || !*sup.lastUp.ReadOnly ||
+		sup.lastUp.AllowOther == nil || !*sup.lastUp.AllowOther || sup.lastUp.Mountpoint != nil {
+		t.Fatalf("overrides did not survive the round trip: %+v", sup.lastUp)
+	}
+
+	cs, err = c.call(controlRequest{Op: opDown, Force: true})
+	if err != nil || len(cs.Filesystems) != 0 || !sup.forced || sup.lastName != "" {
+		t.Fatalf("down = %+v, %v (forced %v)", cs, err, sup.forced)
+	}
+}
+
+func TestControlErrors(t *testing.T) {
+	c := socketpairClient(t, &fakeSupervisor{failOn: opUp})
+
+	if _, err := c.call(controlRequest{Op: opUp}); err == nil || err.Error() != "redis-fs is already running" {
+		t.Fatalf("up error = %v", err)
+	}
+	if _, err := c.call(controlRequest{Op: "explode"}); err == nil {
+		t.Fatal("unknown op succeeded")
+	}
+	// The connection stays usable after errors.
+	if _, err := c.call(controlRequest{Op: opPing}); err != nil {
+		t.Fatalf("ping after errors: %v", err)
+	}
+}
+
+func TestControlVersionMismatch(t *testing.T) {
+	srv := &controlServer{ops: &fakeSupervisor{}}
+	for _, v := range []int{0, controlProtocolVersion + 1} {
+		resp := srv.handle(controlRequest{Version: v, Op: opStatus})
+		if resp.Error == "" || resp.Status != nil {
+			t.Fatalf("version %d accepted: %+v", v, resp)
+		}
+		if resp.Version != controlProtocolVersion {
+			t.Fatalf("response version = %d", resp.Version)
+		}
+	}
+}
+
+func TestControlConfigMismatch(t *testing.T) {
+	t.Setenv(configEnv, filepath.Join(t.TempDir(), "rfs.config.json"))
+	sup := &fakeSupervisor{}
+	srv := &controlServer{ops: sup}
+	path, env := controlConfig()
+	for _, req := range []controlRequest{
+		{Op: opUp, Config: filepath.Join(t.TempDir(), "other.json"), Env: env},
+		{Op: opDown, Config: path, Env: "0123"},
+	} {
+		req.Version = controlProtocolVersion
+		if resp := srv.handle(req); resp.Error == "" || !strings.Contains(resp.Error, "daemon stop") {
+			t.Fatalf("%s with another config: %+v", req.Op, resp)
+		}
+	}
+	if sup.running || sup.forced {
+		t.Fatal("the daemon acted on a request made with another config")
+	}
+	if resp := srv.handle(controlRequest{Version: controlProtocolVersion, Op: opPing, Config: "/elsewhere.json"}); resp.Error != "" {
+		t.Fatalf("ping with another config: %s", resp.Error)
+	}
+
+	// The client sends its own, so a daemon sharing it answers.
+	t.Setenv("RFS_KEY", "notes")
+	if _, err := socketpairClient(t, sup).call(controlRequest{Op: opStatus}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialDaemon(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	if _, err := dialDaemon(); !errors.Is(err, errNoDaemon) {
+		t.Fatalf("dial without a daemon = %v, want errNoDaemon", err)
+	}
+
+	ln, err := listenControl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if fi, err := os.Stat(filepath.Join(home, ".local", "state", "rfs", "rfs.sock")); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("socket = %v, %v", fi, err)
+	}
+	go (&controlServer{ops: &fakeSupervisor{running: true}}).serve(ln)
+
+	c, err := dialDaemon()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	cs, err := c.call(controlRequest{Op: opStatus})
+	if err != nil || len(cs.Filesystems) != 1 || cs.Filesystems[0].State.Mountpoint != "/mnt/rfs" {
+		t.Fatalf("status = %+v, %v", cs, err)
+	}
+
+	if _, err := listenControl(); err == nil {
+		t.Fatal("second listener replaced a live daemon's socket")
+	}
+}
+
+func TestRemountTargets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	err := withState(func(store *stateStore) error {
+		if err := store.save(states{
+			"notes": {Name: "notes", RedisKey: "notes"},
+			"work":  {Name: "work", RedisKey: "work"},
+		}); err != nil {
+			return err
+		}
+		if err := remountIn(store, "", "other"); err == nil || !strings.Contains(err.Error(), "--key switches one filesystem") {
+			t.Errorf("--key without a name: %v", err)
+		}
+		if err := remountIn(store, "music", ""); err == nil || !strings.Contains(err.Error(), "music is not running") {
+			t.Errorf("remount of a filesystem that is not up: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckRemountKey(t *testing.T) {
+	rdb := testRedis(t)
+	cfg := config{RedisAddr: rdb.Options().Addr, RedisKey: testKey(t, rdb)}
+	if _, err := checkRemountKey(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// A new key is created, so the mount daemon finds a root.
+	if st, err := client.New(rdb, cfg.RedisKey).Stat(context.Background(), "/"); err != nil || st == nil {
+		t.Fatalf("root of %q: %v, %v", cfg.RedisKey, st, err)
+	}
+
+	cfg.RedisAddr = "127.0.0.1:1"
+	if _, err := checkRemountKey(cfg); err == nil || !strings.Contains(err.Error(), "left as it is") {
+		t.Fatalf("unreachable Redis: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ---------------------------------------------------------------------------
+// Where rfs keeps its config and state
+// ---------------------------------------------------------------------------
+//
+// The config lives in $XDG_CONFIG_HOME/rfs (~/.config/rfs by default) and
+// everything rfs records as it runs in $XDG_STATE_HOME/rfs
+// (~/.local/state/rfs). Earlier versions kept the config beside the binary,
+// which fails when the binary sits somewhere read-only, and the state in
+// ~/.rfs. The config is copied to its new place on first run; an existing
+// ~/.rfs stays in use, since it may hold the state of running filesystems,
+// the managed Redis registry and persistent Redis data.
+
+// xdgDir is $env/rfs, or ~/fallback/rfs when env is unset or, against the
+// spec, relative.
+func xdgDir(env, fallback string) string {
+	if d := os.Getenv(env); d != "" && filepath.IsAbs(d) {
+		return filepath.Join(d, "rfs")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(home, fallback, "rfs")
+}
+
+// configDir holds the default config and the profiles.
+func configDir() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// stateDir holds the state, the managed Redis registry and everything else
+// rfs records: ~/.rfs while it exists and the new directory does not.
+func stateDir() string {
+	dir := xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+	if home, err := os.UserHomeDir(); err == nil {
+		legacy := filepath.Join(home, ".rfs")
+		if !dirExists(dir) && dirExists(legacy) {
+			return legacy
+		}
+	}
+	return dir
+}
+
+func dirExists(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && fi.IsDir()
+}
+
+// defaultConfigPath is config.json in the config directory.
+func defaultConfigPath() string {
+	return filepath.Join(configDir(), "config.json")
+}
+
+// legacyConfigPath is where earlier versions kept the config: beside the
+// binary.
+func legacyConfigPath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "rfs.config.json"
+	}
+	return filepath.Join(filepath.Dir(exe), "rfs.config.json")
+}
+
+// migrateLegacyConfig copies a config left at src, where earlier versions
+// kept it, to defaultConfigPath, once, and says so on out. The old file is left in
+// place, as its directory may not be writable.
+func migrateLegacyConfig(src string, out io.Writer) error {
+	if configSource() != "default" {
+		return nil
+	}
+	dst := defaultConfigPath()
+	if _, err := os.Stat(dst); !errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return fmt.Errorf("move config to %s: %w", dst, err)
+	}
+	if err := os.WriteFile(dst, b, 0o600); err != nil {
+		return fmt.Errorf("move config to %s: %w", dst, err)
+	}
+	fmt.Fprintf(out, "  %s Config moved from %s to %s %s\n", clr(ansiDim, "▸"), src, dst,
+		clr(ansiDim, "(the old file is no longer read)"))
+	return nil
+}
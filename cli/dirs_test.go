@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestXDGDirs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+
+	if configDir() != filepath.Join(home, ".config", "rfs") || stateDir() != filepath.Join(home, ".local", "state", "rfs") {
+		t.Fatalf("defaults: config %s, state %s", configDir(), stateDir())
+	}
+
+	// An existing ~/.rfs stays in use until the new directory exists.
+	legacy := filepath.Join(home, ".rfs")
+	os.Mkdir(legacy, 0o700)
+	if stateDir() != legacy {
+		t.Fatalf("with ~/.rfs: state %s", stateDir())
+	}
+	os.MkdirAll(filepath.Join(home, ".local", "state", "rfs"), 0o700)
+	if stateDir() != filepath.Join(home, ".local", "state", "rfs") {
+		t.Fatalf("with both: state %s", stateDir())
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_STATE_HOME", "relative")
+	if configDir() != "/xdg/config/rfs" || stateDir() != filepath.Join(home, ".local", "state", "rfs") {
+		t.Fatalf("from the environment: config %s, state %s", configDir(), stateDir())
+	}
+}
+
+func TestMigrateLegacyConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv(configEnv, "")
+	defer func(cfg, profile string) { cfgPathOverride, cfgProfile = cfg, profile }(cfgPathOverride, cfgProfile)
+	cfgPathOverride, cfgProfile = "", ""
+
+	src := filepath.Join(t.TempDir(), "rfs.config.json")
+	var out bytes.Buffer
+	if err := migrateLegacyConfig(src, &out); err != nil || out.Len() != 0 {
+		t.Fatalf("no old config: %q, %v", out.String(), err)
+	}
+
+	os.WriteFile(src, []byte(`{"redisKey":"old"}`), 0o644)
+	if err := migrateLegacyConfig(src, &out); err != nil || !strings.Contains(out.String(), defaultConfigPath()) {
+		t.Fatalf("first run: %q, %v", out.String(), err)
+	}
+	b, err := os.ReadFile(defaultConfigPath())
+	if err != nil || string(b) != `{"redisKey":"old"}` {
+		t.Fatalf("moved config: %q, %v", b, err)
+	}
+	if fi, _ := os.Stat(defaultConfigPath()); fi.Mode().Perm() != 0o600 {
+		t.Fatalf("moved config mode %v", fi.Mode())
+	}
+
+	// Only once: a config already in place is not overwritten.
+	os.WriteFile(src, []byte(`{"redisKey":"newer"}`), 0o644)
+	out.Reset()
+	if err := migrateLegacyConfig(src, &out); err != nil || out.Len() != 0 {
+		t.Fatalf("second run: %q, %v", out.String(), err)
+	}
+
+	// Nor when --config names the file to use.
+	os.Remove(defaultConfigPath())
+	cfgPathOverride = src
+	if err := migrateLegacyConfig(src, &out); err != nil || out.Len() != 0 {
+		t.Fatalf("with --config: %q, %v", out.String(), err)
+	}
+}
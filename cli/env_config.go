@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// ---------------------------------------------------------------------------
+// Config from the environment — RFS_* variables over the config file
+// ---------------------------------------------------------------------------
+//
+// In a container it is easier to pass settings as environment variables
+// than to bake a config file into the image. Each variable below replaces
+// one config field after the file is read, and is enough on its own: with
+// no config file at all, the defaults plus the variables make the config.
+// An empty variable counts as unset. Values found in the environment are
+// never written back to the config file.
+
+// envField is a config field that an environment variable can set. field
+// returns a *string, *bool or *int into cfg, which says how the value is
+// parsed.
+type envField struct {
+	name  string
+	field func(cfg *config) any
+}
+
+// envFields lists the variables in the order they are applied. RFS_REDIS_URL
+// comes first so that the individual connection variables override what it
+// sets, as they would in a config file.
+var envFields = []envField{
+	{"RFS_REDIS_URL", func(c *config) any { return &c.RedisURL }},
+	{"RFS_USE_EXISTING_REDIS", func(c *config) any { return &c.UseExistingRedis }},
+	{"RFS_REDIS_ADDR", func(c *config) any { return &c.RedisAddr }},
+	{"RFS_REDIS_SOCKET", func(c *config) any { return &c.RedisSocket }},
+	{"RFS_REDIS_USERNAME", func(c *config) any { return &c.RedisUsername }},
+	{"RFS_REDIS_PASSWORD", func(c *config) any { return &c.RedisPassword }},
+	{"RFS_REDIS_PASSWORD_FILE", func(c *config) any { return &c.RedisPasswordFile }},
+	{"RFS_REDIS_DB", func(c *config) any { return &c.RedisDB }},
+	{"RFS_REDIS_TLS", func(c *config) any { return &c.RedisTLS }},
+	{"RFS_REDIS_TLS_CA_CERT", func(c *config) any { return &c.RedisTLSCACert }},
+	{"RFS_REDIS_TLS_CERT", func(c *config) any { return &c.RedisTLSCert }},
+	{"RFS_REDIS_TLS_KEY", func(c *config) any { return &c.RedisTLSKey }},
+	{"RFS_REDIS_TLS_SKIP_VERIFY", func(c *config) any { return &c.RedisTLSSkipVerify }},
+	{"RFS_KEY", func(c *config) any { return &c.RedisKey }},
+	{"RFS_MOUNTPOINT", func(c *config) any { return &c.Mountpoint }},
+	{"RFS_MOUNTPOINT_MODE", func(c *config) any { return &c.MountpointMode }},
+	{"RFS_MOUNT_BACKEND", func(c *config) any { return &c.MountBackend }},
+	{"RFS_READ_ONLY", func(c *config) any { return &c.ReadOnly }},
+	{"RFS_ALLOW_OTHER", func(c *config) any { return &c.AllowOther }},
+	{"RFS_REDIS_SERVER_BIN", func(c *config) any { return &c.RedisServerBin }},
+	{"RFS_MODULE_PATH", func(c *config) any { return &c.ModulePath }},
+	{"RFS_MOUNT_BIN", func(c *config) any { return &c.MountBin }},
+	{"RFS_NFS_BIN", func(c *config) any { return &c.NFSBin }},
+	{"RFS_NFS_HOST", func(c *config) any { return &c.NFSHost }},
+	{"RFS_NFS_PORT", func(c *config) any { return &c.NFSPort }},
+	{"RFS_REDIS_LOG", func(c *config) any { return &c.RedisLog }},
+	{"RFS_MOUNT_LOG", func(c *config) any { return &c.MountLog }},
+	{"RFS_PERSISTENCE", func(c *config) any { return &c.Persistence }},
+	{"RFS_DATA_DIR", func(c *config) any { return &c.DataDir }},
+	{"RFS_BIND_ADDRESS", func(c *config) any { return &c.BindAddress }},
+	{"RFS_IMPORT_BATCH_SIZE", func(c *config) any { return &c.ImportBatchSize }},
+	{"RFS_UPDATE_URL", func(c *config) any { return &c.UpdateURL }},
+	{"RFS_UPDATE_PUBLIC_KEY", func(c *config) any { return &c.UpdatePublicKey }},
+}
+
+// envResolved holds, for the variables whose fields resolveConfigPaths
+// rewrites, the same rewrite, so withoutEnv still recognises their values
+// afterwards.
+var envResolved = map[string]func(string) (string, error){
+	"RFS_MOUNTPOINT":       expandPath,
+	"RFS_DATA_DIR":         expandPath,
+	"RFS_MOUNT_BACKEND":    normalizeMountBackend,
+	"RFS_MOUNT_BIN":        resolveBinary,
+	"RFS_NFS_BIN":          resolveBinary,
+	"RFS_REDIS_SERVER_BIN": resolveBinary,
+}
+
+// isEnvValue reports whether got is the value v of the variable name,
+// either as given or as resolveConfigPaths rewrites it.
+func isEnvValue(name, v, got string) bool {
+	if got == v {
+		return true
+	}
+	if resolve := envResolved[name]; resolve != nil {
+		r, err := resolve(v)
+		return err == nil && got == r
+	}
+	return false
+}
+
+// envConfigNames lists the config variables set in the environment.
+func envConfigNames() []string {
+	var names []string
+	for _, e := range envFields {
+		if os.Getenv(e.name) != "" {
+			names = append(names, e.name)
+		}
+	}
+	return names
+}
+
+// applyEnvConfig sets cfg's fields from the environment and records which
+// ones it set, with the values they had before, so saveConfig can put
+// those back.
+func applyEnvConfig(cfg *config) error {
+	names := envConfigNames()
+	if len(names) == 0 {
+		return nil
+	}
+	before := *cfg
+	for _, e := range envFields {
+		v := os.Getenv(e.name)
+		if v == "" {
+			continue
+		}
+		if err := setEnvField(e.field(cfg), e.name, v); err != nil {
+			return err
+		}
+		if e.name == "RFS_REDIS_URL" {
+			if err := applyRedisURL(cfg, v); err != nil {
+				return fmt.Errorf("%s: %w", e.name, err)
+			}
+		}
+	}
+	cfg.fromEnv, cfg.beforeEnv = names, &before
+	return nil
+}
+
+// setEnvField parses v into p. Booleans must be true, false, 1 or 0, and
+// numbers non-negative integers; anything else is an error naming the
+// variable.
+func setEnvField(p any, name, v string) error {
+	switch p := p.(type) {
+	case *string:
+		*p = v
+	case *bool:
+		switch v {
+		case "true", "1":
+			*p = true
+		case "false", "0":
+			*p = false
+		default:
+			return fmt.Errorf("%s=%q: want true or false (or 1 or 0)", name, v)
+		}
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s=%q: want a non-negative whole number", name, v)
+		}
+		*p = n
+	}
+	return nil
+}
+
+// withoutEnv returns cfg with every field that still holds the value its
+// variable gave it, resolved or not, set back to the config file's value,
+// so that saving a config loaded with RFS_* variables does not copy them
+// into the file. Fields a command changed since are kept.
+func (c config) withoutEnv() config {
+	if c.beforeEnv == nil {
+		return c
+	}
+	out := c
+	for _, e := range envFields {
+		if !slices.Contains(c.fromEnv, e.name) {
+			continue
+		}
+		var fromEnv config
+		if setEnvField(e.field(&fromEnv), e.name, os.Getenv(e.name)) != nil {
+			continue
+		}
+		if e.name == "RFS_REDIS_URL" && out.RedisURL == os.Getenv(e.name) {
+			// The URL also set the fields it is split into.
+			b := c.beforeEnv
+			out.RedisAddr, out.RedisUsername, out.RedisPassword, out.RedisDB = b.RedisAddr, b.RedisUsername, b.RedisPassword, b.RedisDB
+			out.RedisTLS, out.RedisTLSSkipVerify = b.RedisTLS, b.RedisTLSSkipVerify
+		}
+		switch p := e.field(&out).(type) {
+		case *string:
+			if isEnvValue(e.name, *e.field(&fromEnv).(*string), *p) {
+				*p = *e.field(c.beforeEnv).(*string)
+			}
+		case *bool:
+			if *p == *e.field(&fromEnv).(*bool) {
+				*p = *e.field(c.beforeEnv).(*bool)
+			}
+		case *int:
+			if *p == *e.field(&fromEnv).(*int) {
+				*p = *e.field(c.beforeEnv).(*int)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rfs.config.json")
+	t.Setenv(configEnv, path)
+	b := `{"redisAddr": "localhost:6379", "redisPassword": "file", "redisKey": "k", "mountpoint": "/mnt/k", "readOnly": true}`
+	if err := os.WriteFile(path, []byte(b), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RFS_REDIS_ADDR", "redis.internal:6380")
+	t.Setenv("RFS_REDIS_PASSWORD", "from-env")
+	t.Setenv("RFS_REDIS_DB", "3")
+	t.Setenv("RFS_READ_ONLY", "false")
+	t.Setenv("RFS_KEY", "")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RedisAddr != "redis.internal:6380" || cfg.RedisPassword != "from-env" || cfg.RedisDB != 3 || cfg.ReadOnly || cfg.RedisKey != "k" || cfg.noFile {
+		t.Fatalf("with variables: %+v", cfg)
+	}
+	want := []string{"RFS_REDIS_ADDR", "RFS_REDIS_PASSWORD", "RFS_REDIS_DB", "RFS_READ_ONLY"}
+	if !reflect.DeepEqual(cfg.fromEnv, want) {
+		t.Fatalf("from the environment: %q, want %q", cfg.fromEnv, want)
+	}
+
+	// Saving keeps the file's values, except for fields changed since.
+	cfg.RedisKey, cfg.RedisDB = "renamed", 5
+	if err := saveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	var saved config
+	if b, err := os.ReadFile(path); err != nil || json.Unmarshal(b, &saved) != nil {
+		t.Fatalf("saved config: %s, %v", b, err)
+	}
+	if saved.RedisAddr != "localhost:6379" || saved.RedisPassword != "file" || !saved.ReadOnly || saved.RedisKey != "renamed" || saved.RedisDB != 5 {
+		t.Fatalf("saved: %+v", saved)
+	}
+
+	for name, bad := range map[string]string{"RFS_READ_ONLY": "yes", "RFS_REDIS_DB": "-1", "RFS_NFS_PORT": "20490x"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, bad)
+			if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), name) {
+				t.Fatalf("%s=%q: %v", name, bad, err)
+			}
+		})
+	}
+}
+
+func TestEnvConfigResolvedNotSaved(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rfs.config.json")
+	t.Setenv(configEnv, path)
+	t.Setenv("HOME", dir)
+	b := `{"redisAddr": "localhost:6379", "redisKey": "k", "mountpoint": "/mnt/k", "mountBackend": "fuse", "persistence": "rdb", "dataDir": "/var/lib/rfs"}`
+	if err := os.WriteFile(path, []byte(b), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RFS_MOUNTPOINT", "~/x")
+	t.Setenv("RFS_DATA_DIR", "~/d")
+	t.Setenv("RFS_MOUNT_BACKEND", "NFS")
+	t.Setenv("RFS_NFS_BIN", "~/bin/redis-fs-nfs")
+	t.Setenv("RFS_REDIS_SERVER_BIN", "~/bin/redis-server")
+
+	// As migrate does: resolve, change what the command changes, save.
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveConfigPaths(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Mountpoint != filepath.Join(dir, "x") || cfg.DataDir != filepath.Join(dir, "d") || cfg.MountBackend != "nfs" {
+		t.Fatalf("resolved: %+v", cfg)
+	}
+	cfg.RedisKey = "migrated"
+	if err := saveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	var saved config
+	if b, err := os.ReadFile(path); err != nil || json.Unmarshal(b, &saved) != nil {
+		t.Fatalf("saved config: %s, %v", b, err)
+	}
+	if saved.Mountpoint != "/mnt/k" || saved.DataDir != "/var/lib/rfs" || saved.MountBackend != "fuse" || saved.NFSBin != "" || saved.RedisServerBin != "" || saved.RedisKey != "migrated" {
+		t.Fatalf("saved: %+v", saved)
+	}
+}
+
+func TestEnvConfigWithoutFile(t *testing.T) {
+	t.Setenv(configEnv, filepath.Join(t.TempDir(), "rfs.config.json"))
+	if _, err := loadConfig(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("neither file nor variables: %v", err)
+	}
+
+	t.Setenv("RFS_REDIS_URL", "redis://:pw@redis:6379/1")
+	t.Setenv("RFS_USE_EXISTING_REDIS", "1")
+	t.Setenv("RFS_MOUNTPOINT", "/data")
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.noFile || !cfg.UseExistingRedis || cfg.RedisAddr != "redis:6379" || cfg.RedisPassword != "pw" || cfg.RedisDB != 1 || cfg.Mountpoint != "/data" || cfg.RedisKey != "myfs" {
+		t.Fatalf("from the environment alone: %+v", cfg)
+	}
+}
+
+func TestRedisPasswordFile(t *testing.T) {
+	dir := t.TempDir()
+	path, secret := filepath.Join(dir, "rfs.config.json"), filepath.Join(dir, "redis.pass")
+	t.Setenv(configEnv, path)
+	b := `{"redisAddr": "localhost:6379", "redisPassword": "stale", "redisPasswordFile": "` + secret + `", "redisKey": "k"}`
+	if err := os.WriteFile(path, []byte(b), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "redisPasswordFile") {
+		t.Fatalf("missing password file: %v", err)
+	}
+	os.WriteFile(secret, []byte("  s3cret\n"), 0o600)
+
+	cfg, err := loadConfig()
+	if err != nil || cfg.RedisPassword != "s3cret" {
+		t.Fatalf("password %q, %v", cfg.RedisPassword, err)
+	}
+	if err := saveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); strings.Contains(string(b), "s3cret") || strings.Contains(string(b), "stale") {
+		t.Fatalf("password saved in the config: %s", b)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("config mode %v, %v", fi.Mode(), err)
+	}
+
+	t.Setenv("RFS_REDIS_PASSWORD", "from-env")
+	if cfg, err := loadConfig(); err != nil || cfg.RedisPassword != "from-env" {
+		t.Fatalf("with RFS_REDIS_PASSWORD: %q, %v", cfg.RedisPassword, err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Import excludes — --exclude patterns and .rfsignore
+// ---------------------------------------------------------------------------
+//
+// Patterns follow gitignore: "*", "?" and "[...]" match within one path
+// element, "**" matches any number of them, a trailing "/" matches only
+// directories, and a leading "!" takes back an exclusion made by an earlier
+// pattern. The last pattern that matches decides. Two differences keep
+// command-line patterns doing what they look like: a pattern matches at any
+// depth unless it starts with "/", and "dir/**" excludes dir itself rather
+// than importing it empty.
+//
+// An excluded directory is pruned from the walk, so nothing below it is
+// read, and nothing below it can be taken back with "!". A directory whose
+// entries are all excluded is still imported, empty, unless --prune-empty
+// leaves it out too.
+
+// ignoreFileName is the exclude file honored in the root of an import.
+const ignoreFileName = ".rfsignore"
+
+type excludeRule struct {
+	pattern string
+	elems   []string // "**" matches any number of path elements
+	dirOnly bool
+	negate  bool
+}
+
+// excludeMatcher decides which entries of an import are left out.
+type excludeMatcher struct {
+	rules []excludeRule
+}
+
+// parseExclude compiles one pattern. Blank lines and "#" comments give a
+// zero rule and false.
+func parseExclude(line string) (excludeRule, bool, error) {
+	rule := excludeRule{pattern: line}
+	p := strings.TrimRight(line, " ")
+	if p == "" || strings.HasPrefix(p, "#") {
+		return rule, false, nil
+	}
+	if strings.HasPrefix(p, "!") {
+		rule.negate = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, `\#`) || strings.HasPrefix(p, `\!`) {
+		p = p[1:]
+	}
+	if s, ok := strings.CutSuffix(p, "/**"); ok {
+		p, rule.dirOnly = s, true
+	}
+	if s, ok := strings.CutSuffix(p, "/"); ok {
+		p, rule.dirOnly = s, true
+	}
+	anchored := strings.HasPrefix(p, "/")
+	if !anchored {
+		rule.elems = append(rule.elems, "**")
+	}
+	for _, e := range strings.Split(p, "/") {
+		if e == "" {
+			continue
+		}
+		if _, err := path.Match(e, ""); err != nil {
+			return rule, false, fmt.Errorf("invalid exclude pattern %q", line)
+		}
+		rule.elems = append(rule.elems, e)
+	}
+	if len(rule.elems) == 0 || (len(rule.elems) == 1 && !anchored) {
+		return rule, false, fmt.Errorf("exclude pattern %q matches nothing", line)
+	}
+	return rule, true, nil
+}
+
+// newExcludeMatcher compiles patterns in order; it returns nil when there
+// are none, so callers can skip matching altogether.
+func newExcludeMatcher(patterns []string) (*excludeMatcher, error) {
+	var m excludeMatcher
+	for _, p := range patterns {
+		rule, ok, err := parseExclude(p)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			m.rules = append(m.rules, rule)
+		}
+	}
+	if len(m.rules) == 0 {
+		return nil, nil
+	}
+	return &m, nil
+}
+
+// loadExcludes reads source's .rfsignore, if it has one, and adds patterns
+// after it, so those given on the command line win. It also returns how
+// many lines of the file were patterns.
+func loadExcludes(source string, patterns []string) (*excludeMatcher, int, error) {
+	var fromFile []string
+	f, err := os.Open(filepath.Join(source, ignoreFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, 0, err
+	}
+	if err == nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fromFile = append(fromFile, strings.TrimSuffix(sc.Text(), "\r"))
+		}
+		if err := sc.Err(); err != nil {
+			return nil, 0, fmt.Errorf("read %s: %w", ignoreFileName, err)
+		}
+	}
+	fileRules, err := newExcludeMatcher(fromFile)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", filepath.Join(source, ignoreFileName), err)
+	}
+	m, err := newExcludeMatcher(append(fromFile, patterns...))
+	if err != nil {
+		return nil, 0, err
+	}
+	n := 0
+	if fileRules != nil {
+		n = len(fileRules.rules)
+	}
+	return m, n, nil
+}
+
+// excluded reports whether the entry at rel, a slash-separated path below
+// the import root, is left out.
+func (m *excludeMatcher) excluded(rel string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	elems := strings.Split(rel, "/")
+	out := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if matchElems(r.elems, elems) {
+			out = !r.negate
+		}
+	}
+	return out
+}
+
+// emptied reports whether the directory at dir, rel below the import root,
+// has entries but would be imported empty because all of them are
+// excluded. With nested, a directory emptied the same way counts as
+// excluded too, as it is under --prune-empty.
+func (m *excludeMatcher) emptied(dir, rel string, nested bool) (bool, error) {
+	if m == nil {
+		return false, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		return false, err
+	}
+	for _, e := range entries {
+		childRel := path.Join(rel, e.Name())
+		if m.excluded(childRel, e.IsDir()) {
+			continue
+		}
+		if !nested || !e.IsDir() {
+			return false, nil
+		}
+		if empty, err := m.emptied(filepath.Join(dir, e.Name()), childRel, true); err != nil || !empty {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// printExcludes notes which patterns an import leaves out.
+func printExcludes(m *excludeMatcher, fromFile int) {
+	if m == nil {
+		return
+	}
+	var shown []string
+	for _, r := range m.rules {
+		shown = append(shown, r.pattern)
+	}
+	detail := ""
+	if fromFile > 0 {
+		detail = fmt.Sprintf(" (%d from %s)", fromFile, ignoreFileName)
+	}
+	fmt.Printf("  %s Excluding %s%s\n", clr(ansiDim, "▸"), strings.Join(shown, " "), clr(ansiDim, detail))
+}
+
+// promptExcludes asks the setup wizard which entries a migration leaves
+// out, mentioning the source's .rfsignore when it has one.
+func promptExcludes(r *bufio.Reader, out io.Writer, source string) ([]string, error) {
+	hint := "Comma-separated, e.g. node_modules/, .git/; empty for none"
+	if _, err := os.Stat(filepath.Join(source, ignoreFileName)); err == nil {
+		hint = "Added to the patterns in " + ignoreFileName + "; empty for none"
+	}
+	answer, err := promptString(r, out, "  Anything to leave out of the migration?\n  "+clr(ansiDim, hint), "")
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, p := range strings.Split(answer, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	if _, err := newExcludeMatcher(patterns); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
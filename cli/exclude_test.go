@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExcludeMatcher(t *testing.T) {
+	m, err := newExcludeMatcher([]string{
+		"# build output",
+		"node_modules/**",
+		".git/",
+		"*.log",
+		"/dist",
+		"!keep.log",
+		"src/**/gen",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"node_modules", false, false},
+		{".git", true, true},
+		{"a/b/.git", true, true},
+		{".gitignore", false, false},
+		{"debug.log", false, true},
+		{"logs/app.log", false, true},
+		{"keep.log", false, false},
+		{"dist", true, true},
+		{"web/dist", true, false},
+		{"src/gen", true, true},
+		{"src/a/b/gen", true, true},
+		{"lib/gen", true, false},
+		{"main.go", false, false},
+	} {
+		if got := m.excluded(tc.rel, tc.isDir); got != tc.want {
+			t.Errorf("excluded(%q, dir=%v) = %v, want %v", tc.rel, tc.isDir, got, tc.want)
+		}
+	}
+
+	if m, err := newExcludeMatcher([]string{"", "# only comments"}); m != nil || err != nil {
+		t.Errorf("blank list gave %+v, %v", m, err)
+	}
+	for _, bad := range []string{"[a-", "!", "/"} {
+		if _, err := newExcludeMatcher([]string{bad}); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestLoadExcludes(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ignoreFileName), []byte("# deps\r\nvendor/\n*.tmp\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, fromFile, err := loadExcludes(root, []string{"!keep.tmp"})
+	if err != nil || fromFile != 2 {
+		t.Fatalf("load: %d from file, %v", fromFile, err)
+	}
+	if !m.excluded("vendor", true) || !m.excluded("x.tmp", false) || m.excluded("keep.tmp", false) {
+		t.Errorf("rules %+v", m.rules)
+	}
+	if m, _, err := loadExcludes(t.TempDir(), nil); m != nil || err != nil {
+		t.Errorf("no patterns gave %+v, %v", m, err)
+	}
+}
+
+func TestExcludeEmptied(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"logs/old", "src", "bare"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"logs/a.log", "logs/old/b.log", "src/a.log", "src/main.go"} {
+		if err := os.WriteFile(filepath.Join(root, f), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := newExcludeMatcher([]string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An empty directory in the source is not one the excludes emptied,
+	// and logs still holds logs/old unless that is pruned too.
+	for _, c := range []struct {
+		rel          string
+		nested, want bool
+	}{
+		{"logs", false, false},
+		{"logs", true, true},
+		{"logs/old", false, true},
+		{"src", true, false},
+		{"bare", true, false},
+	} {
+		if got, err := m.emptied(filepath.Join(root, c.rel), c.rel, c.nested); err != nil || got != c.want {
+			t.Errorf("emptied(%s, %v) = %v, %v; want %v", c.rel, c.nested, got, err, c.want)
+		}
+	}
+	var none *excludeMatcher
+	if got, err := none.emptied(filepath.Join(root, "logs"), "logs", true); got || err != nil {
+		t.Errorf("no excludes: %v, %v", got, err)
+	}
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// cat, write, import, export — move file contents without mounting
+// ---------------------------------------------------------------------------
+
+// connectFilesystem loads the config and connects to its Redis for a
+// mount-less command; keyOverride replaces the configured key. The caller
+// closes the client.
+func connectFilesystem(ctx context.Context, keyOverride string) (config, *redis.Client, string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil, "", fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return cfg, nil, "", err
+	}
+	fsKey := cfg.RedisKey
+	if keyOverride != "" {
+		fsKey = keyOverride
+	}
+	rdb := newRedisClient(cfg, 4)
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return cfg, nil, "", fmt.Errorf("cannot connect to Redis at %s: %w", cfg.RedisAddr, err)
+	}
+	return cfg, rdb, fsKey, nil
+}
+
+// readContents returns a file's plaintext, decrypting with c when the
+// filesystem is encrypted.
+func readContents(ctx context.Context, fsClient client.Client, c *fileCipher, p string) ([]byte, error) {
+	data, err := fsClient.Cat(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("cat %s: %w", p, err)
+	}
+	if c == nil {
+		return data, nil
+	}
+	return c.open(p, data)
+}
+
+// writeContents replaces a file's contents, encrypting with c when set.
+func writeContents(ctx context.Context, fsClient client.Client, c *fileCipher, p string, data []byte) error {
+	if c != nil {
+		var err error
+		if data, err = c.seal(p, data); err != nil {
+			return err
+		}
+	}
+	if err := fsClient.Echo(ctx, p, data); err != nil {
+		return fmt.Errorf("echo %s: %w", p, err)
+	}
+	return nil
+}
+
+// resolveFile follows symlinks from p to a regular file. Contents are
+// sealed under the path they are stored at, so reads must name it.
+func resolveFile(ctx context.Context, fsClient client.Client, p string) (string, error) {
+	for hops := 0; hops < 40; hops++ {
+		st, err := fsClient.Stat(ctx, p)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case st == nil:
+			return "", fmt.Errorf("%s: no such file or directory", p)
+		case st.Type == "dir":
+			return "", fmt.Errorf("%s: is a directory", p)
+		case st.Type != "symlink":
+			return p, nil
+		}
+		target, err := fsClient.Readlink(ctx, p)
+		if err != nil {
+			return "", err
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(p), target)
+		}
+		p = path.Clean(target)
+	}
+	return "", fmt.Errorf("%s: too many levels of symbolic links", p)
+}
+
+func cmdCat(args []string) error {
+	usage := fmt.Sprintf("Usage: %s cat <path> [--key name] [--key-file file | --key-command cmd]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("cat")
+	key := fs.String("key", "", "filesystem key (defaults to the configured key)")
+	var kf keyFlags
+	kf.register(fs, false)
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("expected one path\n\n%s", usage)
+	}
+	userCipher, err := kf.load()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	_, rdb, fsKey, err := connectFilesystem(ctx, *key)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	c, err := cipherForKey(ctx, rdb, fsKey, userCipher)
+	if err != nil {
+		return err
+	}
+	fsClient := client.New(rdb, fsKey)
+	p, err := resolveFile(ctx, fsClient, path.Clean("/"+pos[0]))
+	if err != nil {
+		return err
+	}
+	data, err := readContents(ctx, fsClient, c, p)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func cmdWrite(args []string) error {
+	usage := fmt.Sprintf("Usage: %s write <path> [--key name] [--key-file file | --key-command cmd] < contents", filepath.Base(os.Args[0]))
+	fs := newFlagSet("write")
+	key := fs.String("key", "", "filesystem key (defaults to the configured key)")
+	var kf keyFlags
+	kf.register(fs, false)
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("expected one path\n\n%s", usage)
+	}
+	userCipher, err := kf.load()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	_, rdb, fsKey, err := connectFilesystem(ctx, *key)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	c, err := cipherForKey(ctx, rdb, fsKey, userCipher)
+	if err != nil {
+		return err
+	}
+	fsClient := client.New(rdb, fsKey)
+	// Writing through a symlink replaces its target, like a shell
+	// redirect; a missing file is created.
+	p := path.Clean("/" + pos[0])
+	if st, err := fsClient.Stat(ctx, p); err != nil {
+		return err
+	} else if st != nil {
+		if p, err = resolveFile(ctx, fsClient, p); err != nil {
+			return err
+		}
+	}
+	return writeContents(ctx, fsClient, c, p, data)
+}
+
+func cmdImport(args []string) error {
+	usage := fmt.Sprintf("Usage: %s import <directory> [--key name] [--merge] [--clobber] [--preserve-owner] [--rewrite-absolute-links] [--exclude pattern]... [--prune-empty] [--chunk-size size] [--encrypt] [--key-file file | --key-command cmd]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("import")
+	key := fs.String("key", "", "filesystem key (defaults to the configured key)")
+	merge := fs.Bool("merge", false, "import on top of an existing filesystem")
+	clobber := fs.Bool("clobber", false, "when merging, overwrite files that already exist in Redis")
+	preserveOwner := fs.Bool("preserve-owner", false, "keep original file owners even when not running as root")
+	rewriteLinks := fs.Bool("rewrite-absolute-links", false, "store symlinks that point into the directory by absolute path relative to the link")
+	var excludes stringsFlag
+	fs.Var(&excludes, "exclude", "leave out entries matching this gitignore-style `pattern` (repeatable; adds to .rfsignore)")
+	pruneEmpty := fs.Bool("prune-empty", false, "with --exclude, leave out directories whose entries are all excluded instead of importing them empty")
+	chunk := byteSizeFlag(defaultImportChunkSize)
+	fs.Var(&chunk, "chunk-size", "stream files larger than this in chunks of it (e.g. 8m)")
+	var kf keyFlags
+	kf.register(fs, true)
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("missing directory\n\n%s", usage)
+	}
+	if chunk <= 0 {
+		return fmt.Errorf("--chunk-size must be positive\n\n%s", usage)
+	}
+	sourceDir, err := expandPath(pos[0])
+	if err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+	if fi, err := os.Stat(sourceDir); err != nil {
+		return fmt.Errorf("cannot access %s: %w", sourceDir, err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", sourceDir)
+	}
+	exclude, fromFile, err := loadExcludes(sourceDir, excludes)
+	if err != nil {
+		return err
+	}
+	userCipher, err := kf.load()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	cfg, rdb, fsKey, err := connectFilesystem(ctx, *key)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	fsClient := client.New(rdb, fsKey)
+
+	opts := importOptions{merge: *merge, clobber: *clobber, rewriteLinks: *rewriteLinks, exclude: exclude, pruneEmpty: *pruneEmpty, chunk: int64(chunk)}
+	opts.ownership = importOwnership(os.Geteuid(), os.Getegid(), *preserveOwner)
+	opts.batch = newImportBatch(rdb, fsKey, cfg.importBatchSize(), opts.ownership)
+	if err := prepareImportTarget(ctx, rdb, fsClient, fsKey, kf.encrypt, userCipher, &opts); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	printExcludes(exclude, fromFile)
+	step := startStep("Importing files")
+	start := time.Now()
+	stats, err := importDirectory(ctx, fsClient, sourceDir, opts, func(st importStats) {
+		step.update("Importing · " + st.progress(start))
+	})
+	if err != nil {
+		step.fail(err.Error())
+		return err
+	}
+	detail := stats.summary()
+	if opts.cipher != nil {
+		detail += ", encrypted with key " + opts.cipher.fingerprint
+	}
+	step.succeed(detail)
+	stats.printEmptyDirs()
+	if err := recordImportOwnership(ctx, rdb, fsKey, opts.ownership); err != nil {
+		fmt.Printf("  %s Could not record the ownership mode: %v\n", clr(ansiYellow, "!"), err)
+	}
+	if err := recordImportOrigin(ctx, rdb, fsKey, sourceDir); err != nil {
+		fmt.Printf("  %s Could not record where the filesystem came from: %v\n", clr(ansiYellow, "!"), err)
+	}
+	if err := recordLinkRewrites(ctx, rdb, fsKey, stats.rewrittenLinks); err != nil {
+		fmt.Printf("  %s Could not record the rewritten symlinks: %v\n", clr(ansiYellow, "!"), err)
+	}
+	if !opts.rewriteLinks {
+		warnAbsoluteLinks(stats.links, sourceDir)
+	}
+	printLinkRewrites(stats.rewrittenLinks)
+	fmt.Println()
+	return nil
+}
+
+// prepareImportTarget checks that the key can take the import and settles
+// opts.cipher. A filesystem is encrypted entirely or not at all: importing
+// into an encrypted one needs its key, and --encrypt cannot merge into a
+// plaintext one. A new encrypted filesystem is marked before any file is
+// written, so an interrupted import is still recognized as encrypted.
+func prepareImportTarget(ctx context.Context, rdb *redis.Client, fsClient client.Client, fsKey string, encrypt bool, userCipher *fileCipher, opts *importOptions) error {
+	root, err := fsClient.Stat(ctx, "/")
+	if err != nil {
+		return err
+	}
+	if root != nil && !opts.merge {
+		return fmt.Errorf("filesystem %q already exists\nUse --merge to import on top of it", fsKey)
+	}
+	if root != nil {
+		c, err := cipherForKey(ctx, rdb, fsKey, userCipher)
+		if err != nil {
+			return err
+		}
+		if c == nil && encrypt {
+			return fmt.Errorf("filesystem %q is not encrypted; --encrypt cannot merge into it", fsKey)
+		}
+		opts.cipher = c
+		return nil
+	}
+	if userCipher == nil {
+		return nil
+	}
+	if !encrypt {
+		return errors.New("--key-file and --key-command only encrypt a new filesystem together with --encrypt")
+	}
+	// A stale marker on an otherwise empty key would name the wrong key.
+	if err := rdb.HDel(ctx, infoKey(fsKey), encryptionField, encryptionFingerprintField).Err(); err != nil {
+		return err
+	}
+	if err := fsClient.Mkdir(ctx, "/"); err != nil {
+		return fmt.Errorf("mkdir /: %w", err)
+	}
+	if err := recordKeyEncryption(ctx, rdb, fsKey, userCipher); err != nil {
+		return err
+	}
+	opts.cipher = userCipher
+	return nil
+}
+
+type exportStats struct {
+	Files         int
+	Dirs          int
+	Symlinks      int
+	LinksRestored int // of Symlinks, those given their original absolute target
+	Bytes         int64
+	OwnerFailures int // entries whose owner could not be restored
+}
+
+func (s exportStats) summary() string {
+	out := fmt.Sprintf("%d files, %d dirs, %d symlinks, %s", s.Files, s.Dirs, s.Symlinks, formatBytes(s.Bytes))
+	if s.LinksRestored > 0 {
+		out += fmt.Sprintf(", %d absolute links restored", s.LinksRestored)
+	}
+	return out
+}
+
+// exportOptions tune exportTree; the zero value writes into a directory
+// that does not exist yet or is empty.
+type exportOptions struct {
+	rewrites   map[string]linkRewrite // links to give back their original targets; may be nil
+	force      bool                   // write into a non-empty directory, replacing entries in the way
+	onProgress func(exportStats)
+}
+
+// exportTree writes the filesystem below "/" into dest. Modes, owners and
+// modification times are restored as import recorded them; an owner the
+// exporting user may not give away is counted in OwnerFailures instead,
+// and symlinks keep the time they are created. Links found in
+// opts.rewrites get back the targets they had before import rewrote them.
+func exportTree(ctx context.Context, fsClient client.Client, c *fileCipher, dest string, opts exportOptions) (exportStats, error) {
+	var stats exportStats
+	if empty, err := isEmptyDir(dest); err == nil && !empty && !opts.force {
+		return stats, fmt.Errorf("%s is not empty (--force writes into it anyway)", dest)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return stats, err
+	}
+	entries, err := listDir(ctx, fsClient, "/", lsOptions{recursive: true})
+	if err != nil {
+		return stats, err
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return stats, err
+	}
+
+	chown := func(local string, e lsEntry) {
+		if err := os.Lchown(local, int(e.UID), int(e.GID)); err != nil {
+			stats.OwnerFailures++
+		}
+	}
+	type stamp struct {
+		path  string
+		mtime time.Time
+	}
+	var stamps []stamp
+	var write func(entries []lsEntry) error
+	write = func(entries []lsEntry) error {
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			local := filepath.Join(dest, filepath.FromSlash(e.Path))
+			perm := os.FileMode(e.Mode).Perm()
+			if opts.force {
+				if err := clearExportPath(local, e.Type == "dir"); err != nil {
+					return err
+				}
+			}
+			switch e.Type {
+			case "dir":
+				// Created writable so its entries can be added; the real
+				// mode is applied once they are.
+				if err := os.Mkdir(local, 0o700); errors.Is(err, os.ErrExist) && opts.force {
+					if err := os.Chmod(local, 0o700); err != nil {
+						return err
+					}
+				} else if err != nil {
+					return err
+				}
+				if err := write(e.Children); err != nil {
+					return err
+				}
+				if err := os.Chmod(local, perm); err != nil {
+					return err
+				}
+				chown(local, e)
+				stats.Dirs++
+			case "symlink":
+				target, restored := originalLinkTarget(opts.rewrites, e.Path, e.Target)
+				if err := os.Symlink(target, local); err != nil {
+					return err
+				}
+				chown(local, e)
+				stats.Symlinks++
+				if restored {
+					stats.LinksRestored++
+				}
+			default:
+				data, err := readContents(ctx, fsClient, c, e.Path)
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(local, data, perm); err != nil {
+					return err
+				}
+				// Owner first: chown clears setuid and setgid bits.
+				chown(local, e)
+				if err := os.Chmod(local, perm); err != nil {
+					return err
+				}
+				stats.Files++
+				stats.Bytes += int64(len(data))
+			}
+			if e.Type != "symlink" {
+				stamps = append(stamps, stamp{local, e.Mtime})
+			}
+			if opts.onProgress != nil {
+				opts.onProgress(stats)
+			}
+		}
+		return nil
+	}
+	if err := write(entries); err != nil {
+		return stats, err
+	}
+	// Children were appended before their directories, so this order
+	// sets a directory's time after everything inside it is written.
+	for _, s := range stamps {
+		if err := os.Chtimes(s.path, s.mtime, s.mtime); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// clearExportPath removes what is at local so export --force can write
+// an entry there: anything but a directory, which a directory entry
+// reuses. A directory where a file or link goes is refused rather than
+// deleted with everything in it.
+func clearExportPath(local string, isDir bool) error {
+	info, err := os.Lstat(local)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if isDir {
+			return nil
+		}
+		return fmt.Errorf("%s is a directory in the destination but not in the filesystem", local)
+	}
+	return os.Remove(local)
+}
+
+func cmdExport(args []string) error {
+	usage := fmt.Sprintf("Usage: %s export <directory> [--key name] [--force] [--restore-absolute-links] [--key-file file | --key-command cmd]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("export")
+	key := fs.String("key", "", "filesystem key (defaults to the configured key)")
+	force := fs.Bool("force", false, "write into a non-empty directory, replacing files in the way")
+	restoreLinks := fs.Bool("restore-absolute-links", false, "give symlinks rewritten by --rewrite-absolute-links their original absolute targets")
+	var kf keyFlags
+	kf.register(fs, false)
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("missing directory\n\n%s", usage)
+	}
+	dest, err := expandPath(pos[0])
+	if err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+	userCipher, err := kf.load()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	cfg, rdb, fsKey, err := connectFilesystem(ctx, *key)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	c, err := cipherForKey(ctx, rdb, fsKey, userCipher)
+	if err != nil {
+		return err
+	}
+	fsClient := client.New(rdb, fsKey)
+	if st, err := fsClient.Stat(ctx, "/"); err != nil {
+		return err
+	} else if st == nil {
+		return fmt.Errorf("no filesystem found at key %q on %s (db %d)", fsKey, cfg.RedisAddr, cfg.RedisDB)
+	}
+
+	opts := exportOptions{force: *force}
+	if *restoreLinks {
+		if opts.rewrites, err = loadLinkRewrites(ctx, rdb, fsKey); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println()
+	step := startStep("Exporting " + fsKey)
+	opts.onProgress = func(s exportStats) {
+		step.update(fmt.Sprintf("Exporting %s · %d files, %d dirs, %d symlinks, %s", fsKey, s.Files, s.Dirs, s.Symlinks, formatBytes(s.Bytes)))
+	}
+	stats, err := exportTree(ctx, fsClient, c, dest, opts)
+	if err != nil {
+		step.fail(err.Error())
+		return err
+	}
+	step.succeed(stats.summary() + " to " + dest)
+	if stats.OwnerFailures > 0 {
+		fmt.Printf("  %s %d entries kept your ownership: their recorded owner could not be restored %s\n",
+			clr(ansiYellow, "!"), stats.OwnerFailures, clr(ansiDim, "(run as root to restore it)"))
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Named filesystems
+// ---------------------------------------------------------------------------
+//
+// A config describes one filesystem with redisKey and mountpoint, or
+// several with a filesystems list, each mounted from its own key at its own
+// mountpoint. They share the Redis server and every other setting. Each is
+// known by its name, which defaults to its key, and state.json records
+// each one that is up under that name.
+
+// fsEntry is one filesystem in the config's list.
+type fsEntry struct {
+	Name       string `json:"name,omitempty"`
+	RedisKey   string `json:"redisKey"`
+	Mountpoint string `json:"mountpoint"`
+	ReadOnly   bool   `json:"readOnly,omitempty"`
+}
+
+// filesystems lists the configured filesystems: the filesystems list, or
+// the single one the top-level fields describe.
+func (c config) filesystems() []fsEntry {
+	if len(c.Filesystems) == 0 {
+		return []fsEntry{{Name: c.RedisKey, RedisKey: c.RedisKey, Mountpoint: c.Mountpoint, ReadOnly: c.ReadOnly}}
+	}
+	out := make([]fsEntry, len(c.Filesystems))
+	for i, e := range c.Filesystems {
+		if e.Name == "" {
+			e.Name = e.RedisKey
+		}
+		out[i] = e
+	}
+	return out
+}
+
+// checkFilesystems rejects a filesystems list whose entries cannot all be
+// up at once.
+func (c config) checkFilesystems() error {
+	names := map[string]bool{}
+	mountpoints := map[string]string{}
+	for i, e := range c.filesystems() {
+		switch {
+		case e.Name == "":
+			return fmt.Errorf("filesystems[%d]: redisKey must not be empty", i)
+		case strings.ContainsAny(e.Name, "/ \t"):
+			return fmt.Errorf("filesystems[%d]: name %q must not contain slashes or spaces", i, e.Name)
+		case names[e.Name]:
+			return fmt.Errorf("filesystems[%d]: name %q is used twice", i, e.Name)
+		case e.Mountpoint == "":
+			return fmt.Errorf("filesystem %s has no mountpoint", e.Name)
+		}
+		names[e.Name] = true
+		mp, err := expandPath(e.Mountpoint)
+		if err != nil {
+			return err
+		}
+		if other, ok := mountpoints[mp]; ok {
+			return fmt.Errorf("filesystems %s and %s are both mounted at %s", other, e.Name, mp)
+		}
+		mountpoints[mp] = e.Name
+	}
+	return nil
+}
+
+// selectFilesystems picks the entry called name, or every entry when name
+// is empty.
+func (c config) selectFilesystems(name string) ([]fsEntry, error) {
+	all := c.filesystems()
+	if name == "" {
+		return all, nil
+	}
+	for _, e := range all {
+		if e.Name == name {
+			return []fsEntry{e}, nil
+		}
+	}
+	names := make([]string, len(all))
+	for i, e := range all {
+		names[i] = e.Name
+	}
+	return nil, fmt.Errorf("no filesystem named %q in %s (configured: %s)", name, configPath(), strings.Join(names, ", "))
+}
+
+// forFilesystem is c narrowed to the filesystem e. With a filesystems
+// list, each entry gets a mount log of its own and, under NFS, the next
+// port after the entry before it.
+func (c config) forFilesystem(e fsEntry) config {
+	out := c
+	out.name = e.Name
+	out.RedisKey, out.Mountpoint, out.ReadOnly = e.RedisKey, e.Mountpoint, e.ReadOnly
+	if len(c.Filesystems) == 0 {
+		return out
+	}
+	if c.MountLog != "" {
+		ext := filepath.Ext(c.MountLog)
+		out.MountLog = strings.TrimSuffix(c.MountLog, ext) + "-" + e.Name + ext
+	}
+	for i, other := range c.filesystems() {
+		if other.Name == e.Name && c.NFSPort > 0 {
+			out.NFSPort = c.NFSPort + i
+		}
+	}
+	return out
+}
+
+// overrideRunName names a run of up with --key or --mountpoint: after its
+// key, and its mountpoint too when a configured filesystem has that name.
+func overrideRunName(base, cfg config) string {
+	name := cfg.RedisKey
+	for _, e := range base.filesystems() {
+		if e.Name == name {
+			name += "@" + filepath.Base(cfg.Mountpoint)
+			break
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == ' ' || r == '\t' {
+			return '-'
+		}
+		return r
+	}, name)
+}
+
+// asOverrideRun makes cfg, a filesystem of c brought up with --key or
+// --mountpoint, a filesystem called name. Like a filesystems entry it gets
+// a mount log of its own and, under NFS, a port of its own: the first
+// after the configured filesystems'.
+func (c config) asOverrideRun(cfg *config, name string) {
+	cfg.name = name
+	if c.MountLog != "" {
+		ext := filepath.Ext(c.MountLog)
+		cfg.MountLog = strings.TrimSuffix(c.MountLog, ext) + "-" + name + ext
+	}
+	port := c.NFSPort
+	if port <= 0 {
+		port = 20490
+	}
+	cfg.NFSPort = port + len(c.filesystems())
+}
+
+// fsName is the name state records the filesystem cfg describes under.
+func (c config) fsName() string {
+	if c.name != "" {
+		return c.name
+	}
+	return c.RedisKey
+}
+
+// states is state.json: each filesystem that is up, by name. The
+// filesystems share one Redis server, so its fields agree across entries.
+type states map[string]state
+
+// names lists the filesystems in order.
+func (s states) names() []string {
+	out := make([]string, 0, len(s))
+	for name := range s {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// running returns the first filesystem whose mount daemon is alive.
+func (s states) running() (state, bool) {
+	for _, name := range s.names() {
+		if st := s[name]; st.MountPID > 0 && processAlive(st.MountPID) {
+			return st, true
+		}
+	}
+	return state{}, false
+}
+
+// forKey returns the filesystem mounted from fsKey on cfg's Redis.
+func (s states) forKey(cfg config, fsKey string) (state, bool) {
+	for _, name := range s.names() {
+		if st := s[name]; st.RedisKey == fsKey && st.RedisAddr == cfg.RedisAddr && st.RedisDB == cfg.RedisDB {
+			return st, true
+		}
+	}
+	return state{}, false
+}
+
+// runningElsewhere names the live filesystem other than name mounted at
+// mountpoint, if there is one.
+func (s states) runningElsewhere(name, mountpoint string) (string, bool) {
+	for _, other := range s.names() {
+		st := s[other]
+		if other != name && st.Mountpoint == mountpoint && st.MountPID > 0 && processAlive(st.MountPID) {
+			return other, true
+		}
+	}
+	return "", false
+}
+
+// stateFile is the layout of state.json.
+type stateFile struct {
+	Filesystems states `json:"filesystems"`
+}
+
+// decodeStates reads state.json, including one written before it could
+// hold more than one filesystem.
+func decodeStates(b []byte) (states, error) {
+	var f stateFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if f.Filesystems != nil {
+		for name, st := range f.Filesystems {
+			st.Name = name
+			f.Filesystems[name] = st
+		}
+		return f.Filesystems, nil
+	}
+	var st state
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	if st.Mountpoint == "" && st.MountPID == 0 {
+		return states{}, nil
+	}
+	st.Name = st.RedisKey
+	return states{st.Name: st}, nil
+}
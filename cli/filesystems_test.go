@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFilesystems(t *testing.T) {
+	single := config{RedisKey: "myfs", Mountpoint: "/mnt/rfs", ReadOnly: true, MountLog: "/tmp/rfs-mount.log", NFSPort: 20490}
+	if got := single.filesystems(); len(got) != 1 || got[0] != (fsEntry{Name: "myfs", RedisKey: "myfs", Mountpoint: "/mnt/rfs", ReadOnly: true}) {
+		t.Fatalf("single: %+v", got)
+	}
+	if c := single.forFilesystem(single.filesystems()[0]); c.MountLog != single.MountLog || c.NFSPort != 20490 || c.fsName() != "myfs" {
+		t.Fatalf("single narrowed: log %s, port %d", c.MountLog, c.NFSPort)
+	}
+
+	multi := single
+	multi.Filesystems = []fsEntry{
+		{Name: "notes", RedisKey: "notes-v2", Mountpoint: "/home/me/notes"},
+		{RedisKey: "projects", Mountpoint: "/home/me/projects", ReadOnly: true},
+	}
+	if err := multi.checkFilesystems(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := multi.selectFilesystems("projects")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("select projects: %+v, %v", entries, err)
+	}
+	c := multi.forFilesystem(entries[0])
+	if c.RedisKey != "projects" || c.Mountpoint != "/home/me/projects" || !c.ReadOnly || c.fsName() != "projects" {
+		t.Fatalf("projects: %+v", c)
+	}
+	if c.MountLog != "/tmp/rfs-mount-projects.log" || c.NFSPort != 20491 {
+		t.Fatalf("projects: log %s, port %d", c.MountLog, c.NFSPort)
+	}
+	if all, _ := multi.selectFilesystems(""); len(all) != 2 {
+		t.Fatalf("select all: %+v", all)
+	}
+	if _, err := multi.selectFilesystems("music"); err == nil || !strings.Contains(err.Error(), "notes, projects") {
+		t.Fatalf("select music: %v", err)
+	}
+
+	for _, bad := range [][]fsEntry{
+		{{Name: "a", RedisKey: "a", Mountpoint: "/mnt/a"}, {Name: "a", RedisKey: "b", Mountpoint: "/mnt/b"}},
+		{{RedisKey: "a", Mountpoint: "/mnt/x"}, {RedisKey: "b", Mountpoint: "/mnt/x/"}},
+		{{RedisKey: "a"}},
+		{{Mountpoint: "/mnt/a"}},
+		{{Name: "a/b", RedisKey: "a", Mountpoint: "/mnt/a"}},
+	} {
+		if err := (config{Filesystems: bad}).checkFilesystems(); err == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+}
+
+func TestDecodeLegacyState(t *testing.T) {
+	sts, err := decodeStates([]byte(`{"mount_pid": 10, "mountpoint": "/mnt/rfs", "redis_key": "myfs", "redis_addr": "localhost:6379"}`))
+	if err != nil || len(sts) != 1 || sts["myfs"].MountPID != 10 || sts["myfs"].Name != "myfs" {
+		t.Fatalf("legacy: %+v, %v", sts, err)
+	}
+	sts, err = decodeStates([]byte(`{"filesystems": {"notes": {"mount_pid": 11, "redis_key": "notes-v2"}}}`))
+	if err != nil || sts["notes"].MountPID != 11 || sts["notes"].Name != "notes" {
+		t.Fatalf("current: %+v, %v", sts, err)
+	}
+	if sts, err := decodeStates([]byte(`{}`)); err != nil || len(sts) != 0 {
+		t.Fatalf("empty: %+v, %v", sts, err)
+	}
+}
+
+func TestStopServicesKeepsRedisForTheLastFilesystem(t *testing.T) {
+	cfg, _, _ := fakeManagedRedis(t, 46374)
+	t.Setenv(configEnv, filepath.Join(t.TempDir(), "rfs.config.json"))
+	pid, _, err := acquireManagedRedis(&cfg, redisProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sts := states{}
+	for _, name := range []string{"notes", "projects"} {
+		st := stateFor(cfg, pid)
+		st.Name, st.RedisKey, st.MountBackend = name, name, mountBackendFuse
+		st.Mountpoint = filepath.Join(t.TempDir(), name)
+		sts[name] = st
+	}
+	if err := withState(func(s *stateStore) error { return s.save(sts) }); err != nil {
+		t.Fatal(err)
+	}
+
+	down := func(names []string, purgeData bool) error {
+		return withState(func(s *stateStore) error {
+			cur, err := s.load()
+			if err != nil {
+				return err
+			}
+			return stopServices(s, cur, names, false, purgeData)
+		})
+	}
+	if err := down([]string{"notes"}, true); err == nil {
+		t.Fatal("--purge-data went ahead with a filesystem still up")
+	}
+	if err := down([]string{"notes"}, false); err != nil {
+		t.Fatal(err)
+	}
+	left, err := loadState()
+	if err != nil || len(left) != 1 || left["projects"].Mountpoint != sts["projects"].Mountpoint {
+		t.Fatalf("after notes down: %+v, %v", left, err)
+	}
+	if !processAlive(pid) {
+		t.Fatal("Redis stopped while projects still uses it")
+	}
+
+	if err := down([]string{"projects"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadState(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("state after the last down: %v", err)
+	}
+	if processAlive(pid) {
+		t.Fatal("Redis left running after the last filesystem went down")
+	}
+}
+
+func TestOverrideRunBesidePrimary(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	path := filepath.Join(dir, "rfs.config.json")
+	t.Setenv(configEnv, path)
+	primary := filepath.Join(dir, "myfs")
+	b := `{"useExistingRedis": true, "redisAddr": "localhost:6379", "redisKey": "myfs", "mountpoint": "` + primary + `", "mountBackend": "fuse", "mountBin": "/bin/true"}`
+	if err := os.WriteFile(path, []byte(b), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sts := states{"myfs": {Name: "myfs", RedisKey: "myfs", RedisAddr: "localhost:6379", Mountpoint: primary, MountPID: os.Getpid(), MountBackend: mountBackendFuse}}
+	if err := withState(func(s *stateStore) error { return s.save(sts) }); err != nil {
+		t.Fatal(err)
+	}
+	prepare := func(ov upOverrides) ([]config, error) {
+		var cfgs []config
+		err := withState(func(s *stateStore) (err error) {
+			cfgs, err = prepareUp(s, "", ov)
+			return err
+		})
+		return cfgs, err
+	}
+
+	if _, err := prepare(upOverrides{}); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Fatalf("primary again: %v", err)
+	}
+	ro := true
+	if _, err := prepare(upOverrides{ReadOnly: &ro}); err == nil {
+		t.Fatal("primary again, read-only, was not refused")
+	}
+
+	key, mp := "other", filepath.Join(dir, "other")
+	cfgs, err := prepare(upOverrides{Key: &key, Mountpoint: &mp})
+	if err != nil || len(cfgs) != 1 || cfgs[0].fsName() != "other" || cfgs[0].RedisKey != "other" || cfgs[0].Mountpoint != mp {
+		t.Fatalf("override beside the primary: %+v, %v", cfgs, err)
+	}
+	same := "myfs"
+	if cfgs, err := prepare(upOverrides{Key: &same, Mountpoint: &mp}); err != nil || cfgs[0].fsName() != "myfs@other" {
+		t.Fatalf("primary's key at another mountpoint: %+v, %v", cfgs, err)
+	}
+
+	// Recorded under its own name, down finds it there, and the primary
+	// stays up.
+	st := sts["myfs"]
+	st.Name, st.RedisKey, st.Mountpoint, st.Overrides = "other", "other", mp, cfgs[0].overrides
+	sts["other"] = st
+	if names, err := downTargets(sts, "other"); err != nil || len(names) != 1 || names[0] != "other" {
+		t.Fatalf("down other: %v, %v", names, err)
+	}
+	base, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := configForState(base, st); err != nil || cfg.fsName() != "other" || cfg.RedisKey != "other" {
+		t.Fatalf("config for the override run: %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// FUSE preflight — catch a host that cannot mount before starting the daemon
+// ---------------------------------------------------------------------------
+
+// fuseHost is what checkFUSE inspects, so tests can describe a host
+// without touching the real one.
+type fuseHost interface {
+	GOOS() string
+	Euid() int
+	Stat(path string) (os.FileInfo, error)
+	// OpenRW opens path read-write and closes it again. Unlike access(2)
+	// it also sees a container's device cgroup refusing the open.
+	OpenRW(path string) error
+	LookPath(name string) (string, error)
+	ReadFile(path string) ([]byte, error)
+}
+
+type realFuseHost struct{}
+
+func (realFuseHost) GOOS() string                          { return runtime.GOOS }
+func (realFuseHost) Euid() int                             { return os.Geteuid() }
+func (realFuseHost) Stat(path string) (os.FileInfo, error) { return os.Stat(path) }
+func (realFuseHost) LookPath(name string) (string, error)  { return exec.LookPath(name) }
+func (realFuseHost) ReadFile(path string) ([]byte, error)  { return os.ReadFile(path) }
+
+func (realFuseHost) OpenRW(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// fuseProblem is one reason the host cannot mount through FUSE, with what
+// to do about it.
+type fuseProblem struct {
+	Summary string
+	Hint    string
+}
+
+// macFUSEBundles are where the macFUSE (and older OSXFUSE) installers put
+// their filesystem bundle.
+var macFUSEBundles = []string{"/Library/Filesystems/macfuse.fs", "/Library/Filesystems/osxfuse.fs"}
+
+// checkFUSE lists everything that would stop a FUSE mount on host, so a
+// fresh machine fails with the cause instead of a mount timeout whose
+// reason is buried in the mount log.
+func checkFUSE(host fuseHost, allowOther bool) []fuseProblem {
+	if host.GOOS() == "darwin" {
+		for _, p := range macFUSEBundles {
+			if _, err := host.Stat(p); err == nil {
+				return nil
+			}
+		}
+		return []fuseProblem{{
+			Summary: "macFUSE is not installed",
+			Hint:    "Install it with: brew install --cask macfuse (or use the nfs backend, which needs nothing extra)",
+		}}
+	}
+
+	install := fusePackageHint(host)
+	var problems []fuseProblem
+	if _, err := host.Stat("/dev/fuse"); err != nil {
+		problems = append(problems, fuseProblem{
+			Summary: "/dev/fuse does not exist",
+			Hint:    "Load the module with: sudo modprobe fuse\nIn a container, start it with --device /dev/fuse --cap-add SYS_ADMIN",
+		})
+	} else if err := host.OpenRW("/dev/fuse"); err != nil {
+		hint := "Check its permissions (crw-rw-rw- is typical) or add your user to the fuse group"
+		if errors.Is(err, os.ErrPermission) && host.Euid() == 0 {
+			hint = "The device is present but refused; in a container, pass --device /dev/fuse rather than bind-mounting it"
+		}
+		problems = append(problems, fuseProblem{Summary: fmt.Sprintf("cannot open /dev/fuse: %v", unwrapPathError(err)), Hint: hint})
+	}
+
+	if _, err := host.LookPath("fusermount3"); err != nil {
+		if _, err := host.LookPath("fusermount"); err != nil {
+			problems = append(problems, fuseProblem{Summary: "fusermount3 was not found on PATH", Hint: install})
+		}
+	}
+
+	if allowOther && !allowOtherPermitted(host) {
+		problems = append(problems, fuseProblem{
+			Summary: "allowOther is configured but /etc/fuse.conf does not enable user_allow_other",
+			Hint:    "Add a line 'user_allow_other' to /etc/fuse.conf, or turn allowOther off (or drop --allow-other)",
+		})
+	}
+	return problems
+}
+
+// allowOtherPermitted reports whether this user may mount with
+// allow_other: root always may, everyone else needs fuse.conf's
+// permission.
+func allowOtherPermitted(host fuseHost) bool {
+	if host.Euid() == 0 {
+		return true
+	}
+	conf, err := host.ReadFile("/etc/fuse.conf")
+	return err == nil && fuseConfAllowsOther(conf)
+}
+
+// fuseConfAllowsOther reports whether fuse.conf has an uncommented
+// user_allow_other line.
+func fuseConfAllowsOther(conf []byte) bool {
+	sc := bufio.NewScanner(bytes.NewReader(conf))
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) == "user_allow_other" {
+			return true
+		}
+	}
+	return false
+}
+
+// fusePackageHint names the install command for fuse3 on the host's
+// distribution, as identified by /etc/os-release.
+func fusePackageHint(host fuseHost) string {
+	release, _ := host.ReadFile("/etc/os-release")
+	ids := osReleaseIDs(release)
+	for _, id := range ids {
+		switch id {
+		case "debian", "ubuntu":
+			return "Install it with: sudo apt-get install fuse3"
+		case "fedora", "rhel", "centos":
+			return "Install it with: sudo dnf install fuse3"
+		case "arch":
+			return "Install it with: sudo pacman -S fuse3"
+		case "alpine":
+			return "Install it with: sudo apk add fuse3"
+		case "suse", "opensuse":
+			return "Install it with: sudo zypper install fuse3"
+		}
+	}
+	return "Install your distribution's fuse3 package"
+}
+
+// osReleaseIDs returns ID followed by the entries of ID_LIKE.
+func osReleaseIDs(release []byte) []string {
+	var id string
+	var like []string
+	sc := bufio.NewScanner(bytes.NewReader(release))
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), "=")
+		if !ok {
+			continue
+		}
+		v = strings.Trim(v, `"'`)
+		switch k {
+		case "ID":
+			id = v
+		case "ID_LIKE":
+			like = strings.Fields(v)
+		}
+	}
+	if id == "" {
+		return like
+	}
+	return append([]string{id}, like...)
+}
+
+func unwrapPathError(err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
+
+// checkFUSEReady fails with every FUSE problem on this host, when the
+// config mounts through FUSE.
+func checkFUSEReady(cfg config) error {
+	if cfg.MountBackend != mountBackendFuse {
+		return nil
+	}
+	problems := checkFUSE(realFuseHost{}, cfg.AllowOther)
+	if len(problems) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("FUSE is not usable on this machine:")
+	for _, p := range problems {
+		fmt.Fprintf(&b, "\n  - %s\n    %s", p.Summary, strings.ReplaceAll(p.Hint, "\n", "\n    "))
+	}
+	return errors.New(b.String())
+}
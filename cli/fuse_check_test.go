@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFuseHost describes a host by the files and binaries it has.
+type fakeFuseHost struct {
+	goos    string
+	euid    int
+	files   map[string]string // path -> contents
+	bins    map[string]bool
+	openErr error
+}
+
+func (h fakeFuseHost) GOOS() string { return h.goos }
+func (h fakeFuseHost) Euid() int    { return h.euid }
+
+func (h fakeFuseHost) Stat(path string) (os.FileInfo, error) {
+	if _, ok := h.files[path]; !ok {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	return fakeFileInfo(path), nil
+}
+
+func (h fakeFuseHost) OpenRW(path string) error {
+	if _, err := h.Stat(path); err != nil {
+		return err
+	}
+	return h.openErr
+}
+
+func (h fakeFuseHost) LookPath(name string) (string, error) {
+	if !h.bins[name] {
+		return "", errors.New("not found")
+	}
+	return "/usr/bin/" + name, nil
+}
+
+func (h fakeFuseHost) ReadFile(path string) ([]byte, error) {
+	c, ok := h.files[path]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return []byte(c), nil
+}
+
+type fakeFileInfo string
+
+func (f fakeFileInfo) Name() string       { return string(f) }
+func (f fakeFileInfo) Size() int64        { return 0 }
+func (f fakeFileInfo) Mode() fs.FileMode  { return 0o666 }
+func (f fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (f fakeFileInfo) IsDir() bool        { return false }
+func (f fakeFileInfo) Sys() interface{}   { return nil }
+
+func TestCheckFUSE(t *testing.T) {
+	ubuntu := `NAME="Ubuntu"` + "\nID=ubuntu\nID_LIKE=debian\n"
+	healthy := func() fakeFuseHost {
+		return fakeFuseHost{
+			goos:  "linux",
+			euid:  1000,
+			files: map[string]string{"/dev/fuse": "", "/etc/os-release": ubuntu, "/etc/fuse.conf": "# user_allow_other\n"},
+			bins:  map[string]bool{"fusermount3": true},
+		}
+	}
+
+	cases := []struct {
+		name       string
+		host       func() fakeFuseHost
+		allowOther bool
+		want       []string // substrings, one per expected problem
+	}{
+		{name: "healthy", host: healthy},
+		{name: "old fusermount is enough", host: func() fakeFuseHost {
+			h := healthy()
+			h.bins = map[string]bool{"fusermount": true}
+			return h
+		}},
+		{name: "fresh vm", host: func() fakeFuseHost {
+			h := healthy()
+			delete(h.files, "/dev/fuse")
+			h.bins = nil
+			return h
+		}, want: []string{"modprobe fuse", "apt-get install fuse3"}},
+		{name: "fedora package", host: func() fakeFuseHost {
+			h := healthy()
+			h.files["/etc/os-release"] = "ID=fedora\n"
+			h.bins = nil
+			return h
+		}, want: []string{"dnf install fuse3"}},
+		{name: "unknown distro", host: func() fakeFuseHost {
+			h := healthy()
+			delete(h.files, "/etc/os-release")
+			h.bins = nil
+			return h
+		}, want: []string{"distribution's fuse3 package"}},
+		{name: "device refused", host: func() fakeFuseHost {
+			h := healthy()
+			h.openErr = &fs.PathError{Op: "open", Path: "/dev/fuse", Err: fs.ErrPermission}
+			return h
+		}, want: []string{"cannot open /dev/fuse: permission denied"}},
+		{name: "allow_other commented out", host: healthy, allowOther: true, want: []string{"user_allow_other"}},
+		{name: "allow_other enabled", host: func() fakeFuseHost {
+			h := healthy()
+			h.files["/etc/fuse.conf"] = "mount_max = 1000\n  user_allow_other  \n"
+			return h
+		}, allowOther: true},
+		{name: "root needs no fuse.conf", host: func() fakeFuseHost {
+			h := healthy()
+			h.euid = 0
+			return h
+		}, allowOther: true},
+		{name: "macfuse missing", host: func() fakeFuseHost {
+			return fakeFuseHost{goos: "darwin", files: map[string]string{}}
+		}, want: []string{"brew install --cask macfuse"}},
+		{name: "macfuse installed", host: func() fakeFuseHost {
+			return fakeFuseHost{goos: "darwin", files: map[string]string{"/Library/Filesystems/macfuse.fs": ""}}
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			problems := checkFUSE(c.host(), c.allowOther)
+			if len(problems) != len(c.want) {
+				t.Fatalf("got %d problems %+v, want %d", len(problems), problems, len(c.want))
+			}
+			for i, p := range problems {
+				if text := p.Summary + "\n" + p.Hint; !strings.Contains(text, c.want[i]) {
+					t.Errorf("problem %d %q lacks %q", i, text, c.want[i])
+				}
+			}
+		})
+	}
+}
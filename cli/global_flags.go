@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Global flags: options that apply to every command, wherever they appear
+// ---------------------------------------------------------------------------
+//
+// Global flags are taken out of the arguments wherever they appear, before
+// the command sees them, so `rfs up --config x` and `rfs --config x up`
+// mean the same thing. Arguments after a bare "--" are left alone. The
+// config file can also come from RFS_CONFIG, which the flag overrides.
+
+// configEnv names the config file when --config is not given.
+const configEnv = "RFS_CONFIG"
+
+// globalOptions holds the global flags.
+type globalOptions struct {
+	config  string
+	profile string
+}
+
+// globalFlags lists the global flags and where each one's value goes.
+var globalFlags = map[string]func(g *globalOptions, value string){
+	"config":  func(g *globalOptions, v string) { g.config = v },
+	"profile": func(g *globalOptions, v string) { g.profile = v },
+}
+
+// splitGlobalFlags removes the global flags from args, in either the
+// --flag value or --flag=value form, and returns the rest in order.
+func splitGlobalFlags(args []string) (globalOptions, []string, error) {
+	var g globalOptions
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		set, ok := globalFlags[name]
+		if !ok || !strings.HasPrefix(a, "-") {
+			rest = append(rest, a)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return g, nil, fmt.Errorf("flag needs an argument: --%s", name)
+			}
+			i++
+			value = args[i]
+		}
+		if value == "" {
+			return g, nil, fmt.Errorf("flag needs an argument: --%s", name)
+		}
+		set(&g, value)
+	}
+	return g, rest, nil
+}
+
+// configSource says where configPath came from: the --config flag, the
+// --profile flag, the RFS_CONFIG environment variable, or the default in
+// the config directory.
+func configSource() string {
+	switch {
+	case cfgPathOverride != "":
+		return "--config"
+	case cfgProfile != "":
+		return "--profile " + cfgProfile
+	case os.Getenv(configEnv) != "":
+		return configEnv
+	}
+	return "default"
+}
+
+// configPathLabel is configPath with its source, for status and usage.
+func configPathLabel() string {
+	return fmt.Sprintf("%s (%s)", configPath(), configSource())
+}
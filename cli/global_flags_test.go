@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitGlobalFlags(t *testing.T) {
+	tests := []struct {
+		args   []string
+		config string
+		rest   []string
+	}{
+		{[]string{"--config", "a.json", "up"}, "a.json", []string{"up"}},
+		{[]string{"up", "--config", "a.json", "--readonly"}, "a.json", []string{"up", "--readonly"}},
+		{[]string{"status", "--watch", "--config=a.json"}, "a.json", []string{"status", "--watch"}},
+		{[]string{"-config", "a.json", "down"}, "a.json", []string{"down"}},
+		{[]string{"up", "--config", "a.json", "--config", "b.json"}, "b.json", []string{"up"}},
+		{[]string{"up", "--key", "config"}, "", []string{"up", "--key", "config"}},
+		{[]string{"write", "/f", "--", "--config", "a.json"}, "", []string{"write", "/f", "--", "--config", "a.json"}},
+	}
+	for _, tt := range tests {
+		g, rest, err := splitGlobalFlags(tt.args)
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if g.config != tt.config || !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("%q: got config %q, rest %q; want %q, %q", tt.args, g.config, rest, tt.config, tt.rest)
+		}
+	}
+
+	for _, args := range [][]string{{"up", "--config"}, {"--config=", "up"}} {
+		if _, _, err := splitGlobalFlags(args); err == nil || !strings.Contains(err.Error(), "--config") {
+			t.Errorf("%q: err = %v, want a missing argument", args, err)
+		}
+	}
+}
+
+func TestConfigPathPrecedence(t *testing.T) {
+	defer func(prev string) { cfgPathOverride = prev }(cfgPathOverride)
+
+	cfgPathOverride = ""
+	t.Setenv(configEnv, "")
+	if got := configPath(); got != defaultConfigPath() || configSource() != "default" {
+		t.Errorf("no flag or env: %s (%s)", got, configSource())
+	}
+
+	t.Setenv(configEnv, "/tmp/env.json")
+	if got := configPath(); got != "/tmp/env.json" || configSource() != configEnv {
+		t.Errorf("env: %s (%s)", got, configSource())
+	}
+
+	cfgPathOverride = "/tmp/flag.json"
+	if got := configPath(); got != "/tmp/flag.json" || configSource() != "--config" {
+		t.Errorf("flag and env: %s (%s)", got, configSource())
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// Batched import of small files
+// ---------------------------------------------------------------------------
+//
+// Writing a file through the client costs a dozen round trips: parents are
+// checked, the inode written, its parent's entry set updated, the counters
+// bumped, then mode, owner and times set one call at a time. For a tree of
+// thousands of tiny files that latency is nearly the whole import. Small
+// files are instead queued and written in one pipeline per batch: each
+// file's complete inode and its parent's entry, then the counters for the
+// batch. Their directories already exist, since the walk creates each
+// directory before its contents. Larger files still go through the client.
+
+const (
+	// defaultImportBatchSize is how many small files share a pipeline
+	// unless the config's importBatchSize says otherwise.
+	defaultImportBatchSize = 256
+	// importBatchBytes flushes a batch early once its contents reach it.
+	importBatchBytes = 4 << 20
+	// smallFileMax is the largest file that is batched.
+	smallFileMax = 64 << 10
+)
+
+// importBatchSize is the configured number of files per pipeline.
+func (c config) importBatchSize() int {
+	if c.ImportBatchSize > 0 {
+		return c.ImportBatchSize
+	}
+	return defaultImportBatchSize
+}
+
+// pendingFile is a small file queued for the next pipeline.
+type pendingFile struct {
+	path string // in the filesystem
+	data []byte // as stored, so sealed when encrypting
+	info os.FileInfo
+}
+
+type importBatch struct {
+	rdb   *redis.Client
+	fsKey string
+	size  int
+	owner ownershipMode
+
+	files     []pendingFile
+	bytes     int
+	rootReady bool
+}
+
+// newImportBatch returns nil, writing every file through the client, when
+// size is 1 or less.
+func newImportBatch(rdb *redis.Client, fsKey string, size int, owner ownershipMode) *importBatch {
+	if size <= 1 {
+		return nil
+	}
+	return &importBatch{rdb: rdb, fsKey: fsKey, size: size, owner: owner}
+}
+
+// add queues a file and reports whether the batch is full.
+func (b *importBatch) add(f pendingFile) bool {
+	b.files = append(b.files, f)
+	b.bytes += len(f.data)
+	return len(b.files) >= b.size || b.bytes >= importBatchBytes
+}
+
+// inodeFields is the inode HASH the native backend would hold for f after
+// Echo and applyMetadata.
+func (b *importBatch) inodeFields(f pendingFile, now int64) map[string]interface{} {
+	fields := map[string]interface{}{
+		"type":     "file",
+		"mode":     uint32(f.info.Mode().Perm()),
+		"uid":      uint32(0),
+		"gid":      uint32(0),
+		"size":     len(f.data),
+		"ctime_ms": now,
+		"mtime_ms": now,
+		"atime_ms": now,
+		"content":  f.data,
+	}
+	if st, ok := f.info.Sys().(*syscall.Stat_t); ok {
+		fields["uid"], fields["gid"] = st.Uid, st.Gid
+		aSec, aNsec := statAtime(st)
+		mSec, mNsec := statMtime(st)
+		fields["atime_ms"] = aSec*1000 + aNsec/1_000_000
+		fields["mtime_ms"] = mSec*1000 + mNsec/1_000_000
+	}
+	if b.owner.mapOwner {
+		fields["uid"], fields["gid"] = b.owner.uid, b.owner.gid
+	}
+	return fields
+}
+
+// queueFile adds f's inode and directory entry to pipe.
+func (b *importBatch) queueFile(ctx context.Context, pipe redis.Pipeliner, f pendingFile, now int64) []redis.Cmder {
+	return []redis.Cmder{
+		pipe.HSet(ctx, inodeKeyPrefix(b.fsKey)+f.path, b.inodeFields(f, now)),
+		pipe.SAdd(ctx, childrenKeyPrefix(b.fsKey)+path.Dir(f.path), path.Base(f.path)),
+	}
+}
+
+// flush writes the queued files. A file whose commands failed is retried
+// once on its own, and if that fails too the error names it. Both writes
+// are idempotent, so a retry cannot leave a file half-written or counted
+// twice: the counters only take files once they are fully written.
+func (b *importBatch) flush(ctx context.Context, fsClient client.Client, stats *importStats) error {
+	if len(b.files) == 0 {
+		return nil
+	}
+	if !b.rootReady {
+		if err := fsClient.Mkdir(ctx, "/"); err != nil {
+			return fmt.Errorf("mkdir /: %w", err)
+		}
+		b.rootReady = true
+	}
+
+	now := time.Now().UnixMilli()
+	pipe := b.rdb.Pipeline()
+	cmds := make([][]redis.Cmder, len(b.files))
+	for i, f := range b.files {
+		cmds[i] = b.queueFile(ctx, pipe, f, now)
+	}
+	// Exec reports only the first failure; each file's own commands say
+	// whether it was written.
+	_, _ = pipe.Exec(ctx)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var written, dataBytes int64
+	var failed error
+	for i, f := range b.files {
+		if firstErr(cmds[i]) != nil {
+			retry := b.rdb.Pipeline()
+			again := b.queueFile(ctx, retry, f, now)
+			_, _ = retry.Exec(ctx)
+			if err := firstErr(again); err != nil {
+				failed = fmt.Errorf("import %s: %w", f.path, err)
+				break
+			}
+		}
+		written++
+		dataBytes += int64(len(f.data))
+	}
+
+	// The files written are counted even when a later one failed.
+	if written > 0 {
+		pipe = b.rdb.Pipeline()
+		pipe.HIncrBy(ctx, infoKey(b.fsKey), "files", written)
+		pipe.HIncrBy(ctx, infoKey(b.fsKey), "total_data_bytes", dataBytes)
+		if _, err := pipe.Exec(ctx); err != nil && failed == nil {
+			failed = fmt.Errorf("update counters: %w", err)
+		}
+	}
+	stats.Files += int(written)
+	stats.Bytes += dataBytes
+	b.files, b.bytes = b.files[:0], 0
+	return failed
+}
+
+// firstErr is the first error among cmds.
+func firstErr(cmds []redis.Cmder) error {
+	for _, c := range cmds {
+		if err := c.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
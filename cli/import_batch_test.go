@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis-fs/mount/client"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestImportBatchMatchesUnbatched(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	root := writeFixtureTree(t)
+
+	plainKey, batchedKey := testKey(t, rdb), testKey(t, rdb)
+	if _, err := importDirectory(ctx, client.New(rdb, plainKey), root, importOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	batched := client.New(rdb, batchedKey)
+	// Two files per batch, so the fixture takes several flushes.
+	opts := importOptions{batch: newImportBatch(rdb, batchedKey, 2, ownershipMode{})}
+	stats, err := importDirectory(ctx, batched, root, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 4 || stats.Dirs != 4 || stats.Symlinks != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+	assertTreeMatches(t, ctx, batched, root)
+
+	wantInfo, _ := client.New(rdb, plainKey).Info(ctx)
+	gotInfo, err := batched.Info(ctx)
+	if err != nil || *gotInfo != *wantInfo {
+		t.Fatalf("info %+v (%v), want %+v", gotInfo, err, wantInfo)
+	}
+	for _, p := range []string{"/README.md", "/src/main.go", "/src/run.sh", "/src/deep/er/blob.bin"} {
+		want, _ := rdb.HGetAll(ctx, inodeKeyPrefix(plainKey)+p).Result()
+		got, _ := rdb.HGetAll(ctx, inodeKeyPrefix(batchedKey)+p).Result()
+		// Reading the fixture in the first import moved its atimes.
+		for _, f := range []string{"ctime_ms", "atime_ms"} {
+			delete(want, f)
+			delete(got, f)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: inode %v, want %v", p, got, want)
+		}
+	}
+	for _, dir := range []string{"/", "/src", "/src/deep/er"} {
+		want, _ := client.New(rdb, plainKey).Ls(ctx, dir)
+		got, _ := batched.Ls(ctx, dir)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: entries %v, want %v", dir, got, want)
+		}
+	}
+}
+
+// failingHook fails every HSET of key, up to times (forever when
+// negative), after Redis has run it.
+type failingHook struct {
+	key   string
+	times int
+}
+
+func (h *failingHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *failingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		h.fail(cmd)
+		return err
+	}
+}
+
+func (h *failingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			h.fail(cmd)
+		}
+		return err
+	}
+}
+
+func (h *failingHook) fail(cmd redis.Cmder) {
+	if h.times == 0 || cmd.Name() != "hset" || fmt.Sprint(cmd.Args()[1]) != h.key {
+		return
+	}
+	h.times--
+	cmd.SetErr(errors.New("OOM command not allowed"))
+}
+
+func TestImportBatchAttributesFailures(t *testing.T) {
+	ctx := context.Background()
+	root := writeFixtureTree(t)
+
+	for _, tc := range []struct {
+		times   int
+		wantErr bool
+	}{{1, false}, {-1, true}} {
+		rdb := testRedis(t)
+		key := testKey(t, rdb)
+		rdb.AddHook(&failingHook{key: inodeKeyPrefix(key) + "/src/main.go", times: tc.times})
+		fsClient := client.New(rdb, key)
+
+		stats, err := importDirectory(ctx, fsClient, root, importOptions{batch: newImportBatch(rdb, key, 8, ownershipMode{})}, nil)
+		if !tc.wantErr {
+			// A transient failure is retried.
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertTreeMatches(t, ctx, fsClient, root)
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "import /src/main.go") {
+			t.Fatalf("err = %v, want one naming /src/main.go", err)
+		}
+		// The files written before it are counted; those after it are not
+		// written at all.
+		info, _ := fsClient.Info(ctx)
+		if info.Files != int64(stats.Files) || stats.Files == 0 || stats.Files == 4 {
+			t.Fatalf("stats %+v, info %+v", stats, info)
+		}
+	}
+}
+
+// latencyHook delays every round trip, as a Redis across a network would.
+type latencyHook time.Duration
+
+func (h latencyHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h latencyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		time.Sleep(time.Duration(h))
+		return next(ctx, cmd)
+	}
+}
+
+func (h latencyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		time.Sleep(time.Duration(h))
+		return next(ctx, cmds)
+	}
+}
+
+// BenchmarkImportSmallFiles imports 200 files of 1KB over a link with
+// 200µs of latency, one file at a time and batched.
+func BenchmarkImportSmallFiles(b *testing.B) {
+	root := b.TempDir()
+	for i := 0; i < 200; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("d%02d", i%20))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%03d.txt", i)), make([]byte, 1024), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(b).Addr()})
+	b.Cleanup(func() { rdb.Close() })
+	rdb.AddHook(latencyHook(200 * time.Microsecond))
+
+	for _, size := range []int{1, defaultImportBatchSize} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			ctx := context.Background()
+			for i := 0; i < b.N; i++ {
+				key := fmt.Sprintf("bench-%d-%d", size, i)
+				opts := importOptions{batch: newImportBatch(rdb, key, size, ownershipMode{})}
+				if _, err := importDirectory(ctx, client.New(rdb, key), root, opts, nil); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				_ = deleteNamespace(ctx, rdb, key)
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+)
+
+// ---------------------------------------------------------------------------
+// Chunked import of large files
+// ---------------------------------------------------------------------------
+//
+// A file read whole and sent in one command costs its size in memory and
+// can exceed what Redis accepts in a single request. Files larger than the
+// chunk size are instead read through a fixed buffer and written chunk by
+// chunk: the first replaces the file, each one after it is appended. A
+// failure part way removes the partial file, so an import never leaves a
+// truncated copy looking like a finished one.
+//
+// Encrypted files are sealed whole, since each carries one nonce and tag,
+// and so are still read and written in one piece.
+
+// defaultImportChunkSize is the chunk size unless --chunk-size says
+// otherwise.
+const defaultImportChunkSize = 8 << 20
+
+// chunkSize is the configured chunk size.
+func (o importOptions) chunkSize() int64 {
+	if o.chunk > 0 {
+		return o.chunk
+	}
+	return defaultImportChunkSize
+}
+
+// writeChunked streams the local file at local to p in chunks of size,
+// calling onChunk with the bytes of each chunk once it is written.
+func writeChunked(ctx context.Context, fsClient client.Client, local, p string, size int64, onChunk func(n int64)) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, size)
+	for first := true; ; first = false {
+		n, rerr := io.ReadFull(f, buf)
+		if rerr == io.EOF && !first {
+			return nil
+		}
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return discardPartial(ctx, fsClient, p, rerr)
+		}
+		write, verb := fsClient.EchoAppend, "append"
+		if first {
+			write, verb = fsClient.Echo, "echo"
+		}
+		if err := write(ctx, p, buf[:n]); err != nil {
+			return discardPartial(ctx, fsClient, p, fmt.Errorf("%s %s: %w", verb, p, err))
+		}
+		if onChunk != nil {
+			onChunk(int64(n))
+		}
+		if rerr != nil {
+			return nil
+		}
+	}
+}
+
+// discardPartial removes the partly written file at p and returns err,
+// noting when the removal failed too. It runs even after ctx is cancelled,
+// since an interrupt is the likeliest reason to get here.
+func discardPartial(ctx context.Context, fsClient client.Client, p string, err error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if st, serr := fsClient.Stat(ctx, p); serr == nil && st == nil {
+		return err
+	}
+	if rmErr := fsClient.Rm(ctx, p); rmErr != nil {
+		return errors.Join(err, fmt.Errorf("remove partial %s: %w", p, rmErr))
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/redis-fs/mount/client"
+)
+
+func TestImportChunkedMatchesWhole(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	root := t.TempDir()
+	big := make([]byte, 10_000)
+	rand.New(rand.NewSource(1)).Read(big)
+	if err := os.WriteFile(filepath.Join(root, "big.bin"), big, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "small.txt"), []byte("hi\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fsClient := client.New(rdb, testKey(t, rdb))
+	var updates int
+	var last importStats
+	stats, err := importDirectory(ctx, fsClient, root, importOptions{chunk: 4096}, func(s importStats) {
+		updates++
+		last = s
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 2 || stats.Bytes != int64(len(big))+3 || last.Bytes != stats.Bytes {
+		t.Fatalf("stats %+v, last progress %+v", stats, last)
+	}
+	// Three chunks of big.bin, then its metadata, then small.txt.
+	if updates != 5 {
+		t.Errorf("progress reported %d times", updates)
+	}
+	got, err := fsClient.Cat(ctx, "/big.bin")
+	if err != nil || !bytes.Equal(got, big) {
+		t.Fatalf("big.bin: %d bytes, %v", len(got), err)
+	}
+	if st, _ := fsClient.Stat(ctx, "/big.bin"); st == nil || st.Size != int64(len(big)) || os.FileMode(st.Mode).Perm() != 0o640 {
+		t.Errorf("big.bin stat %+v", st)
+	}
+}
+
+// appendFailer fails every append after the first few.
+type appendFailer struct {
+	client.Client
+	left int
+}
+
+func (a *appendFailer) EchoAppend(ctx context.Context, p string, data []byte) error {
+	if a.left == 0 {
+		return errors.New("connection reset")
+	}
+	a.left--
+	return a.Client.EchoAppend(ctx, p, data)
+}
+
+func TestImportChunkedRemovesPartialFile(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "big.bin"), bytes.Repeat([]byte("x"), 5000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fsClient := &appendFailer{Client: client.New(rdb, testKey(t, rdb)), left: 1}
+	_, err := importDirectory(ctx, fsClient, root, importOptions{chunk: 1000}, nil)
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("import: %v", err)
+	}
+	if st, err := fsClient.Stat(ctx, "/big.bin"); err != nil || st != nil {
+		t.Fatalf("partial file left behind: %+v, %v", st, err)
+	}
+}
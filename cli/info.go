@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// info — inspect a filesystem key without mounting it
+// ---------------------------------------------------------------------------
+
+// Origin fields in the info hash, written on the first import into a key.
+// Keys created by other tools or older versions lack them.
+const (
+	originCreatedField = "created_at"
+	originHostField    = "source_host"
+	originPathField    = "source_path"
+)
+
+const defaultInfoTop = 5
+
+type keyFileSize struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+type keyInfo struct {
+	Key          string         `json:"key"`
+	CreatedAt    *time.Time     `json:"created_at,omitempty"`
+	SourceHost   string         `json:"source_host,omitempty"`
+	SourcePath   string         `json:"source_path,omitempty"`
+	Files        int64          `json:"files"`
+	Dirs         int64          `json:"dirs"` // excluding the root
+	Symlinks     int64          `json:"symlinks"`
+	LogicalBytes int64          `json:"logical_bytes"`
+	MemoryBytes  *int64         `json:"memory_bytes,omitempty"` // nil when MEMORY USAGE is refused
+	Keys         int64          `json:"redis_keys"`
+	Largest      []keyFileSize  `json:"largest_files"`
+	ModuleKey    int64          `json:"module_version,omitempty"`
+	ModuleLoaded int64          `json:"module_loaded,omitempty"`
+	Ownership    string         `json:"import_ownership,omitempty"`
+	Encryption   *keyEncryption `json:"encryption,omitempty"`
+	MountedHere  string         `json:"mounted_here,omitempty"` // local mountpoint, if this machine has it mounted
+
+	// CountersStale is set when the info hash counters disagree with
+	// the inodes actually stored.
+	CountersStale bool `json:"counters_stale,omitempty"`
+}
+
+// recordImportOrigin stamps the key with when and from where it was first
+// imported. Existing values are kept, so a merge import does not
+// overwrite the original origin.
+func recordImportOrigin(ctx context.Context, rdb *redis.Client, fsKey, sourceDir string) error {
+	host, _ := os.Hostname()
+	pipe := rdb.Pipeline()
+	pipe.HSetNX(ctx, infoKey(fsKey), originCreatedField, time.Now().UnixMilli())
+	if host != "" {
+		pipe.HSetNX(ctx, infoKey(fsKey), originHostField, host)
+	}
+	pipe.HSetNX(ctx, infoKey(fsKey), originPathField, sourceDir)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// collectKeyInfo summarizes a filesystem key using only reads. It walks
+// the key's inodes with SCAN, so the counts hold even when the info hash
+// is missing or stale.
+func collectKeyInfo(ctx context.Context, rdb *redis.Client, fsKey string, top int) (keyInfo, error) {
+	info := keyInfo{Key: fsKey}
+	fields, err := rdb.HGetAll(ctx, infoKey(fsKey)).Result()
+	if err != nil {
+		return info, err
+	}
+	if ms, err := strconv.ParseInt(fields[originCreatedField], 10, 64); err == nil && ms > 0 {
+		t := time.UnixMilli(ms).UTC()
+		info.CreatedAt = &t
+	}
+	info.SourceHost = fields[originHostField]
+	info.SourcePath = fields[originPathField]
+	info.Ownership = fields[importOwnershipField]
+	if scheme := fields[encryptionField]; scheme != "" {
+		info.Encryption = &keyEncryption{Scheme: scheme, Fingerprint: fields[encryptionFingerprintField]}
+	}
+
+	versions, err := readModuleVersions(ctx, rdb, fsKey)
+	if err != nil {
+		return info, err
+	}
+	info.ModuleKey, info.ModuleLoaded = versions.Key, versions.Loaded
+
+	var files []keyFileSize
+	memoryOK := true
+	var memory int64
+	prefix := inodeKeyPrefix(fsKey)
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, fsNamespacePattern(fsKey), 500).Result()
+		if err != nil {
+			return info, err
+		}
+		info.Keys += int64(len(keys))
+
+		pipe := rdb.Pipeline()
+		attrs := make(map[string]*redis.SliceCmd)
+		usage := make([]*redis.IntCmd, 0, len(keys))
+		for _, k := range keys {
+			if strings.HasPrefix(k, prefix) {
+				attrs[k] = pipe.HMGet(ctx, k, "type", "size")
+			}
+			if memoryOK {
+				usage = append(usage, pipe.MemoryUsage(ctx, k))
+			}
+		}
+		_, _ = pipe.Exec(ctx)
+
+		for k, cmd := range attrs {
+			vals, err := cmd.Result()
+			if err != nil {
+				return info, err
+			}
+			typ, _ := vals[0].(string)
+			sizeStr, _ := vals[1].(string)
+			size, _ := strconv.ParseInt(sizeStr, 10, 64)
+			switch typ {
+			case "file":
+				info.Files++
+				info.LogicalBytes += size
+				files = append(files, keyFileSize{Path: strings.TrimPrefix(k, prefix), Bytes: size})
+			case "dir":
+				if k != prefix+"/" {
+					info.Dirs++
+				}
+			case "symlink":
+				info.Symlinks++
+			}
+		}
+		for _, cmd := range usage {
+			n, err := cmd.Result()
+			if err != nil && err != redis.Nil {
+				// ACLs or managed Redis may refuse MEMORY USAGE.
+				memoryOK = false
+				break
+			}
+			memory += n
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	if memoryOK {
+		info.MemoryBytes = &memory
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Bytes != files[j].Bytes {
+			return files[i].Bytes > files[j].Bytes
+		}
+		return files[i].Path < files[j].Path
+	})
+	if len(files) > top {
+		files = files[:top]
+	}
+	info.Largest = files
+
+	counters, err := client.New(rdb, fsKey).Info(ctx)
+	if err != nil {
+		return info, err
+	}
+	// The directory counter includes the root, which Dirs leaves out.
+	info.CountersStale = counters.Files != info.Files || counters.Directories != info.Dirs+1 || counters.Symlinks != info.Symlinks
+	return info, nil
+}
+
+func cmdInfo(args []string) error {
+	usage := fmt.Sprintf("Usage: %s info [key] [--json] [--top n]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("info")
+	jsonOut := fs.Bool("json", false, "print the summary as JSON")
+	top := fs.Int("top", defaultInfoTop, "number of largest files to list")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 1 {
+		return fmt.Errorf("unexpected arguments %v\n\n%s", pos[1:], usage)
+	}
+	if *top < 0 {
+		return errors.New("--top must not be negative")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return err
+	}
+	fsKey := cfg.RedisKey
+	if len(pos) == 1 {
+		fsKey = pos[0]
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	rdb := newRedisClient(cfg, 4)
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("cannot connect to Redis at %s: %w", cfg.RedisAddr, err)
+	}
+	if st, err := client.New(rdb, fsKey).Stat(ctx, "/"); err != nil {
+		return err
+	} else if st == nil {
+		return fmt.Errorf("no filesystem found at key %q on %s (db %d)", fsKey, cfg.RedisAddr, cfg.RedisDB)
+	}
+
+	info, err := collectKeyInfo(ctx, rdb, fsKey, *top)
+	if err != nil {
+		return err
+	}
+	sts, err := loadState()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if st, ok := sts.forKey(cfg, fsKey); ok {
+		if backend, _, err := backendForState(st); err == nil && backend.IsMounted(st.Mountpoint) {
+			info.MountedHere = st.Mountpoint
+		}
+	}
+
+	if *jsonOut {
+		b, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	printKeyInfo(info, cfg)
+	return nil
+}
+
+func printKeyInfo(info keyInfo, cfg config) {
+	unknown := clr(ansiDim, "unknown")
+	rows := []boxRow{
+		{Label: "redis", Value: fmt.Sprintf("%s (db %d)", cfg.RedisAddr, cfg.RedisDB)},
+	}
+	if info.CreatedAt != nil {
+		rows = append(rows, boxRow{Label: "created", Value: fmt.Sprintf("%s %s", info.CreatedAt.Local().Format("2006-01-02 15:04"),
+			clr(ansiDim, "("+formatDuration(time.Since(*info.CreatedAt))+" ago)"))})
+	} else {
+		rows = append(rows, boxRow{Label: "created", Value: unknown})
+	}
+	source := unknown
+	switch {
+	case info.SourceHost != "" && info.SourcePath != "":
+		source = info.SourceHost + ":" + info.SourcePath
+	case info.SourceHost != "":
+		source = info.SourceHost
+	case info.SourcePath != "":
+		source = info.SourcePath
+	}
+	rows = append(rows,
+		boxRow{Label: "source", Value: source},
+		boxRow{Label: "entries", Value: fmt.Sprintf("%d files, %d dirs, %d symlinks", info.Files, info.Dirs, info.Symlinks)},
+		boxRow{Label: "size", Value: formatBytes(info.LogicalBytes)},
+	)
+	if info.MemoryBytes != nil {
+		rows = append(rows, boxRow{Label: "memory", Value: fmt.Sprintf("%s in %d keys", formatBytes(*info.MemoryBytes), info.Keys)})
+	} else {
+		rows = append(rows, boxRow{Label: "memory", Value: fmt.Sprintf("%s %s", unknown, clr(ansiDim, "(MEMORY USAGE refused)"))})
+	}
+	module := formatModuleVersion(info.ModuleKey)
+	if info.ModuleKey == 0 {
+		module = unknown
+	}
+	if info.ModuleLoaded > 0 && info.ModuleLoaded != info.ModuleKey {
+		module += clr(ansiDim, " (server has "+formatModuleVersion(info.ModuleLoaded)+")")
+	}
+	rows = append(rows, boxRow{Label: "data version", Value: module})
+	if info.Ownership != "" {
+		rows = append(rows, boxRow{Label: "ownership", Value: info.Ownership})
+	}
+	if info.Encryption != nil {
+		rows = append(rows, boxRow{Label: "encryption", Value: info.Encryption.Scheme + clr(ansiDim, " (key "+info.Encryption.Fingerprint+")")})
+	}
+	if info.MountedHere != "" {
+		rows = append(rows, boxRow{Label: "mounted", Value: clr(ansiGreen, "here") + " at " + info.MountedHere})
+	} else {
+		rows = append(rows, boxRow{Label: "mounted", Value: clr(ansiDim, "not on this machine")})
+	}
+	if info.CountersStale {
+		rows = append(rows, boxRow{Label: "counters", Value: clr(ansiYellow, "info hash counters disagree with stored inodes")})
+	}
+	for i, f := range info.Largest {
+		label := ""
+		if i == 0 {
+			label = "largest"
+		}
+		rows = append(rows, boxRow{Label: label, Value: fmt.Sprintf("%s %s", formatBytes(f.Bytes), clr(ansiDim, f.Path))})
+	}
+	printBox(clr(ansiBold, "Filesystem "+info.Key), rows)
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis-fs/mount/client"
+	"github.com/redis/go-redis/v9"
+)
+
+// Integration tests run against an in-memory miniredis by default. Set
+// RFS_TEST_REDIS_ADDR (host:port) to run the same tests against a real
+// Redis server; each test uses its own key and deletes it afterwards.
+
+func testRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	addr := os.Getenv("RFS_TEST_REDIS_ADDR")
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { rdb.Close() })
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("connect to test Redis at %s: %v", addr, err)
+	}
+	return rdb
+}
+
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+func testKey(t *testing.T, rdb *redis.Client) string {
+	t.Helper()
+	key := "rfs-test-" + unsafeKeyChars.ReplaceAllString(t.Name(), "_") + "-" + randomHex(3)
+	t.Cleanup(func() { _ = deleteNamespace(context.Background(), rdb, key) })
+	return key
+}
+
+var fixtureTime = time.Date(2023, 4, 5, 6, 7, 8, 123_000_000, time.UTC)
+
+// writeFixtureTree creates a small tree exercising every entry type and a
+// spread of permission bits.
+func writeFixtureTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(os.MkdirAll(filepath.Join(root, "src", "deep", "er"), 0o755))
+	must(os.Mkdir(filepath.Join(root, "empty"), 0o700))
+	must(os.WriteFile(filepath.Join(root, "README.md"), []byte("# hello\n"), 0o644))
+	must(os.WriteFile(filepath.Join(root, "src", "main.go"), []byte("package main\n"), 0o600))
+	must(os.WriteFile(filepath.Join(root, "src", "deep", "er", "blob.bin"), []byte{0, 1, 2, 0xff, '\n'}, 0o640))
+	must(os.WriteFile(filepath.Join(root, "src", "run.sh"), []byte("#!/bin/sh\n"), 0o755))
+	must(os.Chmod(filepath.Join(root, "src", "deep"), 0o750))
+	must(os.Symlink("src/main.go", filepath.Join(root, "link")))
+
+	// Fix timestamps deepest-first so directory mtimes are not disturbed.
+	var paths []string
+	filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if p != root && d.Type()&os.ModeSymlink == 0 {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	for i := len(paths) - 1; i >= 0; i-- {
+		must(os.Chtimes(paths[i], fixtureTime, fixtureTime))
+	}
+	return root
+}
+
+// assertTreeMatches walks a local tree and checks each entry against the
+// filesystem stored under fsClient.
+func assertTreeMatches(t *testing.T, ctx context.Context, fsClient client.Client, root string) {
+	t.Helper()
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		rp := "/" + filepath.ToSlash(rel)
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		st, err := fsClient.Stat(ctx, rp)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			t.Errorf("%s: missing from Redis", rp)
+			return nil
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			want, _ := os.Readlink(p)
+			got, err := fsClient.Readlink(ctx, rp)
+			if st.Type != "symlink" || err != nil || got != want {
+				t.Errorf("%s: symlink %q (%v), type %s; want %q", rp, got, err, st.Type, want)
+			}
+			return nil
+		case info.IsDir():
+			if st.Type != "dir" {
+				t.Errorf("%s: type %s, want dir", rp, st.Type)
+			}
+		default:
+			want, _ := os.ReadFile(p)
+			got, err := fsClient.Cat(ctx, rp)
+			if st.Type != "file" || err != nil || !bytes.Equal(got, want) || st.Size != int64(len(want)) {
+				t.Errorf("%s: content %q size %d (%v), want %q", rp, got, st.Size, err, want)
+			}
+		}
+		if perm := os.FileMode(st.Mode).Perm(); perm != info.Mode().Perm() {
+			t.Errorf("%s: mode %04o, want %04o", rp, perm, info.Mode().Perm())
+		}
+		if st.Mtime != fixtureTime.UnixMilli() {
+			t.Errorf("%s: mtime %d, want %d", rp, st.Mtime, fixtureTime.UnixMilli())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIntegrationImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	fsClient := client.New(rdb, testKey(t, rdb))
+	root := writeFixtureTree(t)
+
+	stats, err := importDirectory(ctx, fsClient, root, importOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 4 || stats.Dirs != 4 || stats.EmptyDirs != 1 || stats.Symlinks != 1 || stats.Conflicts != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+	assertTreeMatches(t, ctx, fsClient, root)
+
+	info, err := fsClient.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Files != 4 || info.Symlinks != 1 {
+		t.Fatalf("info %+v", info)
+	}
+}
+
+func TestIntegrationImportEmptyDirs(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	fsClient := client.New(rdb, testKey(t, rdb))
+	root := t.TempDir()
+	for _, dir := range []string{"a/b/c", "a/keep", "solo"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "keep", "f"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := importDirectory(ctx, fsClient, root, importOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a/b/c and solo are empty; a and a/b only hold directories.
+	if stats.Dirs != 5 || stats.EmptyDirs != 2 {
+		t.Fatalf("stats %+v", stats)
+	}
+	for _, p := range []string{"/a/b/c", "/solo"} {
+		st, err := fsClient.Stat(ctx, p)
+		if err != nil || st == nil || st.Type != "dir" {
+			t.Errorf("%s: stat %+v, %v; want an empty dir", p, st, err)
+		}
+		if names, err := fsClient.Ls(ctx, p); err != nil || len(names) != 0 {
+			t.Errorf("%s: entries %v, %v", p, names, err)
+		}
+	}
+}
+
+func TestIntegrationImportPruneEmpty(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	root := t.TempDir()
+	for _, dir := range []string{"logs/old", "src", "bare"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"logs/a.log", "logs/old/b.log", "src/main.go"} {
+		if err := os.WriteFile(filepath.Join(root, f), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exclude, err := newExcludeMatcher([]string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without --prune-empty, logs/old is kept, empty, and counted with
+	// bare; logs still holds it.
+	kept := client.New(rdb, testKey(t, rdb))
+	stats, err := importDirectory(ctx, kept, root, importOptions{exclude: exclude}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Dirs != 4 || stats.EmptyDirs != 2 || stats.Pruned != 0 {
+		t.Fatalf("kept: stats %+v", stats)
+	}
+	for _, p := range []string{"/logs/old", "/bare"} {
+		if names, err := kept.Ls(ctx, p); err != nil || len(names) != 0 {
+			t.Errorf("kept %s: entries %v, %v; want an empty dir", p, names, err)
+		}
+	}
+	if r, err := verifyImport(ctx, root, kept, verifyOptions{exclude: exclude}); err != nil || len(r.Mismatches) != 0 {
+		t.Fatalf("verify kept: %+v, %v", r.Mismatches, err)
+	}
+
+	pruned := client.New(rdb, testKey(t, rdb))
+	stats, err = importDirectory(ctx, pruned, root, importOptions{exclude: exclude, pruneEmpty: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Dirs != 2 || stats.EmptyDirs != 1 || stats.Pruned != 1 || len(stats.prunedPaths) != 1 || stats.prunedPaths[0] != "/logs" {
+		t.Fatalf("pruned: stats %+v", stats)
+	}
+	if st, err := pruned.Stat(ctx, "/logs"); err != nil || st != nil {
+		t.Errorf("pruned /logs: stat %+v, %v; want it left out", st, err)
+	}
+	if st, err := pruned.Stat(ctx, "/bare"); err != nil || st == nil {
+		t.Errorf("pruned /bare: stat %+v, %v; an empty source dir stays", st, err)
+	}
+	if r, err := verifyImport(ctx, root, pruned, verifyOptions{exclude: exclude, pruneEmpty: true}); err != nil || len(r.Mismatches) != 0 {
+		t.Fatalf("verify pruned: %+v, %v", r.Mismatches, err)
+	}
+	if r, err := verifyImport(ctx, root, pruned, verifyOptions{exclude: exclude}); err != nil || len(r.Mismatches) != 1 {
+		t.Fatalf("verify pruned without --prune-empty: %+v, %v", r.Mismatches, err)
+	}
+}
+
+func TestIntegrationImportMergeConflicts(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	fsClient := client.New(rdb, testKey(t, rdb))
+	root := writeFixtureTree(t)
+	if _, err := importDirectory(ctx, fsClient, root, importOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	readme := filepath.Join(root, "README.md")
+	if err := os.WriteFile(readme, []byte("# changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "src", "new.txt"), []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := importDirectory(ctx, fsClient, root, importOptions{merge: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 1 || stats.Conflicts != 5 {
+		t.Fatalf("merge stats %+v", stats)
+	}
+	if len(stats.conflictPaths) != stats.Conflicts {
+		t.Fatalf("recorded %d conflict paths for %d conflicts", len(stats.conflictPaths), stats.Conflicts)
+	}
+	if got, _ := fsClient.Cat(ctx, "/README.md"); string(got) != "# hello\n" {
+		t.Fatalf("merge without clobber overwrote README: %q", got)
+	}
+
+	stats, err = importDirectory(ctx, fsClient, root, importOptions{merge: true, clobber: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Conflicts != 0 {
+		t.Fatalf("clobber stats %+v", stats)
+	}
+	if got, _ := fsClient.Cat(ctx, "/README.md"); string(got) != "# changed\n" {
+		t.Fatalf("clobber did not overwrite README: %q", got)
+	}
+}
+
+// chownRejecter refuses every chown, as a module enforcing ownership would
+// for a non-root caller.
+type chownRejecter struct{ client.Client }
+
+func (chownRejecter) Chown(context.Context, string, uint32, uint32) error {
+	return errors.New("permission denied")
+}
+
+func TestIntegrationImportOwnership(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	root := writeFixtureTree(t)
+
+	mappedKey := testKey(t, rdb)
+	mapped := importOwnership(4242, 4343, false)
+	fsClient := client.New(rdb, mappedKey)
+	if _, err := importDirectory(ctx, fsClient, root, importOptions{ownership: mapped}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/README.md", "/src/main.go", "/empty"} {
+		st, err := fsClient.Stat(ctx, p)
+		if err != nil || st == nil {
+			t.Fatalf("stat %s: %v", p, err)
+		}
+		if st.UID != 4242 || st.GID != 4343 {
+			t.Errorf("%s owned by %d:%d, want 4242:4343", p, st.UID, st.GID)
+		}
+	}
+	if err := recordImportOwnership(ctx, rdb, mappedKey, mapped); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := rdb.HGet(ctx, infoKey(mappedKey), importOwnershipField).Result(); got != ownershipMapped {
+		t.Errorf("recorded ownership = %q, want %q", got, ownershipMapped)
+	}
+
+	// Preserving owners through a client that rejects chown keeps going and
+	// counts the failures.
+	stats, err := importDirectory(ctx, chownRejecter{client.New(rdb, testKey(t, rdb))}, root, importOptions{}, nil)
+	if err != nil {
+		t.Fatalf("import aborted on chown failure: %v", err)
+	}
+	if want := stats.Files + stats.Dirs + stats.Symlinks; stats.OwnerFailures != want {
+		t.Errorf("owner failures = %d, want %d", stats.OwnerFailures, want)
+	}
+}
+
+func TestImportOwnershipMode(t *testing.T) {
+	if m := importOwnership(0, 0, false); m.mapOwner {
+		t.Error("root import maps ownership")
+	}
+	if m := importOwnership(1000, 100, true); m.mapOwner {
+		t.Error("--preserve-owner ignored")
+	}
+	if m := importOwnership(1000, 100, false); !m.mapOwner || m.uid != 1000 || m.gid != 100 {
+		t.Errorf("non-root import = %+v", m)
+	}
+}
+
+func TestIntegrationDeleteNamespaceIsScoped(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	keep, drop := testKey(t, rdb), testKey(t, rdb)
+	root := writeFixtureTree(t)
+	for _, k := range []string{keep, drop} {
+		if _, err := importDirectory(ctx, client.New(rdb, k), root, importOptions{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := deleteNamespace(ctx, rdb, drop); err != nil {
+		t.Fatal(err)
+	}
+	left, err := rdb.Keys(ctx, fsNamespacePattern(drop)).Result()
+	if err != nil || len(left) != 0 {
+		t.Fatalf("keys left under %s: %v (%v)", drop, left, err)
+	}
+	assertTreeMatches(t, ctx, client.New(rdb, keep), root)
+}
+
+func TestIntegrationModuleVersionStamp(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	key := testKey(t, rdb)
+
+	v, err := readModuleVersions(ctx, rdb, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Key != 0 {
+		t.Fatalf("fresh key has version %d", v.Key)
+	}
+	if err := recordKeyModuleVersion(ctx, rdb, key, 7); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = readModuleVersions(ctx, rdb, key); err != nil || v.Key != 7 {
+		t.Fatalf("after stamp: %+v, %v", v, err)
+	}
+	// The stamp shares the info HASH with the mount's counters.
+	if info, err := client.New(rdb, key).Info(ctx); err != nil || info.Files != 0 {
+		t.Fatalf("info after stamp: %+v, %v", info, err)
+	}
+}
+
+func TestIntegrationKeyInfo(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	key := testKey(t, rdb)
+	fsClient := client.New(rdb, key)
+	root := writeFixtureTree(t)
+	if _, err := importDirectory(ctx, fsClient, root, importOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without an origin, as for keys written elsewhere.
+	info, err := collectKeyInfo(ctx, rdb, key, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CreatedAt != nil || info.SourceHost != "" {
+		t.Fatalf("origin without a record: %+v", info)
+	}
+	if info.Files != 4 || info.Dirs != 4 || info.Symlinks != 1 || info.CountersStale {
+		t.Fatalf("counts %+v", info)
+	}
+	if info.LogicalBytes != int64(len("# hello\n")+len("package main\n")+5+len("#!/bin/sh\n")) {
+		t.Fatalf("logical bytes = %d", info.LogicalBytes)
+	}
+	if len(info.Largest) != 2 || info.Largest[0].Path != "/src/main.go" || info.Largest[1].Path != "/src/run.sh" {
+		t.Fatalf("largest %+v", info.Largest)
+	}
+
+	if err := recordImportOrigin(ctx, rdb, key, root); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordImportOrigin(ctx, rdb, key, "/elsewhere"); err != nil {
+		t.Fatal(err)
+	}
+	info, err = collectKeyInfo(ctx, rdb, key, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CreatedAt == nil || info.SourcePath != root {
+		t.Fatalf("origin %+v, want the first import's", info)
+	}
+
+	// Counters drift is reported rather than trusted.
+	if err := rdb.HIncrBy(ctx, infoKey(key), "files", 3).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = collectKeyInfo(ctx, rdb, key, 2); err != nil || !info.CountersStale || info.Files != 4 {
+		t.Fatalf("after drift: %+v, %v", info, err)
+	}
+}
+
+func TestIntegrationExportForce(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	fsClient := client.New(rdb, testKey(t, rdb))
+	root := writeFixtureTree(t)
+	if _, err := importDirectory(ctx, fsClient, root, importOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	if err := os.WriteFile(filepath.Join(out, "README.md"), []byte("stale"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(out, "extra"), []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exportTree(ctx, fsClient, nil, out, exportOptions{}); err == nil {
+		t.Fatal("exported into a non-empty directory without force")
+	}
+
+	var progress int
+	stats, err := exportTree(ctx, fsClient, nil, out, exportOptions{force: true, onProgress: func(exportStats) { progress++ }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 4 || stats.Dirs != 4 || stats.Symlinks != 1 || stats.OwnerFailures != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if progress != stats.Files+stats.Dirs+stats.Symlinks {
+		t.Errorf("progress reported %d times", progress)
+	}
+	if b, _ := os.ReadFile(filepath.Join(out, "extra")); string(b) != "mine" {
+		t.Errorf("untouched file is %q", b)
+	}
+	if err := os.Remove(filepath.Join(out, "extra")); err != nil {
+		t.Fatal(err)
+	}
+	assertTreeMatches(t, ctx, fsClient, out)
+
+	// A directory where the filesystem has a file is not deleted.
+	blocked := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(blocked, "README.md", "keep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exportTree(ctx, fsClient, nil, blocked, exportOptions{force: true}); err == nil {
+		t.Fatal("replaced a directory with a file")
+	}
+	if _, err := os.Stat(filepath.Join(blocked, "README.md", "keep")); err != nil {
+		t.Errorf("directory contents lost: %v", err)
+	}
+}
+
+func TestIntegrationImportExcludes(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	fsClient := client.New(rdb, testKey(t, rdb))
+	root := writeFixtureTree(t)
+	exclude, err := newExcludeMatcher([]string{"deep/", "*.sh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := importDirectory(ctx, fsClient, root, importOptions{exclude: exclude}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// src/deep is pruned whole, so what is inside it is not counted.
+	if stats.Excluded != 2 || stats.Files != 2 || stats.Dirs != 2 {
+		t.Fatalf("stats %+v", stats)
+	}
+	for _, p := range []string{"/src/deep", "/src/deep/er/blob.bin", "/src/run.sh"} {
+		if st, err := fsClient.Stat(ctx, p); err != nil || st != nil {
+			t.Errorf("%s: stat %+v, %v; want it left out", p, st, err)
+		}
+	}
+	if st, err := fsClient.Stat(ctx, "/src/main.go"); err != nil || st == nil {
+		t.Errorf("/src/main.go: stat %+v, %v", st, err)
+	}
+}
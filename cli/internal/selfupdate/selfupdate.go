@@ -0,0 +1,366 @@
+// Package selfupdate finds, verifies and installs new rfs releases.
+//
+// Releases are read from a JSON list in the shape of the GitHub releases
+// API, newest first. Each release carries one binary per platform, named
+// by AssetName, and a SHA256SUMS file in the format sha256sum writes. When
+// a public key is configured, SHA256SUMS must also come with an Ed25519
+// signature in SHA256SUMS.sig, so a compromised download host cannot
+// substitute both a binary and its checksum.
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	ChannelStable  = "stable"
+	ChannelNightly = "nightly"
+
+	// DefaultURL lists the published releases.
+	DefaultURL = "https://api.github.com/repos/rowantrollope/redis-fs/releases"
+
+	ChecksumsAsset = "SHA256SUMS"
+	SignatureAsset = ChecksumsAsset + ".sig"
+
+	maxListBytes   = 8 << 20
+	maxBinaryBytes = 512 << 20
+)
+
+// ErrVerify is wrapped by every checksum and signature failure.
+var ErrVerify = errors.New("verification failed")
+
+// Release is one entry of the releases list.
+type Release struct {
+	Tag        string  `json:"tag_name"`
+	Name       string  `json:"name"`
+	Notes      string  `json:"body"`
+	Draft      bool    `json:"draft"`
+	Prerelease bool    `json:"prerelease"`
+	Assets     []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// Asset finds the release's asset called name.
+func (r *Release) Asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// AssetName is the name of the binary built for a platform.
+func AssetName(goos, goarch string) string {
+	return "rfs_" + goos + "_" + goarch
+}
+
+// Updater talks to a releases URL.
+type Updater struct {
+	HTTP *http.Client // nil uses http.DefaultClient
+	URL  string       // empty uses DefaultURL
+	// PublicKey, when set, must have signed each release's SHA256SUMS.
+	PublicKey ed25519.PublicKey
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key: expected %d bytes of base64", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// Latest returns the newest release on channel: stable takes only full
+// releases, nightly also prereleases. Drafts are never taken.
+func (u *Updater) Latest(ctx context.Context, channel string) (*Release, error) {
+	if channel != ChannelStable && channel != ChannelNightly {
+		return nil, fmt.Errorf("unknown channel %q (expected %s or %s)", channel, ChannelStable, ChannelNightly)
+	}
+	list := u.URL
+	if list == "" {
+		list = DefaultURL
+	}
+	body, err := u.get(ctx, list, maxListBytes)
+	if err != nil {
+		return nil, fmt.Errorf("list releases: %w", err)
+	}
+	var releases []Release
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return nil, fmt.Errorf("list releases: %s is not a releases list: %w", list, err)
+	}
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft || (r.Prerelease && channel == ChannelStable) {
+			continue
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("no %s release found at %s", channel, list)
+}
+
+// Download fetches the asset called name from r and checks it against the
+// release's SHA256SUMS, and that file's signature when u has a key.
+func (u *Updater) Download(ctx context.Context, r *Release, name string) ([]byte, error) {
+	asset, ok := r.Asset(name)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s asset", r.Tag, name)
+	}
+	sumsAsset, ok := r.Asset(ChecksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s: %w", r.Tag, ChecksumsAsset, ErrVerify)
+	}
+	sums, err := u.get(ctx, sumsAsset.URL, maxListBytes)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", ChecksumsAsset, err)
+	}
+	if u.PublicKey != nil {
+		sigAsset, ok := r.Asset(SignatureAsset)
+		if !ok {
+			return nil, fmt.Errorf("release %s is not signed: %w", r.Tag, ErrVerify)
+		}
+		sig, err := u.get(ctx, sigAsset.URL, 4<<10)
+		if err != nil {
+			return nil, fmt.Errorf("download %s: %w", SignatureAsset, err)
+		}
+		if err := verifySignature(u.PublicKey, sums, sig); err != nil {
+			return nil, err
+		}
+	}
+	want, err := checksumFor(sums, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := u.get(ctx, asset.URL, maxBinaryBytes)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", name, err)
+	}
+	if got := sha256.Sum256(data); !bytes.Equal(got[:], want) {
+		return nil, fmt.Errorf("%s: SHA-256 %x does not match %s (%x): %w", name, got, ChecksumsAsset, want, ErrVerify)
+	}
+	return data, nil
+}
+
+// verifySignature accepts a raw or base64 signature of sums.
+func verifySignature(pub ed25519.PublicKey, sums, sig []byte) error {
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil {
+			return fmt.Errorf("%s is neither a raw nor a base64 signature: %w", SignatureAsset, ErrVerify)
+		}
+		sig = decoded
+	}
+	if !ed25519.Verify(pub, sums, sig) {
+		return fmt.Errorf("%s does not match the configured public key: %w", SignatureAsset, ErrVerify)
+	}
+	return nil
+}
+
+// checksumFor finds name's digest in a sha256sum listing.
+func checksumFor(sums []byte, name string) ([]byte, error) {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		digest, file, ok := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		if !ok {
+			continue
+		}
+		// sha256sum marks binary mode with "*".
+		if strings.TrimPrefix(strings.TrimSpace(file), "*") != name {
+			continue
+		}
+		b, err := hex.DecodeString(digest)
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("%s: malformed digest for %s: %w", ChecksumsAsset, name, ErrVerify)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("%s lists no digest for %s: %w", ChecksumsAsset, name, ErrVerify)
+}
+
+// get fetches rawURL, refusing plain http except to this machine and
+// responses over limit bytes.
+func (u *Updater) get(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && isLoopback(parsed.Hostname())) {
+		return nil, fmt.Errorf("refusing to fetch %s: only https URLs are accepted", rawURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/octet-stream")
+	hc := u.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", rawURL, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("%s: response exceeds %d bytes", rawURL, limit)
+	}
+	return b, nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Newer reports whether candidate is a later version than current. Tags
+// of the form v1.2.3[-pre] are compared numerically; any other pair of
+// different tags, such as a dev build or a nightly, counts as newer.
+func Newer(current, candidate string) bool {
+	if current == candidate {
+		return false
+	}
+	a, aok := parseVersion(current)
+	b, bok := parseVersion(candidate)
+	if !aok || !bok {
+		return true
+	}
+	for i := range a.nums {
+		if a.nums[i] != b.nums[i] {
+			return b.nums[i] > a.nums[i]
+		}
+	}
+	// A prerelease comes before its release.
+	switch {
+	case a.pre == b.pre:
+		return false
+	case a.pre == "":
+		return false
+	case b.pre == "":
+		return true
+	}
+	return b.pre > a.pre
+}
+
+type version struct {
+	nums [3]int
+	pre  string
+}
+
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(s, "v")
+	s, v.pre, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.nums[i] = n
+	}
+	return v, true
+}
+
+// Install replaces the executable at exe with binary. The new binary is
+// written next to it and given its mode, then check (if set) is run on
+// it before anything is replaced. The old executable is kept as
+// exe+".old"; if the new one cannot be renamed into place, the old one is
+// put back.
+func Install(exe string, binary []byte, check func(path string) error) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".update-*")
+	if err != nil {
+		return fmt.Errorf("write new binary: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write new binary: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write new binary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write new binary: %w", err)
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if check != nil {
+		if err := check(tmpPath); err != nil {
+			return fmt.Errorf("new binary failed its check: %w", err)
+		}
+	}
+
+	old := exe + ".old"
+	if err := os.Remove(old); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(exe, old); err != nil {
+		return fmt.Errorf("move %s aside: %w", exe, err)
+	}
+	if err := os.Rename(tmpPath, exe); err != nil {
+		if rerr := os.Rename(old, exe); rerr != nil {
+			return fmt.Errorf("install new binary: %w; restoring the old one also failed (%v), it is at %s", err, rerr, old)
+		}
+		return fmt.Errorf("install new binary: %w", err)
+	}
+	return nil
+}
+
+// Excerpt is the first max lines of release notes, followed by "…" when
+// some were left out.
+func Excerpt(notes string, max int) []string {
+	notes = strings.TrimSpace(strings.ReplaceAll(notes, "\r\n", "\n"))
+	if notes == "" {
+		return nil
+	}
+	lines := strings.Split(notes, "\n")
+	if len(lines) > max {
+		lines = append(lines[:max:max], "…")
+	}
+	return lines
+}
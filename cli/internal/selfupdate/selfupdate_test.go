@@ -0,0 +1,214 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeReleases serves a releases list and its assets.
+type fakeReleases struct {
+	srv      *httptest.Server
+	releases []Release
+	files    map[string][]byte // by URL path
+}
+
+func newFakeReleases(t *testing.T) *fakeReleases {
+	f := &fakeReleases{files: map[string][]byte{}}
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/releases" {
+			json.NewEncoder(w).Encode(f.releases)
+			return
+		}
+		b, ok := f.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	}))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeReleases) updater() *Updater {
+	return &Updater{HTTP: f.srv.Client(), URL: f.srv.URL + "/releases"}
+}
+
+// add publishes a release with the given assets, newest first.
+func (f *fakeReleases) add(tag string, prerelease bool, assets map[string][]byte) *Release {
+	r := Release{Tag: tag, Prerelease: prerelease, Notes: "Changes in " + tag}
+	for name, data := range assets {
+		p := "/download/" + tag + "/" + name
+		f.files[p] = data
+		r.Assets = append(r.Assets, Asset{Name: name, URL: f.srv.URL + p, Size: int64(len(data))})
+	}
+	f.releases = append([]Release{r}, f.releases...)
+	return &f.releases[0]
+}
+
+func sums(files map[string][]byte) []byte {
+	var b strings.Builder
+	for name, data := range files {
+		fmt.Fprintf(&b, "%x  %s\n", sha256.Sum256(data), name)
+	}
+	return []byte(b.String())
+}
+
+func TestLatestByChannel(t *testing.T) {
+	f := newFakeReleases(t)
+	f.add("v1.0.0", false, nil)
+	f.add("v1.1.0-rc.1", true, nil)
+	f.releases = append([]Release{{Tag: "v2.0.0", Draft: true}}, f.releases...)
+	u := f.updater()
+
+	for channel, want := range map[string]string{ChannelStable: "v1.0.0", ChannelNightly: "v1.1.0-rc.1"} {
+		r, err := u.Latest(context.Background(), channel)
+		if err != nil || r.Tag != want {
+			t.Errorf("%s: %+v, %v; want %s", channel, r, err, want)
+		}
+	}
+	if _, err := u.Latest(context.Background(), "beta"); err == nil {
+		t.Error("unknown channel accepted")
+	}
+	u.URL = strings.Replace(u.URL, "http://127.0.0.1", "http://example.com", 1)
+	if _, err := u.Latest(context.Background(), ChannelStable); err == nil || !strings.Contains(err.Error(), "only https") {
+		t.Errorf("plain http to another host: %v", err)
+	}
+}
+
+func TestDownloadVerifiesChecksum(t *testing.T) {
+	f := newFakeReleases(t)
+	name := AssetName("linux", "amd64")
+	binary := []byte("#!/bin/sh\necho new\n")
+	good := f.add("v1.0.0", false, map[string][]byte{name: binary, ChecksumsAsset: sums(map[string][]byte{name: binary})})
+	bad := f.add("v1.0.1", false, map[string][]byte{name: []byte("tampered"), ChecksumsAsset: sums(map[string][]byte{name: binary})})
+	unsummed := f.add("v1.0.2", false, map[string][]byte{name: binary})
+	u := f.updater()
+	ctx := context.Background()
+
+	got, err := u.Download(ctx, good, name)
+	if err != nil || string(got) != string(binary) {
+		t.Fatalf("good release: %q, %v", got, err)
+	}
+	for _, r := range []*Release{bad, unsummed} {
+		if _, err := u.Download(ctx, r, name); !errors.Is(err, ErrVerify) {
+			t.Errorf("%s: %v, want a verification failure", r.Tag, err)
+		}
+	}
+	if _, err := u.Download(ctx, good, AssetName("plan9", "arm")); err == nil {
+		t.Error("missing platform asset downloaded")
+	}
+}
+
+func TestDownloadVerifiesSignature(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	f := newFakeReleases(t)
+	name := AssetName("darwin", "arm64")
+	binary := []byte("binary")
+	list := sums(map[string][]byte{name: binary})
+
+	signed := f.add("v1.0.0", false, map[string][]byte{
+		name: binary, ChecksumsAsset: list,
+		SignatureAsset: []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, list))),
+	})
+	wrongKey := f.add("v1.0.1", false, map[string][]byte{
+		name: binary, ChecksumsAsset: list, SignatureAsset: ed25519.Sign(otherPriv, list),
+	})
+	unsigned := f.add("v1.0.2", false, map[string][]byte{name: binary, ChecksumsAsset: list})
+
+	key, err := ParsePublicKey(base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := f.updater()
+	u.PublicKey = key
+	ctx := context.Background()
+	if _, err := u.Download(ctx, signed, name); err != nil {
+		t.Fatalf("signed release: %v", err)
+	}
+	for _, r := range []*Release{wrongKey, unsigned} {
+		if _, err := u.Download(ctx, r, name); !errors.Is(err, ErrVerify) {
+			t.Errorf("%s: %v, want a verification failure", r.Tag, err)
+		}
+	}
+}
+
+func TestNewer(t *testing.T) {
+	for _, tc := range []struct {
+		current, candidate string
+		want               bool
+	}{
+		{"v1.2.3", "v1.2.4", true},
+		{"v1.2.3", "v1.10.0", true},
+		{"v1.2.3", "v1.2.3", false},
+		{"v1.3.0", "v1.2.9", false},
+		{"v1.2.3-rc.1", "v1.2.3", true},
+		{"v1.2.3", "v1.2.3-rc.1", false},
+		{"v1.2.3-rc.1", "v1.2.3-rc.2", true},
+		{"1.2.3", "v1.2.4", true},
+		{"dev", "v0.1.0", true},
+		{"nightly-20261016", "nightly-20261017", true},
+	} {
+		if got := Newer(tc.current, tc.candidate); got != tc.want {
+			t.Errorf("Newer(%q, %q) = %v", tc.current, tc.candidate, got)
+		}
+	}
+}
+
+func TestInstall(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "rfs")
+	if err := os.WriteFile(exe, []byte("old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed check leaves everything as it was.
+	err := Install(exe, []byte("broken"), func(string) error { return errors.New("exit status 1") })
+	if err == nil {
+		t.Fatal("install went ahead after a failed check")
+	}
+	if b, _ := os.ReadFile(exe); string(b) != "old" {
+		t.Fatalf("executable is %q after a failed check", b)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("left behind %v", entries)
+	}
+
+	var checked string
+	if err := Install(exe, []byte("new"), func(p string) error { checked = p; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(checked); len(b) != 0 {
+		t.Errorf("checked file %s still exists", checked)
+	}
+	if b, _ := os.ReadFile(exe); string(b) != "new" {
+		t.Errorf("executable is %q", b)
+	}
+	if b, _ := os.ReadFile(exe + ".old"); string(b) != "old" {
+		t.Errorf("kept %q as the old executable", b)
+	}
+	if info, _ := os.Stat(exe); info.Mode().Perm() != 0o755 {
+		t.Errorf("mode %v", info.Mode())
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	if got := Excerpt("a\r\nb\nc\n", 2); strings.Join(got, "|") != "a|b|…" {
+		t.Errorf("excerpt %q", got)
+	}
+	if got := Excerpt("  \n", 5); got != nil {
+		t.Errorf("blank notes gave %q", got)
+	}
+}
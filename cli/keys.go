@@ -0,0 +1,48 @@
+package main
+
+import "strings"
+
+// Key layout shared with the mount daemon's native backend: every
+// filesystem lives under the "rfs:{<key>}:" hash-tagged namespace.
+
+func fsNamespacePrefix(fsKey string) string {
+	return "rfs:{" + fsKey + "}:"
+}
+
+func inodeKeyPrefix(fsKey string) string {
+	return fsNamespacePrefix(fsKey) + "inode:"
+}
+
+// childrenKeyPrefix precedes a directory's path in the SET naming its
+// entries.
+func childrenKeyPrefix(fsKey string) string {
+	return fsNamespacePrefix(fsKey) + "children:"
+}
+
+// infoKey is the per-filesystem summary HASH (counters plus the module
+// version that last wrote the key).
+func infoKey(fsKey string) string {
+	return fsNamespacePrefix(fsKey) + "info"
+}
+
+// fsNamespacePattern returns a SCAN/PSUBSCRIBE pattern matching every key
+// of the filesystem, with glob metacharacters in the name escaped.
+func fsNamespacePattern(fsKey string) string {
+	return "rfs:{" + escapeGlob(fsKey) + "}:*"
+}
+
+func inodeKeyPattern(fsKey string) string {
+	return "rfs:{" + escapeGlob(fsKey) + "}:inode:*"
+}
+
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
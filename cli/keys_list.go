@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/redis-fs/mount/client"
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// keys — list the filesystems stored in Redis
+// ---------------------------------------------------------------------------
+//
+// Every filesystem has a root inode, a HASH at rfs:{<key>}:inode:/. keys
+// finds them with SCAN filtered by TYPE, never KEYS, so a large database is
+// walked in batches without blocking the server.
+
+type fsKeySummary struct {
+	Key         string `json:"key"`
+	Files       int64  `json:"files"`
+	Dirs        int64  `json:"dirs"` // excluding the root
+	RedisKeys   int64  `json:"redis_keys"`
+	MemoryBytes *int64 `json:"memory_bytes,omitempty"` // nil when MEMORY USAGE is refused
+	Mountpoint  string `json:"mountpoint,omitempty"`   // set while mounted on this machine
+}
+
+// findFilesystems returns the keys of every filesystem in rdb's database,
+// sorted.
+func findFilesystems(ctx context.Context, rdb *redis.Client, onProgress func(int)) ([]string, error) {
+	const prefix, suffix = "rfs:{", "}:inode:/"
+	var found []string
+	var cursor uint64
+	for {
+		keys, next, err := rdb.ScanType(ctx, cursor, prefix+"*"+suffix, 500, "hash").Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			if fsKey, ok := strings.CutPrefix(k, prefix); ok {
+				found = append(found, strings.TrimSuffix(fsKey, suffix))
+			}
+		}
+		if onProgress != nil {
+			onProgress(len(found))
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	sort.Strings(found)
+	return found, nil
+}
+
+// summarizeFilesystem counts fsKey's entries, from its info hash, and the
+// keys and memory it holds.
+func summarizeFilesystem(ctx context.Context, rdb *redis.Client, fsKey string) (fsKeySummary, error) {
+	s := fsKeySummary{Key: fsKey}
+	counters, err := client.New(rdb, fsKey).Info(ctx)
+	if err != nil {
+		return s, err
+	}
+	// The directory counter includes the root.
+	s.Files, s.Dirs = counters.Files, max(counters.Directories-1, 0)
+	size, err := measureNamespace(ctx, rdb, fsKey, nil)
+	if err != nil {
+		return s, err
+	}
+	s.RedisKeys, s.MemoryBytes = size.keys, size.memory
+	return s, nil
+}
+
+func cmdKeys(args []string) error {
+	usage := fmt.Sprintf("Usage: %s keys [--json]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("keys")
+	jsonOut := fs.Bool("json", false, "print the filesystems as JSON")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 0 {
+		return fmt.Errorf("unexpected arguments %v\n\n%s", pos, usage)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	rdb := newRedisClient(cfg, 4)
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("cannot connect to Redis at %s: %w", cfg.RedisAddr, err)
+	}
+
+	var step *uiStep
+	if !*jsonOut {
+		step = startStep("Scanning for filesystems")
+	}
+	progress := func(msg string) {
+		if step != nil {
+			step.update(msg)
+		}
+	}
+	fail := func(err error) error {
+		if step != nil {
+			step.fail(err.Error())
+		}
+		return err
+	}
+	fsKeys, err := findFilesystems(ctx, rdb, func(n int) {
+		progress(fmt.Sprintf("Scanning for filesystems · %d found", n))
+	})
+	if err != nil {
+		return fail(err)
+	}
+	sts, err := loadState()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fail(err)
+	}
+	summaries := make([]fsKeySummary, 0, len(fsKeys))
+	for i, k := range fsKeys {
+		progress(fmt.Sprintf("Measuring %s · %d of %d", k, i+1, len(fsKeys)))
+		s, err := summarizeFilesystem(ctx, rdb, k)
+		if err != nil {
+			return fail(fmt.Errorf("%s: %w", k, err))
+		}
+		if st, ok := sts.forKey(cfg, k); ok {
+			if backend, _, err := backendForState(st); err == nil && backend.IsMounted(st.Mountpoint) {
+				s.Mountpoint = st.Mountpoint
+			}
+		}
+		summaries = append(summaries, s)
+	}
+
+	if *jsonOut {
+		b, _ := json.MarshalIndent(summaries, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+	step.update("Scanning for filesystems")
+	step.succeed(fmt.Sprintf("%d found", len(summaries)))
+	fmt.Println()
+	printFilesystemKeys(summaries, cfg)
+	return nil
+}
+
+func printFilesystemKeys(summaries []fsKeySummary, cfg config) {
+	title := clr(ansiBold, fmt.Sprintf("Filesystems on %s (db %d)", cfg.RedisAddr, cfg.RedisDB))
+	if len(summaries) == 0 {
+		printBox(title, []boxRow{{Value: clr(ansiDim, "none")}})
+		return
+	}
+	rows := make([]boxRow, 0, len(summaries))
+	for _, s := range summaries {
+		memory := clr(ansiDim, "memory unknown")
+		if s.MemoryBytes != nil {
+			memory = formatBytes(*s.MemoryBytes)
+		}
+		value := fmt.Sprintf("%d files, %d dirs · %s", s.Files, s.Dirs, memory)
+		switch {
+		case s.Mountpoint != "":
+			value += " · " + clr(ansiGreen, "mounted") + " at " + s.Mountpoint
+		case s.Key == cfg.RedisKey:
+			value += clr(ansiDim, " · configured")
+		}
+		rows = append(rows, boxRow{Label: s.Key, Value: value})
+	}
+	printBox(title, rows)
+}
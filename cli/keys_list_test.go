@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis-fs/mount/client"
+)
+
+func TestFindFilesystems(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	a, b := testKey(t, rdb), testKey(t, rdb)
+	for _, k := range []string{b, a} {
+		if _, err := importDirectory(ctx, client.New(rdb, k), writeFixtureTree(t), importOptions{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Neither a stray string nor a HASH outside the layout is a filesystem.
+	rdb.Set(ctx, "rfs:{decoy}:inode:/", "x", 0)
+	rdb.HSet(ctx, "unrelated", "type", "dir")
+
+	found, err := findFilesystems(ctx, rdb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{a, b}
+	if a > b {
+		want = []string{b, a}
+	}
+	if len(found) != 2 || found[0] != want[0] || found[1] != want[1] {
+		t.Fatalf("found %v, want %v", found, want)
+	}
+
+	s, err := summarizeFilesystem(ctx, rdb, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Files != 4 || s.Dirs != 4 || s.RedisKeys == 0 {
+		t.Fatalf("summary %+v", s)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// Symlinks pointing out of the imported tree
+// ---------------------------------------------------------------------------
+//
+// Symlink targets are stored verbatim, so they resolve against wherever
+// the filesystem ends up mounted. Each link falls in one of three classes:
+// a relative target that stays inside the tree works anywhere; an
+// absolute target inside the source directory works only while the tree
+// sits at that path, so --rewrite-absolute-links stores it relative to
+// the link instead; anything else points outside the tree and is kept
+// as it is. Rewritten links are recorded, so export can put the original
+// targets back.
+
+type linkClass int
+
+const (
+	linkInternalRelative linkClass = iota
+	linkInternalAbsolute
+	linkExternal
+)
+
+// classifyLink places the link at rel, relative to root, pointing to
+// target. Targets are resolved lexically, as they would be read.
+func classifyLink(root, rel, target string) linkClass {
+	if filepath.IsAbs(target) {
+		if _, ok := linkRoot(root, target); ok {
+			return linkInternalAbsolute
+		}
+		return linkExternal
+	}
+	if pathWithin(filepath.Join(root, filepath.Dir(rel), target), root) {
+		return linkInternalRelative
+	}
+	return linkExternal
+}
+
+// linkRoot returns the form of root, as given or with its symlinks
+// resolved, that the absolute target lies within.
+func linkRoot(root, target string) (string, bool) {
+	for _, r := range []string{root, realPath(root)} {
+		if pathWithin(target, r) {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// relativeLinkTarget rewrites target, an absolute path inside root, to
+// the same place relative to the directory holding the link at rel. It
+// reports false for any other target.
+func relativeLinkTarget(root, rel, target string) (string, bool) {
+	if !filepath.IsAbs(target) {
+		return "", false
+	}
+	r, ok := linkRoot(root, target)
+	if !ok {
+		return "", false
+	}
+	out, err := filepath.Rel(filepath.Join(r, filepath.Dir(rel)), target)
+	if err != nil {
+		return "", false
+	}
+	return out, true
+}
+
+// linkReport counts a tree's symlinks by class.
+type linkReport struct {
+	Internal int // relative, inside the tree
+	Absolute int // absolute, inside the tree
+	External int
+}
+
+func (r linkReport) total() int { return r.Internal + r.Absolute + r.External }
+
+func (r *linkReport) add(c linkClass) {
+	switch c {
+	case linkInternalRelative:
+		r.Internal++
+	case linkInternalAbsolute:
+		r.Absolute++
+	default:
+		r.External++
+	}
+}
+
+// summary describes the counts for the migration plan.
+func (r linkReport) summary(rewrite bool) string {
+	out := fmt.Sprintf("%d internal", r.Internal)
+	if r.Absolute > 0 {
+		if rewrite {
+			out += fmt.Sprintf(", %d absolute (rewritten relative)", r.Absolute)
+		} else {
+			out += clr(ansiYellow, fmt.Sprintf(", %d absolute (break elsewhere; --rewrite-absolute-links)", r.Absolute))
+		}
+	}
+	if r.External > 0 {
+		out += fmt.Sprintf(", %d external (kept as-is)", r.External)
+	}
+	return out
+}
+
+// analyzeLinks classifies every symlink below root.
+func analyzeLinks(root string) (linkReport, error) {
+	var report linkReport
+	err := walkTree(root, func(path, rel string, d os.DirEntry) error {
+		if d.Type()&os.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		report.add(classifyLink(root, rel, target))
+		return nil
+	})
+	return report, err
+}
+
+// linkRewrite is a symlink whose absolute target was stored relative.
+type linkRewrite struct {
+	Path     string `json:"-"`        // in the filesystem
+	Target   string `json:"target"`   // as stored
+	Original string `json:"original"` // as found in the source
+}
+
+// linkRewritesKey is the HASH of rewritten links, by path.
+func linkRewritesKey(fsKey string) string {
+	return fsNamespacePrefix(fsKey) + "link_rewrites"
+}
+
+// recordLinkRewrites notes rewritten links for a later export.
+func recordLinkRewrites(ctx context.Context, rdb *redis.Client, fsKey string, rewrites []linkRewrite) error {
+	if len(rewrites) == 0 {
+		return nil
+	}
+	fields := make(map[string]interface{}, len(rewrites))
+	for _, lr := range rewrites {
+		b, err := json.Marshal(lr)
+		if err != nil {
+			return err
+		}
+		fields[lr.Path] = b
+	}
+	return rdb.HSet(ctx, linkRewritesKey(fsKey), fields).Err()
+}
+
+// loadLinkRewrites reads the links an import rewrote, by path.
+func loadLinkRewrites(ctx context.Context, rdb *redis.Client, fsKey string) (map[string]linkRewrite, error) {
+	fields, err := rdb.HGetAll(ctx, linkRewritesKey(fsKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]linkRewrite, len(fields))
+	for p, v := range fields {
+		var lr linkRewrite
+		if err := json.Unmarshal([]byte(v), &lr); err != nil {
+			return nil, fmt.Errorf("link rewrite for %s: %w", p, err)
+		}
+		lr.Path = p
+		out[p] = lr
+	}
+	return out, nil
+}
+
+// originalLinkTarget is the target export writes for a link: the original
+// from before the import rewrote it, unless the link has changed since.
+func originalLinkTarget(rewrites map[string]linkRewrite, p, target string) (string, bool) {
+	if lr, ok := rewrites[p]; ok && lr.Target == target {
+		return lr.Original, true
+	}
+	return target, false
+}
+
+// printLinkRewrites lists the links an import rewrote.
+func printLinkRewrites(rewrites []linkRewrite) {
+	if len(rewrites) == 0 {
+		return
+	}
+	sorted := append([]linkRewrite(nil), rewrites...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	const maxRows = 10
+	var rows []boxRow
+	for i, lr := range sorted {
+		if i == maxRows {
+			rows = append(rows, boxRow{Value: clr(ansiDim, fmt.Sprintf("… and %d more", len(sorted)-maxRows))})
+			break
+		}
+		rows = append(rows, boxRow{Label: lr.Path, Value: lr.Original + clr(ansiDim, " → ") + lr.Target})
+	}
+	printBox(clr(ansiBold, "Rewritten symlinks"), rows)
+}
+
+// warnAbsoluteLinks points out links an import left absolute.
+func warnAbsoluteLinks(report linkReport, source string) {
+	if report.Absolute == 0 {
+		return
+	}
+	fmt.Printf("  %s %d symlinks point into %s by absolute path and break if the tree is mounted elsewhere %s\n",
+		clr(ansiYellow, "!"), report.Absolute, source, clr(ansiDim, "(--rewrite-absolute-links stores them relative)"))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/redis-fs/mount/client"
+)
+
+func TestClassifyLink(t *testing.T) {
+	root := "/home/me/proj"
+	for _, tc := range []struct {
+		rel, target string
+		want        linkClass
+	}{
+		{"link", "src/main.go", linkInternalRelative},
+		{"a/b/link", "../../README.md", linkInternalRelative},
+		{"a/link", "..", linkInternalRelative},
+		{"a/link", "../../shared", linkExternal},
+		{"link", "../proj-other/x", linkExternal},
+		{"a/b/link", "/home/me/proj/lib/x.so", linkInternalAbsolute},
+		{"link", "/home/me/proj", linkInternalAbsolute},
+		{"link", "/etc/ssl/cert.pem", linkExternal},
+		{"link", "/home/me/project/x", linkExternal},
+	} {
+		if got := classifyLink(root, tc.rel, tc.target); got != tc.want {
+			t.Errorf("%s -> %s: class %d, want %d", tc.rel, tc.target, got, tc.want)
+		}
+	}
+}
+
+func TestRelativeLinkTarget(t *testing.T) {
+	root := "/home/me/proj"
+	for _, tc := range []struct {
+		rel, target, want string
+	}{
+		{"link", "/home/me/proj/src/main.go", "src/main.go"},
+		{"a/link", "/home/me/proj/src/main.go", "../src/main.go"},
+		{"a/b/c/link", "/home/me/proj/a/x", "../../x"},
+		{"a/b/link", "/home/me/proj/a/b/c/d", "c/d"},
+		{"a/b/link", "/home/me/proj", "../.."},
+		{"a/link", "/home/me/proj/a", "."},
+	} {
+		got, ok := relativeLinkTarget(root, tc.rel, tc.target)
+		if !ok || got != tc.want {
+			t.Errorf("%s -> %s: %q (%v), want %q", tc.rel, tc.target, got, ok, tc.want)
+		}
+		// The rewritten target reaches the same place.
+		if back := filepath.Join(root, filepath.Dir(tc.rel), got); back != tc.target {
+			t.Errorf("%s -> %s: rewritten %q resolves to %s", tc.rel, tc.target, got, back)
+		}
+	}
+	for _, target := range []string{"src/main.go", "/etc/ssl/cert.pem", "/home/me/project"} {
+		if got, ok := relativeLinkTarget(root, "link", target); ok {
+			t.Errorf("%s rewritten to %q", target, got)
+		}
+	}
+}
+
+func TestImportRewritesAbsoluteLinks(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	root := writeFixtureTree(t)
+	abs := filepath.Join(root, "src", "deep", "er", "blob.bin")
+	for name, target := range map[string]string{
+		"src/deep/abs":    abs,
+		"src/escape":      "../../shared",
+		"src/deep/er/etc": "/etc/hostname",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := analyzeLinks(root)
+	if err != nil || report != (linkReport{Internal: 1, Absolute: 1, External: 2}) {
+		t.Fatalf("analyze: %+v, %v", report, err)
+	}
+
+	key := testKey(t, rdb)
+	fsClient := client.New(rdb, key)
+	stats, err := importDirectory(ctx, fsClient, root, importOptions{rewriteLinks: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.links != report || len(stats.rewrittenLinks) != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if got, _ := fsClient.Readlink(ctx, "/src/deep/abs"); got != "er/blob.bin" {
+		t.Fatalf("rewritten target %q", got)
+	}
+	if got, _ := fsClient.Readlink(ctx, "/src/escape"); got != "../../shared" {
+		t.Fatalf("external target %q", got)
+	}
+	if err := recordLinkRewrites(ctx, rdb, key, stats.rewrittenLinks); err != nil {
+		t.Fatal(err)
+	}
+	rewrites, err := loadLinkRewrites(ctx, rdb, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		rewrites map[string]linkRewrite
+		want     string
+	}{{nil, "er/blob.bin"}, {rewrites, abs}} {
+		out := filepath.Join(t.TempDir(), "out")
+		exported, err := exportTree(ctx, fsClient, nil, out, exportOptions{rewrites: tc.rewrites})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.Readlink(filepath.Join(out, "src", "deep", "abs")); got != tc.want {
+			t.Errorf("exported target %q, want %q", got, tc.want)
+		}
+		if restored := exported.LinksRestored; (restored == 1) != (tc.rewrites != nil) {
+			t.Errorf("restored %d links", restored)
+		}
+	}
+
+	// A link changed since the import keeps its new target.
+	if err := fsClient.Rm(ctx, "/src/deep/abs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsClient.Ln(ctx, "er", "/src/deep/abs"); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	if _, err := exportTree(ctx, fsClient, nil, out, exportOptions{rewrites: rewrites}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.Readlink(filepath.Join(out, "src", "deep", "abs")); got != "er" {
+		t.Errorf("changed link exported as %q", got)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Log and runtime file hygiene for managed services
+// ---------------------------------------------------------------------------
+
+// largeLogBytes is the size at which up suggests pruning a log.
+const largeLogBytes = 100 << 20
+
+const defaultLogKeep = 7 * 24 * time.Hour
+
+// rotatedLogLayout is the timestamp suffix prune-logs gives archived logs.
+const rotatedLogLayout = "20060102-150405"
+
+// removeManagedRedisFiles deletes what a stopped managed redis-server left
+// behind: always its pidfile, and with purgeData its RDB file too.
+func removeManagedRedisFiles(st state, purgeData bool) error {
+	if !st.ManageRedis || (st.RedisPID > 0 && processAlive(st.RedisPID)) {
+		return nil
+	}
+	paths := []string{st.RedisPidfile}
+	if purgeData && st.RedisDataFile != "" {
+		paths = append(paths, st.RedisDataFile)
+		for _, pattern := range aofFiles(st.RedisDataFile) {
+			aof, _ := filepath.Glob(pattern)
+			paths = append(paths, aof...)
+		}
+	}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// warnLargeLogs prints a warning for each log already past largeLogBytes.
+func warnLargeLogs(paths ...string) {
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || info.Size() < largeLogBytes {
+			continue
+		}
+		fmt.Printf("  %s %s is %s; run '%s prune-logs' to rotate it\n",
+			clr(ansiYellow, "!"), p, formatBytes(info.Size()), filepath.Base(os.Args[0]))
+	}
+}
+
+type pruneResult struct {
+	Rotated string   // archive of the live log, if one was written
+	Freed   int64    // bytes truncated from the live log
+	Removed []string // archives older than the keep window
+}
+
+// pruneLog archives the current contents of path beside it, truncates it
+// in place, and deletes archives older than keep. The log is truncated
+// rather than renamed because the mount daemon holds it open for
+// appending; with keep 0 nothing is archived.
+func pruneLog(path string, keep time.Duration, now time.Time) (pruneResult, error) {
+	var res pruneResult
+	info, err := os.Stat(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return res, err
+	}
+	if err == nil && info.Size() > 0 {
+		if keep > 0 {
+			res.Rotated = path + "." + now.Format(rotatedLogLayout)
+			if err := copyLogFile(path, res.Rotated); err != nil {
+				return res, err
+			}
+		}
+		if err := os.Truncate(path, 0); err != nil {
+			return res, err
+		}
+		res.Freed = info.Size()
+	}
+
+	archives, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return res, err
+	}
+	sort.Strings(archives)
+	for _, a := range archives {
+		stamp, err := time.ParseInLocation(rotatedLogLayout, strings.TrimPrefix(a, path+"."), now.Location())
+		if err != nil || a == res.Rotated || now.Sub(stamp) <= keep {
+			continue
+		}
+		if err := os.Remove(a); err != nil {
+			return res, err
+		}
+		res.Removed = append(res.Removed, a)
+	}
+	return res, nil
+}
+
+func copyLogFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// serviceLog is one log a managed service writes.
+type serviceLog struct {
+	Label string // "redis", or "mount" followed by the filesystem's name
+	Path  string
+	Redis bool
+}
+
+// serviceLogs returns the Redis and mount logs, preferring the paths the
+// running filesystems recorded in state over the current config.
+func serviceLogs() ([]serviceLog, error) {
+	if sts, err := loadState(); err == nil {
+		var logs []serviceLog
+		seen := map[string]bool{}
+		for _, name := range sts.names() {
+			st := sts[name]
+			if st.ManageRedis && st.RedisLog != "" && !seen[st.RedisLog] {
+				logs = append(logs, serviceLog{Label: "redis", Path: st.RedisLog, Redis: true})
+				seen[st.RedisLog] = true
+			}
+			if st.MountLog != "" && !seen[st.MountLog] {
+				logs = append(logs, serviceLog{Label: mountLogLabel(name, len(sts)), Path: st.MountLog})
+				seen[st.MountLog] = true
+			}
+		}
+		return logs, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return nil, err
+	}
+	var logs []serviceLog
+	if !cfg.UseExistingRedis {
+		logs = append(logs, serviceLog{Label: "redis", Path: cfg.RedisLog, Redis: true})
+	}
+	all := cfg.filesystems()
+	for _, e := range all {
+		logs = append(logs, serviceLog{Label: mountLogLabel(e.Name, len(all)), Path: cfg.forFilesystem(e).MountLog})
+	}
+	return logs, nil
+}
+
+// mountLogLabel names a mount log, by filesystem when there are several.
+func mountLogLabel(name string, filesystems int) string {
+	if filesystems > 1 {
+		return "mount " + name
+	}
+	return "mount"
+}
+
+func cmdPruneLogs(args []string) error {
+	usage := fmt.Sprintf("Usage: %s prune-logs [--keep 7d]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("prune-logs")
+	keep := ageFlag(defaultLogKeep)
+	fs.Var(&keep, "keep", "keep rotated logs this long (0 truncates without archiving)")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 0 {
+		return fmt.Errorf("unexpected arguments %v\n\n%s", pos, usage)
+	}
+
+	logs, err := serviceLogs()
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	now := time.Now()
+	for _, l := range logs {
+		s := startStep("Pruning " + l.Path)
+		res, err := pruneLog(l.Path, time.Duration(keep), now)
+		if err != nil {
+			s.fail(err.Error())
+			return err
+		}
+		detail := "empty"
+		if res.Freed > 0 {
+			detail = "truncated " + formatBytes(res.Freed)
+		}
+		if res.Rotated != "" {
+			detail += ", archived to " + filepath.Base(res.Rotated)
+		}
+		if n := len(res.Removed); n > 0 {
+			detail += fmt.Sprintf(", removed %d old archive(s)", n)
+		}
+		s.succeed(detail)
+	}
+	fmt.Println()
+	return nil
+}
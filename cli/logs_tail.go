@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// logs — print and follow the Redis and mount logs
+// ---------------------------------------------------------------------------
+
+const defaultLogLines = 50
+
+// logFollowInterval is how often logs -f checks the files for more.
+var logFollowInterval = 250 * time.Millisecond
+
+func cmdLogs(args []string) error {
+	usage := fmt.Sprintf("Usage: %s logs [-n lines] [-f] [--mount | --redis]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("logs")
+	lines := fs.Int("n", defaultLogLines, "print the last `lines` lines of each log")
+	follow := fs.Bool("f", false, "keep printing lines as they are written, until ctrl-C")
+	mountOnly := fs.Bool("mount", false, "only the mount log")
+	redisOnly := fs.Bool("redis", false, "only the Redis log")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 0 {
+		return fmt.Errorf("unexpected arguments %v\n\n%s", pos, usage)
+	}
+	if *mountOnly && *redisOnly {
+		return fmt.Errorf("--mount and --redis cannot be combined\n\n%s", usage)
+	}
+	if *lines < 0 {
+		return fmt.Errorf("-n must not be negative\n\n%s", usage)
+	}
+
+	all, err := serviceLogs()
+	if err != nil {
+		return err
+	}
+	var logs []serviceLog
+	for _, l := range all {
+		if (*mountOnly && l.Redis) || (*redisOnly && !l.Redis) {
+			continue
+		}
+		logs = append(logs, l)
+	}
+	if len(logs) == 0 {
+		if *redisOnly {
+			return errors.New("no Redis log: rfs does not manage the Redis server (useExistingRedis)")
+		}
+		return errors.New("no logs to show")
+	}
+
+	offsets := make([]int64, len(logs))
+	for i, l := range logs {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(logHeader(l))
+		tail, end, err := lastLines(l.Path, *lines)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			fmt.Println(clr(ansiDim, "(not written yet)"))
+		case err != nil:
+			return err
+		default:
+			for _, line := range tail {
+				fmt.Println(line)
+			}
+		}
+		offsets[i] = end
+	}
+	if !*follow {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	fmt.Println()
+	fmt.Println(clr(ansiDim, "Following; ctrl-C to stop"))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, len(logs))
+	for i, l := range logs {
+		prefix := ""
+		if len(logs) > 1 {
+			prefix = clr(logColor(l), fmt.Sprintf("%-*s", logLabelWidth(logs), l.Label)) + clr(ansiDim, " │ ")
+		}
+		wg.Add(1)
+		go func(i int, l serviceLog) {
+			defer wg.Done()
+			errs[i] = followLog(ctx, l.Path, offsets[i], logFollowInterval, func(line string) {
+				mu.Lock()
+				defer mu.Unlock()
+				fmt.Println(prefix + line)
+			})
+		}(i, l)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func logHeader(l serviceLog) string {
+	return clr(ansiBold+logColor(l), "==> "+l.Label) + " " + clr(ansiDim, l.Path)
+}
+
+func logColor(l serviceLog) string {
+	if l.Redis {
+		return ansiRed
+	}
+	return ansiCyan
+}
+
+func logLabelWidth(logs []serviceLog) int {
+	w := 0
+	for _, l := range logs {
+		w = max(w, len(l.Label))
+	}
+	return w
+}
+
+// lastLines returns the last n lines of the file at path, reading back
+// from its end one block at a time, and the size it read up to.
+func lastLines(path string, n int) ([]string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	end := info.Size()
+	if n == 0 || end == 0 {
+		return nil, end, nil
+	}
+
+	const block = 64 << 10
+	var buf []byte
+	pos := end
+	for pos > 0 {
+		size := min(int64(block), pos)
+		pos -= size
+		chunk := make([]byte, size)
+		if _, err := f.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		buf = append(chunk, buf...)
+		// One more newline than lines wanted marks where the first starts;
+		// a trailing newline ends the last line rather than starting one.
+		if bytes.Count(bytes.TrimSuffix(buf, []byte("\n")), []byte("\n")) >= n {
+			break
+		}
+	}
+	lines := strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, end, nil
+}
+
+// followLog passes each line appended to path after offset to emit until
+// ctx is done. A file that shrinks, as prune-logs truncates them, is read
+// again from the start; one that does not exist yet is waited for. A
+// final line without a newline is held back until it is finished.
+func followLog(ctx context.Context, path string, offset int64, interval time.Duration, emit func(string)) error {
+	var partial []byte
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if len(partial) > 0 {
+				emit(string(partial))
+			}
+			return nil
+		case <-t.C:
+		}
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			offset, partial = 0, nil
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		b, err := readFrom(f, &offset)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if b == nil {
+			partial = nil
+			continue
+		}
+		b = append(partial, b...)
+		i := bytes.LastIndexByte(b, '\n')
+		if i < 0 {
+			partial = b
+			continue
+		}
+		for _, line := range strings.Split(string(b[:i]), "\n") {
+			emit(line)
+		}
+		partial = append([]byte(nil), b[i+1:]...)
+	}
+}
+
+// readFrom returns what f holds past *offset and advances it. After a
+// truncation it starts over from the beginning and returns nil, so the
+// caller drops any partial line it held.
+func readFrom(f *os.File, offset *int64) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < *offset {
+		*offset = 0
+		return nil, nil
+	}
+	if info.Size() == *offset {
+		return []byte{}, nil
+	}
+	b := make([]byte, info.Size()-*offset)
+	n, err := f.ReadAt(b, *offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	*offset += int64(n)
+	return b[:n], nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPruneLog(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "rfs-mount.log")
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	if err := os.WriteFile(log, []byte("line one\nline two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := log + "." + now.AddDate(0, 0, -8).Format(rotatedLogLayout)
+	recent := log + "." + now.AddDate(0, 0, -2).Format(rotatedLogLayout)
+	unrelated := log + ".bak"
+	for _, p := range []string{old, recent, unrelated} {
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := pruneLog(log, 7*24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Freed != 18 || len(res.Removed) != 1 || res.Removed[0] != old {
+		t.Fatalf("result %+v", res)
+	}
+	if b, err := os.ReadFile(res.Rotated); err != nil || string(b) != "line one\nline two\n" {
+		t.Fatalf("archive %q: %q, %v", res.Rotated, b, err)
+	}
+	if info, err := os.Stat(log); err != nil || info.Size() != 0 {
+		t.Fatalf("live log not truncated: %v", err)
+	}
+	for _, p := range []string{recent, unrelated} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s should be kept: %v", filepath.Base(p), err)
+		}
+	}
+
+	// keep 0 truncates without archiving and drops every archive.
+	os.WriteFile(log, []byte("more\n"), 0o644)
+	res, err = pruneLog(log, 0, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Rotated != "" || res.Freed != 5 || len(res.Removed) != 2 {
+		t.Fatalf("keep 0: %+v", res)
+	}
+
+	// A log that was never written is not an error.
+	if _, err := pruneLog(filepath.Join(dir, "missing.log"), time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	cases := map[string]time.Duration{"7d": 7 * 24 * time.Hour, "0": 0, "36h": 36 * time.Hour, "90m": 90 * time.Minute}
+	for in, want := range cases {
+		if got, err := parseAge(in); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "d", "-1d", "-5m", "week"} {
+		if _, err := parseAge(in); err == nil {
+			t.Errorf("parseAge(%q) succeeded", in)
+		}
+	}
+}
+
+func TestRemoveManagedRedisFiles(t *testing.T) {
+	dir := t.TempDir()
+	st := state{
+		ManageRedis:   true,
+		RedisPidfile:  filepath.Join(dir, "rfs-6380.pid"),
+		RedisDataFile: filepath.Join(dir, "rfs-6380.rdb"),
+	}
+	for _, p := range []string{st.RedisPidfile, st.RedisDataFile} {
+		os.WriteFile(p, []byte("1"), 0o644)
+	}
+
+	if err := removeManagedRedisFiles(st, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(st.RedisPidfile); !os.IsNotExist(err) {
+		t.Errorf("pidfile survived: %v", err)
+	}
+	if _, err := os.Stat(st.RedisDataFile); err != nil {
+		t.Errorf("data file removed without --purge-data: %v", err)
+	}
+	if err := removeManagedRedisFiles(st, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(st.RedisDataFile); !os.IsNotExist(err) {
+		t.Errorf("data file survived --purge-data: %v", err)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "rfs-redis.log")
+	var b strings.Builder
+	for i := 1; i <= 20000; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	if err := os.WriteFile(log, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lines, end, err := lastLines(log, 3)
+	if err != nil || strings.Join(lines, "|") != "line 19998|line 19999|line 20000" || end != int64(b.Len()) {
+		t.Fatalf("last 3: %q, %d, %v", lines, end, err)
+	}
+	// More than one block back, and more lines than the file has.
+	if lines, _, _ := lastLines(log, 15000); len(lines) != 15000 || lines[0] != "line 5001" {
+		t.Fatalf("last 15000: %d lines from %q", len(lines), lines[0])
+	}
+	if lines, _, _ := lastLines(log, 50000); len(lines) != 20000 {
+		t.Fatalf("last 50000: %d lines", len(lines))
+	}
+	if lines, _, err := lastLines(log, 0); err != nil || len(lines) != 0 {
+		t.Fatalf("last 0: %q, %v", lines, err)
+	}
+	os.WriteFile(log, []byte("no newline"), 0o644)
+	if lines, _, _ := lastLines(log, 5); len(lines) != 1 || lines[0] != "no newline" {
+		t.Fatalf("unterminated: %q", lines)
+	}
+}
+
+func TestFollowLog(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "rfs-mount.log")
+	os.WriteFile(log, []byte("old\n"), 0o644)
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan string, 10)
+	done := make(chan error)
+	go func() { done <- followLog(ctx, log, 4, 5*time.Millisecond, func(l string) { got <- l }) }()
+
+	next := func() string {
+		select {
+		case l := <-got:
+			return l
+		case <-time.After(2 * time.Second):
+			t.Fatal("no line")
+			return ""
+		}
+	}
+	f, _ := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString("first\nsec")
+	if l := next(); l != "first" {
+		t.Fatalf("got %q", l)
+	}
+	f.WriteString("ond\n")
+	f.Close()
+	if l := next(); l != "second" {
+		t.Fatalf("got %q", l)
+	}
+	// Truncated, as prune-logs does: read again from the start.
+	os.WriteFile(log, []byte("fresh\n"), 0o644)
+	if l := next(); l != "fresh" {
+		t.Fatalf("after truncation got %q", l)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
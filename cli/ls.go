@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+)
+
+// ---------------------------------------------------------------------------
+// ls — list a directory inside the filesystem without mounting it
+// ---------------------------------------------------------------------------
+
+type lsEntry struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Type     string    `json:"type"`
+	Mode     uint32    `json:"mode"`
+	UID      uint32    `json:"uid"`
+	GID      uint32    `json:"gid"`
+	Size     int64     `json:"size"`
+	Mtime    time.Time `json:"mtime"`
+	Target   string    `json:"target,omitempty"`
+	Children []lsEntry `json:"children,omitempty"`
+}
+
+type lsSort int
+
+const (
+	lsByName lsSort = iota
+	lsByTime
+	lsBySize
+)
+
+type lsOptions struct {
+	recursive bool
+	sortBy    lsSort
+	reverse   bool
+}
+
+// modeString renders the type and permission bits the way ls -l does.
+// os.FileMode's String would mark symlinks with "L" rather than "l".
+func (e lsEntry) modeString() string {
+	kind := "-"
+	switch e.Type {
+	case "dir":
+		kind = "d"
+	case "symlink":
+		kind = "l"
+	}
+	return kind + os.FileMode(e.Mode & 0o777).String()[1:]
+}
+
+// listDir reads one directory through the FS client. With opts.recursive
+// it descends into subdirectories, filling in Children.
+func listDir(ctx context.Context, fsClient client.Client, dir string, opts lsOptions) ([]lsEntry, error) {
+	raw, err := fsClient.LsLong(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	entries := make([]lsEntry, 0, len(raw))
+	for _, r := range raw {
+		p := path.Join(dir, r.Name)
+		e := lsEntry{Name: r.Name, Path: p, Type: r.Type, Mode: r.Mode, Size: r.Size, Mtime: time.UnixMilli(r.Mtime)}
+		st, err := fsClient.Stat(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if st != nil {
+			e.UID, e.GID = st.UID, st.GID
+		}
+		if e.Type == "symlink" {
+			if e.Target, err = fsClient.Readlink(ctx, p); err != nil {
+				return nil, fmt.Errorf("%s: %w", p, err)
+			}
+		}
+		if e.Type == "dir" && opts.recursive {
+			if e.Children, err = listDir(ctx, fsClient, p, opts); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	sortLsEntries(entries, opts)
+	return entries, nil
+}
+
+// sortLsEntries orders entries like ls: by name, or newest or largest
+// first, with -r reversing whichever order applies.
+func sortLsEntries(entries []lsEntry, opts lsOptions) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if opts.reverse {
+			a, b = b, a
+		}
+		switch opts.sortBy {
+		case lsByTime:
+			if !a.Mtime.Equal(b.Mtime) {
+				return a.Mtime.After(b.Mtime)
+			}
+		case lsBySize:
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+// lsName colors a name the way GNU ls does by default: directories bold
+// blue, symlinks cyan, executables green.
+func lsName(e lsEntry) string {
+	switch {
+	case e.Type == "dir":
+		return clr(ansiBold+ansiBlue, e.Name)
+	case e.Type == "symlink":
+		return clr(ansiCyan, e.Name) + " -> " + e.Target
+	case e.Mode&0o111 != 0:
+		return clr(ansiGreen, e.Name)
+	}
+	return e.Name
+}
+
+// lsTimestamp follows ls: the time of day for recent entries, the year for
+// those older than six months or in the future.
+func lsTimestamp(t, now time.Time) string {
+	t = t.Local()
+	if t.After(now) || now.Sub(t) > 182*24*time.Hour {
+		return t.Format("Jan _2  2006")
+	}
+	return t.Format("Jan _2 15:04")
+}
+
+// writeLsLong prints entries in ls -l columns.
+func writeLsLong(w io.Writer, entries []lsEntry, now time.Time) {
+	var ownerW, groupW, sizeW int
+	for _, e := range entries {
+		ownerW = max(ownerW, len(fmt.Sprint(e.UID)))
+		groupW = max(groupW, len(fmt.Sprint(e.GID)))
+		sizeW = max(sizeW, len(fmt.Sprint(e.Size)))
+	}
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s  %*d %*d  %*d  %s  %s\n",
+			e.modeString(), ownerW, e.UID, groupW, e.GID, sizeW, e.Size, lsTimestamp(e.Mtime, now), lsName(e))
+	}
+}
+
+// writeLsShort prints one name per line, like ls -1.
+func writeLsShort(w io.Writer, entries []lsEntry) {
+	for _, e := range entries {
+		if e.Type == "symlink" {
+			fmt.Fprintln(w, clr(ansiCyan, e.Name))
+			continue
+		}
+		fmt.Fprintln(w, lsName(e))
+	}
+}
+
+// writeLsRecursive prints each directory as its own section, like ls -R,
+// or ls -lR with long.
+func writeLsRecursive(w io.Writer, dir string, entries []lsEntry, long bool, now time.Time) {
+	fmt.Fprintf(w, "%s:\n", dir)
+	if long {
+		writeLsLong(w, entries, now)
+	} else {
+		writeLsShort(w, entries)
+	}
+	for _, e := range entries {
+		if e.Type == "dir" {
+			fmt.Fprintln(w)
+			writeLsRecursive(w, e.Path, e.Children, long, now)
+		}
+	}
+}
+
+// writeLsTree draws entries with box-drawing branches, like tree(1).
+func writeLsTree(w io.Writer, entries []lsEntry, prefix string) {
+	for i, e := range entries {
+		branch, indent := "├── ", "│   "
+		if i == len(entries)-1 {
+			branch, indent = "└── ", "    "
+		}
+		line := clr(ansiGray, prefix+branch) + lsName(e)
+		if e.Type == "file" {
+			line += clr(ansiDim, " ("+formatBytes(e.Size)+")")
+		}
+		fmt.Fprintln(w, line)
+		if len(e.Children) > 0 {
+			writeLsTree(w, e.Children, prefix+indent)
+		}
+	}
+}
+
+type lsTotals struct {
+	Files    int   `json:"files"`
+	Dirs     int   `json:"dirs"`
+	Symlinks int   `json:"symlinks"`
+	Bytes    int64 `json:"bytes"`
+}
+
+func countLsEntries(entries []lsEntry) lsTotals {
+	var t lsTotals
+	for _, e := range entries {
+		switch e.Type {
+		case "file":
+			t.Files++
+			t.Bytes += e.Size
+		case "dir":
+			t.Dirs++
+		case "symlink":
+			t.Symlinks++
+		}
+		sub := countLsEntries(e.Children)
+		t.Files += sub.Files
+		t.Dirs += sub.Dirs
+		t.Symlinks += sub.Symlinks
+		t.Bytes += sub.Bytes
+	}
+	return t
+}
+
+func (t lsTotals) String() string {
+	return fmt.Sprintf("%d files, %d dirs, %d symlinks, %s", t.Files, t.Dirs, t.Symlinks, formatBytes(t.Bytes))
+}
+
+func cmdLs(args []string) error {
+	usage := fmt.Sprintf("Usage: %s ls [path] [-l] [-R | --tree] [-t | -S] [-r] [--total] [--json] [--key name]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("ls")
+	long := fs.Bool("l", false, "show mode, owner, size and modification time")
+	recursive := fs.Bool("R", false, "list subdirectories recursively")
+	tree := fs.Bool("tree", false, "draw the hierarchy as a tree")
+	byTime := fs.Bool("t", false, "sort by modification time, newest first")
+	bySize := fs.Bool("S", false, "sort by size, largest first")
+	reverse := fs.Bool("r", false, "reverse the sort order")
+	total := fs.Bool("total", false, "finish with a count of entries and bytes")
+	jsonOut := fs.Bool("json", false, "print entries as JSON")
+	key := fs.String("key", "", "filesystem key (defaults to the configured key)")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 1 {
+		return fmt.Errorf("unexpected arguments %v\n\n%s", pos[1:], usage)
+	}
+	if *byTime && *bySize {
+		return errors.New("-t and -S are mutually exclusive")
+	}
+	dir := "/"
+	if len(pos) == 1 {
+		dir = path.Clean("/" + pos[0])
+	}
+	opts := lsOptions{recursive: *recursive || *tree, reverse: *reverse}
+	switch {
+	case *byTime:
+		opts.sortBy = lsByTime
+	case *bySize:
+		opts.sortBy = lsBySize
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return err
+	}
+	fsKey := cfg.RedisKey
+	if *key != "" {
+		fsKey = *key
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	rdb := newRedisClient(cfg, 4)
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("cannot connect to Redis at %s: %w", cfg.RedisAddr, err)
+	}
+	fsClient := client.New(rdb, fsKey)
+
+	st, err := fsClient.Stat(ctx, dir)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		if dir == "/" {
+			return fmt.Errorf("no filesystem found at key %q on %s (db %d)", fsKey, cfg.RedisAddr, cfg.RedisDB)
+		}
+		return fmt.Errorf("%s: no such file or directory", dir)
+	}
+
+	var entries []lsEntry
+	if st.Type == "dir" {
+		if entries, err = listDir(ctx, fsClient, dir, opts); err != nil {
+			return err
+		}
+	} else {
+		e := lsEntry{Name: path.Base(dir), Path: dir, Type: st.Type, Mode: st.Mode, UID: st.UID, GID: st.GID, Size: st.Size, Mtime: time.UnixMilli(st.Mtime)}
+		if e.Type == "symlink" {
+			if e.Target, err = fsClient.Readlink(ctx, dir); err != nil {
+				return err
+			}
+		}
+		entries = []lsEntry{e}
+	}
+
+	if *jsonOut {
+		out := map[string]interface{}{"key": fsKey, "path": dir, "entries": entries}
+		if *total {
+			out["total"] = countLsEntries(entries)
+		}
+		b, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(b))
+		return nil
+	}
+
+	now := time.Now()
+	switch {
+	case *tree:
+		fmt.Println(clr(ansiBold+ansiBlue, dir))
+		writeLsTree(os.Stdout, entries, "")
+	case *recursive && st.Type == "dir":
+		writeLsRecursive(os.Stdout, dir, entries, *long, now)
+	case *long:
+		writeLsLong(os.Stdout, entries, now)
+	default:
+		writeLsShort(os.Stdout, entries)
+	}
+	if *total {
+		fmt.Printf("\n%s\n", clr(ansiDim, "total: "+countLsEntries(entries).String()))
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+)
+
+func lsFixture(t *testing.T) client.Client {
+	t.Helper()
+	rdb := testRedis(t)
+	fsClient := client.New(rdb, testKey(t, rdb))
+	if _, err := importDirectory(context.Background(), fsClient, writeFixtureTree(t), importOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	return fsClient
+}
+
+func lsNames(entries []lsEntry) string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestListDirSorting(t *testing.T) {
+	ctx := context.Background()
+	fsClient := lsFixture(t)
+
+	cases := []struct {
+		opts lsOptions
+		want string
+	}{
+		{lsOptions{}, "deep main.go run.sh"},
+		{lsOptions{reverse: true}, "run.sh main.go deep"},
+		{lsOptions{sortBy: lsBySize}, "main.go run.sh deep"},
+		{lsOptions{sortBy: lsBySize, reverse: true}, "deep run.sh main.go"},
+	}
+	for _, tc := range cases {
+		entries, err := listDir(ctx, fsClient, "/src", tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lsNames(entries); got != tc.want {
+			t.Errorf("%+v: %q, want %q", tc.opts, got, tc.want)
+		}
+	}
+
+	if err := fsClient.Utimens(ctx, "/src/run.sh", 0, time.Now().UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := listDir(ctx, fsClient, "/src", lsOptions{sortBy: lsByTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lsNames(entries); got != "run.sh deep main.go" {
+		t.Errorf("by time: %q", got)
+	}
+}
+
+func TestListDirLongAndTotals(t *testing.T) {
+	fsClient := lsFixture(t)
+	entries, err := listDir(context.Background(), fsClient, "/", lsOptions{recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tot := countLsEntries(entries); tot != (lsTotals{Files: 4, Dirs: 4, Symlinks: 1, Bytes: 36}) {
+		t.Fatalf("totals %+v", tot)
+	}
+
+	var buf bytes.Buffer
+	writeLsLong(&buf, entries, fixtureTime.Add(time.Hour))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("long listing:\n%s", buf.String())
+	}
+	for _, want := range []string{"-rw-r--r--", "8  " + lsTimestamp(fixtureTime, fixtureTime.Add(time.Hour)) + "  README.md"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("README line %q lacks %q", lines[0], want)
+		}
+	}
+	if !strings.HasPrefix(lines[1], "drwx------") {
+		t.Errorf("empty dir line %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "lrwxrwxrwx") || !strings.HasSuffix(lines[2], "link -> src/main.go") {
+		t.Errorf("symlink line %q", lines[2])
+	}
+	if lsTimestamp(fixtureTime, fixtureTime.AddDate(1, 0, 0)) != fixtureTime.Local().Format("Jan _2  2006") {
+		t.Error("old entries should show the year")
+	}
+}
+
+func TestLsTreeRendering(t *testing.T) {
+	fsClient := lsFixture(t)
+	entries, err := listDir(context.Background(), fsClient, "/", lsOptions{recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	writeLsTree(&buf, entries, "")
+	want := `├── README.md (8 B)
+├── empty
+├── link -> src/main.go
+└── src
+    ├── deep
+    │   └── er
+    │       └── blob.bin (5 B)
+    ├── main.go (13 B)
+    └── run.sh (10 B)
+`
+	if buf.String() != want {
+		t.Fatalf("tree:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestLsShortRendering(t *testing.T) {
+	fsClient := lsFixture(t)
+	entries, err := listDir(context.Background(), fsClient, "/", lsOptions{recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	writeLsRecursive(&buf, "/", entries, false, time.Now())
+	want := `/:
+README.md
+empty
+link
+src
+
+/empty:
+
+/src:
+deep
+main.go
+run.sh
+
+/src/deep:
+er
+
+/src/deep/er:
+blob.bin
+`
+	if buf.String() != want {
+		t.Fatalf("ls -R:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
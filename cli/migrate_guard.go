@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Migration source checks
+// ---------------------------------------------------------------------------
+//
+// A migration renames its source directory to an archive and mounts the
+// filesystem in its place, so anything rfs itself relies on that lives
+// under the source moves away with it: a mountpoint from an earlier setup,
+// the state directory, the config file, the logs, or the binaries the
+// config points at. Those are refused up front, naming the path in the
+// way. Migrating / or the home directory is refused unless asked for
+// explicitly.
+
+// broadSourceFlag lets a migration take / or the home directory.
+const broadSourceFlag = "i-know-what-im-doing"
+
+// pathWithin reports whether p is dir or lies beneath it. Both are
+// absolute.
+func pathWithin(p, dir string) bool {
+	p, dir = filepath.Clean(p), filepath.Clean(dir)
+	if p == dir || dir == "/" {
+		return true
+	}
+	return strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// realPath resolves symlinks in p where it exists, so that a path reached
+// through a link is compared by where it really is.
+func realPath(p string) string {
+	if r, err := filepath.EvalSymlinks(p); err == nil {
+		return r
+	}
+	if r, err := filepath.EvalSymlinks(filepath.Dir(p)); err == nil {
+		return filepath.Join(r, filepath.Base(p))
+	}
+	return filepath.Clean(p)
+}
+
+// migrateDependency is a path rfs needs to stay where it is.
+type migrateDependency struct {
+	what string
+	path string
+}
+
+// migrateDependencies lists the paths cfg and rfs itself rely on.
+func migrateDependencies(cfg config) []migrateDependency {
+	deps := []migrateDependency{
+		{"state directory", stateDir()},
+		{"config file", configPath()},
+		{"Redis log", cfg.RedisLog},
+		{"mount log", cfg.MountLog},
+		{"redis-server binary", cfg.RedisServerBin},
+		{"Redis module", cfg.ModulePath},
+		{"mount binary", cfg.MountBin},
+		{"NFS server binary", cfg.NFSBin},
+	}
+	if exe, err := os.Executable(); err == nil {
+		deps = append(deps, migrateDependency{"rfs binary", exe})
+	}
+	return deps
+}
+
+// checkMigrateSource refuses a source directory whose archiving would pull
+// something rfs depends on out from under cfg, the configuration in place
+// before the migration. allowBroad permits / and the home directory.
+func checkMigrateSource(src string, cfg config, allowBroad bool) error {
+	src = realPath(src)
+	if !allowBroad {
+		var what string
+		if src == "/" {
+			what = "the root directory"
+		} else if home, err := os.UserHomeDir(); err == nil && src == realPath(home) {
+			what = "your home directory"
+		}
+		if what != "" {
+			return fmt.Errorf("refusing to migrate %s: it is %s\nPass --%s to migrate it anyway", src, what, broadSourceFlag)
+		}
+	}
+
+	if cfg.Mountpoint != "" {
+		if mp := realPath(cfg.Mountpoint); mp != src && pathWithin(mp, src) {
+			return fmt.Errorf("cannot migrate %s: it contains the configured mountpoint %s\nArchiving it would move the mountpoint away; migrate %s itself, or another directory", src, mp, mp)
+		}
+	}
+	for _, dep := range migrateDependencies(cfg) {
+		if dep.path == "" {
+			continue
+		}
+		if p := realPath(dep.path); pathWithin(p, src) {
+			return fmt.Errorf("cannot migrate %s: it contains the %s %s\nMove it outside the directory first", src, dep.what, p)
+		}
+	}
+	return nil
+}
+
+// warnMountpointAncestor notes a source inside the configured mountpoint,
+// which the migration replaces as the mountpoint.
+func warnMountpointAncestor(out io.Writer, src string, cfg config) {
+	if cfg.Mountpoint == "" {
+		return
+	}
+	src, mp := realPath(src), realPath(cfg.Mountpoint)
+	if mp != src && pathWithin(src, mp) {
+		fmt.Fprintf(out, "  %s %s is inside the configured mountpoint %s, which will no longer be mounted\n", clr(ansiYellow, "!"), src, mp)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathWithin(t *testing.T) {
+	tests := []struct {
+		p, dir string
+		want   bool
+	}{
+		{"/home/u/projects/fs", "/home/u/projects", true},
+		{"/home/u/projects", "/home/u/projects", true},
+		{"/home/u/projects/", "/home/u/projects", true},
+		{"/home/u/projects2", "/home/u/projects", false},
+		{"/home/u/proj", "/home/u/projects", false},
+		{"/home/u", "/home/u/projects", false},
+		{"/etc", "/", true},
+		{"/home/u/projects/../other", "/home/u/projects", false},
+	}
+	for _, tt := range tests {
+		if got := pathWithin(tt.p, tt.dir); got != tt.want {
+			t.Errorf("pathWithin(%q, %q) = %v, want %v", tt.p, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMigrateSource(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	defer func(prev string) { cfgPathOverride = prev }(cfgPathOverride)
+	cfgPathOverride = filepath.Join(home, "etc", "rfs.config.json")
+
+	projects := filepath.Join(home, "projects")
+	for _, d := range []string{"projects/fs", "projects/app", "tools/bin", "etc"} {
+		if err := os.MkdirAll(filepath.Join(home, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A link to projects is judged by where it points.
+	link := filepath.Join(home, "work")
+	if err := os.Symlink(projects, link); err != nil {
+		t.Fatal(err)
+	}
+	base := config{
+		RedisLog: "/tmp/rfs-redis.log",
+		MountLog: "/tmp/rfs-mount.log",
+		MountBin: filepath.Join(home, "tools/bin/redis-fs-mount"),
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		cfg     func(c *config)
+		broad   bool
+		wantErr string
+	}{
+		{name: "unrelated directory", src: filepath.Join(projects, "app")},
+		{name: "mountpoint inside", src: projects, cfg: func(c *config) { c.Mountpoint = filepath.Join(projects, "fs") }, wantErr: "configured mountpoint"},
+		{name: "mountpoint through a link", src: link, cfg: func(c *config) { c.Mountpoint = filepath.Join(projects, "fs") }, wantErr: "configured mountpoint"},
+		{name: "the mountpoint itself", src: filepath.Join(projects, "fs"), cfg: func(c *config) { c.Mountpoint = filepath.Join(projects, "fs") }},
+		{name: "source inside the mountpoint", src: filepath.Join(projects, "app"), cfg: func(c *config) { c.Mountpoint = projects }},
+		{name: "binary inside", src: filepath.Join(home, "tools"), wantErr: "mount binary"},
+		{name: "log inside", src: filepath.Join(projects, "app"), cfg: func(c *config) { c.MountLog = filepath.Join(projects, "app", "mount.log") }, wantErr: "mount log"},
+		{name: "config inside", src: filepath.Join(home, "etc"), wantErr: "config file"},
+		{name: "home", src: home, wantErr: "your home directory"},
+		{name: "home allowed", src: home, broad: true, wantErr: "state directory"},
+		{name: "root", src: "/", wantErr: "root directory"},
+	}
+	for _, tt := range tests {
+		cfg := base
+		if tt.cfg != nil {
+			tt.cfg(&cfg)
+		}
+		err := checkMigrateSource(tt.src, cfg, tt.broad)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: err = %v, want one naming the %s", tt.name, err, tt.wantErr)
+		}
+	}
+}
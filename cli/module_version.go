@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// FS module version tracking
+// ---------------------------------------------------------------------------
+
+const (
+	fsModuleName       = "fs"
+	moduleVersionField = "module_version"
+)
+
+// minFSModuleVersion is the oldest fs module this rfs works with. A mount
+// binary that reports a newer one raises the bar for it.
+const minFSModuleVersion = 1
+
+// moduleVersions pairs the version of the fs module loaded in Redis with
+// the version recorded on the key by the last module that wrote it.
+// Zero means unknown: the module is not loaded, or the key predates
+// version tracking.
+type moduleVersions struct {
+	Loaded int64
+	Key    int64
+}
+
+func (v moduleVersions) upgraded() bool   { return v.Loaded > 0 && v.Key > 0 && v.Loaded > v.Key }
+func (v moduleVersions) downgraded() bool { return v.Loaded > 0 && v.Key > 0 && v.Loaded < v.Key }
+
+// readModuleVersions queries MODULE LIST and the key's info HASH. A server
+// that refuses MODULE LIST (ACLs, managed Redis) reports the module as
+// not loaded rather than failing startup.
+func readModuleVersions(ctx context.Context, rdb *redis.Client, fsKey string) (moduleVersions, error) {
+	var v moduleVersions
+	if loaded, err := loadedModuleVersion(ctx, rdb, fsModuleName); err == nil {
+		v.Loaded = loaded
+	}
+	raw, err := rdb.HGet(ctx, infoKey(fsKey), moduleVersionField).Result()
+	if err != nil && err != redis.Nil {
+		return v, err
+	}
+	if raw != "" {
+		v.Key, _ = strconv.ParseInt(raw, 10, 64)
+	}
+	return v, nil
+}
+
+// recordKeyModuleVersion stamps the key with the loaded module version.
+func recordKeyModuleVersion(ctx context.Context, rdb *redis.Client, fsKey string, version int64) error {
+	return rdb.HSet(ctx, infoKey(fsKey), moduleVersionField, version).Err()
+}
+
+// loadedModuleVersion returns the version of the named module, or 0 if it
+// is not loaded.
+func loadedModuleVersion(ctx context.Context, rdb *redis.Client, name string) (int64, error) {
+	mods, err := rdb.Do(ctx, "MODULE", "LIST").Slice()
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range mods {
+		fields := moduleFields(m)
+		if n, _ := fields["name"].(string); strings.EqualFold(n, name) {
+			return toInt64(fields["ver"]), nil
+		}
+	}
+	return 0, nil
+}
+
+// moduleFields normalizes a MODULE LIST entry, which is a flat name/value
+// array under RESP2 and a map under RESP3.
+func moduleFields(entry interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	switch e := entry.(type) {
+	case []interface{}:
+		for i := 0; i+1 < len(e); i += 2 {
+			if k, ok := e[i].(string); ok {
+				out[k] = e[i+1]
+			}
+		}
+	case map[interface{}]interface{}:
+		for k, val := range e {
+			if ks, ok := k.(string); ok {
+				out[ks] = val
+			}
+		}
+	}
+	return out
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	}
+	return 0
+}
+
+func formatModuleVersion(v int64) string {
+	if v <= 0 {
+		return "not loaded"
+	}
+	return fmt.Sprintf("fs v%d", v)
+}
+
+// printModuleUpgradeBox explains a version change between the module that
+// last wrote the key and the one now serving it.
+func printModuleUpgradeBox(fsKey string, v moduleVersions) {
+	if v.downgraded() {
+		printBox(clr(ansiYellow, "!")+" "+clr(ansiBold, "FS module is older than this key's data"), []boxRow{
+			{Label: "key", Value: fsKey},
+			{Label: "written by", Value: formatModuleVersion(v.Key)},
+			{Label: "loaded", Value: formatModuleVersion(v.Loaded)},
+			{},
+			{Label: "risk", Value: "newer on-disk features may be ignored or rejected"},
+			{Label: "fix", Value: clr(ansiCyan, "load a module at least as new as "+formatModuleVersion(v.Key))},
+		})
+		return
+	}
+	printBox(clr(ansiCyan, "i")+" "+clr(ansiBold, "FS module upgraded"), []boxRow{
+		{Label: "key", Value: fsKey},
+		{Label: "was", Value: formatModuleVersion(v.Key)},
+		{Label: "now", Value: formatModuleVersion(v.Loaded)},
+		{},
+		{Label: "data", Value: clr(ansiDim, "existing entries are upgraded lazily as they are written")},
+	})
+}
+
+// offerFSModule loads the fs module from cfg.ModulePath into a server that
+// lacks it, asking first on r unless yes is set. With no way to ask, or
+// when the server refuses (MODULE LOAD disabled, or the path missing on
+// its side), it says how to load the module by hand and goes on: the
+// filesystem works without it.
+func offerFSModule(ctx context.Context, rdb *redis.Client, cfg config, r *bufio.Reader, yes bool) error {
+	if cfg.ModulePath == "" {
+		return nil
+	}
+	if loaded, err := loadedModuleVersion(ctx, rdb, fsModuleName); err != nil || loaded > 0 {
+		return nil
+	}
+	path, err := expandPath(cfg.ModulePath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	manual := fmt.Sprintf("redis-cli MODULE LOAD %s", path)
+	if !yes {
+		if r == nil {
+			fmt.Printf("  %s The fs module is not loaded %s\n", clr(ansiYellow, "!"),
+				clr(ansiDim, "(up --yes loads it from "+path+", or run: "+manual+")"))
+			return nil
+		}
+		ok, err := promptYesNo(r, os.Stdout, "  The fs module is not loaded in Redis. Load it from "+path+"?", true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	s := startStep("Loading the fs module")
+	if err := rdb.Do(ctx, "MODULE", "LOAD", path).Err(); err != nil {
+		s.fail(err.Error())
+		fmt.Printf("  %s Load it by hand, or with loadmodule in redis.conf: %s\n", clr(ansiYellow, "!"), manual)
+		return nil
+	}
+	loaded, err := loadedModuleVersion(ctx, rdb, fsModuleName)
+	if err != nil || loaded == 0 {
+		s.fail("not listed by MODULE LIST afterwards")
+		return nil
+	}
+	s.succeed(formatModuleVersion(loaded))
+	return nil
+}
+
+// requiredModuleVersion is the oldest fs module cfg can mount with: the
+// newer of minFSModuleVersion and the version its mount binary reports.
+func requiredModuleVersion(cfg config) (version int64, by string) {
+	version, by = minFSModuleVersion, "rfs"
+	bin, _, err := mountBinaryFor(cfg)
+	if err != nil {
+		return version, by
+	}
+	if caps, err := mountCapabilitiesFor(bin); err == nil && caps.ModuleVersion > version {
+		version, by = caps.ModuleVersion, filepath.Base(bin)
+	}
+	return version, by
+}
+
+// checkModuleCompatible fails when the fs module loaded in Redis is older
+// than cfg needs. A server without the module passes: the filesystem
+// works without it.
+func checkModuleCompatible(cfg config, loaded int64) error {
+	required, by := requiredModuleVersion(cfg)
+	if loaded == 0 || loaded >= required {
+		return nil
+	}
+	return fmt.Errorf("fs module v%d is loaded in Redis but %s requires v%d\nRebuild it with 'make module', then load the new module/fs.so into Redis", loaded, by, required)
+}
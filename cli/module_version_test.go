@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestModuleFieldsRESP2AndRESP3(t *testing.T) {
+	resp2 := []interface{}{"name", "fs", "ver", int64(3), "path", "/x/fs.so", "args", []interface{}{}}
+	resp3 := map[interface{}]interface{}{"name": "fs", "ver": int64(3)}
+	for _, entry := range []interface{}{resp2, resp3} {
+		f := moduleFields(entry)
+		if f["name"] != "fs" || toInt64(f["ver"]) != 3 {
+			t.Errorf("moduleFields(%v) = %v", entry, f)
+		}
+	}
+}
+
+func TestModuleVersionsDirection(t *testing.T) {
+	cases := []struct {
+		v        moduleVersions
+		up, down bool
+	}{
+		{moduleVersions{Loaded: 2, Key: 1}, true, false},
+		{moduleVersions{Loaded: 1, Key: 2}, false, true},
+		{moduleVersions{Loaded: 2, Key: 2}, false, false},
+		{moduleVersions{Loaded: 0, Key: 2}, false, false},
+		{moduleVersions{Loaded: 2, Key: 0}, false, false},
+	}
+	for _, c := range cases {
+		if c.v.upgraded() != c.up || c.v.downgraded() != c.down {
+			t.Errorf("%+v: upgraded=%v downgraded=%v", c.v, c.v.upgraded(), c.v.downgraded())
+		}
+	}
+}
+
+func TestOfferFSModuleWhenServerRefusesModuleList(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer rdb.Close()
+	so := filepath.Join(t.TempDir(), "fs.so")
+	os.WriteFile(so, nil, 0o644)
+	cfg := config{ModulePath: so}
+	// Nothing to read: a prompt would fail with EOF.
+	r := bufio.NewReader(strings.NewReader(""))
+	if err := offerFSModule(context.Background(), rdb, cfg, r, false); err != nil {
+		t.Fatalf("server without MODULE LIST: %v", err)
+	}
+}
+
+func TestCheckModuleCompatible(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	bin := filepath.Join(t.TempDir(), "redis-fs-mount")
+	script := "#!/bin/sh\necho '{\"version\":\"redis-fs-mount (fs module v5)\",\"flags\":{\"redis\":true},\"module_version\":5}'\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{MountBackend: mountBackendFuse, MountBin: bin}
+
+	err := checkModuleCompatible(cfg, 3)
+	if err == nil || !strings.Contains(err.Error(), "fs module v3 is loaded in Redis but redis-fs-mount requires v5") {
+		t.Fatalf("older module: %v", err)
+	}
+	for _, loaded := range []int64{5, 6, 0} {
+		if err := checkModuleCompatible(cfg, loaded); err != nil {
+			t.Errorf("module v%d: %v", loaded, err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"os/exec"
@@ -23,6 +24,9 @@ const (
 type mountStartResult struct {
 	PID      int
 	Endpoint string
+	// exited receives the daemon's exit error if it exits while this
+	// process is still running; WaitForMount uses it to fail fast.
+	exited <-chan error
 }
 
 type mountBackend interface {
@@ -31,6 +35,9 @@ type mountBackend interface {
 	WaitForMount(cfg config, started mountStartResult, timeout time.Duration) error
 	IsMounted(mountpoint string) bool
 	Unmount(mountpoint string) error
+	// MountSource is the source column the mount table will show for a
+	// mount started with cfg; it is recorded so `down` can verify ownership.
+	MountSource(cfg config, started mountStartResult) string
 }
 
 func defaultMountBackend() string {
@@ -92,6 +99,21 @@ type fuseBackend struct{}
 
 func (f fuseBackend) Name() string { return mountBackendFuse }
 
+// fuseFSName is the per-key fsname passed to the FUSE daemon. Commas and
+// whitespace would split the mount option string, so they are replaced.
+func fuseFSName(fsKey string) string {
+	return "redis-fs:" + strings.Map(func(r rune) rune {
+		if r == ',' || r == ' ' || r == '\t' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, fsKey)
+}
+
+func (f fuseBackend) MountSource(cfg config, _ mountStartResult) string {
+	return fuseFSName(cfg.RedisKey)
+}
+
 func (f fuseBackend) Start(cfg config) (mountStartResult, error) {
 	if err := os.MkdirAll(filepathDir(cfg.MountLog), 0o755); err != nil {
 		return mountStartResult{}, err
@@ -102,42 +124,44 @@ func (f fuseBackend) Start(cfg config) (mountStartResult, error) {
 	}
 	defer logFile.Close()
 
-	args := []string{
-		"--redis", cfg.RedisAddr,
+	cmd, err := mountCommand(cfg.MountBin, fuseArgs(cfg))
+	if err != nil {
+		return mountStartResult{}, err
+	}
+	exited, err := startDetached(cmd, logFile)
+	if err != nil {
+		return mountStartResult{}, fmt.Errorf("start mount failed: %w", err)
+	}
+	return mountStartResult{PID: cmd.Process.Pid, exited: exited}, nil
+}
+
+// fuseArgs builds the FUSE daemon's argv. Its flag parser stops at the
+// first positional argument, so every option precedes the key and
+// mountpoint.
+func fuseArgs(cfg config) []string {
+	args := append(redisEndpointArgs(cfg),
 		"--db", strconv.Itoa(cfg.RedisDB),
 		"--foreground",
-		cfg.RedisKey,
-		cfg.Mountpoint,
+		"--fsname", fuseFSName(cfg.RedisKey),
+	)
+	if cfg.RedisUsername != "" {
+		args = append(args, "--username", cfg.RedisUsername)
 	}
 	if cfg.RedisPassword != "" {
-		args = append([]string{"--password", cfg.RedisPassword}, args...)
+		args = append(args, "--password", cfg.RedisPassword)
 	}
+	args = append(args, redisTLSArgs(cfg)...)
 	if cfg.ReadOnly {
-		args = append([]string{"--readonly"}, args...)
+		args = append(args, "--readonly")
 	}
 	if cfg.AllowOther {
-		args = append([]string{"--allow-other"}, args...)
-	}
-
-	cmd := exec.Command(cfg.MountBin, args...)
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
-	if devNull, err := os.Open(os.DevNull); err == nil {
-		defer devNull.Close()
-		cmd.Stdin = devNull
-	}
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
-
-	if err := cmd.Start(); err != nil {
-		return mountStartResult{}, fmt.Errorf("start mount failed: %w", err)
+		args = append(args, "--allow-other")
 	}
-	pid := cmd.Process.Pid
-	_ = cmd.Process.Release()
-	return mountStartResult{PID: pid}, nil
+	return append(args, cfg.RedisKey, cfg.Mountpoint)
 }
 
-func (f fuseBackend) WaitForMount(cfg config, _ mountStartResult, timeout time.Duration) error {
-	return waitForMountpoint(cfg.Mountpoint, timeout, f.IsMounted)
+func (f fuseBackend) WaitForMount(cfg config, started mountStartResult, timeout time.Duration) error {
+	return waitForMountpoint(cfg, started, timeout, f.IsMounted)
 }
 
 func (f fuseBackend) IsMounted(mountpoint string) bool {
@@ -145,12 +169,7 @@ func (f fuseBackend) IsMounted(mountpoint string) bool {
 }
 
 func (f fuseBackend) Unmount(mountpoint string) error {
-	for _, c := range [][]string{{"fusermount", "-u", mountpoint}, {"fusermount", "-uz", mountpoint}, {"umount", "-l", mountpoint}, {"umount", mountpoint}} {
-		if exec.Command(c[0], c[1:]...).Run() == nil {
-			return nil
-		}
-	}
-	return errors.New("all unmount commands failed")
+	return unmountWith(mountBackendFuse, mountpoint)
 }
 
 type nfsBackend struct{}
@@ -175,6 +194,26 @@ func (n nfsBackend) Start(cfg config) (mountStartResult, error) {
 	}
 	defer logFile.Close()
 
+	host := cfg.NFSHost
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	export := nfsExportPath(cfg.RedisKey)
+
+	cmd, err := mountCommand(cfg.NFSBin, nfsArgs(cfg))
+	if err != nil {
+		return mountStartResult{}, err
+	}
+	exited, err := startDetached(cmd, logFile)
+	if err != nil {
+		return mountStartResult{}, fmt.Errorf("start nfs gateway failed: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s:%s", host, export)
+	return mountStartResult{PID: cmd.Process.Pid, Endpoint: endpoint, exited: exited}, nil
+}
+
+// nfsArgs builds the NFS gateway's argv, options in a fixed order.
+func nfsArgs(cfg config) []string {
 	host := cfg.NFSHost
 	if host == "" {
 		host = "127.0.0.1"
@@ -183,38 +222,27 @@ func (n nfsBackend) Start(cfg config) (mountStartResult, error) {
 	if port <= 0 {
 		port = 20490
 	}
-	export := nfsExportPath(cfg.RedisKey)
-
-	args := []string{
-		"--redis", cfg.RedisAddr,
+	args := append(redisEndpointArgs(cfg),
 		"--db", strconv.Itoa(cfg.RedisDB),
 		"--listen", net.JoinHostPort(host, strconv.Itoa(port)),
-		"--export", export,
+		"--export", nfsExportPath(cfg.RedisKey),
 		"--foreground",
+	)
+	if cfg.RedisUsername != "" {
+		args = append(args, "--username", cfg.RedisUsername)
 	}
 	if cfg.RedisPassword != "" {
-		args = append([]string{"--password", cfg.RedisPassword}, args...)
+		args = append(args, "--password", cfg.RedisPassword)
 	}
+	args = append(args, redisTLSArgs(cfg)...)
 	if cfg.ReadOnly {
-		args = append([]string{"--readonly"}, args...)
-	}
-
-	cmd := exec.Command(cfg.NFSBin, args...)
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
-	if devNull, err := os.Open(os.DevNull); err == nil {
-		defer devNull.Close()
-		cmd.Stdin = devNull
+		args = append(args, "--readonly")
 	}
-	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return args
+}
 
-	if err := cmd.Start(); err != nil {
-		return mountStartResult{}, fmt.Errorf("start nfs gateway failed: %w", err)
-	}
-	pid := cmd.Process.Pid
-	_ = cmd.Process.Release()
-	endpoint := fmt.Sprintf("%s:%s", host, export)
-	return mountStartResult{PID: pid, Endpoint: endpoint}, nil
+func (n nfsBackend) MountSource(_ config, started mountStartResult) string {
+	return started.Endpoint
 }
 
 func (n nfsBackend) WaitForMount(cfg config, started mountStartResult, timeout time.Duration) error {
@@ -230,6 +258,9 @@ func (n nfsBackend) WaitForMount(cfg config, started mountStartResult, timeout t
 
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
+		if err := checkExited(cfg, started); err != nil {
+			return err
+		}
 		conn, err := net.DialTimeout("tcp", server, 250*time.Millisecond)
 		if err == nil {
 			_ = conn.Close()
@@ -240,10 +271,13 @@ func (n nfsBackend) WaitForMount(cfg config, started mountStartResult, timeout t
 
 	if !n.IsMounted(cfg.Mountpoint) {
 		if err := n.mountLocal(cfg, started.Endpoint); err != nil {
+			if exitErr := checkExited(cfg, started); exitErr != nil {
+				return exitErr
+			}
 			return err
 		}
 	}
-	return waitForMountpoint(cfg.Mountpoint, timeout, n.IsMounted)
+	return waitForMountpoint(cfg, started, timeout, n.IsMounted)
 }
 
 func (n nfsBackend) mountLocal(cfg config, endpoint string) error {
@@ -282,25 +316,117 @@ func (n nfsBackend) IsMounted(mountpoint string) bool {
 }
 
 func (n nfsBackend) Unmount(mountpoint string) error {
-	for _, c := range [][]string{{"umount", mountpoint}, {"umount", "-l", mountpoint}} {
-		if exec.Command(c[0], c[1:]...).Run() == nil {
-			return nil
-		}
+	return unmountWith(mountBackendNFS, mountpoint)
+}
+
+// startDetached starts a daemon in its own session with output going to
+// logFile, and reaps it in the background so an early exit is reported on
+// the returned channel instead of leaving a zombie.
+func startDetached(cmd *exec.Cmd, logFile *os.File) (<-chan error, error) {
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if devNull, err := os.Open(os.DevNull); err == nil {
+		defer devNull.Close()
+		cmd.Stdin = devNull
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
 	}
-	return errors.New("all unmount commands failed")
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	return exited, nil
 }
 
-func waitForMountpoint(mountpoint string, timeout time.Duration, mountedFn func(string) bool) error {
+// mountExitedError reports a mount daemon that exited before its mount
+// appeared, with the end of its log so the cause is visible.
+type mountExitedError struct {
+	Err     error
+	LogPath string
+	LogTail string
+}
+
+func (e *mountExitedError) Error() string {
+	status := "exited"
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(e.Err, &exitErr):
+		status = exitErr.ProcessState.String()
+	case e.Err == nil:
+		status = "exited with status 0"
+	}
+	msg := fmt.Sprintf("mount daemon %s before the mount appeared", status)
+	if e.LogTail != "" {
+		msg += fmt.Sprintf("\n\n  Last lines of %s:\n%s", e.LogPath, indentLines(e.LogTail, "    "))
+	}
+	return msg
+}
+
+// checkExited returns a *mountExitedError if the daemon has exited.
+func checkExited(cfg config, started mountStartResult) error {
+	select {
+	case err := <-started.exited:
+		return &mountExitedError{Err: err, LogPath: cfg.MountLog, LogTail: logTail(cfg.MountLog, 10)}
+	default:
+		return nil
+	}
+}
+
+// mountFailDetail is the short step detail for a WaitForMount error.
+func mountFailDetail(err error) string {
+	var exited *mountExitedError
+	if errors.As(err, &exited) {
+		return "mount daemon exited"
+	}
+	return "timeout"
+}
+
+func waitForMountpoint(cfg config, started mountStartResult, timeout time.Duration, mountedFn func(string) bool) error {
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
-		if mountedFn(mountpoint) {
+		if mountedFn(cfg.Mountpoint) {
 			return nil
 		}
+		if err := checkExited(cfg, started); err != nil {
+			return err
+		}
 		time.Sleep(150 * time.Millisecond)
 	}
 	return errors.New("timeout waiting for mount")
 }
 
+// logTail returns up to the last n non-empty lines of a log file.
+func logTail(path string, n int) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	const maxRead = 16 << 10
+	if info, err := f.Stat(); err == nil && info.Size() > maxRead {
+		_, _ = f.Seek(-maxRead, io.SeekEnd)
+	}
+	b, _ := io.ReadAll(f)
+	var lines []string
+	for _, ln := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(ln) != "" {
+			lines = append(lines, ln)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func indentLines(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, ln := range lines {
+		lines[i] = prefix + ln
+	}
+	return strings.Join(lines, "\n")
+}
+
 func mountTableContains(mountpoint string) bool {
 	_, ok := mountTableEntry(mountpoint)
 	return ok
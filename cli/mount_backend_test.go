@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFuseArgsOrdering(t *testing.T) {
+	base := config{RedisAddr: "localhost:6379", RedisDB: 2, RedisKey: "myfs", Mountpoint: "/mnt/rfs"}
+	for mask := 0; mask < 8; mask++ {
+		cfg := base
+		var want []string
+		want = append(want, "--redis", "localhost:6379", "--db", "2", "--foreground", "--fsname", "redis-fs:myfs")
+		if mask&1 != 0 {
+			cfg.RedisPassword = "pw"
+			want = append(want, "--password", "pw")
+		}
+		if mask&2 != 0 {
+			cfg.ReadOnly = true
+			want = append(want, "--readonly")
+		}
+		if mask&4 != 0 {
+			cfg.AllowOther = true
+			want = append(want, "--allow-other")
+		}
+		want = append(want, "myfs", "/mnt/rfs")
+
+		if got := fuseArgs(cfg); !reflect.DeepEqual(got, want) {
+			t.Errorf("mask %03b:\n got %q\nwant %q", mask, got, want)
+		}
+	}
+}
+
+func TestNFSArgsOrdering(t *testing.T) {
+	base := config{RedisAddr: "localhost:6379", RedisKey: "myfs", NFSPort: 2049}
+	for mask := 0; mask < 4; mask++ {
+		cfg := base
+		want := []string{"--redis", "localhost:6379", "--db", "0", "--listen", "127.0.0.1:2049", "--export", "/myfs", "--foreground"}
+		if mask&1 != 0 {
+			cfg.RedisPassword = "pw"
+			want = append(want, "--password", "pw")
+		}
+		if mask&2 != 0 {
+			cfg.ReadOnly = true
+			want = append(want, "--readonly")
+		}
+		if got := nfsArgs(cfg); !reflect.DeepEqual(got, want) {
+			t.Errorf("mask %02b:\n got %q\nwant %q", mask, got, want)
+		}
+	}
+}
+
+func TestWaitForMountFailsFastWhenDaemonExits(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "fake-mount")
+	script := "#!/bin/sh\necho 'flag provided but not defined: -bogus' >&2\nexit 2\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{
+		RedisAddr:  "localhost:6379",
+		RedisKey:   "myfs",
+		Mountpoint: filepath.Join(dir, "mnt"),
+		MountBin:   bin,
+		MountLog:   filepath.Join(dir, "mount.log"),
+	}
+
+	b := fuseBackend{}
+	started, err := b.Start(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Now()
+	err = b.WaitForMount(cfg, started, 10*time.Second)
+	if elapsed := time.Since(begin); elapsed > 3*time.Second {
+		t.Fatalf("WaitForMount took %v after the daemon exited", elapsed)
+	}
+	var exited *mountExitedError
+	if !errors.As(err, &exited) {
+		t.Fatalf("err = %v, want *mountExitedError", err)
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "exit status 2") || !strings.Contains(msg, "flag provided but not defined") {
+		t.Fatalf("error lacks the exit status or log tail:\n%s", msg)
+	}
+	if mountFailDetail(err) != "mount daemon exited" {
+		t.Fatalf("detail = %q", mountFailDetail(err))
+	}
+}
+
+func TestLogTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	var b strings.Builder
+	for i := 0; i < 30; i++ {
+		b.WriteString("line\n\n")
+	}
+	b.WriteString("last\n")
+	os.WriteFile(path, []byte(b.String()), 0o644)
+
+	got := strings.Split(logTail(path, 3), "\n")
+	if len(got) != 3 || got[2] != "last" {
+		t.Fatalf("logTail = %q", got)
+	}
+	if logTail(filepath.Join(t.TempDir(), "missing"), 3) != "" {
+		t.Fatal("missing log produced a tail")
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Mount binary handshake: which flags the installed daemon accepts
+// ---------------------------------------------------------------------------
+//
+// The CLI and the mount daemons are upgraded separately, and a daemon that
+// renamed a flag used to fail with a usage error buried in its log. Before
+// starting one, up asks the binary which flags it has (--capabilities if it
+// answers, else its --help text), spells each option the way that binary
+// does, and fails with the binary's version when an option the config needs
+// has no spelling it accepts. Probes are cached by the binary's path, size
+// and modification time.
+
+// mountFlag is one option rfs passes to a mount daemon.
+type mountFlag struct {
+	spellings  []string // flag names the daemons have used, preferred first
+	takesValue bool
+	// dropValue, for a flag with a value, is the daemons' default: a
+	// binary without the flag behaves the same when this is the value.
+	dropValue string
+	// optional flags only restate the daemons' default and are left out
+	// when the binary lacks them.
+	optional bool
+	need     string // the config setting that asks for the flag; empty when rfs always does
+}
+
+// mountFlags is the translation table, keyed by the spelling fuseArgs and
+// nfsArgs emit.
+var mountFlags = map[string]mountFlag{
+	"--redis":           {spellings: []string{"redis", "redis-addr"}, takesValue: true},
+	"--socket":          {spellings: []string{"socket", "redis-socket", "unix-socket"}, takesValue: true, need: "redisSocket"},
+	"--username":        {spellings: []string{"username", "redis-username", "user"}, takesValue: true, need: "redisUsername"},
+	"--password":        {spellings: []string{"password", "redis-password"}, takesValue: true, need: "redisPassword"},
+	"--password-env":    {spellings: []string{"password-env"}, takesValue: true, need: "redisPassword"},
+	"--db":              {spellings: []string{"db", "redis-db"}, takesValue: true, dropValue: "0", need: "redisDB"},
+	"--tls":             {spellings: []string{"tls"}, need: "redisTLS"},
+	"--tls-ca-cert":     {spellings: []string{"tls-ca-cert", "tls-cacert"}, takesValue: true, need: "redisTLSCACert"},
+	"--tls-cert":        {spellings: []string{"tls-cert"}, takesValue: true, need: "redisTLSCert"},
+	"--tls-key":         {spellings: []string{"tls-key"}, takesValue: true, need: "redisTLSKey"},
+	"--tls-skip-verify": {spellings: []string{"tls-skip-verify", "tls-insecure"}, need: "redisTLSSkipVerify"},
+	"--readonly":        {spellings: []string{"readonly", "read-only"}, need: "readOnly"},
+	"--allow-other":     {spellings: []string{"allow-other", "allow_other"}, need: "allowOther"},
+	"--foreground":      {spellings: []string{"foreground"}, optional: true},
+	"--fsname":          {spellings: []string{"fsname", "fs-name"}, takesValue: true},
+	"--listen":          {spellings: []string{"listen", "listen-addr"}, takesValue: true, need: "nfsHost and nfsPort"},
+	"--export":          {spellings: []string{"export", "export-path"}, takesValue: true},
+}
+
+// mountCapabilities is what a mount binary reports about itself.
+type mountCapabilities struct {
+	Version string          `json:"version,omitempty"`
+	Flags   map[string]bool `json:"flags"`
+	// ModuleVersion is the fs module version the binary was built for;
+	// zero when it does not say.
+	ModuleVersion int64 `json:"module_version,omitempty"`
+}
+
+func (c mountCapabilities) version() string {
+	if c.Version != "" {
+		return c.Version
+	}
+	return "unknown version"
+}
+
+// unsupportedMountFlagError reports a config option the installed mount
+// binary cannot be given.
+type unsupportedMountFlagError struct {
+	bin     string
+	version string
+	flag    string
+	need    string
+}
+
+func (e *unsupportedMountFlagError) Error() string {
+	name := filepath.Base(e.bin)
+	if e.need == "" {
+		return fmt.Sprintf("%s (%s) has no %s flag, which rfs always passes\nInstall a %s that matches this rfs, or point the config at one: %s",
+			name, e.version, e.flag, name, configPath())
+	}
+	return fmt.Sprintf("%s (%s) has no %s flag, which the %s setting needs\nInstall a %s that supports it, or change %s in %s",
+		name, e.version, e.flag, e.need, name, e.need, configPath())
+}
+
+// translateMountArgs respells the options in args, as built by fuseArgs or
+// nfsArgs, for a binary with caps. Options end at the first positional
+// argument; the rest pass through. Without any known flags, as when the
+// binary printed no usage, args are returned unchanged.
+func translateMountArgs(bin string, caps mountCapabilities, args []string) ([]string, error) {
+	if len(caps.Flags) == 0 {
+		return args, nil
+	}
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "--") {
+			return append(out, args[i:]...), nil
+		}
+		f, ok := mountFlags[a]
+		if !ok {
+			out = append(out, a)
+			continue
+		}
+		var value string
+		if f.takesValue && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		spelled := ""
+		for _, s := range f.spellings {
+			if caps.Flags[s] {
+				spelled = "--" + s
+				break
+			}
+		}
+		switch {
+		case spelled != "":
+			out = append(out, spelled)
+			if f.takesValue {
+				out = append(out, value)
+			}
+		case f.optional, f.takesValue && value == f.dropValue && f.dropValue != "":
+		default:
+			return nil, &unsupportedMountFlagError{bin: bin, version: caps.version(), flag: a, need: f.need}
+		}
+	}
+	return out, nil
+}
+
+// usageFlagRE matches a flag at the start of a usage line, as Go's flag
+// package and most other parsers print them.
+var usageFlagRE = regexp.MustCompile(`^\s+--?([A-Za-z0-9][A-Za-z0-9_.-]*)`)
+
+// parseUsageFlags extracts the flag names from --help output.
+func parseUsageFlags(usage string) map[string]bool {
+	flags := map[string]bool{}
+	for _, line := range strings.Split(usage, "\n") {
+		if m := usageFlagRE.FindStringSubmatch(line); m != nil {
+			flags[m[1]] = true
+		}
+	}
+	return flags
+}
+
+const mountProbeTimeout = 3 * time.Second
+
+// runMountProbe runs bin with args and returns what it printed, whatever
+// its exit status: flag parsers commonly exit non-zero after usage.
+func runMountProbe(bin string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mountProbeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, bin, args...).CombinedOutput()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%s %s did not finish within %v", bin, strings.Join(args, " "), mountProbeTimeout)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// probeMountBinary asks bin which flags it accepts. A binary without
+// --capabilities typically rejects it with its usage, which serves as well
+// as --help.
+func probeMountBinary(bin string) (mountCapabilities, error) {
+	out, err := runMountProbe(bin, "--capabilities")
+	if err != nil {
+		return mountCapabilities{}, err
+	}
+	var caps mountCapabilities
+	if json.Unmarshal([]byte(strings.TrimSpace(out)), &caps) == nil && len(caps.Flags) > 0 {
+		return caps, nil
+	}
+	caps = mountCapabilities{Flags: parseUsageFlags(out)}
+	if len(caps.Flags) == 0 {
+		if out, err = runMountProbe(bin, "--help"); err != nil {
+			return mountCapabilities{}, err
+		}
+		caps.Flags = parseUsageFlags(out)
+	}
+	delete(caps.Flags, "h")
+	delete(caps.Flags, "help")
+	if caps.Flags["version"] {
+		if v, err := runMountProbe(bin, "--version"); err == nil {
+			caps.Version = strings.TrimSpace(strings.SplitN(v, "\n", 2)[0])
+		}
+	}
+	return caps, nil
+}
+
+// mountProbeCachePath holds probe results across runs.
+func mountProbeCachePath() string {
+	return filepath.Join(stateDir(), "mount-probe.json")
+}
+
+// mountProbeEntry is a cached probe, valid while the binary's size and
+// modification time are unchanged.
+type mountProbeEntry struct {
+	Size    int64             `json:"size"`
+	ModTime time.Time         `json:"mod_time"`
+	Caps    mountCapabilities `json:"capabilities"`
+}
+
+// mountCapabilitiesFor returns bin's capabilities, probing it only when
+// the cache has nothing for its current size and modification time.
+func mountCapabilitiesFor(bin string) (mountCapabilities, error) {
+	info, err := os.Stat(bin)
+	if err != nil {
+		return mountCapabilities{}, err
+	}
+	cache := map[string]mountProbeEntry{}
+	if b, err := os.ReadFile(mountProbeCachePath()); err == nil {
+		_ = json.Unmarshal(b, &cache)
+	}
+	if e, ok := cache[bin]; ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+		return e.Caps, nil
+	}
+	caps, err := probeMountBinary(bin)
+	if err != nil {
+		return mountCapabilities{}, err
+	}
+	if len(caps.Flags) == 0 {
+		return caps, nil
+	}
+	cache[bin] = mountProbeEntry{Size: info.Size(), ModTime: info.ModTime(), Caps: caps}
+	for path := range cache {
+		if _, err := os.Stat(path); err != nil {
+			delete(cache, path)
+		}
+	}
+	if err := os.MkdirAll(stateDir(), 0o700); err == nil {
+		if b, err := json.MarshalIndent(cache, "", "  "); err == nil {
+			_ = os.WriteFile(mountProbeCachePath(), b, 0o600)
+		}
+	}
+	return caps, nil
+}
+
+// mountPasswordEnv carries the Redis password to a mount daemon that has
+// --password-env, so it does not show in ps as --password would.
+const mountPasswordEnv = "REDIS_FS_PASSWORD"
+
+// passwordViaEnv replaces --password in args with --password-env and
+// returns the environment entry that then holds the password. A binary
+// without --password-env is refused rather than shown the password on its
+// command line.
+func passwordViaEnv(bin string, caps mountCapabilities, args []string) ([]string, []string, error) {
+	if !hasMountPassword(args) {
+		return args, nil, nil
+	}
+	if !caps.Flags["password-env"] {
+		return nil, nil, fmt.Errorf("%s (%s) has no --password-env flag, and rfs will not pass the Redis password on its command line, where ps shows it\nRebuild it with: make mount",
+			filepath.Base(bin), caps.version())
+	}
+	out := make([]string, 0, len(args))
+	var env []string
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			return append(out, args[i:]...), env, nil
+		}
+		if args[i] == "--password" && i+1 < len(args) {
+			env = []string{mountPasswordEnv + "=" + args[i+1]}
+			out = append(out, "--password-env", mountPasswordEnv)
+			i++
+			continue
+		}
+		out = append(out, args[i])
+		if mountFlags[args[i]].takesValue && i+1 < len(args) {
+			i++
+			out = append(out, args[i])
+		}
+	}
+	return out, env, nil
+}
+
+// hasMountPassword reports whether args, as built by fuseArgs or nfsArgs,
+// carry a Redis password.
+func hasMountPassword(args []string) bool {
+	for i := 0; i < len(args) && strings.HasPrefix(args[i], "--"); i++ {
+		if args[i] == "--password" {
+			return true
+		}
+		if mountFlags[args[i]].takesValue {
+			i++
+		}
+	}
+	return false
+}
+
+// mountCommand is the command that starts the installed bin with args,
+// spelled for that binary, with the password passed out of sight of ps. A
+// binary that cannot be probed gets args as they are, and starting it
+// reports the problem, unless they hold a password.
+func mountCommand(bin string, args []string) (*exec.Cmd, error) {
+	caps, err := mountCapabilitiesFor(bin)
+	if err != nil {
+		if hasMountPassword(args) {
+			return nil, fmt.Errorf("cannot tell whether %s takes --password-env, so rfs will not pass it the Redis password: %w\nRebuild it with: make mount",
+				filepath.Base(bin), err)
+		}
+		return exec.Command(bin, args...), nil
+	}
+	args, env, err := passwordViaEnv(bin, caps, args)
+	if err != nil {
+		return nil, err
+	}
+	if args, err = translateMountArgs(bin, caps, args); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(bin, args...)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd, nil
+}
+
+// checkMountBinary fails before anything starts when the configured mount
+// binary cannot take the options cfg needs.
+func checkMountBinary(cfg config) error {
+	bin, args, err := mountBinaryFor(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = mountCommand(bin, args)
+	return err
+}
+
+// mountBinaryFor is the mount binary cfg's backend runs, with the
+// arguments rfs gives it.
+func mountBinaryFor(cfg config) (bin string, args []string, err error) {
+	name, err := normalizeMountBackend(cfg.MountBackend)
+	if err != nil {
+		return "", nil, err
+	}
+	if name == mountBackendNFS {
+		return cfg.NFSBin, nfsArgs(cfg), nil
+	}
+	return cfg.MountBin, fuseArgs(cfg), nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// goFlagUsage is how redis-fs-mount answers an unknown flag.
+const goFlagUsage = `flag provided but not defined: -capabilities
+Usage: redis-fs-mount [flags] <redis-key> <mountpoint>
+
+Mount a Redis FS filesystem via FUSE.
+
+Flags:
+  -allow-other
+    	Allow other users to access mount
+  -db int
+    	Redis database number
+  -foreground
+    	Run in foreground (default true)
+  -fsname string
+    	Mount source name shown in the mount table (default "redis-fs")
+  -password string
+    	Redis password
+  -readonly
+    	Mount read-only
+  -redis string
+    	Redis server address (default "localhost:6379")
+`
+
+func capsOf(flags ...string) mountCapabilities {
+	caps := mountCapabilities{Version: "v9.9.9", Flags: map[string]bool{}}
+	for _, f := range flags {
+		caps.Flags[f] = true
+	}
+	return caps
+}
+
+func TestParseUsageFlags(t *testing.T) {
+	got := parseUsageFlags(goFlagUsage)
+	want := map[string]bool{"allow-other": true, "db": true, "foreground": true, "fsname": true, "password": true, "readonly": true, "redis": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseUsageFlags = %v", got)
+	}
+}
+
+func TestTranslateMountArgs(t *testing.T) {
+	cfg := config{RedisAddr: "localhost:6379", RedisDB: 2, RedisKey: "myfs", Mountpoint: "/mnt/rfs", RedisPassword: "pw", ReadOnly: true, AllowOther: true}
+	current := capsOf("redis", "db", "foreground", "fsname", "password", "readonly", "allow-other")
+	renamed := capsOf("redis-addr", "redis-db", "fs-name", "redis-password", "read-only", "allow_other")
+
+	cases := []struct {
+		name    string
+		cfg     config
+		caps    mountCapabilities
+		want    []string
+		missing string // flag the error should name
+	}{
+		{
+			name: "current spellings pass through",
+			cfg:  cfg, caps: current,
+			want: fuseArgs(cfg),
+		},
+		{
+			name: "renamed flags are respelled and foreground dropped",
+			cfg:  cfg, caps: renamed,
+			want: []string{"--redis-addr", "localhost:6379", "--redis-db", "2", "--fs-name", "redis-fs:myfs",
+				"--redis-password", "pw", "--read-only", "--allow_other", "myfs", "/mnt/rfs"},
+		},
+		{
+			name: "no db flag is fine for db 0",
+			cfg:  config{RedisAddr: "localhost:6379", RedisKey: "myfs", Mountpoint: "/mnt/rfs"},
+			caps: capsOf("redis", "fsname"),
+			want: []string{"--redis", "localhost:6379", "--fsname", "redis-fs:myfs", "myfs", "/mnt/rfs"},
+		},
+		{name: "no db flag for db 2", cfg: cfg, caps: capsOf("redis", "fsname", "password", "readonly", "allow-other"), missing: "--db"},
+		{name: "no password flag", cfg: cfg, caps: capsOf("redis", "db", "fsname", "readonly", "allow-other"), missing: "--password"},
+		{name: "no allow-other flag", cfg: cfg, caps: capsOf("redis", "db", "fsname", "password", "readonly"), missing: "--allow-other"},
+		{
+			name: "unknown usage leaves args alone",
+			cfg:  cfg, caps: mountCapabilities{},
+			want: fuseArgs(cfg),
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := translateMountArgs("/opt/rfs/redis-fs-mount", tc.caps, fuseArgs(tc.cfg))
+			if tc.missing != "" {
+				var unsupported *unsupportedMountFlagError
+				if !errors.As(err, &unsupported) || unsupported.flag != tc.missing ||
+					!strings.Contains(err.Error(), "redis-fs-mount (v9.9.9)") {
+					t.Fatalf("err = %v, want one naming %s and the version", err, tc.missing)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %q, %v\nwant %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestMountCapabilitiesCached(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "redis-fs-mount")
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho x >> " + calls + "\ncat >&2 <<'EOF'\n" + goFlagUsage + "EOF\nexit 2\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	probes := func() int {
+		b, _ := os.ReadFile(calls)
+		return strings.Count(string(b), "x")
+	}
+
+	for i := 0; i < 2; i++ {
+		caps, err := mountCapabilitiesFor(bin)
+		if err != nil || !caps.Flags["readonly"] {
+			t.Fatalf("capabilities %+v, %v", caps, err)
+		}
+	}
+	if n := probes(); n != 1 {
+		t.Fatalf("binary probed %d times, want 1", n)
+	}
+
+	// An upgraded binary is probed again.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(bin, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mountCapabilitiesFor(bin); err != nil {
+		t.Fatal(err)
+	}
+	if n := probes(); n != 2 {
+		t.Fatalf("binary probed %d times after changing, want 2", n)
+	}
+}
+
+func TestPasswordViaEnv(t *testing.T) {
+	cfg := config{RedisAddr: "localhost:6379", RedisKey: "myfs", Mountpoint: "/mnt/rfs", RedisPassword: "s3cret"}
+	args := fuseArgs(cfg)
+
+	got, env, err := passwordViaEnv("redis-fs-mount", capsOf("redis", "db", "foreground", "fsname", "password", "password-env"), args)
+	if err != nil || strings.Contains(strings.Join(got, " "), "s3cret") || !strings.Contains(strings.Join(got, " "), "--password-env "+mountPasswordEnv) {
+		t.Fatalf("args %q, %v", got, err)
+	}
+	if !reflect.DeepEqual(env, []string{mountPasswordEnv + "=s3cret"}) || got[len(got)-2] != "myfs" {
+		t.Fatalf("env %q, args %q", env, got)
+	}
+
+	// An older binary is refused rather than given --password.
+	for _, caps := range []mountCapabilities{capsOf("redis", "db", "foreground", "fsname", "password"), {}} {
+		if _, _, err := passwordViaEnv("redis-fs-mount", caps, args); err == nil || !strings.Contains(err.Error(), "make mount") {
+			t.Fatalf("without --password-env: %v", err)
+		}
+	}
+
+	// Without a password there is nothing to hide.
+	cfg.RedisPassword = ""
+	args = fuseArgs(cfg)
+	if got, env, err := passwordViaEnv("redis-fs-mount", capsOf("redis", "db"), args); err != nil || env != nil || !reflect.DeepEqual(got, args) {
+		t.Fatalf("without a password: %q, %q, %v", got, env, err)
+	}
+
+	// Nor does a binary that cannot be probed get the password.
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	if _, err := mountCommand(filepath.Join(t.TempDir(), "missing"), fuseArgs(config{RedisKey: "k", Mountpoint: "/mnt", RedisPassword: "s3cret"})); err == nil {
+		t.Fatal("unprobed binary given a password")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mountInfoEntry is the subset of a /proc/self/mountinfo line needed to
+// identify who owns a mountpoint.
+type mountInfoEntry struct {
+	MountPoint string
+	FSType     string
+	Source     string
+}
+
+// parseMountInfo reads mountinfo(5) lines. Malformed lines are skipped.
+func parseMountInfo(r io.Reader) ([]mountInfoEntry, error) {
+	var entries []mountInfoEntry
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		entries = append(entries, mountInfoEntry{
+			MountPoint: unescapeMountField(fields[4]),
+			FSType:     fields[sep+1],
+			Source:     unescapeMountField(fields[sep+2]),
+		})
+	}
+	return entries, sc.Err()
+}
+
+// unescapeMountField decodes the \ooo octal escapes the kernel uses for
+// spaces, tabs, newlines and backslashes.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// findMountInfo returns the topmost mount at mountpoint; later lines shadow
+// earlier ones when filesystems are stacked.
+func findMountInfo(entries []mountInfoEntry, mountpoint string) (mountInfoEntry, bool) {
+	var found mountInfoEntry
+	ok := false
+	for _, e := range entries {
+		if e.MountPoint == mountpoint {
+			found, ok = e, true
+		}
+	}
+	return found, ok
+}
+
+// checkMountOwnership verifies that the mount at st.Mountpoint is the one
+// rfs created. It returns nil when ownership cannot be determined (no
+// mountinfo on this platform, or nothing mounted there).
+func checkMountOwnership(st state) error {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	entries, err := parseMountInfo(f)
+	if err != nil {
+		return nil
+	}
+
+	mp := st.Mountpoint
+	if resolved, err := filepath.EvalSymlinks(mp); err == nil {
+		mp = resolved
+	}
+	entry, ok := findMountInfo(entries, mp)
+	if !ok {
+		return nil
+	}
+	return mountEntryMatches(entry, st)
+}
+
+// mountEntryMatches reports why entry is not the mount recorded in st.
+func mountEntryMatches(entry mountInfoEntry, st state) error {
+	backend := st.MountBackend
+	if backend == "" {
+		backend = mountBackendFuse
+	}
+
+	switch backend {
+	case mountBackendFuse:
+		if entry.FSType != "fuse.redis-fs" {
+			return mountMismatch(entry, "fuse.redis-fs", st.MountSource)
+		}
+		// State written before sources were recorded only knows the
+		// generic name.
+		if st.MountSource == "" {
+			if !strings.HasPrefix(entry.Source, "redis-fs") {
+				return mountMismatch(entry, "fuse.redis-fs", "redis-fs")
+			}
+			return nil
+		}
+	case mountBackendNFS:
+		if !strings.HasPrefix(entry.FSType, "nfs") {
+			return mountMismatch(entry, "nfs", st.MountSource)
+		}
+		if st.MountSource == "" {
+			return nil
+		}
+	}
+	if entry.Source != st.MountSource {
+		return mountMismatch(entry, entry.FSType, st.MountSource)
+	}
+	return nil
+}
+
+func mountMismatch(entry mountInfoEntry, wantType, wantSource string) error {
+	want := wantType
+	if wantSource != "" {
+		want += " from " + wantSource
+	}
+	return fmt.Errorf("%s is now a %s mount of %q, not the redis-fs mount rfs created (expected %s)",
+		entry.MountPoint, entry.FSType, entry.Source, want)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleMountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+40 22 0:35 / /home/me/work rw,nosuid,nodev,relatime shared:20 - fuse.redis-fs redis-fs:myfs rw,user_id=1000,group_id=1000
+41 22 0:36 / /home/me/with\040space rw,relatime shared:21 - fuse.redis-fs redis-fs:a_b rw
+42 22 0:37 / /mnt/share rw,relatime shared:22 - nfs 127.0.0.1:/myfs rw,vers=3
+43 40 0:38 / /home/me/work rw,relatime shared:23 - nfs4 fileserver:/export rw
+garbage line
+`
+
+func TestParseMountInfo(t *testing.T) {
+	entries, err := parseMountInfo(strings.NewReader(sampleMountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("got %d entries, want 5: %+v", len(entries), entries)
+	}
+	e, ok := findMountInfo(entries, "/home/me/with space")
+	if !ok || e.FSType != "fuse.redis-fs" || e.Source != "redis-fs:a_b" {
+		t.Fatalf("escaped mountpoint: %+v %v", e, ok)
+	}
+	// The NFS share stacked over the redis-fs mount shadows it.
+	e, ok = findMountInfo(entries, "/home/me/work")
+	if !ok || e.FSType != "nfs4" {
+		t.Fatalf("stacked mount: %+v %v", e, ok)
+	}
+}
+
+func TestMountEntryMatches(t *testing.T) {
+	fuse := mountInfoEntry{MountPoint: "/m", FSType: "fuse.redis-fs", Source: "redis-fs:myfs"}
+	nfs := mountInfoEntry{MountPoint: "/m", FSType: "nfs", Source: "127.0.0.1:/myfs"}
+	other := mountInfoEntry{MountPoint: "/m", FSType: "nfs4", Source: "fileserver:/export"}
+
+	cases := []struct {
+		name  string
+		entry mountInfoEntry
+		st    state
+		ok    bool
+	}{
+		{"fuse exact", fuse, state{MountBackend: "fuse", MountSource: "redis-fs:myfs"}, true},
+		{"fuse other key", fuse, state{MountBackend: "fuse", MountSource: "redis-fs:other"}, false},
+		{"fuse legacy state", fuse, state{}, true},
+		{"fuse replaced by nfs", other, state{MountBackend: "fuse", MountSource: "redis-fs:myfs"}, false},
+		{"legacy replaced by nfs", other, state{}, false},
+		{"nfs exact", nfs, state{MountBackend: "nfs", MountSource: "127.0.0.1:/myfs"}, true},
+		{"nfs foreign share", other, state{MountBackend: "nfs", MountSource: "127.0.0.1:/myfs"}, false},
+	}
+	for _, c := range cases {
+		err := mountEntryMatches(c.entry, c.st)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: err = %v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestFuseFSNameIsOptionSafe(t *testing.T) {
+	if got := fuseFSName("a,b c"); got != "redis-fs:a_b_c" {
+		t.Fatalf("fuseFSName = %q", got)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// defaultMountpointPerm is used for newly created mountpoints when the
+// config does not set mountpointMode. The process umask still applies.
+const defaultMountpointPerm os.FileMode = 0o755
+
+// dirAttrs is the mode and ownership of a directory that is about to be
+// replaced by a mountpoint.
+type dirAttrs struct {
+	Mode os.FileMode
+	UID  int
+	GID  int
+}
+
+// parseMountpointMode parses an octal permission string such as "0700".
+func parseMountpointMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return defaultMountpointPerm, nil
+	}
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 0o7777 {
+		return 0, fmt.Errorf("invalid mountpointMode %q (expected octal permissions such as 0755)", s)
+	}
+	return fileModeFromUnix(uint32(v)), nil
+}
+
+func fileModeFromUnix(v uint32) os.FileMode {
+	m := os.FileMode(v & 0o777)
+	if v&syscall.S_ISUID != 0 {
+		m |= os.ModeSetuid
+	}
+	if v&syscall.S_ISGID != 0 {
+		m |= os.ModeSetgid
+	}
+	if v&syscall.S_ISVTX != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// captureDirAttrs records a directory's permission bits and owner.
+func captureDirAttrs(path string) (dirAttrs, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return dirAttrs{}, err
+	}
+	attrs := dirAttrs{Mode: info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky), UID: -1, GID: -1}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		attrs.UID = int(st.Uid)
+		attrs.GID = int(st.Gid)
+	}
+	return attrs, nil
+}
+
+// createMountpoint creates path (and parents) with perm filtered through
+// the umask. An existing directory is left as is.
+func createMountpoint(path string, perm os.FileMode) error {
+	if err := os.MkdirAll(path, perm); err != nil {
+		return fmt.Errorf("create mountpoint: %w", err)
+	}
+	return nil
+}
+
+// restoreDirAttrs applies captured attributes to a recreated directory.
+// Ownership changes need privileges; when they are refused the returned
+// error is a warning and the mode has still been applied.
+func restoreDirAttrs(path string, attrs dirAttrs) error {
+	if err := os.Chmod(path, attrs.Mode); err != nil {
+		return fmt.Errorf("restore mode %04o on %s: %w", attrs.Mode.Perm(), path, err)
+	}
+	if attrs.UID < 0 {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) == attrs.UID && int(st.Gid) == attrs.GID {
+		return nil
+	}
+	if err := os.Lchown(path, attrs.UID, attrs.GID); err != nil {
+		if errors.Is(err, syscall.EPERM) {
+			return fmt.Errorf("could not restore owner %d:%d on %s (run as root to preserve ownership)", attrs.UID, attrs.GID, path)
+		}
+		return fmt.Errorf("restore owner on %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestParseMountpointMode(t *testing.T) {
+	cases := map[string]os.FileMode{
+		"":     defaultMountpointPerm,
+		"0700": 0o700,
+		"750":  0o750,
+		"2770": 0o770 | os.ModeSetgid,
+	}
+	for in, want := range cases {
+		got, err := parseMountpointMode(in)
+		if err != nil || got != want {
+			t.Errorf("parseMountpointMode(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"rwx", "0899", "17777"} {
+		if _, err := parseMountpointMode(bad); err == nil {
+			t.Errorf("parseMountpointMode(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestRestoreDirAttrsAfterArchive(t *testing.T) {
+	old := syscall.Umask(0o022)
+	defer syscall.Umask(old)
+
+	root := t.TempDir()
+	src := filepath.Join(root, "private")
+	if err := os.Mkdir(src, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0o2750); err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := captureDirAttrs(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate the archive step and recreate the mountpoint.
+	if err := os.Rename(src, src+".archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMountpoint(src, attrs.Mode.Perm()); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreDirAttrs(src, attrs); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := captureDirAttrs(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != attrs {
+		t.Fatalf("recreated attrs %+v, want %+v", got, attrs)
+	}
+}
+
+func TestCreateMountpointRespectsUmask(t *testing.T) {
+	old := syscall.Umask(0o027)
+	defer syscall.Umask(old)
+
+	dir := filepath.Join(t.TempDir(), "mnt")
+	if err := createMountpoint(dir, 0o775); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o750 {
+		t.Fatalf("mode %04o, want 0750", perm)
+	}
+}
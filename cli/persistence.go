@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// Persistence of the managed Redis server
+// ---------------------------------------------------------------------------
+//
+// By default a managed redis-server keeps everything in memory, so a crash
+// loses every filesystem in it. The persistence setting makes it write
+// its data under dataDir: "rdb" snapshots once a minute when anything
+// changed, "aof" appends every write and fsyncs once a second. down stops
+// a persistent server with SHUTDOWN SAVE, so the last writes reach the
+// disk, rather than with SIGTERM alone.
+
+const (
+	persistenceNone = "none"
+	persistenceRDB  = "rdb"
+	persistenceAOF  = "aof"
+)
+
+// persistenceShutdownTimeout is how long down waits for a persistent
+// server to save and exit before it is signalled.
+const persistenceShutdownTimeout = 30 * time.Second
+
+// persistence is cfg's persistence setting, with empty meaning none.
+func (cfg config) persistence() string {
+	if cfg.Persistence == "" {
+		return persistenceNone
+	}
+	return cfg.Persistence
+}
+
+func checkPersistence(mode string) error {
+	switch mode {
+	case "", persistenceNone, persistenceRDB, persistenceAOF:
+		return nil
+	}
+	return fmt.Errorf("invalid persistence %q (expected none, rdb or aof)", mode)
+}
+
+// defaultDataDir is where a persistent managed server keeps its data
+// unless dataDir says otherwise; unlike /tmp it survives a reboot.
+func defaultDataDir() string {
+	return filepath.Join(stateDir(), "data")
+}
+
+// managedRedisDataFile is the RDB file the managed server for cfg writes:
+// under dataDir when it persists, else beside its pidfile.
+func (cfg config) managedRedisDataFile() string {
+	if cfg.persistence() == persistenceNone {
+		return "/tmp/" + cfg.managedRedisName() + ".rdb"
+	}
+	return filepath.Join(cfg.DataDir, cfg.managedRedisName()+".rdb")
+}
+
+// persistenceArgs are the redis-server arguments for cfg's persistence.
+// The append-only file is named after the port, like the RDB file, so
+// servers sharing a dataDir do not collide.
+func (cfg config) persistenceArgs() []string {
+	switch cfg.persistence() {
+	case persistenceRDB:
+		return []string{"--save", "60", "1", "--appendonly", "no"}
+	case persistenceAOF:
+		return []string{"--save", "", "--appendonly", "yes", "--appendfsync", "everysec",
+			"--appendfilename", cfg.managedRedisName() + ".aof"}
+	}
+	return []string{"--save", "", "--appendonly", "no"}
+}
+
+// aofFiles are the globs matching the append-only files of the server
+// whose RDB file is dataFile: one file before Redis 7, a directory of
+// them since.
+func aofFiles(dataFile string) []string {
+	dir := filepath.Dir(dataFile)
+	base := strings.TrimSuffix(filepath.Base(dataFile), ".rdb") + ".aof"
+	return []string{filepath.Join(dir, base), filepath.Join(dir, "appendonlydir", base+".*")}
+}
+
+// persistenceDetail describes, for status, how st's managed server keeps
+// its data.
+func persistenceDetail(st state) string {
+	switch st.RedisPersistence {
+	case persistenceRDB:
+		return "rdb, " + st.RedisDataFile
+	case persistenceAOF:
+		return "aof, in " + filepath.Dir(st.RedisDataFile)
+	}
+	return clr(ansiDim, "none (lost when Redis stops)")
+}
+
+// shutdownSave stops the managed server m with SHUTDOWN SAVE and waits for
+// it to exit. It reports false when the server could not be asked, or did
+// not exit in time, for the caller to fall back to a signal.
+func shutdownSave(m *managedRedis) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), persistenceShutdownTimeout)
+	defer cancel()
+	rdb := redis.NewClient(&redis.Options{Network: redisNetwork(m.Addr), Addr: m.Addr, Password: m.Password, MaxRetries: -1})
+	defer rdb.Close()
+	// The server closes the connection as it exits, so success shows as a
+	// connection error; only an error reply means it refused, as when the
+	// save fails.
+	var reply redis.Error
+	if err := rdb.ShutdownSave(ctx).Err(); errors.As(err, &reply) {
+		return false
+	}
+	for processAlive(m.PID) {
+		if ctx.Err() != nil {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
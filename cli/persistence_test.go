@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPersistenceArgs(t *testing.T) {
+	cfg := config{redisPort: 6390, DataDir: "/var/lib/rfs"}
+	if got := cfg.persistenceArgs(); !slices.Equal(got, []string{"--save", "", "--appendonly", "no"}) {
+		t.Errorf("none: %q", got)
+	}
+	if got := cfg.managedRedisDataFile(); got != "/tmp/rfs-6390.rdb" {
+		t.Errorf("none keeps its data file in /tmp, got %s", got)
+	}
+
+	cfg.Persistence = persistenceRDB
+	if got := strings.Join(cfg.persistenceArgs(), " "); got != "--save 60 1 --appendonly no" {
+		t.Errorf("rdb: %q", got)
+	}
+	if got := cfg.managedRedisDataFile(); got != "/var/lib/rfs/rfs-6390.rdb" {
+		t.Errorf("rdb data file: %s", got)
+	}
+
+	cfg.Persistence = persistenceAOF
+	if got := cfg.persistenceArgs(); !slices.Contains(got, "yes") || !slices.Contains(got, "rfs-6390.aof") {
+		t.Errorf("aof: %q", got)
+	}
+
+	if err := checkPersistence("always"); err == nil {
+		t.Error("checkPersistence accepted an unknown mode")
+	}
+}
+
+func TestPurgeDataRemovesAppendOnlyFiles(t *testing.T) {
+	dir := t.TempDir()
+	dataFile := filepath.Join(dir, "rfs-6390.rdb")
+	aofDir := filepath.Join(dir, "appendonlydir")
+	if err := os.Mkdir(aofDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{
+		dataFile,
+		filepath.Join(aofDir, "rfs-6390.aof.1.base.rdb"),
+		filepath.Join(aofDir, "rfs-6390.aof.manifest"),
+	}
+	other := filepath.Join(aofDir, "rfs-6391.aof.manifest")
+	for _, p := range append(files, other) {
+		if err := os.WriteFile(p, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := state{ManageRedis: true, RedisDataFile: dataFile, RedisPersistence: persistenceAOF}
+	if err := removeManagedRedisFiles(st, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range files {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s survived --purge-data", filepath.Base(p))
+		}
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("another port's append-only file was removed: %v", err)
+	}
+}
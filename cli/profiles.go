@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Profiles: named configs, each with its own state
+// ---------------------------------------------------------------------------
+//
+// `rfs --profile work up` uses profiles/work.json in the config directory
+// for its config, and keeps its state, state lock, daemon socket and daemon
+// log in profiles/work/ in the state directory, so profiles run side by
+// side without touching one another's PIDs. A config path in the profiles
+// directory, as a service unit or a spawned daemon is given, selects its
+// profile the same way. --config still wins over --profile for where the
+// config is read from.
+
+// cfgProfile is the --profile flag.
+var cfgProfile string
+
+var profileNameRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+func checkProfileName(name string) error {
+	if !profileNameRE.MatchString(name) || strings.HasSuffix(name, ".json") {
+		return fmt.Errorf("invalid profile name %q (use letters, digits, '.', '_' and '-')", name)
+	}
+	return nil
+}
+
+// profilesDir holds a config file per profile.
+func profilesDir() string {
+	return filepath.Join(configDir(), "profiles")
+}
+
+func profileConfigPath(name string) string {
+	return filepath.Join(profilesDir(), name+".json")
+}
+
+// activeProfile is the profile whose config configPath names, or "" for a
+// config outside the profiles directory.
+func activeProfile() string {
+	p, err := filepath.Abs(configPath())
+	if err != nil || filepath.Dir(p) != profilesDir() {
+		return ""
+	}
+	name := strings.TrimSuffix(filepath.Base(p), ".json")
+	if name == filepath.Base(p) || checkProfileName(name) != nil {
+		return ""
+	}
+	return name
+}
+
+// runDir holds the state and the daemon's socket and log: the state dir
+// itself, or the active profile's own directory in it.
+func runDir() string {
+	if name := activeProfile(); name != "" {
+		return filepath.Join(stateDir(), "profiles", name)
+	}
+	return stateDir()
+}
+
+// profileNames lists the profiles that have a config file.
+func profileNames() ([]string, error) {
+	entries, err := os.ReadDir(profilesDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if ok && !e.IsDir() && checkProfileName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// cmdProfiles lists the profiles with the key, Redis address and
+// mountpoint each one's config names.
+func cmdProfiles(args []string) error {
+	fs := newFlagSet("profiles")
+	usage := fmt.Sprintf("Usage: %s profiles", filepath.Base(os.Args[0]))
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 0 {
+		return errors.New(usage)
+	}
+	names, err := profileNames()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Printf("  %s No profiles yet %s\n", clr(ansiDim, "▸"),
+			clr(ansiDim, "(create one with '"+filepath.Base(os.Args[0])+" --profile <name> setup')"))
+		return nil
+	}
+
+	defer func(prev string) { cfgProfile = prev }(cfgProfile)
+	defer func(prev string) { cfgPathOverride = prev }(cfgPathOverride)
+	cfgPathOverride = ""
+	active := activeProfile()
+	var rows []boxRow
+	for _, name := range names {
+		cfgProfile = name
+		label := name
+		if name == active {
+			label = name + " *"
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			rows = append(rows, boxRow{Label: label, Value: clr(ansiRed, err.Error())})
+			continue
+		}
+		var mounts []string
+		for _, e := range cfg.filesystems() {
+			mounts = append(mounts, e.RedisKey+clr(ansiDim, " at ")+e.Mountpoint)
+		}
+		rows = append(rows, boxRow{Label: label, Value: cfg.RedisAddr + clr(ansiDim, " · ") + strings.Join(mounts, ", ")})
+	}
+	printBox(clr(ansiBold, "Profiles"), rows)
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProfilePaths(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(configEnv, "/tmp/env.json")
+	defer func(cfg, profile string) { cfgPathOverride, cfgProfile = cfg, profile }(cfgPathOverride, cfgProfile)
+	cfgPathOverride, cfgProfile = "", ""
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+	rfs := filepath.Join(home, ".local", "state", "rfs")
+
+	if statePath() != filepath.Join(rfs, "state.json") || activeProfile() != "" {
+		t.Fatalf("without a profile: state %s, profile %q", statePath(), activeProfile())
+	}
+
+	cfgProfile = "work"
+	if got := configPath(); got != filepath.Join(home, ".config", "rfs", "profiles", "work.json") || configSource() != "--profile work" {
+		t.Fatalf("profile config: %s (%s)", got, configSource())
+	}
+	workDir := filepath.Join(rfs, "profiles", "work")
+	if statePath() != filepath.Join(workDir, "state.json") || controlSocketPath() != filepath.Join(workDir, "rfs.sock") {
+		t.Fatalf("profile state %s, socket %s", statePath(), controlSocketPath())
+	}
+
+	// --config wins, and a path in the profiles directory still selects
+	// that profile's state, as for a service unit.
+	cfgPathOverride = "/tmp/other.json"
+	if configPath() != "/tmp/other.json" || activeProfile() != "" {
+		t.Fatalf("--config over --profile: %s, profile %q", configPath(), activeProfile())
+	}
+	cfgPathOverride, cfgProfile = profileConfigPath("home"), ""
+	if activeProfile() != "home" || runDir() != filepath.Join(rfs, "profiles", "home") {
+		t.Fatalf("--config naming a profile: %q, %s", activeProfile(), runDir())
+	}
+
+	for _, bad := range []string{"", "../x", "a/b", ".hidden", "x.json"} {
+		if checkProfileName(bad) == nil {
+			t.Errorf("profile name %q accepted", bad)
+		}
+	}
+}
+
+func TestProfileNames(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if names, err := profileNames(); err != nil || len(names) != 0 {
+		t.Fatalf("no profiles dir: %q, %v", names, err)
+	}
+	if err := os.MkdirAll(filepath.Join(profilesDir(), "work"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"work.json", "home.json", "notes.txt"} {
+		os.WriteFile(filepath.Join(profilesDir(), f), []byte("{}"), 0o600)
+	}
+	names, err := profileNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"home", "work"}) {
+		t.Fatalf("profiles %q, %v", names, err)
+	}
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+)
+
+// ---------------------------------------------------------------------------
+// reconcile — is the migration archive still needed?
+// ---------------------------------------------------------------------------
+//
+// Weeks after a migration the archive and the Redis key have drifted apart
+// in the ordinary way: files were edited, added, and deleted through the
+// mount. reconcile walks the archive and sorts each of its entries into
+// one of three piles by comparing it with the key and, when the key is
+// mounted, with the live mount:
+//
+//   - identical: the same in Redis as in the archive;
+//   - changed: present in Redis but edited since, which is expected;
+//   - anomalies: in the archive but missing from Redis, or read differently
+//     through the mount than from Redis, which is how data loss shows.
+//
+// Contents are compared by hashing a stratified sample of the files whose
+// size and modification time still match, or every file with --full. The
+// conclusion is recorded in the archive registry, where `archive rm`
+// checks it before deleting anything.
+
+const defaultReconcileSample = 50
+
+// reconcileMaxAge is how long a reconciliation stands before archive rm
+// asks for a fresh one.
+const reconcileMaxAge = 24 * time.Hour
+
+// Reconciliation verdicts.
+const (
+	verdictSafe       = "safe"        // every entry compared, none lost
+	verdictLikelySafe = "likely-safe" // no anomalies, but contents were sampled
+	verdictKeep       = "keep"        // anomalies found
+)
+
+type reconcileEntry struct {
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+}
+
+type reconcileReport struct {
+	Archive    string `json:"archive"`
+	Key        string `json:"key"`
+	Mountpoint string `json:"mountpoint,omitempty"` // set when the live mount was compared too
+	Full       bool   `json:"full"`
+
+	Entries   int              `json:"entries"`   // in the archive
+	Identical int              `json:"identical"` // of which unchanged in Redis
+	Hashed    int              `json:"hashed"`    // files whose contents were compared
+	Changed   []reconcileEntry `json:"changed"`
+	Anomalies []reconcileEntry `json:"anomalies"`
+	Added     int              `json:"added"` // entries in Redis the archive lacks
+
+	Verdict        string `json:"verdict"`
+	Recommendation string `json:"recommendation"`
+}
+
+// reconcileSummary is what the archive registry keeps of a report.
+type reconcileSummary struct {
+	At        time.Time `json:"at"`
+	Key       string    `json:"key"`
+	Verdict   string    `json:"verdict"`
+	Full      bool      `json:"full"`
+	Changed   int       `json:"changed"`
+	Anomalies int       `json:"anomalies"`
+}
+
+func (r *reconcileReport) summary(at time.Time) *reconcileSummary {
+	return &reconcileSummary{At: at, Key: r.Key, Verdict: r.Verdict, Full: r.Full, Changed: len(r.Changed), Anomalies: len(r.Anomalies)}
+}
+
+// reconcileOptions says what reconcileArchive compares.
+type reconcileOptions struct {
+	full       bool
+	sample     int
+	cipher     *fileCipher // for an encrypted filesystem
+	mountpoint string      // the key's live mount, or empty
+	rng        *rand.Rand
+	onProgress func(done, total int)
+}
+
+// reconcileArchive compares the archive at dir with the filesystem behind
+// fsClient, and the mount when one is given.
+func reconcileArchive(ctx context.Context, dir string, fsClient client.Client, opts reconcileOptions) (*reconcileReport, error) {
+	report := &reconcileReport{Archive: dir, Mountpoint: opts.mountpoint, Full: opts.full, Changed: []reconcileEntry{}, Anomalies: []reconcileEntry{}}
+
+	tree, err := listDir(ctx, fsClient, "/", lsOptions{recursive: true})
+	if err != nil {
+		return nil, err
+	}
+	inRedis := map[string]lsEntry{}
+	var flatten func([]lsEntry)
+	flatten = func(entries []lsEntry) {
+		for _, e := range entries {
+			inRedis[e.Path] = e
+			flatten(e.Children)
+		}
+	}
+	flatten(tree)
+
+	type archived struct {
+		rel   string
+		redis lsEntry
+		info  os.FileInfo
+	}
+	var candidates []smokeFile // files whose metadata still match
+	var files []archived
+	seen := map[string]bool{}
+	changed := func(rel, format string, args ...interface{}) {
+		report.Changed = append(report.Changed, reconcileEntry{rel, fmt.Sprintf(format, args...)})
+	}
+	anomaly := func(rel, format string, args ...interface{}) {
+		report.Anomalies = append(report.Anomalies, reconcileEntry{rel, fmt.Sprintf(format, args...)})
+	}
+
+	err = walkTree(dir, func(local, rel string, d os.DirEntry) error {
+		if rel == archiveSumsName || rel == archiveSumsPartial {
+			return nil
+		}
+		report.Entries++
+		p := "/" + filepath.ToSlash(rel)
+		seen[p] = true
+		info, err := os.Lstat(local)
+		if err != nil {
+			return err
+		}
+		kind := entryType(info.Mode())
+		e, ok := inRedis[p]
+		switch {
+		case !ok:
+			anomaly(rel, "missing from Redis")
+			return nil
+		case e.Type != kind:
+			changed(rel, "is a %s in Redis, a %s in the archive", e.Type, kind)
+			return nil
+		}
+		switch kind {
+		case "symlink":
+			target, err := os.Readlink(local)
+			if err != nil {
+				return err
+			}
+			if target != e.Target {
+				changed(rel, "points to %q, archive has %q", e.Target, target)
+			} else {
+				report.Identical++
+			}
+		case "dir":
+			report.Identical++
+		default:
+			files = append(files, archived{rel, e, info})
+			if opts.full {
+				break
+			}
+			if size := redisSize(e, opts.cipher); size != info.Size() {
+				changed(rel, "%s in Redis, %s in the archive", formatBytes(size), formatBytes(info.Size()))
+			} else if e.Mtime.UnixMilli() != info.ModTime().UnixMilli() {
+				changed(rel, "modified %s", e.Mtime.Local().Format(time.DateTime))
+			} else {
+				candidates = append(candidates, smokeFile{rel: rel, size: info.Size()})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for p := range inRedis {
+		if !seen[p] {
+			report.Added++
+		}
+	}
+
+	// Decide which files to hash: all of them with --full, otherwise a
+	// sample of those whose metadata still match; the rest of those count
+	// as identical on their metadata alone.
+	hash := map[string]bool{}
+	if opts.full {
+		for _, f := range files {
+			hash[f.rel] = true
+		}
+	} else {
+		for _, f := range pickSmokeFiles(candidates, opts.sample, opts.rng) {
+			hash[f.rel] = true
+		}
+		report.Identical += len(candidates) - len(hash)
+	}
+
+	done := 0
+	for _, f := range files {
+		if !hash[f.rel] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report.Hashed++
+		want, err := hashFile(filepath.Join(dir, f.rel))
+		if err != nil {
+			return nil, err
+		}
+		p := "/" + filepath.ToSlash(f.rel)
+		data, err := readContents(ctx, fsClient, opts.cipher, p)
+		if err != nil {
+			anomaly(f.rel, "unreadable in Redis: %v", err)
+			continue
+		}
+		got := fmt.Sprintf("%x", sha256.Sum256(data))
+		if got == want {
+			report.Identical++
+		} else {
+			changed(f.rel, "content differs from the archive")
+		}
+		if opts.mountpoint != "" {
+			if mounted, err := hashFile(filepath.Join(opts.mountpoint, f.rel)); err != nil {
+				anomaly(f.rel, "unreadable through the mount: %v", err)
+			} else if mounted != got {
+				anomaly(f.rel, "reads differently through the mount than from Redis")
+			}
+		}
+		done++
+		if opts.onProgress != nil {
+			opts.onProgress(done, len(hash))
+		}
+	}
+
+	// Everything found in Redis should look the same through the mount;
+	// hashed files were compared above.
+	if opts.mountpoint != "" {
+		for _, f := range files {
+			if hash[f.rel] {
+				continue
+			}
+			st, err := os.Lstat(filepath.Join(opts.mountpoint, f.rel))
+			switch {
+			case err != nil:
+				anomaly(f.rel, "missing through the mount: %v", err)
+			case st.Size() != f.redis.Size:
+				anomaly(f.rel, "%s through the mount, %s in Redis", formatBytes(st.Size()), formatBytes(f.redis.Size))
+			}
+		}
+	}
+
+	sort.Slice(report.Changed, func(i, j int) bool { return report.Changed[i].Path < report.Changed[j].Path })
+	sort.Slice(report.Anomalies, func(i, j int) bool { return report.Anomalies[i].Path < report.Anomalies[j].Path })
+	report.conclude(len(files))
+	return report, nil
+}
+
+// conclude sets the verdict and recommendation from the findings.
+func (r *reconcileReport) conclude(files int) {
+	bin := filepath.Base(os.Args[0])
+	switch {
+	case len(r.Anomalies) > 0:
+		r.Verdict = verdictKeep
+		r.Recommendation = fmt.Sprintf("Keep the archive: %d of its entries are missing from Redis or read wrongly through the mount", len(r.Anomalies))
+	case r.Full:
+		r.Verdict = verdictSafe
+		r.Recommendation = fmt.Sprintf("Safe to delete: every entry in the archive is in Redis (%d changed since)", len(r.Changed))
+	default:
+		r.Verdict = verdictLikelySafe
+		r.Recommendation = fmt.Sprintf("Probably safe to delete: nothing is missing, but only %d of %d files' contents were compared; run '%s reconcile --full' to be sure", r.Hashed, files, bin)
+	}
+}
+
+// entryType names a local file's type the way the FS client does.
+func entryType(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode.IsDir():
+		return "dir"
+	}
+	return "file"
+}
+
+// redisSize is the size of e's contents as the archive would have them,
+// taking off what encryption adds.
+func redisSize(e lsEntry, c *fileCipher) int64 {
+	if c == nil || e.Size == 0 {
+		return e.Size
+	}
+	return e.Size - c.overhead()
+}
+
+// defaultArchive finds the archive of fsKey: the one the running mount
+// came from, else the newest registered for the key.
+func defaultArchive(fsKey string) (string, error) {
+	if sts, err := loadState(); err == nil {
+		for _, name := range sts.names() {
+			if st := sts[name]; st.RedisKey == fsKey && st.ArchivePath != "" {
+				return st.ArchivePath, nil
+			}
+		}
+	}
+	var newest string
+	var at time.Time
+	err := withArchiveRegistry(func(reg archiveRegistry) error {
+		for dir, rec := range reg {
+			if rec.Key == fsKey && rec.CreatedAt.After(at) {
+				newest, at = dir, rec.CreatedAt
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if newest == "" {
+		return "", fmt.Errorf("no archive is recorded for key %q\nName it: %s reconcile <archive>", fsKey, filepath.Base(os.Args[0]))
+	}
+	return newest, nil
+}
+
+// recordReconcile stores the conclusion on dir's registry record.
+func recordReconcile(dir string, sum *reconcileSummary) error {
+	return withArchiveRegistry(func(reg archiveRegistry) error {
+		rec := reg[dir]
+		if rec == nil {
+			rec = &archiveRecord{Key: sum.Key, CreatedAt: time.Now().UTC()}
+			reg[dir] = rec
+		}
+		rec.Reconciled = sum
+		return nil
+	})
+}
+
+func cmdReconcile(args []string) error {
+	usage := fmt.Sprintf("Usage: %s reconcile [archive] [--key name] [--full | --sample n] [--json] [--key-file file | --key-command cmd]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("reconcile")
+	key := fs.String("key", "", "filesystem key (defaults to the archive's, else the configured key)")
+	full := fs.Bool("full", false, "compare the contents of every file")
+	sample := fs.Int("sample", defaultReconcileSample, "files whose contents are compared, when not --full")
+	jsonOut := fs.Bool("json", false, "print the report as JSON")
+	var kf keyFlags
+	kf.register(fs, false)
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 1 {
+		return fmt.Errorf("expected at most one archive\n\n%s", usage)
+	}
+	userCipher, err := kf.load()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	var dir string
+	var rec *archiveRecord
+	if len(pos) == 1 {
+		if dir, err = expandPath(pos[0]); err != nil {
+			return fmt.Errorf("invalid path: %w", err)
+		}
+		if rec, err = lookupArchive(dir); err != nil {
+			return err
+		}
+	}
+	keyOverride := *key
+	if keyOverride == "" && rec != nil {
+		keyOverride = rec.Key
+	}
+	cfg, rdb, fsKey, err := connectFilesystem(ctx, keyOverride)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	if dir == "" {
+		if dir, err = defaultArchive(fsKey); err != nil {
+			return err
+		}
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("cannot access %s: %w", dir, err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	c, err := cipherForKey(ctx, rdb, fsKey, userCipher)
+	if err != nil {
+		return err
+	}
+	fsClient := client.New(rdb, fsKey)
+	if st, err := fsClient.Stat(ctx, "/"); err != nil {
+		return err
+	} else if st == nil {
+		return fmt.Errorf("no filesystem found at key %q on %s (db %d)", fsKey, cfg.RedisAddr, cfg.RedisDB)
+	}
+
+	opts := reconcileOptions{full: *full, sample: *sample, cipher: c, rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	sts, err := loadState()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if st, ok := sts.forKey(cfg, fsKey); ok && st.MountPID > 0 && processAlive(st.MountPID) {
+		opts.mountpoint = st.Mountpoint
+	}
+
+	var step *uiStep
+	if !*jsonOut {
+		fmt.Println()
+		step = startStep("Reconciling " + dir)
+		opts.onProgress = func(done, total int) {
+			step.update(fmt.Sprintf("Reconciling · hashed %d of %d files", done, total))
+		}
+	}
+	report, err := reconcileArchive(ctx, dir, fsClient, opts)
+	if err != nil {
+		if step != nil {
+			step.fail(err.Error())
+		}
+		if ctx.Err() != nil {
+			return errors.New("reconcile interrupted")
+		}
+		return err
+	}
+	report.Key = fsKey
+	if err := recordReconcile(dir, report.summary(time.Now().UTC())); err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		b, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(b))
+	} else {
+		step.update("Reconciling " + dir)
+		if report.Verdict == verdictKeep {
+			step.fail(fmt.Sprintf("%d anomalies", len(report.Anomalies)))
+		} else {
+			step.succeed(fmt.Sprintf("%d entries", report.Entries))
+		}
+		printReconcileReport(report)
+	}
+	if report.Verdict == verdictKeep {
+		return fmt.Errorf("the archive holds data Redis does not; keep it")
+	}
+	return nil
+}
+
+func printReconcileReport(r *reconcileReport) {
+	const maxRows = 10
+	listRows := func(entries []reconcileEntry) []boxRow {
+		var rows []boxRow
+		for i, e := range entries {
+			if i == maxRows {
+				rows = append(rows, boxRow{Value: clr(ansiDim, fmt.Sprintf("… and %d more", len(entries)-maxRows))})
+				break
+			}
+			rows = append(rows, boxRow{Label: e.Path, Value: e.Problem})
+		}
+		return rows
+	}
+
+	compared := "key " + r.Key
+	if r.Mountpoint != "" {
+		compared += " and the mount at " + r.Mountpoint
+	}
+	rows := []boxRow{
+		{Label: "archive", Value: r.Archive},
+		{Label: "compared with", Value: compared},
+		{Label: "identical", Value: fmt.Sprintf("%d of %d entries (%d files hashed)", r.Identical, r.Entries, r.Hashed)},
+		{Label: "changed", Value: fmt.Sprintf("%d, edited in Redis since the migration", len(r.Changed))},
+		{Label: "anomalies", Value: fmt.Sprintf("%d", len(r.Anomalies))},
+		{Label: "added", Value: fmt.Sprintf("%d entries in Redis the archive lacks", r.Added)},
+	}
+	printBox(clr(ansiBold, "Archive reconciliation"), rows)
+	if len(r.Anomalies) > 0 {
+		printBox(clr(ansiBold, "Anomalies"), listRows(r.Anomalies))
+	}
+	if len(r.Changed) > 0 {
+		printBox(clr(ansiBold, "Changed since the migration"), listRows(r.Changed))
+	}
+
+	mark := clr(ansiGreen, "✓")
+	switch r.Verdict {
+	case verdictKeep:
+		mark = clr(ansiRed, "✗")
+	case verdictLikelySafe:
+		mark = clr(ansiYellow, "!")
+	}
+	fmt.Printf("  %s %s\n\n", mark, r.Recommendation)
+}
+
+// ---------------------------------------------------------------------------
+// archive rm
+// ---------------------------------------------------------------------------
+
+// checkArchiveRemovable decides from the latest reconciliation whether the
+// archive at dir may be deleted. A sampled reconciliation is allowed with
+// a warning for the caller to confirm.
+func checkArchiveRemovable(dir string, rec *archiveRecord, now time.Time) (warning string, err error) {
+	bin := filepath.Base(os.Args[0])
+	switch {
+	case rec == nil || rec.Reconciled == nil:
+		return "", fmt.Errorf("%s has not been reconciled with Redis\nRun '%s reconcile %s' first", dir, bin, dir)
+	case now.Sub(rec.Reconciled.At) > reconcileMaxAge:
+		return "", fmt.Errorf("%s was last reconciled %s ago\nRun '%s reconcile %s' again first", dir, formatDuration(now.Sub(rec.Reconciled.At)), bin, dir)
+	case rec.Reconciled.Verdict == verdictKeep:
+		return "", fmt.Errorf("%s holds %d entries that are missing from Redis or read wrongly through the mount\nRun '%s reconcile %s' to see them", dir, rec.Reconciled.Anomalies, bin, dir)
+	case rec.Reconciled.Verdict == verdictLikelySafe:
+		return "only a sample of its files' contents was compared with Redis", nil
+	}
+	return "", nil
+}
+
+func cmdArchiveRm(args []string) error {
+	usage := fmt.Sprintf("Usage: %s archive rm <path> [--yes] [--force]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("archive rm")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	force := fs.Bool("force", false, "delete without a clean reconciliation")
+	pos, err := parseInterspersed(fs, args)
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 1 {
+		return errors.New(usage)
+	}
+	dir, err := expandPath(pos[0])
+	if err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("cannot access %s: %w", dir, err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	sts, err := loadState()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, name := range sts.names() {
+		if st := sts[name]; st.Mountpoint != "" && pathWithin(realPath(st.Mountpoint), realPath(dir)) {
+			return fmt.Errorf("%s contains the mountpoint %s", dir, st.Mountpoint)
+		}
+	}
+
+	rec, err := lookupArchive(dir)
+	if err != nil {
+		return err
+	}
+	warning, err := checkArchiveRemovable(dir, rec, time.Now())
+	if err != nil {
+		if !*force {
+			return fmt.Errorf("%w\nPass --force to delete it anyway", err)
+		}
+		warning = err.Error()
+	}
+	if warning != "" {
+		warning, _, _ = strings.Cut(warning, "\n")
+		fmt.Printf("  %s %s: %s\n", clr(ansiYellow, "!"), dir, warning)
+	}
+	if !*yes {
+		ok, err := promptYesNo(bufio.NewReader(os.Stdin), os.Stdout, fmt.Sprintf("  Delete %s?", dir), false)
+		if err != nil || !ok {
+			return errors.New("archive rm cancelled")
+		}
+	}
+
+	step := startStep("Deleting " + dir)
+	if err := removeTree(dir); err != nil {
+		step.fail(err.Error())
+		return err
+	}
+	step.succeed("done")
+	return withArchiveRegistry(func(reg archiveRegistry) error {
+		delete(reg, dir)
+		return nil
+	})
+}
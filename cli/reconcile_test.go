@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+)
+
+func TestReconcileArchive(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	fsClient := client.New(rdb, testKey(t, rdb))
+	archive := writeFixtureTree(t)
+	if _, err := importDirectory(ctx, fsClient, archive, importOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	opts := reconcileOptions{sample: 2, rng: rand.New(rand.NewSource(1))}
+
+	report, err := reconcileArchive(ctx, archive, fsClient, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verdict != verdictLikelySafe || report.Identical != report.Entries || report.Hashed != 2 || report.Added != 0 {
+		t.Fatalf("untouched filesystem: %+v", report)
+	}
+	opts.full = true
+	if report, _ = reconcileArchive(ctx, archive, fsClient, opts); report.Verdict != verdictSafe || report.Hashed != 4 {
+		t.Fatalf("full: %+v", report)
+	}
+
+	// Edits and additions in Redis are expected; a file gone from Redis
+	// is not.
+	if err := fsClient.Echo(ctx, "/README.md", []byte("# edited\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsClient.Echo(ctx, "/new.txt", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = reconcileArchive(ctx, archive, fsClient, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verdict != verdictSafe || len(report.Changed) != 1 || report.Changed[0].Path != "README.md" || report.Added != 1 {
+		t.Fatalf("after edits: %+v", report)
+	}
+	if err := fsClient.Rm(ctx, "/src/main.go"); err != nil {
+		t.Fatal(err)
+	}
+	opts.full = false
+	report, err = reconcileArchive(ctx, archive, fsClient, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verdict != verdictKeep || len(report.Anomalies) != 1 || report.Anomalies[0].Path != filepath.Join("src", "main.go") {
+		t.Fatalf("after loss: %+v", report)
+	}
+}
+
+func TestCheckArchiveRemovable(t *testing.T) {
+	now := time.Now()
+	rec := func(verdict string, age time.Duration) *archiveRecord {
+		return &archiveRecord{Reconciled: &reconcileSummary{At: now.Add(-age), Verdict: verdict, Anomalies: 3}}
+	}
+	cases := []struct {
+		name    string
+		rec     *archiveRecord
+		warn    bool
+		refused string
+	}{
+		{"unregistered", nil, false, "has not been reconciled"},
+		{"never reconciled", &archiveRecord{}, false, "has not been reconciled"},
+		{"stale", rec(verdictSafe, 2*reconcileMaxAge), false, "last reconciled"},
+		{"anomalies", rec(verdictKeep, time.Minute), false, "3 entries"},
+		{"sampled", rec(verdictLikelySafe, time.Minute), true, ""},
+		{"full", rec(verdictSafe, time.Minute), false, ""},
+	}
+	for _, c := range cases {
+		warning, err := checkArchiveRemovable("/a.archive", c.rec, now)
+		switch {
+		case c.refused != "" && (err == nil || !strings.Contains(err.Error(), c.refused)):
+			t.Errorf("%s: err = %v, want one mentioning %q", c.name, err, c.refused)
+		case c.refused == "" && err != nil:
+			t.Errorf("%s: refused: %v", c.name, err)
+		case (warning != "") != c.warn:
+			t.Errorf("%s: warning %q", c.name, warning)
+		}
+	}
+}
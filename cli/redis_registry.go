@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// Registry of managed redis-server instances
+// ---------------------------------------------------------------------------
+//
+// Several profiles (config files) can point at the same managed port. The
+// registry in the state dir records each managed server once, keyed by
+// port or socket path, with the profiles using it: up adds its profile,
+// down removes it, and the server is stopped only when the last profile
+// lets go. It lives
+// apart from state.json so that losing one profile's state neither strands
+// the server nor lets another profile's down kill it.
+
+// managedRedis is one redis-server rfs started.
+type managedRedis struct {
+	PID       int       `json:"pid"`
+	Addr      string    `json:"addr"`
+	Pidfile   string    `json:"pidfile"`
+	DataFile  string    `json:"data_file"`
+	StartedAt time.Time `json:"started_at"`
+	Users     []string  `json:"users"`
+	MovedFrom int       `json:"moved_from,omitempty"` // the port asked for, when it was taken
+
+	// Persistence is "rdb" or "aof" for a server that saves its data,
+	// which is then stopped with SHUTDOWN SAVE.
+	Persistence string `json:"persistence,omitempty"`
+
+	// Password is the requirepass the server was started with; empty for
+	// servers started before managed ones had one. The registry is 0600.
+	Password string `json:"password,omitempty"`
+}
+
+// redisRegistry maps a port, or a socket path, to the managed server
+// listening on it; see managedRedisID.
+type redisRegistry map[string]*managedRedis
+
+func (m *managedRedis) addUser(profile string) {
+	for _, u := range m.Users {
+		if u == profile {
+			return
+		}
+	}
+	m.Users = append(m.Users, profile)
+	sort.Strings(m.Users)
+}
+
+func (m *managedRedis) removeUser(profile string) {
+	kept := m.Users[:0]
+	for _, u := range m.Users {
+		if u != profile {
+			kept = append(kept, u)
+		}
+	}
+	m.Users = kept
+}
+
+func redisRegistryPath() string {
+	return filepath.Join(stateDir(), "managed-redis.json")
+}
+
+// defaultBindAddress keeps a managed server off every other interface.
+const defaultBindAddress = "127.0.0.1"
+
+func managedRedisSecretPath() string {
+	return filepath.Join(stateDir(), "managed-redis.secret")
+}
+
+// managedRedisPassword is the password setup gives profiles that manage
+// their own Redis server. It is generated once, so that profiles sharing
+// a managed server agree on it, and kept 0600 in the state dir.
+func managedRedisPassword() (string, error) {
+	b, err := os.ReadFile(managedRedisSecretPath())
+	if err == nil && len(strings.TrimSpace(string(b))) > 0 {
+		return strings.TrimSpace(string(b)), nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	pwd := hex.EncodeToString(buf)
+	if err := os.MkdirAll(stateDir(), 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(managedRedisSecretPath(), []byte(pwd+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	return pwd, nil
+}
+
+// redisProfile identifies this invocation's profile in the registry: the
+// absolute path of its config file.
+func redisProfile() string {
+	p := configPath()
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// startManagedRedis and managedRedisPidfile are variables so tests can
+// stand in for a real redis-server.
+var (
+	startManagedRedis   = startRedisDaemon
+	managedRedisPidfile = configGetPidfile
+)
+
+// configGetPidfile asks the server at addr which pidfile it writes,
+// authenticating with password when the server was started with one.
+func configGetPidfile(ctx context.Context, addr, password string) (string, error) {
+	rdb := redis.NewClient(&redis.Options{Network: redisNetwork(addr), Addr: addr, Password: password, MaxRetries: -1})
+	defer rdb.Close()
+	vals, err := rdb.ConfigGet(ctx, "pidfile").Result()
+	if err != nil {
+		return "", err
+	}
+	return vals["pidfile"], nil
+}
+
+// identifyManagedRedis checks that m is still the server rfs started
+// before anything signals it: the process is alive, its pidfile names it,
+// and the server on its port reports writing that same pidfile. A PID that
+// was recycled, or a server someone else started on the port, fails.
+func identifyManagedRedis(m *managedRedis) error {
+	if !processAlive(m.PID) {
+		return fmt.Errorf("pid %d is not running", m.PID)
+	}
+	b, err := os.ReadFile(m.Pidfile)
+	if err != nil {
+		return fmt.Errorf("read pidfile: %w", err)
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err != nil || pid != m.PID {
+		return fmt.Errorf("pidfile %s does not name pid %d", m.Pidfile, m.PID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	got, err := managedRedisPidfile(ctx, m.Addr, m.Password)
+	if err != nil {
+		return fmt.Errorf("CONFIG GET pidfile on %s: %w", m.Addr, err)
+	}
+	if got != m.Pidfile {
+		return fmt.Errorf("the server on %s writes pidfile %q, not %q", m.Addr, got, m.Pidfile)
+	}
+	return nil
+}
+
+// withRedisRegistry runs fn on the registry under an exclusive lock and
+// saves what fn leaves behind, unless it fails.
+func withRedisRegistry(fn func(reg redisRegistry) error) error {
+	if err := os.MkdirAll(stateDir(), 0o700); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(redisRegistryPath()+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock managed Redis registry: %w", err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	reg := redisRegistry{}
+	b, err := os.ReadFile(redisRegistryPath())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(b, &reg); err != nil {
+			return fmt.Errorf("parse %s: %w", redisRegistryPath(), err)
+		}
+	}
+	if err := fn(reg); err != nil {
+		return err
+	}
+	if len(reg) == 0 {
+		if err := os.Remove(redisRegistryPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	out, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := redisRegistryPath() + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, redisRegistryPath())
+}
+
+// acquireManagedRedis registers profile as a user of the managed server on
+// cfg's port or socket, starting one unless a running server there is
+// identified as ours. It returns the server's PID and how many other
+// profiles share it.
+//
+// When the port is taken by a server that is not ours, a free port is
+// used instead and cfg's address is rewritten to it for this run, unless
+// the port was pinned with up --port. A server moved that way is recorded
+// with the port asked for, so other profiles asking for it join it. A
+// socket that is taken is an error.
+func acquireManagedRedis(cfg *config, profile string) (pid, others int, err error) {
+	err = withRedisRegistry(func(reg redisRegistry) error {
+		id, err := managedRedisID(cfg.RedisAddr)
+		if err != nil {
+			return err
+		}
+		if m := reg[id]; m != nil {
+			if identifyManagedRedis(m) == nil {
+				if err := m.checkPassword(*cfg); err != nil {
+					return err
+				}
+				m.addUser(profile)
+				pid, others = m.PID, len(m.Users)-1
+				return nil
+			}
+			// It died or was replaced; whatever is there now is not ours.
+			delete(reg, id)
+		}
+		if isSocketAddr(cfg.RedisAddr) {
+			if socketInUse(cfg.RedisAddr) {
+				return fmt.Errorf("another process already listens on %s\nStop it, or set redisSocket to another path", cfg.RedisAddr)
+			}
+			return startAndRegister(reg, cfg, profile, 0, &pid)
+		}
+		requested := cfg.redisPort
+		if !cfg.redisPortPinned {
+			if port, m := reg.movedFrom(requested); m != nil {
+				if err := m.checkPassword(*cfg); err != nil {
+					return err
+				}
+				m.addUser(profile)
+				pid, others = m.PID, len(m.Users)-1
+				cfg.setRedisPort(port)
+				return nil
+			}
+		}
+		if portInUse(cfg.redisHost, requested) {
+			if cfg.redisPortPinned {
+				return fmt.Errorf("port %d is already in use by another process\nFree it, or pick another with --port", requested)
+			}
+			port, err := freePort(cfg.redisHost)
+			if err != nil {
+				return fmt.Errorf("port %d is already in use, and no free port was found: %w", requested, err)
+			}
+			cfg.setRedisPort(port)
+		}
+		movedFrom := 0
+		if cfg.redisPort != requested {
+			movedFrom = requested
+		}
+		return startAndRegister(reg, cfg, profile, movedFrom, &pid)
+	})
+	return pid, others, err
+}
+
+// startAndRegister starts the managed server for cfg, with profile as its
+// only user, and records it in reg. Called with the registry locked.
+func startAndRegister(reg redisRegistry, cfg *config, profile string, movedFrom int, pid *int) error {
+	started, err := startManagedRedis(*cfg)
+	if err != nil {
+		return err
+	}
+	m := &managedRedis{PID: started, Addr: cfg.RedisAddr, StartedAt: time.Now().UTC(), Users: []string{profile}, Password: cfg.RedisPassword, MovedFrom: movedFrom}
+	m.Pidfile = cfg.managedRedisPidfile()
+	m.DataFile = cfg.managedRedisDataFile()
+	if cfg.persistence() != persistenceNone {
+		m.Persistence = cfg.persistence()
+	}
+	id, err := managedRedisID(cfg.RedisAddr)
+	if err != nil {
+		return err
+	}
+	reg[id] = m
+	*pid = started
+	return nil
+}
+
+// checkPassword refuses to let cfg join m when they disagree on the
+// password, as when cfg was set up again while m kept running.
+func (m *managedRedis) checkPassword(cfg config) error {
+	if m.Password == cfg.RedisPassword {
+		return nil
+	}
+	return fmt.Errorf("the managed Redis server on %s was started with a different password (used by %s)\nRun '%s down' for those profiles first, so it restarts with this one", m.Addr, strings.Join(m.Users, ", "), filepath.Base(os.Args[0]))
+}
+
+// movedFrom finds the running managed server that was moved off port
+// because it was taken, and the port it listens on instead.
+func (reg redisRegistry) movedFrom(port int) (int, *managedRedis) {
+	for id, m := range reg {
+		p, err := strconv.Atoi(id)
+		if err == nil && m.MovedFrom == port && identifyManagedRedis(m) == nil {
+			return p, m
+		}
+	}
+	return 0, nil
+}
+
+// portInUse reports whether something already listens on host:port. It is
+// a variable so tests can stand in for the probe.
+var portInUse = func(host string, port int) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return true
+	}
+	ln.Close()
+	return false
+}
+
+// freePort asks the kernel for a port on host that nothing listens on.
+func freePort(host string) (int, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// redisRelease reports what releasing a managed server did.
+type redisRelease struct {
+	PID       int
+	Remaining int   // profiles still using the server, which was left running
+	Stopped   bool  // the server was identified and stopped
+	Refused   error // why a live server was left running instead of signalled
+}
+
+// releaseManagedRedis removes profile from the users of the managed server
+// st records and stops the server if no profile is left. A server missing
+// from the registry, as one started before it existed, is taken from st.
+// Nothing is signalled unless identifyManagedRedis passes.
+func releaseManagedRedis(st state, profile string) (redisRelease, error) {
+	id, err := managedRedisID(st.RedisAddr)
+	if err != nil {
+		return redisRelease{}, err
+	}
+	var rel redisRelease
+	err = withRedisRegistry(func(reg redisRegistry) error {
+		m := reg[id]
+		if m == nil {
+			m = &managedRedis{PID: st.RedisPID, Addr: st.RedisAddr, Pidfile: st.RedisPidfile, DataFile: st.RedisDataFile}
+			if st.RedisPersistence != persistenceNone {
+				m.Persistence = st.RedisPersistence
+			}
+		}
+		rel = stopIfUnused(reg, id, m, profile)
+		return nil
+	})
+	return rel, err
+}
+
+// releaseOrphanedRedis drops profile from every registry entry. It
+// recovers references whose state file is gone, stopping servers that no
+// profile uses any more.
+func releaseOrphanedRedis(profile string) ([]redisRelease, error) {
+	var rels []redisRelease
+	err := withRedisRegistry(func(reg redisRegistry) error {
+		ids := make([]string, 0, len(reg))
+		for id := range reg {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			m := reg[id]
+			held := false
+			for _, u := range m.Users {
+				held = held || u == profile
+			}
+			if held {
+				rels = append(rels, stopIfUnused(reg, id, m, profile))
+			}
+		}
+		return nil
+	})
+	return rels, err
+}
+
+// stopIfUnused drops profile from m and, once no profile uses it, removes
+// m from the registry and stops the server if it is still ours. Called
+// with the registry locked.
+func stopIfUnused(reg redisRegistry, id string, m *managedRedis, profile string) redisRelease {
+	rel := redisRelease{PID: m.PID}
+	m.removeUser(profile)
+	if len(m.Users) > 0 {
+		rel.Remaining = len(m.Users)
+		return rel
+	}
+	delete(reg, id)
+	if !processAlive(m.PID) {
+		return rel
+	}
+	if err := identifyManagedRedis(m); err != nil {
+		rel.Refused = err
+		return rel
+	}
+	if m.Persistence == "" || !shutdownSave(m) {
+		_ = terminatePID(m.PID, 2*time.Second)
+	}
+	rel.Stopped = true
+	return rel
+}
+
+// reportRedisRelease prints the outcome of releasing a managed server.
+func reportRedisRelease(rel redisRelease) {
+	switch {
+	case rel.Remaining > 0:
+		s := startStep("Releasing Redis server")
+		s.succeed(fmt.Sprintf("pid %d still used by %d other profile(s)", rel.PID, rel.Remaining))
+	case rel.Refused != nil:
+		fmt.Printf("  %s left Redis pid %d running: it no longer looks like the server rfs started (%v)\n", clr(ansiYellow, "!"), rel.PID, rel.Refused)
+	case rel.Stopped:
+		s := startStep("Stopping Redis server")
+		s.succeed(fmt.Sprintf("pid %d", rel.PID))
+	}
+}
+
+// warnRedisPortMoved says so when acquireManagedRedis had to move the
+// server off the requested port.
+func warnRedisPortMoved(requested int, cfg config) {
+	if cfg.redisPort != requested {
+		fmt.Printf("  %s Port %d is in use by another process; managed Redis listens on %s for this run\n", clr(ansiYellow, "!"), requested, cfg.RedisAddr)
+	}
+}
+
+func managedRedisDetail(pid, others int) string {
+	if others > 0 {
+		return fmt.Sprintf("pid %d, shared with %d other profile(s)", pid, others)
+	}
+	return fmt.Sprintf("pid %d", pid)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// fakeManagedRedis stands in for redis-server: starting runs a sleep
+// process and writes its pidfile, and CONFIG GET pidfile answers with
+// *reported, which starts out as the pidfile a managed server would write.
+func fakeManagedRedis(t *testing.T, port int) (cfg config, starts *int, reported *string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	cfg = config{RedisAddr: fmt.Sprintf("127.0.0.1:%d", port), redisPort: port}
+	pidfile := cfg.managedRedisPidfile()
+	starts, reported = new(int), &pidfile
+
+	origStart, origPidfile := startManagedRedis, managedRedisPidfile
+	t.Cleanup(func() {
+		startManagedRedis, managedRedisPidfile = origStart, origPidfile
+		os.Remove(pidfile)
+	})
+	startManagedRedis = func(c config) (int, error) {
+		pidfile := c.managedRedisPidfile()
+		t.Cleanup(func() { os.Remove(pidfile) })
+		cmd := exec.Command("sleep", "60")
+		if err := cmd.Start(); err != nil {
+			return 0, err
+		}
+		go cmd.Wait()
+		t.Cleanup(func() { cmd.Process.Kill() })
+		*starts++
+		pid := cmd.Process.Pid
+		return pid, os.WriteFile(pidfile, []byte(fmt.Sprintf("%d\n", pid)), 0o600)
+	}
+	managedRedisPidfile = func(context.Context, string, string) (string, error) {
+		return *reported, nil
+	}
+	return cfg, starts, reported
+}
+
+func stateFor(cfg config, pid int) state {
+	return state{ManageRedis: true, RedisAddr: cfg.RedisAddr, RedisPID: pid, RedisPidfile: cfg.managedRedisPidfile(), RedisDataFile: cfg.managedRedisDataFile()}
+}
+
+func TestManagedRedisSharedByTwoProfiles(t *testing.T) {
+	cfg, starts, _ := fakeManagedRedis(t, 46371)
+	const a, b = "/profiles/a.json", "/profiles/b.json"
+
+	pid, others, err := acquireManagedRedis(&cfg, a)
+	if err != nil || others != 0 {
+		t.Fatalf("first up: pid %d, others %d, %v", pid, others, err)
+	}
+	pidB, others, err := acquireManagedRedis(&cfg, b)
+	if err != nil || pidB != pid || others != 1 {
+		t.Fatalf("second up: pid %d (want %d), others %d, %v", pidB, pid, others, err)
+	}
+	// Bringing a profile up again does not count it twice.
+	if _, others, err = acquireManagedRedis(&cfg, a); err != nil || others != 1 {
+		t.Fatalf("repeated up: others %d, %v", others, err)
+	}
+	if *starts != 1 {
+		t.Fatalf("started %d servers, want 1", *starts)
+	}
+
+	rel, err := releaseManagedRedis(stateFor(cfg, pid), a)
+	if err != nil || rel.Stopped || rel.Remaining != 1 {
+		t.Fatalf("first down: %+v, %v", rel, err)
+	}
+	if !processAlive(pid) {
+		t.Fatal("first down stopped a server the other profile still uses")
+	}
+
+	rel, err = releaseManagedRedis(stateFor(cfg, pid), b)
+	if err != nil || !rel.Stopped || rel.Remaining != 0 {
+		t.Fatalf("last down: %+v, %v", rel, err)
+	}
+	if processAlive(pid) {
+		t.Fatal("last down left the server running")
+	}
+	if _, err := os.Stat(redisRegistryPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("empty registry left behind: %v", err)
+	}
+}
+
+func TestManagedRedisNotSignalledUnlessIdentified(t *testing.T) {
+	cfg, starts, reported := fakeManagedRedis(t, 46372)
+	const a = "/profiles/a.json"
+
+	pid, _, err := acquireManagedRedis(&cfg, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Something else now answers on the port.
+	*reported = "/var/run/redis/redis-server.pid"
+	rel, err := releaseManagedRedis(stateFor(cfg, pid), a)
+	if err != nil || rel.Stopped || rel.Refused == nil {
+		t.Fatalf("down: %+v, %v", rel, err)
+	}
+	if !processAlive(pid) {
+		t.Fatal("down signalled a server it could not identify")
+	}
+
+	// Nor is an unidentified server reused.
+	pidfile := cfg.managedRedisPidfile()
+	*reported = pidfile
+	if _, _, err := acquireManagedRedis(&cfg, a); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(pidfile, []byte("1\n"), 0o600)
+	next, _, err := acquireManagedRedis(&cfg, "/profiles/b.json")
+	if err != nil || next == pid || *starts != 3 {
+		t.Fatalf("up over a stale pidfile: pid %d, %d starts, %v", next, *starts, err)
+	}
+}
+
+func TestManagedRedisMovesOffATakenPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	taken := ln.Addr().(*net.TCPAddr).Port
+	cfg, starts, _ := fakeManagedRedis(t, taken)
+	cfg.redisHost = "127.0.0.1"
+	managedRedisPidfile = func(_ context.Context, addr, _ string) (string, error) {
+		_, port, err := splitAddr(addr)
+		return config{RedisAddr: addr, redisPort: port}.managedRedisPidfile(), err
+	}
+	const a, b = "/profiles/a.json", "/profiles/b.json"
+
+	pinned := cfg
+	pinned.redisPortPinned = true
+	if _, _, err := acquireManagedRedis(&pinned, a); err == nil || !strings.Contains(err.Error(), "already in use") || *starts != 0 {
+		t.Fatalf("pinned to a taken port: %d starts, %v", *starts, err)
+	}
+
+	moved := cfg
+	pid, _, err := acquireManagedRedis(&moved, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.redisPort == taken || moved.RedisAddr != fmt.Sprintf("127.0.0.1:%d", moved.redisPort) {
+		t.Fatalf("not moved off port %d: %+v", taken, moved)
+	}
+	// Another profile asking for the same port joins the moved server.
+	other := cfg
+	pidB, others, err := acquireManagedRedis(&other, b)
+	if err != nil || pidB != pid || others != 1 || other.RedisAddr != moved.RedisAddr || *starts != 1 {
+		t.Fatalf("second up: pid %d (want %d), others %d, addr %s, %d starts, %v", pidB, pid, others, other.RedisAddr, *starts, err)
+	}
+
+	for _, profile := range []string{a, b} {
+		if _, err := releaseManagedRedis(stateFor(moved, pid), profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if processAlive(pid) {
+		t.Fatal("last down left the moved server running")
+	}
+}
+
+func TestManagedRedisPassword(t *testing.T) {
+	cfg, _, _ := fakeManagedRedis(t, 46375)
+	pwd, err := managedRedisPassword()
+	if err != nil || len(pwd) < 32 {
+		t.Fatalf("password %q, %v", pwd, err)
+	}
+	if again, err := managedRedisPassword(); err != nil || again != pwd {
+		t.Fatalf("second call gave %q, want the same %q (%v)", again, pwd, err)
+	}
+	if fi, err := os.Stat(managedRedisSecretPath()); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("secret file: %v, %v", fi.Mode(), err)
+	}
+
+	cfg.RedisPassword = pwd
+	if _, _, err := acquireManagedRedis(&cfg, "/profiles/a.json"); err != nil {
+		t.Fatal(err)
+	}
+	other := cfg
+	other.RedisPassword = "something else"
+	if _, _, err := acquireManagedRedis(&other, "/profiles/b.json"); err == nil || !strings.Contains(err.Error(), "different password") {
+		t.Fatalf("joined with another password: %v", err)
+	}
+}
+
+func TestReleaseOrphanedRedis(t *testing.T) {
+	cfg, _, _ := fakeManagedRedis(t, 46373)
+	pid, _, err := acquireManagedRedis(&cfg, "/profiles/a.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// state.json is gone, so down only has the registry to go on.
+	rels, err := releaseOrphanedRedis("/profiles/a.json")
+	if err != nil || len(rels) != 1 || !rels[0].Stopped {
+		t.Fatalf("orphan release: %+v, %v", rels, err)
+	}
+	if processAlive(pid) {
+		t.Fatal("orphaned server left running")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Unix socket connections to Redis
+// ---------------------------------------------------------------------------
+//
+// With redisSocket set, Redis is reached through that unix socket instead
+// of TCP. At run time the socket path stands in for redisAddr, so state,
+// status and error messages carry it like any address, and an address
+// that is an absolute path is dialled as a socket. A managed server is
+// then started with the socket and no TCP port, and is known in the
+// registry by its socket path rather than a port.
+
+// isSocketAddr reports whether addr is a unix socket path, not host:port.
+func isSocketAddr(addr string) bool {
+	return strings.HasPrefix(addr, "/")
+}
+
+// redisNetwork is the network to dial addr on.
+func redisNetwork(addr string) string {
+	if isSocketAddr(addr) {
+		return "unix"
+	}
+	return "tcp"
+}
+
+// applyRedisSocket points cfg's address at its socket, keeping the TCP
+// address for saveConfig to write back.
+func applyRedisSocket(cfg *config) error {
+	if cfg.RedisSocket == "" || cfg.RedisAddr == cfg.RedisSocket {
+		return nil
+	}
+	p, err := expandPath(cfg.RedisSocket)
+	if err != nil {
+		return err
+	}
+	cfg.tcpAddr, cfg.RedisSocket, cfg.RedisAddr = cfg.RedisAddr, p, p
+	return nil
+}
+
+// redisEndpointArgs are the mount daemon flags saying where Redis is.
+func redisEndpointArgs(cfg config) []string {
+	if isSocketAddr(cfg.RedisAddr) {
+		return []string{"--socket", cfg.RedisAddr}
+	}
+	return []string{"--redis", cfg.RedisAddr}
+}
+
+// managedRedisID is the registry key of the managed server at addr: its
+// port, or its socket path.
+func managedRedisID(addr string) (string, error) {
+	if isSocketAddr(addr) {
+		return addr, nil
+	}
+	_, port, err := splitAddr(addr)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(port), nil
+}
+
+// managedRedisName is the base name of the files of cfg's managed server:
+// rfs-<port>, or for a socket rfs-sock- and a hash of its path.
+func (cfg config) managedRedisName() string {
+	if isSocketAddr(cfg.RedisAddr) {
+		sum := sha1.Sum([]byte(cfg.RedisAddr))
+		return "rfs-sock-" + hex.EncodeToString(sum[:4])
+	}
+	return fmt.Sprintf("rfs-%d", cfg.redisPort)
+}
+
+// managedRedisPidfile is the pidfile cfg's managed server writes.
+func (cfg config) managedRedisPidfile() string {
+	return "/tmp/" + cfg.managedRedisName() + ".pid"
+}
+
+// socketInUse reports whether a server answers on the socket at path.
+func socketInUse(path string) bool {
+	c, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
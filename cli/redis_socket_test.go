@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRedisSocketConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	sock := filepath.Join(t.TempDir(), "redis.sock")
+	cfg := config{RedisAddr: "localhost:6379", RedisSocket: sock}
+	if err := applyRedisSocket(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RedisAddr != sock || redisNetwork(cfg.RedisAddr) != "unix" || cfg.tcpAddr != "localhost:6379" {
+		t.Fatalf("socket not used: addr %q, tcp %q", cfg.RedisAddr, cfg.tcpAddr)
+	}
+	if id, err := managedRedisID(cfg.RedisAddr); err != nil || id != sock {
+		t.Fatalf("registry key %q, %v", id, err)
+	}
+	if name := cfg.managedRedisName(); !strings.HasPrefix(name, "rfs-sock-") {
+		t.Fatalf("managed server named %q", name)
+	}
+	args := redisEndpointArgs(cfg)
+	if !slices.Equal(args, []string{"--socket", sock}) {
+		t.Fatalf("mount daemon args %q", args)
+	}
+}
+
+func TestManagedRedisOnSocket(t *testing.T) {
+	cfg, starts, reported := fakeManagedRedis(t, 46376)
+	cfg.RedisAddr = filepath.Join(t.TempDir(), "redis.sock")
+	cfg.redisPort = 0
+	*reported = cfg.managedRedisPidfile()
+	const a, b = "/profiles/a.json", "/profiles/b.json"
+
+	pid, _, err := acquireManagedRedis(&cfg, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, others, err := acquireManagedRedis(&cfg, b); err != nil || others != 1 || *starts != 1 {
+		t.Fatalf("second up: others %d, %d starts, %v", others, *starts, err)
+	}
+	for _, profile := range []string{a, b} {
+		if _, err := releaseManagedRedis(stateFor(cfg, pid), profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if processAlive(pid) {
+		t.Fatal("last down left the server running")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/redis-fs/mount/client"
+)
+
+// ---------------------------------------------------------------------------
+// TLS connections to Redis
+// ---------------------------------------------------------------------------
+//
+// With redisTLS set, the CLI and the mount daemons reach Redis over TLS,
+// verifying the server against redisTLSCACert (or the system roots) and
+// presenting redisTLSCert and redisTLSKey when a client certificate is
+// wanted. Setting any of the other TLS fields implies redisTLS.
+
+// redisTLSEnabled reports whether cfg reaches Redis over TLS.
+func (cfg config) redisTLSEnabled() bool {
+	return cfg.RedisTLS || cfg.RedisTLSCACert != "" || cfg.RedisTLSCert != "" || cfg.RedisTLSKey != "" || cfg.RedisTLSSkipVerify
+}
+
+// redisTLSConfig is the tls.Config for cfg's Redis connections, or nil
+// when they are plain TCP.
+func (cfg config) redisTLSConfig() (*tls.Config, error) {
+	if !cfg.redisTLSEnabled() {
+		return nil, nil
+	}
+	opts := client.TLSOptions{SkipVerify: cfg.RedisTLSSkipVerify}
+	for _, p := range []struct {
+		dst *string
+		src string
+	}{
+		{&opts.CACert, cfg.RedisTLSCACert},
+		{&opts.Cert, cfg.RedisTLSCert},
+		{&opts.Key, cfg.RedisTLSKey},
+	} {
+		v, err := expandPath(p.src)
+		if err != nil {
+			return nil, err
+		}
+		*p.dst = v
+	}
+	return client.TLSConfig(opts)
+}
+
+// redisTLSArgs are the mount daemon flags carrying cfg's TLS settings.
+func redisTLSArgs(cfg config) []string {
+	if !cfg.redisTLSEnabled() {
+		return nil
+	}
+	args := []string{"--tls"}
+	for _, f := range []struct{ flag, path string }{
+		{"--tls-ca-cert", cfg.RedisTLSCACert},
+		{"--tls-cert", cfg.RedisTLSCert},
+		{"--tls-key", cfg.RedisTLSKey},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if p, err := expandPath(f.path); err == nil {
+			args = append(args, f.flag, p)
+		}
+	}
+	if cfg.RedisTLSSkipVerify {
+		args = append(args, "--tls-skip-verify")
+	}
+	return args
+}
+
+// errRedisTLSSetup marks a TLS setting that could not be loaded, such as
+// a missing certificate file.
+var errRedisTLSSetup = errors.New("redis TLS settings")
+
+// failingDialer stands in for a connection that cannot be made, so a bad
+// TLS setting surfaces where connection errors already do.
+func failingDialer(err error) func(context.Context, string, string) (net.Conn, error) {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return nil, err
+	}
+}
+
+// redisConnectFailure describes err, from connecting to cfg's Redis, for
+// a step's failure message: a TLS handshake that failed reads differently
+// from a server that is not there.
+func redisConnectFailure(cfg config, err error) string {
+	var (
+		recordErr tls.RecordHeaderError
+		alertErr  tls.AlertError
+	)
+	switch {
+	case errors.Is(err, errRedisTLSSetup):
+		return err.Error()
+	case errors.As(err, &recordErr):
+		return fmt.Sprintf("TLS handshake with %s failed: the server did not answer with TLS", cfg.RedisAddr)
+	case certRejected(err):
+		return fmt.Sprintf("TLS handshake with %s failed: its certificate was rejected", cfg.RedisAddr)
+	case errors.As(err, &alertErr):
+		return fmt.Sprintf("TLS handshake with %s failed: the server refused it (%v)", cfg.RedisAddr, alertErr)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return fmt.Sprintf("connection to %s refused", cfg.RedisAddr)
+	case cfg.redisTLSEnabled() && (errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)):
+		return fmt.Sprintf("TLS handshake with %s failed: the server closed the connection; it may not use TLS", cfg.RedisAddr)
+	case errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET):
+		return fmt.Sprintf("%s closed the connection; it may require TLS (redisTLS)", cfg.RedisAddr)
+	}
+	return fmt.Sprintf("cannot reach %s", cfg.RedisAddr)
+}
+
+// certRejected reports whether err is the server's certificate failing
+// verification.
+func certRejected(err error) bool {
+	var (
+		authority x509.UnknownAuthorityError
+		hostname  x509.HostnameError
+		invalid   x509.CertificateInvalidError
+		verifyErr *tls.CertificateVerificationError
+	)
+	return errors.As(err, &authority) || errors.As(err, &hostname) || errors.As(err, &invalid) || errors.As(err, &verifyErr)
+}
+
+// tlsRejected reports whether the TLS handshake failed in a way another
+// attempt would repeat: a rejected certificate, a refusal, or a server
+// that does not speak TLS.
+func tlsRejected(err error) bool {
+	var (
+		recordErr tls.RecordHeaderError
+		alertErr  tls.AlertError
+	)
+	return certRejected(err) || errors.As(err, &recordErr) || errors.As(err, &alertErr)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// selfSignedCert writes a certificate for 127.0.0.1 and its key to dir.
+func selfSignedCert(t *testing.T, dir string) (certFile, keyFile string, pair tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "rfs test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pair, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, pair
+}
+
+func TestRedisOverTLS(t *testing.T) {
+	certFile, _, pair := selfSignedCert(t, t.TempDir())
+	srv, err := miniredis.RunTLS(&tls.Config{Certificates: []tls.Certificate{pair}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	plain := miniredis.RunT(t)
+	ctx := context.Background()
+
+	ping := func(cfg config) error {
+		rdb := newRedisClient(cfg, 1)
+		defer rdb.Close()
+		return rdb.Ping(ctx).Err()
+	}
+
+	cfg := config{RedisAddr: srv.Addr(), RedisTLSCACert: certFile}
+	if err := ping(cfg); err != nil {
+		t.Fatalf("TLS with the CA certificate: %v", err)
+	}
+
+	// The system roots do not know the test CA.
+	noCA := config{RedisAddr: srv.Addr(), RedisTLS: true}
+	err = ping(noCA)
+	if msg := redisConnectFailure(noCA, err); !strings.Contains(msg, "certificate was rejected") {
+		t.Errorf("unknown CA: %q (%v)", msg, err)
+	}
+
+	toPlain := config{RedisAddr: plain.Addr(), RedisTLSCACert: certFile}
+	err = ping(toPlain)
+	if msg := redisConnectFailure(toPlain, err); !strings.Contains(msg, "TLS handshake") {
+		t.Errorf("TLS to a plain server: %q (%v)", msg, err)
+	}
+
+	// And a plain client meets a TLS server.
+	toTLS := config{RedisAddr: srv.Addr()}
+	err = ping(toTLS)
+	if msg := redisConnectFailure(toTLS, err); !strings.Contains(msg, "may require TLS") {
+		t.Errorf("plain to a TLS server: %q (%v)", msg, err)
+	}
+
+	missing := config{RedisAddr: srv.Addr(), RedisTLSCACert: filepath.Join(t.TempDir(), "nope.pem")}
+	err = ping(missing)
+	if msg := redisConnectFailure(missing, err); !strings.Contains(msg, "read CA certificate") {
+		t.Errorf("missing CA file: %q (%v)", msg, err)
+	}
+
+	refused := config{RedisAddr: "127.0.0.1:1"}
+	err = ping(refused)
+	if msg := redisConnectFailure(refused, err); !strings.Contains(msg, "refused") {
+		t.Errorf("nothing listening: %q (%v)", msg, err)
+	}
+}
+
+func TestRedisTLSArgs(t *testing.T) {
+	if args := redisTLSArgs(config{}); args != nil {
+		t.Errorf("plain: %q", args)
+	}
+	got := strings.Join(redisTLSArgs(config{RedisTLSCert: "/c.pem", RedisTLSKey: "/k.pem", RedisTLSSkipVerify: true}), " ")
+	if want := "--tls --tls-cert /c.pem --tls-key /k.pem --tls-skip-verify"; got != want {
+		t.Errorf("args = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// Waiting for Redis to come up
+// ---------------------------------------------------------------------------
+//
+// A remote Redis, or one in a container that is still starting, may refuse
+// connections or answer LOADING for a while after up begins. up keeps
+// trying, with a backoff that doubles up to redisRetryMaxDelay, until the
+// wait given by --wait-redis runs out. Errors that waiting cannot fix, such
+// as a wrong password or a rejected certificate, fail at once.
+
+const (
+	defaultRedisWait   = 30 * time.Second
+	redisRetryDelay    = 100 * time.Millisecond
+	redisRetryMaxDelay = 2 * time.Second
+	redisAttemptLimit  = 5 * time.Second
+
+	// fsModuleWait bounds the wait for the fs module, which may never
+	// come when the server has been replaced by one without it.
+	fsModuleWait = 5 * time.Second
+)
+
+// errFSModuleNotLoaded marks a key written by the fs module on a server
+// that has not loaded it yet.
+var errFSModuleNotLoaded = errors.New("fs module not loaded")
+
+// redisWaitTimeout is how long up waits for cfg's Redis.
+func (cfg config) redisWaitTimeout() time.Duration {
+	if cfg.redisWait > 0 {
+		return cfg.redisWait
+	}
+	return defaultRedisWait
+}
+
+// redisErrTransient reports whether err, from talking to Redis, may go
+// away by itself: the server is not reachable yet, or is still loading.
+func redisErrTransient(err error) bool {
+	if errors.Is(err, errFSModuleNotLoaded) {
+		return true
+	}
+	if errors.Is(err, errRedisTLSSetup) || tlsRejected(err) {
+		return false
+	}
+	var reply redis.Error
+	if errors.As(err, &reply) {
+		for _, prefix := range []string{"LOADING", "BUSY", "MASTERDOWN", "TRYAGAIN"} {
+			if strings.HasPrefix(reply.Error(), prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// retryRedis runs op until it succeeds, fails for good, or cfg's wait
+// runs out, and returns its last error. Each retry relabels s, when
+// given, with label and the attempt number.
+func retryRedis(cfg config, s *uiStep, label string, op func(context.Context) error) error {
+	deadline := time.Now().Add(cfg.redisWaitTimeout())
+	delay := redisRetryDelay
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), redisAttemptLimit)
+		err := op(ctx)
+		cancel()
+		if err == nil || !redisErrTransient(err) || time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		if s != nil {
+			s.update(fmt.Sprintf("%s (attempt %d)", label, attempt+1))
+		}
+		time.Sleep(delay)
+		delay = min(delay*2, redisRetryMaxDelay)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// replyError is an error reply from Redis.
+type replyError string
+
+func (e replyError) Error() string { return string(e) }
+func (replyError) RedisError()     {}
+
+var _ redis.Error = replyError("")
+
+func TestRetryRedis(t *testing.T) {
+	cfg := config{redisWait: 5 * time.Second}
+	calls := 0
+	err := retryRedis(cfg, nil, "", func(context.Context) error {
+		if calls++; calls < 3 {
+			return syscall.ECONNREFUSED
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("refused twice: %d calls, %v", calls, err)
+	}
+
+	calls = 0
+	loading := replyError("LOADING Redis is loading the dataset in memory")
+	if err := retryRedis(cfg, nil, "", func(context.Context) error {
+		if calls++; calls < 2 {
+			return loading
+		}
+		return nil
+	}); err != nil || calls != 2 {
+		t.Fatalf("loading: %d calls, %v", calls, err)
+	}
+
+	// Waiting does not fix a wrong password.
+	calls = 0
+	wrongPass := replyError("WRONGPASS invalid username-password pair")
+	if err := retryRedis(cfg, nil, "", func(context.Context) error {
+		calls++
+		return wrongPass
+	}); !errors.Is(err, wrongPass) || calls != 1 {
+		t.Fatalf("wrong password: %d calls, %v", calls, err)
+	}
+
+	// Nor does it go on past the wait.
+	cfg.redisWait = 300 * time.Millisecond
+	start := time.Now()
+	if err := retryRedis(cfg, nil, "", func(context.Context) error {
+		return syscall.ECONNREFUSED
+	}); !errors.Is(err, syscall.ECONNREFUSED) || time.Since(start) > time.Second {
+		t.Fatalf("gave up after %v: %v", time.Since(start), err)
+	}
+}
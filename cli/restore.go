@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// restore — undo a migration
+// ---------------------------------------------------------------------------
+//
+// A migrated directory becomes a mountpoint, with the original kept at the
+// archive path the state records. restore unmounts it, removes the empty
+// mountpoint, and moves the archive back, by rename or, when the two are
+// on different filesystems, by copy. The Redis key is deleted unless
+// --keep-key says to leave it; either way the filesystem leaves the state,
+// so status no longer lists it or its archive.
+
+func cmdRestore(args []string) error {
+	usage := fmt.Sprintf("Usage: %s restore [name] [--keep-key] [--yes] [--force]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("restore")
+	keepKey := fs.Bool("keep-key", false, "leave the filesystem's data in Redis")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	force := fs.Bool("force", false, "unmount even if the mountpoint no longer looks like ours")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 1 {
+		return errors.New(usage)
+	}
+	var name string
+	if len(pos) == 1 {
+		name = pos[0]
+	}
+
+	if c, err := dialDaemon(); err == nil {
+		c.Close()
+		return fmt.Errorf("the rfs daemon is running\nStop it with '%s daemon stop' before restoring", filepath.Base(os.Args[0]))
+	} else if !errors.Is(err, errNoDaemon) {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return err
+	}
+
+	return withState(func(s *stateStore) error {
+		sts, err := s.load()
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.New("nothing is mounted, so there is no migration to restore")
+		} else if err != nil {
+			return err
+		}
+		name, err := restoreTarget(sts, name)
+		if err != nil {
+			return err
+		}
+		st := sts[name]
+		if _, err := os.Stat(st.ArchivePath); err != nil {
+			return fmt.Errorf("cannot restore %s: the archive %s is gone: %w", st.Mountpoint, st.ArchivePath, err)
+		}
+		plan, err := planRestore(st)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println()
+		printBox("Restore", []boxRow{
+			{Label: "filesystem", Value: name},
+			{Label: "archive", Value: st.ArchivePath},
+			{Label: "restore to", Value: st.Mountpoint},
+			{Label: "method", Value: plan.strategy()},
+			{Label: "redis key", Value: restoreKeyFate(st.RedisKey, *keepKey)},
+		})
+		fmt.Println()
+		if !*yes {
+			fmt.Printf("  %s Changes made through the mount since the migration are not copied back\n", clr(ansiYellow, "!"))
+			ok, err := promptYesNo(bufio.NewReader(os.Stdin), os.Stdout,
+				fmt.Sprintf("  Unmount %s and put the original back?", st.Mountpoint), false)
+			if err != nil || !ok {
+				return errors.New("restore cancelled")
+			}
+			fmt.Println()
+		}
+
+		if err := stopMount(st, *force); err != nil {
+			return err
+		}
+		step := startStep("Restoring " + st.Mountpoint)
+		if err := os.Remove(st.Mountpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			step.fail(err.Error())
+			return fmt.Errorf("remove the mountpoint: %w\nThe original is still at %s", err, st.ArchivePath)
+		}
+		if err := restoreArchive(plan, st.Mountpoint); err != nil {
+			step.fail(err.Error())
+			return fmt.Errorf("restore %s: %w", st.Mountpoint, err)
+		}
+		step.succeed("from " + st.ArchivePath)
+		if err := withArchiveRegistry(func(reg archiveRegistry) error {
+			delete(reg, st.ArchivePath)
+			return nil
+		}); err != nil {
+			fmt.Printf("  %s Could not drop the archive record: %v\n", clr(ansiYellow, "!"), err)
+		}
+
+		// The key goes before the state, since stopping the last
+		// filesystem stops a managed Redis server too.
+		var keyErr error
+		if !*keepKey {
+			keyErr = deleteRestoredKey(cfg, st)
+		}
+		if err := stopServices(s, sts, []string{name}, *force, false); err != nil {
+			return errors.Join(keyErr, err)
+		}
+		if keyErr != nil {
+			return fmt.Errorf("%s is restored, but deleting key %q failed: %w\nDelete it with '%s rm %s'", st.Mountpoint, st.RedisKey, keyErr, filepath.Base(os.Args[0]), st.RedisKey)
+		}
+		fmt.Printf("\n  %s %s restored\n", clr(ansiDim, "■"), st.Mountpoint)
+		if st.Mountpoint == cfg.Mountpoint {
+			fmt.Printf("  %s It is still the configured mountpoint; 'up' would mount over it\n", clr(ansiDim, "▸"))
+		}
+		fmt.Println()
+		return nil
+	})
+}
+
+// restoreTarget is the filesystem restore undoes: name, or the only one
+// that came from a migration.
+func restoreTarget(sts states, name string) (string, error) {
+	if name != "" {
+		st, ok := sts[name]
+		if !ok {
+			return "", fmt.Errorf("%s is not running (up: %s)", name, strings.Join(sts.names(), ", "))
+		}
+		if st.ArchivePath == "" {
+			return "", fmt.Errorf("%s was not migrated, so there is no archive to restore", name)
+		}
+		return name, nil
+	}
+	var migrated []string
+	for _, n := range sts.names() {
+		if sts[n].ArchivePath != "" {
+			migrated = append(migrated, n)
+		}
+	}
+	switch len(migrated) {
+	case 0:
+		return "", errors.New("no running filesystem came from a migration")
+	case 1:
+		return migrated[0], nil
+	default:
+		return "", fmt.Errorf("more than one filesystem came from a migration; name one of: %s", strings.Join(migrated, ", "))
+	}
+}
+
+// planRestore works out how the archive goes back. The mountpoint is
+// removed first, so what matters is the filesystem of its parent.
+func planRestore(st state) (archivePlan, error) {
+	src, err := deviceOf(st.ArchivePath)
+	if err != nil {
+		return archivePlan{}, err
+	}
+	dst, err := deviceOf(filepath.Dir(st.Mountpoint))
+	if err != nil {
+		return archivePlan{}, err
+	}
+	return archivePlan{dir: st.ArchivePath, copy: src != dst}, nil
+}
+
+func restoreKeyFate(fsKey string, keep bool) string {
+	if keep {
+		return fsKey + " (kept)"
+	}
+	return fsKey + " (deleted)"
+}
+
+// deleteRestoredKey deletes the key st mounted from the Redis server it
+// used.
+func deleteRestoredKey(cfg config, st state) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	cfg.RedisAddr, cfg.RedisDB = st.RedisAddr, st.RedisDB
+	rdb := newRedisClient(cfg, 4)
+	defer rdb.Close()
+	size, err := measureStep(ctx, rdb, st.RedisKey)
+	if err != nil {
+		return err
+	}
+	return deleteFilesystem(ctx, rdb, st.RedisKey, size, false)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreTarget(t *testing.T) {
+	sts := states{
+		"notes":    {Name: "notes", ArchivePath: "/home/me/notes.archive"},
+		"projects": {Name: "projects"},
+	}
+	if name, err := restoreTarget(sts, ""); err != nil || name != "notes" {
+		t.Fatalf("only migrated: %q, %v", name, err)
+	}
+	if _, err := restoreTarget(sts, "projects"); err == nil || !strings.Contains(err.Error(), "not migrated") {
+		t.Fatalf("projects: %v", err)
+	}
+	if _, err := restoreTarget(sts, "music"); err == nil {
+		t.Fatal("music accepted")
+	}
+	sts["docs"] = state{Name: "docs", ArchivePath: "/home/me/docs.archive"}
+	if _, err := restoreTarget(sts, ""); err == nil || !strings.Contains(err.Error(), "docs, notes") {
+		t.Fatalf("two migrated: %v", err)
+	}
+}
+
+func TestPlanRestoreRenamesBack(t *testing.T) {
+	src := writeFixtureTree(t)
+	st := state{Mountpoint: src, ArchivePath: src + ".archive"}
+	if err := os.Rename(src, st.ArchivePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(st.Mountpoint, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planRestore(st)
+	if err != nil || plan.copy || plan.dir != st.ArchivePath {
+		t.Fatalf("plan: %+v, %v", plan, err)
+	}
+	if err := os.Remove(st.Mountpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreArchive(plan, st.Mountpoint); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "README.md")); err != nil {
+		t.Fatalf("original not back: %v", err)
+	}
+	if _, err := os.Stat(st.ArchivePath); !os.IsNotExist(err) {
+		t.Fatalf("archive left behind: %v", err)
+	}
+	if _, err := planRestore(st); err == nil {
+		t.Fatal("planned a restore from a missing archive")
+	}
+}
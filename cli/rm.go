@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// rm — delete a whole filesystem key, with progress
+// ---------------------------------------------------------------------------
+//
+// A filesystem of many gigabytes takes Redis a while to free. DEL frees it
+// in the foreground and blocks every other client meanwhile; UNLINK
+// returns at once and frees in the background, which leaves nothing to
+// show whether it worked. Deleting a filesystem, whether from rm or a
+// migration overwriting a key, first reports how much memory it holds,
+// then UNLINKs it and follows the reclamation until Redis is done. A server
+// without lazy freeing gets DEL, after a warning of how long it may block.
+
+// delFreeRate is roughly how fast Redis frees memory with DEL, used to
+// warn of the pause it causes.
+const delFreeRate = 512 << 20 // bytes per second
+
+// reclaimPoll and reclaimWait pace and bound the wait for background
+// freeing to finish.
+var (
+	reclaimPoll = 200 * time.Millisecond
+	reclaimWait = 2 * time.Minute
+)
+
+// namespaceSize is what deleting a filesystem will free.
+type namespaceSize struct {
+	keys   int64
+	memory *int64 // nil when the server refuses MEMORY USAGE
+	lazy   bool   // the server frees UNLINKed keys in the background
+}
+
+func (n namespaceSize) String() string {
+	s := fmt.Sprintf("%d keys", n.keys)
+	if n.memory != nil {
+		s += ", " + formatBytes(*n.memory)
+	}
+	return s
+}
+
+// blockEstimate guesses how long DEL will stall Redis, or zero when it
+// cannot tell.
+func (n namespaceSize) blockEstimate() time.Duration {
+	if n.memory == nil {
+		return 0
+	}
+	return time.Duration(float64(*n.memory) / delFreeRate * float64(time.Second))
+}
+
+// measureNamespace counts fsKey's keys and the memory they use, and asks
+// whether the server frees lazily.
+func measureNamespace(ctx context.Context, rdb *redis.Client, fsKey string, onProgress func(int64)) (namespaceSize, error) {
+	var n namespaceSize
+	text, err := rdb.Info(ctx, "memory").Result()
+	if err == nil {
+		_, n.lazy = parseRedisInfo(text)["lazyfree_pending_objects"]
+	}
+
+	memoryOK := true
+	var memory int64
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, fsNamespacePattern(fsKey), 500).Result()
+		if err != nil {
+			return n, err
+		}
+		n.keys += int64(len(keys))
+		if memoryOK && len(keys) > 0 {
+			pipe := rdb.Pipeline()
+			usage := make([]*redis.IntCmd, len(keys))
+			for i, k := range keys {
+				usage[i] = pipe.MemoryUsage(ctx, k)
+			}
+			_, _ = pipe.Exec(ctx)
+			for _, cmd := range usage {
+				v, err := cmd.Result()
+				if err != nil && err != redis.Nil {
+					// ACLs or managed Redis may refuse MEMORY USAGE.
+					memoryOK = false
+					break
+				}
+				memory += v
+			}
+		}
+		if onProgress != nil {
+			onProgress(n.keys)
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	if memoryOK {
+		n.memory = &memory
+	}
+	return n, nil
+}
+
+// removeNamespace deletes fsKey's keys, with UNLINK when the server frees
+// lazily and DEL otherwise, reporting the count deleted so far.
+func removeNamespace(ctx context.Context, rdb *redis.Client, fsKey string, lazy bool, onProgress func(int64)) error {
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, fsNamespacePattern(fsKey), 500).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if lazy {
+				err = rdb.Unlink(ctx, keys...).Err()
+			} else {
+				err = rdb.Del(ctx, keys...).Err()
+			}
+			if err != nil {
+				return err
+			}
+			deleted += int64(len(keys))
+			if onProgress != nil {
+				onProgress(deleted)
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// awaitReclaim waits until the filesystem's root is gone and Redis has no
+// objects left to free in the background, reporting the pending count.
+// The pending count is server-wide, so other clients' deletes can hold it
+// up; it gives up after reclaimWait.
+func awaitReclaim(ctx context.Context, rdb *redis.Client, fsKey string, onProgress func(int64)) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, reclaimWait)
+	defer cancel()
+	root := inodeKeyPrefix(fsKey) + "/"
+	for {
+		exists, err := rdb.Exists(ctx, root).Result()
+		if err != nil {
+			return false, ignoreDeadline(err)
+		}
+		text, err := rdb.Info(ctx, "memory").Result()
+		if err != nil {
+			return false, ignoreDeadline(err)
+		}
+		pending, _ := strconv.ParseInt(parseRedisInfo(text)["lazyfree_pending_objects"], 10, 64)
+		if exists == 0 && pending == 0 {
+			return true, nil
+		}
+		onProgress(pending)
+		select {
+		case <-ctx.Done():
+			return false, ignoreDeadline(ctx.Err())
+		case <-time.After(reclaimPoll):
+		}
+	}
+}
+
+// ignoreDeadline treats running out of time to wait as not an error.
+func ignoreDeadline(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
+
+// deleteFilesystem deletes fsKey, measured beforehand as size, with
+// progress: it warns before a blocking DEL, deletes the keys, and unless
+// noWait follows the memory being reclaimed.
+func deleteFilesystem(ctx context.Context, rdb *redis.Client, fsKey string, size namespaceSize, noWait bool) error {
+	if !size.lazy {
+		warning := "This Redis server cannot free memory in the background, so DEL will block it while freeing"
+		if d := size.blockEstimate(); d >= time.Second {
+			warning = fmt.Sprintf("This Redis server cannot free memory in the background; DEL may block it for about %s", formatDuration(d))
+		}
+		fmt.Printf("  %s %s\n", clr(ansiYellow, "!"), warning)
+	}
+
+	step := startStep(fmt.Sprintf("Deleting %s", size))
+	err := removeNamespace(ctx, rdb, fsKey, size.lazy, func(n int64) {
+		step.update(fmt.Sprintf("Deleting · %d of %d keys", n, size.keys))
+	})
+	if err != nil {
+		step.fail(err.Error())
+		return err
+	}
+	step.update(fmt.Sprintf("Deleting %s", size))
+	step.succeed(fmt.Sprintf("%d keys", size.keys))
+	if !size.lazy {
+		return nil
+	}
+	if noWait {
+		fmt.Printf("  %s Redis is freeing the memory in the background\n", clr(ansiDim, "▸"))
+		return nil
+	}
+
+	step = startStep("Reclaiming memory")
+	done, err := awaitReclaim(ctx, rdb, fsKey, func(pending int64) {
+		step.update(fmt.Sprintf("Reclaiming memory · %d objects pending", pending))
+	})
+	step.update("Reclaiming memory")
+	switch {
+	case err != nil:
+		step.fail(err.Error())
+		return err
+	case !done:
+		step.succeed(clr(ansiYellow, "still freeing in the background"))
+	case size.memory != nil:
+		step.succeed(formatBytes(*size.memory) + " freed")
+	default:
+		step.succeed("done")
+	}
+	return nil
+}
+
+// measureStep sizes fsKey behind a spinner.
+func measureStep(ctx context.Context, rdb *redis.Client, fsKey string) (namespaceSize, error) {
+	step := startStep("Measuring " + fsKey)
+	size, err := measureNamespace(ctx, rdb, fsKey, func(n int64) {
+		step.update(fmt.Sprintf("Measuring %s · %d keys", fsKey, n))
+	})
+	if err != nil {
+		step.fail(err.Error())
+		return size, err
+	}
+	step.update("Measuring " + fsKey)
+	step.succeed(size.String())
+	return size, nil
+}
+
+// confirmKeyName asks for fsKey to be typed back before deleting it, so
+// a key picked from shell history by mistake is not deleted on reflex.
+func confirmKeyName(r *bufio.Reader, out io.Writer, fsKey string) (bool, error) {
+	answer, err := promptString(r, out, fmt.Sprintf("  Type %s to delete it", clr(ansiBold, fsKey)), "")
+	if err != nil {
+		return false, err
+	}
+	return answer == fsKey, nil
+}
+
+// keyArchives lists the archives recorded as migrated into fsKey.
+func keyArchives(fsKey string) ([]string, error) {
+	var dirs []string
+	err := withArchiveRegistry(func(reg archiveRegistry) error {
+		for dir, rec := range reg {
+			if rec.Key == fsKey {
+				dirs = append(dirs, dir)
+			}
+		}
+		return nil
+	})
+	sort.Strings(dirs)
+	return dirs, err
+}
+
+// cmdRm serves both rm and rm-key.
+func cmdRm(args []string) error {
+	usage := fmt.Sprintf("Usage: %s %s <key> [--force] [--no-wait]", filepath.Base(os.Args[0]), args[0])
+	fs := newFlagSet(args[0])
+	force := fs.Bool("force", false, "do not ask for the key name before deleting")
+	fs.BoolVar(force, "yes", false, "same as --force")
+	noWait := fs.Bool("no-wait", false, "return once the keys are unlinked, without waiting for Redis to free the memory")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("expected one filesystem key\n\n%s", usage)
+	}
+	fsKey := pos[0]
+
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return err
+	}
+	// Without a readable state there is no telling whether the key is
+	// mounted, so refuse rather than delete it from under a mount.
+	sts, err := loadState()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if st, ok := sts.forKey(cfg, fsKey); ok && st.MountPID > 0 && processAlive(st.MountPID) {
+		return fmt.Errorf("%s is mounted at %s\nRun '%s down' first", fsKey, st.Mountpoint, filepath.Base(os.Args[0]))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	rdb := newRedisClient(cfg, 4)
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("cannot connect to Redis at %s: %w", cfg.RedisAddr, err)
+	}
+	fsClient := client.New(rdb, fsKey)
+	if st, err := fsClient.Stat(ctx, "/"); err != nil {
+		return fmt.Errorf("read key %q on %s: %w", fsKey, cfg.RedisAddr, err)
+	} else if st == nil {
+		return fmt.Errorf("no filesystem found at key %q on %s (db %d)", fsKey, cfg.RedisAddr, cfg.RedisDB)
+	}
+	counters, err := fsClient.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("read key %q on %s: %w", fsKey, cfg.RedisAddr, err)
+	}
+
+	size, err := measureStep(ctx, rdb, fsKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  %s %d files, %d dirs, %d symlinks\n", clr(ansiDim, "▸"), counters.Files, max(counters.Directories-1, 0), counters.Symlinks)
+	archives, err := keyArchives(fsKey)
+	if err != nil {
+		return err
+	}
+	for _, dir := range archives {
+		fmt.Printf("  %s %s was migrated into %s and is kept\n", clr(ansiDim, "▸"), dir, fsKey)
+	}
+	if !*force {
+		fmt.Printf("  %s This deletes filesystem %q from %s (db %d)\n", clr(ansiYellow, "!"), fsKey, cfg.RedisAddr, cfg.RedisDB)
+		ok, err := confirmKeyName(bufio.NewReader(os.Stdin), os.Stdout, fsKey)
+		if err != nil || !ok {
+			return fmt.Errorf("%s cancelled", args[0])
+		}
+	}
+	if err := deleteFilesystem(ctx, rdb, fsKey, size, *noWait); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s interrupted; part of the filesystem may remain", args[0])
+		}
+		return err
+	}
+	if fsKey == cfg.RedisKey {
+		fmt.Printf("  %s %s is still the configured key; 'up' will start it empty\n", clr(ansiDim, "▸"), fsKey)
+	}
+	return nil
+}
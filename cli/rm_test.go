@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+)
+
+func TestNamespaceSizeSummary(t *testing.T) {
+	n := namespaceSize{keys: 12}
+	if got := n.String(); got != "12 keys" {
+		t.Fatalf("String without memory = %q", got)
+	}
+	if d := n.blockEstimate(); d != 0 {
+		t.Fatalf("blockEstimate without memory = %s", d)
+	}
+	mem := int64(delFreeRate * 3)
+	n.memory = &mem
+	if got := n.String(); got != "12 keys, "+formatBytes(mem) {
+		t.Fatalf("String = %q", got)
+	}
+	if d := n.blockEstimate(); d != 3*time.Second {
+		t.Fatalf("blockEstimate = %s, want 3s", d)
+	}
+}
+
+func TestMeasureAndRemoveNamespace(t *testing.T) {
+	rdb := testRedis(t)
+	ctx := context.Background()
+	key, other := testKey(t, rdb), testKey(t, rdb)
+	for _, k := range []string{key, other} {
+		if _, err := importDirectory(ctx, client.New(rdb, k), writeFixtureTree(t), importOptions{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := rdb.Keys(ctx, fsNamespacePattern(key)).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := measureNamespace(ctx, rdb, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size.keys != int64(len(want)) || size.keys == 0 {
+		t.Fatalf("measured %d keys, want %d", size.keys, len(want))
+	}
+
+	var reported int64
+	if err := removeNamespace(ctx, rdb, key, size.lazy, func(n int64) { reported = n }); err != nil {
+		t.Fatal(err)
+	}
+	if reported != size.keys {
+		t.Fatalf("progress reported %d keys, want %d", reported, size.keys)
+	}
+	if left, _ := rdb.Keys(ctx, fsNamespacePattern(key)).Result(); len(left) != 0 {
+		t.Fatalf("keys left after remove: %v", left)
+	}
+	if st, err := client.New(rdb, other).Stat(ctx, "/"); err != nil || st == nil {
+		t.Fatalf("other filesystem damaged: %v, %v", st, err)
+	}
+}
+
+func TestConfirmKeyName(t *testing.T) {
+	for answer, want := range map[string]bool{"notes\n": true, " notes \n": true, "y\n": false, "\n": false, "Notes\n": false} {
+		ok, err := confirmKeyName(bufio.NewReader(strings.NewReader(answer)), io.Discard, "notes")
+		if err != nil || ok != want {
+			t.Errorf("%q: %v, %v; want %v", answer, ok, err, want)
+		}
+	}
+}
+
+func TestRmRefusedWhileStateBusy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "rfs.config.json")
+	t.Setenv(configEnv, path)
+	if err := os.WriteFile(path, []byte(`{"redisAddr": "127.0.0.1:1", "redisKey": "myfs"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	orig := stateLockWait
+	stateLockWait = 100 * time.Millisecond
+	t.Cleanup(func() { stateLockWait = orig })
+
+	held, err := lockState(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.unlock()
+	var busy *stateBusyError
+	if err := cmdRm([]string{"rm-key", "myfs", "--force"}); !errors.As(err, &busy) {
+		t.Fatalf("rm-key with the state locked: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/redis-fs/cli/internal/selfupdate"
+)
+
+// version is the release this binary was built from, set at build time
+// with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+func cmdVersion() error {
+	fmt.Printf("%s %s (%s/%s)\n", filepath.Base(os.Args[0]), version, runtime.GOOS, runtime.GOARCH)
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// self-update — replace this binary with the latest release
+// ---------------------------------------------------------------------------
+
+func cmdSelfUpdate(args []string) error {
+	usage := fmt.Sprintf("Usage: %s self-update [--channel stable|nightly] [--check-only] [--force] [--url releases-url]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("self-update")
+	channel := fs.String("channel", selfupdate.ChannelStable, "release channel: stable, or nightly to include prereleases")
+	checkOnly := fs.Bool("check-only", false, "report whether an update is available without installing it")
+	force := fs.Bool("force", false, "update even while the filesystem is running")
+	releasesURL := fs.String("url", "", "releases list to query (defaults to the config's updateURL, then GitHub)")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 0 {
+		return errors.New(usage)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	u := &selfupdate.Updater{URL: cfg.UpdateURL}
+	if *releasesURL != "" {
+		u.URL = *releasesURL
+	}
+	if cfg.UpdatePublicKey != "" {
+		if u.PublicKey, err = selfupdate.ParsePublicKey(cfg.UpdatePublicKey); err != nil {
+			return fmt.Errorf("updatePublicKey in %s: %w", configPath(), err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	fmt.Println()
+	step := startStep("Checking for updates")
+	rel, err := u.Latest(ctx, *channel)
+	if err != nil {
+		step.fail(err.Error())
+		return err
+	}
+	if !selfupdate.Newer(version, rel.Tag) {
+		step.succeed(fmt.Sprintf("%s is the latest %s release", version, *channel))
+		fmt.Println()
+		return nil
+	}
+	step.succeed(fmt.Sprintf("%s available %s", rel.Tag, clr(ansiDim, "(running "+version+")")))
+	printChangelog(rel)
+
+	if *checkOnly {
+		fmt.Printf("  %s\n\n", clr(ansiDim, "Run '"+filepath.Base(os.Args[0])+" self-update' to install it"))
+		return nil
+	}
+	if !*force {
+		sts, err := loadState()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cannot tell whether redis-fs is running: %w\nPass --force to update anyway", err)
+		}
+		if _, ok := sts.running(); ok {
+			return fmt.Errorf("redis-fs is currently running\nRun '%s down' first, or pass --force to update anyway", filepath.Base(os.Args[0]))
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	asset := selfupdate.AssetName(runtime.GOOS, runtime.GOARCH)
+	step = startStep("Downloading " + asset)
+	binary, err := u.Download(ctx, rel, asset)
+	if err != nil {
+		step.fail(err.Error())
+		return err
+	}
+	verified := "SHA-256 verified"
+	if u.PublicKey != nil {
+		verified += ", signature verified"
+	}
+	step.succeed(formatBytes(int64(len(binary))) + clr(ansiDim, " ("+verified+")"))
+
+	step = startStep("Installing " + rel.Tag)
+	if err := selfupdate.Install(exe, binary, checkNewBinary); err != nil {
+		step.fail(err.Error())
+		return err
+	}
+	step.succeed(exe + clr(ansiDim, " (previous version kept at "+filepath.Base(exe)+".old)"))
+	fmt.Println()
+	return nil
+}
+
+// checkNewBinary runs a downloaded binary's version command, so one that
+// cannot run here is caught before it replaces the working one.
+func checkNewBinary(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s version: %w: %s", filepath.Base(path), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// printChangelog shows the start of a release's notes.
+func printChangelog(rel *selfupdate.Release) {
+	const maxLines = 15
+	lines := selfupdate.Excerpt(rel.Notes, maxLines)
+	if len(lines) == 0 {
+		return
+	}
+	rows := make([]boxRow, len(lines))
+	for i, l := range lines {
+		rows[i] = boxRow{Value: l}
+	}
+	title := rel.Tag
+	if rel.Name != "" && rel.Name != rel.Tag {
+		title += " · " + rel.Name
+	}
+	printBox(clr(ansiBold, "What's new in "+title), rows)
+}
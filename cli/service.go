@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// service — bring the filesystems up at login with systemd or launchd
+// ---------------------------------------------------------------------------
+//
+// `service install` writes a systemd user unit, or a launchd agent on
+// darwin, that runs `rfs up --foreground` with this config. The service
+// manager owns that process: stopping the service sends it SIGTERM, which
+// brings the filesystems down, and a mount that goes away makes it exit
+// with an error, which the manager answers by restarting it. This avoids
+// Type=forking, which would have to guess which detached daemon to track.
+
+// serviceName is the unit or agent name for the config in use, so each
+// config can have its own: "rfs" for the default config, else rfs- and
+// the config file's name.
+func serviceName() string {
+	cfg := configPath()
+	if abs, err := filepath.Abs(cfg); err == nil {
+		cfg = abs
+	}
+	if cfg == defaultConfigPath() {
+		return "rfs"
+	}
+	base := strings.TrimSuffix(filepath.Base(cfg), filepath.Ext(cfg))
+	base = strings.TrimSuffix(base, ".config")
+	var b strings.Builder
+	for _, r := range base {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	return "rfs-" + b.String()
+}
+
+// launchdLabel is the launchd label of the agent called name.
+func launchdLabel(name string) string {
+	return "com.redis-fs." + name
+}
+
+// serviceFilePath is where the unit or agent called name is installed.
+func serviceFilePath(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(home, "Library", "LaunchAgents", launchdLabel(name)+".plist"), nil
+	}
+	return filepath.Join(home, ".config", "systemd", "user", name+".service"), nil
+}
+
+// systemdUnit is a user unit running exe up --foreground with cfgPath.
+// KillMode=mixed sends SIGTERM to rfs alone, so it can unmount and stop
+// its daemons in order, before anything left is killed.
+func systemdUnit(exe, cfgPath string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Redis-FS (%[2]s)
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+ExecStart=%[1]s --config %[2]s up --foreground
+Restart=on-failure
+RestartSec=5
+KillMode=mixed
+TimeoutStopSec=30
+
+[Install]
+WantedBy=default.target
+`, systemdQuote(exe), systemdQuote(cfgPath))
+}
+
+// systemdQuote quotes s for an ExecStart line when it needs it.
+func systemdQuote(s string) string {
+	if !strings.ContainsAny(s, " \t\"'\\$%") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// launchdPlist is an agent running exe up --foreground with cfgPath at
+// login, and again whenever it exits with an error.
+func launchdPlist(label, exe, cfgPath, logPath string) string {
+	esc := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%s</string>
+		<string>--config</string>
+		<string>%s</string>
+		<string>up</string>
+		<string>--foreground</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>5</integer>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, esc(label), esc(exe), esc(cfgPath), esc(logPath), esc(logPath))
+}
+
+// serviceLogPath is where a launchd agent's output goes; systemd keeps
+// it in the journal.
+func serviceLogPath(name string) string {
+	return filepath.Join(stateDir(), name+".service.log")
+}
+
+// runServiceTool runs a systemctl or launchctl command with its output
+// going to ours.
+func runServiceTool(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func launchdDomain() string {
+	return fmt.Sprintf("gui/%d", os.Getuid())
+}
+
+func cmdService(args []string) error {
+	usage := fmt.Sprintf("Usage: %s service install [--force] | uninstall | status", filepath.Base(os.Args[0]))
+	fs := newFlagSet("service")
+	force := fs.Bool("force", false, "replace a unit that is already installed")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 1 {
+		return errors.New(usage)
+	}
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return fmt.Errorf("service is not supported on %s", runtime.GOOS)
+	}
+	name := serviceName()
+	path, err := serviceFilePath(name)
+	if err != nil {
+		return err
+	}
+	switch pos[0] {
+	case "install":
+		return installService(name, path, *force)
+	case "uninstall":
+		return uninstallService(name, path)
+	case "status":
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no service is installed for %s\nInstall one with '%s service install'", configPath(), filepath.Base(os.Args[0]))
+		}
+		if runtime.GOOS == "darwin" {
+			return runServiceTool("launchctl", "print", launchdDomain()+"/"+launchdLabel(name))
+		}
+		// systemctl status exits non-zero for a stopped unit, which is an
+		// answer rather than a failure.
+		_ = runServiceTool("systemctl", "--user", "status", "--no-pager", name+".service")
+		return nil
+	default:
+		return fmt.Errorf("unknown service command %q\n\n%s", pos[0], usage)
+	}
+}
+
+func installService(name, path string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists\nRe-run with --force to replace it", path)
+	}
+	if _, err := loadConfig(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cfgPath, err := filepath.Abs(configPath())
+	if err != nil {
+		return err
+	}
+	contents := systemdUnit(exe, cfgPath)
+	if runtime.GOOS == "darwin" {
+		contents = launchdPlist(launchdLabel(name), exe, cfgPath, serviceLogPath(name))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	step := startStep("Writing " + filepath.Base(path))
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		step.fail(err.Error())
+		return err
+	}
+	step.succeed(path)
+
+	if runtime.GOOS == "darwin" {
+		// A replaced agent must be unloaded before it is loaded again.
+		_ = exec.Command("launchctl", "bootout", launchdDomain()+"/"+launchdLabel(name)).Run()
+		if err := runServiceTool("launchctl", "bootstrap", launchdDomain(), path); err != nil {
+			return err
+		}
+	} else {
+		if err := runServiceTool("systemctl", "--user", "daemon-reload"); err != nil {
+			return err
+		}
+		if err := runServiceTool("systemctl", "--user", "enable", "--now", name+".service"); err != nil {
+			return err
+		}
+		fmt.Printf("  %s To start it at boot rather than at login: loginctl enable-linger %s\n", clr(ansiDim, "▸"), os.Getenv("USER"))
+	}
+	fmt.Printf("\n  %s %s installed; '%s service status' shows how it is doing\n\n", clr(ansiDim, "■"), name, filepath.Base(os.Args[0]))
+	return nil
+}
+
+func uninstallService(name, path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no service is installed for %s", configPath())
+	}
+	fmt.Println()
+	if runtime.GOOS == "darwin" {
+		if err := runServiceTool("launchctl", "bootout", launchdDomain()+"/"+launchdLabel(name)); err != nil {
+			fmt.Printf("  %s %v\n", clr(ansiYellow, "!"), err)
+		}
+	} else if err := runServiceTool("systemctl", "--user", "disable", "--now", name+".service"); err != nil {
+		fmt.Printf("  %s %v\n", clr(ansiYellow, "!"), err)
+	}
+	step := startStep("Removing " + filepath.Base(path))
+	if err := os.Remove(path); err != nil {
+		step.fail(err.Error())
+		return err
+	}
+	step.succeed(path)
+	if runtime.GOOS != "darwin" {
+		if err := runServiceTool("systemctl", "--user", "daemon-reload"); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("\n  %s %s uninstalled\n\n", clr(ansiDim, "■"), name)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	unit := systemdUnit("/usr/local/bin/rfs", "/home/me/my configs/rfs.json")
+	for _, want := range []string{
+		`ExecStart=/usr/local/bin/rfs --config "/home/me/my configs/rfs.json" up --foreground`,
+		"Type=simple",
+		"Restart=on-failure",
+		"KillMode=mixed",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("unit is missing %q:\n%s", want, unit)
+		}
+	}
+	if got := systemdQuote(`/a/100%$x`); got != `"/a/100%%$$x"` {
+		t.Errorf("systemdQuote = %s", got)
+	}
+}
+
+func TestLaunchdPlist(t *testing.T) {
+	plist := launchdPlist("com.redis-fs.rfs", "/opt/rfs", "/Users/me/a&b.json", "/Users/me/.rfs/rfs.service.log")
+	for _, want := range []string{
+		"<string>com.redis-fs.rfs</string>",
+		"<string>/opt/rfs</string>\n\t\t<string>--config</string>\n\t\t<string>/Users/me/a&amp;b.json</string>\n\t\t<string>up</string>\n\t\t<string>--foreground</string>",
+		"<key>SuccessfulExit</key>\n\t\t<false/>",
+		"<string>/Users/me/.rfs/rfs.service.log</string>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Errorf("plist is missing %q:\n%s", want, plist)
+		}
+	}
+}
+
+func TestServiceName(t *testing.T) {
+	defer func(old string) { cfgPathOverride = old }(cfgPathOverride)
+	t.Setenv(configEnv, "")
+
+	cfgPathOverride = ""
+	if got := serviceName(); got != "rfs" {
+		t.Errorf("default config: serviceName = %q, want rfs", got)
+	}
+	cfgPathOverride = "/etc/rfs/work.config.json"
+	if got := serviceName(); got != "rfs-work" {
+		t.Errorf("serviceName = %q, want rfs-work", got)
+	}
+	cfgPathOverride = "/etc/rfs/my home.json"
+	if got := serviceName(); got != "rfs-my-home" {
+		t.Errorf("serviceName = %q, want rfs-my-home", got)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Post-migration smoke test — compare a sample of the mount to the archive
+// ---------------------------------------------------------------------------
+
+const defaultSmokeSample = 20
+
+type smokeFile struct {
+	rel  string
+	size int64
+}
+
+type smokeMismatch struct {
+	Path    string
+	Problem string
+}
+
+type smokeReport struct {
+	Files      int
+	Dirs       int
+	Symlinks   int
+	Mismatches []smokeMismatch
+}
+
+func (r smokeReport) checked() int { return r.Files + r.Dirs + r.Symlinks }
+
+func (r smokeReport) summary() string {
+	out := fmt.Sprintf("%d files", r.Files)
+	if r.Dirs > 0 {
+		out += fmt.Sprintf(", %d dirs", r.Dirs)
+	}
+	if r.Symlinks > 0 {
+		out += fmt.Sprintf(", %d symlinks", r.Symlinks)
+	}
+	return out + " match"
+}
+
+// runSmokeTest reads a sample of the migrated tree back through the mount
+// and compares it with the archived original. Paths for which skip
+// returns true (conflicts kept from an existing filesystem) are ignored.
+func runSmokeTest(archiveDir, mountpoint string, sample int, rng *rand.Rand, skip func(rel string) bool) (smokeReport, error) {
+	var files []smokeFile
+	var dirs, emptyDirs, links []string
+	err := filepath.WalkDir(archiveDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == archiveDir {
+			return nil
+		}
+		rel, err := filepath.Rel(archiveDir, path)
+		if err != nil {
+			return err
+		}
+		if skip != nil && skip(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.Type()&os.ModeSymlink != 0:
+			links = append(links, rel)
+		case d.IsDir():
+			empty, err := isEmptyDir(path)
+			if err != nil {
+				return err
+			}
+			if empty {
+				emptyDirs = append(emptyDirs, rel)
+			} else {
+				dirs = append(dirs, rel)
+			}
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files = append(files, smokeFile{rel: rel, size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		return smokeReport{}, err
+	}
+
+	var report smokeReport
+	mismatch := func(rel, format string, args ...interface{}) {
+		report.Mismatches = append(report.Mismatches, smokeMismatch{Path: rel, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	for _, f := range pickSmokeFiles(files, sample, rng) {
+		report.Files++
+		want, err := hashFile(filepath.Join(archiveDir, f.rel))
+		if err != nil {
+			return report, err
+		}
+		got, err := hashFile(filepath.Join(mountpoint, f.rel))
+		if err != nil {
+			mismatch(f.rel, "unreadable through the mount: %v", err)
+			continue
+		}
+		if got != want {
+			mismatch(f.rel, "content differs from the archive (%s)", formatBytes(f.size))
+		}
+	}
+
+	// Empty directories are all checked: nothing else in the tree implies
+	// them, so they are the entries most easily lost.
+	for _, rel := range append(emptyDirs, pickSmokeSample(dirs, sample, rng)...) {
+		report.Dirs++
+		orig, err := os.Lstat(filepath.Join(archiveDir, rel))
+		if err != nil {
+			return report, err
+		}
+		st, err := os.Lstat(filepath.Join(mountpoint, rel))
+		switch {
+		case err != nil:
+			mismatch(rel, "missing from the mount: %v", err)
+		case !st.IsDir():
+			mismatch(rel, "is a %s in the mount, not a directory", st.Mode().Type())
+		case st.Mode().Perm() != orig.Mode().Perm():
+			mismatch(rel, "mode %04o, archive has %04o", st.Mode().Perm(), orig.Mode().Perm())
+		}
+	}
+
+	for _, rel := range pickSmokeSample(links, sample, rng) {
+		report.Symlinks++
+		want, err := os.Readlink(filepath.Join(archiveDir, rel))
+		if err != nil {
+			return report, err
+		}
+		got, err := os.Readlink(filepath.Join(mountpoint, rel))
+		switch {
+		case err != nil:
+			mismatch(rel, "not a readable symlink in the mount: %v", err)
+		case got != want:
+			mismatch(rel, "points to %q, archive has %q", got, want)
+		}
+	}
+	return report, nil
+}
+
+// pickSmokeFiles draws up to n files stratified by size, so small,
+// medium, and large files are all represented. The largest file is always
+// included since truncation shows up there first.
+func pickSmokeFiles(files []smokeFile, n int, rng *rand.Rand) []smokeFile {
+	if n <= 0 || len(files) == 0 {
+		return nil
+	}
+	sorted := append([]smokeFile(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].size < sorted[j].size })
+	if len(sorted) <= n {
+		return sorted
+	}
+
+	picked := []smokeFile{sorted[len(sorted)-1]}
+	rest := sorted[:len(sorted)-1]
+	strata := n - 1
+	for i := 0; i < strata; i++ {
+		lo := i * len(rest) / strata
+		hi := (i + 1) * len(rest) / strata
+		if hi > lo {
+			picked = append(picked, rest[lo+rng.Intn(hi-lo)])
+		}
+	}
+	return picked
+}
+
+func pickSmokeSample(paths []string, n int, rng *rand.Rand) []string {
+	if n <= 0 || len(paths) <= n {
+		return paths
+	}
+	out := make([]string, 0, n)
+	for _, i := range rng.Perm(len(paths))[:n] {
+		out = append(out, paths[i])
+	}
+	return out
+}
+
+func hashFile(path string) (string, error) {
+	return hashFileProgress(context.Background(), path, &copyProgress{}, nil)
+}
+
+// hashFileProgress is hashFile for large trees: it adds the bytes read to
+// progress as it goes and stops once ctx is done.
+func hashFileProgress(ctx context.Context, path string, progress *copyProgress, onProgress func(copyProgress)) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, &progressReader{r: ctxReader{ctx, f}, progress: progress, onProgress: onProgress}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// ctxReader ends a read loop once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(b []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+// underConflict reports whether rel lies at or beneath one of the Redis
+// paths an import left untouched because they already existed, or stored
+// differently from the source.
+func underConflict(conflicts []string) func(rel string) bool {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return func(rel string) bool {
+		p := "/" + filepath.ToSlash(rel)
+		for _, c := range conflicts {
+			if p == c || strings.HasPrefix(p, c+"/") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// verifyMigration runs the smoke test as a migration step and prints the
+// mismatches when it fails.
+func verifyMigration(archiveDir, mountpoint string, sample int, stats importStats) error {
+	if sample <= 0 {
+		sample = defaultSmokeSample
+	}
+	step := startStep("Verifying files through the mount")
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	// Rewritten symlinks differ from the archive on purpose.
+	// Excluded entries, and directories pruned for them, are only in the
+	// archive.
+	skipped := append(append([]string(nil), stats.conflictPaths...), stats.excludedPaths...)
+	skipped = append(skipped, stats.prunedPaths...)
+	for _, lr := range stats.rewrittenLinks {
+		skipped = append(skipped, lr.Path)
+	}
+	report, err := runSmokeTest(archiveDir, mountpoint, sample, rng, underConflict(skipped))
+	if err != nil {
+		step.fail(err.Error())
+		return fmt.Errorf("smoke test: %w", err)
+	}
+	if len(report.Mismatches) == 0 {
+		step.succeed(report.summary())
+		return nil
+	}
+	step.fail(fmt.Sprintf("%d of %d sampled entries differ", len(report.Mismatches), report.checked()))
+	printMismatches("Smoke test mismatches", report.Mismatches, 10)
+	return fmt.Errorf("smoke test failed: %d of %d sampled entries differ from the original", len(report.Mismatches), report.checked())
+}
+
+// printMismatches lists mismatches in a box, the first maxRows of them
+// when maxRows is positive.
+func printMismatches(title string, mismatches []smokeMismatch, maxRows int) {
+	var rows []boxRow
+	for i, m := range mismatches {
+		if i == maxRows {
+			rows = append(rows, boxRow{Value: clr(ansiDim, fmt.Sprintf("… and %d more", len(mismatches)-maxRows))})
+			break
+		}
+		rows = append(rows, boxRow{Label: m.Path, Value: m.Problem})
+	}
+	printBox(clr(ansiBold, title), rows)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyTree duplicates the fixture tree so it can stand in for the mount.
+func copyTree(t *testing.T, src string) string {
+	t.Helper()
+	dst := t.TempDir()
+	err := filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil || p == src {
+			return err
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(dst, rel)
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.IsDir():
+			if err := os.Mkdir(target, 0o700); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		default:
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(target, data, info.Mode().Perm())
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+func TestSmokeTestIdenticalTreePasses(t *testing.T) {
+	archive := writeFixtureTree(t)
+	mount := copyTree(t, archive)
+
+	report, err := runSmokeTest(archive, mount, defaultSmokeSample, rand.New(rand.NewSource(1)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Mismatches) != 0 {
+		t.Fatalf("mismatches on identical trees: %+v", report.Mismatches)
+	}
+	if report.Files != 4 || report.Dirs != 4 || report.Symlinks != 1 {
+		t.Fatalf("report %+v", report)
+	}
+}
+
+func TestSmokeTestReportsDifferences(t *testing.T) {
+	archive := writeFixtureTree(t)
+	mount := copyTree(t, archive)
+	if err := os.WriteFile(filepath.Join(mount, "src", "main.go"), []byte("pack"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(mount, "link")
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("README.md", link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(mount, "src", "run.sh")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := runSmokeTest(archive, mount, defaultSmokeSample, rand.New(rand.NewSource(1)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, m := range report.Mismatches {
+		got[m.Path] = m.Problem
+	}
+	if len(got) != 3 {
+		t.Fatalf("mismatches %+v", report.Mismatches)
+	}
+	for path, want := range map[string]string{
+		filepath.Join("src", "main.go"): "content differs",
+		filepath.Join("src", "run.sh"):  "unreadable",
+		"link":                          "points to",
+	} {
+		if !strings.Contains(got[path], want) {
+			t.Errorf("%s: problem %q, want it to mention %q", path, got[path], want)
+		}
+	}
+}
+
+func TestSmokeTestFlagsMissingEmptyDir(t *testing.T) {
+	archive := writeFixtureTree(t)
+	mount := copyTree(t, archive)
+	if err := os.Remove(filepath.Join(mount, "empty")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A sample of one would usually miss it; empty directories are
+	// always checked.
+	report, err := runSmokeTest(archive, mount, 1, rand.New(rand.NewSource(1)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Path != "empty" {
+		t.Fatalf("mismatches %+v", report.Mismatches)
+	}
+}
+
+func TestSmokeTestSkipsConflicts(t *testing.T) {
+	archive := writeFixtureTree(t)
+	mount := copyTree(t, archive)
+	// A merge that kept existing entries leaves the mount differing there.
+	if err := os.WriteFile(filepath.Join(mount, "README.md"), []byte("# existing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(mount, "src", "deep")); err != nil {
+		t.Fatal(err)
+	}
+
+	skip := underConflict([]string{"/README.md", "/src/deep"})
+	report, err := runSmokeTest(archive, mount, defaultSmokeSample, rand.New(rand.NewSource(1)), skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Mismatches) != 0 {
+		t.Fatalf("conflicting paths were checked: %+v", report.Mismatches)
+	}
+	if report.Files != 2 || report.Dirs != 2 {
+		t.Fatalf("report %+v", report)
+	}
+	if skip("src") || skip("README.md.bak") || !skip(filepath.Join("src", "deep", "er")) {
+		t.Fatal("underConflict matched the wrong paths")
+	}
+}
+
+func TestPickSmokeFilesStratified(t *testing.T) {
+	var files []smokeFile
+	for i := 0; i < 100; i++ {
+		files = append(files, smokeFile{rel: string(rune('a'+i%26)) + "/" + string(rune('0'+i/26)), size: int64(i)})
+	}
+	rng := rand.New(rand.NewSource(7))
+
+	picked := pickSmokeFiles(files, 5, rng)
+	if len(picked) != 5 {
+		t.Fatalf("picked %d files, want 5", len(picked))
+	}
+	if picked[0].size != 99 {
+		t.Fatalf("largest file not picked first: %+v", picked)
+	}
+	// The remaining 99 files fall into four strata of ~25 sizes each.
+	for i, f := range picked[1:] {
+		lo, hi := int64(i*99/4), int64((i+1)*99/4)
+		if f.size < lo || f.size >= hi {
+			t.Errorf("pick %d has size %d, outside stratum [%d, %d)", i, f.size, lo, hi)
+		}
+	}
+
+	if got := pickSmokeFiles(files[:3], 5, rng); len(got) != 3 {
+		t.Fatalf("small tree: picked %d files, want all 3", len(got))
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Stale state — filesystems recorded as up whose processes are gone
+// ---------------------------------------------------------------------------
+//
+// A crashed mount daemon or a reboot leaves state.json describing a
+// filesystem that is no longer there. An entry is stale when its mount
+// daemon has exited and its mountpoint is no longer in the mount table;
+// up drops such entries with a warning and carries on. An exited daemon
+// whose mount is still listed has left a wedged mount behind, which down
+// and clean unmount (lazily when nothing else works). clean also deletes
+// pidfiles of managed Redis servers that are no longer running.
+
+// managedPidfileGlob matches the pidfiles startRedisDaemon has servers
+// write.
+const managedPidfileGlob = "/tmp/rfs-*.pid"
+
+// mountedAt reports whether mountpoint is in the mount table; tests
+// replace it.
+var mountedAt = func(mountpoint string) bool {
+	_, ok := mountTableEntry(mountpoint)
+	return ok
+}
+
+// mountDaemonAlive reports whether st's mount daemon is still running.
+func (st state) mountDaemonAlive() bool {
+	return st.MountPID > 0 && processAlive(st.MountPID)
+}
+
+// stale reports whether st describes a filesystem that has gone away
+// without a trace: its mount daemon exited and nothing is mounted.
+func (st state) stale() bool {
+	return !st.mountDaemonAlive() && !mountedAt(st.Mountpoint)
+}
+
+// wedged reports whether st's mount daemon exited but left its mount.
+func (st state) wedged() bool {
+	return !st.mountDaemonAlive() && mountedAt(st.Mountpoint)
+}
+
+// staleNames lists the stale filesystems in sts, in name order.
+func (s states) staleNames() []string {
+	var names []string
+	for _, name := range s.names() {
+		if s[name].stale() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// pruneStale drops the stale filesystems from sts and from store, warning
+// about each, and returns what is left.
+func pruneStale(store *stateStore, sts states) (states, error) {
+	names := sts.staleNames()
+	if len(names) == 0 {
+		return sts, nil
+	}
+	for _, name := range names {
+		fmt.Printf("  %s %s\n", clr(ansiYellow, "!"), staleReason(name, sts[name]))
+		delete(sts, name)
+	}
+	if len(sts) == 0 {
+		return sts, store.clear()
+	}
+	return sts, store.save(sts)
+}
+
+// staleReason explains why name's state entry is being dropped.
+func staleReason(name string, st state) string {
+	if st.MountPID > 0 {
+		return fmt.Sprintf("%s was left behind: its mount daemon (pid %d) exited and %s is not mounted; clearing its state", name, st.MountPID, st.Mountpoint)
+	}
+	return fmt.Sprintf("%s was left behind: %s is not mounted; clearing its state", name, st.Mountpoint)
+}
+
+// orphanedPidfiles lists the pidfiles matching pattern whose process is
+// no longer running.
+func orphanedPidfiles(pattern string) ([]string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var orphans []string
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil || !processAlive(pid) {
+			orphans = append(orphans, p)
+		}
+	}
+	return orphans, nil
+}
+
+func cmdClean(args []string) error {
+	usage := fmt.Sprintf("Usage: %s clean", filepath.Base(os.Args[0]))
+	fs := newFlagSet("clean")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) > 0 {
+		return fmt.Errorf("unexpected arguments %v\n\n%s", pos, usage)
+	}
+	if c, err := dialDaemon(); err == nil {
+		c.Close()
+		return fmt.Errorf("the rfs daemon is running and keeps its own state\nStop it with '%s daemon stop' first", filepath.Base(os.Args[0]))
+	} else if !errors.Is(err, errNoDaemon) {
+		return err
+	}
+
+	fmt.Println()
+	cleaned := 0
+	err = withState(func(s *stateStore) error {
+		sts, err := s.load()
+		if errors.Is(err, os.ErrNotExist) {
+			sts = states{}
+		} else if err != nil {
+			return err
+		}
+		for _, name := range sts.names() {
+			st := sts[name]
+			switch {
+			case st.mountDaemonAlive():
+				fmt.Printf("  %s %s is running; leaving it to '%s down %s'\n", clr(ansiDim, "▸"), name, filepath.Base(os.Args[0]), name)
+				continue
+			case st.wedged():
+				if err := stopMount(st, true); err != nil {
+					return err
+				}
+			}
+			step := startStep("Clearing state of " + name)
+			step.succeed(st.Mountpoint)
+			delete(sts, name)
+			cleaned++
+		}
+		if len(sts) > 0 {
+			return s.save(sts)
+		}
+		// No filesystem is up, so any hold this profile still has on a
+		// managed Redis server is left over too.
+		rels, err := releaseOrphanedRedis(redisProfile())
+		for _, rel := range rels {
+			reportRedisRelease(rel)
+			cleaned++
+		}
+		if err != nil {
+			return err
+		}
+		return s.clear()
+	})
+	if err != nil {
+		return err
+	}
+
+	pidfiles, err := orphanedPidfiles(managedPidfileGlob)
+	if err != nil {
+		return err
+	}
+	for _, p := range pidfiles {
+		step := startStep("Removing orphaned pidfile")
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			step.fail(err.Error())
+			return err
+		}
+		step.succeed(p)
+		cleaned++
+	}
+
+	if cleaned == 0 {
+		fmt.Printf("  %s Nothing to clean\n", clr(ansiDim, "■"))
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPruneStale(t *testing.T) {
+	t.Setenv(configEnv, filepath.Join(t.TempDir(), "rfs.config.json"))
+	wedgedAt := filepath.Join(t.TempDir(), "wedged")
+	saved := mountedAt
+	mountedAt = func(mp string) bool { return mp == wedgedAt }
+	t.Cleanup(func() { mountedAt = saved })
+
+	sts := states{
+		"crashed": {Name: "crashed", MountPID: 999999999, Mountpoint: filepath.Join(t.TempDir(), "crashed")},
+		"live":    {Name: "live", MountPID: os.Getpid(), Mountpoint: filepath.Join(t.TempDir(), "live")},
+		"wedged":  {Name: "wedged", MountPID: 999999999, Mountpoint: wedgedAt},
+	}
+	if got := sts.staleNames(); len(got) != 1 || got[0] != "crashed" {
+		t.Fatalf("stale: %v", got)
+	}
+	if !sts["wedged"].wedged() || sts["live"].wedged() || sts["crashed"].wedged() {
+		t.Fatal("wedged misjudged")
+	}
+
+	err := withState(func(s *stateStore) error {
+		if err := s.save(sts); err != nil {
+			return err
+		}
+		_, err := pruneStale(s, sts)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left, err := loadState()
+	if err != nil || len(left) != 2 || left["crashed"].Mountpoint != "" {
+		t.Fatalf("after prune: %+v, %v", left, err)
+	}
+}
+
+func TestOrphanedPidfiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("rfs-6380.pid", strconv.Itoa(os.Getpid())+"\n")
+	write("rfs-6381.pid", "999999999\n")
+	write("rfs-6382.pid", "garbage")
+	write("other-6383.pid", "999999999\n")
+
+	got, err := orphanedPidfiles(filepath.Join(dir, "rfs-*.pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || filepath.Base(got[0]) != "rfs-6381.pid" || filepath.Base(got[1]) != "rfs-6382.pid" {
+		t.Fatalf("orphans: %v", got)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// State store: state.json guarded by a lock file
+// ---------------------------------------------------------------------------
+//
+// Two rfs commands racing, say an `up` against a `down` from a systemd
+// unit, could interleave their reads and writes of state.json and leave it
+// describing neither. Every command that changes the state holds an
+// exclusive flock on state.json.lock from the moment it reads the state
+// until it has written it; commands that only look take a shared lock.
+// The lock is not reentrant: code running under withState uses the store
+// it was given rather than loadState.
+//
+// up waits for Redis and the mount for up to --wait-redis, longer than
+// anyone should wait for the lock, so it holds the lock only to check what
+// is running and again to record what it started. In between, a lock of
+// the filesystem's own keeps a second up from starting it too.
+
+// stateLockWait bounds how long a command waits for another to finish.
+// Nothing holds the lock across a wait for Redis or a mount.
+var stateLockWait = 15 * time.Second
+
+func stateLockPath() string {
+	return statePath() + ".lock"
+}
+
+// stateStore is state.json, held locked until unlock.
+type stateStore struct {
+	lock      *os.File
+	exclusive bool
+}
+
+// lockState takes the state lock, exclusive for a command that will change
+// the state, waiting up to stateLockWait for another command to finish.
+func lockState(exclusive bool) (*stateStore, error) {
+	if exclusive {
+		if err := os.MkdirAll(runDir(), 0o700); err != nil {
+			return nil, err
+		}
+	}
+	// Without the state directory there is no state to read: the open
+	// fails with os.ErrNotExist, which readers take as not running.
+	f, err := os.OpenFile(stateLockPath(), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	deadline := time.Now().Add(stateLockWait)
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %w", stateLockPath(), err)
+		}
+		if time.Now().After(deadline) {
+			holder := stateLockHolder(f)
+			f.Close()
+			return nil, holder
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if exclusive {
+		// Name ourselves for anyone kept waiting.
+		_ = f.Truncate(0)
+		_, _ = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &stateStore{lock: f, exclusive: exclusive}, nil
+}
+
+// stateBusyError reports a state lock that did not come free in time.
+type stateBusyError struct {
+	pid int // the last exclusive holder, when it is still alive
+}
+
+func (e *stateBusyError) Error() string {
+	if e.pid > 0 {
+		return fmt.Sprintf("another rfs command is running (pid %d)\nWait for it to finish and try again", e.pid)
+	}
+	return "another rfs command is running\nWait for it to finish and try again"
+}
+
+// stateLockHolder names the process that last took the lock exclusively.
+// A shared holder leaves no name, so a pid that has exited is left out.
+func stateLockHolder(f *os.File) error {
+	b := make([]byte, 32)
+	n, _ := f.ReadAt(b, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b[:n])))
+	if err != nil || !processAlive(pid) {
+		pid = 0
+	}
+	return &stateBusyError{pid: pid}
+}
+
+// unlock releases the lock; the store cannot be used afterwards.
+func (s *stateStore) unlock() {
+	_ = syscall.Flock(int(s.lock.Fd()), syscall.LOCK_UN)
+	s.lock.Close()
+}
+
+// load reads the state; a missing file is os.ErrNotExist.
+func (s *stateStore) load() (states, error) {
+	b, err := os.ReadFile(statePath())
+	if err != nil {
+		return nil, err
+	}
+	sts, err := decodeStates(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", statePath(), err)
+	}
+	return sts, nil
+}
+
+// save replaces the state, atomically, so a reader never sees half of it.
+// With no filesystem left up there is nothing to record, and the state is
+// cleared.
+func (s *stateStore) save(sts states) error {
+	if !s.exclusive {
+		return errors.New("state saved under a shared lock")
+	}
+	if len(sts) == 0 {
+		return s.clear()
+	}
+	b, err := json.MarshalIndent(stateFile{Filesystems: sts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(runDir(), ".state.json.tmp")
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statePath())
+}
+
+// clear removes the state, as when every filesystem has been brought down.
+func (s *stateStore) clear() error {
+	if !s.exclusive {
+		return errors.New("state cleared under a shared lock")
+	}
+	if err := os.Remove(statePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// withState runs fn holding the exclusive state lock.
+func withState(fn func(s *stateStore) error) error {
+	s, err := lockState(true)
+	if err != nil {
+		return err
+	}
+	defer s.unlock()
+	return fn(s)
+}
+
+// reserveFilesystem keeps any other command from starting the filesystem
+// name until release is called. It fails at once, rather than wait, when
+// another command is starting it.
+func reserveFilesystem(name string) (release func(), err error) {
+	if err := os.MkdirAll(runDir(), 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(runDir(), "up-"+name+".lock")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%s is being started by another rfs command\nWait for it to finish and try again", name)
+		}
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// loadState reads the state under a shared lock, for commands that only
+// look at it.
+func loadState() (states, error) {
+	s, err := lockState(false)
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlock()
+	return s.load()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStateStoreSerializesUpdates(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := withState(func(s *stateStore) error {
+				sts, err := s.load()
+				if errors.Is(err, os.ErrNotExist) {
+					sts = states{}
+				} else if err != nil {
+					return err
+				}
+				// Widen the window a lost update would need.
+				time.Sleep(2 * time.Millisecond)
+				st := sts["myfs"]
+				st.RedisDB++
+				sts["myfs"] = st
+				return s.save(sts)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	sts, err := loadState()
+	if err != nil || sts["myfs"].RedisDB != workers {
+		t.Fatalf("after %d increments: %d, %v", workers, sts["myfs"].RedisDB, err)
+	}
+}
+
+func TestStateStoreContention(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	orig := stateLockWait
+	stateLockWait = 100 * time.Millisecond
+	t.Cleanup(func() { stateLockWait = orig })
+
+	if _, err := loadState(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loadState with no state directory: %v", err)
+	}
+
+	held, err := lockState(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var busy *stateBusyError
+	if _, err := loadState(); !errors.As(err, &busy) || busy.pid != os.Getpid() {
+		t.Fatalf("read while locked: %v", err)
+	}
+	if err := withState(func(*stateStore) error { return nil }); !errors.As(err, &busy) {
+		t.Fatalf("update while locked: %v", err)
+	}
+	held.unlock()
+
+	// Readers share the lock, and cannot write under it.
+	a, err := lockState(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.unlock()
+	b, err := lockState(false)
+	if err != nil {
+		t.Fatalf("second reader: %v", err)
+	}
+	defer b.unlock()
+	if err := b.save(states{"myfs": {}}); err == nil {
+		t.Fatal("saved under a shared lock")
+	}
+}
+
+func TestReserveFilesystem(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	release, err := reserveFilesystem("myfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reserveFilesystem("myfs"); err == nil {
+		t.Fatal("reserved twice")
+	}
+	// Another filesystem, and the state, stay free meanwhile.
+	other, err := reserveFilesystem("notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+	if err := withState(func(*stateStore) error { return nil }); err != nil {
+		t.Fatalf("state lock while starting: %v", err)
+	}
+	if err := startServices(config{RedisKey: "myfs"}); err == nil || !strings.Contains(err.Error(), "being started") {
+		t.Fatalf("start while reserved: %v", err)
+	}
+	release()
+	if release, err = reserveFilesystem("myfs"); err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+	release()
+}
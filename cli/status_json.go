@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// status --json — machine-readable status for scripts and healthchecks
+// ---------------------------------------------------------------------------
+//
+// The exit code answers the healthcheck question on its own: 0 when every
+// filesystem shown is mounted with its daemon and Redis alive, 3 when none
+// is up, 4 when one is recorded as up but its mount or daemon has died, and
+// 5 when the mounts are up but a Redis server behind one does not answer.
+
+const (
+	statusExitStopped   = 3
+	statusExitMountDead = 4
+	statusExitRedisDead = 5
+)
+
+// fsStatusJSON is one filesystem's state with what status works out
+// from it.
+type fsStatusJSON struct {
+	Name string `json:"name"`
+	state
+	Mounted       bool  `json:"mounted"`
+	MountAlive    bool  `json:"mount_alive"`
+	RedisAlive    bool  `json:"redis_alive"`
+	UptimeSeconds int64 `json:"uptime_seconds"`
+}
+
+type statusJSON struct {
+	Status      string         `json:"status"` // running, stopped, mount_dead or redis_dead
+	Filesystems []fsStatusJSON `json:"filesystems"`
+}
+
+// statusReport builds the JSON status of list, or only the filesystem
+// called name, and the exit code that goes with it.
+func statusReport(list []fsStatus, name string, now time.Time, redisAlive func(state) bool) (statusJSON, int) {
+	out := statusJSON{Status: "running", Filesystems: []fsStatusJSON{}}
+	code := 0
+	for _, fs := range list {
+		if name != "" && fs.Name != name {
+			continue
+		}
+		st := fs.State
+		st.Name = fs.Name
+		f := fsStatusJSON{
+			Name:          fs.Name,
+			state:         st,
+			Mounted:       fs.Mounted,
+			MountAlive:    fs.MountAlive,
+			RedisAlive:    redisAlive(st),
+			UptimeSeconds: int64(now.Sub(st.StartedAt).Seconds()),
+		}
+		out.Filesystems = append(out.Filesystems, f)
+		switch {
+		case !f.Mounted || !f.MountAlive:
+			out.Status, code = "mount_dead", statusExitMountDead
+		case !f.RedisAlive && code == 0:
+			out.Status, code = "redis_dead", statusExitRedisDead
+		}
+	}
+	if len(out.Filesystems) == 0 {
+		out.Status, code = "stopped", statusExitStopped
+	}
+	return out, code
+}
+
+// pingStateRedis reports whether the Redis server st uses answers a PING.
+func pingStateRedis(st state) bool {
+	if st.ManageRedis && !processAlive(st.RedisPID) {
+		return false
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		cfg = config{}
+	}
+	cfg.RedisAddr, cfg.RedisDB = st.RedisAddr, st.RedisDB
+	rdb := newRedisClient(cfg, 1)
+	defer rdb.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return rdb.Ping(ctx).Err() == nil
+}
+
+// printStatusJSON prints the status of list as JSON and returns an
+// exitStatus when it is not healthy.
+func printStatusJSON(list []fsStatus, name string) error {
+	out, code := statusReport(list, name, time.Now(), pingStateRedis)
+	b, _ := json.MarshalIndent(out, "", "  ")
+	fmt.Println(string(b))
+	if code != 0 {
+		return exitStatus(code)
+	}
+	return nil
+}
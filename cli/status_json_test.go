@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestStatusReport(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	up := state{StartedAt: now.Add(-90 * time.Second), RedisKey: "notes-v2", Mountpoint: "/home/me/notes", MountPID: 10}
+	list := []fsStatus{
+		{Name: "notes", Mounted: true, MountAlive: true, State: up},
+		{Name: "projects", Mounted: true, MountAlive: false, State: state{StartedAt: now, RedisKey: "projects"}},
+	}
+	alive := func(state) bool { return true }
+
+	out, code := statusReport(list, "notes", now, alive)
+	if code != 0 || out.Status != "running" || len(out.Filesystems) != 1 {
+		t.Fatalf("notes: %d %+v", code, out)
+	}
+	if out, code := statusReport(list, "", now, alive); code != statusExitMountDead || out.Status != "mount_dead" || len(out.Filesystems) != 2 {
+		t.Fatalf("all: %d %+v", code, out)
+	}
+	redisDown := func(state) bool { return false }
+	if out, code := statusReport(list, "notes", now, redisDown); code != statusExitRedisDead || out.Status != "redis_dead" || out.Filesystems[0].RedisAlive {
+		t.Fatalf("notes with Redis down: %d %+v", code, out)
+	}
+	if out, code := statusReport(list, "", now, redisDown); code != statusExitMountDead || out.Status != "mount_dead" {
+		t.Fatalf("all with Redis down: %d %+v", code, out)
+	}
+	if out, code := statusReport(nil, "", now, alive); code != statusExitStopped || out.Status != "stopped" {
+		t.Fatalf("none: %d %+v", code, out)
+	}
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Filesystems []map[string]interface{} `json:"filesystems"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	fs := got.Filesystems[0]
+	for field, want := range map[string]interface{}{
+		"name": "notes", "redis_key": "notes-v2", "mountpoint": "/home/me/notes", "mount_pid": 10.0,
+		"mounted": true, "mount_alive": true, "redis_alive": true, "uptime_seconds": 90.0,
+	} {
+		if fs[field] != want {
+			t.Errorf("%s = %v, want %v", field, fs[field], want)
+		}
+	}
+}
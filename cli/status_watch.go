@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ---------------------------------------------------------------------------
+// status --watch — redraw the status box with live Redis stats
+// ---------------------------------------------------------------------------
+
+const defaultStatusInterval = 2 * time.Second
+
+// statusArgs is what status was asked to show, and how.
+type statusArgs struct {
+	name     string
+	watch    bool
+	interval time.Duration
+	json     bool
+}
+
+// parseStatusArgs parses status's arguments: the name of one filesystem
+// to show, --json (or --format json|text), and --watch, which takes an
+// optional interval, either a duration ("500ms") or whole seconds ("5"),
+// as the next argument or after "=". An interval must follow --watch
+// directly, so a name goes before it or is given with --watch=interval.
+func parseStatusArgs(args []string) (statusArgs, error) {
+	usage := fmt.Sprintf("Usage: %s status [name] [--watch [interval] | --json]", filepath.Base(os.Args[0]))
+	sa := statusArgs{interval: defaultStatusInterval}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		name, value, hasValue := strings.Cut(a, "=")
+		if !strings.HasPrefix(a, "-") && sa.name == "" {
+			sa.name = a
+			continue
+		}
+		switch name {
+		case "--json", "-json":
+			if hasValue {
+				return statusArgs{}, fmt.Errorf("--json takes no value\n\n%s", usage)
+			}
+			sa.json = true
+			continue
+		case "--format", "-format":
+			if !hasValue && i+1 < len(args) {
+				i++
+				value, hasValue = args[i], true
+			}
+			switch value {
+			case "json":
+				sa.json = true
+			case "text":
+				sa.json = false
+			default:
+				return statusArgs{}, fmt.Errorf("--format must be json or text\n\n%s", usage)
+			}
+			continue
+		case "--watch", "-watch", "-w":
+		default:
+			return statusArgs{}, fmt.Errorf("unknown argument %q\n\n%s", a, usage)
+		}
+		sa.watch = true
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			value, hasValue = args[i], true
+		}
+		if hasValue {
+			var err error
+			if sa.interval, err = parseStatusInterval(value); err != nil {
+				return statusArgs{}, fmt.Errorf("%w\n\n%s", err, usage)
+			}
+		}
+	}
+	if sa.watch && sa.json {
+		return statusArgs{}, fmt.Errorf("--watch and --json cannot be combined\n\n%s", usage)
+	}
+	return sa, nil
+}
+
+func parseStatusInterval(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		n, nerr := strconv.ParseFloat(s, 64)
+		if nerr != nil {
+			return 0, fmt.Errorf("invalid interval %q (expected seconds or a duration such as 500ms)", s)
+		}
+		d = time.Duration(n * float64(time.Second))
+	}
+	if d < 100*time.Millisecond {
+		return 0, fmt.Errorf("interval %v is too short (minimum 100ms)", d)
+	}
+	return d, nil
+}
+
+// statusSample is one observation of the filesystem's services, shared by
+// everything that samples them repeatedly.
+type statusSample struct {
+	At         time.Time
+	State      *state // nil when nothing is running
+	Mounted    bool
+	MountAlive bool
+	DaemonPID  int         // 0 without an rfs daemon
+	Redis      *redisStats // nil when not asked for or unreachable
+	RedisErr   error
+}
+
+// redisStats are the live server figures shown beside the status.
+type redisStats struct {
+	OpsPerSec  int64
+	UsedMemory int64
+	Clients    int64
+}
+
+// phase names the sample's overall condition for transition tracking.
+func (s statusSample) phase() string {
+	switch {
+	case s.State == nil:
+		return "not running"
+	case s.Mounted && s.MountAlive:
+		return "mounted"
+	case s.Mounted:
+		return "mount daemon down"
+	default:
+		return "not mounted"
+	}
+}
+
+// sampleStatus observes the services of the filesystem called name, or
+// the first one up, through the rfs daemon when one is running, and with
+// withRedis also asks Redis for its live stats.
+func sampleStatus(ctx context.Context, name string, withRedis bool) (statusSample, error) {
+	s := statusSample{At: time.Now()}
+	var list []fsStatus
+	if c, err := dialDaemon(); err == nil {
+		defer c.Close()
+		cs, err := c.call(controlRequest{Op: opStatus})
+		if err != nil {
+			return s, err
+		}
+		s.DaemonPID, list = cs.DaemonPID, cs.Filesystems
+	} else if !errors.Is(err, errNoDaemon) {
+		return s, err
+	} else {
+		sts, err := loadState()
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+		if list, err = probeStates(sts); err != nil {
+			return s, err
+		}
+	}
+	for _, fs := range list {
+		if name == "" || fs.Name == name {
+			st := fs.State
+			st.Name = fs.Name
+			s.State, s.Mounted, s.MountAlive = &st, fs.Mounted, fs.MountAlive
+			break
+		}
+	}
+	if withRedis && s.State != nil {
+		s.Redis, s.RedisErr = sampleRedisStats(ctx, *s.State)
+	}
+	return s, nil
+}
+
+// sampleRedisStats reads ops/sec, memory, and client count from INFO.
+func sampleRedisStats(ctx context.Context, st state) (*redisStats, error) {
+	cfg, _ := loadConfig()
+	cfg.RedisAddr, cfg.RedisDB = st.RedisAddr, st.RedisDB
+	rdb := newRedisClient(cfg, 1)
+	defer rdb.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	text, err := rdb.Info(ctx, "stats", "memory", "clients").Result()
+	if err != nil {
+		return nil, err
+	}
+	info := parseRedisInfo(text)
+	num := func(field string) int64 {
+		n, _ := strconv.ParseInt(info[field], 10, 64)
+		return n
+	}
+	return &redisStats{
+		OpsPerSec:  num("instantaneous_ops_per_sec"),
+		UsedMemory: num("used_memory"),
+		Clients:    num("connected_clients"),
+	}, nil
+}
+
+// parseRedisInfo turns INFO output into field/value pairs.
+func parseRedisInfo(text string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// statusTransition is the latest change of phase seen while watching.
+type statusTransition struct {
+	from, to string
+	at       time.Time
+}
+
+// watchStatus redraws the status every interval until ctrl-C or q. When
+// stdout is not a terminal it prints one line per sample instead.
+func watchStatus(name string, interval time.Duration) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	if colorTerm {
+		if stdinIsTerminal() {
+			if restoreTerm, err := readKeys(func(b byte) {
+				if b == 'q' || b == 'Q' {
+					cancel()
+				}
+			}); err == nil {
+				defer restoreTerm()
+			}
+		}
+		hideCursor()
+		defer showCursor()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var prev *statusSample
+	var change *statusTransition
+	for {
+		s, err := sampleStatus(ctx, name, true)
+		if prev != nil && err == nil && s.phase() != prev.phase() {
+			change = &statusTransition{from: prev.phase(), to: s.phase(), at: s.At}
+		}
+		if colorTerm {
+			drawStatusFrame(s, err, change, interval)
+		} else {
+			fmt.Println(statusLine(s, err))
+		}
+		if err == nil {
+			prev = &s
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// drawStatusFrame clears the terminal and draws one frame of the watch.
+func drawStatusFrame(s statusSample, err error, change *statusTransition, interval time.Duration) {
+	fmt.Print(ansiClearScr)
+	switch {
+	case err != nil:
+		printBox(clr(ansiRed, "✗")+" cannot read status", []boxRow{{Value: err.Error()}})
+	case s.State == nil:
+		rows := []boxRow{{Label: "start", Value: clr(ansiCyan, "rfs up")}}
+		if s.DaemonPID > 0 {
+			rows = append(rows, daemonRow(s.DaemonPID))
+		}
+		if change != nil {
+			rows = append(rows, transitionRow(change))
+		}
+		printBox(clr(ansiDim, "○")+" redis-fs is not running", rows)
+	default:
+		var extra []boxRow
+		if s.DaemonPID > 0 {
+			extra = append(extra, daemonRow(s.DaemonPID))
+		}
+		extra = append(extra, boxRow{})
+		if s.Redis != nil {
+			extra = append(extra,
+				boxRow{Label: "ops/sec", Value: strconv.FormatInt(s.Redis.OpsPerSec, 10)},
+				boxRow{Label: "memory", Value: formatBytes(s.Redis.UsedMemory)},
+				boxRow{Label: "clients", Value: strconv.FormatInt(s.Redis.Clients, 10)})
+		} else {
+			extra = append(extra, boxRow{Label: "ops/sec", Value: clr(ansiDim, "Redis unreachable")})
+		}
+		if change != nil {
+			extra = append(extra, transitionRow(change))
+		}
+		if perr := printStatus(*s.State, s.Mounted, s.MountAlive, extra); perr != nil {
+			fmt.Printf("  %s %v\n", clr(ansiRed, "✗"), perr)
+		}
+	}
+	fmt.Printf("  %s\n", clr(ansiDim, fmt.Sprintf("%s · every %v · q or ctrl-c to quit", s.At.Format("15:04:05"), interval)))
+}
+
+// transitionRow highlights the latest change, green when it came up and
+// red when it went down.
+func transitionRow(c *statusTransition) boxRow {
+	color := ansiRed
+	if c.to == "mounted" {
+		color = ansiGreen
+	}
+	return boxRow{Label: "changed", Value: clr(ansiBold+color, c.from+" → "+c.to) + clr(ansiDim, " at "+c.at.Format("15:04:05"))}
+}
+
+// statusLine is a sample as a single line, for watching without a
+// terminal.
+func statusLine(s statusSample, err error) string {
+	at := s.At.Format(time.RFC3339)
+	if err != nil {
+		return fmt.Sprintf("%s error=%q", at, err.Error())
+	}
+	line := fmt.Sprintf("%s state=%q", at, s.phase())
+	if s.State == nil {
+		return line
+	}
+	line += fmt.Sprintf(" mount_pid=%d", s.State.MountPID)
+	if s.State.ManageRedis {
+		line += fmt.Sprintf(" redis_pid=%d", s.State.RedisPID)
+	}
+	if s.Redis != nil {
+		line += fmt.Sprintf(" ops_per_sec=%d used_memory=%d clients=%d", s.Redis.OpsPerSec, s.Redis.UsedMemory, s.Redis.Clients)
+	} else if s.RedisErr != nil {
+		line += " redis=unreachable"
+	}
+	return line
+}
+
+// readKeys switches the terminal on stdin to unbuffered input without echo
+// and hands each key pressed to onKey. Signals such as ctrl-C still work.
+// The returned function restores the terminal.
+func readKeys(onKey func(byte)) (restore func(), err error) {
+	fd := os.Stdin.Fd()
+	var orig syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&orig))); errno != 0 {
+		return nil, errno
+	}
+	raw := orig
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN], raw.Cc[syscall.VTIME] = 1, 0
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&raw))); errno != 0 {
+		return nil, errno
+	}
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if n, err := os.Stdin.Read(buf); err != nil {
+				return
+			} else if n == 1 {
+				onKey(buf[0])
+			}
+		}
+	}()
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&orig)))
+	}, nil
+}
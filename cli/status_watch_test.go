@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatusArgs(t *testing.T) {
+	cases := []struct {
+		args []string
+		want statusArgs
+	}{
+		{nil, statusArgs{interval: defaultStatusInterval}},
+		{[]string{"--watch"}, statusArgs{watch: true, interval: defaultStatusInterval}},
+		{[]string{"--watch", "5"}, statusArgs{watch: true, interval: 5 * time.Second}},
+		{[]string{"--watch=500ms"}, statusArgs{watch: true, interval: 500 * time.Millisecond}},
+		{[]string{"-w", "1.5"}, statusArgs{watch: true, interval: 1500 * time.Millisecond}},
+		{[]string{"notes"}, statusArgs{name: "notes", interval: defaultStatusInterval}},
+		{[]string{"notes", "--watch", "5"}, statusArgs{name: "notes", watch: true, interval: 5 * time.Second}},
+		{[]string{"--watch=5", "notes"}, statusArgs{name: "notes", watch: true, interval: 5 * time.Second}},
+		{[]string{"--json"}, statusArgs{interval: defaultStatusInterval, json: true}},
+		{[]string{"--format", "json", "notes"}, statusArgs{name: "notes", interval: defaultStatusInterval, json: true}},
+		{[]string{"--json", "--format=text"}, statusArgs{interval: defaultStatusInterval}},
+	}
+	for _, tc := range cases {
+		got, err := parseStatusArgs(tc.args)
+		if err != nil || got != tc.want {
+			t.Errorf("parseStatusArgs(%q) = %+v, %v", tc.args, got, err)
+		}
+	}
+	for _, bad := range [][]string{{"--watch", "soon"}, {"--watch=10ms"}, {"--json=yes"}, {"--format", "yaml"}, {"--json", "--watch"}, {"notes", "projects"}} {
+		if _, err := parseStatusArgs(bad); err == nil {
+			t.Errorf("parseStatusArgs(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseRedisInfo(t *testing.T) {
+	info := parseRedisInfo("# Stats\r\ninstantaneous_ops_per_sec:42\r\n\r\n# Memory\r\nused_memory:1048576\r\nused_memory_human:1.00M\r\n")
+	if info["instantaneous_ops_per_sec"] != "42" || info["used_memory"] != "1048576" || len(info) != 3 {
+		t.Fatalf("parseRedisInfo = %v", info)
+	}
+}
+
+func TestStatusLine(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	st := &state{MountPID: 10, ManageRedis: true, RedisPID: 11}
+
+	running := statusSample{At: at, State: st, Mounted: true, MountAlive: true, Redis: &redisStats{OpsPerSec: 7, UsedMemory: 2048, Clients: 3}}
+	if got, want := statusLine(running, nil), `2026-01-02T03:04:05Z state="mounted" mount_pid=10 redis_pid=11 ops_per_sec=7 used_memory=2048 clients=3`; got != want {
+		t.Fatalf("statusLine = %s\nwant %s", got, want)
+	}
+	down := statusSample{At: at, State: st, RedisErr: errors.New("refused")}
+	if got := statusLine(down, nil); !strings.Contains(got, `state="not mounted"`) || !strings.HasSuffix(got, "redis=unreachable") {
+		t.Fatalf("statusLine = %s", got)
+	}
+	if got := statusLine(statusSample{At: at}, nil); got != `2026-01-02T03:04:05Z state="not running"` {
+		t.Fatalf("statusLine = %s", got)
+	}
+}
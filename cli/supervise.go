@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// up --supervise — keep the filesystems up from the foreground
+// ---------------------------------------------------------------------------
+//
+// After bringing the filesystems up, `up --supervise` stays attached and
+// checks on them every superviseInterval. A mount daemon that exited or a
+// mount that vanished is restarted; a managed Redis server that died is
+// started again and the mounts it served are remounted against it.
+// Restarts back off, doubling up to superviseMaxBackoff while they keep
+// failing or the process keeps dying, so a flapping daemon does not spin.
+// Each restart is logged, with a timestamp, to the filesystem's mount log.
+// ctrl-C or SIGTERM brings the supervised filesystems down.
+//
+// `up --foreground` watches the same way but restarts nothing: once a
+// mount goes away it brings the rest down and exits with an error, for a
+// service manager such as systemd or launchd to restart the whole thing.
+//
+// The rfs daemon has its own policy, bringing filesystems down when their
+// processes die, so --supervise refuses to run alongside it.
+
+// superviseMaxBackoff caps the wait between restarts of one process, and
+// superviseStableAfter is how long it must stay up for the backoff to
+// start over.
+const (
+	superviseMaxBackoff  = 2 * time.Minute
+	superviseStableAfter = time.Minute
+)
+
+// restartBackoff is the wait after the nth restart in a row.
+func restartBackoff(n int) time.Duration {
+	d := superviseInterval
+	for i := 1; i < n && d < superviseMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, superviseMaxBackoff)
+}
+
+// restartTracker paces the restarts of one process.
+type restartTracker struct {
+	restarts int
+	last     time.Time
+	next     time.Time
+}
+
+// due reports whether the process may be restarted at now.
+func (r *restartTracker) due(now time.Time) bool {
+	return !now.Before(r.next)
+}
+
+// record notes a restart at now and returns how long until the next one
+// is allowed.
+func (r *restartTracker) record(now time.Time) time.Duration {
+	if now.Sub(r.last) > superviseStableAfter {
+		r.restarts = 0
+	}
+	r.restarts++
+	r.last = now
+	d := restartBackoff(r.restarts)
+	r.next = now.Add(d)
+	return d
+}
+
+// superviseLog prints msg with a timestamp and appends it to logPath.
+func superviseLog(logPath, msg string) {
+	line := fmt.Sprintf("%s rfs supervise: %s\n", time.Now().Format(time.RFC3339), msg)
+	fmt.Print("  " + line)
+	if logPath == "" {
+		return
+	}
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.WriteString(line)
+}
+
+// errNothingSupervised ends supervision once every filesystem it watched
+// has been brought down by other means.
+var errNothingSupervised = errors.New("nothing left to supervise")
+
+// errMountGone ends a foreground run that does not restart.
+var errMountGone = errors.New("mount went away")
+
+// foregroundSupervisor is what up --supervise keeps between checks: a
+// tracker per mount, by filesystem name, and per managed Redis server, by
+// address.
+type foregroundSupervisor struct {
+	names   []string
+	restart bool // restart what dies, rather than exit
+	mounts  map[string]*restartTracker
+	redis   map[string]*restartTracker
+}
+
+func newForegroundSupervisor(names []string, restart bool) *foregroundSupervisor {
+	sort.Strings(names)
+	return &foregroundSupervisor{names: names, restart: restart, mounts: map[string]*restartTracker{}, redis: map[string]*restartTracker{}}
+}
+
+func tracker(m map[string]*restartTracker, k string) *restartTracker {
+	if m[k] == nil {
+		m[k] = &restartTracker{}
+	}
+	return m[k]
+}
+
+// check restarts whatever has died and records the new PIDs.
+func (sv *foregroundSupervisor) check(now time.Time) error {
+	return withState(func(store *stateStore) error {
+		sts, err := store.load()
+		if errors.Is(err, os.ErrNotExist) {
+			return errNothingSupervised
+		}
+		if err != nil {
+			return err
+		}
+		base, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		watched := 0
+		restartedRedis := map[string]state{} // old address → the restarted server's fields
+		for _, name := range sv.names {
+			st, ok := sts[name]
+			if !ok {
+				continue
+			}
+			watched++
+
+			remount := false
+			if st.ManageRedis && !processAlive(st.RedisPID) {
+				if !sv.restart {
+					return fmt.Errorf("%w: redis-server pid %d exited", errMountGone, st.RedisPID)
+				}
+				r, ok := restartedRedis[st.RedisAddr]
+				if !ok {
+					tr := tracker(sv.redis, st.RedisAddr)
+					if !tr.due(now) {
+						continue
+					}
+					wait := tr.record(now)
+					cfg, err := configForState(base, st)
+					pid := 0
+					if err == nil {
+						pid, _, err = acquireManagedRedis(&cfg, redisProfile())
+					}
+					if err != nil {
+						superviseLog(st.MountLog, fmt.Sprintf("redis-server pid %d exited; restart failed: %v (next try in %s)", st.RedisPID, err, formatDuration(wait)))
+						continue
+					}
+					superviseLog(st.MountLog, fmt.Sprintf("redis-server pid %d exited; restarted as pid %d on %s (restart %d)", st.RedisPID, pid, cfg.RedisAddr, tr.restarts))
+					// Its port may have been taken in the meantime.
+					r = state{RedisPID: pid, RedisAddr: cfg.RedisAddr}
+					r.RedisPidfile = cfg.managedRedisPidfile()
+					r.RedisDataFile = cfg.managedRedisDataFile()
+					restartedRedis[st.RedisAddr] = r
+				}
+				st.RedisPID, st.RedisAddr = r.RedisPID, r.RedisAddr
+				st.RedisPidfile, st.RedisDataFile = r.RedisPidfile, r.RedisDataFile
+				sts[name] = st
+				remount = true
+			}
+
+			backend, _, err := backendForState(st)
+			if err != nil {
+				return err
+			}
+			if !remount && st.mountDaemonAlive() && backend.IsMounted(st.Mountpoint) {
+				continue
+			}
+			why := fmt.Sprintf("mount daemon pid %d exited", st.MountPID)
+			switch {
+			case remount:
+				why = "its Redis server was restarted"
+			case st.mountDaemonAlive():
+				why = st.Mountpoint + " is no longer mounted"
+			}
+			if !sv.restart {
+				return fmt.Errorf("%w: %s: %s", errMountGone, name, why)
+			}
+			tr := tracker(sv.mounts, name)
+			if !tr.due(now) {
+				continue
+			}
+			wait := tr.record(now)
+			restarted, err := remountOne(base, st, "")
+			if err != nil {
+				superviseLog(st.MountLog, fmt.Sprintf("%s: %s; restart failed: %v (next try in %s)", name, why, err, formatDuration(wait)))
+				continue
+			}
+			superviseLog(st.MountLog, fmt.Sprintf("%s: %s; restarted as pid %d (restart %d)", name, why, restarted.MountPID, tr.restarts))
+			sts[name] = restarted
+		}
+		if watched == 0 {
+			return errNothingSupervised
+		}
+		return store.save(sts)
+	})
+}
+
+// down brings the supervised filesystems that are still up down.
+func (sv *foregroundSupervisor) down() error {
+	return withState(func(store *stateStore) error {
+		sts, err := store.load()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var names []string
+		for _, name := range sv.names {
+			if _, ok := sts[name]; ok {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil
+		}
+		return stopServices(store, sts, names, false, false)
+	})
+}
+
+// superviseForeground watches names until interrupted, then brings them
+// down. Without restart it also brings them down, and fails, as soon as
+// one of them goes away.
+func superviseForeground(names []string, restart bool) error {
+	sv := newForegroundSupervisor(names, restart)
+	done := make(chan struct{})
+	stop := func() {
+		select {
+		case <-done:
+		default:
+			close(done)
+		}
+	}
+	restore := onInterrupt(stop)
+	defer restore()
+
+	verb := "Watching"
+	if restart {
+		verb = "Supervising"
+	}
+	fmt.Printf("\n  %s %s; ctrl-C or SIGTERM brings it down\n", clr(ansiDim, "▸"), verb)
+	t := time.NewTicker(superviseInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			fmt.Println()
+			if err := sv.down(); err != nil {
+				return err
+			}
+			fmt.Printf("\n  %s stopped\n\n", clr(ansiDim, "■"))
+			return nil
+		case now := <-t.C:
+			err := sv.check(now)
+			if errors.Is(err, errNothingSupervised) {
+				fmt.Printf("  %s Every supervised filesystem was brought down; exiting\n", clr(ansiDim, "▸"))
+				return nil
+			}
+			if errors.Is(err, errMountGone) {
+				superviseLog("", err.Error()+"; bringing the rest down")
+				if derr := sv.down(); derr != nil {
+					return errors.Join(err, derr)
+				}
+				return err
+			}
+			if err != nil {
+				superviseLog("", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartBackoff(t *testing.T) {
+	for n, want := range map[int]time.Duration{
+		1:  superviseInterval,
+		2:  2 * superviseInterval,
+		3:  4 * superviseInterval,
+		10: superviseMaxBackoff,
+	} {
+		if got := restartBackoff(n); got != want {
+			t.Errorf("restartBackoff(%d) = %s, want %s", n, got, want)
+		}
+	}
+
+	var tr restartTracker
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if !tr.due(now) {
+		t.Fatal("first restart not due")
+	}
+	if wait := tr.record(now); wait != superviseInterval {
+		t.Fatalf("first wait %s", wait)
+	}
+	if tr.due(now.Add(superviseInterval / 2)) {
+		t.Fatal("restart due before the backoff elapsed")
+	}
+	now = now.Add(superviseInterval)
+	if wait := tr.record(now); wait != 2*superviseInterval || tr.restarts != 2 {
+		t.Fatalf("second wait %s after %d restarts", wait, tr.restarts)
+	}
+	// Staying up long enough starts the backoff over.
+	now = now.Add(superviseStableAfter + time.Second)
+	if wait := tr.record(now); wait != superviseInterval || tr.restarts != 1 {
+		t.Fatalf("wait after a stable run %s after %d restarts", wait, tr.restarts)
+	}
+}
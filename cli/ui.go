@@ -10,20 +10,22 @@ import (
 )
 
 const (
-	ansiReset   = "\033[0m"
-	ansiBold    = "\033[1m"
-	ansiDim     = "\033[2m"
-	ansiRed     = "\033[31m"
-	ansiGreen   = "\033[32m"
-	ansiYellow  = "\033[33m"
-	ansiCyan    = "\033[36m"
-	ansiWhite   = "\033[37m"
-	ansiBRed    = "\033[91m"
-	ansiBGreen  = "\033[92m"
-	ansiGray    = "\033[90m"
-	ansiHideCur = "\033[?25l"
-	ansiShowCur = "\033[?25h"
-	ansiClearLn = "\033[2K"
+	ansiReset    = "\033[0m"
+	ansiBold     = "\033[1m"
+	ansiDim      = "\033[2m"
+	ansiRed      = "\033[31m"
+	ansiGreen    = "\033[32m"
+	ansiYellow   = "\033[33m"
+	ansiBlue     = "\033[34m"
+	ansiCyan     = "\033[36m"
+	ansiWhite    = "\033[37m"
+	ansiBRed     = "\033[91m"
+	ansiBGreen   = "\033[92m"
+	ansiGray     = "\033[90m"
+	ansiHideCur  = "\033[?25l"
+	ansiShowCur  = "\033[?25h"
+	ansiClearLn  = "\033[2K"
+	ansiClearScr = "\033[H\033[2J"
 )
 
 var (
@@ -39,6 +41,14 @@ func init() {
 	colorTerm = fi.Mode()&os.ModeCharDevice != 0
 }
 
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
 func hideCursor() {
 	if colorTerm {
 		fmt.Print(ansiHideCur)
@@ -357,6 +367,19 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
 }
 
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func pidStatusColored(pid int) string {
 	if pid <= 0 {
 		return "unknown"
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// unmountTools are the executables any platform's unmount sequence may
+// use; which of them exist is detected once per run.
+var unmountTools = []string{"fusermount3", "fusermount", "umount", "diskutil"}
+
+var detectUnmountTools = sync.OnceValue(func() map[string]bool {
+	found := make(map[string]bool)
+	for _, name := range unmountTools {
+		if _, err := exec.LookPath(name); err == nil {
+			found[name] = true
+		}
+	}
+	return found
+})
+
+// unmountWith runs the platform's unmount sequence for backend until one
+// command succeeds. On failure the error carries the output of the last
+// attempt, which usually names the process keeping the mount busy.
+func unmountWith(backend, mountpoint string) error {
+	cmds := unmountCommands(backend, mountpoint, detectUnmountTools())
+	if len(cmds) == 0 {
+		return fmt.Errorf("no unmount tool found (looked for %s)", strings.Join(unmountToolNames(backend), ", "))
+	}
+	var lastErr error
+	for _, c := range cmds {
+		var stderr bytes.Buffer
+		cmd := exec.Command(c[0], c[1:]...)
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		if err == nil {
+			return nil
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		lastErr = fmt.Errorf("%s: %s", strings.Join(c, " "), msg)
+	}
+	return lastErr
+}
+
+// checkUnmountTool fails when nothing could unmount a backend's mount, so
+// the problem surfaces before a mount exists rather than when it is stuck.
+func checkUnmountTool(backend string) error {
+	if len(unmountCommands(backend, "/", detectUnmountTools())) > 0 {
+		return nil
+	}
+	return fmt.Errorf("no tool to unmount a %s mount was found (looked for %s)\n%s",
+		backend, strings.Join(unmountToolNames(backend), ", "), unmountToolHint(backend))
+}
+
+// unmountToolNames lists the tools the sequence for backend can use, in
+// order of preference.
+func unmountToolNames(backend string) []string {
+	all := make(map[string]bool, len(unmountTools))
+	for _, name := range unmountTools {
+		all[name] = true
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, c := range unmountCommands(backend, "/", all) {
+		if !seen[c[0]] {
+			seen[c[0]] = true
+			names = append(names, c[0])
+		}
+	}
+	return names
+}
@@ -0,0 +1,25 @@
+//go:build darwin
+
+package main
+
+// unmountCommands returns the commands to try, in order, to unmount a
+// backend's mount given the tools available. macOS has no fusermount and
+// no lazy umount; macFUSE and NFS mounts both go through umount, then
+// diskutil, which can force a busy volume off.
+func unmountCommands(_ string, mountpoint string, have map[string]bool) [][]string {
+	var cmds [][]string
+	if have["umount"] {
+		cmds = append(cmds, []string{"umount", mountpoint})
+	}
+	if have["diskutil"] {
+		cmds = append(cmds, []string{"diskutil", "unmount", mountpoint}, []string{"diskutil", "unmount", "force", mountpoint})
+	}
+	if have["umount"] {
+		cmds = append(cmds, []string{"umount", "-f", mountpoint})
+	}
+	return cmds
+}
+
+func unmountToolHint(string) string {
+	return "umount and diskutil ship with macOS; check that /sbin and /usr/sbin are on PATH"
+}
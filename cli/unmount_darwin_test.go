@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmountCommandsDarwin(t *testing.T) {
+	all := map[string]bool{"umount": true, "diskutil": true, "fusermount": true}
+	want := [][]string{
+		{"umount", "/mnt"}, {"diskutil", "unmount", "/mnt"}, {"diskutil", "unmount", "force", "/mnt"}, {"umount", "-f", "/mnt"},
+	}
+	for _, backend := range []string{mountBackendFuse, mountBackendNFS} {
+		if got := unmountCommands(backend, "/mnt", all); !reflect.DeepEqual(got, want) {
+			t.Errorf("unmountCommands(%s) = %v, want %v", backend, got, want)
+		}
+	}
+	if got := unmountCommands(mountBackendFuse, "/mnt", map[string]bool{"diskutil": true}); len(got) != 2 || got[0][0] != "diskutil" {
+		t.Errorf("diskutil only: %v", got)
+	}
+	if got := unmountCommands(mountBackendFuse, "/mnt", map[string]bool{"fusermount": true}); got != nil {
+		t.Errorf("fusermount is never used on macOS: %v", got)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package main
+
+// unmountCommands returns the commands to try, in order, to unmount a
+// backend's mount given the tools available. FUSE mounts prefer
+// fusermount3 over fusermount; both fall back to a lazy umount.
+func unmountCommands(backend, mountpoint string, have map[string]bool) [][]string {
+	var cmds [][]string
+	if backend == mountBackendFuse {
+		fusermount := ""
+		switch {
+		case have["fusermount3"]:
+			fusermount = "fusermount3"
+		case have["fusermount"]:
+			fusermount = "fusermount"
+		}
+		if fusermount != "" {
+			cmds = append(cmds, []string{fusermount, "-u", mountpoint}, []string{fusermount, "-uz", mountpoint})
+		}
+		if have["umount"] {
+			cmds = append(cmds, []string{"umount", "-l", mountpoint}, []string{"umount", mountpoint})
+		}
+		return cmds
+	}
+	if have["umount"] {
+		cmds = append(cmds, []string{"umount", mountpoint}, []string{"umount", "-l", mountpoint})
+	}
+	return cmds
+}
+
+func unmountToolHint(backend string) string {
+	if backend == mountBackendFuse {
+		return "Install fuse3 (or fuse) to provide fusermount3"
+	}
+	return "Install util-linux to provide umount"
+}
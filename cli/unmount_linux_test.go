@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmountCommandsLinux(t *testing.T) {
+	tools := func(names ...string) map[string]bool {
+		m := make(map[string]bool)
+		for _, n := range names {
+			m[n] = true
+		}
+		return m
+	}
+	cases := []struct {
+		backend string
+		have    map[string]bool
+		want    [][]string
+	}{
+		{mountBackendFuse, tools("fusermount3", "fusermount", "umount"), [][]string{
+			{"fusermount3", "-u", "/mnt"}, {"fusermount3", "-uz", "/mnt"}, {"umount", "-l", "/mnt"}, {"umount", "/mnt"},
+		}},
+		{mountBackendFuse, tools("fusermount"), [][]string{
+			{"fusermount", "-u", "/mnt"}, {"fusermount", "-uz", "/mnt"},
+		}},
+		{mountBackendFuse, tools("umount"), [][]string{{"umount", "-l", "/mnt"}, {"umount", "/mnt"}}},
+		{mountBackendFuse, tools("diskutil"), nil},
+		{mountBackendNFS, tools("fusermount3", "umount"), [][]string{{"umount", "/mnt"}, {"umount", "-l", "/mnt"}}},
+		{mountBackendNFS, tools(), nil},
+	}
+	for _, c := range cases {
+		if got := unmountCommands(c.backend, "/mnt", c.have); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("unmountCommands(%s, %v) = %v, want %v", c.backend, c.have, got, c.want)
+		}
+	}
+
+	if got := unmountToolNames(mountBackendFuse); !reflect.DeepEqual(got, []string{"fusermount3", "umount"}) {
+		t.Errorf("unmountToolNames(fuse) = %v", got)
+	}
+}
+
+func TestUnmountWithReportsLastFailure(t *testing.T) {
+	if !detectUnmountTools()["umount"] {
+		t.Skip("umount not installed")
+	}
+	err := unmountWith(mountBackendNFS, t.TempDir())
+	if err == nil {
+		t.Fatal("unmounting a plain directory succeeded")
+	}
+	// The last command tried is the lazy umount; its stderr is kept.
+	if msg := err.Error(); !strings.HasPrefix(msg, "umount -l ") || !strings.Contains(msg, "umount: ") {
+		t.Fatalf("error does not describe the last attempt: %v", err)
+	}
+}
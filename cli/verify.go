@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/redis-fs/mount/client"
+)
+
+// ---------------------------------------------------------------------------
+// verify — compare a directory with the filesystem it was imported into
+// ---------------------------------------------------------------------------
+//
+// The smoke test samples a migrated tree through the mount. verify reads
+// everything instead, straight from Redis: every file's size and SHA-256,
+// every symlink's target, and that every directory exists. It runs after
+// migrate --verify imports, while the original is still in place, and on
+// its own against any directory imported earlier.
+
+// verifyOptions says what verifyImport leaves out and how to read Redis.
+type verifyOptions struct {
+	cipher   *fileCipher
+	exclude  *excludeMatcher
+	skip     func(rel string) bool  // entries Redis is not expected to match, such as merge conflicts
+	rewrites map[string]linkRewrite // links stored relative by --rewrite-absolute-links
+	// onProgress is called after each entry.
+	onProgress func(verifyReport)
+	// pruneEmpty expects directories whose entries exclude leaves out
+	// to be missing, as import --prune-empty leaves them.
+	pruneEmpty bool
+}
+
+type verifyReport struct {
+	Files      int
+	Dirs       int
+	Symlinks   int
+	Bytes      int64 // of files hashed
+	Mismatches []smokeMismatch
+}
+
+func (r verifyReport) summary() string {
+	return fmt.Sprintf("%d files, %d dirs, %d symlinks", r.Files, r.Dirs, r.Symlinks)
+}
+
+func (r verifyReport) progress(start time.Time) string {
+	return r.summary() + ", " + formatBytes(r.Bytes) + transferRate(r.Bytes, start)
+}
+
+// verifyImport walks source and checks each entry against the filesystem
+// behind fsClient.
+func verifyImport(ctx context.Context, source string, fsClient client.Client, opts verifyOptions) (verifyReport, error) {
+	var r verifyReport
+	mismatch := func(rel, format string, args ...interface{}) {
+		r.Mismatches = append(r.Mismatches, smokeMismatch{Path: rel, Problem: fmt.Sprintf(format, args...)})
+	}
+	err := walkTree(source, func(local, rel string, d os.DirEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		slash := filepath.ToSlash(rel)
+		if opts.exclude.excluded(slash, d.IsDir()) || (opts.skip != nil && opts.skip(rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && opts.pruneEmpty {
+			if emptied, err := opts.exclude.emptied(local, slash, true); err != nil {
+				return err
+			} else if emptied {
+				return filepath.SkipDir
+			}
+		}
+		p := "/" + slash
+		info, err := os.Lstat(local)
+		if err != nil {
+			return err
+		}
+		kind := entryType(info.Mode())
+		st, err := fsClient.Stat(ctx, p)
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", p, err)
+		}
+		if st == nil || st.Type != kind {
+			if st == nil {
+				mismatch(rel, "missing from Redis")
+			} else {
+				mismatch(rel, "is a %s in Redis, a %s in the source", st.Type, kind)
+			}
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch kind {
+		case "dir":
+			r.Dirs++
+		case "symlink":
+			r.Symlinks++
+			want, err := os.Readlink(local)
+			if err != nil {
+				return err
+			}
+			if lr, ok := opts.rewrites[p]; ok && lr.Original == want {
+				want = lr.Target
+			}
+			if got, err := fsClient.Readlink(ctx, p); err != nil {
+				mismatch(rel, "unreadable in Redis: %v", err)
+			} else if got != want {
+				mismatch(rel, "points to %q in Redis, %q in the source", got, want)
+			}
+		default:
+			r.Files++
+			if size := redisSize(lsEntry{Size: st.Size}, opts.cipher); size != info.Size() {
+				mismatch(rel, "%s in Redis, %s in the source", formatBytes(size), formatBytes(info.Size()))
+				break
+			}
+			want, err := hashFileProgress(ctx, local, &copyProgress{}, nil)
+			if err != nil {
+				return err
+			}
+			data, err := readContents(ctx, fsClient, opts.cipher, p)
+			if err != nil {
+				mismatch(rel, "unreadable in Redis: %v", err)
+				break
+			}
+			if got := fmt.Sprintf("%x", sha256.Sum256(data)); got != want {
+				mismatch(rel, "SHA-256 %.12s in Redis, %.12s in the source", got, want)
+			}
+			r.Bytes += info.Size()
+		}
+		if opts.onProgress != nil {
+			opts.onProgress(r)
+		}
+		return nil
+	})
+	return r, err
+}
+
+// runVerify runs verifyImport as a step and prints any mismatches. It
+// fails when there are some.
+func runVerify(ctx context.Context, source string, fsClient client.Client, opts verifyOptions) error {
+	step := startStep("Verifying against Redis")
+	start := time.Now()
+	opts.onProgress = func(r verifyReport) {
+		step.update("Verifying against Redis · " + r.progress(start))
+	}
+	report, err := verifyImport(ctx, source, fsClient, opts)
+	if err != nil {
+		step.fail(err.Error())
+		return fmt.Errorf("verify: %w", err)
+	}
+	checked := report.Files + report.Dirs + report.Symlinks
+	if len(report.Mismatches) == 0 {
+		step.succeed(report.summary() + " match")
+		return nil
+	}
+	step.fail(fmt.Sprintf("%d of %d entries differ", len(report.Mismatches), checked))
+	printMismatches("Verify mismatches", report.Mismatches, 0)
+	return fmt.Errorf("verify failed: %d of %d entries differ between %s and Redis", len(report.Mismatches), checked, source)
+}
+
+func cmdVerify(args []string) error {
+	usage := fmt.Sprintf("Usage: %s verify <directory> [--key name] [--exclude pattern]... [--prune-empty] [--key-file file | --key-command cmd]", filepath.Base(os.Args[0]))
+	fs := newFlagSet("verify")
+	key := fs.String("key", "", "filesystem key (defaults to the configured key)")
+	var excludes stringsFlag
+	fs.Var(&excludes, "exclude", "skip entries matching this gitignore-style `pattern` (repeatable; adds to .rfsignore)")
+	pruneEmpty := fs.Bool("prune-empty", false, "expect directories whose entries are all excluded to be missing, as import --prune-empty leaves them")
+	var kf keyFlags
+	kf.register(fs, false)
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\n%s", err, usage)
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("missing directory\n\n%s", usage)
+	}
+	source, err := expandPath(pos[0])
+	if err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+	if fi, err := os.Stat(source); err != nil {
+		return fmt.Errorf("cannot access %s: %w", source, err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", source)
+	}
+	exclude, _, err := loadExcludes(source, excludes)
+	if err != nil {
+		return err
+	}
+	userCipher, err := kf.load()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	cfg, rdb, fsKey, err := connectFilesystem(ctx, *key)
+	if err != nil {
+		return err
+	}
+	defer rdb.Close()
+	c, err := cipherForKey(ctx, rdb, fsKey, userCipher)
+	if err != nil {
+		return err
+	}
+	fsClient := client.New(rdb, fsKey)
+	if st, err := fsClient.Stat(ctx, "/"); err != nil {
+		return err
+	} else if st == nil {
+		return fmt.Errorf("no filesystem found at key %q on %s (db %d)", fsKey, cfg.RedisAddr, cfg.RedisDB)
+	}
+	rewrites, err := loadLinkRewrites(ctx, rdb, fsKey)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	if err := runVerify(ctx, source, fsClient, verifyOptions{cipher: c, exclude: exclude, pruneEmpty: *pruneEmpty, rewrites: rewrites}); err != nil {
+		return err
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/redis-fs/mount/client"
+)
+
+func TestVerifyImport(t *testing.T) {
+	ctx := context.Background()
+	rdb := testRedis(t)
+	fsClient := client.New(rdb, testKey(t, rdb))
+	root := writeFixtureTree(t)
+	if _, err := importDirectory(ctx, fsClient, root, importOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := verifyImport(ctx, root, fsClient, verifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 4 || report.Dirs != 4 || report.Symlinks != 1 || len(report.Mismatches) != 0 {
+		t.Fatalf("clean tree: %+v", report)
+	}
+
+	// Same size, different contents; a new file; a retargeted link; a
+	// directory Redis lost.
+	if err := fsClient.Echo(ctx, "/README.md", []byte("# HELLO\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "new.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsClient.Rm(ctx, "/link"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsClient.Ln(ctx, "README.md", "/link"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsClient.Rm(ctx, "/empty"); err != nil {
+		t.Fatal(err)
+	}
+	report, err = verifyImport(ctx, root, fsClient, verifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range report.Mismatches {
+		got = append(got, m.Path+": "+m.Problem)
+	}
+	sort.Strings(got)
+	want := []string{"README.md: SHA-256", "empty: missing from Redis", "link: points to \"README.md\" in Redis", "new.txt: missing from Redis"}
+	if len(got) != len(want) {
+		t.Fatalf("mismatches %q", got)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("mismatch %q, want %q…", got[i], want[i])
+		}
+	}
+
+	// Excluded and skipped entries are not compared.
+	exclude, _ := newExcludeMatcher([]string{"new.txt", "/empty"})
+	report, err = verifyImport(ctx, root, fsClient, verifyOptions{exclude: exclude, skip: underConflict([]string{"/README.md", "/link"})})
+	if err != nil || len(report.Mismatches) != 0 {
+		t.Fatalf("with exclusions: %+v, %v", report.Mismatches, err)
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ---------------------------------------------------------------------------
+// watch — print filesystem changes as they happen
+// ---------------------------------------------------------------------------
+
+type fsEvent struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	Path string    `json:"path"`
+	From string    `json:"from,omitempty"`
+}
+
+type inodeMeta struct {
+	Type    string
+	Size    int64
+	CtimeMs int64
+	MtimeMs int64
+}
+
+type fsWatcher struct {
+	rdb    *redis.Client
+	fsKey  string
+	prefix string
+	filter string
+	json   bool
+	out    io.Writer
+	known  map[string]inodeMeta
+}
+
+func cmdWatch(args []string) error {
+	fs := newFlagSet("watch")
+	jsonOut := fs.Bool("json", false, "emit one JSON object per event")
+	filter := fs.String("filter", "", "only show paths matching this glob")
+	interval := fs.Duration("interval", time.Second, "polling interval when keyspace notifications are unavailable")
+	poll := fs.Bool("poll", false, "always poll instead of using keyspace notifications")
+	key := fs.String("key", "", "filesystem key (defaults to the configured key)")
+	pos, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return fmt.Errorf("%w\n\nUsage: %s watch [--json] [--filter glob] [--interval 1s] [path-prefix]", err, filepath.Base(os.Args[0]))
+	}
+	if *filter != "" {
+		if _, err := path.Match(*filter, ""); err != nil {
+			return fmt.Errorf("invalid --filter %q: %w", *filter, err)
+		}
+	}
+	if *interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+
+	prefix := "/"
+	if len(pos) > 0 {
+		prefix = path.Clean("/" + pos[0])
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no configuration found\nRun '%s setup' first", filepath.Base(os.Args[0]))
+		}
+		return err
+	}
+	if *key != "" {
+		cfg.RedisKey = *key
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	restore := onInterrupt(cancel)
+	defer restore()
+
+	rdb := newRedisClient(cfg, 4)
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("cannot connect to Redis at %s: %w", cfg.RedisAddr, err)
+	}
+
+	w := &fsWatcher{
+		rdb:    rdb,
+		fsKey:  cfg.RedisKey,
+		prefix: prefix,
+		filter: *filter,
+		json:   *jsonOut,
+		out:    os.Stdout,
+	}
+	if w.known, err = w.snapshot(ctx); err != nil {
+		return err
+	}
+
+	useNotify := false
+	if !*poll {
+		enabled, restoreNotify, err := w.enableNotifications(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %s keyspace notifications unavailable: %v\n", clr(ansiYellow, "!"), err)
+		}
+		if restoreNotify != nil {
+			defer restoreNotify()
+		}
+		useNotify = enabled
+	}
+
+	how := "polling every " + interval.String()
+	if useNotify {
+		how = "keyspace notifications"
+	}
+	fmt.Fprintf(os.Stderr, "  %s watching %s%s via %s %s\n",
+		clr(ansiCyan, "▸"), cfg.RedisKey, clr(ansiDim, ":"+prefix), how, clr(ansiDim, "(ctrl-c to stop)"))
+
+	if useNotify {
+		err = w.runNotify(ctx, cfg.RedisDB)
+	} else {
+		err = w.runPoll(ctx, *interval)
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// enableNotifications reports whether keyspace notifications cover hash
+// writes and deletes. When they don't, it offers to enable them for the
+// duration of this session and returns a function restoring the original
+// setting.
+func (w *fsWatcher) enableNotifications(ctx context.Context) (bool, func(), error) {
+	res, err := w.rdb.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return false, nil, err
+	}
+	orig := res["notify-keyspace-events"]
+	missing := missingNotifyFlags(orig)
+	if missing == "" {
+		return true, nil, nil
+	}
+	if !stdinIsTerminal() {
+		return false, nil, errors.New("notify-keyspace-events does not include hash and generic events")
+	}
+
+	ok, err := promptYesNo(bufio.NewReader(os.Stdin), os.Stderr,
+		"  Keyspace notifications are disabled on this server.\n"+
+			"  Enable them for this session (CONFIG SET notify-keyspace-events)?", true)
+	if err != nil || !ok {
+		return false, nil, err
+	}
+	if err := w.rdb.ConfigSet(ctx, "notify-keyspace-events", orig+missing).Err(); err != nil {
+		return false, nil, err
+	}
+	restore := func() {
+		rctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = w.rdb.ConfigSet(rctx, "notify-keyspace-events", orig).Err()
+	}
+	return true, restore, nil
+}
+
+// missingNotifyFlags returns the notify-keyspace-events flags that must be
+// added to current so keyspace events fire for HSET and DEL.
+func missingNotifyFlags(current string) string {
+	missing := ""
+	if !strings.Contains(current, "K") {
+		missing += "K"
+	}
+	if !strings.Contains(current, "A") {
+		if !strings.Contains(current, "g") {
+			missing += "g"
+		}
+		if !strings.Contains(current, "h") {
+			missing += "h"
+		}
+	}
+	return missing
+}
+
+func (w *fsWatcher) runNotify(ctx context.Context, db int) error {
+	channelPrefix := "__keyspace@" + strconv.Itoa(db) + "__:"
+	pubsub := w.rdb.PSubscribe(ctx, channelPrefix+inodeKeyPattern(w.fsKey))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	msgs := pubsub.Channel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	keyPrefix := channelPrefix + inodeKeyPrefix(w.fsKey)
+	var batch []fsEvent
+	for {
+		select {
+		case <-ctx.Done():
+			w.emit(batch)
+			return ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return errors.New("subscription closed")
+			}
+			p := strings.TrimPrefix(msg.Channel, keyPrefix)
+			if ev, ok := w.notifyEvent(ctx, p, msg.Payload); ok {
+				batch = append(batch, ev)
+			}
+		case <-ticker.C:
+			w.emit(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (w *fsWatcher) notifyEvent(ctx context.Context, p, op string) (fsEvent, bool) {
+	now := time.Now()
+	switch op {
+	case "del", "expired", "evicted":
+		if _, ok := w.known[p]; !ok {
+			return fsEvent{}, false
+		}
+		prev := w.known[p]
+		delete(w.known, p)
+		return fsEvent{Time: now, Op: "delete", Path: p, From: metaToken(prev)}, true
+	case "hset", "hdel", "hincrby":
+		meta, ok, err := w.loadMeta(ctx, p)
+		if err != nil || !ok {
+			return fsEvent{}, false
+		}
+		prev, existed := w.known[p]
+		w.known[p] = meta
+		if !existed {
+			return fsEvent{Time: now, Op: "create", Path: p, From: metaToken(meta)}, true
+		}
+		if opName := changeOp(prev, meta); opName != "" {
+			return fsEvent{Time: now, Op: opName, Path: p}, true
+		}
+	}
+	return fsEvent{}, false
+}
+
+func (w *fsWatcher) runPoll(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		next, err := w.snapshot(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		w.emit(diffSnapshots(w.known, next, time.Now()))
+		w.known = next
+	}
+}
+
+// snapshot reads the metadata of every inode in the filesystem.
+func (w *fsWatcher) snapshot(ctx context.Context) (map[string]inodeMeta, error) {
+	out := make(map[string]inodeMeta)
+	prefix := inodeKeyPrefix(w.fsKey)
+	var cursor uint64
+	for {
+		keys, next, err := w.rdb.Scan(ctx, cursor, inodeKeyPattern(w.fsKey), 500).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			pipe := w.rdb.Pipeline()
+			cmds := make([]*redis.SliceCmd, len(keys))
+			for i, k := range keys {
+				cmds[i] = pipe.HMGet(ctx, k, "type", "size", "ctime_ms", "mtime_ms")
+			}
+			if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+				return nil, err
+			}
+			for i, k := range keys {
+				if meta, ok := parseMeta(cmds[i].Val()); ok {
+					out[strings.TrimPrefix(k, prefix)] = meta
+				}
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return out, nil
+		}
+	}
+}
+
+func (w *fsWatcher) loadMeta(ctx context.Context, p string) (inodeMeta, bool, error) {
+	vals, err := w.rdb.HMGet(ctx, inodeKeyPrefix(w.fsKey)+p, "type", "size", "ctime_ms", "mtime_ms").Result()
+	if err != nil {
+		return inodeMeta{}, false, err
+	}
+	meta, ok := parseMeta(vals)
+	return meta, ok, nil
+}
+
+func parseMeta(vals []interface{}) (inodeMeta, bool) {
+	if len(vals) != 4 || vals[0] == nil {
+		return inodeMeta{}, false
+	}
+	str := func(v interface{}) string {
+		s, _ := v.(string)
+		return s
+	}
+	num := func(v interface{}) int64 {
+		n, _ := strconv.ParseInt(str(v), 10, 64)
+		return n
+	}
+	return inodeMeta{
+		Type:    str(vals[0]),
+		Size:    num(vals[1]),
+		CtimeMs: num(vals[2]),
+		MtimeMs: num(vals[3]),
+	}, true
+}
+
+func changeOp(prev, cur inodeMeta) string {
+	switch {
+	case prev.Type != cur.Type || prev.Size != cur.Size || prev.MtimeMs != cur.MtimeMs:
+		return "write"
+	case prev.CtimeMs != cur.CtimeMs:
+		return "attrib"
+	default:
+		return "" // atime-only update from a read
+	}
+}
+
+// diffSnapshots compares two inode snapshots and returns the changes
+// between them, with matching delete/create pairs folded into renames.
+func diffSnapshots(prev, next map[string]inodeMeta, now time.Time) []fsEvent {
+	var events []fsEvent
+	for p, meta := range next {
+		old, ok := prev[p]
+		if !ok {
+			events = append(events, fsEvent{Time: now, Op: "create", Path: p, From: metaToken(meta)})
+			continue
+		}
+		if op := changeOp(old, meta); op != "" {
+			events = append(events, fsEvent{Time: now, Op: op, Path: p})
+		}
+	}
+	for p, meta := range prev {
+		if _, ok := next[p]; !ok {
+			events = append(events, fsEvent{Time: now, Op: "delete", Path: p, From: metaToken(meta)})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
+
+// metaToken identifies an inode across a rename, which preserves the
+// type, size, and creation time. It rides in From until coalesceRenames
+// consumes it.
+func metaToken(m inodeMeta) string {
+	return fmt.Sprintf("\x00%s/%d/%d", m.Type, m.Size, m.CtimeMs)
+}
+
+// coalesceRenames pairs each delete with a create carrying the same inode
+// identity and replaces the pair with a single rename event.
+func coalesceRenames(events []fsEvent) []fsEvent {
+	creates := make(map[string][]int)
+	for i, ev := range events {
+		if ev.Op == "create" {
+			creates[ev.From] = append(creates[ev.From], i)
+		}
+	}
+	drop := make(map[int]bool)
+	for i, ev := range events {
+		if ev.Op != "delete" {
+			continue
+		}
+		idx := creates[ev.From]
+		if len(idx) == 0 {
+			continue
+		}
+		j := idx[0]
+		creates[ev.From] = idx[1:]
+		events[j] = fsEvent{Time: events[j].Time, Op: "rename", Path: events[j].Path, From: ev.Path}
+		drop[i] = true
+	}
+
+	out := events[:0:0]
+	for i, ev := range events {
+		if drop[i] {
+			continue
+		}
+		if strings.HasPrefix(ev.From, "\x00") {
+			ev.From = ""
+		}
+		out = append(out, ev)
+	}
+	return out
+}
+
+func (w *fsWatcher) matches(p string) bool {
+	if w.prefix != "/" && p != w.prefix && !strings.HasPrefix(p, w.prefix+"/") {
+		return false
+	}
+	if w.filter == "" {
+		return true
+	}
+	target := p
+	if !strings.Contains(w.filter, "/") {
+		target = path.Base(p)
+	}
+	ok, _ := path.Match(w.filter, target)
+	return ok
+}
+
+func (w *fsWatcher) emit(batch []fsEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	for _, ev := range coalesceRenames(batch) {
+		if !w.matches(ev.Path) && (ev.From == "" || !w.matches(ev.From)) {
+			continue
+		}
+		if w.json {
+			b, _ := json.Marshal(ev)
+			fmt.Fprintln(w.out, string(b))
+			continue
+		}
+		ts := clr(ansiDim, ev.Time.Format("15:04:05.000"))
+		target := ev.Path
+		if ev.Op == "rename" {
+			target = ev.From + clr(ansiDim, " → ") + ev.Path
+		}
+		fmt.Fprintf(w.out, "%s  %s  %s\n", ts, opColored(ev.Op), target)
+	}
+}
+
+func opColored(op string) string {
+	label := fmt.Sprintf("%-6s", op)
+	switch op {
+	case "create":
+		return clr(ansiGreen, label)
+	case "delete":
+		return clr(ansiRed, label)
+	case "rename":
+		return clr(ansiCyan, label)
+	case "write":
+		return clr(ansiYellow, label)
+	default:
+		return clr(ansiDim, label)
+	}
+}
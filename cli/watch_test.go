@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshotsFoldsRenames(t *testing.T) {
+	now := time.Now()
+	prev := map[string]inodeMeta{
+		"/a.txt":   {Type: "file", Size: 3, CtimeMs: 10, MtimeMs: 10},
+		"/b.txt":   {Type: "file", Size: 5, CtimeMs: 20, MtimeMs: 20},
+		"/gone.md": {Type: "file", Size: 1, CtimeMs: 30, MtimeMs: 30},
+	}
+	next := map[string]inodeMeta{
+		"/a.txt":   {Type: "file", Size: 4, CtimeMs: 10, MtimeMs: 11},
+		"/c.txt":   {Type: "file", Size: 5, CtimeMs: 20, MtimeMs: 20},
+		"/new.txt": {Type: "file", Size: 0, CtimeMs: 40, MtimeMs: 40},
+	}
+
+	got := coalesceRenames(diffSnapshots(prev, next, now))
+	want := map[string]fsEvent{
+		"/a.txt":   {Op: "write", Path: "/a.txt"},
+		"/c.txt":   {Op: "rename", Path: "/c.txt", From: "/b.txt"},
+		"/new.txt": {Op: "create", Path: "/new.txt"},
+		"/gone.md": {Op: "delete", Path: "/gone.md"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %+v, want %d", len(got), got, len(want))
+	}
+	for _, ev := range got {
+		w, ok := want[ev.Path]
+		if !ok || ev.Op != w.Op || ev.From != w.From {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	}
+}
+
+func TestChangeOpIgnoresAtime(t *testing.T) {
+	m := inodeMeta{Type: "file", Size: 1, CtimeMs: 1, MtimeMs: 1}
+	if op := changeOp(m, m); op != "" {
+		t.Fatalf("identical metadata reported %q", op)
+	}
+	attr := m
+	attr.CtimeMs = 2
+	if op := changeOp(m, attr); op != "attrib" {
+		t.Fatalf("ctime change reported %q, want attrib", op)
+	}
+}
+
+func TestMissingNotifyFlags(t *testing.T) {
+	cases := map[string]string{
+		"":       "Kgh",
+		"KA":     "",
+		"Kgh":    "",
+		"Ex":     "Kgh",
+		"Kg$":    "h",
+		"KEA":    "",
+		"Khlsgz": "",
+	}
+	for in, want := range cases {
+		if got := missingNotifyFlags(in); got != want {
+			t.Errorf("missingNotifyFlags(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWatcherMatches(t *testing.T) {
+	w := &fsWatcher{prefix: "/src", filter: "*.go"}
+	for p, want := range map[string]bool{
+		"/src/main.go":     true,
+		"/src/pkg/util.go": true,
+		"/src/README":      false,
+		"/srcx/main.go":    false,
+		"/other/main.go":   false,
+	} {
+		if got := w.matches(p); got != want {
+			t.Errorf("matches(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
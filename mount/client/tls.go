@@ -0,0 +1,48 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSOptions says how to reach a Redis server over TLS. CACert, when set,
+// replaces the system roots; Cert and Key are a client certificate for
+// servers that ask for one.
+type TLSOptions struct {
+	CACert     string
+	Cert       string
+	Key        string
+	SkipVerify bool
+}
+
+// TLSConfig builds the tls.Config for redis.Options.TLSConfig from o.
+func TLSConfig(o TLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.SkipVerify,
+	}
+	if o.CACert != "" {
+		pem, err := os.ReadFile(o.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates in %s", o.CACert)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.Cert != "" || o.Key != "" {
+		if o.Cert == "" || o.Key == "" {
+			return nil, fmt.Errorf("a client certificate needs both a certificate and a key")
+		}
+		pair, err := tls.LoadX509KeyPair(o.Cert, o.Key)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
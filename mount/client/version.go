@@ -0,0 +1,30 @@
+package client
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// ModuleVersion is the fs module version whose key layout this client
+// reads and writes. The mount daemons report it, and rfs refuses to mount
+// while an older module is loaded in Redis.
+const ModuleVersion = 1
+
+// Version describes a mount daemon named name for --version.
+func Version(name string) string {
+	return fmt.Sprintf("%s (fs module v%d)", name, ModuleVersion)
+}
+
+// WriteCapabilities answers --capabilities for a mount daemon named name:
+// its version, the flags in fs, and ModuleVersion, as JSON.
+func WriteCapabilities(w io.Writer, name string, fs *flag.FlagSet) error {
+	caps := struct {
+		Version       string          `json:"version"`
+		Flags         map[string]bool `json:"flags"`
+		ModuleVersion int64           `json:"module_version"`
+	}{Version(name), map[string]bool{}, ModuleVersion}
+	fs.VisitAll(func(f *flag.Flag) { caps.Flags[f.Name] = true })
+	return json.NewEncoder(w).Encode(caps)
+}
@@ -14,19 +14,31 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	rfsclient "github.com/redis-fs/mount/client"
 	"github.com/redis-fs/mount/internal/client"
 	"github.com/redis-fs/mount/internal/redisfs"
 )
 
 func main() {
 	redisAddr := flag.String("redis", "localhost:6379", "Redis server address")
+	redisSocket := flag.String("socket", "", "Redis unix socket path, used instead of --redis")
+	redisUsername := flag.String("username", "", "Redis ACL username")
 	redisPassword := flag.String("password", "", "Redis password")
+	redisPasswordEnv := flag.String("password-env", "", "Read the Redis password from this environment variable, out of sight of ps")
 	redisDB := flag.Int("db", 0, "Redis database number")
+	useTLS := flag.Bool("tls", false, "Connect to Redis over TLS")
+	tlsCACert := flag.String("tls-ca-cert", "", "CA certificate to verify the Redis server with (implies --tls)")
+	tlsCert := flag.String("tls-cert", "", "Client certificate for Redis (implies --tls)")
+	tlsKey := flag.String("tls-key", "", "Key of the client certificate (implies --tls)")
+	tlsSkipVerify := flag.Bool("tls-skip-verify", false, "Do not verify the Redis server's certificate (implies --tls)")
 	attrTimeout := flag.Float64("attr-timeout", 1.0, "Attribute cache TTL in seconds")
 	readOnly := flag.Bool("readonly", false, "Mount read-only")
 	allowOther := flag.Bool("allow-other", false, "Allow other users to access mount")
 	foreground := flag.Bool("foreground", true, "Run in foreground")
 	debug := flag.Bool("debug", false, "Enable FUSE debug logging")
+	fsName := flag.String("fsname", "redis-fs", "Mount source name shown in the mount table")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	showCapabilities := flag.Bool("capabilities", false, "Print the version, flags and fs module version as JSON, and exit")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <redis-key> <mountpoint>\n\n", os.Args[0])
@@ -37,6 +49,17 @@ func main() {
 
 	flag.Parse()
 
+	if *showCapabilities {
+		if err := rfsclient.WriteCapabilities(os.Stdout, "redis-fs-mount", flag.CommandLine); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *showVersion {
+		fmt.Println(rfsclient.Version("redis-fs-mount"))
+		return
+	}
+
 	if flag.NArg() != 2 {
 		flag.Usage()
 		os.Exit(1)
@@ -88,13 +111,32 @@ func main() {
 		log.Fatalf("mountpoint %s is not a directory", mountpoint)
 	}
 
+	if *redisPasswordEnv != "" {
+		*redisPassword = os.Getenv(*redisPasswordEnv)
+		os.Unsetenv(*redisPasswordEnv)
+	}
+
 	// Connect to Redis.
-	rdb := redis.NewClient(&redis.Options{
+	redisOpts := &redis.Options{
+		Network:  "tcp",
 		Addr:     *redisAddr,
+		Username: *redisUsername,
 		Password: *redisPassword,
 		DB:       *redisDB,
 		PoolSize: 16,
-	})
+	}
+	if *redisSocket != "" {
+		redisOpts.Network, redisOpts.Addr = "unix", *redisSocket
+		*redisAddr = *redisSocket
+	}
+	if *useTLS || *tlsCACert != "" || *tlsCert != "" || *tlsKey != "" || *tlsSkipVerify {
+		tlsConfig, err := rfsclient.TLSConfig(rfsclient.TLSOptions{CACert: *tlsCACert, Cert: *tlsCert, Key: *tlsKey, SkipVerify: *tlsSkipVerify})
+		if err != nil {
+			log.Fatalf("redis TLS: %v", err)
+		}
+		redisOpts.TLSConfig = tlsConfig
+	}
+	rdb := redis.NewClient(redisOpts)
 
 	ctx := context.Background()
 	if err := rdb.Ping(ctx).Err(); err != nil {
@@ -112,6 +154,7 @@ func main() {
 		Debug:       *debug,
 		UID:         uid,
 		GID:         gid,
+		FsName:      *fsName,
 	}
 
 	log.Printf("Mounting Redis FS key %q at %s", redisKey, mountpoint)
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"syscall"
 
 	"github.com/go-git/go-billy/v5"
+	rfsclient "github.com/redis-fs/mount/client"
 	"github.com/redis-fs/mount/internal/client"
 	"github.com/redis-fs/mount/internal/nfsfs"
 	"github.com/redis/go-redis/v9"
@@ -49,14 +51,35 @@ func (h authCompatHandler) Mount(ctx context.Context, conn net.Conn, req nfs.Mou
 
 func main() {
 	redisAddr := flag.String("redis", "localhost:6379", "Redis server address")
+	redisSocket := flag.String("socket", "", "Redis unix socket path, used instead of --redis")
+	redisUsername := flag.String("username", "", "Redis ACL username")
 	redisPassword := flag.String("password", "", "Redis password")
+	redisPasswordEnv := flag.String("password-env", "", "Read the Redis password from this environment variable, out of sight of ps")
 	redisDB := flag.Int("db", 0, "Redis database number")
+	useTLS := flag.Bool("tls", false, "Connect to Redis over TLS")
+	tlsCACert := flag.String("tls-ca-cert", "", "CA certificate to verify the Redis server with (implies --tls)")
+	tlsCert := flag.String("tls-cert", "", "Client certificate for Redis (implies --tls)")
+	tlsKey := flag.String("tls-key", "", "Key of the client certificate (implies --tls)")
+	tlsSkipVerify := flag.Bool("tls-skip-verify", false, "Do not verify the Redis server's certificate (implies --tls)")
 	listenAddr := flag.String("listen", "127.0.0.1:20490", "Listen address for NFS server")
 	exportPath := flag.String("export", "/myfs", "Exported NFS path")
 	readOnly := flag.Bool("readonly", false, "Export read-only")
 	foreground := flag.Bool("foreground", true, "Run in foreground")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	showCapabilities := flag.Bool("capabilities", false, "Print the version, flags and fs module version as JSON, and exit")
 	flag.Parse()
 
+	if *showCapabilities {
+		if err := rfsclient.WriteCapabilities(os.Stdout, "redis-fs-nfs", flag.CommandLine); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *showVersion {
+		fmt.Println(rfsclient.Version("redis-fs-nfs"))
+		return
+	}
+
 	if !*foreground {
 		log.Printf("--foreground=false is not supported; running foreground")
 	}
@@ -66,12 +89,31 @@ func main() {
 		log.Fatalf("invalid --export %q: expected absolute path", *exportPath)
 	}
 
-	rdb := redis.NewClient(&redis.Options{
+	if *redisPasswordEnv != "" {
+		*redisPassword = os.Getenv(*redisPasswordEnv)
+		os.Unsetenv(*redisPasswordEnv)
+	}
+
+	redisOpts := &redis.Options{
+		Network:  "tcp",
 		Addr:     *redisAddr,
+		Username: *redisUsername,
 		Password: *redisPassword,
 		DB:       *redisDB,
 		PoolSize: 16,
-	})
+	}
+	if *redisSocket != "" {
+		redisOpts.Network, redisOpts.Addr = "unix", *redisSocket
+		*redisAddr = *redisSocket
+	}
+	if *useTLS || *tlsCACert != "" || *tlsCert != "" || *tlsKey != "" || *tlsSkipVerify {
+		tlsConfig, err := rfsclient.TLSConfig(rfsclient.TLSOptions{CACert: *tlsCACert, Cert: *tlsCert, Key: *tlsKey, SkipVerify: *tlsSkipVerify})
+		if err != nil {
+			log.Fatalf("redis TLS: %v", err)
+		}
+		redisOpts.TLSConfig = tlsConfig
+	}
+	rdb := redis.NewClient(redisOpts)
 	defer rdb.Close()
 
 	ctx := context.Background()
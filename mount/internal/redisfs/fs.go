@@ -24,6 +24,7 @@ type Options struct {
 	Debug       bool
 	UID         uint32
 	GID         uint32
+	FsName      string // mount source shown in the mount table; defaults to "redis-fs"
 }
 
 // FSRoot is the root of the FUSE filesystem.
@@ -96,10 +97,15 @@ func Mount(mountpoint string, c client.Client, opts *Options) (*fuse.Server, err
 		},
 	}
 
+	fsName := opts.FsName
+	if fsName == "" {
+		fsName = "redis-fs"
+	}
+
 	fuseOpts := &fs.Options{
 		MountOptions: fuse.MountOptions{
 			AllowOther: opts.AllowOther,
-			FsName:     "redis-fs",
+			FsName:     fsName,
 			Name:       "redis-fs",
 			Debug:      opts.Debug,
 		},
@@ -0,0 +1,369 @@
+// Package client is a typed Go client for the sandbox REST API. Requests
+// and responses are the server's own types, aliased here, so the client
+// cannot drift from what the server sends.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/api"
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// Request and response types, shared with the server.
+type (
+	LaunchRequest    = api.LaunchRequest
+	ValidateResponse = api.ValidateResponse
+	WriteRequest     = api.WriteRequest
+	WriteResponse    = api.WriteResponse
+	Health           = api.Health
+	Session          = api.Session
+
+	LaunchResult  = executor.LaunchResult
+	ReadResult    = executor.ReadResult
+	StreamResult  = executor.StreamResult
+	OutputLines   = executor.OutputLines
+	StreamLines   = executor.StreamLines
+	ProcessInfo   = executor.ProcessInfo
+	RecordingInfo = executor.RecordingInfo
+	InputHistory  = executor.InputHistory
+	TailOptions   = executor.TailOptions
+	StreamEvent   = executor.StreamEvent
+	ProcessState  = executor.ProcessState
+)
+
+// Error is a request the server refused, as its JSON error envelope
+// describes it.
+type Error api.ErrorBody
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%d %s)", e.Message, e.Status, e.Code)
+}
+
+// Options configures a SandboxClient.
+type Options struct {
+	// HTTPClient sends the requests; nil uses http.DefaultClient.
+	HTTPClient *http.Client
+	// Token, when set, is sent as a bearer token.
+	Token string
+	// Retries is how many times a request that failed transiently is
+	// tried again; see send. Negative disables retries.
+	Retries int
+	// RetryBackoff is the wait before the first retry, doubling after
+	// each; Retry-After from the server takes precedence.
+	RetryBackoff time.Duration
+}
+
+// DefaultOptions retries twice, starting at a quarter second.
+func DefaultOptions() Options {
+	return Options{Retries: 2, RetryBackoff: 250 * time.Millisecond}
+}
+
+// maxRetryWait caps how long a Retry-After may hold up a retry.
+const maxRetryWait = 10 * time.Second
+
+// SandboxClient calls a sandbox server's v2 API.
+type SandboxClient struct {
+	base string
+	opts Options
+}
+
+// New returns a client for the server at baseURL, such as
+// http://localhost:8090.
+func New(baseURL string, opts Options) *SandboxClient {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &SandboxClient{base: strings.TrimRight(baseURL, "/") + "/" + api.APIVersionV2, opts: opts}
+}
+
+// send makes a request, retrying transient failures. A request the server
+// may have acted on is only retried when idempotent: connection failures
+// after dialing and 502 and 504 from a proxy are retried for idempotent
+// requests, while a failed dial, 429 and 503, which mean nothing was done,
+// are retried for any request. A response of 400 or above is returned as
+// an *Error.
+func (c *SandboxClient) send(ctx context.Context, method, path string, body interface{}, idempotent bool) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	wait := c.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.base+path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.opts.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+		}
+
+		resp, err := c.opts.HTTPClient.Do(req)
+		var retry bool
+		var after time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			retry = idempotent || isDialError(err)
+		case resp.StatusCode >= 400:
+			err = readError(resp)
+			switch resp.StatusCode {
+			case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+				retry = true
+				after = retryAfter(resp.Header.Get("Retry-After"))
+			case http.StatusBadGateway, http.StatusGatewayTimeout:
+				retry = idempotent
+			}
+		default:
+			return resp, nil
+		}
+		if !retry || attempt >= c.opts.Retries {
+			return nil, err
+		}
+		if after == 0 {
+			after = wait
+		}
+		wait *= 2
+		timer := time.NewTimer(after)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// call makes a request and decodes its JSON response into out.
+func (c *SandboxClient) call(ctx context.Context, method, path string, body, out interface{}, idempotent bool) error {
+	resp, err := c.send(ctx, method, path, body, idempotent)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// readError turns an error response into an *Error, whether or not it
+// came with the JSON envelope.
+func readError(resp *http.Response) error {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var env api.ErrorEnvelope
+	if json.Unmarshal(b, &env) == nil && env.Error.Status != 0 {
+		e := Error(env.Error)
+		return &e
+	}
+	return &Error{Status: resp.StatusCode, Code: "error", Message: strings.TrimSpace(string(b))}
+}
+
+func isDialError(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+// retryAfter reads a Retry-After header given in seconds.
+func retryAfter(v string) time.Duration {
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	if d := time.Duration(secs) * time.Second; d < maxRetryWait {
+		return d
+	}
+	return maxRetryWait
+}
+
+func processPath(id string, rest ...string) string {
+	return "/processes/" + url.PathEscape(id) + strings.Join(rest, "")
+}
+
+// Health reports whether the server can launch processes.
+func (c *SandboxClient) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	return &h, c.call(ctx, http.MethodGet, "/health", nil, &h, true)
+}
+
+// Launch starts a process; with req.Wait it returns once the process has
+// finished, with its output.
+func (c *SandboxClient) Launch(ctx context.Context, req LaunchRequest) (*LaunchResult, error) {
+	var res LaunchResult
+	return &res, c.call(ctx, http.MethodPost, "/processes", req, &res, false)
+}
+
+// Validate checks a launch without running it.
+func (c *SandboxClient) Validate(ctx context.Context, req LaunchRequest) (*ValidateResponse, error) {
+	var res ValidateResponse
+	return &res, c.call(ctx, http.MethodPost, "/processes/validate", req, &res, true)
+}
+
+// Read returns a process's state and output so far.
+func (c *SandboxClient) Read(ctx context.Context, id string) (*ReadResult, error) {
+	var res ReadResult
+	return &res, c.call(ctx, http.MethodGet, processPath(id), nil, &res, true)
+}
+
+// ReadTail is Read with each stream cut to its last n lines, counted by
+// the server.
+func (c *SandboxClient) ReadTail(ctx context.Context, id string, n int) (*ReadResult, error) {
+	var res ReadResult
+	return &res, c.call(ctx, http.MethodGet, processPath(id)+"?tail_lines="+strconv.Itoa(n), nil, &res, true)
+}
+
+// ReadStream returns the output of one stream (stdout, stderr or combined)
+// written after since; a zero since returns everything retained.
+func (c *SandboxClient) ReadStream(ctx context.Context, id, stream string, since time.Time) (*StreamResult, error) {
+	path := processPath(id, "/", url.PathEscape(stream))
+	if !since.IsZero() {
+		path += "?since=" + url.QueryEscape(since.Format(time.RFC3339Nano))
+	}
+	var res StreamResult
+	return &res, c.call(ctx, http.MethodGet, path, nil, &res, true)
+}
+
+// ReadStreamTail returns the last n lines of one stream.
+func (c *SandboxClient) ReadStreamTail(ctx context.Context, id, stream string, n int) (*StreamResult, error) {
+	path := processPath(id, "/", url.PathEscape(stream)) + "?tail_lines=" + strconv.Itoa(n)
+	var res StreamResult
+	return &res, c.call(ctx, http.MethodGet, path, nil, &res, true)
+}
+
+// Write sends input to the stdin of a process launched with
+// KeepStdinOpen.
+func (c *SandboxClient) Write(ctx context.Context, id string, req WriteRequest) (*WriteResponse, error) {
+	var res WriteResponse
+	return &res, c.call(ctx, http.MethodPost, processPath(id, "/write"), req, &res, false)
+}
+
+// Inputs returns the stdin history of a process.
+func (c *SandboxClient) Inputs(ctx context.Context, id string) (*InputHistory, error) {
+	var res InputHistory
+	return &res, c.call(ctx, http.MethodGet, processPath(id, "/inputs"), nil, &res, true)
+}
+
+// Recording streams the asciinema cast of a process launched with Record.
+// The caller closes it.
+func (c *SandboxClient) Recording(ctx context.Context, id string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, http.MethodGet, processPath(id, "/recording"), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Wait blocks until a process has finished and returns its output.
+func (c *SandboxClient) Wait(ctx context.Context, id string) (*ReadResult, error) {
+	var res ReadResult
+	return &res, c.call(ctx, http.MethodPost, processPath(id, "/wait"), nil, &res, true)
+}
+
+// Kill stops a process and returns the state it ended in. With a grace
+// period it is sent SIGTERM and SIGKILLed only if still running when the
+// period is up.
+func (c *SandboxClient) Kill(ctx context.Context, id string, grace time.Duration) (ProcessState, error) {
+	path := processPath(id)
+	if grace > 0 {
+		path += "?grace_period_secs=" + strconv.Itoa(int(grace.Round(time.Second)/time.Second))
+	}
+	var res api.StatusResponse
+	err := c.call(ctx, http.MethodDelete, path, nil, &res, true)
+	return ProcessState(res.Status), err
+}
+
+// Pause stops a running process with SIGSTOP until Resume.
+func (c *SandboxClient) Pause(ctx context.Context, id string) error {
+	var res api.StatusResponse
+	return c.call(ctx, http.MethodPost, processPath(id, "/pause"), nil, &res, true)
+}
+
+// Resume continues a paused process.
+func (c *SandboxClient) Resume(ctx context.Context, id string) error {
+	var res api.StatusResponse
+	return c.call(ctx, http.MethodPost, processPath(id, "/resume"), nil, &res, true)
+}
+
+// Tail starts a managed tail of a workspace file.
+func (c *SandboxClient) Tail(ctx context.Context, opts TailOptions) (*LaunchResult, error) {
+	var res LaunchResult
+	return &res, c.call(ctx, http.MethodPost, "/workspace/tail", opts, &res, false)
+}
+
+// SetSession sets where launches with session ID id start when they give
+// no cwd: a template relative to the workspace, or empty for the server's
+// default.
+func (c *SandboxClient) SetSession(ctx context.Context, id, cwd string) (*Session, error) {
+	var res Session
+	body := map[string]string{"cwd": cwd}
+	return &res, c.call(ctx, http.MethodPut, "/sessions/"+url.PathEscape(id), body, &res, true)
+}
+
+// ListOptions filters and long-polls List.
+type ListOptions struct {
+	// States keeps only processes in one of these states; empty lists all.
+	States []ProcessState
+	// ETag is the tag of a list already held. When it is still current,
+	// List reports NotModified, first waiting up to WaitForChange for the
+	// list to change.
+	ETag          string
+	WaitForChange time.Duration
+}
+
+// ListResult is the process list and the tag to pass as the next
+// ListOptions.ETag.
+type ListResult struct {
+	Processes   []*ProcessInfo
+	ETag        string
+	NotModified bool // the list is unchanged since ETag; Processes is nil
+}
+
+// List returns the server's processes.
+func (c *SandboxClient) List(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	q := url.Values{}
+	if len(opts.States) > 0 {
+		states := make([]string, len(opts.States))
+		for i, s := range opts.States {
+			states[i] = string(s)
+		}
+		q.Set("state", strings.Join(states, ","))
+	}
+	if opts.ETag != "" {
+		q.Set("etag", opts.ETag)
+	}
+	if opts.WaitForChange > 0 {
+		q.Set("wait_for_change", opts.WaitForChange.String())
+	}
+	path := "/processes"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	resp, err := c.send(ctx, http.MethodGet, path, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	res := &ListResult{ETag: resp.Header.Get("ETag")}
+	if resp.StatusCode == http.StatusNotModified {
+		res.NotModified = true
+		return res, nil
+	}
+	return res, json.NewDecoder(resp.Body).Decode(&res.Processes)
+}
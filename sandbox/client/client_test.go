@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/api"
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// newTestClient runs a real API server and returns a client for it.
+func newTestClient(t *testing.T) *SandboxClient {
+	t.Helper()
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	ts := httptest.NewServer(api.NewServer(executor.NewManager(dir, opts), api.NewConfig(dir, opts, executor.Features{})).Handler())
+	t.Cleanup(ts.Close)
+	return New(ts.URL, DefaultOptions())
+}
+
+func TestLaunchReadWait(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	res, err := c.Launch(ctx, LaunchRequest{Command: "echo out; echo err >&2; exit 3", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.State != executor.StateExited || res.ExitCode != 3 || res.Stdout != "out\n" || res.Stderr != "err\n" {
+		t.Fatalf("waited launch: %+v", res)
+	}
+
+	// An async launch outlives its request.
+	res, err = c.Launch(ctx, LaunchRequest{Command: "sleep 0.2; echo done"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.Wait(ctx, res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.State != executor.StateExited || out.Stdout != "done\n" {
+		t.Fatalf("wait: %+v", out)
+	}
+	if read, err := c.Read(ctx, res.ID); err != nil || read.Stdout != "done\n" {
+		t.Fatalf("read: %+v, %v", read, err)
+	}
+	if st, err := c.ReadStream(ctx, res.ID, "stdout", time.Time{}); err != nil || st.Data != "done\n" {
+		t.Fatalf("read stream: %+v, %v", st, err)
+	}
+
+	v, err := c.Validate(ctx, LaunchRequest{Command: "echo ("})
+	if err != nil || len(v.Warnings) == 0 {
+		t.Fatalf("validate: %+v, %v", v, err)
+	}
+}
+
+func TestWriteAndKill(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	res, err := c.Launch(ctx, LaunchRequest{Command: "cat", KeepStdinOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.Write(ctx, res.ID, WriteRequest{Input: "hello", Line: true, Tag: "greeting"})
+	if err != nil || w.Seq != 1 || w.Bytes != 6 {
+		t.Fatalf("write: %+v, %v", w, err)
+	}
+	if h, err := c.Inputs(ctx, res.ID); err != nil || len(h.Inputs) != 1 || h.Inputs[0].Tag != "greeting" {
+		t.Fatalf("inputs: %+v, %v", h, err)
+	}
+	if err := c.Pause(ctx, res.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Resume(ctx, res.ID); err != nil {
+		t.Fatal(err)
+	}
+	state, err := c.Kill(ctx, res.ID, time.Second)
+	if err != nil || state != executor.StateKilled {
+		t.Fatalf("kill: %s, %v", state, err)
+	}
+
+	// Errors arrive as the server's envelope.
+	var apiErr *Error
+	if err := c.Pause(ctx, res.ID); !errors.As(err, &apiErr) || apiErr.Status != http.StatusConflict || apiErr.Code != "conflict" {
+		t.Fatalf("pause after kill: %v", err)
+	}
+	if _, err := c.Read(ctx, "nope"); !errors.As(err, &apiErr) || apiErr.Code != "not_found" {
+		t.Fatalf("read unknown: %v", err)
+	}
+	if _, err := c.Launch(ctx, LaunchRequest{Command: ""}); !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadRequest {
+		t.Fatalf("empty command: %v", err)
+	}
+}
+
+func TestListFilterAndLongPoll(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	done, err := c.Launch(ctx, LaunchRequest{Command: "true", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, err := c.Launch(ctx, LaunchRequest{Command: "sleep 30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Kill(ctx, running.ID, 0)
+
+	all, err := c.List(ctx, ListOptions{})
+	if err != nil || len(all.Processes) != 2 || all.ETag == "" {
+		t.Fatalf("list: %+v, %v", all, err)
+	}
+	only, err := c.List(ctx, ListOptions{States: []ProcessState{executor.StateRunning}})
+	if err != nil || len(only.Processes) != 1 || only.Processes[0].ID != running.ID {
+		t.Fatalf("running: %+v, %v", only, err)
+	}
+	if exited, _ := c.List(ctx, ListOptions{States: []ProcessState{executor.StateExited}}); len(exited.Processes) != 1 || exited.Processes[0].ID != done.ID {
+		t.Fatalf("exited: %+v", exited)
+	}
+
+	same, err := c.List(ctx, ListOptions{ETag: all.ETag})
+	if err != nil || !same.NotModified {
+		t.Fatalf("unchanged list: %+v, %v", same, err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		c.Kill(ctx, running.ID, 0)
+	}()
+	changed, err := c.List(ctx, ListOptions{ETag: all.ETag, WaitForChange: 5 * time.Second})
+	if err != nil || changed.NotModified || changed.ETag == all.ETag {
+		t.Fatalf("long poll: %+v, %v", changed, err)
+	}
+}
+
+func TestAttachAndFollow(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	res, err := c.Launch(ctx, LaunchRequest{Command: "cat", KeepStdinOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Attach(ctx, res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write(ctx, res.ID, WriteRequest{Input: "one", Line: true}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-s.C:
+		if ev.Stream != "stdout" || ev.Data != "one\n" {
+			t.Fatalf("event: %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no output event")
+	}
+	c.Kill(ctx, res.ID, 0)
+	for range s.C {
+	}
+	if s.Err() != nil || s.Reason() != "process killed" {
+		t.Fatalf("attach ended %q, %v", s.Reason(), s.Err())
+	}
+
+	res, err = c.Launch(ctx, LaunchRequest{Command: "echo a; sleep 0.3; echo b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := c.Follow(ctx, res.ID, "stdout", 50*time.Millisecond)
+	var got strings.Builder
+	for ev := range f.C {
+		got.WriteString(ev.Data)
+	}
+	if f.Err() != nil || got.String() != "a\nb\n" || f.Reason() != "process exited" {
+		t.Fatalf("follow: %q, %q, %v", got.String(), f.Reason(), f.Err())
+	}
+}
+
+func TestRetriesTransientErrors(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	h := api.NewServer(executor.NewManager(dir, opts), api.NewConfig(dir, opts, executor.Features{})).Handler()
+	var calls, failures atomic.Int32
+	failures.Store(2)
+	var auth atomic.Value
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		auth.Store(r.Header.Get("Authorization"))
+		if failures.Add(-1) >= 0 {
+			http.Error(w, "upstream restarting", http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Options{Token: "s3cret", Retries: 2, RetryBackoff: time.Millisecond})
+	if _, err := c.Launch(context.Background(), LaunchRequest{Command: "true", Wait: true}); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 || auth.Load() != "Bearer s3cret" {
+		t.Fatalf("calls %d, auth %q", calls.Load(), auth.Load())
+	}
+
+	// 502 may mean the server acted, so only idempotent requests retry it.
+	calls.Store(0)
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	})
+	var apiErr *Error
+	if _, err := c.Launch(context.Background(), LaunchRequest{Command: "true"}); !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway || apiErr.Message != "bad gateway" {
+		t.Fatalf("launch through 502: %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("launch tried %d times", calls.Load())
+	}
+	calls.Store(0)
+	c.Read(context.Background(), "x")
+	if calls.Load() != 3 {
+		t.Fatalf("read tried %d times", calls.Load())
+	}
+}
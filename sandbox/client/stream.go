@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// Stream delivers a process's output as it is written. C is closed when
+// the stream ends; Reason and Err then say why.
+type Stream struct {
+	C <-chan StreamEvent
+
+	ch     chan StreamEvent
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	reason string
+	err    error
+}
+
+func newStream(ctx context.Context) *Stream {
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan StreamEvent, 64)
+	return &Stream{C: ch, ch: ch, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+}
+
+// deliver hands ev to the reader, giving up once the stream is closed.
+func (s *Stream) deliver(ev StreamEvent) bool {
+	select {
+	case s.ch <- ev:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// end records why the stream stopped and closes C.
+func (s *Stream) end(reason string, err error) {
+	if err == nil && s.ctx.Err() != nil && reason == "" {
+		reason = "closed"
+	}
+	s.reason, s.err = reason, err
+	close(s.ch)
+	close(s.done)
+}
+
+// Reason says why the stream ended, such as "process exited". It is set
+// once C is closed.
+func (s *Stream) Reason() string {
+	<-s.done
+	return s.reason
+}
+
+// Err is the error that ended the stream, if any. It is set once C is
+// closed.
+func (s *Stream) Err() error {
+	<-s.done
+	return s.err
+}
+
+// Close stops the stream and waits for it to end.
+func (s *Stream) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// maxEventBytes bounds one server-sent event; a single write to a
+// process's output is far smaller.
+const maxEventBytes = 4 << 20
+
+// Attach follows a running process's output as the server publishes it.
+// The stream ends when the process does, or when the server drops a
+// subscriber that fell too far behind. Too many subscribers is an *Error
+// with code too_many_subscribers.
+func (c *SandboxClient) Attach(ctx context.Context, id string) (*Stream, error) {
+	s := newStream(ctx)
+	resp, err := c.send(s.ctx, http.MethodGet, processPath(id, "/attach"), nil, true)
+	if err != nil {
+		s.cancel()
+		return nil, err
+	}
+	go func() {
+		defer resp.Body.Close()
+		defer s.cancel()
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(make([]byte, 64<<10), maxEventBytes)
+		var event, data string
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			case line == "":
+				switch event {
+				case "output":
+					var ev StreamEvent
+					if err := json.Unmarshal([]byte(data), &ev); err != nil {
+						s.end("", err)
+						return
+					}
+					if !s.deliver(ev) {
+						s.end("", nil)
+						return
+					}
+				case "end":
+					var end struct {
+						Reason string `json:"reason"`
+					}
+					json.Unmarshal([]byte(data), &end)
+					s.end(end.Reason, nil)
+					return
+				}
+				event, data = "", ""
+			}
+		}
+		if s.ctx.Err() != nil {
+			s.end("", nil)
+			return
+		}
+		err := sc.Err()
+		if err == nil {
+			err = errStreamCut
+		}
+		s.end("", err)
+	}()
+	return s, nil
+}
+
+// errStreamCut reports an attach stream that stopped without its end
+// event.
+var errStreamCut = &Error{Status: http.StatusBadGateway, Code: "stream_cut", Message: "the server closed the stream before the process ended"}
+
+// Follow polls one stream (stdout, stderr or combined) of a process every
+// interval, delivering what was written since the previous poll, until the
+// process ends. Unlike Attach it also replays the output written before it
+// was called, and works for a process that has already ended.
+func (c *SandboxClient) Follow(ctx context.Context, id, stream string, interval time.Duration) *Stream {
+	s := newStream(ctx)
+	go func() {
+		defer s.cancel()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var since time.Time
+		for {
+			res, err := c.ReadStream(s.ctx, id, stream, since)
+			if err != nil {
+				if s.ctx.Err() != nil {
+					err = nil
+				}
+				s.end("", err)
+				return
+			}
+			if res.Data != "" {
+				ev := StreamEvent{Stream: stream, Data: res.Data}
+				if res.NewestAt != nil {
+					ev.At = *res.NewestAt
+				}
+				if !s.deliver(ev) {
+					s.end("", nil)
+					return
+				}
+			}
+			if res.NewestAt != nil {
+				since = *res.NewestAt
+			}
+			if res.State != executor.StateRunning && res.State != executor.StatePaused {
+				s.end("process "+string(res.State), nil)
+				return
+			}
+			select {
+			case <-s.ctx.Done():
+				s.end("", nil)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
@@ -2,21 +2,33 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/redis-fs/sandbox/client"
+	"github.com/redis-fs/sandbox/internal/executor"
 )
 
-var baseURL string
+var sandbox *client.SandboxClient
 
 func main() {
-	flag.StringVar(&baseURL, "url", "http://localhost:8090", "Sandbox server URL")
+	baseURL := flag.String("url", "http://localhost:8090", "Sandbox server URL")
+	token := flag.String("token", os.Getenv("SANDBOX_AUTH_TOKEN"), "Bearer token sent with each request (default $SANDBOX_AUTH_TOKEN)")
 	flag.Parse()
 
+	opts := client.DefaultOptions()
+	opts.Token = *token
+	sandbox = client.New(*baseURL, opts)
+
 	if flag.NArg() < 1 {
 		usage()
 		os.Exit(1)
@@ -33,12 +45,22 @@ func main() {
 		err = cmdRead(args)
 	case "write", "input":
 		err = cmdWrite(args)
+	case "inputs":
+		err = cmdInputs(args)
 	case "kill", "stop":
 		err = cmdKill(args)
+	case "pause":
+		err = cmdSignal(args, "pause")
+	case "resume":
+		err = cmdSignal(args, "resume")
 	case "list", "ps":
-		err = cmdList()
+		err = cmdList(args)
 	case "wait":
 		err = cmdWait(args)
+	case "record":
+		err = cmdRecord(args)
+	case "tail":
+		err = cmdTail(args)
 	default:
 		usage()
 		os.Exit(1)
@@ -57,12 +79,20 @@ Usage:
   sandbox-cli [flags] <command> [args...]
 
 Commands:
-  launch <command>     Launch a process (use -w to wait)
-  read <id>            Read process output
-  write <id> <input>   Write to process stdin
-  kill <id>            Kill a process
-  list                 List all processes
+  launch <command>     Launch a process (use -w to wait, -m to merge stderr into stdout,
+                       -r to record it on a terminal)
+  read <id>            Read process output (-n lines: only the last lines of each stream)
+  write <id> <input>   Write a line to process stdin (-n: no newline)
+  inputs <id>          Show the input history of a process
+  kill <id>            Kill a process (-g n: SIGTERM first, SIGKILL after n seconds)
+  pause <id>           Pause a process until resumed
+  resume <id>          Resume a paused process
+  list                 List all processes (-state running,paused to filter,
+                       -json for the raw response)
   wait <id>            Wait for process to complete
+  record <id>          Download the recording of a process launched with -r as an
+                       asciinema cast (-o file, default stdout)
+  tail <path>          Print the end of a workspace file (-n lines, -f follow)
 
 Flags:`)
 	flag.PrintDefaults()
@@ -74,95 +104,237 @@ func cmdLaunch(args []string) error {
 	cwd := fs.String("d", "", "Working directory")
 	timeout := fs.Int("t", 0, "Timeout in seconds")
 	keepStdin := fs.Bool("i", false, "Keep stdin open")
+	nice := fs.Int("nice", 0, "Scheduling niceness")
+	profile := fs.String("profile", "", "Security profile to launch under")
+	merge := fs.Bool("m", false, "Merge stderr into stdout, keeping the order they were written in")
+	grace := fs.Int("g", 0, "On timeout, seconds to let the process handle SIGTERM before SIGKILL")
+	record := fs.Bool("r", false, "Run on a terminal and record it as an asciinema cast")
 	fs.Parse(args)
 
 	if fs.NArg() < 1 {
 		return fmt.Errorf("command required")
 	}
 
-	body, _ := json.Marshal(map[string]interface{}{
-		"command":         fs.Arg(0),
-		"cwd":             *cwd,
-		"timeout_secs":    *timeout,
-		"wait":            *wait,
-		"keep_stdin_open": *keepStdin,
-	})
-
-	resp, err := http.Post(baseURL+"/processes", "application/json", bytes.NewReader(body))
-	if err != nil {
-		return err
+	req := client.LaunchRequest{
+		Command:         fs.Arg(0),
+		Cwd:             *cwd,
+		TimeoutSecs:     *timeout,
+		Wait:            *wait,
+		KeepStdinOpen:   *keepStdin,
+		SecurityProfile: *profile,
+		MergeOutput:     *merge,
+		GracePeriodSecs: *grace,
+		Record:          *record,
 	}
-	defer resp.Body.Close()
-
-	return printJSON(resp.Body)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "nice" {
+			req.Nice = nice
+		}
+	})
+	return printJSON(sandbox.Launch(context.Background(), req))
 }
 
 func cmdRead(args []string) error {
-	if len(args) < 1 {
+	fs := flag.NewFlagSet("read", flag.ExitOnError)
+	lines := fs.Int("n", 0, "Only the last n lines of each stream")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
 		return fmt.Errorf("process ID required")
 	}
-	resp, err := http.Get(baseURL + "/processes/" + args[0])
-	if err != nil {
-		return err
+	if *lines > 0 {
+		return printJSON(sandbox.ReadTail(context.Background(), fs.Arg(0), *lines))
 	}
-	defer resp.Body.Close()
-	return printJSON(resp.Body)
+	return printJSON(sandbox.Read(context.Background(), fs.Arg(0)))
 }
 
 func cmdWrite(args []string) error {
-	if len(args) < 2 {
+	fs := flag.NewFlagSet("write", flag.ExitOnError)
+	noNewline := fs.Bool("n", false, "Do not append a trailing newline")
+	tag := fs.String("tag", "", "Label recorded in the input history")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 {
 		return fmt.Errorf("process ID and input required")
 	}
-	body, _ := json.Marshal(map[string]string{"input": args[1]})
-	resp, err := http.Post(baseURL+"/processes/"+args[0]+"/write", "application/json", bytes.NewReader(body))
-	if err != nil {
-		return err
+	return printJSON(sandbox.Write(context.Background(), fs.Arg(0), client.WriteRequest{
+		Input: fs.Arg(1),
+		Line:  !*noNewline,
+		Tag:   *tag,
+	}))
+}
+
+func cmdInputs(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("process ID required")
 	}
-	defer resp.Body.Close()
-	return printJSON(resp.Body)
+	return printJSON(sandbox.Inputs(context.Background(), args[0]))
 }
 
 func cmdKill(args []string) error {
+	fs := flag.NewFlagSet("kill", flag.ExitOnError)
+	grace := fs.Int("g", 0, "Seconds to let the process handle SIGTERM before SIGKILL")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		return fmt.Errorf("process ID required")
+	}
+	state, err := sandbox.Kill(context.Background(), fs.Arg(0), time.Duration(*grace)*time.Second)
+	return printJSON(map[string]client.ProcessState{"status": state}, err)
+}
+
+// cmdSignal pauses or resumes a process.
+func cmdSignal(args []string, action string) error {
 	if len(args) < 1 {
 		return fmt.Errorf("process ID required")
 	}
-	req, _ := http.NewRequest("DELETE", baseURL+"/processes/"+args[0], nil)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	apply, status := sandbox.Pause, "paused"
+	if action == "resume" {
+		apply, status = sandbox.Resume, "running"
 	}
-	defer resp.Body.Close()
-	return printJSON(resp.Body)
+	err := apply(context.Background(), args[0])
+	return printJSON(map[string]string{"status": status}, err)
 }
 
-func cmdList() error {
-	resp, err := http.Get(baseURL + "/processes")
+func cmdList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	raw := fs.Bool("json", false, "Print the server's JSON instead of a table")
+	state := fs.String("state", "", "Only list processes in these comma-separated states")
+	fs.Parse(args)
+
+	var opts client.ListOptions
+	for _, s := range strings.Split(*state, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			opts.States = append(opts.States, client.ProcessState(s))
+		}
+	}
+	res, err := sandbox.List(context.Background(), opts)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	return printJSON(resp.Body)
+	procs := res.Processes
+	if *raw {
+		return printJSON(procs, nil)
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].StartedAt.Before(procs[j].StartedAt) })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPID\tSTATE\tAGE\tDURATION\tCOMMAND")
+	for _, p := range procs {
+		state := string(p.State)
+		if p.State == executor.StateExited {
+			state = fmt.Sprintf("exited(%d)", p.ExitCode)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", p.ID, p.PID, state,
+			formatDuration(time.Duration(p.AgeMs)*time.Millisecond),
+			formatDuration(time.Duration(p.DurationMs)*time.Millisecond),
+			shorten(p.Command, 50))
+	}
+	return tw.Flush()
+}
+
+// formatDuration renders d the way rfs status does, with milliseconds
+// for processes younger than a second.
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	d = d.Truncate(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	if d < time.Hour {
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// shorten collapses a command onto one line and cuts it to n runes.
+func shorten(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
 }
 
 func cmdWait(args []string) error {
 	if len(args) < 1 {
 		return fmt.Errorf("process ID required")
 	}
-	resp, err := http.Post(baseURL+"/processes/"+args[0]+"/wait", "application/json", nil)
+	return printJSON(sandbox.Wait(context.Background(), args[0]))
+}
+
+// cmdRecord writes a process's recording to a file or stdout. The -o flag
+// may come before or after the ID.
+func cmdRecord(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	out := fs.String("o", "", "File to write the cast to (default stdout)")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		return fmt.Errorf("process ID required")
+	}
+	id := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+
+	body, err := sandbox.Recording(context.Background(), id)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	return printJSON(resp.Body)
+	defer body.Close()
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = io.Copy(w, body)
+	return err
 }
 
-func printJSON(r io.Reader) error {
-	var data interface{}
-	if err := json.NewDecoder(r).Decode(&data); err != nil {
+func cmdTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	lines := fs.Int("n", 10, "Number of trailing lines to print")
+	follow := fs.Bool("f", false, "Keep printing lines as the file grows")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		return fmt.Errorf("path required")
+	}
+	started, err := sandbox.Tail(context.Background(), client.TailOptions{Path: fs.Arg(0), Lines: *lines, Follow: *follow})
+	if err != nil {
 		return err
 	}
-	out, _ := json.MarshalIndent(data, "", "  ")
+	if !*follow {
+		fmt.Print(started.Stdout)
+		return nil
+	}
+
+	// Follow until interrupted, then stop the tail on the server so it
+	// does not outlive this command.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	defer sandbox.Kill(context.Background(), started.ID, 0)
+
+	s := sandbox.Follow(ctx, started.ID, "stdout", 500*time.Millisecond)
+	for ev := range s.C {
+		fmt.Print(ev.Data)
+	}
+	return s.Err()
+}
+
+// printJSON prints a typed result, or returns the error that came
+// instead of it.
+func printJSON(v interface{}, err error) error {
+	if err != nil {
+		return err
+	}
+	out, _ := json.MarshalIndent(v, "", "  ")
 	fmt.Println(string(out))
 	return nil
 }
-
@@ -6,63 +6,201 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/redis-fs/sandbox/internal/api"
 	"github.com/redis-fs/sandbox/internal/executor"
 )
 
 func main() {
+	// A launch under a security profile re-executes this binary to apply
+	// it; that must happen before anything else runs.
+	executor.MaybeRunSecurityHelper()
+
 	port := flag.Int("port", 8090, "HTTP server port")
 	workspace := flag.String("workspace", "/workspace", "Workspace directory")
-	transport := flag.String("transport", "http", "Transport: http or stdio (MCP)")
+	transport := flag.String("transport", "http", "Comma-separated transports: http, and MCP over stdio, ws, or tcp (e.g. http,stdio)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", api.DefaultShutdownTimeout, "How long in-flight HTTP requests may run after SIGINT or SIGTERM")
+	authToken := flag.String("auth-token", os.Getenv("SANDBOX_AUTH_TOKEN"), "Bearer token clients must present; required for the ws and tcp transports, and guards the HTTP API too when set (default $SANDBOX_AUTH_TOKEN)")
+
+	opts := executor.DefaultOptions()
+	flag.IntVar(&opts.Priority.DefaultNice, "nice-default", opts.Priority.DefaultNice, "Niceness applied when a launch does not request one")
+	flag.IntVar(&opts.Priority.MinNice, "nice-min", opts.Priority.MinNice, "Lowest niceness a launch may request")
+	flag.IntVar(&opts.Priority.MaxNice, "nice-max", opts.Priority.MaxNice, "Highest niceness a launch may request")
+	flag.IntVar(&opts.OpenFiles.Default, "open-files-default", opts.OpenFiles.Default, "Open file limit applied when a launch does not request one (0 inherits the server's)")
+	flag.IntVar(&opts.OpenFiles.Max, "open-files-max", opts.OpenFiles.Max, "Highest open file limit a launch may request (0 for no bound)")
+	flag.IntVar(&opts.MaxCommandBytes, "max-command-bytes", opts.MaxCommandBytes, "Longest command string a launch may submit (0 disables the check)")
+	flag.IntVar(&opts.MaxOutputBytes, "max-output-bytes", opts.MaxOutputBytes, "Output retained per stream; older output is discarded beyond it (0 keeps everything)")
+	flag.StringVar(&opts.ProcessLogDir, "process-log-dir", opts.ProcessLogDir, "Directory for per-process files such as recordings")
+	flag.IntVar(&opts.Subscribers.PerProcess, "subscribers-per-process", opts.Subscribers.PerProcess, "Live output subscribers (attach streams) allowed per process (0 for no bound)")
+	flag.IntVar(&opts.Subscribers.Total, "subscribers-max", opts.Subscribers.Total, "Live output subscribers allowed across all processes (0 for no bound)")
+	flag.DurationVar(&opts.Subscribers.SlowGrace, "subscriber-grace", opts.Subscribers.SlowGrace, "How long a subscriber may fall behind the output before it is dropped")
+	probe := executor.DefaultFeatureProbe()
+	flag.BoolVar(&probe.DisableCgroups, "no-cgroups", false, "Do not use cgroups even when available")
+	flag.BoolVar(&probe.DisablePrivilegeDrop, "no-privilege-drop", false, "Do not drop privileges for launched processes")
+	flag.BoolVar(&probe.DisableNetworkIsolation, "no-network-isolation", false, "Do not isolate launched processes from the network")
+	sweepInterval := flag.Duration("sweep-interval", 10*time.Second, "How often to check running processes against the process table (0 disables)")
+	limits := api.DefaultRateLimits()
+	flag.Float64Var(&limits.Launch.PerSecond, "rate-launch", limits.Launch.PerSecond, "Launch, write and kill requests allowed per second per client (0 disables)")
+	flag.IntVar(&limits.Launch.Burst, "rate-launch-burst", limits.Launch.Burst, "Launch-class requests a client may make in a burst")
+	flag.Float64Var(&limits.Read.PerSecond, "rate-read", limits.Read.PerSecond, "Read requests allowed per second per client (0 disables)")
+	flag.IntVar(&limits.Read.Burst, "rate-read-burst", limits.Read.Burst, "Read requests a client may make in a burst")
+	profilesPath := flag.String("security-profiles", "", "JSON file declaring the security profiles launches may select")
+	flag.BoolVar(&opts.Workspace.Create, "create-workspace", opts.Workspace.Create, "Create the workspace directory if it does not exist")
+	workspaceMode := flag.String("workspace-mode", fmt.Sprintf("%04o", opts.Workspace.Mode), "Permissions (octal) of a workspace the server creates")
+	flag.StringVar(&opts.Workspace.Root, "workspace-root", "", "Directory the workspace must resolve inside of, even through symlinks")
+	redisFSMount := flag.String("redis-fs-mount", "", "Live redis-fs FUSE mountpoint to expose to launches at <workspace>/"+executor.RedisFSLinkName)
+	flag.StringVar(&opts.SessionCwd, "session-cwd", "", "Directory, relative to the workspace, where launches with a session_id start by default, such as sessions/{{.SessionID}}")
+	ioniceClasses := flag.String("ionice-classes", strings.Join(opts.Priority.IONiceClasses, ","), "Comma-separated I/O classes a launch may request")
 
 	flag.Parse()
 
-	manager := executor.NewManager(*workspace)
+	transports, err := api.ParseTransports(*transport)
+	if err != nil {
+		log.Fatalf("--transport: %v", err)
+	}
+	if (transports.WS || transports.TCP) && *authToken == "" {
+		log.Fatalf("--transport %s exposes process execution over the network and requires --auth-token", *transport)
+	}
+
+	opts.Priority.IONiceClasses = strings.Split(*ioniceClasses, ",")
+	if opts.Priority.MinNice > opts.Priority.MaxNice ||
+		opts.Priority.DefaultNice < opts.Priority.MinNice || opts.Priority.DefaultNice > opts.Priority.MaxNice {
+		log.Fatalf("invalid nice policy: default %d must lie within [%d, %d]",
+			opts.Priority.DefaultNice, opts.Priority.MinNice, opts.Priority.MaxNice)
+	}
 
-	if *transport == "stdio" {
-		// Run MCP server over stdio
-		mcp := api.NewMCPServer(manager)
-		if err := mcp.Run(context.Background(), os.Stdin, os.Stdout); err != nil {
-			log.Fatalf("MCP server error: %v", err)
+	if opts.OpenFiles.Default < 0 || opts.OpenFiles.Max < 0 ||
+		(opts.OpenFiles.Max > 0 && opts.OpenFiles.Default > opts.OpenFiles.Max) {
+		log.Fatalf("invalid open file policy: default %d must lie within [0, %d]", opts.OpenFiles.Default, opts.OpenFiles.Max)
+	}
+	if opts.Subscribers.PerProcess < 0 || opts.Subscribers.Total < 0 || opts.Subscribers.SlowGrace <= 0 {
+		log.Fatalf("invalid subscriber limits: counts must not be negative and the grace period must be positive")
+	}
+	if err := executor.CheckTemplate("--session-cwd", opts.SessionCwd); err != nil {
+		log.Fatal(err)
+	}
+	if filepath.IsAbs(opts.SessionCwd) {
+		log.Fatalf("--session-cwd %s must be relative to the workspace", opts.SessionCwd)
+	}
+	// Launches get their own limit, so the server can take all it may.
+	if soft, hard, err := executor.RaiseFDLimit(); err != nil {
+		log.Printf("Open file limit: soft %d, hard %d (could not raise: %v)", soft, hard, err)
+	} else {
+		log.Printf("Open file limit: soft %d, hard %d; launches get %d by default, at most %d", soft, hard, opts.OpenFiles.Default, opts.OpenFiles.Max)
+	}
+
+	mode, err := strconv.ParseUint(*workspaceMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		log.Fatalf("invalid --workspace-mode %q: expected octal permission bits such as 0755", *workspaceMode)
+	}
+	opts.Workspace.Mode = os.FileMode(mode)
+	abs, resolved, err := executor.PrepareWorkspace(*workspace, opts.Workspace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	*workspace = abs
+	if resolved != abs {
+		log.Printf("Workspace %s resolves to %s", abs, resolved)
+	}
+
+	if *profilesPath != "" {
+		profiles, err := executor.LoadSecurityProfiles(*profilesPath)
+		if err != nil {
+			log.Fatalf("security profiles: %v", err)
+		}
+		for _, p := range profiles {
+			if err := p.Supported(); err != nil {
+				if p.Name == executor.DefaultSecurityProfile {
+					log.Fatalf("security profiles: %v", err)
+				}
+				log.Printf("security profiles: %v; launches selecting it will be refused", err)
+			}
+		}
+		opts.SecurityProfiles = profiles
+	}
+
+	opts.Logger = slog.Default()
+	manager := executor.NewManager(*workspace, opts)
+	if *redisFSMount != "" {
+		if err := manager.AttachRedisFS(*redisFSMount); err != nil {
+			log.Fatalf("redis-fs mount: %v", err)
 		}
-		return
 	}
+	manager.StartSweeper(context.Background(), *sweepInterval)
+
+	config := api.NewConfig(*workspace, opts, executor.DetectFeatures(probe))
+	config.SweepIntervalSecs = int(sweepInterval.Seconds())
+	config.RateLimits = limits
 
-	// HTTP server
-	server := api.NewServer(manager)
-	addr := fmt.Sprintf(":%d", *port)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	httpServer := &http.Server{
-		Addr:    addr,
-		Handler: server.Handler(),
+	serveOpts := api.ServeOptions{
+		Transports:      transports,
+		Stdin:           os.Stdin,
+		Stdout:          os.Stdout,
+		AuthToken:       *authToken,
+		ShutdownTimeout: *shutdownTimeout,
+	}
+	if transports.Listens() {
+		addr := fmt.Sprintf(":%d", *port)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("listen: %v", err)
+		}
+		serveOpts.Listener = ln
+		logListening(transports, ln.Addr().String(), *workspace, *redisFSMount)
+	}
+	// Logs go to stderr, so they never mix with MCP on stdout.
+	if transports.Stdio && transports.Listens() {
+		log.Printf("MCP also on stdio; closing stdin ends that session only")
 	}
 
-	// Graceful shutdown
 	go func() {
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		<-sigCh
+		<-ctx.Done()
 		log.Println("Shutting down...")
-		httpServer.Shutdown(context.Background())
 	}()
+	if err := api.Serve(ctx, manager, config, serveOpts); err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+}
 
+// logListening describes the network frontends at startup.
+func logListening(t api.Transports, addr, workspace, redisFSMount string) {
+	if t.TCP {
+		log.Printf("Sandbox MCP listening on tcp %s (send {\"token\": ...} as the first line)", addr)
+		return
+	}
+	if t.WS {
+		log.Printf("Sandbox MCP listening on ws://%s/mcp", addr)
+	}
+	if !t.HTTP {
+		return
+	}
 	log.Printf("Sandbox server listening on %s", addr)
-	log.Printf("Workspace: %s", *workspace)
-	log.Printf("Endpoints:")
+	log.Printf("Workspace: %s", workspace)
+	if redisFSMount != "" {
+		log.Printf("redis-fs: %s (at %s/%s)", redisFSMount, workspace, executor.RedisFSLinkName)
+	}
+	log.Printf("Endpoints (prefix /v1 or /v2; unprefixed paths are deprecated aliases of /v1):")
+	log.Printf("  GET    /config          - Limits and capabilities")
 	log.Printf("  POST   /processes       - Launch process")
-	log.Printf("  GET    /processes       - List processes")
+	log.Printf("  POST   /processes/validate - Check a launch without running it")
+	log.Printf("  GET    /processes       - List processes (?wait_for_change=30s&etag=... to long-poll)")
 	log.Printf("  GET    /processes/{id}  - Read process output")
 	log.Printf("  POST   /processes/{id}/write - Write to stdin")
 	log.Printf("  POST   /processes/{id}/wait  - Wait for completion")
+	log.Printf("  GET    /processes/{id}/transcript - Stdin, output and state as JSONL (?format=text)")
 	log.Printf("  DELETE /processes/{id}  - Kill process")
-
-	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatalf("Server error: %v", err)
-	}
+	log.Printf("  POST   /workspace/tail  - Tail (and follow) a workspace file")
+	log.Printf("  GET    /metrics (unprefixed) - Prometheus metrics")
 }
-
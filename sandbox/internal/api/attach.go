@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// handleAttach streams a running process's output as server-sent events:
+// an "output" event per write, then one "end" event saying why the stream
+// stopped (the process ended, or the client fell too far behind and was
+// dropped). Too many subscribers is 429 with a JSON error.
+func (s *Server) handleAttach(w http.ResponseWriter, r *http.Request) {
+	sub, err := s.manager.Subscribe(mux.Vars(r)["id"])
+	if err != nil {
+		var lerr *executor.LimitError
+		var serr *executor.StateError
+		switch {
+		case errors.As(err, &lerr):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(ErrorEnvelope{Error: ErrorBody{
+				Status:  http.StatusTooManyRequests,
+				Code:    "too_many_subscribers",
+				Message: err.Error(),
+			}})
+		case errors.As(err, &serr):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+		return
+	}
+	defer sub.Close()
+
+	flusher, _ := w.(http.Flusher)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				b, _ := json.Marshal(map[string]string{"reason": sub.Reason()})
+				fmt.Fprintf(w, "event: end\ndata: %s\n\n", b)
+				if flusher != nil {
+					flusher.Flush()
+				}
+				return
+			}
+			b, _ := json.Marshal(ev)
+			if _, err := fmt.Fprintf(w, "event: output\ndata: %s\n\n", b); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
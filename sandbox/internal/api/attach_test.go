@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+func TestAttachStreamsOutputAndLimitsSubscribers(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	opts.Subscribers.PerProcess = 1
+	m := executor.NewManager(dir, opts)
+	ts := httptest.NewServer(NewServer(m, NewConfig(dir, opts, executor.Features{})).Handler())
+	t.Cleanup(ts.Close)
+
+	launched, err := m.Launch(context.Background(), executor.LaunchOptions{Command: "sleep 0.3; echo hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := http.Get(ts.URL + "/v2/processes/" + launched.ID + "/attach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); stream.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("attach: %d %s", stream.StatusCode, ct)
+	}
+
+	for _, prefix := range []string{"/v1", "/v2"} {
+		resp, err := http.Get(ts.URL + prefix + "/processes/" + launched.ID + "/attach")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body ErrorEnvelope
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests || err != nil || body.Error.Code != "too_many_subscribers" {
+			t.Fatalf("%s second subscriber: %d %+v %v", prefix, resp.StatusCode, body, err)
+		}
+	}
+
+	var events []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sc := bufio.NewScanner(stream.Body)
+		for sc.Scan() {
+			if line := sc.Text(); line != "" {
+				events = append(events, line)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("stream did not end with the process")
+	}
+	got := strings.Join(events, "\n")
+	if !strings.Contains(got, "event: output\ndata: {\"stream\":\"stdout\",\"data\":\"hello\\n\"") ||
+		!strings.HasSuffix(got, "event: end\ndata: {\"reason\":\"process exited\"}") {
+		t.Fatalf("events:\n%s", got)
+	}
+}
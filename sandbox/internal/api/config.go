@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// Config describes the limits and capabilities clients can rely on. It is
+// assembled once at startup from flags and runtime probes.
+type Config struct {
+	Workspace          string                     `json:"workspace"`
+	Shells             []string                   `json:"shells"`
+	MaxOutputBytes     int64                      `json:"max_output_bytes"`
+	MaxCommandBytes    int                        `json:"max_command_bytes"`
+	DefaultTimeoutSecs int                        `json:"default_timeout_secs"`
+	MaxTimeoutSecs     int                        `json:"max_timeout_secs"`
+	Retention          string                     `json:"retention"`
+	SweepIntervalSecs  int                        `json:"sweep_interval_secs"`
+	Priority           executor.PriorityPolicy    `json:"priority"`
+	OpenFiles          executor.FDPolicy          `json:"open_files"`
+	SecurityProfiles   []executor.SecurityProfile `json:"security_profiles"`
+	RateLimits         RateLimits                 `json:"rate_limits"`
+	Subscribers        executor.SubscriberLimits  `json:"subscribers"`
+	Features           executor.Features          `json:"features"`
+	APIVersions        []string                   `json:"api_versions"`
+
+	// TemplateVariables may appear as {{.Name}} in a launch's cwd and env
+	// values. SessionCwd is where launches in a session start by default.
+	TemplateVariables []executor.TemplateVariable `json:"template_variables"`
+	SessionCwd        string                      `json:"session_cwd,omitempty"`
+
+	// RedisFS is probed per request rather than fixed at startup.
+	RedisFS *executor.RedisFSStatus `json:"redis_fs,omitempty"`
+}
+
+// NewConfig builds the advertised configuration for a workspace and policy.
+func NewConfig(workspace string, opts executor.Options, features executor.Features) Config {
+	return Config{
+		Workspace:        workspace,
+		Shells:           []string{"sh"},
+		Retention:        "until server restart",
+		MaxCommandBytes:  opts.MaxCommandBytes,
+		MaxOutputBytes:   int64(opts.MaxOutputBytes),
+		Priority:         opts.Priority,
+		OpenFiles:        opts.OpenFiles,
+		SecurityProfiles: opts.SecurityProfiles,
+		Subscribers:      opts.Subscribers,
+		RateLimits:       DefaultRateLimits(),
+		Features:         features,
+		APIVersions:      []string{APIVersionV1, APIVersionV2},
+
+		TemplateVariables: executor.TemplateVariables,
+		SessionCwd:        opts.SessionCwd,
+	}
+}
+
+// summary is the condensed form advertised in the MCP initialize result.
+func (c Config) summary() map[string]interface{} {
+	return map[string]interface{}{
+		"workspace":         c.Workspace,
+		"shells":            c.Shells,
+		"max_output_bytes":  c.MaxOutputBytes,
+		"max_command_bytes": c.MaxCommandBytes,
+		"max_timeout_secs":  c.MaxTimeoutSecs,
+		"features":          c.Features,
+	}
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	config := s.config
+	config.RedisFS = s.manager.RedisFS()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config)
+}
+
+// Stats is a point-in-time view of server load. /metrics exports the
+// same numbers.
+type Stats struct {
+	Processes   map[executor.ProcessState]int `json:"processes"`
+	Counters    executor.Counters             `json:"counters"`
+	RateLimit   RateUsage                     `json:"rate_limit"`
+	Subscribers executor.SubscriberStats      `json:"subscribers"`
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	snap := s.manager.Metrics()
+	stats := Stats{
+		Processes:   snap.States,
+		Counters:    snap.Counters,
+		RateLimit:   s.limiter.usage(),
+		Subscribers: s.manager.Subscribers(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -4,7 +4,11 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/redis-fs/sandbox/internal/executor"
 )
@@ -29,32 +33,121 @@ type MCPError struct {
 	Message string `json:"message"`
 }
 
+// MCPNotification is a server-initiated message that expects no reply.
+type MCPNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
 // MCPServer handles MCP protocol over stdio.
 type MCPServer struct {
 	manager *executor.Manager
+	config  Config
+
+	progressInterval time.Duration
+	progressBytes    int
+
+	outMu sync.Mutex
+	out   *json.Encoder
+
+	// initialized is set once the client has sent initialize; change
+	// notifications are held back until then.
+	initialized atomic.Bool
 }
 
 // NewMCPServer creates a new MCP server.
-func NewMCPServer(manager *executor.Manager) *MCPServer {
-	return &MCPServer{manager: manager}
+func NewMCPServer(manager *executor.Manager, config Config) *MCPServer {
+	return &MCPServer{
+		manager:          manager,
+		config:           config,
+		progressInterval: defaultProgressInterval,
+		progressBytes:    defaultProgressBytes,
+	}
 }
 
-// Run starts the MCP server reading from r and writing to w.
+// maxMCPMessageBytes bounds a single JSON-RPC line read from stdin.
+const maxMCPMessageBytes = 16 << 20
+
+// Run starts the MCP server reading from r and writing to w. It returns
+// when r reaches EOF, or when ctx is done, without waiting for a read that
+// may never finish; tool calls already running are answered first.
 func (s *MCPServer) Run(ctx context.Context, r io.Reader, w io.Writer) error {
 	scanner := bufio.NewScanner(r)
-	encoder := json.NewEncoder(w)
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
+	// Oversized commands must reach Launch to be rejected with a clear
+	// error instead of ending the session with bufio.ErrTooLong.
+	scanner.Buffer(make([]byte, 64<<10), maxMCPMessageBytes)
+	s.out = json.NewEncoder(w)
+
+	// Tool calls run concurrently so a waited launch does not block the
+	// session; everything else is answered in order.
+	var calls sync.WaitGroup
+	defer calls.Wait()
+
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	var watcher sync.WaitGroup
+	watcher.Add(1)
+	go func() {
+		defer watcher.Done()
+		s.watchProcesses(watchCtx)
+	}()
+	defer watcher.Wait()
+	defer stopWatch()
+
+	lines := make(chan []byte)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		for scanner.Scan() {
+			select {
+			case lines <- append([]byte(nil), scanner.Bytes()...):
+			case <-ctx.Done():
+				scanErr <- nil
+				return
+			}
+		}
+		scanErr <- scanner.Err()
+	}()
+
+	for {
+		var line []byte
+		select {
+		case <-ctx.Done():
+			return nil
+		case l, ok := <-lines:
+			if !ok {
+				return <-scanErr
+			}
+			line = l
+		}
 		var req MCPRequest
 		if err := json.Unmarshal(line, &req); err != nil {
 			continue
 		}
 
-		resp := s.handleRequest(ctx, &req)
-		encoder.Encode(resp)
+		if req.Method == "tools/call" {
+			calls.Add(1)
+			go func() {
+				defer calls.Done()
+				s.send(s.handleRequest(ctx, &req))
+			}()
+			continue
+		}
+		s.send(s.handleRequest(ctx, &req))
 	}
-	return scanner.Err()
+}
+
+// send writes one message to the client. Responses and notifications from
+// concurrent tool calls share the stream, so writes are serialized.
+func (s *MCPServer) send(msg interface{}) {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	s.out.Encode(msg)
+}
+
+// notify sends a JSON-RPC notification to the client.
+func (s *MCPServer) notify(method string, params interface{}) {
+	s.send(MCPNotification{JSONRPC: "2.0", Method: method, Params: params})
 }
 
 func (s *MCPServer) handleRequest(ctx context.Context, req *MCPRequest) *MCPResponse {
@@ -62,23 +155,56 @@ func (s *MCPServer) handleRequest(ctx context.Context, req *MCPRequest) *MCPResp
 
 	switch req.Method {
 	case "initialize":
+		s.initialized.Store(true)
 		resp.Result = map[string]interface{}{
 			"protocolVersion": "2024-11-05",
-			"capabilities":    map[string]interface{}{"tools": map[string]bool{}},
-			"serverInfo":      map[string]string{"name": "redis-fs-sandbox", "version": "1.0.0"},
+			"capabilities": map[string]interface{}{
+				"tools":     map[string]bool{},
+				"resources": map[string]bool{"listChanged": true},
+				"experimental": map[string]interface{}{
+					"sandboxAPI": map[string]interface{}{
+						"current":   APIVersionCurrent,
+						"supported": []string{APIVersionV1, APIVersionV2},
+					},
+					"sandboxConfig": s.config.summary(),
+				},
+			},
+			"serverInfo":   map[string]string{"name": "redis-fs-sandbox", "version": "1.0.0"},
+			"instructions": mcpInstructions,
 		}
 
 	case "tools/list":
 		resp.Result = map[string]interface{}{"tools": s.getTools()}
 
+	case "resources/list":
+		resp.Result = map[string]interface{}{"resources": s.listResources()}
+
+	case "resources/read":
+		var params struct {
+			URI string `json:"uri"`
+		}
+		json.Unmarshal(req.Params, &params)
+		resp.Result, resp.Error = s.readResource(params.URI)
+
 	case "tools/call":
 		var params struct {
 			Name      string                 `json:"name"`
 			Arguments map[string]interface{} `json:"arguments"`
+			Meta      struct {
+				ProgressToken interface{} `json:"progressToken"`
+			} `json:"_meta"`
 		}
 		json.Unmarshal(req.Params, &params)
+		if params.Meta.ProgressToken != nil {
+			ctx = withProgress(ctx, s.progressReporter(params.Meta.ProgressToken))
+		}
 		result, err := s.callTool(ctx, params.Name, params.Arguments)
-		if err != nil {
+		if isToolFailure(err) {
+			resp.Result = map[string]interface{}{
+				"content": []map[string]string{{"type": "text", "text": err.Error()}},
+				"isError": true,
+			}
+		} else if err != nil {
 			resp.Error = &MCPError{Code: -32000, Message: err.Error()}
 		} else {
 			resp.Result = map[string]interface{}{
@@ -93,58 +219,12 @@ func (s *MCPServer) handleRequest(ctx context.Context, req *MCPRequest) *MCPResp
 	return resp
 }
 
-func (s *MCPServer) getTools() []map[string]interface{} {
-	return []map[string]interface{}{
-		{
-			"name":        "sandbox_launch",
-			"description": "Launch a process in the sandbox",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"command":         map[string]string{"type": "string", "description": "Shell command"},
-					"cwd":             map[string]string{"type": "string", "description": "Working directory"},
-					"timeout_secs":    map[string]string{"type": "integer", "description": "Timeout"},
-					"wait":            map[string]string{"type": "boolean", "description": "Wait for completion"},
-					"keep_stdin_open": map[string]string{"type": "boolean", "description": "Keep stdin open"},
-				},
-				"required": []string{"command"},
-			},
-		},
-		{
-			"name":        "sandbox_read",
-			"description": "Read output from a sandbox process",
-			"inputSchema": map[string]interface{}{
-				"type":       "object",
-				"properties": map[string]interface{}{"id": map[string]string{"type": "string"}},
-				"required":   []string{"id"},
-			},
-		},
-		{
-			"name":        "sandbox_write",
-			"description": "Write to a sandbox process stdin",
-			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"id":    map[string]string{"type": "string"},
-					"input": map[string]string{"type": "string"},
-				},
-				"required": []string{"id", "input"},
-			},
-		},
-		{
-			"name":        "sandbox_kill",
-			"description": "Kill a sandbox process",
-			"inputSchema": map[string]interface{}{
-				"type":       "object",
-				"properties": map[string]interface{}{"id": map[string]string{"type": "string"}},
-				"required":   []string{"id"},
-			},
-		},
-		{
-			"name":        "sandbox_list",
-			"description": "List all sandbox processes",
-			"inputSchema": map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
-		},
-	}
+// isToolFailure reports whether err describes a rejected or failed launch
+// the model should see and correct, rather than a protocol error.
+func isToolFailure(err error) bool {
+	var verr *executor.ValidationError
+	var xerr *executor.ExecError
+	var uerr *executor.UnsupportedError
+	var merr *executor.MountUnavailableError
+	return errors.As(err, &verr) || errors.As(err, &xerr) || errors.As(err, &uerr) || errors.As(err, &merr)
 }
-
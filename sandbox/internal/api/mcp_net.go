@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// Network transports carry the same newline-delimited JSON-RPC as stdio.
+// Each connection gets its own MCPServer, so sessions answer requests
+// independently while launching into the one shared Manager.
+
+// mcpAuthTimeout bounds how long a TCP client may take to authenticate.
+const mcpAuthTimeout = 10 * time.Second
+
+// tokenMatches compares in constant time so the token cannot be guessed
+// byte by byte from response latency.
+func tokenMatches(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// ServeMCPTCP accepts MCP sessions on ln until ctx is done or ln is closed.
+// A client authenticates by sending {"token": "..."} as its first line;
+// after that the connection speaks JSON-RPC exactly like stdio.
+func ServeMCPTCP(ctx context.Context, ln net.Listener, manager *executor.Manager, config Config, token string) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	var sessions sync.WaitGroup
+	defer sessions.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			defer conn.Close()
+			serveMCPConn(ctx, conn, manager, config, token)
+		}()
+	}
+}
+
+func serveMCPConn(ctx context.Context, conn net.Conn, manager *executor.Manager, config Config, token string) {
+	r := bufio.NewReaderSize(conn, 64<<10)
+
+	conn.SetReadDeadline(time.Now().Add(mcpAuthTimeout))
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if json.Unmarshal(line, &auth) != nil || !tokenMatches(auth.Token, token) {
+		json.NewEncoder(conn).Encode(MCPResponse{JSONRPC: "2.0", Error: &MCPError{Code: -32001, Message: "unauthorized"}})
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if err := NewMCPServer(manager, config).Run(ctx, r, conn); err != nil {
+		log.Printf("mcp tcp session %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+var mcpUpgrader = websocket.Upgrader{
+	ReadBufferSize:  64 << 10,
+	WriteBufferSize: 64 << 10,
+	// Clients are programs authenticated by token, not browsers, so
+	// cross-origin requests carry no ambient credentials to abuse.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// MCPWebSocketHandler serves MCP sessions over WebSocket, one JSON-RPC
+// message per text frame. The token must be sent as a bearer token on the
+// upgrade request.
+func MCPWebSocketHandler(manager *executor.Manager, config Config, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !tokenMatches(got, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sandbox-mcp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := mcpUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return // Upgrade has already replied
+		}
+		defer conn.Close()
+		conn.SetReadLimit(maxMCPMessageBytes)
+
+		ws := &wsStream{conn: conn}
+		if err := NewMCPServer(manager, config).Run(r.Context(), ws, ws); err != nil {
+			log.Printf("mcp websocket session %s: %v", r.RemoteAddr, err)
+		}
+	})
+}
+
+// wsStream adapts a WebSocket connection to the line-oriented reader and
+// writer MCPServer.Run expects.
+type wsStream struct {
+	conn    *websocket.Conn
+	pending []byte
+}
+
+// Read returns one frame at a time, compacted onto a single line so that
+// pretty-printed messages survive line framing.
+func (s *wsStream) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		typ, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if typ != websocket.TextMessage && typ != websocket.BinaryMessage {
+			continue
+		}
+		var line bytes.Buffer
+		if json.Compact(&line, msg) != nil {
+			// Let the server skip it like any other malformed line.
+			line.Reset()
+			line.Write(bytes.ReplaceAll(msg, []byte("\n"), []byte(" ")))
+		}
+		line.WriteByte('\n')
+		s.pending = line.Bytes()
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write sends one frame per call; MCPServer serializes its writes and
+// json.Encoder emits each message in a single call.
+func (s *wsStream) Write(p []byte) (int, error) {
+	if err := s.conn.WriteMessage(websocket.TextMessage, bytes.TrimRight(p, "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
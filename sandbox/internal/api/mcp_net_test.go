@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+const testMCPToken = "s3cret"
+
+func newMCPWebSocketServer(t *testing.T) (*httptest.Server, *executor.Manager) {
+	t.Helper()
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	m := executor.NewManager(dir, opts)
+	ts := httptest.NewServer(MCPWebSocketHandler(m, NewConfig(dir, opts, executor.Features{}), testMCPToken))
+	t.Cleanup(ts.Close)
+	return ts, m
+}
+
+func dialMCP(t *testing.T, ts *httptest.Server, token string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	h := http.Header{}
+	if token != "" {
+		h.Set("Authorization", "Bearer "+token)
+	}
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), h)
+}
+
+// mcpCall sends one request and returns the response with the same id,
+// skipping any notifications in between.
+func mcpCall(conn *websocket.Conn, id int, method string, params interface{}) (MCPResponse, error) {
+	if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return MCPResponse{}, err
+	}
+	for {
+		var resp MCPResponse
+		if err := conn.ReadJSON(&resp); err != nil {
+			return resp, err
+		}
+		if n, ok := resp.ID.(float64); ok && int(n) == id {
+			return resp, nil
+		}
+	}
+}
+
+func TestMCPWebSocketSession(t *testing.T) {
+	ts, m := newMCPWebSocketServer(t)
+	conn, _, err := dialMCP(t, ts, testMCPToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if resp, err := mcpCall(conn, 1, "initialize", map[string]interface{}{}); err != nil || resp.Error != nil {
+		t.Fatalf("initialize: %+v, %v", resp.Error, err)
+	}
+
+	// Pretty-printed frames must survive the line framing Run uses.
+	pretty := "{\n  \"jsonrpc\": \"2.0\",\n  \"id\": 2,\n  \"method\": \"tools/list\"\n}"
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(pretty)); err != nil {
+		t.Fatal(err)
+	}
+	var list MCPResponse
+	if err := conn.ReadJSON(&list); err != nil || list.Error != nil {
+		t.Fatalf("tools/list: %+v, %v", list.Error, err)
+	}
+
+	resp, err := mcpCall(conn, 3, "tools/call", map[string]interface{}{
+		"name":      "sandbox_launch",
+		"arguments": map[string]interface{}{"command": "echo over-ws", "wait": true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(resp.Result)
+	if !strings.Contains(string(b), "over-ws") {
+		t.Fatalf("launch result = %s", b)
+	}
+	if n := len(m.List()); n != 1 {
+		t.Fatalf("manager has %d processes, want 1", n)
+	}
+}
+
+func TestMCPWebSocketRequiresToken(t *testing.T) {
+	ts, _ := newMCPWebSocketServer(t)
+	for _, token := range []string{"", "wrong"} {
+		_, resp, err := dialMCP(t, ts, token)
+		if err == nil {
+			t.Fatalf("token %q: dial succeeded", token)
+		}
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("token %q: response %v", token, resp)
+		}
+	}
+}
+
+func TestMCPWebSocketSessionsShareManager(t *testing.T) {
+	ts, m := newMCPWebSocketServer(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		conn, _, err := dialMCP(t, ts, testMCPToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		wg.Add(1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			// Every session uses id 1; responses must not cross sessions.
+			resp, err := mcpCall(conn, 1, "tools/call", map[string]interface{}{
+				"name":      "sandbox_launch",
+				"arguments": map[string]interface{}{"command": "sleep 0.1", "wait": true},
+			})
+			if err != nil || resp.Error != nil {
+				t.Errorf("launch: %+v, %v", resp.Error, err)
+			}
+		}(conn)
+	}
+	wg.Wait()
+	if n := len(m.List()); n != 3 {
+		t.Fatalf("manager has %d processes, want 3", n)
+	}
+}
+
+func TestMCPTCPSession(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	m := executor.NewManager(dir, opts)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ServeMCPTCP(ctx, ln, m, NewConfig(dir, opts, executor.Features{}), testMCPToken) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ServeMCPTCP: %v", err)
+		}
+	}()
+
+	session := func(token string) (net.Conn, *json.Decoder) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(conn).Encode(map[string]string{"token": token})
+		return conn, json.NewDecoder(bufio.NewReader(conn))
+	}
+
+	conn, dec := session("wrong")
+	var denied MCPResponse
+	if err := dec.Decode(&denied); err != nil || denied.Error == nil || denied.Error.Code != -32001 {
+		t.Fatalf("bad token: %+v, %v", denied.Error, err)
+	}
+	conn.Close()
+
+	conn, dec = session(testMCPToken)
+	defer conn.Close()
+	json.NewEncoder(conn).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "tools/list"})
+	var resp MCPResponse
+	if err := dec.Decode(&resp); err != nil || resp.Error != nil {
+		t.Fatalf("tools/list: %+v, %v", resp.Error, err)
+	}
+}
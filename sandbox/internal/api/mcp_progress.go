@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// Waited launches that carry a progressToken report progress at least this
+// often, or sooner once this much new output has accumulated.
+const (
+	defaultProgressInterval = 3 * time.Second
+	defaultProgressBytes    = 4 << 10
+
+	progressPoll      = 200 * time.Millisecond
+	progressTailBytes = 512
+	progressTailLines = 5
+)
+
+// progressFunc reports one progress step for the current tool call.
+type progressFunc func(progress float64, message string)
+
+type progressKey struct{}
+
+func withProgress(ctx context.Context, fn progressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func progressFrom(ctx context.Context) progressFunc {
+	fn, _ := ctx.Value(progressKey{}).(progressFunc)
+	return fn
+}
+
+// progressReporter emits notifications/progress for token. Progress is a
+// strictly increasing step count, as the protocol requires.
+func (s *MCPServer) progressReporter(token interface{}) progressFunc {
+	return func(progress float64, message string) {
+		s.notify("notifications/progress", map[string]interface{}{
+			"progressToken": token,
+			"progress":      progress,
+			"message":       message,
+		})
+	}
+}
+
+// awaitWithProgress waits for a launched process, reporting a tail of its
+// recent output periodically. It returns as soon as the process finishes.
+func (s *MCPServer) awaitWithProgress(ctx context.Context, launch *executor.LaunchResult, report progressFunc) (*executor.LaunchResult, error) {
+	done, err := s.manager.Done(launch.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(progressPoll)
+	defer ticker.Stop()
+
+	start := time.Now()
+	lastEmit := start
+	lastBytes := 0
+	step := 0
+	for {
+		select {
+		case <-done:
+			out, err := s.manager.Read(launch.ID)
+			if err != nil {
+				return nil, err
+			}
+			return &executor.LaunchResult{
+				ID:       launch.ID,
+				PID:      launch.PID,
+				State:    out.State,
+				ExitCode: out.ExitCode,
+				Stdout:   out.Stdout,
+				Stderr:   out.Stderr,
+				Combined: out.Combined,
+			}, nil
+		case <-ctx.Done():
+			return launch, nil
+		case <-ticker.C:
+			total, tail, err := s.manager.Tail(launch.ID, progressTailBytes)
+			if err != nil {
+				return nil, err
+			}
+			if total-lastBytes < s.progressBytes && time.Since(lastEmit) < s.progressInterval {
+				continue
+			}
+			step++
+			report(float64(step), progressMessage(time.Since(start), tail))
+			lastEmit = time.Now()
+			lastBytes = total
+		}
+	}
+}
+
+// progressMessage summarizes a running process as its last few lines of
+// output, or the elapsed time if it has printed nothing yet.
+func progressMessage(elapsed time.Duration, tail string) string {
+	tail = strings.TrimRight(tail, "\n")
+	if tail == "" {
+		return fmt.Sprintf("running for %s", elapsed.Round(time.Second))
+	}
+	lines := strings.Split(tail, "\n")
+	if len(lines) > progressTailLines {
+		lines = lines[len(lines)-progressTailLines:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+func TestMCPProgressNotificationsForWaitedLaunch(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	s := NewMCPServer(executor.NewManager(dir, opts), NewConfig(dir, opts, executor.Features{}))
+	s.progressInterval = 100 * time.Millisecond
+
+	call := func(id int, token, script string) string {
+		b, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"method":  "tools/call",
+			"params": map[string]interface{}{
+				"name":      "sandbox_launch",
+				"arguments": map[string]interface{}{"command": script, "wait": true},
+				"_meta":     map[string]interface{}{"progressToken": token},
+			},
+		})
+		return string(b) + "\n"
+	}
+	in := call(1, "slow", "for i in 1 2 3 4 5; do echo line$i; sleep 0.2; done") +
+		call(2, "other", "for i in 1 2 3; do echo other$i; sleep 0.2; done")
+
+	var out strings.Builder
+	if err := s.Run(context.Background(), strings.NewReader(in), &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	type message struct {
+		ID     *float64 `json:"id"`
+		Method string   `json:"method"`
+		Params struct {
+			ProgressToken string  `json:"progressToken"`
+			Progress      float64 `json:"progress"`
+			Message       string  `json:"message"`
+		} `json:"params"`
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"result"`
+	}
+
+	tokenFor := map[float64]string{1: "slow", 2: "other"}
+	finished := map[string]bool{}
+	last := map[string]float64{}
+	dec := json.NewDecoder(strings.NewReader(out.String()))
+	for dec.More() {
+		var m message
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		if m.ID != nil {
+			tok := tokenFor[*m.ID]
+			finished[tok] = true
+			var res executor.LaunchResult
+			if len(m.Result.Content) == 0 || json.Unmarshal([]byte(m.Result.Content[0].Text), &res) != nil {
+				t.Fatalf("id %v: unexpected result %+v", *m.ID, m.Result)
+			}
+			if res.State != executor.StateExited || !strings.Contains(res.Stdout, "3") {
+				t.Errorf("id %v: result %+v", *m.ID, res)
+			}
+			continue
+		}
+		if m.Method != "notifications/progress" {
+			t.Fatalf("unexpected notification %q", m.Method)
+		}
+		tok := m.Params.ProgressToken
+		if finished[tok] {
+			t.Errorf("progress for %q after its response", tok)
+		}
+		if m.Params.Progress <= last[tok] {
+			t.Errorf("progress for %q did not increase: %v after %v", tok, m.Params.Progress, last[tok])
+		}
+		last[tok] = m.Params.Progress
+	}
+	for _, tok := range []string{"slow", "other"} {
+		if !finished[tok] {
+			t.Errorf("no response for %q", tok)
+		}
+		if last[tok] == 0 {
+			t.Errorf("no progress notifications for %q", tok)
+		}
+	}
+}
+
+func TestProgressMessageKeepsRecentLines(t *testing.T) {
+	if got := progressMessage(3*time.Second, ""); got != "running for 3s" {
+		t.Errorf("empty tail = %q", got)
+	}
+	got := progressMessage(0, "a\nb\nc\nd\ne\nf\ng\n")
+	if got != "c\nd\ne\nf\ng" {
+		t.Errorf("tail = %q", got)
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Processes are exposed as MCP resources so clients can browse them
+// without a tool call. The manager's change counter drives
+// notifications/resources/list_changed, the same signal that wakes
+// long-polling GET /processes requests.
+
+const processResourcePrefix = "sandbox://processes/"
+
+func (s *MCPServer) listResources() []map[string]interface{} {
+	procs := s.manager.List()
+	sort.Slice(procs, func(i, j int) bool { return procs[i].StartedAt.Before(procs[j].StartedAt) })
+
+	resources := make([]map[string]interface{}, 0, len(procs))
+	for _, p := range procs {
+		resources = append(resources, map[string]interface{}{
+			"uri":         processResourcePrefix + p.ID,
+			"name":        p.ID + ": " + p.Command,
+			"description": "Process " + string(p.State),
+			"mimeType":    "application/json",
+		})
+	}
+	return resources
+}
+
+func (s *MCPServer) readResource(uri string) (interface{}, *MCPError) {
+	id := strings.TrimPrefix(uri, processResourcePrefix)
+	if id == uri || id == "" {
+		return nil, &MCPError{Code: -32002, Message: "resource not found: " + uri}
+	}
+	result, err := s.manager.Read(id)
+	if err != nil {
+		return nil, &MCPError{Code: -32002, Message: "resource not found: " + uri}
+	}
+	text, _ := json.MarshalIndent(result, "", "  ")
+	return map[string]interface{}{
+		"contents": []map[string]string{{"uri": uri, "mimeType": "application/json", "text": string(text)}},
+	}, nil
+}
+
+// watchProcesses sends resources/list_changed whenever the process list
+// version moves, until ctx is done. Bursts of transitions that land while
+// a notification is being written are coalesced into the next one.
+func (s *MCPServer) watchProcesses(ctx context.Context) {
+	_, changed := s.manager.Changed()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+		_, changed = s.manager.Changed()
+		if s.initialized.Load() {
+			s.notify("notifications/resources/list_changed", nil)
+		}
+	}
+}
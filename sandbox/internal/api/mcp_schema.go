@@ -0,0 +1,256 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// Tool metadata for tools/list. Models call tools more reliably when the
+// schema carries defaults, allowed values, and worked examples, so each
+// argument is described as real JSON Schema built from the server's policy
+// rather than a bare description.
+
+// mcpInstructions is returned from initialize to describe how the tools
+// fit together.
+const mcpInstructions = `Run shell commands in a sandboxed workspace.
+
+For a short command, call sandbox_launch with wait: true; the result carries its exit code and output.
+
+For a long-running command, call sandbox_launch without wait and keep the returned id. Poll sandbox_read with that id until its state is no longer "running"; send it input with sandbox_write if it was launched with keep_stdin_open; stop it with sandbox_kill.
+
+Use sandbox_validate to check a command and the options the server would apply without running it, and sandbox_list to see every process.`
+
+// mcpTool is one entry in the tools/list result.
+type mcpTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema *jsonSchema `json:"inputSchema"`
+}
+
+// jsonSchema is the subset of JSON Schema the tool arguments use.
+type jsonSchema struct {
+	Type        string                 `json:"type"`
+	Description string                 `json:"description,omitempty"`
+	Properties  map[string]*jsonSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	// Default is emitted whenever it is set, including false and 0.
+	Default   interface{} `json:"default,omitempty"`
+	Enum      []string    `json:"enum,omitempty"`
+	Minimum   *int        `json:"minimum,omitempty"`
+	Maximum   *int        `json:"maximum,omitempty"`
+	MinLength *int        `json:"minLength,omitempty"`
+	MaxLength *int        `json:"maxLength,omitempty"`
+
+	AdditionalProperties *bool                    `json:"additionalProperties,omitempty"`
+	Examples             []map[string]interface{} `json:"examples,omitempty"`
+}
+
+func intPtr(n int) *int { return &n }
+
+// positive returns &n, or nil when n leaves the bound open.
+func positive(n int) *int {
+	if n <= 0 {
+		return nil
+	}
+	return &n
+}
+
+// object is the schema for a tool's arguments.
+func object(props map[string]*jsonSchema, required []string, examples ...map[string]interface{}) *jsonSchema {
+	closed := false
+	return &jsonSchema{
+		Type:                 "object",
+		Properties:           props,
+		Required:             required,
+		AdditionalProperties: &closed,
+		Examples:             examples,
+	}
+}
+
+// processID is the id argument shared by the per-process tools.
+var processID = &jsonSchema{Type: "string", Description: "Process ID returned by sandbox_launch"}
+
+// gracePeriod is a SIGTERM-to-SIGKILL grace period argument.
+func gracePeriod(description string) *jsonSchema {
+	return &jsonSchema{Type: "integer", Description: description, Default: 0, Minimum: intPtr(0)}
+}
+
+// launchSchema describes the sandbox_launch and sandbox_validate arguments
+// within the limits this server enforces.
+func (s *MCPServer) launchSchema() *jsonSchema {
+	c := s.config
+	profile := &jsonSchema{Type: "string", Description: "Server-defined security profile restricting writes and syscalls"}
+	for _, p := range c.SecurityProfiles {
+		profile.Enum = append(profile.Enum, p.Name)
+		if p.Name == executor.DefaultSecurityProfile {
+			profile.Default = p.Name
+		}
+	}
+	files := &jsonSchema{
+		Type:        "integer",
+		Description: "Open file descriptor limit",
+		Minimum:     intPtr(1),
+		Maximum:     positive(c.OpenFiles.Max),
+	}
+	if c.OpenFiles.Default > 0 {
+		files.Default = c.OpenFiles.Default
+	}
+
+	return object(map[string]*jsonSchema{
+		"command": {
+			Type:        "string",
+			Description: "Shell command, run with sh -c",
+			MinLength:   intPtr(1),
+			MaxLength:   positive(c.MaxCommandBytes),
+		},
+		"cwd": {Type: "string", Description: "Working directory, relative to the workspace, or in a session to the session's directory; defaults to the session's directory or the workspace itself. May use " + templateHelp},
+		"session_id": {
+			Type:        "string",
+			Description: "Session the launch belongs to; launches in a session start in its directory",
+			MaxLength:   intPtr(executor.MaxSessionIDLength),
+		},
+		"env": {Type: "object", Description: "Environment variables to set, name to string value. Values may use " + templateHelp},
+		"timeout_secs": {
+			Type:        "integer",
+			Description: "Seconds before the process is killed; 0 for no timeout",
+			Default:     c.DefaultTimeoutSecs,
+			Minimum:     intPtr(0),
+			Maximum:     positive(c.MaxTimeoutSecs),
+		},
+		"wait": {
+			Type:        "boolean",
+			Description: "Wait for the process to finish and return its output. Use it for short commands; read long-running ones with sandbox_read instead",
+			Default:     false,
+		},
+		"keep_stdin_open": {Type: "boolean", Description: "Keep stdin open for sandbox_write", Default: false},
+		"nice": {
+			Type:        "integer",
+			Description: "Scheduling niceness; higher runs at lower priority",
+			Default:     c.Priority.DefaultNice,
+			Minimum:     intPtr(c.Priority.MinNice),
+			Maximum:     intPtr(c.Priority.MaxNice),
+		},
+		"ionice_class": {
+			Type:        "string",
+			Description: "I/O scheduling class",
+			Enum:        c.Priority.IONiceClasses,
+		},
+		"max_open_files":   files,
+		"security_profile": profile,
+		"trace_id": {
+			Type:        "string",
+			Description: "Caller's trace or correlation ID, echoed in results and server logs",
+			MaxLength:   intPtr(executor.MaxTraceIDLength),
+		},
+		"merge_output": {
+			Type:        "boolean",
+			Description: "Capture stdout and stderr as one combined stream in the order they were written",
+			Default:     false,
+		},
+		"grace_period_secs": gracePeriod("On timeout, seconds the process may handle SIGTERM before it is SIGKILLed; 0 kills it at once"),
+	}, []string{"command"},
+		map[string]interface{}{"command": "go test ./...", "wait": true, "timeout_secs": 300},
+		map[string]interface{}{"command": "npm run dev", "cwd": "web"},
+		map[string]interface{}{"command": "python3 -i", "keep_stdin_open": true, "merge_output": true},
+		map[string]interface{}{"command": "make", "session_id": "agent-7", "cwd": "builds/{{.SessionID}}", "env": map[string]string{"LOG": "/tmp/{{.ProcessID}}.log"}},
+	)
+}
+
+// templateHelp lists the template variables for argument descriptions.
+var templateHelp = func() string {
+	var parts []string
+	for _, v := range executor.TemplateVariables {
+		parts = append(parts, "{{."+v.Name+"}} ("+v.Description+")")
+	}
+	return strings.Join(parts, ", ")
+}()
+
+func (s *MCPServer) getTools() []mcpTool {
+	launch := s.launchSchema()
+	byID := func() *jsonSchema {
+		return object(map[string]*jsonSchema{"id": processID}, []string{"id"}, map[string]interface{}{"id": "3f9a2c1e"})
+	}
+	return []mcpTool{
+		{
+			Name:        "sandbox_launch",
+			Description: "Launch a process in the sandbox. With wait, returns its exit code and output; without, returns an id to read, write to, and kill. The cwd and env values may use the template variables " + templateHelp,
+			InputSchema: launch,
+		},
+		{
+			Name:        "sandbox_validate",
+			Description: "Check a launch without running it: returns the options the server would apply, the argv, and warnings such as shell syntax errors",
+			InputSchema: launch,
+		},
+		{
+			Name:        "sandbox_read",
+			Description: fmt.Sprintf("Read the state and output of a sandbox process: the last %d lines of each stream unless tail_lines or full says otherwise", mcpReadTailLines),
+			InputSchema: object(map[string]*jsonSchema{
+				"id":         processID,
+				"transcript": {Type: "boolean", Description: "Return a text transcript interleaving stdin, output and state changes", Default: false},
+				"verbose":    {Type: "boolean", Description: "Include how the process was executed: argv, resolved cwd, interpreter, env names and limits", Default: false},
+				"tail_lines": {
+					Type:        "integer",
+					Description: "Return only the last this many lines of each stream, with the total line counts",
+					Default:     mcpReadTailLines,
+					Minimum:     intPtr(1),
+				},
+				"full": {Type: "boolean", Description: "Return all retained output instead of the last tail_lines lines", Default: false},
+			}, []string{"id"},
+				map[string]interface{}{"id": "3f9a2c1e"},
+				map[string]interface{}{"id": "3f9a2c1e", "full": true},
+				map[string]interface{}{"id": "3f9a2c1e", "transcript": true},
+			),
+		},
+		{
+			Name:        "sandbox_write",
+			Description: "Write to the stdin of a process launched with keep_stdin_open",
+			InputSchema: object(map[string]*jsonSchema{
+				"id":    processID,
+				"input": {Type: "string", Description: "Text to write"},
+				"line":  {Type: "boolean", Description: "Append a newline if the input lacks one", Default: false},
+				"tag":   {Type: "string", Description: "Label recorded in the input history"},
+			}, []string{"id", "input"},
+				map[string]interface{}{"id": "3f9a2c1e", "input": "print(2 + 2)", "line": true},
+			),
+		},
+		{
+			Name:        "sandbox_kill",
+			Description: "Kill a sandbox process; returns the state it ended in (killed, or exited if it finished first)",
+			InputSchema: object(map[string]*jsonSchema{
+				"id":                processID,
+				"grace_period_secs": gracePeriod("Seconds the process may handle SIGTERM, to flush and checkpoint, before it is SIGKILLed; 0 kills it at once"),
+			}, []string{"id"},
+				map[string]interface{}{"id": "3f9a2c1e"},
+				map[string]interface{}{"id": "3f9a2c1e", "grace_period_secs": 10},
+			),
+		},
+		{
+			Name:        "sandbox_pause",
+			Description: "Pause a running sandbox process (SIGSTOP) until resumed; its timeout stops counting and stdin writes are refused",
+			InputSchema: byID(),
+		},
+		{
+			Name:        "sandbox_resume",
+			Description: "Resume a paused sandbox process (SIGCONT)",
+			InputSchema: byID(),
+		},
+		{
+			Name:        "sandbox_list",
+			Description: "List all sandbox processes",
+			InputSchema: object(map[string]*jsonSchema{}, nil, map[string]interface{}{}),
+		},
+		{
+			Name:        "sandbox_tail",
+			Description: "Tail a file in the workspace; with follow, appended lines keep arriving as process output until killed",
+			InputSchema: object(map[string]*jsonSchema{
+				"path":   {Type: "string", Description: "File path, relative to the workspace"},
+				"lines":  {Type: "integer", Description: "Trailing lines to start with", Default: executor.DefaultTailLines, Minimum: intPtr(1)},
+				"follow": {Type: "boolean", Description: "Keep following the file as it grows", Default: false},
+			}, []string{"path"},
+				map[string]interface{}{"path": "logs/server.log", "lines": 50, "follow": true},
+			),
+		},
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata golden files")
+
+// TestMCPToolsSnapshot pins the tools/list metadata for the default policy.
+// After an intended change, regenerate it with go test -run Snapshot -update.
+func TestMCPToolsSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	s := NewMCPServer(executor.NewManager(dir, opts), NewConfig(dir, opts, executor.Features{}))
+
+	got, err := json.MarshalIndent(s.getTools(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	golden := filepath.Join("testdata", "mcp_tools.golden.json")
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("tools/list changed; if intended, run go test -run Snapshot -update\n%s", got)
+	}
+}
+
+func TestMCPSchemaFollowsPolicy(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	opts.MaxCommandBytes = 4096
+	opts.SecurityProfiles = []executor.SecurityProfile{{Name: "default"}, {Name: "readonly", RestrictWrites: true}}
+	config := NewConfig(dir, opts, executor.Features{})
+	config.MaxTimeoutSecs = 600
+	s := NewMCPServer(executor.NewManager(dir, opts), config)
+
+	launch := s.launchSchema()
+	if max := launch.Properties["command"].MaxLength; max == nil || *max != 4096 {
+		t.Fatalf("command maxLength: %v", max)
+	}
+	if max := launch.Properties["timeout_secs"].Maximum; max == nil || *max != 600 {
+		t.Fatalf("timeout_secs maximum: %v", max)
+	}
+	profile := launch.Properties["security_profile"]
+	if strings.Join(profile.Enum, ",") != "default,readonly" || profile.Default != "default" {
+		t.Fatalf("security_profile: %+v", profile)
+	}
+
+	// Every example must satisfy its own schema's required arguments and
+	// name only declared ones.
+	for _, tool := range s.getTools() {
+		if len(tool.InputSchema.Examples) == 0 {
+			t.Errorf("%s has no examples", tool.Name)
+		}
+		for _, ex := range tool.InputSchema.Examples {
+			for _, name := range tool.InputSchema.Required {
+				if _, ok := ex[name]; !ok {
+					t.Errorf("%s example %v lacks %s", tool.Name, ex, name)
+				}
+			}
+			for name := range ex {
+				if _, ok := tool.InputSchema.Properties[name]; !ok {
+					t.Errorf("%s example %v uses undeclared %s", tool.Name, ex, name)
+				}
+			}
+		}
+	}
+}
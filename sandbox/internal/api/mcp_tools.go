@@ -13,14 +13,22 @@ func (s *MCPServer) callTool(ctx context.Context, name string, args map[string]i
 	switch name {
 	case "sandbox_launch":
 		return s.toolLaunch(ctx, args)
+	case "sandbox_validate":
+		return s.toolValidate(ctx, args)
 	case "sandbox_read":
 		return s.toolRead(args)
 	case "sandbox_write":
 		return s.toolWrite(args)
 	case "sandbox_kill":
 		return s.toolKill(args)
+	case "sandbox_pause":
+		return s.toolPause(args)
+	case "sandbox_resume":
+		return s.toolResume(args)
 	case "sandbox_list":
 		return s.toolList()
+	case "sandbox_tail":
+		return s.toolTail(args)
 	default:
 		return "", fmt.Errorf("unknown tool: %s", name)
 	}
@@ -32,6 +40,33 @@ func (s *MCPServer) toolLaunch(ctx context.Context, args map[string]interface{})
 		return "", fmt.Errorf("command is required")
 	}
 
+	opts := launchOptionsFromArgs(command, args)
+
+	// With a progress token, launch detached and wait here so output can
+	// be reported while the process runs.
+	report := progressFrom(ctx)
+	progressive := opts.Wait && report != nil
+	if progressive {
+		opts.Wait = false
+	}
+
+	result, err := s.manager.Launch(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+	if progressive {
+		if result, err = s.awaitWithProgress(ctx, result, report); err != nil {
+			return "", err
+		}
+	}
+
+	out, _ := json.MarshalIndent(result, "", "  ")
+	return string(out), nil
+}
+
+// launchOptionsFromArgs reads the sandbox_launch arguments, which
+// sandbox_validate shares.
+func launchOptionsFromArgs(command string, args map[string]interface{}) executor.LaunchOptions {
 	opts := executor.LaunchOptions{Command: command}
 
 	if cwd, ok := args["cwd"].(string); ok {
@@ -46,26 +81,96 @@ func (s *MCPServer) toolLaunch(ctx context.Context, args map[string]interface{})
 	if keepStdin, ok := args["keep_stdin_open"].(bool); ok {
 		opts.KeepStdinOpen = keepStdin
 	}
+	if nice, ok := args["nice"].(float64); ok {
+		n := int(nice)
+		opts.Nice = &n
+	}
+	if class, ok := args["ionice_class"].(string); ok {
+		opts.IONiceClass = class
+	}
+	if files, ok := args["max_open_files"].(float64); ok {
+		n := int(files)
+		opts.MaxOpenFiles = &n
+	}
+	if profile, ok := args["security_profile"].(string); ok {
+		opts.SecurityProfile = profile
+	}
+	if traceID, ok := args["trace_id"].(string); ok {
+		opts.TraceID = traceID
+	}
+	if merge, ok := args["merge_output"].(bool); ok {
+		opts.MergeOutput = merge
+	}
+	if grace, ok := args["grace_period_secs"].(float64); ok {
+		opts.GracePeriod = time.Duration(grace) * time.Second
+	}
+	if session, ok := args["session_id"].(string); ok {
+		opts.SessionID = session
+	}
+	if env, ok := args["env"].(map[string]interface{}); ok {
+		opts.Env = make(map[string]string, len(env))
+		for name, v := range env {
+			if s, ok := v.(string); ok {
+				opts.Env[name] = s
+			} else {
+				opts.Env[name] = fmt.Sprint(v)
+			}
+		}
+	}
 
-	result, err := s.manager.Launch(ctx, opts)
+	return opts
+}
+
+func (s *MCPServer) toolValidate(ctx context.Context, args map[string]interface{}) (string, error) {
+	command, _ := args["command"].(string)
+	if command == "" {
+		return "", fmt.Errorf("command is required")
+	}
+	result, err := s.manager.Validate(ctx, launchOptionsFromArgs(command, args))
 	if err != nil {
 		return "", err
 	}
-
-	out, _ := json.MarshalIndent(result, "", "  ")
+	out, _ := json.MarshalIndent(newValidateResponse(result), "", "  ")
 	return string(out), nil
 }
 
+// mcpReadTailLines is how many lines of each stream sandbox_read returns
+// unless asked for more, or for everything with full.
+const mcpReadTailLines = 200
+
 func (s *MCPServer) toolRead(args map[string]interface{}) (string, error) {
 	id, _ := args["id"].(string)
 	if id == "" {
 		return "", fmt.Errorf("id is required")
 	}
 
-	result, err := s.manager.Read(id)
+	if transcript, _ := args["transcript"].(bool); transcript {
+		events, err := s.manager.Transcript(id)
+		if err != nil {
+			return "", err
+		}
+		return executor.RenderTranscript(events), nil
+	}
+
+	// Agents rarely need more than the end of the output, and every byte
+	// returned costs tokens.
+	var result *executor.ReadResult
+	var err error
+	if full, _ := args["full"].(bool); full {
+		result, err = s.manager.Read(id)
+	} else {
+		tail := mcpReadTailLines
+		if n, ok := args["tail_lines"].(float64); ok {
+			tail = int(n)
+		}
+		result, err = s.manager.ReadTail(id, tail)
+	}
 	if err != nil {
 		return "", err
 	}
+	if verbose, _ := args["verbose"].(bool); !verbose {
+		result.Effective = nil
+	}
 
 	out, _ := json.MarshalIndent(result, "", "  ")
 	return string(out), nil
@@ -78,7 +183,14 @@ func (s *MCPServer) toolWrite(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("id is required")
 	}
 
-	if err := s.manager.Write(id, input); err != nil {
+	var opts executor.WriteOptions
+	if line, ok := args["line"].(bool); ok {
+		opts.Line = line
+	}
+	if tag, ok := args["tag"].(string); ok {
+		opts.Tag = tag
+	}
+	if _, err := s.manager.WriteInput(id, input, opts); err != nil {
 		return "", err
 	}
 	return "OK", nil
@@ -90,15 +202,65 @@ func (s *MCPServer) toolKill(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("id is required")
 	}
 
-	if err := s.manager.Kill(id); err != nil {
+	var grace time.Duration
+	if secs, ok := args["grace_period_secs"].(float64); ok {
+		grace = time.Duration(secs) * time.Second
+	}
+	state, err := s.manager.Terminate(id, grace)
+	if err != nil {
+		return "", err
+	}
+	return string(state), nil
+}
+
+func (s *MCPServer) toolPause(args map[string]interface{}) (string, error) {
+	id, _ := args["id"].(string)
+	if id == "" {
+		return "", fmt.Errorf("id is required")
+	}
+
+	if err := s.manager.Pause(id); err != nil {
+		return "", err
+	}
+	return "OK", nil
+}
+
+func (s *MCPServer) toolResume(args map[string]interface{}) (string, error) {
+	id, _ := args["id"].(string)
+	if id == "" {
+		return "", fmt.Errorf("id is required")
+	}
+
+	if err := s.manager.Resume(id); err != nil {
 		return "", err
 	}
 	return "OK", nil
 }
 
+func (s *MCPServer) toolTail(args map[string]interface{}) (string, error) {
+	path, _ := args["path"].(string)
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	opts := executor.TailOptions{Path: path}
+	if lines, ok := args["lines"].(float64); ok {
+		opts.Lines = int(lines)
+	}
+	if follow, ok := args["follow"].(bool); ok {
+		opts.Follow = follow
+	}
+	result, err := s.manager.TailFile(opts)
+	if err != nil {
+		return "", err
+	}
+
+	out, _ := json.MarshalIndent(result, "", "  ")
+	return string(out), nil
+}
+
 func (s *MCPServer) toolList() (string, error) {
 	procs := s.manager.List()
 	out, _ := json.MarshalIndent(procs, "", "  ")
 	return string(out), nil
 }
-
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// promWriter writes the Prometheus text exposition format (version
+// 0.0.4). It covers the gauges, counters and histograms this server
+// exports and nothing more.
+type promWriter struct {
+	w *bufio.Writer
+}
+
+func newPromWriter(w io.Writer) *promWriter {
+	return &promWriter{w: bufio.NewWriter(w)}
+}
+
+// family starts a metric family with its HELP and TYPE lines.
+func (p *promWriter) family(name, typ, help string) {
+	p.w.WriteString("# HELP " + name + " " + strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help) + "\n")
+	p.w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample writes one value; labels alternate names and values.
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	p.w.WriteString(name)
+	if len(labels) > 0 {
+		p.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.w.WriteByte(',')
+			}
+			p.w.WriteString(labels[i] + `="` + escapeLabelValue(labels[i+1]) + `"`)
+		}
+		p.w.WriteByte('}')
+	}
+	p.w.WriteString(" " + formatPromValue(value) + "\n")
+}
+
+// histogram writes the bucket, sum and count series of one histogram.
+func (p *promWriter) histogram(name string, bounds []float64, h executor.Histogram, labels ...string) {
+	withLE := func(le string) []string {
+		return append(append([]string(nil), labels...), "le", le)
+	}
+	for i, le := range bounds {
+		p.sample(name+"_bucket", float64(h.Buckets[i]), withLE(formatPromValue(le))...)
+	}
+	p.sample(name+"_bucket", float64(h.Count), withLE("+Inf")...)
+	p.sample(name+"_sum", h.Sum, labels...)
+	p.sample(name+"_count", float64(h.Count), labels...)
+}
+
+func (p *promWriter) flush() error { return p.w.Flush() }
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatPromValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// workspaceBytes totals the regular files under dir. Symlinks are not
+// followed, so an attached redis-fs mount is not counted.
+func workspaceBytes(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// writeMetrics renders a snapshot; it runs without any Manager lock held.
+func writeMetrics(w io.Writer, snap executor.MetricsSnapshot, workspace int64) error {
+	p := newPromWriter(w)
+
+	p.family("sandbox_processes", "gauge", "Processes currently known to the server, by state.")
+	for _, s := range executor.ProcessStates {
+		p.sample("sandbox_processes", float64(snap.States[s]), "state", string(s))
+	}
+
+	p.family("sandbox_launches_total", "counter", "Processes launched since the server started.")
+	p.sample("sandbox_launches_total", float64(snap.Counters.Launches))
+
+	p.family("sandbox_exits_total", "counter", "Processes that have ended, by how they ended.")
+	for _, c := range executor.ExitClasses {
+		p.sample("sandbox_exits_total", float64(snap.Counters.Exits[c]), "class", string(c))
+	}
+
+	p.family("sandbox_output_bytes_total", "counter", "Bytes of stdout and stderr captured, including output later discarded by the retention cap.")
+	p.sample("sandbox_output_bytes_total", float64(snap.Counters.OutputBytes))
+
+	p.family("sandbox_workspace_bytes", "gauge", "Total size of regular files in the workspace.")
+	p.sample("sandbox_workspace_bytes", float64(workspace))
+
+	p.family("sandbox_process_duration_seconds", "histogram", "Time from launch to exit of finished processes, by how they ended.")
+	empty := executor.Histogram{Buckets: make([]int64, len(executor.DurationBuckets))}
+	for _, c := range executor.ExitClasses {
+		h, ok := snap.Durations[c]
+		if !ok {
+			h = empty
+		}
+		p.histogram("sandbox_process_duration_seconds", executor.DurationBuckets, h, "class", string(c))
+	}
+	return p.flush()
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	snap := s.manager.Metrics()
+	size := workspaceBytes(s.config.Workspace)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w, snap, size)
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+var (
+	promSampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(?:\{(.*)\})? (\S+)$`)
+	promLabel      = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\]|\\.)*)"$`)
+)
+
+// parseExposition parses the text format strictly enough to catch
+// malformed lines, undeclared families and bad labels.
+func parseExposition(t *testing.T, r io.Reader) []promSample {
+	t.Helper()
+	types := map[string]string{}
+	var samples []promSample
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "# TYPE ") {
+			f := strings.Fields(line)
+			types[f[2]] = f[3]
+			continue
+		}
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		m := promSampleLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("malformed line %q", line)
+		}
+		s := promSample{name: m[1], labels: map[string]string{}}
+		if m[2] != "" {
+			for _, pair := range strings.Split(m[2], ",") {
+				lm := promLabel.FindStringSubmatch(pair)
+				if lm == nil {
+					t.Fatalf("malformed label %q in %q", pair, line)
+				}
+				if _, dup := s.labels[lm[1]]; dup {
+					t.Fatalf("duplicate label %q in %q", lm[1], line)
+				}
+				s.labels[lm[1]] = lm[2]
+			}
+		}
+		v, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			t.Fatalf("bad value in %q", line)
+		}
+		s.value = v
+		family := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(s.name, "_bucket"), "_sum"), "_count")
+		if types[s.name] == "" && types[family] != "histogram" {
+			t.Fatalf("sample %q has no TYPE", s.name)
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+func findSample(samples []promSample, name string, labels ...string) (float64, bool) {
+next:
+	for _, s := range samples {
+		if s.name != name || len(s.labels) != len(labels)/2 {
+			continue
+		}
+		for i := 0; i < len(labels); i += 2 {
+			if s.labels[labels[i]] != labels[i+1] {
+				continue next
+			}
+		}
+		return s.value, true
+	}
+	return 0, false
+}
+
+func TestMetricsExposition(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data"), make([]byte, 1000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := executor.DefaultOptions()
+	ts := httptest.NewServer(NewServer(executor.NewManager(dir, opts), NewConfig(dir, opts, executor.Features{})).Handler())
+	defer ts.Close()
+
+	launch := func(body string) executor.LaunchResult {
+		resp, err := http.Post(ts.URL+"/v1/processes", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var r executor.LaunchResult
+		json.NewDecoder(resp.Body).Decode(&r)
+		return r
+	}
+	launch(`{"command":"echo hello","wait":true}`)
+	launch(`{"command":"exit 3","wait":true}`)
+	launch(`{"command":"sleep 5","timeout_secs":1,"wait":true}`)
+	victim := launch(`{"command":"sleep 5"}`)
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/v1/processes/"+victim.ID, nil)
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	} else {
+		resp.Body.Close()
+	}
+
+	var samples []promSample
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, err := http.Get(ts.URL + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Fatalf("content type %q", ct)
+		}
+		samples = parseExposition(t, resp.Body)
+		resp.Body.Close()
+		if n, _ := findSample(samples, "sandbox_exits_total", "class", "killed"); n == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	want := []struct {
+		name   string
+		labels []string
+		value  float64
+	}{
+		{"sandbox_launches_total", nil, 4},
+		{"sandbox_exits_total", []string{"class", "ok"}, 1},
+		{"sandbox_exits_total", []string{"class", "nonzero"}, 1},
+		{"sandbox_exits_total", []string{"class", "timeout"}, 1},
+		{"sandbox_exits_total", []string{"class", "killed"}, 1},
+		{"sandbox_exits_total", []string{"class", "lost"}, 0},
+		{"sandbox_processes", []string{"state", "running"}, 0},
+		{"sandbox_processes", []string{"state", "timed_out"}, 1},
+		{"sandbox_process_duration_seconds_count", []string{"class", "timeout"}, 1},
+		{"sandbox_process_duration_seconds_bucket", []string{"class", "timeout", "le", "0.5"}, 0},
+		{"sandbox_process_duration_seconds_bucket", []string{"class", "timeout", "le", "+Inf"}, 1},
+		{"sandbox_output_bytes_total", nil, float64(len("hello\n"))},
+		{"sandbox_workspace_bytes", nil, 1000},
+	}
+	for _, w := range want {
+		got, ok := findSample(samples, w.name, w.labels...)
+		if !ok || got != w.value {
+			t.Errorf("%s%v = %v (present %v), want %v", w.name, w.labels, got, ok, w.value)
+		}
+	}
+
+	// Buckets are cumulative and end at the count.
+	for _, class := range executor.ExitClasses {
+		prev := -1.0
+		for _, le := range executor.DurationBuckets {
+			n, ok := findSample(samples, "sandbox_process_duration_seconds_bucket", "class", string(class), "le", formatPromValue(le))
+			if !ok || n < prev {
+				t.Fatalf("class %s bucket le=%v = %v after %v", class, le, n, prev)
+			}
+			prev = n
+		}
+		inf, _ := findSample(samples, "sandbox_process_duration_seconds_bucket", "class", string(class), "le", "+Inf")
+		count, _ := findSample(samples, "sandbox_process_duration_seconds_count", "class", string(class))
+		if inf < prev || inf != count {
+			t.Fatalf("class %s: +Inf %v, count %v, last bucket %v", class, inf, count, prev)
+		}
+	}
+}
+
+func TestPromLabelEscaping(t *testing.T) {
+	var b strings.Builder
+	p := newPromWriter(&b)
+	p.sample("x", 1.5, "path", "a\"b\\c\nd")
+	p.flush()
+	if got, want := b.String(), `x{path="a\"b\\c\nd"} 1.5`+"\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
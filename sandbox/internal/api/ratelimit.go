@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimit is a token bucket: PerSecond tokens are added each second up
+// to Burst. A zero PerSecond disables the limit.
+type RateLimit struct {
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+}
+
+// RateLimits holds separate budgets for requests that start or change
+// processes and for requests that only read state.
+type RateLimits struct {
+	Launch RateLimit `json:"launch"`
+	Read   RateLimit `json:"read"`
+}
+
+// DefaultRateLimits allows short launch bursts while stopping retry
+// loops, and leaves plenty of headroom for polling reads.
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Launch: RateLimit{PerSecond: 2, Burst: 10},
+		Read:   RateLimit{PerSecond: 50, Burst: 100},
+	}
+}
+
+const (
+	rateClassLaunch = "launch"
+	rateClassRead   = "read"
+
+	// Buckets idle this long are full again and can be forgotten.
+	bucketIdleTTL      = 5 * time.Minute
+	bucketEvictionTick = time.Minute
+)
+
+// RateUsage reports limiter activity for /stats.
+type RateUsage struct {
+	Limits  RateLimits       `json:"limits"`
+	Clients int              `json:"clients"`
+	Limited map[string]int64 `json:"limited"`
+}
+
+type bucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keys token buckets by client and request class.
+type rateLimiter struct {
+	limits  RateLimits
+	buckets sync.Map // "<class>|<client>" -> *bucket
+	now     func() time.Time
+
+	lastEvict     atomic.Int64
+	limitedLaunch atomic.Int64
+	limitedRead   atomic.Int64
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	l := &rateLimiter{limits: limits, now: time.Now}
+	l.lastEvict.Store(l.now().UnixNano())
+	return l
+}
+
+func (l *rateLimiter) limitFor(class string) RateLimit {
+	if class == rateClassLaunch {
+		return l.limits.Launch
+	}
+	return l.limits.Read
+}
+
+// allow takes one token for client in class, or reports how long until
+// one is available.
+func (l *rateLimiter) allow(class, client string) (bool, time.Duration) {
+	limit := l.limitFor(class)
+	if limit.PerSecond <= 0 {
+		return true, 0
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	now := l.now()
+	l.maybeEvict(now)
+
+	v, _ := l.buckets.LoadOrStore(class+"|"+client, &bucket{tokens: burst, last: now})
+	b := v.(*bucket)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.PerSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if class == rateClassLaunch {
+		l.limitedLaunch.Add(1)
+	} else {
+		l.limitedRead.Add(1)
+	}
+	wait := time.Duration((1 - b.tokens) / limit.PerSecond * float64(time.Second))
+	return false, wait
+}
+
+// maybeEvict drops idle buckets at most once per bucketEvictionTick, on
+// whichever request happens to arrive.
+func (l *rateLimiter) maybeEvict(now time.Time) {
+	last := l.lastEvict.Load()
+	if now.UnixNano()-last < int64(bucketEvictionTick) || !l.lastEvict.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	l.buckets.Range(func(k, v interface{}) bool {
+		b := v.(*bucket)
+		b.mu.Lock()
+		idle := now.Sub(b.last) > bucketIdleTTL
+		b.mu.Unlock()
+		if idle {
+			l.buckets.Delete(k)
+		}
+		return true
+	})
+}
+
+func (l *rateLimiter) usage() RateUsage {
+	clients := map[string]bool{}
+	l.buckets.Range(func(k, _ interface{}) bool {
+		key := k.(string)
+		clients[key[strings.IndexByte(key, '|')+1:]] = true
+		return true
+	})
+	return RateUsage{
+		Limits:  l.limits,
+		Clients: len(clients),
+		Limited: map[string]int64{
+			rateClassLaunch: l.limitedLaunch.Load(),
+			rateClassRead:   l.limitedRead.Load(),
+		},
+	}
+}
+
+// middleware rejects requests over budget with 429, a Retry-After header,
+// and a JSON error body.
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class, limited := rateClass(r)
+		if !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, wait := l.allow(class, clientKey(r))
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		secs := int(math.Ceil(wait.Seconds()))
+		if secs < 1 {
+			secs = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(ErrorEnvelope{Error: ErrorBody{
+			Status:  http.StatusTooManyRequests,
+			Code:    errorCode(http.StatusTooManyRequests),
+			Message: "rate limit exceeded for " + class + " requests; retry after " + strconv.Itoa(secs) + "s",
+		}})
+	})
+}
+
+// rateClass buckets a request. Health checks are never limited; waits are
+// long polls on existing processes and count as reads.
+func rateClass(r *http.Request) (string, bool) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if strings.HasSuffix(path, "/health") {
+		return "", false
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || strings.HasSuffix(path, "/wait") {
+		return rateClassRead, true
+	}
+	return rateClassLaunch, true
+}
+
+// clientKey identifies the caller. The server has no authentication, so
+// the remote IP is the only identity a client cannot trivially rotate.
+func clientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
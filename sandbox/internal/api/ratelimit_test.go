@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+func newLimitedServer(t *testing.T, limits RateLimits) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	cfg := NewConfig(dir, opts, executor.Features{})
+	cfg.RateLimits = limits
+	return NewServer(executor.NewManager(dir, opts), cfg)
+}
+
+func serve(s *Server, method, path, remote string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remote
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimitBurstThreshold(t *testing.T) {
+	s := newLimitedServer(t, RateLimits{
+		Launch: RateLimit{PerSecond: 1, Burst: 5},
+		Read:   RateLimit{PerSecond: 1, Burst: 5},
+	})
+	now := time.Unix(1000, 0)
+	s.limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		if rec := serve(s, "DELETE", "/v2/processes/missing", "10.0.0.1:5000"); rec.Code != http.StatusNotFound {
+			t.Fatalf("request %d = %d, want 404 from the handler", i, rec.Code)
+		}
+	}
+	rec := serve(s, "DELETE", "/v1/processes/missing", "10.0.0.1:5001")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request past burst = %d, want 429", rec.Code)
+	}
+	if ra, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || ra < 1 {
+		t.Fatalf("Retry-After = %q", rec.Header().Get("Retry-After"))
+	}
+	var env ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("429 body is not JSON: %v: %s", err, rec.Body.String())
+	}
+	if env.Error.Code != "rate_limited" || env.Error.Status != http.StatusTooManyRequests {
+		t.Fatalf("429 body = %+v", env.Error)
+	}
+
+	// Reads draw on their own bucket, other clients on theirs.
+	if rec := serve(s, "GET", "/v2/processes", "10.0.0.1:5002"); rec.Code != http.StatusOK {
+		t.Fatalf("read after launch limit = %d", rec.Code)
+	}
+	if rec := serve(s, "DELETE", "/v2/processes/missing", "10.0.0.2:5000"); rec.Code != http.StatusNotFound {
+		t.Fatalf("second client = %d", rec.Code)
+	}
+	if rec := serve(s, "GET", "/v2/health", "10.0.0.1:5003"); rec.Code != http.StatusOK {
+		t.Fatalf("health = %d, must never be limited", rec.Code)
+	}
+
+	now = now.Add(time.Second)
+	if rec := serve(s, "DELETE", "/v2/processes/missing", "10.0.0.1:5004"); rec.Code != http.StatusNotFound {
+		t.Fatalf("after refill = %d", rec.Code)
+	}
+	if rec := serve(s, "DELETE", "/v2/processes/missing", "10.0.0.1:5005"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("refill granted more than one token: %d", rec.Code)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	s := newLimitedServer(t, RateLimits{})
+	for i := 0; i < 200; i++ {
+		if rec := serve(s, "GET", "/v2/processes", "10.0.0.1:5000"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d with limits disabled", i, rec.Code)
+		}
+	}
+}
+
+func TestRateLimitEvictsIdleBuckets(t *testing.T) {
+	l := newRateLimiter(RateLimits{Read: RateLimit{PerSecond: 1, Burst: 1}})
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time { return now }
+	l.lastEvict.Store(now.UnixNano())
+
+	l.allow(rateClassRead, "a")
+	l.allow(rateClassRead, "b")
+	if got := l.usage().Clients; got != 2 {
+		t.Fatalf("clients = %d, want 2", got)
+	}
+
+	now = now.Add(bucketIdleTTL + bucketEvictionTick)
+	l.allow(rateClassRead, "c")
+	if got := l.usage().Clients; got != 1 {
+		t.Fatalf("clients after eviction = %d, want 1", got)
+	}
+}
+
+func TestStatsReportsRateLimitUsage(t *testing.T) {
+	limits := RateLimits{
+		Launch: RateLimit{PerSecond: 1, Burst: 1},
+		Read:   RateLimit{PerSecond: 100, Burst: 100},
+	}
+	s := newLimitedServer(t, limits)
+	serve(s, "DELETE", "/v2/processes/x", "10.0.0.1:1")
+	serve(s, "DELETE", "/v2/processes/x", "10.0.0.1:1")
+
+	rec := serve(s, "GET", "/v2/stats", "10.0.0.2:1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stats = %d", rec.Code)
+	}
+	var stats Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.RateLimit.Limits != limits {
+		t.Errorf("limits = %+v", stats.RateLimit.Limits)
+	}
+	if stats.RateLimit.Limited[rateClassLaunch] != 1 {
+		t.Errorf("limited = %v, want one launch", stats.RateLimit.Limited)
+	}
+	if stats.RateLimit.Clients != 2 {
+		t.Errorf("clients = %d, want 2", stats.RateLimit.Clients)
+	}
+
+	rec = serve(s, "GET", "/v2/config", "10.0.0.2:1")
+	var cfg Config
+	if err := json.Unmarshal(rec.Body.Bytes(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimits != limits {
+		t.Errorf("config rate_limits = %+v", cfg.RateLimits)
+	}
+}
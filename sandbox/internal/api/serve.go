@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+// Transports selects the frontends one server process runs. They share a
+// Manager, so a process launched through one is visible through all.
+type Transports struct {
+	HTTP  bool
+	Stdio bool
+	WS    bool // MCP over WebSocket at /mcp
+	TCP   bool // MCP over raw TCP
+}
+
+// ParseTransports parses a comma-separated --transport value such as
+// "http,stdio". HTTP and WebSocket share one listener; raw TCP needs the
+// port to itself.
+func ParseTransports(s string) (Transports, error) {
+	var t Transports
+	for _, name := range strings.Split(s, ",") {
+		switch strings.TrimSpace(name) {
+		case "http":
+			t.HTTP = true
+		case "stdio":
+			t.Stdio = true
+		case "ws":
+			t.WS = true
+		case "tcp":
+			t.TCP = true
+		case "":
+		default:
+			return t, fmt.Errorf("unknown transport %q (expected http, stdio, ws, or tcp)", name)
+		}
+	}
+	if t == (Transports{}) {
+		return t, errors.New("no transport selected")
+	}
+	if t.TCP && (t.HTTP || t.WS) {
+		return t, errors.New("tcp cannot share a port with http or ws; run it as a separate server")
+	}
+	return t, nil
+}
+
+// Listens reports whether any selected transport needs a network listener.
+func (t Transports) Listens() bool { return t.HTTP || t.WS || t.TCP }
+
+// DefaultShutdownTimeout bounds how long in-flight HTTP requests may run
+// once shutdown begins.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// ServeOptions configures Serve.
+type ServeOptions struct {
+	Transports Transports
+	Listener   net.Listener // for HTTP and WebSocket, or raw TCP
+	Stdin      io.Reader
+	Stdout     io.Writer
+	// AuthToken is required by ws and tcp. When set, it guards the HTTP
+	// API as well, which shares the ws listener: without it REST would
+	// launch processes for anyone who skipped MCP.
+	AuthToken string
+
+	ShutdownTimeout time.Duration
+}
+
+// Serve runs the selected frontends over manager until ctx is done, then
+// drains them: HTTP requests in flight get up to ShutdownTimeout to
+// finish, and MCP tool calls in flight are answered before their session
+// ends. The stdio session ending on its own, when the client closes stdin,
+// leaves the network frontends running; a network frontend failing stops
+// everything. Serve returns once every frontend has stopped.
+func Serve(ctx context.Context, manager *executor.Manager, config Config, opts ServeOptions) error {
+	t := opts.Transports
+	if (t.WS || t.TCP) && opts.AuthToken == "" {
+		return errors.New("ws and tcp transports expose process execution over the network and require an auth token")
+	}
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+		cancel()
+	}
+
+	if t.Stdio {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := NewMCPServer(manager, config).Run(ctx, opts.Stdin, opts.Stdout); err != nil {
+				log.Printf("MCP stdio session: %v", err)
+			}
+			if ctx.Err() == nil && t.Listens() {
+				log.Printf("MCP stdio session ended; still serving on %s", opts.Listener.Addr())
+			}
+		}()
+	}
+
+	switch {
+	case t.TCP:
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ServeMCPTCP(ctx, opts.Listener, manager, config, opts.AuthToken); err != nil {
+				fail(err)
+			}
+		}()
+	case t.HTTP || t.WS:
+		mux := http.NewServeMux()
+		if t.WS {
+			mux.Handle("/mcp", MCPWebSocketHandler(manager, config, opts.AuthToken))
+		}
+		if t.HTTP {
+			mux.Handle("/", NewServer(manager, config).Handler())
+		}
+		var handler http.Handler = mux
+		if opts.AuthToken != "" {
+			handler = requireToken(mux, opts.AuthToken)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := serveHTTP(ctx, opts.Listener, handler, opts.ShutdownTimeout); err != nil {
+				fail(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// requireToken lets through only requests that carry token as a bearer
+// token, so one token guards every route on the listener.
+func requireToken(next http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !tokenMatches(got, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sandbox"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveHTTP serves handler on ln until ctx is done, then shuts down.
+// Requests keep their own context until the drain finishes or times out,
+// so a waited launch is not killed merely because shutdown began.
+// WebSocket sessions, which Shutdown does not track, end with it.
+func serveHTTP(ctx context.Context, ln net.Listener, handler http.Handler, drain time.Duration) error {
+	reqCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	srv := &http.Server{
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return reqCtx },
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), drain)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP shutdown: %v; closing remaining connections", err)
+		srv.Close()
+	}
+	<-served
+	return nil
+}
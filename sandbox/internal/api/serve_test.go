@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+func TestParseTransports(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Transports
+		err  bool
+	}{
+		{in: "http", want: Transports{HTTP: true}},
+		{in: "http,stdio", want: Transports{HTTP: true, Stdio: true}},
+		{in: " ws , http ", want: Transports{HTTP: true, WS: true}},
+		{in: "stdio,tcp", want: Transports{Stdio: true, TCP: true}},
+		{in: "", err: true},
+		{in: "grpc", err: true},
+		{in: "http,tcp", err: true},
+	}
+	for _, c := range cases {
+		got, err := ParseTransports(c.in)
+		if (err != nil) != c.err || (!c.err && got != c.want) {
+			t.Errorf("ParseTransports(%q) = %+v, %v", c.in, got, err)
+		}
+	}
+}
+
+// servedPair runs Serve with HTTP and stdio over one Manager. It returns
+// the HTTP base URL, a writer feeding MCP stdin, decoded MCP responses,
+// and a stop function that cancels Serve and returns its error.
+func servedPair(t *testing.T) (string, io.WriteCloser, <-chan map[string]interface{}, func() error) {
+	t.Helper()
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	m := executor.NewManager(dir, opts)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	responses := make(chan map[string]interface{}, 16)
+	go func() {
+		sc := bufio.NewScanner(stdoutR)
+		for sc.Scan() {
+			var msg map[string]interface{}
+			if json.Unmarshal(sc.Bytes(), &msg) == nil {
+				responses <- msg
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, m, NewConfig(dir, opts, executor.Features{}), ServeOptions{
+			Transports: Transports{HTTP: true, Stdio: true},
+			Listener:   ln,
+			Stdin:      stdinR,
+			Stdout:     stdoutW,
+		})
+	}()
+	stop := func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("Serve did not return after cancel")
+			return nil
+		}
+	}
+	t.Cleanup(func() { cancel(); stdinW.Close(); stdoutW.Close() })
+	return "http://" + ln.Addr().String(), stdinW, responses, stop
+}
+
+func mcpToolCall(t *testing.T, w io.Writer, id int, tool string, args map[string]interface{}) {
+	t.Helper()
+	req := map[string]interface{}{
+		"jsonrpc": "2.0", "id": id, "method": "tools/call",
+		"params": map[string]interface{}{"name": tool, "arguments": args},
+	}
+	if err := json.NewEncoder(w).Encode(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func awaitResponse(t *testing.T, responses <-chan map[string]interface{}, id int) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-responses:
+			if msg["id"] != float64(id) {
+				continue
+			}
+			result, _ := msg["result"].(map[string]interface{})
+			content, _ := result["content"].([]interface{})
+			if len(content) == 0 {
+				t.Fatalf("response %d has no content: %v", id, msg)
+			}
+			return content[0].(map[string]interface{})["text"].(string)
+		case <-timeout:
+			t.Fatalf("no MCP response %d", id)
+		}
+	}
+}
+
+func TestServeSharesManagerAcrossTransports(t *testing.T) {
+	base, stdin, responses, stop := servedPair(t)
+
+	mcpToolCall(t, stdin, 1, "sandbox_launch", map[string]interface{}{"command": "echo from-mcp", "wait": true})
+	var launched executor.LaunchResult
+	if err := json.Unmarshal([]byte(awaitResponse(t, responses, 1)), &launched); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(base + "/v1/processes/" + launched.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read executor.ReadResult
+	json.NewDecoder(resp.Body).Decode(&read)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || read.Stdout != "from-mcp\n" {
+		t.Fatalf("HTTP read of MCP process: %d %+v", resp.StatusCode, read)
+	}
+
+	// Closing stdin ends the MCP session but not the HTTP server.
+	stdin.Close()
+	time.Sleep(50 * time.Millisecond)
+	resp, err = http.Post(base+"/v1/processes", "application/json", strings.NewReader(`{"command":"true","wait":true}`))
+	if err != nil {
+		t.Fatalf("HTTP stopped with the stdio session: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("launch after stdin closed: %d", resp.StatusCode)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(base + "/health"); err == nil {
+		t.Fatal("HTTP still serving after shutdown")
+	}
+}
+
+func TestServeShutdownDrainsBothTransports(t *testing.T) {
+	base, stdin, responses, stop := servedPair(t)
+
+	type httpResult struct {
+		result executor.LaunchResult
+		err    error
+	}
+	httpDone := make(chan httpResult, 1)
+	go func() {
+		resp, err := http.Post(base+"/v1/processes", "application/json",
+			strings.NewReader(`{"command":"sleep 0.3; echo drained","wait":true}`))
+		if err != nil {
+			httpDone <- httpResult{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		var r httpResult
+		r.err = json.NewDecoder(resp.Body).Decode(&r.result)
+		httpDone <- r
+	}()
+	mcpToolCall(t, stdin, 7, "sandbox_launch", map[string]interface{}{"command": "sleep 0.3", "wait": true})
+	time.Sleep(100 * time.Millisecond)
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-httpDone:
+		if r.err != nil || r.result.Stdout != "drained\n" {
+			// Output shows the command ran to completion rather than
+			// being killed when shutdown began.
+			t.Fatalf("in-flight HTTP launch: %+v, %v", r.result, r.err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight HTTP request was dropped")
+	}
+	// The MCP call was answered before its session ended.
+	if text := awaitResponse(t, responses, 7); !strings.Contains(text, `"id"`) {
+		t.Fatalf("in-flight MCP call: %s", text)
+	}
+}
+
+func TestServeTokenGuardsHTTP(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	m := executor.NewManager(dir, opts)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, m, NewConfig(dir, opts, executor.Features{}), ServeOptions{
+			Transports: Transports{HTTP: true, WS: true},
+			Listener:   ln,
+			AuthToken:  testMCPToken,
+		})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	get := func(path, token string) int {
+		req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, path := range []string{"/health", "/v1/processes", "/metrics"} {
+		for _, token := range []string{"", "wrong"} {
+			if code := get(path, token); code != http.StatusUnauthorized {
+				t.Errorf("GET %s with token %q = %d", path, token, code)
+			}
+		}
+	}
+	if code := get("/health", testMCPToken); code != http.StatusOK {
+		t.Fatalf("GET /health with the token = %d", code)
+	}
+}
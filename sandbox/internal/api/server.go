@@ -2,8 +2,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -13,24 +20,96 @@ import (
 // Server handles HTTP requests for the sandbox.
 type Server struct {
 	manager *executor.Manager
+	config  Config
 	router  *mux.Router
+	limiter *rateLimiter
 }
 
 // NewServer creates a new API server.
-func NewServer(manager *executor.Manager) *Server {
-	s := &Server{manager: manager, router: mux.NewRouter()}
+func NewServer(manager *executor.Manager, config Config) *Server {
+	s := &Server{
+		manager: manager,
+		config:  config,
+		router:  mux.NewRouter(),
+		limiter: newRateLimiter(config.RateLimits),
+	}
 	s.setupRoutes()
 	return s
 }
 
 func (s *Server) setupRoutes() {
-	s.router.HandleFunc("/health", s.handleHealth).Methods("GET")
-	s.router.HandleFunc("/processes", s.handleLaunch).Methods("POST")
-	s.router.HandleFunc("/processes", s.handleList).Methods("GET")
-	s.router.HandleFunc("/processes/{id}", s.handleRead).Methods("GET")
-	s.router.HandleFunc("/processes/{id}/write", s.handleWrite).Methods("POST")
-	s.router.HandleFunc("/processes/{id}/wait", s.handleWait).Methods("POST")
-	s.router.HandleFunc("/processes/{id}", s.handleKill).Methods("DELETE")
+	// Limits apply before version middleware so a rejected request costs
+	// nothing beyond the bucket lookup.
+	s.router.Use(s.limiter.middleware)
+
+	// Scrapers expect /metrics at the root, outside API versioning.
+	s.router.HandleFunc("/metrics", s.handleMetrics).Methods("GET")
+
+	v1 := s.router.PathPrefix("/" + APIVersionV1).Subrouter()
+	s.registerRoutes(v1)
+
+	v2 := s.router.PathPrefix("/" + APIVersionV2).Subrouter()
+	v2.Use(jsonErrors)
+	// Middleware only wraps matched routes, so the fallbacks need the
+	// envelope applied directly.
+	v2.NotFoundHandler = jsonErrors(http.HandlerFunc(s.unrouted))
+	v2.MethodNotAllowedHandler = jsonErrors(http.HandlerFunc(methodNotAllowed))
+	s.registerRoutes(v2)
+
+	legacy := s.router.NewRoute().Subrouter()
+	legacy.Use(deprecatedRoutes)
+	s.registerRoutes(legacy)
+
+	s.router.NotFoundHandler = http.HandlerFunc(s.unrouted)
+}
+
+// unrouted answers requests no route took. Subrouter routes repeat the
+// version prefix matcher, which makes mux forget a method mismatch, so a
+// wrong method lands here too; it gets a 405 listing the allowed methods.
+func (s *Server) unrouted(w http.ResponseWriter, r *http.Request) {
+	var allow []string
+	s.router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		req := r.Clone(r.Context())
+		req.Method = methods[0]
+		if route.Match(req, &mux.RouteMatch{}) {
+			allow = append(allow, methods...)
+		}
+		return nil
+	})
+	if len(allow) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	methodNotAllowed(w, r)
+}
+
+// registerRoutes installs the shared handlers on one versioned router.
+func (s *Server) registerRoutes(r *mux.Router) {
+	r.HandleFunc("/health", s.handleHealth).Methods("GET")
+	r.HandleFunc("/config", s.handleConfig).Methods("GET")
+	r.HandleFunc("/stats", s.handleStats).Methods("GET")
+	r.HandleFunc("/processes", s.handleLaunch).Methods("POST")
+	r.HandleFunc("/processes/validate", s.handleValidate).Methods("POST")
+	r.HandleFunc("/processes", s.handleList).Methods("GET")
+	r.HandleFunc("/processes/{id}", s.handleRead).Methods("GET")
+	r.HandleFunc("/processes/{id}/{stream:stdout|stderr|combined}", s.handleStream).Methods("GET")
+	r.HandleFunc("/processes/{id}/attach", s.handleAttach).Methods("GET")
+	r.HandleFunc("/processes/{id}/write", s.handleWrite).Methods("POST")
+	r.HandleFunc("/processes/{id}/inputs", s.handleInputs).Methods("GET")
+	r.HandleFunc("/processes/{id}/transcript", s.handleTranscript).Methods("GET")
+	r.HandleFunc("/processes/{id}/recording", s.handleRecording).Methods("GET")
+	r.HandleFunc("/processes/{id}/wait", s.handleWait).Methods("POST")
+	r.HandleFunc("/processes/{id}/pause", s.handlePause).Methods("POST")
+	r.HandleFunc("/processes/{id}/resume", s.handleResume).Methods("POST")
+	r.HandleFunc("/processes/{id}", s.handleKill).Methods("DELETE")
+	r.HandleFunc("/workspace/tail", s.handleTail).Methods("POST")
+	r.HandleFunc("/sessions/{id}", s.handleSetSession).Methods("PUT")
+	r.HandleFunc("/sessions/{id}", s.handleGetSession).Methods("GET")
 }
 
 // Handler returns the HTTP handler.
@@ -38,8 +117,27 @@ func (s *Server) Handler() http.Handler {
 	return s.router
 }
 
+// Health is the /health response. Status is "degraded" while an attached
+// redis-fs mount is unhealthy; the server itself still answers. It is
+// "unavailable", with a 503, when the workspace has gone missing, since
+// no launch can succeed.
+type Health struct {
+	Status    string                   `json:"status"`
+	Workspace executor.WorkspaceStatus `json:"workspace"`
+	RedisFS   *executor.RedisFSStatus  `json:"redis_fs,omitempty"`
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	h := Health{Status: "ok", Workspace: s.manager.Workspace(), RedisFS: s.manager.RedisFS()}
+	if h.RedisFS != nil && !h.RedisFS.Healthy {
+		h.Status = "degraded"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !h.Workspace.Ready {
+		h.Status = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(h)
 }
 
 // LaunchRequest is the JSON body for launching a process.
@@ -49,45 +147,317 @@ type LaunchRequest struct {
 	TimeoutSecs   int    `json:"timeout_secs,omitempty"`
 	Wait          bool   `json:"wait"`
 	KeepStdinOpen bool   `json:"keep_stdin_open,omitempty"`
+	Nice          *int   `json:"nice,omitempty"`
+	IONiceClass   string `json:"ionice_class,omitempty"`
+	MaxOpenFiles  *int   `json:"max_open_files,omitempty"`
+
+	SecurityProfile string `json:"security_profile,omitempty"`
+	TraceID         string `json:"trace_id,omitempty"`
+	MergeOutput     bool   `json:"merge_output,omitempty"`
+	GracePeriodSecs int    `json:"grace_period_secs,omitempty"`
+
+	// SessionID and Env are described on executor.LaunchOptions; Cwd and
+	// Env values may use the template variables GET /config lists.
+	SessionID string            `json:"session_id,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+
+	// Record runs the command on a terminal and keeps an asciinema cast
+	// of it, served by GET /processes/{id}/recording.
+	Record bool `json:"record,omitempty"`
 }
 
-func (s *Server) handleLaunch(w http.ResponseWriter, r *http.Request) {
+// decodeLaunchRequest reads a LaunchRequest body. Without a trace_id in
+// the body, the trace ID of a W3C traceparent header is used.
+func decodeLaunchRequest(r *http.Request) (LaunchRequest, error) {
 	var req LaunchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return req, err
+	}
+	if req.TraceID == "" {
+		req.TraceID, _ = executor.TraceIDFromTraceparent(r.Header.Get("traceparent"))
+	}
+	return req, nil
+}
+
+func (s *Server) handleLaunch(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeLaunchRequest(r)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// A waited launch ends with its request; any other outlives it.
+	ctx := r.Context()
+	if !req.Wait {
+		ctx = context.WithoutCancel(ctx)
+	}
+	result, err := s.manager.Launch(ctx, req.options())
+	if err != nil {
+		http.Error(w, err.Error(), launchErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (req LaunchRequest) options() executor.LaunchOptions {
 	opts := executor.LaunchOptions{
 		Command:       req.Command,
 		Cwd:           req.Cwd,
 		Wait:          req.Wait,
 		KeepStdinOpen: req.KeepStdinOpen,
+		Nice:          req.Nice,
+		IONiceClass:   req.IONiceClass,
+		MaxOpenFiles:  req.MaxOpenFiles,
+
+		SecurityProfile: req.SecurityProfile,
+		TraceID:         req.TraceID,
+		MergeOutput:     req.MergeOutput,
+		GracePeriod:     time.Duration(req.GracePeriodSecs) * time.Second,
+		SessionID:       req.SessionID,
+		Env:             req.Env,
+		Record:          req.Record,
 	}
 	if req.TimeoutSecs > 0 {
 		opts.Timeout = time.Duration(req.TimeoutSecs) * time.Second
 	}
+	return opts
+}
+
+// launchRequestFor renders resolved launch options in request form.
+func launchRequestFor(opts executor.LaunchOptions) LaunchRequest {
+	return LaunchRequest{
+		Command:       opts.Command,
+		Cwd:           opts.Cwd,
+		TimeoutSecs:   int(opts.Timeout / time.Second),
+		Wait:          opts.Wait,
+		KeepStdinOpen: opts.KeepStdinOpen,
+		Nice:          opts.Nice,
+		IONiceClass:   opts.IONiceClass,
+		MaxOpenFiles:  opts.MaxOpenFiles,
 
-	result, err := s.manager.Launch(r.Context(), opts)
+		SecurityProfile: opts.SecurityProfile,
+		TraceID:         opts.TraceID,
+		MergeOutput:     opts.MergeOutput,
+		GracePeriodSecs: int(opts.GracePeriod / time.Second),
+		SessionID:       opts.SessionID,
+		Env:             opts.Env,
+		Record:          opts.Record,
+	}
+}
+
+// ValidateResponse is the result of a dry-run launch: the request as the
+// server would run it, the resulting argv, and any warnings.
+type ValidateResponse struct {
+	Options  LaunchRequest `json:"options"`
+	Argv     []string      `json:"argv"`
+	Warnings []string      `json:"warnings"`
+}
+
+func newValidateResponse(result *executor.ValidationResult) ValidateResponse {
+	return ValidateResponse{Options: launchRequestFor(result.Options), Argv: result.Argv, Warnings: result.Warnings}
+}
+
+// handleValidate checks a LaunchRequest without running it. A request
+// Launch would refuse fails with the same status.
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeLaunchRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	result, err := s.manager.Validate(r.Context(), req.options())
+	if err != nil {
+		http.Error(w, err.Error(), launchErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newValidateResponse(result))
+}
+
+// maxListWait bounds ?wait_for_change so a request cannot hold a
+// connection open indefinitely.
+const maxListWait = 5 * time.Minute
+
+// launchErrorStatus maps a failed launch to its HTTP status.
+func launchErrorStatus(err error) int {
+	var verr *executor.ValidationError
+	var xerr *executor.ExecError
+	var uerr *executor.UnsupportedError
+	var merr *executor.MountUnavailableError
+	switch {
+	case errors.As(err, &verr):
+		return http.StatusBadRequest
+	case errors.As(err, &xerr):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &uerr):
+		return http.StatusNotImplemented
+	case errors.As(err, &merr):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
 
+// handleTail starts a managed tail of a workspace file; see
+// executor.Manager.TailFile.
+func (s *Server) handleTail(w http.ResponseWriter, r *http.Request) {
+	var req executor.TailOptions
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := s.manager.TailFile(req)
+	if err != nil {
+		http.Error(w, err.Error(), launchErrorStatus(err))
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
 
+// Session is a session's default working directory, as a cwd template
+// relative to the workspace; empty means the workspace itself.
+type Session struct {
+	ID  string `json:"id"`
+	Cwd string `json:"cwd"`
+}
+
+// handleSetSession sets where launches in a session start when they give
+// no cwd. An empty cwd restores the server's default.
+func (s *Server) handleSetSession(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req struct {
+		Cwd string `json:"cwd"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.manager.SetSessionCwd(id, req.Cwd); err != nil {
+		http.Error(w, err.Error(), launchErrorStatus(err))
+		return
+	}
+	s.handleGetSession(w, r)
+}
+
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Session{ID: id, Cwd: s.manager.SessionCwd(id)})
+}
+
+// handleList returns all processes with an ETag for the list version.
+// When the client's tag (?etag= or If-None-Match) is current, it answers
+// 304, first blocking for up to ?wait_for_change=<duration> for the list
+// to change.
+// ?state=running,paused lists only processes in those states.
 func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var wait time.Duration
+	if v := q.Get("wait_for_change"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, fmt.Sprintf("wait_for_change: expected a duration such as 30s, got %q", v), http.StatusBadRequest)
+			return
+		}
+		if d > maxListWait {
+			d = maxListWait
+		}
+		wait = d
+	}
+	tag := q.Get("etag")
+	if tag == "" {
+		tag = r.Header.Get("If-None-Match")
+	}
+
+	version := s.manager.Version()
+	if tag != "" && tag == s.manager.ETag(version) && wait > 0 {
+		version = s.manager.WaitForChange(r.Context(), version, wait)
+	}
+	current := s.manager.ETag(version)
+	w.Header().Set("ETag", current)
+	if tag == current {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	processes := s.manager.List()
+	if v := q.Get("state"); v != "" {
+		processes = filterStates(processes, strings.Split(v, ","))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(processes)
 }
 
+// filterStates keeps the processes in one of states.
+func filterStates(procs []*executor.ProcessInfo, states []string) []*executor.ProcessInfo {
+	keep := procs[:0]
+	for _, p := range procs {
+		for _, st := range states {
+			if string(p.State) == strings.TrimSpace(st) {
+				keep = append(keep, p)
+				break
+			}
+		}
+	}
+	return keep
+}
+
+// handleRead returns a process's state and output; ?tail_lines=n cuts
+// each stream to its last n lines.
 func (s *Server) handleRead(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	result, err := s.manager.Read(id)
+	tail, err := parseTailLines(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result *executor.ReadResult
+	if tail > 0 {
+		result, err = s.manager.ReadTail(id, tail)
+	} else {
+		result, err = s.manager.Read(id)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleStream returns one stream's output, optionally limited to what was
+// written after ?since=<RFC 3339 time> or within ?last=<duration>, or to
+// its last ?tail_lines=n lines.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	q := r.URL.Query()
+	since, err := parseSince(q, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tail, err := parseTailLines(q)
+	if err == nil && tail > 0 && !since.IsZero() {
+		err = errors.New("tail_lines cannot be combined with since or last")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result *executor.StreamResult
+	if tail > 0 {
+		result, err = s.manager.ReadStreamTail(vars["id"], vars["stream"], tail)
+	} else {
+		result, err = s.manager.ReadSince(vars["id"], vars["stream"], since)
+	}
 	if err != nil {
+		var verr *executor.ValidationError
+		if errors.As(err, &verr) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
@@ -95,9 +465,45 @@ func (s *Server) handleRead(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
+func parseSince(q url.Values, now time.Time) (time.Time, error) {
+	sinceStr, lastStr := q.Get("since"), q.Get("last")
+	switch {
+	case sinceStr != "" && lastStr != "":
+		return time.Time{}, errors.New("since and last are mutually exclusive")
+	case sinceStr != "":
+		t, err := time.Parse(time.RFC3339Nano, sinceStr)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("since: expected an RFC 3339 timestamp: %w", err)
+		}
+		return t, nil
+	case lastStr != "":
+		d, err := time.ParseDuration(lastStr)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("last: expected a positive duration such as 30s, got %q", lastStr)
+		}
+		return now.Add(-d), nil
+	}
+	return time.Time{}, nil
+}
+
+// parseTailLines reads ?tail_lines, which is 0 when absent.
+func parseTailLines(q url.Values) (int, error) {
+	v := q.Get("tail_lines")
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("tail_lines: expected a positive number of lines, got %q", v)
+	}
+	return n, nil
+}
+
 // WriteRequest is the JSON body for writing to stdin.
 type WriteRequest struct {
 	Input string `json:"input"`
+	Line  bool   `json:"line,omitempty"`
+	Tag   string `json:"tag,omitempty"`
 }
 
 func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
@@ -108,13 +514,82 @@ func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.manager.Write(id, req.Input); err != nil {
+	rec, err := s.manager.WriteInput(id, req.Input, executor.WriteOptions{Line: req.Line, Tag: req.Tag})
+	if err != nil {
+		var serr *executor.StateError
+		if errors.As(err, &serr) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(WriteResponse{Status: "ok", Seq: rec.Seq, Bytes: rec.Bytes, At: rec.At})
+}
+
+// StatusResponse is the state a process was left in by kill, pause or
+// resume.
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+// WriteResponse acknowledges a write to stdin.
+type WriteResponse struct {
+	Status string    `json:"status"`
+	Seq    int       `json:"seq"`
+	Bytes  int       `json:"bytes"`
+	At     time.Time `json:"at"`
+}
+
+func (s *Server) handleInputs(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	history, err := s.manager.Inputs(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// handleTranscript returns the process transcript as JSON lines, one
+// event per line, or rendered as plain text with ?format=text.
+func (s *Server) handleTranscript(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "jsonl" && format != "text" {
+		http.Error(w, fmt.Sprintf("format: expected jsonl or text, got %q", format), http.StatusBadRequest)
+		return
+	}
+	events, err := s.manager.Transcript(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, executor.RenderTranscript(events))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, ev := range events {
+		enc.Encode(ev)
+	}
+}
+
+// handleRecording returns the asciinema cast of a process launched with
+// record, as far as it has been written.
+func (s *Server) handleRecording(w http.ResponseWriter, r *http.Request) {
+	f, err := s.manager.Recording(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", executor.CastContentType)
+	io.Copy(w, f)
 }
 
 func (s *Server) handleWait(w http.ResponseWriter, r *http.Request) {
@@ -128,13 +603,49 @@ func (s *Server) handleWait(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
+// handleKill stops a process. With ?grace_period_secs=n it is sent SIGTERM
+// and given n seconds to exit before it is SIGKILLed; the response then
+// waits for it.
 func (s *Server) handleKill(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
-	if err := s.manager.Kill(id); err != nil {
+	var grace time.Duration
+	if v := r.URL.Query().Get("grace_period_secs"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("grace_period_secs: expected a whole number of seconds, got %q", v), http.StatusBadRequest)
+			return
+		}
+		grace = time.Duration(n) * time.Second
+	}
+	state, err := s.manager.Terminate(id, grace)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "killed"})
+	json.NewEncoder(w).Encode(StatusResponse{Status: string(state)})
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.changeRunState(w, mux.Vars(r)["id"], s.manager.Pause, "paused")
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.changeRunState(w, mux.Vars(r)["id"], s.manager.Resume, "running")
 }
 
+// changeRunState applies pause or resume. A process in a state that does
+// not allow it is a conflict; any other failure means it was not found.
+func (s *Server) changeRunState(w http.ResponseWriter, id string, apply func(string) error, status string) {
+	if err := apply(id); err != nil {
+		var serr *executor.StateError
+		if errors.As(err, &serr) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatusResponse{Status: status})
+}
@@ -0,0 +1,726 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-fs/sandbox/internal/executor"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	m := executor.NewManager(dir, opts)
+	cfg := NewConfig(dir, opts, executor.Features{})
+	ts := httptest.NewServer(NewServer(m, cfg).Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestVersionedRoutesResolve(t *testing.T) {
+	ts := newTestServer(t)
+	for _, prefix := range []string{"", "/v1", "/v2"} {
+		resp, err := http.Get(ts.URL + prefix + "/processes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s/processes = %d", prefix, resp.StatusCode)
+		}
+		deprecated := resp.Header.Get("Deprecation") != ""
+		if deprecated != (prefix == "") {
+			t.Errorf("GET %s/processes Deprecation header present = %v", prefix, deprecated)
+		}
+	}
+}
+
+func TestErrorFormatPerVersion(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/v1/processes/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("v1 status = %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("v1 content type = %q, want text/plain", ct)
+	}
+
+	resp2, err := http.Get(ts.URL + "/v2/processes/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	if resp2.StatusCode != http.StatusNotFound {
+		t.Fatalf("v2 status = %d", resp2.StatusCode)
+	}
+	var env ErrorEnvelope
+	if err := json.NewDecoder(resp2.Body).Decode(&env); err != nil {
+		t.Fatalf("v2 body is not a JSON envelope: %v", err)
+	}
+	if env.Error.Status != http.StatusNotFound || env.Error.Code != "not_found" || !strings.Contains(env.Error.Message, "missing") {
+		t.Fatalf("unexpected envelope %+v", env)
+	}
+}
+
+func TestV2UnroutedErrorsUseEnvelope(t *testing.T) {
+	ts := newTestServer(t)
+	for _, c := range []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{"GET", "/v2/nope", http.StatusNotFound, "not_found"},
+		{"DELETE", "/v2/health", http.StatusMethodNotAllowed, "method_not_allowed"},
+	} {
+		req, _ := http.NewRequest(c.method, ts.URL+c.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var env ErrorEnvelope
+		err = json.NewDecoder(resp.Body).Decode(&env)
+		resp.Body.Close()
+		if resp.StatusCode != c.status || err != nil || env.Error.Status != c.status || env.Error.Code != c.code {
+			t.Errorf("%s %s = %d %+v (%v)", c.method, c.path, resp.StatusCode, env, err)
+		}
+		if c.status == http.StatusMethodNotAllowed && resp.Header.Get("Allow") != "GET" {
+			t.Errorf("%s %s Allow = %q", c.method, c.path, resp.Header.Get("Allow"))
+		}
+	}
+
+	// v1 keeps the plain-text errors.
+	resp, err := http.Get(ts.URL + "/v1/nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusNotFound || !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("GET /v1/nope = %d %q", resp.StatusCode, ct)
+	}
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+	resp, err := http.Get(ts.URL + "/v1/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var cfg Config
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Workspace == "" || len(cfg.Shells) == 0 || len(cfg.APIVersions) != 2 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLaunchErrorStatuses(t *testing.T) {
+	ts := newTestServer(t)
+	cases := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"command":"echo a\u0000b"}`, http.StatusBadRequest, "invalid_request"},
+		{`{"command":"` + strings.Repeat("x", executor.DefaultMaxCommandBytes+1) + `"}`, http.StatusBadRequest, "invalid_request"},
+		{`{"command":"true","cwd":"no/such/dir"}`, http.StatusUnprocessableEntity, "unprocessable"},
+	}
+	for _, c := range cases {
+		resp, err := http.Post(ts.URL+"/v2/processes", "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var env ErrorEnvelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		resp.Body.Close()
+		if resp.StatusCode != c.status || env.Error.Code != c.code {
+			t.Errorf("launch %.40s: status %d code %q, want %d %q (%s)",
+				c.body, resp.StatusCode, env.Error.Code, c.status, c.code, env.Error.Message)
+		}
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+	resp, err := http.Post(ts.URL+"/v1/processes/validate", "application/json", strings.NewReader(`{"command":"echo (","timeout_secs":30}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got ValidateResponse
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || got.Options.TimeoutSecs != 30 || got.Options.Cwd == "" || got.Options.Nice == nil {
+		t.Fatalf("status %d, response %+v", resp.StatusCode, got)
+	}
+	if len(got.Warnings) != 1 || !strings.HasPrefix(got.Warnings[0], "shell syntax") {
+		t.Fatalf("warnings = %q", got.Warnings)
+	}
+
+	resp, err = http.Post(ts.URL+"/v2/processes/validate", "application/json", strings.NewReader(`{"command":"true","cwd":"no/such/dir"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("missing cwd: status %d", resp.StatusCode)
+	}
+}
+
+func TestLaunchTakesTraceparent(t *testing.T) {
+	ts := newTestServer(t)
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/v1/processes", strings.NewReader(`{"command":"true","wait":true}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// An explicit trace_id wins over the header.
+	req, _ = http.NewRequest(http.MethodPost, ts.URL+"/v1/processes", strings.NewReader(`{"command":"true","wait":true,"trace_id":"job-42"}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(ts.URL + "/v1/processes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list []executor.ProcessInfo
+	json.NewDecoder(resp.Body).Decode(&list)
+	got := map[string]bool{}
+	for _, p := range list {
+		got[p.TraceID] = true
+	}
+	if len(list) != 2 || !got["4bf92f3577b34da6a3ce929d0e0e4736"] || !got["job-42"] {
+		t.Fatalf("trace ids %v", got)
+	}
+}
+
+func TestMCPLaunchFailureIsToolError(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	s := NewMCPServer(executor.NewManager(dir, opts), NewConfig(dir, opts, executor.Features{}))
+
+	big := strings.Repeat("x", 1<<20)
+	in := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"sandbox_launch","arguments":{"command":"` + big + `"}}}` + "\n" +
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"sandbox_launch","arguments":{"command":"true","cwd":"missing"}}}` + "\n"
+	var out strings.Builder
+	if err := s.Run(context.Background(), strings.NewReader(in), &out); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// Tool calls are answered concurrently, so match responses by id.
+	want := map[float64]string{1: "exceeding", 2: "ENOENT"}
+	dec := json.NewDecoder(strings.NewReader(out.String()))
+	for range want {
+		var resp struct {
+			ID     float64   `json:"id"`
+			Error  *MCPError `json:"error"`
+			Result struct {
+				IsError bool `json:"isError"`
+				Content []struct {
+					Text string `json:"text"`
+				} `json:"content"`
+			} `json:"result"`
+		}
+		if err := dec.Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if resp.Error != nil || !resp.Result.IsError || len(resp.Result.Content) == 0 ||
+			!strings.Contains(resp.Result.Content[0].Text, want[resp.ID]) {
+			t.Errorf("id %v: want isError result mentioning %q, got %+v", resp.ID, want[resp.ID], resp)
+		}
+	}
+}
+
+func TestStreamSinceQuery(t *testing.T) {
+	ts := newTestServer(t)
+	resp, err := http.Post(ts.URL+"/v1/processes", "application/json",
+		strings.NewReader(`{"command":"echo hello; echo oops >&2","wait":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var launched executor.LaunchResult
+	json.NewDecoder(resp.Body).Decode(&launched)
+	resp.Body.Close()
+
+	get := func(query string) (int, executor.StreamResult) {
+		resp, err := http.Get(ts.URL + "/v1/processes/" + launched.ID + "/stdout" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var res executor.StreamResult
+		json.NewDecoder(resp.Body).Decode(&res)
+		return resp.StatusCode, res
+	}
+
+	status, all := get("?last=1m")
+	if status != http.StatusOK || all.Data != "hello\n" || all.NewestAt == nil {
+		t.Fatalf("last=1m: %d %+v", status, all)
+	}
+	next := all.NewestAt.Format(time.RFC3339Nano)
+	if status, res := get("?since=" + next); status != http.StatusOK || res.Data != "" {
+		t.Fatalf("since newest: %d %+v", status, res)
+	}
+	for _, bad := range []string{"?since=yesterday", "?last=-5s", "?since=" + next + "&last=5s"} {
+		if status, _ := get(bad); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", bad, status)
+		}
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/processes/" + launched.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read executor.ReadResult
+	json.NewDecoder(resp.Body).Decode(&read)
+	resp.Body.Close()
+	if read.FirstOutputAt == nil || read.LastOutputAt == nil || read.LastOutputAt.Before(*read.FirstOutputAt) {
+		t.Fatalf("output timestamps %+v", read)
+	}
+}
+
+func TestListLongPollUnblocksOnExit(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	m := executor.NewManager(dir, opts)
+	ts := httptest.NewServer(NewServer(m, NewConfig(dir, opts, executor.Features{})).Handler())
+	defer ts.Close()
+	list := func(query string, header http.Header) *http.Response {
+		req, _ := http.NewRequest("GET", ts.URL+"/v2/processes"+query, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// The process exits once it reads a line, so the test decides when.
+	launched, err := m.Launch(context.Background(), executor.LaunchOptions{Command: "read line", KeepStdinOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := list("", nil)
+	resp.Body.Close()
+	tag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || tag == "" {
+		t.Fatalf("initial list: %d, etag %q", resp.StatusCode, tag)
+	}
+
+	// A current tag without waiting is answered immediately.
+	resp = list("", http.Header{"If-None-Match": {tag}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("If-None-Match current tag: %d, want 304", resp.StatusCode)
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		m.WriteInput(launched.ID, "go", executor.WriteOptions{Line: true})
+	}()
+	start := time.Now()
+	resp = list("?wait_for_change=10s&etag="+url.QueryEscape(tag), nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("long poll: %d, want 200", resp.StatusCode)
+	}
+	if waited := time.Since(start); waited > 5*time.Second {
+		t.Fatalf("long poll returned after %v, not when the process exited", waited)
+	}
+	if resp.Header.Get("ETag") == tag {
+		t.Fatal("long poll returned the stale etag")
+	}
+	var procs []executor.ProcessInfo
+	json.NewDecoder(resp.Body).Decode(&procs)
+	if len(procs) != 1 || procs[0].State != executor.StateExited {
+		t.Fatalf("processes after exit: %+v", procs)
+	}
+
+	tag = resp.Header.Get("ETag")
+	resp = list("?wait_for_change=100ms&etag="+url.QueryEscape(tag), nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified || resp.Header.Get("ETag") != tag {
+		t.Fatalf("idle long poll: %d etag %q, want 304 %q", resp.StatusCode, resp.Header.Get("ETag"), tag)
+	}
+
+	resp = list("?wait_for_change=soon", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad wait_for_change: %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestMCPResourcesListChanged(t *testing.T) {
+	ts, _ := newMCPWebSocketServer(t)
+	conn, _, err := dialMCP(t, ts, testMCPToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if resp, err := mcpCall(conn, 1, "initialize", map[string]interface{}{}); err != nil || resp.Error != nil {
+		t.Fatalf("initialize: %+v, %v", resp.Error, err)
+	}
+	if err := conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0", "id": 2, "method": "tools/call",
+		"params": map[string]interface{}{"name": "sandbox_launch", "arguments": map[string]interface{}{"command": "true"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg MCPNotification
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("no resources/list_changed notification: %v", err)
+		}
+		if msg.Method == "notifications/resources/list_changed" {
+			break
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	resp, err := mcpCall(conn, 3, "resources/list", nil)
+	if err != nil || resp.Error != nil {
+		t.Fatalf("resources/list: %+v, %v", resp.Error, err)
+	}
+	var list struct {
+		Resources []struct {
+			URI string `json:"uri"`
+		} `json:"resources"`
+	}
+	b, _ := json.Marshal(resp.Result)
+	json.Unmarshal(b, &list)
+	if len(list.Resources) != 1 || !strings.HasPrefix(list.Resources[0].URI, processResourcePrefix) {
+		t.Fatalf("resources = %s", b)
+	}
+
+	resp, err = mcpCall(conn, 4, "resources/read", map[string]string{"uri": list.Resources[0].URI})
+	if err != nil || resp.Error != nil {
+		t.Fatalf("resources/read: %+v, %v", resp.Error, err)
+	}
+	if resp, _ := mcpCall(conn, 5, "resources/read", map[string]string{"uri": processResourcePrefix + "missing"}); resp.Error == nil || resp.Error.Code != -32002 {
+		t.Fatalf("reading a missing resource: %+v", resp.Error)
+	}
+}
+
+func TestWorkspaceTail(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	ts := httptest.NewServer(NewServer(executor.NewManager(dir, opts), NewConfig(dir, opts, executor.Features{})).Handler())
+	defer ts.Close()
+	if err := os.WriteFile(filepath.Join(dir, "build.log"), []byte("a\nb\nc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(ts.URL+"/v2/workspace/tail", "application/json", strings.NewReader(`{"path":"build.log","lines":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res executor.LaunchResult
+	json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || res.Stdout != "b\nc\n" {
+		t.Fatalf("tail: %d %+v", resp.StatusCode, res)
+	}
+
+	resp, err = http.Post(ts.URL+"/v2/workspace/tail", "application/json", strings.NewReader(`{"path":"/etc/passwd"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env ErrorEnvelope
+	json.NewDecoder(resp.Body).Decode(&env)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || env.Error.Code != "invalid_request" {
+		t.Fatalf("tail outside workspace: %d %+v", resp.StatusCode, env)
+	}
+}
+
+func TestTranscriptEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+	resp, err := http.Post(ts.URL+"/v1/processes", "application/json",
+		strings.NewReader(`{"command":"echo hello; exit 4","wait":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var launched executor.LaunchResult
+	json.NewDecoder(resp.Body).Decode(&launched)
+	resp.Body.Close()
+
+	resp, err = http.Get(ts.URL + "/v1/processes/" + launched.ID + "/transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("content type = %q", ct)
+	}
+	var kinds []string
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		var ev executor.TranscriptEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		kinds = append(kinds, ev.Kind)
+	}
+	if got := strings.Join(kinds, " "); got != "start stdout state exit" {
+		t.Fatalf("kinds = %q", got)
+	}
+
+	resp2, err := http.Get(ts.URL + "/v1/processes/" + launched.ID + "/transcript?format=text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	var text strings.Builder
+	io.Copy(&text, resp2.Body)
+	if !strings.Contains(text.String(), "$ echo hello; exit 4") || !strings.Contains(text.String(), "code 4") {
+		t.Fatalf("text transcript:\n%s", text.String())
+	}
+
+	resp3, err := http.Get(ts.URL + "/v1/processes/" + launched.ID + "/transcript?format=xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp3.Body.Close()
+	if resp3.StatusCode != http.StatusBadRequest {
+		t.Fatalf("format=xml status = %d", resp3.StatusCode)
+	}
+}
+
+func TestReadTailLines(t *testing.T) {
+	ts := newTestServer(t)
+	// About 3.4MB of output.
+	resp, err := http.Post(ts.URL+"/v1/processes", "application/json",
+		strings.NewReader(`{"command":"seq 1 500000","wait":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var launched executor.LaunchResult
+	json.NewDecoder(resp.Body).Decode(&launched)
+	resp.Body.Close()
+
+	get := func(path string, out interface{}) (int, int) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/v1/processes/" + launched.ID + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if out != nil {
+			json.Unmarshal(body, out)
+		}
+		return resp.StatusCode, len(body)
+	}
+
+	var read executor.ReadResult
+	if code, size := get("?tail_lines=50", &read); code != http.StatusOK || size > 4<<10 {
+		t.Fatalf("read: %d, %d bytes", code, size)
+	}
+	if read.Lines == nil || read.Lines.Tail != 50 || read.Lines.Stdout.Total != 500000 || read.Lines.Stdout.Returned != 50 ||
+		!strings.HasPrefix(read.Stdout, "499951\n") || !strings.HasSuffix(read.Stdout, "\n500000\n") {
+		t.Fatalf("read: %+v, stdout %q", read.Lines, read.Stdout)
+	}
+
+	var stream executor.StreamResult
+	if code, _ := get("/stdout?tail_lines=2", &stream); code != http.StatusOK || stream.Data != "499999\n500000\n" || stream.Lines == nil {
+		t.Fatalf("stream: %d %+v", code, stream)
+	}
+
+	for _, path := range []string{"?tail_lines=0", "?tail_lines=x", "/stdout?tail_lines=-1", "/stdout?tail_lines=5&last=1m"} {
+		if code, _ := get(path, nil); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", path, code)
+		}
+	}
+}
+
+func TestRecordingEndpoint(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("recording needs a pseudo-terminal")
+	}
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	opts.ProcessLogDir = t.TempDir()
+	ts := httptest.NewServer(NewServer(executor.NewManager(dir, opts), NewConfig(dir, opts, executor.Features{})).Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/v1/processes", "application/json",
+		strings.NewReader(`{"command":"echo hello","wait":true,"record":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var launched executor.LaunchResult
+	json.NewDecoder(resp.Body).Decode(&launched)
+	resp.Body.Close()
+
+	resp, err = http.Get(ts.URL + "/v1/processes/" + launched.ID + "/recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != executor.CastContentType {
+		t.Fatalf("recording: %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var cast strings.Builder
+	io.Copy(&cast, resp.Body)
+	header, events, _ := strings.Cut(cast.String(), "\n")
+	if !strings.HasPrefix(header, `{"version":2,`) || !strings.Contains(events, `"o","hello\r\n"]`) {
+		t.Fatalf("cast:\n%s", cast.String())
+	}
+
+	resp, err = http.Get(ts.URL + "/v1/processes/nope/recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown process: %d", resp.StatusCode)
+	}
+}
+
+func TestHealthReflectsWorkspace(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ws")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	opts := executor.DefaultOptions()
+	ts := httptest.NewServer(NewServer(executor.NewManager(dir, opts), NewConfig(dir, opts, executor.Features{})).Handler())
+	defer ts.Close()
+
+	health := func() (int, Health) {
+		resp, err := http.Get(ts.URL + "/v1/health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var h Health
+		json.NewDecoder(resp.Body).Decode(&h)
+		return resp.StatusCode, h
+	}
+	if code, h := health(); code != http.StatusOK || h.Status != "ok" || !h.Workspace.Ready {
+		t.Fatalf("health = %d %+v", code, h)
+	}
+	os.Remove(dir)
+	if code, h := health(); code != http.StatusServiceUnavailable || h.Status != "unavailable" || h.Workspace.Error == "" {
+		t.Fatalf("health without workspace = %d %+v", code, h)
+	}
+}
+
+func TestKillGracePeriod(t *testing.T) {
+	dir := t.TempDir()
+	opts := executor.DefaultOptions()
+	m := executor.NewManager(dir, opts)
+	ts := httptest.NewServer(NewServer(m, NewConfig(dir, opts, executor.Features{})).Handler())
+	defer ts.Close()
+
+	res, err := m.Launch(context.Background(), executor.LaunchOptions{
+		Command: `trap 'echo flushed; exit 0' TERM; echo started; while :; do sleep 0.05; done`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if out, _ := m.Read(res.ID); strings.Contains(out.Stdout, "started") || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	kill := func(query string) *http.Response {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/processes/"+res.ID+query, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := kill("?grace_period_secs=soon"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad grace: %d", resp.StatusCode)
+	}
+	resp := kill("?grace_period_secs=5")
+	var status map[string]string
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if status["status"] != string(executor.StateKilled) {
+		t.Fatalf("kill: %d %v", resp.StatusCode, status)
+	}
+	out, _ := m.Read(res.ID)
+	if out.EndedBy != executor.EndedBySIGTERM || !strings.Contains(out.Stdout, "flushed") {
+		t.Fatalf("ended by %q with %q", out.EndedBy, out.Stdout)
+	}
+}
+
+func TestLaunchTemplatesAndSessions(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, err := http.Post(ts.URL+"/v2/processes", "application/json", strings.NewReader(`{"command":"true","cwd":"{{.Home}}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env ErrorEnvelope
+	json.NewDecoder(resp.Body).Decode(&env)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(env.Error.Message, "{{.SessionID}}, {{.ProcessID}}, {{.Date}}") {
+		t.Fatalf("unknown variable: %d %+v", resp.StatusCode, env.Error)
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/v2/sessions/agent-1", strings.NewReader(`{"cwd":"s/{{.SessionID}}"}`))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sess Session
+	json.NewDecoder(resp.Body).Decode(&sess)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || sess.Cwd != "s/{{.SessionID}}" {
+		t.Fatalf("put session: %d %+v", resp.StatusCode, sess)
+	}
+
+	resp, err = http.Post(ts.URL+"/v2/processes", "application/json", strings.NewReader(`{"command":"pwd","session_id":"agent-1","wait":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res executor.LaunchResult
+	json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if !strings.HasSuffix(strings.TrimSpace(res.Stdout), "/s/agent-1") {
+		t.Fatalf("session launch ran in %q", res.Stdout)
+	}
+
+	cfg, err := http.Get(ts.URL + "/v2/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c Config
+	json.NewDecoder(cfg.Body).Decode(&c)
+	cfg.Body.Close()
+	if len(c.TemplateVariables) != len(executor.TemplateVariables) {
+		t.Fatalf("config template variables: %+v", c.TemplateVariables)
+	}
+}
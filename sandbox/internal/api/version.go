@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API versions served by the router. Unprefixed paths alias v1 and are
+// deprecated.
+const (
+	APIVersionV1      = "v1"
+	APIVersionV2      = "v2"
+	APIVersionCurrent = APIVersionV2
+)
+
+// legacySunset is when unprefixed routes stop being served.
+var legacySunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+
+// ErrorEnvelope is the v2 error response body.
+type ErrorEnvelope struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes a failed request.
+type ErrorBody struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// deprecatedRoutes marks responses from unprefixed paths as deprecated and
+// points clients at the v1 equivalent.
+func deprecatedRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Deprecation", "true")
+		h.Set("Sunset", legacySunset.Format(http.TimeFormat))
+		h.Set("Link", "</"+APIVersionV1+r.URL.Path+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jsonErrors rewrites the plain-text errors written by the shared handlers
+// into the v2 JSON envelope. A handler that already wrote a JSON error is
+// left alone.
+func jsonErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &envelopeWriter{ResponseWriter: w}
+		next.ServeHTTP(ew, r)
+		ew.flush()
+	})
+}
+
+type envelopeWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *envelopeWriter) WriteHeader(code int) {
+	if code >= 400 && w.status == 0 && w.Header().Get("Content-Type") != "application/json" {
+		w.status = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *envelopeWriter) Write(b []byte) (int, error) {
+	if w.status != 0 {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *envelopeWriter) Flush() {
+	if w.status != 0 {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *envelopeWriter) flush() {
+	if w.status == 0 {
+		return
+	}
+	h := w.ResponseWriter.Header()
+	h.Del("X-Content-Type-Options")
+	h.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.status)
+	json.NewEncoder(w.ResponseWriter).Encode(ErrorEnvelope{Error: ErrorBody{
+		Status:  w.status,
+		Code:    errorCode(w.status),
+		Message: strings.TrimSpace(w.body.String()),
+	}})
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "invalid_request"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusUnprocessableEntity:
+		return "unprocessable"
+	case http.StatusNotImplemented:
+		return "not_implemented"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	default:
+		if status >= 500 {
+			return "internal"
+		}
+		return "error"
+	}
+}
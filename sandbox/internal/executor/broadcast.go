@@ -0,0 +1,247 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Live output subscribers. Each process has a broadcaster that hands every
+// write to its subscribers without ever blocking the writer: a subscriber
+// whose buffer is full misses events, and one that stays full for longer
+// than the grace period is dropped, so a stalled client cannot slow the
+// child's output path. Subscribers are bounded per process and across the
+// server.
+
+// SubscriberLimits bounds live output subscribers.
+type SubscriberLimits struct {
+	PerProcess int `json:"per_process"` // 0 for no bound
+	Total      int `json:"total"`       // across all processes; 0 for no bound
+
+	// SlowGrace is how long a subscriber's buffer may stay full before it
+	// is dropped.
+	SlowGrace time.Duration `json:"-"`
+}
+
+// DefaultSubscriberLimits allows a few dashboards per process.
+func DefaultSubscriberLimits() SubscriberLimits {
+	return SubscriberLimits{PerProcess: 8, Total: 64, SlowGrace: 5 * time.Second}
+}
+
+// subscriberBuffer is how many events a subscriber may have pending.
+const subscriberBuffer = 256
+
+// StreamEvent is one write to a process stream.
+type StreamEvent struct {
+	Stream string    `json:"stream"` // stdout, stderr, or combined
+	Data   string    `json:"data"`
+	At     time.Time `json:"at"`
+	// Skipped counts events this subscriber missed just before this one
+	// because its buffer was full.
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// Subscription receives a process's output as it is written. C is closed
+// when the process ends, the subscriber is dropped, or Close is called;
+// Reason then says which.
+type Subscription struct {
+	C <-chan StreamEvent
+
+	ch        chan StreamEvent
+	b         *broadcaster
+	fullSince time.Time // when the buffer was first found full; zero while it has room
+	skipped   int
+	reason    string
+}
+
+// Reason explains why C was closed, or is empty while it is open.
+func (s *Subscription) Reason() string {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	return s.reason
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.b.removeLocked(s, "closed")
+}
+
+// subscriberPool enforces the server-wide limit and keeps the counts
+// /stats reports.
+type subscriberPool struct {
+	limits  SubscriberLimits
+	active  atomic.Int64
+	dropped atomic.Int64
+}
+
+// reserve takes a slot under the server-wide limit.
+func (p *subscriberPool) reserve() bool {
+	for {
+		n := p.active.Load()
+		if p.limits.Total > 0 && n >= int64(p.limits.Total) {
+			return false
+		}
+		if p.active.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// broadcaster fans one process's output out to its subscribers.
+type broadcaster struct {
+	mu    sync.Mutex
+	subs  map[*Subscription]struct{}
+	ended bool
+	pool  *subscriberPool
+}
+
+func newBroadcaster(pool *subscriberPool) *broadcaster {
+	return &broadcaster{subs: make(map[*Subscription]struct{}), pool: pool}
+}
+
+// tap returns the function an output buffer calls with each write to
+// stream.
+func (b *broadcaster) tap(stream string) func([]byte) {
+	return func(p []byte) { b.publish(stream, p) }
+}
+
+// publish delivers p to every subscriber that has room, and drops those
+// that have had none for longer than the grace period. It never blocks.
+func (b *broadcaster) publish(stream string, p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.subs) == 0 {
+		return
+	}
+	now := time.Now()
+	var ev *StreamEvent // copied from p only once someone has room for it
+	for s := range b.subs {
+		// Only publish sends on s.ch, under b.mu, so a channel with room
+		// here still has it below.
+		if len(s.ch) < cap(s.ch) {
+			if ev == nil {
+				ev = &StreamEvent{Stream: stream, Data: string(p), At: now}
+			}
+			sent := *ev
+			sent.Skipped = s.skipped
+			s.ch <- sent
+			s.fullSince, s.skipped = time.Time{}, 0
+			continue
+		}
+		s.skipped++
+		if s.fullSince.IsZero() {
+			s.fullSince = now
+		} else if grace := b.pool.limits.SlowGrace; now.Sub(s.fullSince) > grace {
+			b.removeLocked(s, fmt.Sprintf("dropped: did not keep up with the output for %v", grace))
+			b.pool.dropped.Add(1)
+		}
+	}
+}
+
+// subscribe adds a subscriber within the limits.
+func (b *broadcaster) subscribe(id string) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ended {
+		return nil, errEnded
+	}
+	limits := b.pool.limits
+	if limits.PerProcess > 0 && len(b.subs) >= limits.PerProcess {
+		return nil, &LimitError{Resource: "subscribers", Limit: limits.PerProcess,
+			Message: fmt.Sprintf("process %s already has %d subscribers", id, len(b.subs))}
+	}
+	if !b.pool.reserve() {
+		return nil, &LimitError{Resource: "subscribers", Limit: limits.Total,
+			Message: fmt.Sprintf("the server already has %d subscribers", limits.Total)}
+	}
+	ch := make(chan StreamEvent, subscriberBuffer)
+	s := &Subscription{C: ch, ch: ch, b: b}
+	b.subs[s] = struct{}{}
+	return s, nil
+}
+
+// errEnded is returned by subscribe once the process has ended.
+var errEnded = errors.New("process has ended")
+
+// removeLocked ends s with reason. The caller holds b.mu.
+func (b *broadcaster) removeLocked(s *Subscription, reason string) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	s.reason = reason
+	close(s.ch)
+	b.pool.active.Add(-1)
+}
+
+// end closes every subscription once the process has ended; events
+// already delivered are still read first.
+func (b *broadcaster) end(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ended = true
+	for s := range b.subs {
+		b.removeLocked(s, reason)
+	}
+}
+
+func (b *broadcaster) count() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// attachOutputs publishes the writes to proc's buffers to its subscribers.
+func (m *Manager) attachOutputs(proc *Process) {
+	proc.subs = newBroadcaster(m.subscribers)
+	if proc.combined != nil {
+		proc.combined.tap = proc.subs.tap("combined")
+		return
+	}
+	proc.stdout.tap = proc.subs.tap("stdout")
+	proc.stderr.tap = proc.subs.tap("stderr")
+}
+
+// Subscribe follows a running process's output from now on. It fails with
+// a LimitError when the process or the server has as many subscribers as
+// allowed, and with a StateError once the process has ended.
+func (m *Manager) Subscribe(id string) (*Subscription, error) {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+	s, err := proc.subs.subscribe(id)
+	if err == errEnded {
+		proc.mu.RLock()
+		state := proc.State
+		proc.mu.RUnlock()
+		return nil, &StateError{ID: id, State: state, Message: "only a running process can be followed; read its output instead"}
+	}
+	return s, err
+}
+
+// SubscriberStats counts live output subscribers.
+type SubscriberStats struct {
+	Active  int64            `json:"active"`
+	Dropped int64            `json:"dropped"` // slow subscribers dropped since start
+	Limits  SubscriberLimits `json:"limits"`
+}
+
+// Subscribers reports the subscriber counts and limits.
+func (m *Manager) Subscribers() SubscriberStats {
+	return SubscriberStats{
+		Active:  m.subscribers.active.Load(),
+		Dropped: m.subscribers.dropped.Load(),
+		Limits:  m.subscribers.limits,
+	}
+}
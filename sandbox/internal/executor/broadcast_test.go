@@ -0,0 +1,168 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscriberLimits(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Subscribers = SubscriberLimits{PerProcess: 2, Total: 3, SlowGrace: time.Second}
+	m := NewManager(t.TempDir(), opts)
+	launch := func() string {
+		res, err := m.Launch(context.Background(), LaunchOptions{Command: "sleep 5"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { m.Kill(res.ID) })
+		return res.ID
+	}
+	a, b := launch(), launch()
+
+	var lerr *LimitError
+	subA1, err := m.Subscribe(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Subscribe(a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Subscribe(a); !errors.As(err, &lerr) || lerr.Limit != 2 {
+		t.Fatalf("third subscriber on one process: %v", err)
+	}
+	if _, err := m.Subscribe(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Subscribe(b); !errors.As(err, &lerr) || lerr.Limit != 3 {
+		t.Fatalf("fourth subscriber on the server: %v", err)
+	}
+	for _, p := range m.List() {
+		want := map[string]int{a: 2, b: 1}[p.ID]
+		if p.Subscribers != want {
+			t.Fatalf("%s lists %d subscribers, want %d", p.ID, p.Subscribers, want)
+		}
+	}
+
+	subA1.Close()
+	subA1.Close()
+	if _, err := m.Subscribe(b); err != nil {
+		t.Fatalf("after a close: %v", err)
+	}
+	if got := m.Subscribers(); got.Active != 3 {
+		t.Fatalf("active subscribers: %+v", got)
+	}
+}
+
+func TestSubscriptionFollowsOutputUntilExit(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "sleep 0.2; echo out; echo err >&2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := m.Subscribe(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	timeout := time.After(3 * time.Second)
+	for done := false; !done; {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				done = true
+				break
+			}
+			got[ev.Stream] += ev.Data
+		case <-timeout:
+			t.Fatal("subscription did not end with the process")
+		}
+	}
+	if got["stdout"] != "out\n" || got["stderr"] != "err\n" || sub.Reason() != "process exited" {
+		t.Fatalf("got %q, reason %q", got, sub.Reason())
+	}
+	if n := m.Subscribers().Active; n != 0 {
+		t.Fatalf("%d subscribers left after exit", n)
+	}
+	var serr *StateError
+	if _, err := m.Subscribe(res.ID); !errors.As(err, &serr) {
+		t.Fatalf("subscribing to an ended process: %v", err)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	pool := &subscriberPool{limits: SubscriberLimits{SlowGrace: 50 * time.Millisecond}}
+	b := newBroadcaster(pool)
+	slow, _ := b.subscribe("p")
+	fast, _ := b.subscribe("p")
+
+	var fastGot int
+	drain := func() {
+		for {
+			select {
+			case <-fast.C:
+				fastGot++
+			default:
+				return
+			}
+		}
+	}
+	for i := 0; i < subscriberBuffer+10; i++ {
+		b.publish("stdout", []byte("x"))
+		drain()
+	}
+	if slow.Reason() != "" {
+		t.Fatalf("dropped within the grace period: %s", slow.Reason())
+	}
+	time.Sleep(60 * time.Millisecond)
+	b.publish("stdout", []byte("x"))
+	drain()
+
+	if !strings.HasPrefix(slow.Reason(), "dropped") || pool.dropped.Load() != 1 {
+		t.Fatalf("slow subscriber: reason %q, dropped %d", slow.Reason(), pool.dropped.Load())
+	}
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("slow subscriber kept %d buffered events, want %d", n, subscriberBuffer)
+	}
+	if fastGot != subscriberBuffer+11 || fast.Reason() != "" {
+		t.Fatalf("fast subscriber got %d events, reason %q", fastGot, fast.Reason())
+	}
+	if pool.active.Load() != 1 {
+		t.Fatalf("active %d after the drop", pool.active.Load())
+	}
+}
+
+// BenchmarkOutputWithStalledSubscriber compares output throughput with no
+// subscriber against one that never reads, which must not slow the
+// writer.
+func BenchmarkOutputWithStalledSubscriber(b *testing.B) {
+	chunk := []byte(strings.Repeat("x", 4096))
+	for _, stalled := range []bool{false, true} {
+		name := "none"
+		if stalled {
+			name = "stalled"
+		}
+		b.Run(name, func(b *testing.B) {
+			pool := &subscriberPool{limits: SubscriberLimits{SlowGrace: time.Hour}}
+			cast := newBroadcaster(pool)
+			out := newOutputBuffer(DefaultMaxOutputBytes)
+			out.tap = cast.tap("stdout")
+			if stalled {
+				if _, err := cast.subscribe("bench"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.SetBytes(int64(len(chunk)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				out.Write(chunk)
+			}
+		})
+	}
+}
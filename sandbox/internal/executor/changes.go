@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// changeFeed is a version counter bumped on every process state
+// transition. Waiters block on a channel that is closed and replaced at
+// each bump, so any number of them wake without polling.
+type changeFeed struct {
+	mu      sync.Mutex
+	version uint64
+	changed chan struct{}
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{changed: make(chan struct{})}
+}
+
+func (f *changeFeed) bump() {
+	f.mu.Lock()
+	f.version++
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.mu.Unlock()
+}
+
+func (f *changeFeed) current() (uint64, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.version, f.changed
+}
+
+// Version returns the current process list version. It changes whenever a
+// process is launched or leaves the running state.
+func (m *Manager) Version() uint64 {
+	v, _ := m.changes.current()
+	return v
+}
+
+// Changed returns the current version and a channel that is closed once
+// the version moves past it.
+func (m *Manager) Changed() (uint64, <-chan struct{}) {
+	return m.changes.current()
+}
+
+// WaitForChange blocks until the version differs from since, ctx is done,
+// or timeout elapses, and returns the version at that point.
+func (m *Manager) WaitForChange(ctx context.Context, since uint64, timeout time.Duration) uint64 {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		v, changed := m.changes.current()
+		if v != since {
+			return v
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return v
+		case <-ctx.Done():
+			return v
+		}
+	}
+}
+
+// ETag identifies a process list version. It includes the manager's start
+// time so a tag from before a restart never matches a fresh counter.
+func (m *Manager) ETag(version uint64) string {
+	return fmt.Sprintf(`"%x-%d"`, m.epoch, version)
+}
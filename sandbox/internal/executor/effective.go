@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"os/exec"
+	"time"
+)
+
+// Effective is what a launch actually executed, captured from its exec.Cmd
+// once started. The command alone does not say which shell ran it, where,
+// or under which limits.
+type Effective struct {
+	// Argv is the argument vector given to exec. Under a security profile
+	// it starts with the server binary acting as the helper, which then
+	// execs the shell.
+	Argv []string `json:"argv"`
+	Cwd  string   `json:"cwd"`
+	// Interpreter is the resolved path of the shell running the command.
+	Interpreter string `json:"interpreter"`
+	// Env names the variables the launch set on top of the server's
+	// environment. Values are left out; they may hold credentials.
+	Env []string `json:"env,omitempty"`
+	// UID and GID are set when the process runs with other credentials
+	// than the server's.
+	UID *uint32 `json:"uid,omitempty"`
+	GID *uint32 `json:"gid,omitempty"`
+
+	Limits EffectiveLimits `json:"limits"`
+}
+
+// EffectiveLimits are the limits a process was started under.
+type EffectiveLimits struct {
+	Nice            int           `json:"nice"`
+	IONiceClass     string        `json:"ionice_class,omitempty"`
+	MaxOpenFiles    int           `json:"max_open_files,omitempty"` // zero when the server's limit was inherited
+	Timeout         time.Duration `json:"timeout,omitempty"`
+	GracePeriod     time.Duration `json:"grace_period,omitempty"`
+	SecurityProfile string        `json:"security_profile,omitempty"`
+}
+
+// captureEffective records how proc was started, from its exec.Cmd and the
+// plan that built it. Launch calls it once the limits are applied.
+func captureEffective(proc *Process, plan *launchPlan) *Effective {
+	cmd := proc.cmd
+	eff := &Effective{
+		Argv:        append([]string(nil), cmd.Args...),
+		Cwd:         cmd.Dir,
+		Interpreter: cmd.Path,
+		Env:         proc.envNames,
+		Limits: EffectiveLimits{
+			Nice:            proc.Nice,
+			IONiceClass:     proc.IONiceClass,
+			MaxOpenFiles:    proc.MaxOpenFiles,
+			Timeout:         plan.opts.Timeout,
+			GracePeriod:     plan.opts.GracePeriod,
+			SecurityProfile: proc.SecurityProfile,
+		},
+	}
+	if plan.profile != nil {
+		// cmd.Path is the helper; it looks the shell up as exec would.
+		if path, err := exec.LookPath("sh"); err == nil {
+			eff.Interpreter = path
+		}
+	}
+	if attr := cmd.SysProcAttr; attr != nil && attr.Credential != nil {
+		uid, gid := attr.Credential.Uid, attr.Credential.Gid
+		eff.UID, eff.GID = &uid, &gid
+	}
+	return eff
+}
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEffectiveMatchesCmd(t *testing.T) {
+	ws := t.TempDir()
+	if err := os.Mkdir(ws+"/sub", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.SecurityProfiles = []SecurityProfile{{Name: "plain"}}
+	m := NewManager(ws, opts)
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nice, files := 5, 64
+
+	cases := map[string]LaunchOptions{
+		"plain":   {Command: "true"},
+		"cwd+env": {Command: "true", Cwd: "sub", Env: map[string]string{"B": "2", "A": "{{.ProcessID}}"}},
+		"limits":  {Command: "true", Nice: &nice, MaxOpenFiles: &files, Timeout: time.Minute, GracePeriod: time.Second, MergeOutput: true},
+		"profile": {Command: "true", SecurityProfile: "plain"},
+	}
+	for name, o := range cases {
+		o.Wait = true
+		res, err := m.Launch(context.Background(), o)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		m.mu.RLock()
+		proc := m.processes[res.ID]
+		m.mu.RUnlock()
+		eff, cmd := proc.effective, proc.cmd
+
+		if !reflect.DeepEqual(eff.Argv, cmd.Args) || eff.Cwd != cmd.Dir {
+			t.Errorf("%s: effective argv %q in %s, cmd ran %q in %s", name, eff.Argv, eff.Cwd, cmd.Args, cmd.Dir)
+		}
+		if want := cmd.Path; o.SecurityProfile != "" {
+			if eff.Interpreter != sh || eff.Argv[0] == "sh" {
+				t.Errorf("%s: interpreter %s behind %s, want %s behind the helper", name, eff.Interpreter, eff.Argv[0], sh)
+			}
+		} else if eff.Interpreter != want {
+			t.Errorf("%s: interpreter %s, want %s", name, eff.Interpreter, want)
+		}
+		var set []string
+		for _, kv := range cmd.Env[len(cmd.Env)-len(o.Env):] {
+			set = append(set, kv[:strings.IndexByte(kv, '=')])
+		}
+		if !reflect.DeepEqual(eff.Env, set) {
+			t.Errorf("%s: effective env %q, cmd set %q", name, eff.Env, set)
+		}
+		if eff.UID != nil || eff.GID != nil {
+			t.Errorf("%s: credentials recorded for a process that kept the server's", name)
+		}
+		if l := eff.Limits; l.Nice != proc.Nice || l.MaxOpenFiles != proc.MaxOpenFiles || l.Timeout != o.Timeout ||
+			l.GracePeriod != o.GracePeriod || l.SecurityProfile != o.SecurityProfile {
+			t.Errorf("%s: limits %+v for launch %+v", name, l, o)
+		}
+
+		// Read and the transcript report the same record.
+		read, err := m.Read(res.ID)
+		if err != nil || read.Effective != eff {
+			t.Errorf("%s: read effective %+v, %v", name, read.Effective, err)
+		}
+		events, err := m.Transcript(res.ID)
+		if err != nil || events[0].Effective != eff {
+			t.Errorf("%s: transcript effective %+v, %v", name, events[0].Effective, err)
+		}
+	}
+}
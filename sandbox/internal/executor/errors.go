@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"syscall"
+)
+
+// ValidationError reports a launch request that violates server policy.
+// API layers map it to a client error rather than a server failure.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+func invalid(field, format string, args ...interface{}) error {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// ExecError reports that the kernel refused to start a validated command,
+// e.g. because the argument list was too long or the shell or working
+// directory could not be found or entered.
+type ExecError struct {
+	Cause   string `json:"cause"`
+	Message string `json:"message"`
+	Err     error  `json:"-"`
+}
+
+func (e *ExecError) Error() string {
+	return e.Cause + ": " + e.Message
+}
+
+func (e *ExecError) Unwrap() error { return e.Err }
+
+// classifyStartError turns the errno behind a failed exec into an
+// ExecError; other failures are returned unchanged.
+func classifyStartError(err error) error {
+	var msg string
+	switch {
+	case errors.Is(err, syscall.E2BIG):
+		msg = "argument list or environment too long for exec"
+	case errors.Is(err, syscall.ENOENT):
+		msg = "shell or working directory does not exist"
+	case errors.Is(err, syscall.EACCES):
+		msg = "permission denied executing the shell or entering the working directory"
+	default:
+		return fmt.Errorf("start: %w", err)
+	}
+	var errno syscall.Errno
+	errors.As(err, &errno)
+	return &ExecError{Cause: errnoName(errno), Message: msg + " (" + err.Error() + ")", Err: err}
+}
+
+// StateError reports an operation the process's current state does not
+// allow, such as pausing one that has exited or writing to one that is
+// paused. API layers map it to a conflict.
+type StateError struct {
+	ID      string       `json:"id"`
+	State   ProcessState `json:"state"`
+	Message string       `json:"message"`
+}
+
+func (e *StateError) Error() string {
+	return "process " + e.ID + " is " + string(e.State) + ": " + e.Message
+}
+
+// LimitError reports a request refused because a server capacity, such as
+// the number of output subscribers, is in use. API layers map it to 429.
+type LimitError struct {
+	Resource string `json:"resource"`
+	Limit    int    `json:"limit"`
+	Message  string `json:"message"`
+}
+
+func (e *LimitError) Error() string {
+	return e.Message + " (limit " + strconv.Itoa(e.Limit) + ")"
+}
+
+// UnsupportedError reports a launch that needs an isolation feature this
+// host cannot provide.
+type UnsupportedError struct {
+	Feature string `json:"feature"`
+	Message string `json:"message"`
+}
+
+func (e *UnsupportedError) Error() string {
+	return e.Message
+}
+
+// MountUnavailableError reports a launch into the attached redis-fs mount
+// while that mount is down, so the caller can tell a dead filesystem from
+// a failing command.
+type MountUnavailableError struct {
+	Mountpoint string `json:"mountpoint"`
+	Reason     string `json:"reason"`
+}
+
+func (e *MountUnavailableError) Error() string {
+	return "redis-fs mount at " + e.Mountpoint + " is unavailable: " + e.Reason
+}
+
+func errnoName(errno syscall.Errno) string {
+	switch errno {
+	case syscall.E2BIG:
+		return "E2BIG"
+	case syscall.ENOENT:
+		return "ENOENT"
+	case syscall.EACCES:
+		return "EACCES"
+	}
+	return errno.Error()
+}
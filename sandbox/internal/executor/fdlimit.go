@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"strings"
+	"syscall"
+)
+
+// FDPolicy bounds the open file limit (RLIMIT_NOFILE) of launched
+// processes. Children would otherwise inherit the server's own limit,
+// which it raises for itself, so one leaky command could exhaust the
+// host's file table.
+type FDPolicy struct {
+	Default int `json:"default"` // applied when a launch does not ask; 0 inherits the server's limit
+	Max     int `json:"max"`     // highest a launch may request; 0 for no bound
+}
+
+// DefaultFDPolicy gives launches the traditional 1024 descriptors and
+// lets them ask for more.
+func DefaultFDPolicy() FDPolicy {
+	return FDPolicy{Default: 1024, Max: 65536}
+}
+
+// minOpenFiles leaves room for the standard streams and the shell's own
+// descriptors.
+const minOpenFiles = 8
+
+// LimitOpenFiles is reported in limit_hits when a process failed after
+// running out of file descriptors.
+const LimitOpenFiles = "open_files"
+
+// resolveOpenFiles validates the requested limit against the policy and
+// returns the one to apply; 0 leaves the inherited limit alone.
+func (p FDPolicy) resolveOpenFiles(opts LaunchOptions) (int, error) {
+	if opts.MaxOpenFiles == nil {
+		return p.Default, nil
+	}
+	n := *opts.MaxOpenFiles
+	if n < minOpenFiles {
+		return 0, invalid("max_open_files", "must be at least %d", minOpenFiles)
+	}
+	if p.Max > 0 && n > p.Max {
+		return 0, invalid("max_open_files", "must be at most %d on this server", p.Max)
+	}
+	return n, nil
+}
+
+// RaiseFDLimit lifts the server's soft open file limit to its hard limit
+// and returns the resulting pair.
+func RaiseFDLimit() (soft, hard uint64, err error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, 0, err
+	}
+	if lim.Cur < lim.Max {
+		raised := lim
+		raised.Cur = raised.Max
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised); err != nil {
+			return lim.Cur, lim.Max, err
+		}
+		lim = raised
+	}
+	return lim.Cur, lim.Max, nil
+}
+
+// ranOutOfFiles reports whether stderr shows EMFILE, the only trace a
+// process leaves of hitting its descriptor limit.
+func ranOutOfFiles(stderr string) bool {
+	return strings.Contains(strings.ToLower(stderr), "too many open files")
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func prlimitNofile(pid int, newLimit, oldLimit *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), syscall.RLIMIT_NOFILE,
+		uintptr(unsafe.Pointer(newLimit)), uintptr(unsafe.Pointer(oldLimit)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// applyOpenFiles sets both the soft and hard open file limit of a freshly
+// started process to n, so it cannot raise its own limit back. A limit
+// above what the process already has is capped there, since raising a
+// hard limit needs privilege. It returns the limit applied.
+func applyOpenFiles(pid, n int) (int, error) {
+	var cur syscall.Rlimit
+	if err := prlimitNofile(pid, nil, &cur); err != nil {
+		return 0, fmt.Errorf("prlimit: %w", err)
+	}
+	lim := uint64(n)
+	if lim > cur.Max {
+		lim = cur.Max
+	}
+	if err := prlimitNofile(pid, &syscall.Rlimit{Cur: lim, Max: lim}, nil); err != nil {
+		return 0, fmt.Errorf("prlimit: %w", err)
+	}
+	return int(lim), nil
+}
+
+// countOpenFDs returns how many descriptors pid has open.
+func countOpenFDs(pid int) (int, error) {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
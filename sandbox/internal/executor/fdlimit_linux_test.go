@@ -0,0 +1,109 @@
+//go:build linux
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestOpenFilesHelper is not a test: launches re-execute the test binary
+// with SANDBOX_FD_HELPER set to run it as a command that opens files
+// until it cannot.
+func TestOpenFilesHelper(t *testing.T) {
+	if os.Getenv("SANDBOX_FD_HELPER") == "" {
+		t.Skip("helper process only")
+	}
+	var lim syscall.Rlimit
+	syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim)
+	last := -1
+	for i := 0; i < 1<<16; i++ {
+		fd, err := syscall.Open("/dev/null", syscall.O_RDONLY, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "limit %d/%d, last fd %d: %v\n", lim.Cur, lim.Max, last, err)
+			os.Exit(1)
+		}
+		last = fd
+	}
+	os.Exit(0)
+}
+
+func fdHelperCommand(t *testing.T) string {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("SANDBOX_FD_HELPER=1 exec '%s' -test.run='^TestOpenFilesHelper$'", self)
+}
+
+func TestLaunchLimitsOpenFiles(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	limit := 32
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: fdHelperCommand(t), MaxOpenFiles: &limit, Wait: true})
+	if err != nil {
+		t.Fatalf("launch: %v", err)
+	}
+	// Descriptors are allocated lowest first, so the last to succeed is
+	// the one just below the limit.
+	want := fmt.Sprintf("limit %d/%d, last fd %d: too many open files", limit, limit, limit-1)
+	if res.ExitCode != 1 || !strings.Contains(res.Stderr, want) {
+		t.Fatalf("exit %d, stderr %q; want %q", res.ExitCode, res.Stderr, want)
+	}
+
+	read, err := m.Read(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.LimitHits) != 1 || read.LimitHits[0] != LimitOpenFiles {
+		t.Fatalf("limit hits %v, want [%s]", read.LimitHits, LimitOpenFiles)
+	}
+	for _, p := range m.List() {
+		if p.ID == res.ID && p.MaxOpenFiles != limit {
+			t.Fatalf("ProcessInfo.MaxOpenFiles = %d, want %d", p.MaxOpenFiles, limit)
+		}
+	}
+}
+
+func TestLaunchAppliesDefaultOpenFiles(t *testing.T) {
+	opts := DefaultOptions()
+	opts.OpenFiles.Default = 48
+	m := NewManager(t.TempDir(), opts)
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "exec sleep 5"})
+	if err != nil {
+		t.Fatalf("launch: %v", err)
+	}
+	defer m.Kill(res.ID)
+
+	var lim syscall.Rlimit
+	if err := prlimitNofile(res.PID, nil, &lim); err != nil {
+		t.Fatal(err)
+	}
+	if lim.Cur != 48 || lim.Max != 48 {
+		t.Fatalf("limit %d/%d, want 48/48", lim.Cur, lim.Max)
+	}
+
+	m.sweep()
+	for _, p := range m.List() {
+		// stdin, stdout and stderr at least.
+		if p.ID == res.ID && (p.OpenFDs == nil || *p.OpenFDs < 3) {
+			t.Fatalf("open fds %v after a sweep", p.OpenFDs)
+		}
+	}
+}
+
+func TestLaunchRejectsOpenFilesOutsidePolicy(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	for _, n := range []int{1, DefaultFDPolicy().Max + 1} {
+		limit := n
+		_, err := m.Launch(context.Background(), LaunchOptions{Command: "true", MaxOpenFiles: &limit})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Field != "max_open_files" {
+			t.Fatalf("max_open_files %d: err = %v, want ValidationError", n, err)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package executor
+
+import "errors"
+
+// applyOpenFiles leaves the inherited limit alone: without prlimit there
+// is no way to set another process's limit.
+func applyOpenFiles(pid, n int) (int, error) {
+	return 0, nil
+}
+
+func countOpenFDs(pid int) (int, error) {
+	return 0, errors.New("descriptor counting is not supported on this platform")
+}
@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Features reports optional isolation capabilities detected at startup.
+type Features struct {
+	Cgroups          bool `json:"cgroups"`
+	IONice           bool `json:"ionice"`
+	PrivilegeDrop    bool `json:"privilege_drop"`
+	NetworkIsolation bool `json:"network_isolation"`
+	PTY              bool `json:"pty"`
+	Landlock         bool `json:"landlock"`
+	Seccomp          bool `json:"seccomp"`
+}
+
+// FeatureProbe describes where to look for each capability and which ones
+// the operator has switched off.
+type FeatureProbe struct {
+	CgroupRoot string
+	NetNSPath  string
+	EUID       int
+
+	DisableCgroups          bool
+	DisablePrivilegeDrop    bool
+	DisableNetworkIsolation bool
+}
+
+// DefaultFeatureProbe inspects the running host.
+func DefaultFeatureProbe() FeatureProbe {
+	return FeatureProbe{
+		CgroupRoot: "/sys/fs/cgroup",
+		NetNSPath:  "/proc/self/ns/net",
+		EUID:       os.Geteuid(),
+	}
+}
+
+// DetectFeatures probes the host. A feature is reported only when it is
+// both available and not disabled.
+func DetectFeatures(p FeatureProbe) Features {
+	f := Features{IONice: ioniceSupported, Landlock: landlockSupported(), Seccomp: seccompSupported()}
+
+	if !p.DisableCgroups && p.CgroupRoot != "" {
+		controllers := filepath.Join(p.CgroupRoot, "cgroup.controllers")
+		if _, err := os.Stat(controllers); err == nil {
+			f.Cgroups = syscall.Access(p.CgroupRoot, 2 /* W_OK */) == nil
+		}
+	}
+	if !p.DisablePrivilegeDrop {
+		f.PrivilegeDrop = p.EUID == 0
+	}
+	if !p.DisableNetworkIsolation && p.EUID == 0 && p.NetNSPath != "" {
+		_, err := os.Stat(p.NetNSPath)
+		f.NetworkIsolation = err == nil
+	}
+	return f
+}
@@ -0,0 +1,40 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectFeaturesHonorsProbesAndSwitches(t *testing.T) {
+	cg := t.TempDir()
+	if err := os.WriteFile(filepath.Join(cg, "cgroup.controllers"), []byte("cpu memory\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	netns := filepath.Join(t.TempDir(), "net")
+	if err := os.WriteFile(netns, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	probe := FeatureProbe{CgroupRoot: cg, NetNSPath: netns, EUID: 0}
+	f := DetectFeatures(probe)
+	if !f.Cgroups || !f.PrivilegeDrop || !f.NetworkIsolation {
+		t.Fatalf("all features available, got %+v", f)
+	}
+
+	probe.DisableCgroups = true
+	probe.DisablePrivilegeDrop = true
+	probe.DisableNetworkIsolation = true
+	f = DetectFeatures(probe)
+	if f.Cgroups || f.PrivilegeDrop || f.NetworkIsolation {
+		t.Fatalf("all features disabled, got %+v", f)
+	}
+
+	f = DetectFeatures(FeatureProbe{CgroupRoot: t.TempDir(), NetNSPath: netns, EUID: 1000})
+	if f.Cgroups {
+		t.Fatal("cgroups reported without cgroup.controllers")
+	}
+	if f.PrivilegeDrop || f.NetworkIsolation {
+		t.Fatalf("unprivileged server reported privileged features: %+v", f)
+	}
+}
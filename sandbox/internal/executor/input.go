@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxInputRecords bounds the input history by count; the retained input
+// bytes are additionally bounded by the per-stream output cap.
+const maxInputRecords = 10000
+
+// WriteOptions adjusts how input is delivered to a process.
+type WriteOptions struct {
+	// Line appends a trailing newline when the input lacks one.
+	Line bool
+	// Tag is an opaque client label recorded with the write.
+	Tag string
+}
+
+// InputRecord describes one write to a process's stdin.
+type InputRecord struct {
+	Seq   int       `json:"seq"`
+	At    time.Time `json:"at"`
+	Bytes int       `json:"bytes"`
+	Tag   string    `json:"tag,omitempty"`
+	Data  string    `json:"data"`
+}
+
+// InputHistory is the retained stdin transcript of a process.
+type InputHistory struct {
+	ID      string        `json:"id"`
+	Inputs  []InputRecord `json:"inputs"`
+	Dropped int           `json:"dropped,omitempty"`
+}
+
+// inputLog is guarded by the owning Process's mutex.
+type inputLog struct {
+	records []InputRecord
+	bytes   int
+	next    int
+	dropped int
+}
+
+func (l *inputLog) add(rec InputRecord, maxBytes int) InputRecord {
+	l.next++
+	rec.Seq = l.next
+	l.records = append(l.records, rec)
+	l.bytes += len(rec.Data)
+	for len(l.records) > 1 && (len(l.records) > maxInputRecords || (maxBytes > 0 && l.bytes > maxBytes)) {
+		l.bytes -= len(l.records[0].Data)
+		l.records[0] = InputRecord{}
+		l.records = l.records[1:]
+		l.dropped++
+	}
+	return rec
+}
+
+// WriteInput sends input to a process's stdin and records it in the
+// process's input history.
+func (m *Manager) WriteInput(id, input string, opts WriteOptions) (*InputRecord, error) {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+
+	if opts.Line && !strings.HasSuffix(input, "\n") {
+		input += "\n"
+	}
+
+	proc.mu.RLock()
+	stdin := proc.stdin
+	state := proc.State
+	proc.mu.RUnlock()
+
+	if state == StatePaused {
+		return nil, &StateError{ID: id, State: state, Message: "resume it before writing to stdin"}
+	}
+	if state != StateRunning {
+		return nil, fmt.Errorf("process %s is not running", id)
+	}
+	if stdin == nil {
+		return nil, fmt.Errorf("process %s stdin not open", id)
+	}
+
+	// Hold the write lock across the write so history order matches the
+	// order bytes reached the pipe. The time is taken before writing so
+	// the record never postdates output the input provoked.
+	proc.inputMu.Lock()
+	defer proc.inputMu.Unlock()
+	at := time.Now()
+	if _, err := stdin.Write([]byte(input)); err != nil {
+		return nil, err
+	}
+
+	proc.mu.Lock()
+	rec := proc.inputs.add(InputRecord{At: at, Bytes: len(input), Tag: opts.Tag, Data: input}, m.opts.MaxOutputBytes)
+	proc.mu.Unlock()
+	return &rec, nil
+}
+
+// Inputs returns the retained input history of a process.
+func (m *Manager) Inputs(id string) (*InputHistory, error) {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+
+	proc.mu.RLock()
+	defer proc.mu.RUnlock()
+	return &InputHistory{
+		ID:      id,
+		Inputs:  append([]InputRecord{}, proc.inputs.records...),
+		Dropped: proc.inputs.dropped,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteInputLineModeAndHistory(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "cat", KeepStdinOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Kill(res.ID)
+
+	writes := []struct {
+		input string
+		opts  WriteOptions
+	}{
+		{"one", WriteOptions{Line: true, Tag: "first"}},
+		{"two\n", WriteOptions{Line: true}},
+		{"thr", WriteOptions{}},
+		{"ee", WriteOptions{Line: true}},
+	}
+	for _, w := range writes {
+		if _, err := m.WriteInput(res.ID, w.input, w.opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		out, _ := m.Read(res.ID)
+		if out.Stdout == "one\ntwo\nthree\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stdout = %q", out.Stdout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	h, err := m.Inputs(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Inputs) != 4 || h.Inputs[0].Tag != "first" || h.Inputs[0].Data != "one\n" ||
+		h.Inputs[1].Bytes != 4 || h.Inputs[2].Data != "thr" || h.Inputs[3].Seq != 4 {
+		t.Fatalf("history %+v", h.Inputs)
+	}
+}
+
+func TestInputLogCapsByBytesAndCount(t *testing.T) {
+	var l inputLog
+	for i := 0; i < 5; i++ {
+		l.add(InputRecord{Data: strings.Repeat("x", 4)}, 10)
+	}
+	if len(l.records) != 2 || l.bytes != 8 || l.dropped != 3 || l.records[0].Seq != 4 {
+		t.Fatalf("byte cap: %d records, %d bytes, %d dropped, first seq %d",
+			len(l.records), l.bytes, l.dropped, l.records[0].Seq)
+	}
+
+	// A single oversized write is still kept so the history is never empty
+	// after a write.
+	l.add(InputRecord{Data: strings.Repeat("y", 50)}, 10)
+	if len(l.records) != 1 || l.records[0].Seq != 6 {
+		t.Fatalf("oversized write: %+v", l.records)
+	}
+
+	var unbounded inputLog
+	for i := 0; i < maxInputRecords+5; i++ {
+		unbounded.add(InputRecord{Data: "z"}, 0)
+	}
+	if len(unbounded.records) != maxInputRecords || unbounded.dropped != 5 {
+		t.Fatalf("count cap: %d records, %d dropped", len(unbounded.records), unbounded.dropped)
+	}
+}
@@ -0,0 +1,135 @@
+package executor
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExitClass buckets how a process ended.
+type ExitClass string
+
+const (
+	ExitOK      ExitClass = "ok"
+	ExitNonzero ExitClass = "nonzero"
+	ExitTimeout ExitClass = "timeout"
+	ExitKilled  ExitClass = "killed"
+	ExitLost    ExitClass = "lost"
+
+	// ExitSignaled is a process ended by a signal the sandbox did not
+	// send; ExitOOM one the kernel's OOM killer ended.
+	ExitSignaled ExitClass = "signaled"
+	ExitOOM      ExitClass = "oom"
+)
+
+// ExitClasses lists every class, so exporters can report zeros.
+var ExitClasses = []ExitClass{ExitOK, ExitNonzero, ExitTimeout, ExitKilled, ExitLost, ExitSignaled, ExitOOM}
+
+// ProcessStates lists every state a process can be in.
+var ProcessStates = []ProcessState{StateRunning, StatePaused, StateExited, StateKilled, StateTimedOut, StateLost}
+
+// DurationBuckets are the upper bounds, in seconds, of the process
+// duration histogram.
+var DurationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+// Counters are totals since the Manager was created.
+type Counters struct {
+	Launches    int64               `json:"launches"`
+	Exits       map[ExitClass]int64 `json:"exits"`
+	OutputBytes int64               `json:"output_bytes"`
+}
+
+// Histogram is a cumulative histogram over DurationBuckets: Buckets[i]
+// counts observations no greater than DurationBuckets[i].
+type Histogram struct {
+	Buckets []int64 `json:"buckets"`
+	Count   int64   `json:"count"`
+	Sum     float64 `json:"sum"`
+}
+
+// MetricsSnapshot is a consistent copy of the Manager's counters and
+// process table, safe to format without holding any lock.
+type MetricsSnapshot struct {
+	States    map[ProcessState]int
+	Counters  Counters
+	Durations map[ExitClass]Histogram // seconds from start to end, by how the process ended
+}
+
+// managerStats accumulates the counters behind /stats and /metrics.
+type managerStats struct {
+	outputBytes atomic.Int64 // fed by every process's output buffers
+
+	mu        sync.Mutex
+	launches  int64
+	exits     map[ExitClass]int64
+	durations map[ExitClass]*Histogram
+}
+
+func newManagerStats() *managerStats {
+	return &managerStats{exits: make(map[ExitClass]int64), durations: make(map[ExitClass]*Histogram)}
+}
+
+func (s *managerStats) launched() {
+	s.mu.Lock()
+	s.launches++
+	s.mu.Unlock()
+}
+
+func (s *managerStats) exited(class ExitClass, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exits[class]++
+	h := s.durations[class]
+	if h == nil {
+		h = &Histogram{Buckets: make([]int64, len(DurationBuckets))}
+		s.durations[class] = h
+	}
+	secs := d.Seconds()
+	for i, le := range DurationBuckets {
+		if secs <= le {
+			h.Buckets[i]++
+		}
+	}
+	h.Count++
+	h.Sum += secs
+}
+
+// newOutput returns an output buffer that counts what it receives toward
+// the Manager's output total.
+func (m *Manager) newOutput() *outputBuffer {
+	b := newOutputBuffer(m.opts.MaxOutputBytes)
+	b.counter = &m.stats.outputBytes
+	return b
+}
+
+// Metrics snapshots the process table and counters. Locks are held only
+// long enough to copy; callers format the result at leisure.
+func (m *Manager) Metrics() MetricsSnapshot {
+	snap := MetricsSnapshot{States: make(map[ProcessState]int, len(ProcessStates))}
+
+	m.mu.RLock()
+	procs := make([]*Process, 0, len(m.processes))
+	for _, p := range m.processes {
+		procs = append(procs, p)
+	}
+	m.mu.RUnlock()
+	for _, p := range procs {
+		p.mu.RLock()
+		snap.States[p.State]++
+		p.mu.RUnlock()
+	}
+
+	s := m.stats
+	s.mu.Lock()
+	snap.Counters = Counters{Launches: s.launches, Exits: make(map[ExitClass]int64, len(s.exits))}
+	for c, n := range s.exits {
+		snap.Counters.Exits[c] = n
+	}
+	snap.Durations = make(map[ExitClass]Histogram, len(s.durations))
+	for c, h := range s.durations {
+		snap.Durations[c] = Histogram{Buckets: append([]int64(nil), h.Buckets...), Count: h.Count, Sum: h.Sum}
+	}
+	s.mu.Unlock()
+	snap.Counters.OutputBytes = s.outputBytes.Load()
+	return snap
+}
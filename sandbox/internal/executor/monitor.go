@@ -8,46 +8,139 @@ import (
 	"time"
 )
 
-// monitor watches a process and updates its state when it exits.
+// monitor watches a process and updates its state when it exits. Time
+// the process spends paused does not count toward its timeout.
 func (m *Manager) monitor(proc *Process, timeout time.Duration) {
-	defer close(proc.done)
+	defer m.changes.bump()
+	defer proc.finish()
+	defer func() {
+		proc.mu.Lock()
+		proc.monitored = false
+		proc.mu.Unlock()
+	}()
+	defer m.recoverMonitor(proc)
 
 	var timeoutCh <-chan time.Time
+	var timer *time.Timer
 	if timeout > 0 {
-		timeoutCh = time.After(timeout)
+		timer = time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
 	}
 
 	waitDone := make(chan error, 1)
 	go func() {
-		waitDone <- proc.cmd.Wait()
+		err := proc.cmd.Wait()
+		proc.closePTY()
+		waitDone <- err
 	}()
 
-	select {
-	case err := <-waitDone:
-		proc.mu.Lock()
-		now := time.Now()
-		proc.EndedAt = &now
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				proc.ExitCode = exitErr.ExitCode()
-			} else {
-				proc.ExitCode = -1
+	for {
+		select {
+		case err := <-waitDone:
+			m.recordExit(proc, err, "")
+			return
+
+		case req := <-proc.stop:
+			endedBy, err := terminate(proc, req.grace, waitDone)
+			m.recordExit(proc, err, endedBy)
+			return
+
+		case <-timeoutCh:
+			proc.mu.Lock()
+			if left := timeout - proc.runTime(time.Now()); left > 0 {
+				// Paused for part of the timeout; wait out the rest.
+				proc.mu.Unlock()
+				timer.Reset(left)
+				continue
 			}
+			proc.setState(StateTimedOut, time.Now())
+			grace := proc.grace
+			proc.mu.Unlock()
+			endedBy, _ := terminate(proc, grace, waitDone)
+			proc.mu.Lock()
+			now := time.Now()
+			proc.EndedAt = &now
+			proc.EndedBy = endedBy
+			proc.recordUsage()
+			ran := proc.runTime(now)
+			attrs := proc.logAttrs("state", StateTimedOut, "timeout", timeout, "duration_ms", ran.Milliseconds())
+			if endedBy != "" {
+				attrs = append(attrs, "ended_by", endedBy)
+			}
+			proc.mu.Unlock()
+			m.stats.exited(ExitTimeout, ran)
+			m.logger().Warn("process timed out", attrs...)
+			return
 		}
-		proc.State = StateExited
-		proc.mu.Unlock()
+	}
+}
 
-	case <-timeoutCh:
-		proc.mu.Lock()
-		proc.State = StateTimedOut
-		proc.mu.Unlock()
-		syscall.Kill(-proc.PID, syscall.SIGKILL)
-		<-waitDone
-		proc.mu.Lock()
-		now := time.Now()
-		proc.EndedAt = &now
+// recoverMonitor, deferred by monitor, turns a panic in it into a lost
+// process rather than a crashed server and a record claiming to run.
+func (m *Manager) recoverMonitor(proc *Process) {
+	if r := recover(); r != nil {
+		m.logger().Error("process monitor panicked", proc.logAttrs("panic", fmt.Sprint(r))...)
+		m.markLost(proc, fmt.Sprintf("its monitor failed: %v", r))
+	}
+}
+
+// recordExit records how a reaped process ended. endedBy is the signal
+// that ended a process Kill stopped, or empty if it exited on its own.
+func (m *Manager) recordExit(proc *Process, err error, endedBy string) {
+	proc.mu.Lock()
+	proc.recordUsage()
+	if proc.State == StateLost {
 		proc.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	proc.EndedAt = &now
+	class := ExitOK
+	if err != nil {
+		class = ExitNonzero
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			proc.ExitCode = exitErr.ExitCode()
+		} else {
+			proc.ExitCode = -1
+		}
+	}
+	// A process Kill stopped may still have exited on its own first; only
+	// death by our SIGKILL, or an exit within the grace period after our
+	// SIGTERM, counts as killed. A SIGKILL nobody here sent is checked
+	// against the OOM killer.
+	state := StateExited
+	sig, signaled := termSignal(err)
+	if signaled {
+		proc.TermSignal = signalName(sig)
+	}
+	switch {
+	case endedBy == EndedBySIGTERM || endedBy == EndedBySIGKILL && signaled && sig == syscall.SIGKILL:
+		state, class = StateKilled, ExitKilled
+		proc.EndedBy = endedBy
+	case signaled && sig == syscall.SIGKILL && proc.oomKilledSince():
+		proc.OOMKilled = true
+		class = ExitOOM
+	case signaled:
+		class = ExitSignaled
+	}
+	if class == ExitNonzero && proc.MaxOpenFiles > 0 {
+		if _, tail, _ := proc.errorOutput().tail(64 << 10); ranOutOfFiles(tail) {
+			proc.LimitHits = append(proc.LimitHits, LimitOpenFiles)
+		}
+	}
+	proc.setState(state, now)
+	ran := proc.runTime(now)
+	attrs := proc.logAttrs("state", state, "exit_code", proc.ExitCode, "class", class, "duration_ms", ran.Milliseconds())
+	if signaled {
+		attrs = append(attrs, "term_signal", proc.TermSignal, "oom_killed", proc.OOMKilled)
 	}
+	if proc.EndedBy != "" {
+		attrs = append(attrs, "ended_by", proc.EndedBy)
+	}
+	proc.mu.Unlock()
+	m.stats.exited(class, ran)
+	m.logger().Info("process ended", attrs...)
 }
 
 // ReadResult contains process output.
@@ -57,10 +150,52 @@ type ReadResult struct {
 	ExitCode int          `json:"exit_code"`
 	Stdout   string       `json:"stdout"`
 	Stderr   string       `json:"stderr"`
+	Combined string       `json:"combined,omitempty"` // set instead of Stdout and Stderr with MergeOutput
+
+	LostReason string   `json:"lost_reason,omitempty"`
+	LimitHits  []string `json:"limit_hits,omitempty"`
+	TraceID    string   `json:"trace_id,omitempty"`
+	TermSignal string   `json:"term_signal,omitempty"` // signal that ended the process
+	OOMKilled  bool     `json:"oom_killed,omitempty"`  // the kernel's OOM killer sent that signal
+	EndedBy    string   `json:"ended_by,omitempty"`    // sigterm or sigkill, for a process the server stopped
+
+	FirstOutputAt *time.Time `json:"first_output_at,omitempty"`
+	LastOutputAt  *time.Time `json:"last_output_at,omitempty"`
+
+	Effective *Effective `json:"effective,omitempty"`
+
+	// Lines is set when the output was limited to its last lines.
+	Lines *OutputLines `json:"lines,omitempty"`
+
+	Timing
+}
+
+// OutputLines describes each stream of a ReadResult cut to its last Tail
+// lines.
+type OutputLines struct {
+	Tail     int          `json:"tail"`
+	Stdout   StreamLines  `json:"stdout"`
+	Stderr   StreamLines  `json:"stderr"`
+	Combined *StreamLines `json:"combined,omitempty"`
 }
 
 // Read returns the current output of a process.
 func (m *Manager) Read(id string) (*ReadResult, error) {
+	return m.read(id, 0)
+}
+
+// ReadTail is Read with each stream cut to its last n lines, counted
+// server-side so a long log costs only what is returned.
+func (m *Manager) ReadTail(id string, n int) (*ReadResult, error) {
+	if n <= 0 {
+		return nil, invalid("tail_lines", "must be positive, got %d", n)
+	}
+	return m.read(id, n)
+}
+
+// read returns the output of a process, or its last tail lines when tail
+// is positive.
+func (m *Manager) read(id string, tail int) (*ReadResult, error) {
 	m.mu.RLock()
 	proc, ok := m.processes[id]
 	m.mu.RUnlock()
@@ -72,60 +207,228 @@ func (m *Manager) Read(id string) (*ReadResult, error) {
 	proc.mu.RLock()
 	defer proc.mu.RUnlock()
 
+	first, last := outputSpan(proc.outputs()...)
+	var stdout, stderr, combined string
+	var lines *OutputLines
+	if tail > 0 {
+		lines = &OutputLines{Tail: tail}
+		stdout, lines.Stdout = proc.stdout.tailLines(tail)
+		stderr, lines.Stderr = proc.stderr.tailLines(tail)
+		if proc.combined != nil {
+			var info StreamLines
+			combined, info = proc.combined.tailLines(tail)
+			lines.Combined = &info
+		}
+	} else {
+		stdout, stderr = proc.stdout.String(), proc.stderr.String()
+		if proc.combined != nil {
+			combined = proc.combined.String()
+		}
+	}
 	return &ReadResult{
 		ID:       proc.ID,
 		State:    proc.State,
 		ExitCode: proc.ExitCode,
-		Stdout:   proc.stdout.String(),
-		Stderr:   proc.stderr.String(),
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Combined: combined,
+		Lines:    lines,
+
+		LostReason: proc.LostReason,
+		LimitHits:  proc.LimitHits,
+		TraceID:    proc.TraceID,
+		TermSignal: proc.TermSignal,
+		OOMKilled:  proc.OOMKilled,
+		EndedBy:    proc.EndedBy,
+
+		FirstOutputAt: first,
+		LastOutputAt:  last,
+
+		Effective: proc.effective,
+
+		Timing: proc.timing(time.Now()),
 	}, nil
 }
 
-// Write sends input to a process's stdin.
-func (m *Manager) Write(id string, input string) error {
-	m.mu.RLock()
-	proc, ok := m.processes[id]
-	m.mu.RUnlock()
+// outputSpan combines the write times of the given streams.
+func outputSpan(bufs ...*outputBuffer) (*time.Time, *time.Time) {
+	var first, last *time.Time
+	for _, b := range bufs {
+		f, l := b.span()
+		if f.IsZero() {
+			continue
+		}
+		if first == nil || f.Before(*first) {
+			first = &f
+		}
+		if last == nil || l.After(*last) {
+			last = &l
+		}
+	}
+	return first, last
+}
 
-	if !ok {
-		return fmt.Errorf("process %s not found", id)
+// StreamResult is the output of one stream written after a cutoff.
+type StreamResult struct {
+	ID       string       `json:"id"`
+	Stream   string       `json:"stream"`
+	State    ProcessState `json:"state"`
+	Since    *time.Time   `json:"since,omitempty"`
+	Data     string       `json:"data"`
+	NewestAt *time.Time   `json:"newest_at,omitempty"`
+	// Truncated is set when output after the cutoff may have been
+	// discarded by the per-stream output cap.
+	Truncated bool `json:"truncated,omitempty"`
+	// Lines is set when the data was limited to its last lines.
+	Lines *StreamLines `json:"lines,omitempty"`
+}
+
+// ReadSince returns the output of stream ("stdout" or "stderr", or
+// "combined" for a process launched with MergeOutput) written after since;
+// a zero since returns everything retained. Pass the returned NewestAt as
+// the next since to follow a stream.
+func (m *Manager) ReadSince(id, stream string, since time.Time) (*StreamResult, error) {
+	proc, buf, err := m.stream(id, stream)
+	if err != nil {
+		return nil, err
 	}
 
+	data, newest, truncated := buf.since(since)
+	res := &StreamResult{ID: id, Stream: stream, Data: data, Truncated: truncated}
+	if !since.IsZero() {
+		res.Since = &since
+	}
+	if !newest.IsZero() {
+		res.NewestAt = &newest
+	}
 	proc.mu.RLock()
-	stdin := proc.stdin
-	state := proc.State
+	res.State = proc.State
 	proc.mu.RUnlock()
+	return res, nil
+}
 
-	if state != StateRunning {
-		return fmt.Errorf("process %s is not running", id)
+// ReadStreamTail returns the last n lines of stream; see ReadSince for the
+// streams.
+func (m *Manager) ReadStreamTail(id, stream string, n int) (*StreamResult, error) {
+	if n <= 0 {
+		return nil, invalid("tail_lines", "must be positive, got %d", n)
 	}
-	if stdin == nil {
-		return fmt.Errorf("process %s stdin not open", id)
+	proc, buf, err := m.stream(id, stream)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err := stdin.Write([]byte(input))
+	data, lines := buf.tailLines(n)
+	_, newest := buf.span()
+	res := &StreamResult{ID: id, Stream: stream, Data: data, Truncated: lines.Truncated, Lines: &lines}
+	if !newest.IsZero() {
+		res.NewestAt = &newest
+	}
+	proc.mu.RLock()
+	res.State = proc.State
+	proc.mu.RUnlock()
+	return res, nil
+}
+
+// stream looks up a process and the buffer of one of its streams.
+func (m *Manager) stream(id, stream string) (*Process, *outputBuffer, error) {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("process %s not found", id)
+	}
+
+	var buf *outputBuffer
+	switch {
+	case stream != "stdout" && stream != "stderr" && stream != "combined":
+		return nil, nil, invalid("stream", "unknown stream %q (expected stdout, stderr or combined)", stream)
+	case proc.combined != nil && stream != "combined":
+		return nil, nil, invalid("stream", "process %s merges its output; read the combined stream", id)
+	case proc.combined == nil && stream == "combined":
+		return nil, nil, invalid("stream", "process %s keeps stdout and stderr separate; launch it with merge_output for a combined stream", id)
+	case stream == "stdout":
+		buf = proc.stdout
+	case stream == "stderr":
+		buf = proc.stderr
+	default:
+		buf = proc.combined
+	}
+	return proc, buf, nil
+}
+
+// Write sends input to a process's stdin.
+func (m *Manager) Write(id string, input string) error {
+	_, err := m.WriteInput(id, input, WriteOptions{})
 	return err
 }
 
-// Kill terminates a process.
-func (m *Manager) Kill(id string) error {
+// killWait bounds how long Kill waits for a signalled process to be
+// reaped before reporting its state.
+const killWait = 2 * time.Second
+
+// Kill terminates a process at once and returns the state it ended in; see
+// Terminate.
+func (m *Manager) Kill(id string) (ProcessState, error) {
+	return m.Terminate(id, 0)
+}
+
+// Terminate stops a process and returns the state it ended in. With a
+// grace period the process is sent SIGTERM and given that long to exit
+// before it is SIGKILLed; a second call during the grace period SIGKILLs
+// it at once. A process that has already ended, or that exits on its own
+// before the signal lands, is not an error: its terminal state is
+// returned instead of killed. The state is only killed once the monitor
+// has seen the process end of the stop.
+func (m *Manager) Terminate(id string, grace time.Duration) (ProcessState, error) {
+	if err := checkGrace("grace_period", grace); err != nil {
+		return "", err
+	}
 	m.mu.RLock()
 	proc, ok := m.processes[id]
 	m.mu.RUnlock()
 
 	if !ok {
-		return fmt.Errorf("process %s not found", id)
+		return "", fmt.Errorf("process %s not found", id)
 	}
 
 	proc.mu.Lock()
-	if proc.State != StateRunning {
+	if proc.State != StateRunning && proc.State != StatePaused {
+		state := proc.State
 		proc.mu.Unlock()
-		return nil
+		return state, nil
+	}
+	if proc.cancel != nil {
+		proc.setState(StateKilled, time.Now())
+		attrs := proc.logAttrs()
+		proc.mu.Unlock()
+		m.changes.bump()
+		m.logger().Info("process killed", attrs...)
+		proc.cancel()
+		return m.awaitEnd(proc, killWait), nil
+	}
+	proc.requestStop(stopRequest{grace: grace})
+	attrs := proc.logAttrs()
+	if grace > 0 {
+		attrs = append(attrs, "grace_period", grace)
 	}
-	proc.State = StateKilled
 	proc.mu.Unlock()
+	m.logger().Info("process kill requested", attrs...)
+	return m.awaitEnd(proc, grace+killWait), nil
+}
 
-	return syscall.Kill(-proc.PID, syscall.SIGKILL)
+// awaitEnd waits up to wait for proc to finish and returns its state.
+func (m *Manager) awaitEnd(proc *Process, wait time.Duration) ProcessState {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-proc.done:
+	case <-timer.C:
+	}
+	proc.mu.RLock()
+	defer proc.mu.RUnlock()
+	return proc.State
 }
 
 // ProcessInfo is a summary of a process for listing.
@@ -138,6 +441,32 @@ type ProcessInfo struct {
 	PID       int          `json:"pid"`
 	StartedAt time.Time    `json:"started_at"`
 	EndedAt   *time.Time   `json:"ended_at,omitempty"`
+
+	Nice        int    `json:"nice"`
+	IONiceClass string `json:"ionice_class,omitempty"`
+	LostReason  string `json:"lost_reason,omitempty"`
+
+	SecurityProfile string `json:"security_profile,omitempty"`
+	TraceID         string `json:"trace_id,omitempty"`
+	SessionID       string `json:"session_id,omitempty"`
+	MergeOutput     bool   `json:"merge_output,omitempty"`
+
+	MaxOpenFiles int      `json:"max_open_files,omitempty"`
+	OpenFDs      *int     `json:"open_fds,omitempty"`
+	LimitHits    []string `json:"limit_hits,omitempty"`
+
+	PausedAt *time.Time `json:"paused_at,omitempty"`
+
+	TermSignal string `json:"term_signal,omitempty"`
+	OOMKilled  bool   `json:"oom_killed,omitempty"`
+	EndedBy    string `json:"ended_by,omitempty"`
+
+	Subscribers int `json:"subscribers,omitempty"` // live output subscribers
+
+	Effective *Effective     `json:"effective,omitempty"` // how the launch was executed
+	Recording *RecordingInfo `json:"recording,omitempty"` // set for a process launched with Record
+
+	Timing
 }
 
 // List returns all processes.
@@ -145,6 +474,7 @@ func (m *Manager) List() []*ProcessInfo {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	now := time.Now()
 	result := make([]*ProcessInfo, 0, len(m.processes))
 	for _, proc := range m.processes {
 		proc.mu.RLock()
@@ -157,6 +487,32 @@ func (m *Manager) List() []*ProcessInfo {
 			PID:       proc.PID,
 			StartedAt: proc.StartedAt,
 			EndedAt:   proc.EndedAt,
+
+			Nice:        proc.Nice,
+			IONiceClass: proc.IONiceClass,
+			LostReason:  proc.LostReason,
+
+			SecurityProfile: proc.SecurityProfile,
+			TraceID:         proc.TraceID,
+			SessionID:       proc.SessionID,
+			MergeOutput:     proc.MergeOutput,
+
+			MaxOpenFiles: proc.MaxOpenFiles,
+			OpenFDs:      proc.OpenFDs,
+			LimitHits:    proc.LimitHits,
+
+			PausedAt: proc.PausedAt,
+
+			TermSignal: proc.TermSignal,
+			OOMKilled:  proc.OOMKilled,
+			EndedBy:    proc.EndedBy,
+
+			Subscribers: proc.subs.count(),
+
+			Effective: proc.effective,
+			Recording: proc.recordingInfo(),
+
+			Timing: proc.timing(now),
 		})
 		proc.mu.RUnlock()
 	}
@@ -182,3 +538,37 @@ func (m *Manager) Wait(ctx context.Context, id string) (*ReadResult, error) {
 	return m.Read(id)
 }
 
+// Done returns a channel that is closed once the process has finished.
+func (m *Manager) Done(id string) (<-chan struct{}, error) {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+	return proc.done, nil
+}
+
+// Tail returns the combined number of bytes a process has written and up
+// to n trailing bytes of whichever stream it wrote to most recently.
+func (m *Manager) Tail(id string, n int) (int, string, error) {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return 0, "", fmt.Errorf("process %s not found", id)
+	}
+
+	if proc.combined != nil {
+		total, tail, _ := proc.combined.tail(n)
+		return total, tail, nil
+	}
+	outLen, outTail, outAt := proc.stdout.tail(n)
+	errLen, errTail, errAt := proc.stderr.tail(n)
+	if errAt.After(outAt) {
+		return outLen + errLen, errTail, nil
+	}
+	return outLen + errLen, outTail, nil
+}
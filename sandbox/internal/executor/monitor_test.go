@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKillRacingNaturalExit(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := m.Launch(context.Background(), LaunchOptions{Command: "exit 3"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// Stagger the kills across the process's short life.
+			time.Sleep(time.Duration(i%8) * 500 * time.Microsecond)
+			state, err := m.Kill(res.ID)
+			if err != nil {
+				t.Errorf("kill %s: %v", res.ID, err)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			out, err := m.Wait(ctx, res.ID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if out.State != state {
+				t.Errorf("kill returned %s, process ended %s", state, out.State)
+			}
+			switch out.State {
+			case StateExited:
+				if out.ExitCode != 3 {
+					t.Errorf("exited with %d, want its own exit code 3", out.ExitCode)
+				}
+			case StateKilled:
+				if out.ExitCode != -1 {
+					t.Errorf("killed with exit code %d", out.ExitCode)
+				}
+			default:
+				t.Errorf("ended in state %s", out.State)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Every exit was counted once, in the class matching its state.
+	snap := m.Metrics()
+	killed, exited := snap.States[StateKilled], snap.States[StateExited]
+	if snap.Counters.Exits[ExitKilled] != int64(killed) || snap.Counters.Exits[ExitNonzero] != int64(exited) {
+		t.Fatalf("exit classes %v, states killed %d exited %d", snap.Counters.Exits, killed, exited)
+	}
+}
+
+func TestKillEndedProcessReturnsItsState(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "exit 7", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := m.Kill(res.ID)
+	if err != nil || state != StateExited {
+		t.Fatalf("kill after exit: %s, %v", state, err)
+	}
+	if out, _ := m.Read(res.ID); out.State != StateExited || out.ExitCode != 7 {
+		t.Fatalf("kill rewrote a finished process: %+v", out)
+	}
+}
@@ -0,0 +1,252 @@
+package executor
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Writes landing within chunkGranularity of a chunk's first write are merged
+// into the same chunk, so the chunk index grows with wall time and output
+// volume rather than with the number of write calls.
+const (
+	chunkGranularity = 100 * time.Millisecond
+	maxChunkBytes    = 64 << 10
+)
+
+// outputChunk is a run of output begun at start and last written at at.
+type outputChunk struct {
+	start time.Time
+	at    time.Time
+	data  []byte
+}
+
+// outputBuffer collects a process stream as timestamped chunks. exec's
+// copier goroutine writes to it while API callers read snapshots, so
+// access is serialized. When max is positive the oldest output is
+// discarded to keep at most max bytes.
+type outputBuffer struct {
+	mu      sync.Mutex
+	chunks  []outputChunk
+	size    int
+	dropped int64
+	first   time.Time
+	last    time.Time
+	max     int
+	now     func() time.Time
+	counter *atomic.Int64 // running total across buffers, if set
+	tap     func([]byte)  // sees each write, in order, if set
+
+	// Lines are counted by their newlines: all written, and those the
+	// cap has discarded. partial is set while the last line is
+	// unterminated.
+	newlines     int64
+	droppedLines int64
+	partial      bool
+}
+
+func newOutputBuffer(max int) *outputBuffer {
+	return &outputBuffer{max: max}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.now != nil {
+		now = b.now()
+	}
+	if b.first.IsZero() {
+		b.first = now
+	}
+	b.last = now
+
+	if n := len(b.chunks); n > 0 && now.Sub(b.chunks[n-1].start) < chunkGranularity &&
+		len(b.chunks[n-1].data)+len(p) <= maxChunkBytes {
+		last := &b.chunks[n-1]
+		last.data = append(last.data, p...)
+		last.at = now
+	} else {
+		b.chunks = append(b.chunks, outputChunk{start: now, at: now, data: append([]byte(nil), p...)})
+	}
+	b.size += len(p)
+	b.newlines += int64(bytes.Count(p, []byte{'\n'}))
+	b.partial = p[len(p)-1] != '\n'
+	if b.counter != nil {
+		b.counter.Add(int64(len(p)))
+	}
+	if b.tap != nil {
+		b.tap(p)
+	}
+	b.trim()
+	return len(p), nil
+}
+
+// trim drops the oldest output beyond the cap, cutting into the first
+// remaining chunk if necessary.
+func (b *outputBuffer) trim() {
+	if b.max <= 0 {
+		return
+	}
+	for b.size > b.max {
+		excess := b.size - b.max
+		head := &b.chunks[0]
+		if len(head.data) <= excess {
+			b.size -= len(head.data)
+			b.dropped += int64(len(head.data))
+			b.droppedLines += int64(bytes.Count(head.data, []byte{'\n'}))
+			b.chunks[0] = outputChunk{}
+			b.chunks = b.chunks[1:]
+			continue
+		}
+		b.droppedLines += int64(bytes.Count(head.data[:excess], []byte{'\n'}))
+		head.data = head.data[excess:]
+		b.size -= excess
+		b.dropped += int64(excess)
+	}
+}
+
+func (b *outputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var sb strings.Builder
+	sb.Grow(b.size)
+	for _, c := range b.chunks {
+		sb.Write(c.data)
+	}
+	return sb.String()
+}
+
+// tail returns the total bytes retained, the last n of them, and when the
+// stream was last written.
+func (b *outputBuffer) tail(n int) (int, string, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.chunks) == 0 {
+		return 0, "", time.Time{}
+	}
+	var parts []string
+	remaining := n
+	for i := len(b.chunks) - 1; i >= 0 && remaining > 0; i-- {
+		d := b.chunks[i].data
+		if len(d) > remaining {
+			d = d[len(d)-remaining:]
+		}
+		parts = append(parts, string(d))
+		remaining -= len(d)
+	}
+	var sb strings.Builder
+	for i := len(parts) - 1; i >= 0; i-- {
+		sb.WriteString(parts[i])
+	}
+	return b.size, sb.String(), b.last
+}
+
+// StreamLines describes a stream read as its last lines. Lines end at
+// "\n", so a CRLF line is one line that keeps its "\r"; a final line
+// without a newline counts too.
+type StreamLines struct {
+	Total    int64 `json:"total"`    // lines written to the stream
+	Returned int   `json:"returned"` // lines in the data returned
+	// Dropped is how many whole lines the output cap discarded.
+	Dropped int64 `json:"dropped,omitempty"`
+	// Truncated is set when fewer lines were retained than asked for
+	// because earlier output was discarded; the first line returned may
+	// then be missing its start.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// tailLines returns the last n lines retained, scanning back from the end
+// so only the returned output is copied.
+func (b *outputBuffer) tailLines(n int) (string, StreamLines) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	info := StreamLines{Total: b.newlines, Dropped: b.droppedLines}
+	if b.partial {
+		info.Total++
+	}
+	if n <= 0 || b.size == 0 {
+		return "", info
+	}
+
+	// The newline ending the stream closes its last line rather than
+	// starting another, so it is passed over.
+	chunk, offset, need := 0, 0, n
+	final, found := true, false
+scan:
+	for i := len(b.chunks) - 1; i >= 0; i-- {
+		d := b.chunks[i].data
+		for j := len(d) - 1; j >= 0; j-- {
+			if d[j] == '\n' && !final {
+				if need--; need == 0 {
+					chunk, offset, found = i, j+1, true
+					break scan
+				}
+			}
+			final = false
+		}
+	}
+
+	var sb strings.Builder
+	for i := chunk; i < len(b.chunks); i++ {
+		d := b.chunks[i].data
+		if i == chunk {
+			d = d[offset:]
+		}
+		sb.Write(d)
+	}
+	out := sb.String()
+	if found {
+		info.Returned = n
+	} else {
+		info.Returned = strings.Count(out, "\n")
+		if b.partial {
+			info.Returned++
+		}
+		info.Truncated = b.dropped > 0
+	}
+	return out, info
+}
+
+// since returns the output in chunks last written after cutoff, the time
+// of the latest write, and whether output that may have been written
+// after cutoff was already discarded by the cap. Chunks are coarse, so the
+// result can include up to chunkGranularity of output from before cutoff.
+func (b *outputBuffer) since(cutoff time.Time) (string, time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var sb strings.Builder
+	for _, c := range b.chunks {
+		if c.at.After(cutoff) {
+			sb.Write(c.data)
+		}
+	}
+	truncated := b.dropped > 0 && (len(b.chunks) == 0 || b.chunks[0].at.After(cutoff))
+	return sb.String(), b.last, truncated
+}
+
+// span returns when the stream was first and last written; both are zero
+// if it never was.
+func (b *outputBuffer) span() (time.Time, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.first, b.last
+}
+
+// snapshot copies the retained chunks and reports how many bytes the cap
+// has discarded.
+func (b *outputBuffer) snapshot() ([]outputChunk, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	chunks := make([]outputChunk, len(b.chunks))
+	for i, c := range b.chunks {
+		chunks[i] = outputChunk{start: c.start, at: c.at, data: append([]byte(nil), c.data...)}
+	}
+	return chunks, b.dropped
+}
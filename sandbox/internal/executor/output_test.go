@@ -0,0 +1,198 @@
+package executor
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock steps a buffer's clock explicitly.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestBuffer(max int) (*outputBuffer, *fakeClock) {
+	c := &fakeClock{t: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	b := newOutputBuffer(max)
+	b.now = c.now
+	return b, c
+}
+
+func TestOutputSinceCutoffBoundaries(t *testing.T) {
+	b, clock := newTestBuffer(0)
+	t0 := clock.t
+	b.Write([]byte("a"))
+	clock.t = t0.Add(time.Second)
+	b.Write([]byte("b"))
+	clock.t = t0.Add(2 * time.Second)
+	b.Write([]byte("c"))
+
+	cases := []struct {
+		cutoff time.Time
+		want   string
+	}{
+		{time.Time{}, "abc"},
+		{t0.Add(-time.Nanosecond), "abc"},
+		{t0, "bc"}, // a chunk stamped exactly at the cutoff is not after it
+		{t0.Add(time.Second - time.Nanosecond), "bc"},
+		{t0.Add(time.Second), "c"},
+		{t0.Add(2 * time.Second), ""},
+	}
+	for _, c := range cases {
+		got, newest, truncated := b.since(c.cutoff)
+		if got != c.want || !newest.Equal(t0.Add(2*time.Second)) || truncated {
+			t.Errorf("since(%v) = %q, %v, %v; want %q", c.cutoff, got, newest, truncated, c.want)
+		}
+	}
+}
+
+func TestOutputMergesWritesWithinGranularity(t *testing.T) {
+	b, clock := newTestBuffer(0)
+	t0 := clock.t
+	for i := 0; i < 5; i++ {
+		b.Write([]byte("x"))
+		clock.t = clock.t.Add(chunkGranularity / 4)
+	}
+	if len(b.chunks) != 2 {
+		t.Fatalf("got %d chunks, want 2", len(b.chunks))
+	}
+	// The merged chunk was last written after t0, so a cutoff inside it
+	// returns the whole chunk.
+	if got, _, _ := b.since(t0.Add(time.Nanosecond)); got != "xxxxx" {
+		t.Fatalf("since inside merged chunk = %q", got)
+	}
+}
+
+func TestOutputCapTruncatesOldestChunks(t *testing.T) {
+	b, clock := newTestBuffer(6)
+	t0 := clock.t
+	for i, s := range []string{"aaaa", "bbbb", "cccc"} {
+		clock.t = t0.Add(time.Duration(i) * time.Second)
+		b.Write([]byte(s))
+	}
+	if got := b.String(); got != "bbcccc" {
+		t.Fatalf("retained %q, want bbcccc", got)
+	}
+	if b.dropped != 6 || b.size != 6 {
+		t.Fatalf("dropped %d size %d", b.dropped, b.size)
+	}
+
+	// Cutoff after the oldest retained chunk: nothing relevant was lost.
+	if got, _, truncated := b.since(t0.Add(time.Second)); got != "cccc" || truncated {
+		t.Errorf("since(t0+1s) = %q truncated=%v", got, truncated)
+	}
+	// Cutoff before the oldest retained chunk: part of "bbbb" and all of
+	// "aaaa" were discarded.
+	if got, _, truncated := b.since(t0); got != "bbcccc" || !truncated {
+		t.Errorf("since(t0) = %q truncated=%v", got, truncated)
+	}
+
+	first, last := b.span()
+	if !first.Equal(t0) || !last.Equal(t0.Add(2*time.Second)) {
+		t.Errorf("span = %v..%v", first, last)
+	}
+}
+
+// interleaved alternates writes to stdout and stderr.
+const interleaved = `for i in 1 2 3 4 5; do echo out$i; echo err$i >&2; done`
+
+func TestMergeOutputPreservesInterleaving(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: interleaved, Wait: true, MergeOutput: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "out1\nerr1\nout2\nerr2\nout3\nerr3\nout4\nerr4\nout5\nerr5\n"
+	if res.Combined != want || res.Stdout != "" || res.Stderr != "" {
+		t.Fatalf("launch: combined %q, stdout %q, stderr %q", res.Combined, res.Stdout, res.Stderr)
+	}
+	out, err := m.Read(res.ID)
+	if err != nil || out.Combined != want || out.Stdout != "" || out.Stderr != "" {
+		t.Fatalf("read: %+v, %v", out, err)
+	}
+	if s, err := m.ReadSince(res.ID, "combined", time.Time{}); err != nil || s.Data != want {
+		t.Fatalf("combined stream: %+v, %v", s, err)
+	}
+	if _, err := m.ReadSince(res.ID, "stdout", time.Time{}); err == nil {
+		t.Fatal("stdout stream of a merged process was served")
+	}
+}
+
+func TestSeparateOutputKeepsEachStreamInOrder(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: interleaved, Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Across streams the order is lost; within each it is kept.
+	if res.Stdout != "out1\nout2\nout3\nout4\nout5\n" || res.Stderr != "err1\nerr2\nerr3\nerr4\nerr5\n" || res.Combined != "" {
+		t.Fatalf("stdout %q, stderr %q, combined %q", res.Stdout, res.Stderr, res.Combined)
+	}
+	if _, err := m.ReadSince(res.ID, "combined", time.Time{}); err == nil || !strings.Contains(err.Error(), "merge_output") {
+		t.Fatalf("combined stream of a separate process: %v", err)
+	}
+}
+
+func TestOutputTailLines(t *testing.T) {
+	cases := []struct {
+		writes []string
+		n      int
+		want   string
+		info   StreamLines
+	}{
+		{[]string{"a\nb\nc\n"}, 2, "b\nc\n", StreamLines{Total: 3, Returned: 2}},
+		{[]string{"a\nb\nc"}, 2, "b\nc", StreamLines{Total: 3, Returned: 2}},
+		{[]string{"a\r\nb\r\nc\r\n"}, 1, "c\r\n", StreamLines{Total: 3, Returned: 1}},
+		{[]string{"a\nb\n"}, 5, "a\nb\n", StreamLines{Total: 2, Returned: 2}},
+		{[]string{"\n\n\n"}, 2, "\n\n", StreamLines{Total: 3, Returned: 2}},
+		{[]string{"no newline"}, 1, "no newline", StreamLines{Total: 1, Returned: 1}},
+		// Lines split across writes, and so across chunks.
+		{[]string{"a\nb", "b\ncc", "c\n"}, 2, "bb\nccc\n", StreamLines{Total: 3, Returned: 2}},
+		{nil, 3, "", StreamLines{}},
+	}
+	for _, c := range cases {
+		b, clock := newTestBuffer(0)
+		for _, w := range c.writes {
+			b.Write([]byte(w))
+			clock.t = clock.t.Add(time.Second)
+		}
+		got, info := b.tailLines(c.n)
+		if got != c.want || info != c.info {
+			t.Errorf("%q, last %d: %q %+v; want %q %+v", c.writes, c.n, got, info, c.want, c.info)
+		}
+	}
+}
+
+func TestOutputTailLinesAfterCap(t *testing.T) {
+	// 8MB of numbered lines through a 1MB cap.
+	b, clock := newTestBuffer(1 << 20)
+	var total int64
+	var lines strings.Builder
+	for b.dropped+int64(b.size) < 8<<20 {
+		lines.Reset()
+		for j := 0; j < 100; j++ {
+			lines.WriteString(strconv.FormatInt(total, 10))
+			lines.WriteByte('\n')
+			total++
+		}
+		b.Write([]byte(lines.String()))
+		clock.t = clock.t.Add(time.Millisecond)
+	}
+	last := strconv.FormatInt(total-1, 10)
+
+	got, info := b.tailLines(50)
+	if info.Total != total || info.Returned != 50 || info.Truncated || info.Dropped == 0 || len(got) > 1024 {
+		t.Fatalf("tail: %d bytes, %+v (%d lines written)", len(got), info, total)
+	}
+	if lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n"); len(lines) != 50 || lines[49] != last {
+		t.Fatalf("tail ends %q, want %s", lines[len(lines)-1], last)
+	}
+
+	// Asking for more lines than are retained reaches the discarded output.
+	got, info = b.tailLines(int(total))
+	if !info.Truncated || len(got) != b.size || int64(info.Returned)+info.Dropped > total || int64(info.Returned)+info.Dropped < total-1 {
+		t.Fatalf("all: %d bytes, %+v (%d retained, %d written)", len(got), info, b.size, total)
+	}
+}
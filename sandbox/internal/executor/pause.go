@@ -0,0 +1,108 @@
+package executor
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// Pause stops a running process and everything in its process group with
+// SIGSTOP until Resume. While paused, stdin writes are rejected and its
+// timeout does not run down; Kill still works. Pausing a paused process
+// does nothing.
+func (m *Manager) Pause(id string) error {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("process %s not found", id)
+	}
+
+	proc.mu.Lock()
+	switch {
+	case proc.cancel != nil:
+		state := proc.State
+		proc.mu.Unlock()
+		return &StateError{ID: id, State: state, Message: "a native process such as a tail cannot be paused"}
+	case proc.State == StatePaused:
+		proc.mu.Unlock()
+		return nil
+	case proc.State != StateRunning:
+		state := proc.State
+		proc.mu.Unlock()
+		return &StateError{ID: id, State: state, Message: "only a running process can be paused"}
+	}
+	if err := syscall.Kill(-proc.PID, syscall.SIGSTOP); err != nil {
+		proc.mu.Unlock()
+		return fmt.Errorf("pause %s: %w", id, err)
+	}
+	now := time.Now()
+	proc.PausedAt = &now
+	proc.setState(StatePaused, now)
+	attrs := proc.logAttrs()
+	proc.mu.Unlock()
+	m.changes.bump()
+	m.logger().Info("process paused", attrs...)
+	return nil
+}
+
+// Resume continues a paused process with SIGCONT. Resuming a running
+// process does nothing.
+func (m *Manager) Resume(id string) error {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("process %s not found", id)
+	}
+
+	proc.mu.Lock()
+	switch proc.State {
+	case StateRunning:
+		proc.mu.Unlock()
+		return nil
+	case StatePaused:
+	default:
+		state := proc.State
+		proc.mu.Unlock()
+		return &StateError{ID: id, State: state, Message: "only a paused process can be resumed"}
+	}
+	if err := syscall.Kill(-proc.PID, syscall.SIGCONT); err != nil {
+		proc.mu.Unlock()
+		return fmt.Errorf("resume %s: %w", id, err)
+	}
+	proc.setState(StateRunning, time.Now())
+	attrs := proc.logAttrs("paused_ms", proc.pausedFor.Milliseconds())
+	proc.mu.Unlock()
+	m.changes.bump()
+	m.logger().Info("process resumed", attrs...)
+	return nil
+}
+
+// endPause adds the pause begun at PausedAt to the total. The caller holds
+// p.mu.
+func (p *Process) endPause(at time.Time) {
+	if p.PausedAt == nil {
+		return
+	}
+	p.pausedFor += at.Sub(*p.PausedAt)
+	p.PausedAt = nil
+}
+
+// paused returns the total time p has spent paused as of now, including a
+// pause in progress. The caller holds p.mu.
+func (p *Process) paused(now time.Time) time.Duration {
+	d := p.pausedFor
+	if p.PausedAt != nil {
+		d += now.Sub(*p.PausedAt)
+	}
+	return d
+}
+
+// runTime is how long p has run as of end, not counting time paused. The
+// caller holds p.mu.
+func (p *Process) runTime(end time.Time) time.Duration {
+	return end.Sub(p.StartedAt) - p.paused(end)
+}
@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// counter prints an increasing count until stopped.
+const counter = `i=0; while :; do i=$((i+1)); echo $i; sleep 0.02; done`
+
+// outputLen returns how many bytes of stdout id has produced.
+func outputLen(t *testing.T, m *Manager, id string) int {
+	t.Helper()
+	out, err := m.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(out.Stdout)
+}
+
+func TestPauseStallsAndResumeContinuesOutput(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: counter, KeepStdinOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Kill(res.ID)
+	time.Sleep(100 * time.Millisecond)
+
+	if err := m.Pause(res.ID); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // let any write in flight land
+	stalled := outputLen(t, m, res.ID)
+	time.Sleep(300 * time.Millisecond)
+	if n := outputLen(t, m, res.ID); n != stalled {
+		t.Fatalf("output grew from %d to %d bytes while paused", stalled, n)
+	}
+
+	out, _ := m.Read(res.ID)
+	if out.State != StatePaused || out.PausedMs < 300 {
+		t.Fatalf("while paused: state %s, paused %dms", out.State, out.PausedMs)
+	}
+	if out.DurationMs > out.AgeMs-out.PausedMs+5 {
+		t.Fatalf("duration %dms counts paused time (age %dms, paused %dms)", out.DurationMs, out.AgeMs, out.PausedMs)
+	}
+	var serr *StateError
+	if _, err := m.WriteInput(res.ID, "x\n", WriteOptions{}); !errors.As(err, &serr) {
+		t.Fatalf("write while paused: %v", err)
+	}
+
+	if err := m.Resume(res.ID); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for outputLen(t, m, res.ID) == stalled {
+		if time.Now().After(deadline) {
+			t.Fatal("output did not continue after resume")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if list := m.List(); len(list) != 1 || list[0].State != StateRunning || list[0].PausedAt != nil || list[0].PausedMs < 300 {
+		t.Fatalf("after resume: %+v", list[0])
+	}
+}
+
+func TestPauseSuspendsTimeout(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "sleep 0.2", Timeout: 400 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Pause(res.ID); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(600 * time.Millisecond) // past the timeout, had it kept running
+	if err := m.Resume(res.ID); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := m.Wait(ctx, res.ID)
+	if err != nil || out.State != StateExited || out.ExitCode != 0 {
+		t.Fatalf("wait: %+v, %v", out, err)
+	}
+}
+
+func TestKillPausedProcessAndStateRules(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: counter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Resume(res.ID); err != nil {
+		t.Fatalf("resuming a running process: %v", err)
+	}
+	if err := m.Pause(res.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Pause(res.ID); err != nil {
+		t.Fatalf("pausing twice: %v", err)
+	}
+	if _, err := m.Kill(res.ID); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if out, err := m.Wait(ctx, res.ID); err != nil || out.State == StatePaused || out.State == StateRunning {
+		t.Fatalf("killed while paused: %+v, %v", out, err)
+	}
+
+	var serr *StateError
+	if err := m.Pause(res.ID); !errors.As(err, &serr) || !strings.Contains(err.Error(), "only a running process") {
+		t.Fatalf("pausing an ended process: %v", err)
+	}
+	if err := m.Resume(res.ID); !errors.As(err, &serr) {
+		t.Fatalf("resuming an ended process: %v", err)
+	}
+}
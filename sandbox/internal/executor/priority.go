@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// PriorityPolicy bounds the scheduling priority a launch may request.
+type PriorityPolicy struct {
+	DefaultNice   int      `json:"default_nice"`
+	MinNice       int      `json:"min_nice"`
+	MaxNice       int      `json:"max_nice"`
+	IONiceClasses []string `json:"ionice_classes"`
+}
+
+// DefaultPriorityPolicy allows lowering priority but never raising it,
+// which is all an unprivileged server can do anyway.
+func DefaultPriorityPolicy() PriorityPolicy {
+	return PriorityPolicy{
+		DefaultNice:   0,
+		MinNice:       0,
+		MaxNice:       19,
+		IONiceClasses: []string{"best-effort", "idle"},
+	}
+}
+
+// resolvePriority validates the requested niceness and I/O class against
+// the policy and returns the values to apply.
+func (p PriorityPolicy) resolvePriority(opts LaunchOptions) (int, string, error) {
+	nice := p.DefaultNice
+	if opts.Nice != nil {
+		nice = *opts.Nice
+		if nice < -20 || nice > 19 {
+			return 0, "", invalid("nice", "must be between -20 and 19")
+		}
+		if nice < p.MinNice || nice > p.MaxNice {
+			return 0, "", invalid("nice", "must be between %d and %d on this server", p.MinNice, p.MaxNice)
+		}
+	}
+
+	class := opts.IONiceClass
+	if class != "" {
+		if !ioniceSupported {
+			return 0, "", invalid("ionice_class", "not supported on this platform")
+		}
+		if _, ok := ioprioClasses[class]; !ok {
+			return 0, "", invalid("ionice_class", "unknown class %q (expected realtime, best-effort, or idle)", class)
+		}
+		allowed := false
+		for _, c := range p.IONiceClasses {
+			if c == class {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return 0, "", invalid("ionice_class", "class %q is not allowed on this server", class)
+		}
+	}
+	return nice, class, nil
+}
+
+// applyPriority sets the niceness and I/O class of a freshly started
+// process group.
+func applyPriority(pgid, nice int, class string) error {
+	if nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PGRP, pgid, nice); err != nil {
+			return fmt.Errorf("setpriority: %w", err)
+		}
+	}
+	if class != "" {
+		if err := setIOPriority(pgid, class); err != nil {
+			return fmt.Errorf("ioprio_set: %w", err)
+		}
+	}
+	return nil
+}
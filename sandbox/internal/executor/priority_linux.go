@@ -0,0 +1,30 @@
+//go:build linux
+
+package executor
+
+import "syscall"
+
+const ioniceSupported = true
+
+const (
+	ioprioWhoPgrp    = 2
+	ioprioClassShift = 13
+)
+
+var ioprioClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+func setIOPriority(pgid int, class string) error {
+	prio := ioprioClasses[class] << ioprioClassShift
+	if class != "idle" {
+		prio |= 4 // default level within the class
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoPgrp, uintptr(pgid), uintptr(prio))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
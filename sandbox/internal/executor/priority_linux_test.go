@@ -0,0 +1,53 @@
+//go:build linux
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestLaunchAppliesNice(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	nice := 7
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "sleep 5", Nice: &nice})
+	if err != nil {
+		t.Fatalf("launch: %v", err)
+	}
+	defer m.Kill(res.ID)
+
+	// The raw Linux getpriority syscall reports 20 - nice.
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, res.PID)
+	if err != nil {
+		t.Fatalf("getpriority: %v", err)
+	}
+	if got := 20 - prio; got != nice {
+		t.Fatalf("nice = %d, want %d", got, nice)
+	}
+
+	for _, p := range m.List() {
+		if p.ID == res.ID && p.Nice != nice {
+			t.Fatalf("ProcessInfo.Nice = %d, want %d", p.Nice, nice)
+		}
+	}
+}
+
+func TestLaunchRejectsNiceOutsidePolicy(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	for _, n := range []int{-5, 25} {
+		nice := n
+		_, err := m.Launch(context.Background(), LaunchOptions{Command: "true", Nice: &nice})
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("nice %d: err = %v, want ValidationError", n, err)
+		}
+	}
+
+	_, err := m.Launch(context.Background(), LaunchOptions{Command: "true", IONiceClass: "realtime"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("realtime class: err = %v, want ValidationError", err)
+	}
+}
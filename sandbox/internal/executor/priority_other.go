@@ -0,0 +1,13 @@
+//go:build !linux
+
+package executor
+
+import "errors"
+
+const ioniceSupported = false
+
+var ioprioClasses = map[string]int{}
+
+func setIOPriority(pgid int, class string) error {
+	return errors.New("ionice is not supported on this platform")
+}
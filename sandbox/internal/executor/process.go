@@ -2,11 +2,14 @@
 package executor
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -19,9 +22,11 @@ type ProcessState string
 
 const (
 	StateRunning  ProcessState = "running"
+	StatePaused   ProcessState = "paused"
 	StateExited   ProcessState = "exited"
 	StateKilled   ProcessState = "killed"
 	StateTimedOut ProcessState = "timed_out"
+	StateLost     ProcessState = "lost"
 )
 
 // Process represents a managed process in the sandbox.
@@ -35,26 +40,173 @@ type Process struct {
 	EndedAt   *time.Time   `json:"ended_at,omitempty"`
 	PID       int          `json:"pid,omitempty"`
 
-	cmd    *exec.Cmd
-	stdout *bytes.Buffer
-	stderr *bytes.Buffer
-	stdin  io.WriteCloser
-	mu     sync.RWMutex
-	done   chan struct{}
+	Nice        int    `json:"nice"`
+	IONiceClass string `json:"ionice_class,omitempty"`
+	LostReason  string `json:"lost_reason,omitempty"`
+
+	SecurityProfile string `json:"security_profile,omitempty"`
+	TraceID         string `json:"trace_id,omitempty"`
+	SessionID       string `json:"session_id,omitempty"`
+	MergeOutput     bool   `json:"merge_output,omitempty"`
+
+	MaxOpenFiles int      `json:"max_open_files,omitempty"` // RLIMIT_NOFILE applied at launch
+	OpenFDs      *int     `json:"open_fds,omitempty"`       // as of the latest sweep
+	LimitHits    []string `json:"limit_hits,omitempty"`
+
+	PausedAt *time.Time `json:"paused_at,omitempty"` // start of the current pause
+
+	TermSignal string `json:"term_signal,omitempty"` // signal that ended the process, such as SIGKILL
+	OOMKilled  bool   `json:"oom_killed,omitempty"`  // the signal came from the kernel's OOM killer
+	EndedBy    string `json:"ended_by,omitempty"`    // sigterm or sigkill, for a process the server stopped
+
+	cmd          *exec.Cmd
+	cancel       context.CancelFunc // stops a native process such as a tail; nil for commands
+	stdout       *outputBuffer
+	stderr       *outputBuffer
+	combined     *outputBuffer // both streams in write order; nil unless MergeOutput
+	subs         *broadcaster  // live output subscribers; see Subscribe
+	stdin        io.WriteCloser
+	inputs       inputLog
+	inputMu      sync.Mutex
+	mu           sync.RWMutex
+	done         chan struct{}
+	doneOnce     sync.Once
+	startTicks   uint64
+	zombieSweeps int
+	monitored    bool             // a monitor goroutine is waiting on cmd; see sweep
+	cpu          *cpuTimes        // set when the monitor reaps the process
+	pausedFor    time.Duration    // completed pauses; see paused
+	stop         chan stopRequest // to the monitor; see Terminate
+	grace        time.Duration    // SIGTERM to SIGKILL on timeout; see terminate
+	oomFile      string           // memory cgroup file counting OOM kills; see watchOOM
+	oomKills     uint64           // its count when last read
+	transitions  []stateChange
+	envNames     []string   // variables the launch set; see Transcript
+	effective    *Effective // nil for native processes such as tails
+
+	pty           *os.File      // master side of a Record process's terminal
+	ptyDone       chan struct{} // closed once the terminal's output is drained
+	recorder      *castRecorder
+	recordingPath string
+}
+
+// stateChange records when a process changed state after launch.
+type stateChange struct {
+	at    time.Time
+	state ProcessState
+}
+
+// setState moves the process to s and records the transition for its
+// transcript. Leaving StatePaused ends the pause. The caller holds p.mu.
+func (p *Process) setState(s ProcessState, at time.Time) {
+	if p.State == StatePaused && s != StatePaused {
+		p.endPause(at)
+	}
+	p.State = s
+	p.transitions = append(p.transitions, stateChange{at: at, state: s})
+}
+
+// outputs returns the buffers the process writes to.
+func (p *Process) outputs() []*outputBuffer {
+	if p.combined != nil {
+		return []*outputBuffer{p.combined}
+	}
+	return []*outputBuffer{p.stdout, p.stderr}
+}
+
+// errorOutput returns the buffer that holds the process's stderr.
+func (p *Process) errorOutput() *outputBuffer {
+	if p.combined != nil {
+		return p.combined
+	}
+	return p.stderr
+}
+
+// finish releases everyone waiting on the process. It is safe to call
+// from both the monitor and the sweeper.
+func (p *Process) finish() {
+	p.doneOnce.Do(func() {
+		close(p.done)
+		if p.subs != nil {
+			p.mu.RLock()
+			state := p.State
+			p.mu.RUnlock()
+			p.subs.end("process " + string(state))
+		}
+	})
+}
+
+// Options configures server-wide policy for a Manager.
+type Options struct {
+	Priority        PriorityPolicy
+	OpenFiles       FDPolicy
+	MaxCommandBytes int
+	MaxOutputBytes  int // per stream; older output is discarded beyond it
+
+	SecurityProfiles []SecurityProfile
+	Workspace        WorkspaceOptions
+	Subscribers      SubscriberLimits
+
+	// SessionCwd is where launches in a session start when neither they
+	// nor their session give a cwd: a template relative to the workspace,
+	// such as "sessions/{{.SessionID}}". Empty starts them in the
+	// workspace.
+	SessionCwd string
+
+	// ProcessLogDir holds per-process files such as recordings.
+	ProcessLogDir string
+
+	// Logger receives a structured line for each process lifecycle event;
+	// nil discards them.
+	Logger *slog.Logger
+}
+
+// DefaultMaxCommandBytes matches Linux's MAX_ARG_STRLEN, the longest single
+// argument exec accepts; sh receives the whole command as one argument.
+const DefaultMaxCommandBytes = 128 << 10
+
+// DefaultMaxOutputBytes is how much of each stream a process retains.
+const DefaultMaxOutputBytes = 16 << 20
+
+// DefaultOptions returns the policy used when no flags override it.
+func DefaultOptions() Options {
+	return Options{
+		Priority:        DefaultPriorityPolicy(),
+		OpenFiles:       DefaultFDPolicy(),
+		MaxCommandBytes: DefaultMaxCommandBytes,
+		MaxOutputBytes:  DefaultMaxOutputBytes,
+		Workspace:       DefaultWorkspaceOptions(),
+		Subscribers:     DefaultSubscriberLimits(),
+		ProcessLogDir:   DefaultProcessLogDir(),
+	}
 }
 
 // Manager handles process creation and lifecycle.
 type Manager struct {
 	processes map[string]*Process
 	workspace string
+	opts      Options
 	mu        sync.RWMutex
+
+	changes     *changeFeed
+	stats       *managerStats
+	subscribers *subscriberPool
+	epoch       int64
+	redisFS     *RedisFSStatus    // attached mount, if any; see AttachRedisFS
+	sessions    map[string]string // session ID to cwd template; see SetSessionCwd
 }
 
 // NewManager creates a new process manager.
-func NewManager(workspace string) *Manager {
+func NewManager(workspace string, opts Options) *Manager {
 	return &Manager{
-		processes: make(map[string]*Process),
-		workspace: workspace,
+		processes:   make(map[string]*Process),
+		sessions:    make(map[string]string),
+		workspace:   workspace,
+		opts:        opts,
+		changes:     newChangeFeed(),
+		stats:       newManagerStats(),
+		subscribers: &subscriberPool{limits: opts.Subscribers},
+		epoch:       time.Now().UnixNano(),
 	}
 }
 
@@ -65,6 +217,31 @@ type LaunchOptions struct {
 	Timeout       time.Duration `json:"timeout,omitempty"`
 	Wait          bool          `json:"wait"`
 	KeepStdinOpen bool          `json:"keep_stdin_open,omitempty"`
+	Nice          *int          `json:"nice,omitempty"`
+	IONiceClass   string        `json:"ionice_class,omitempty"`
+	MaxOpenFiles  *int          `json:"max_open_files,omitempty"`
+
+	SecurityProfile string `json:"security_profile,omitempty"`
+	// TraceID correlates the process with the caller's trace. It is
+	// stored and reported back, never interpreted.
+	TraceID string `json:"trace_id,omitempty"`
+	// MergeOutput sends stdout and stderr to one buffer in the order they
+	// were written, reported as the combined stream.
+	MergeOutput bool `json:"merge_output,omitempty"`
+	// GracePeriod, when set, lets a timed-out process handle SIGTERM for
+	// that long before it is SIGKILLed.
+	GracePeriod time.Duration `json:"grace_period,omitempty"`
+	// SessionID groups launches of one client session. A launch in a
+	// session starts in the session's directory unless it gives a cwd;
+	// see SetSessionCwd.
+	SessionID string `json:"session_id,omitempty"`
+	// Env sets variables on top of the server's environment. Cwd and
+	// Env values may use the variables in TemplateVariables.
+	Env map[string]string `json:"env,omitempty"`
+	// Record runs the process on a pseudo-terminal and records what it
+	// shows as an asciinema cast; see Recording. Its output is the
+	// terminal's, so it is reported as the combined stream.
+	Record bool `json:"record,omitempty"`
 }
 
 // LaunchResult contains the result of launching a process.
@@ -75,31 +252,95 @@ type LaunchResult struct {
 	ExitCode int          `json:"exit_code,omitempty"`
 	Stdout   string       `json:"stdout,omitempty"`
 	Stderr   string       `json:"stderr,omitempty"`
+	Combined string       `json:"combined,omitempty"`
+	TraceID  string       `json:"trace_id,omitempty"`
+
+	TermSignal string `json:"term_signal,omitempty"`
+	OOMKilled  bool   `json:"oom_killed,omitempty"`
+	EndedBy    string `json:"ended_by,omitempty"`
+
+	Timing
+}
+
+// newProcessID returns a short random process ID.
+func newProcessID() string {
+	return uuid.New().String()[:8]
+}
+
+// validateCommand rejects commands exec would refuse or truncate before
+// anything is started.
+func (m *Manager) validateCommand(command string) error {
+	if command == "" {
+		return invalid("command", "is required")
+	}
+	if i := strings.IndexByte(command, 0); i >= 0 {
+		return invalid("command", "contains a NUL byte at offset %d", i)
+	}
+	if max := m.opts.MaxCommandBytes; max > 0 && len(command) > max {
+		return invalid("command", "is %d bytes, exceeding the %d byte limit", len(command), max)
+	}
+	return nil
 }
 
 // Launch starts a new process.
 func (m *Manager) Launch(ctx context.Context, opts LaunchOptions) (*LaunchResult, error) {
-	id := uuid.New().String()[:8]
-
-	cwd := opts.Cwd
-	if cwd == "" {
-		cwd = m.workspace
-	} else if cwd[0] != '/' {
-		cwd = m.workspace + "/" + cwd
+	id := newProcessID()
+	plan, err := m.planLaunch(opts, id)
+	if err != nil {
+		return nil, err
+	}
+	cwd, nice, ioClass, argv := plan.opts.Cwd, *plan.opts.Nice, plan.opts.IONiceClass, plan.argv
+	if plan.createCwd {
+		if err := os.MkdirAll(cwd, 0o755); err != nil {
+			return nil, fmt.Errorf("create session directory: %w", err)
+		}
 	}
 
-	cmd := exec.CommandContext(ctx, "sh", "-c", opts.Command)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	cmd.Dir = cwd
+	cmd.Env = environ(plan.opts.Env)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
-	stdout := &bytes.Buffer{}
-	stderr := &bytes.Buffer{}
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
+	stdout := m.newOutput()
+	stderr := m.newOutput()
+	var combined *outputBuffer
+	var master, tty *os.File
+	var recorder *castRecorder
+	recordingPath := filepath.Join(m.opts.ProcessLogDir, id+".cast")
+	if plan.opts.Record {
+		if master, tty, err = openPTY(castCols, castRows); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(m.opts.ProcessLogDir, 0o700); err != nil {
+			master.Close()
+			tty.Close()
+			return nil, fmt.Errorf("process log dir: %w", err)
+		}
+		if recorder, err = newCastRecorder(recordingPath, opts.Command, m.opts.MaxOutputBytes, time.Now()); err != nil {
+			master.Close()
+			tty.Close()
+			return nil, err
+		}
+		combined = m.newOutput()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+		cmd.SysProcAttr = ptyAttr()
+	} else if opts.MergeOutput {
+		// Given the same writer for both, exec hands the child a single
+		// pipe as stdout and stderr, so writes arrive in the order made.
+		combined = m.newOutput()
+		cmd.Stdout = combined
+		cmd.Stderr = combined
+	} else {
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+	}
 
 	var stdin io.WriteCloser
-	if opts.KeepStdinOpen {
-		var err error
+	if master != nil {
+		if opts.KeepStdinOpen {
+			stdin = ptyInput{master}
+		}
+	} else if opts.KeepStdinOpen {
 		stdin, err = cmd.StdinPipe()
 		if err != nil {
 			return nil, fmt.Errorf("stdin pipe: %w", err)
@@ -107,30 +348,88 @@ func (m *Manager) Launch(ctx context.Context, opts LaunchOptions) (*LaunchResult
 	}
 
 	proc := &Process{
-		ID:        id,
-		Command:   opts.Command,
-		Cwd:       cwd,
-		State:     StateRunning,
-		StartedAt: time.Now(),
-		cmd:       cmd,
-		stdout:    stdout,
-		stderr:    stderr,
-		stdin:     stdin,
-		done:      make(chan struct{}),
+		ID:          id,
+		Command:     opts.Command,
+		Cwd:         cwd,
+		State:       StateRunning,
+		StartedAt:   time.Now(),
+		Nice:        nice,
+		IONiceClass: ioClass,
+		TraceID:     opts.TraceID,
+		SessionID:   opts.SessionID,
+		MergeOutput: plan.opts.MergeOutput,
+		envNames:    sortedKeys(plan.opts.Env),
+		cmd:         cmd,
+		stdout:      stdout,
+		stderr:      stderr,
+		combined:    combined,
+		stdin:       stdin,
+		done:        make(chan struct{}),
+		stop:        make(chan stopRequest, 1),
+		grace:       plan.opts.GracePeriod,
+
+		pty:           master,
+		recorder:      recorder,
+		recordingPath: recordingPath,
 	}
+	if plan.profile != nil {
+		proc.SecurityProfile = plan.profile.Name
+	}
+	m.attachOutputs(proc)
 
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("start: %w", err)
+		if master != nil {
+			master.Close()
+			tty.Close()
+			recorder.Close()
+			os.Remove(recordingPath)
+		}
+		return nil, classifyStartError(err)
+	}
+	if master != nil {
+		// The child has its own copy of the terminal, which must close
+		// when the child's does.
+		tty.Close()
+		proc.ptyDone = make(chan struct{})
+		go proc.copyPTY(io.MultiWriter(combined, recorder))
 	}
 	proc.PID = cmd.Process.Pid
+	if _, start, err := readProcStat(proc.PID); err == nil {
+		proc.startTicks = start
+	}
+	proc.watchOOM()
+
+	if err := applyPriority(proc.PID, nice, ioClass); err != nil {
+		syscall.Kill(-proc.PID, syscall.SIGKILL)
+		cmd.Wait()
+		proc.discardPTY()
+		return nil, err
+	}
+	// Like the priority, the limit is applied just after the process
+	// starts; anything it forks in that instant keeps the server's limit.
+	if n := *plan.opts.MaxOpenFiles; n > 0 {
+		if proc.MaxOpenFiles, err = applyOpenFiles(proc.PID, n); err != nil {
+			syscall.Kill(-proc.PID, syscall.SIGKILL)
+			cmd.Wait()
+			proc.discardPTY()
+			return nil, err
+		}
+	}
+
+	proc.effective = captureEffective(proc, plan)
+	proc.monitored = true
 
 	m.mu.Lock()
 	m.processes[id] = proc
 	m.mu.Unlock()
+	m.changes.bump()
+	m.stats.launched()
+	m.logger().Info("process launched", proc.logAttrs("pid", proc.PID, "command", proc.Command, "cwd", cwd,
+		"argv", proc.effective.Argv, "interpreter", proc.effective.Interpreter, "env", proc.effective.Env)...)
 
-	go m.monitor(proc, opts.Timeout)
+	go m.monitor(proc, plan.opts.Timeout)
 
-	result := &LaunchResult{ID: id, PID: proc.PID, State: StateRunning}
+	result := &LaunchResult{ID: id, PID: proc.PID, State: StateRunning, TraceID: proc.TraceID}
 
 	if opts.Wait {
 		select {
@@ -140,11 +439,20 @@ func (m *Manager) Launch(ctx context.Context, opts LaunchOptions) (*LaunchResult
 		proc.mu.RLock()
 		result.State = proc.State
 		result.ExitCode = proc.ExitCode
-		result.Stdout = stdout.String()
-		result.Stderr = stderr.String()
+		result.TermSignal = proc.TermSignal
+		result.OOMKilled = proc.OOMKilled
+		result.EndedBy = proc.EndedBy
+		if combined != nil {
+			result.Combined = combined.String()
+		} else {
+			result.Stdout = stdout.String()
+			result.Stderr = stderr.String()
+		}
 		proc.mu.RUnlock()
 	}
+	proc.mu.RLock()
+	result.Timing = proc.timing(time.Now())
+	proc.mu.RUnlock()
 
 	return result, nil
 }
-
@@ -0,0 +1,136 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readProcStat returns the scheduler state letter and start time (in clock
+// ticks since boot) from /proc/<pid>/stat.
+func readProcStat(pid int) (byte, uint64, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command name may contain spaces and parentheses; fields resume
+	// after the last ')'.
+	s := string(b)
+	i := strings.LastIndexByte(s, ')')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(s[i+1:])
+	if len(fields) < 20 {
+		return 0, 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return fields[0][0], start, nil
+}
+
+// mountTable lists the calling process's mounts; tests point it at a
+// fixture.
+var mountTable = "/proc/self/mounts"
+
+// mountFSType returns the filesystem type mounted exactly at path, or
+// false when path is not a mountpoint.
+func mountFSType(path string) (string, bool, error) {
+	b, err := os.ReadFile(mountTable)
+	if err != nil {
+		return "", false, err
+	}
+	for _, ln := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(ln)
+		if len(fields) >= 3 && unescapeMountField(fields[1]) == path {
+			return fields[2], true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// unescapeMountField decodes the octal escapes (\040 for a space, and so
+// on) the kernel uses for whitespace in mount table paths.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// cgroupRoot is where the cgroup hierarchies are mounted; tests point it
+// at a fixture.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// oomCounterFile returns the file of pid's memory cgroup holding its
+// oom_kill count: memory.oom_control under cgroup v1, memory.events
+// under v2.
+func oomCounterFile(pid int) (string, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	var candidates []string
+	for _, ln := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		parts := strings.SplitN(ln, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[0] == "0" && parts[1] == "":
+			candidates = append(candidates,
+				filepath.Join(cgroupRoot, parts[2], "memory.events"),
+				filepath.Join(cgroupRoot, "unified", parts[2], "memory.events"))
+		case hasController(parts[1], "memory"):
+			// A v1 memory controller takes precedence over v2.
+			candidates = append([]string{filepath.Join(cgroupRoot, "memory", parts[2], "memory.oom_control")}, candidates...)
+		}
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("no memory cgroup found for pid %d", pid)
+}
+
+func hasController(list, name string) bool {
+	for _, c := range strings.Split(list, ",") {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readOOMKills returns the oom_kill count from a memory.events or
+// memory.oom_control file.
+func readOOMKills(file string) (uint64, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	for _, ln := range strings.Split(string(b), "\n") {
+		if v, ok := strings.CutPrefix(ln, "oom_kill "); ok {
+			return strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("%s has no oom_kill count", file)
+}
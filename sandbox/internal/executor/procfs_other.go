@@ -0,0 +1,21 @@
+//go:build !linux
+
+package executor
+
+import "errors"
+
+func readProcStat(pid int) (byte, uint64, error) {
+	return 0, 0, errors.New("process table inspection is not supported on this platform")
+}
+
+func mountFSType(path string) (string, bool, error) {
+	return "", false, errors.New("mount table inspection is not supported on this platform")
+}
+
+func oomCounterFile(pid int) (string, error) {
+	return "", errors.New("cgroup inspection is not supported on this platform")
+}
+
+func readOOMKills(file string) (uint64, error) {
+	return 0, errors.New("cgroup inspection is not supported on this platform")
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPTY allocates a pseudo-terminal of the given size, returning its
+// master side and the terminal a process is given.
+func openPTY(cols, rows uint16) (master, tty *os.File, err error) {
+	// The master is set up by descriptor and made non-blocking before it
+	// becomes an *os.File, so reads go through the poller and Close
+	// interrupts them.
+	fd, err := syscall.Open("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open pty: %w", err)
+	}
+	var unlock int32
+	var n uint32
+	ws := struct{ rows, cols, x, y uint16 }{rows, cols, 0, 0}
+	for _, op := range []struct {
+		req  uintptr
+		arg  unsafe.Pointer
+		what string
+	}{
+		{syscall.TIOCSPTLCK, unsafe.Pointer(&unlock), "unlock pty"},
+		{syscall.TIOCGPTN, unsafe.Pointer(&n), "pty number"},
+		{syscall.TIOCSWINSZ, unsafe.Pointer(&ws), "pty size"},
+	} {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), op.req, uintptr(op.arg)); errno != 0 {
+			syscall.Close(fd)
+			return nil, nil, fmt.Errorf("%s: %w", op.what, errno)
+		}
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, nil, fmt.Errorf("open pty: %w", err)
+	}
+	master = os.NewFile(uintptr(fd), "/dev/ptmx")
+	tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("open pty: %w", err)
+	}
+	return master, tty, nil
+}
+
+// ptyAttr makes the process a session leader with tty, its fd 0, as its
+// controlling terminal. Its process group is still its PID, as signals
+// to the group expect.
+func ptyAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+}
+
+const ptySupported = true
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package executor
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func openPTY(cols, rows uint16) (*os.File, *os.File, error) {
+	return nil, nil, errors.New("pseudo-terminals are not supported on this platform")
+}
+
+func ptyAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+const ptySupported = false
@@ -0,0 +1,231 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// A launch with Record runs on a pseudo-terminal, and everything the
+// terminal shows is written as an asciinema v2 cast to
+// <ProcessLogDir>/<id>.cast as it happens: a JSON header line, then one
+// [seconds, "o", data] line per read. The cast holds at most
+// MaxOutputBytes of output; past that it ends with a marker event.
+
+// CastContentType is the media type of an asciinema v2 recording.
+const CastContentType = "application/x-asciicast"
+
+// The terminal a recorded process is given.
+const (
+	castCols = 80
+	castRows = 24
+	castTerm = "xterm-256color"
+)
+
+// DefaultProcessLogDir is where per-process files such as recordings are
+// written unless Options.ProcessLogDir says otherwise.
+func DefaultProcessLogDir() string {
+	return filepath.Join(os.TempDir(), "sandbox-process-logs")
+}
+
+// RecordingInfo notes a process's recording in ProcessInfo.
+type RecordingInfo struct {
+	Bytes     int64 `json:"bytes"`
+	Truncated bool  `json:"truncated,omitempty"` // output past the cap was not recorded
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// castRecorder writes a cast as output arrives. Writes never fail: a
+// recording that cannot be written stops, and the process carries on.
+type castRecorder struct {
+	mu        sync.Mutex
+	f         *os.File
+	start     time.Time
+	last      float64 // seconds of the latest event, so times never go back
+	pending   []byte  // an incomplete UTF-8 sequence held for the next read
+	size      int64
+	output    int
+	max       int // output bytes recorded at most; 0 for no bound
+	truncated bool
+	closed    bool
+}
+
+func newCastRecorder(path, command string, max int, start time.Time) (*castRecorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create recording: %w", err)
+	}
+	r := &castRecorder{f: f, start: start, max: max}
+	header, _ := json.Marshal(castHeader{
+		Version:   2,
+		Width:     castCols,
+		Height:    castRows,
+		Timestamp: start.Unix(),
+		Command:   command,
+		Env:       map[string]string{"SHELL": "/bin/sh", "TERM": castTerm},
+	})
+	r.line(header)
+	return r, nil
+}
+
+func (r *castRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.truncated {
+		return len(p), nil
+	}
+	data := append(r.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[cut:]...)
+	r.record(data[:cut])
+	return len(p), nil
+}
+
+// record records one output event, or the truncation marker once the cap
+// is reached. The caller holds r.mu.
+func (r *castRecorder) record(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if r.max > 0 && r.output+len(data) > r.max {
+		r.truncated = true
+		r.event("m", fmt.Sprintf("recording truncated after %d bytes of output", r.output))
+		return
+	}
+	r.output += len(data)
+	r.event("o", string(data))
+}
+
+func (r *castRecorder) event(kind, data string) {
+	t := time.Since(r.start).Seconds()
+	if t < r.last {
+		t = r.last
+	}
+	r.last = t
+	line, _ := json.Marshal([]interface{}{json.Number(strconv.FormatFloat(t, 'f', 6, 64)), kind, data})
+	r.line(line)
+}
+
+func (r *castRecorder) line(b []byte) {
+	if r.f == nil {
+		return
+	}
+	n, err := r.f.Write(append(b, '\n'))
+	r.size += int64(n)
+	if err != nil {
+		r.f.Close()
+		r.f = nil
+	}
+}
+
+// Close records any held bytes and closes the file.
+func (r *castRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	if !r.truncated {
+		r.record(r.pending)
+	}
+	r.closed = true
+	if r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
+
+// recordingInfo describes the process's recording, or is nil without one.
+func (p *Process) recordingInfo() *RecordingInfo {
+	if p.recorder == nil {
+		return nil
+	}
+	return p.recorder.info()
+}
+
+func (r *castRecorder) info() *RecordingInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &RecordingInfo{Bytes: r.size, Truncated: r.truncated}
+}
+
+// Recording opens the cast of a process launched with Record. It may
+// still be growing while the process runs.
+func (m *Manager) Recording(id string) (*os.File, error) {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+	if proc.recorder == nil {
+		return nil, fmt.Errorf("process %s was not recorded", id)
+	}
+	return os.Open(proc.recordingPath)
+}
+
+// ptyDrainWait bounds how long a terminal's output is read after its
+// process exits, should something the process started hold it open.
+const ptyDrainWait = 2 * time.Second
+
+// copyPTY reads the terminal's output into w until the terminal closes.
+func (p *Process) copyPTY(w io.Writer) {
+	defer close(p.ptyDone)
+	io.Copy(w, p.pty)
+}
+
+// closePTY ends the terminal of a Record process that has exited: once
+// its output is drained, or after ptyDrainWait, the terminal and the
+// recording are closed.
+func (p *Process) closePTY() {
+	if p.pty == nil {
+		return
+	}
+	select {
+	case <-p.ptyDone:
+	case <-time.After(ptyDrainWait):
+	}
+	p.pty.Close()
+	<-p.ptyDone
+	p.recorder.Close()
+}
+
+// discardPTY closes the terminal of a process Launch gave up on, and
+// removes its recording.
+func (p *Process) discardPTY() {
+	if p.pty != nil {
+		p.closePTY()
+		os.Remove(p.recordingPath)
+	}
+}
+
+// ptyInput is the stdin of a process on a pseudo-terminal: writes go to
+// the terminal, which closePTY closes once the process is gone.
+type ptyInput struct{ f *os.File }
+
+func (p ptyInput) Write(b []byte) (int, error) { return p.f.Write(b) }
+
+func (p ptyInput) Close() error { return nil }
@@ -0,0 +1,159 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readCast parses a cast into its header and events, checking that event
+// times never go back.
+func readCast(t *testing.T, r io.Reader) (castHeader, [][3]interface{}) {
+	t.Helper()
+	sc := bufio.NewScanner(r)
+	if !sc.Scan() {
+		t.Fatal("empty cast")
+	}
+	var header castHeader
+	if err := json.Unmarshal(sc.Bytes(), &header); err != nil {
+		t.Fatalf("header %s: %v", sc.Bytes(), err)
+	}
+	var events [][3]interface{}
+	last := 0.0
+	for sc.Scan() {
+		var ev [3]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("event %s: %v", sc.Bytes(), err)
+		}
+		at, ok := ev[0].(float64)
+		if !ok || at < last {
+			t.Fatalf("event %s: time %v after %v", sc.Bytes(), ev[0], last)
+		}
+		last = at
+		events = append(events, ev)
+	}
+	return header, events
+}
+
+func TestCastRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.cast")
+	r, err := newCastRecorder(path, "echo", 10, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A rune split across reads is held until it is whole.
+	r.Write([]byte("h\xc3"))
+	r.Write([]byte("\xa9llo"))
+	r.Write([]byte("this write passes the cap"))
+	r.Write([]byte("and is followed by nothing"))
+	r.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	header, events := readCast(t, f)
+	if header.Version != 2 || header.Width != castCols || header.Height != castRows || header.Timestamp == 0 {
+		t.Fatalf("header %+v", header)
+	}
+	if len(events) != 3 || events[0][2] != "h" || events[1][2] != "éllo" ||
+		events[2][1] != "m" || !strings.Contains(events[2][2].(string), "truncated after 6 bytes") {
+		t.Fatalf("events %v", events)
+	}
+	if info := r.info(); !info.Truncated || info.Bytes == 0 {
+		t.Fatalf("info %+v", info)
+	}
+}
+
+func TestRecordLaunch(t *testing.T) {
+	if !ptySupported {
+		t.Skip("pseudo-terminals are not supported")
+	}
+	opts := DefaultOptions()
+	opts.ProcessLogDir = t.TempDir()
+	m := NewManager(t.TempDir(), opts)
+	ctx := context.Background()
+
+	res, err := m.Launch(ctx, LaunchOptions{
+		Command: `[ -t 1 ] && echo "tty $TERM"; echo one; sleep 0.05; echo two >&2`,
+		Record:  true,
+		Wait:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res.Combined, "tty "+castTerm) || !strings.Contains(res.Combined, "two") {
+		t.Fatalf("combined output %q", res.Combined)
+	}
+
+	f, err := m.Recording(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	header, events := readCast(t, f)
+	if header.Command == "" || len(events) < 2 {
+		t.Fatalf("header %+v, events %v", header, events)
+	}
+	var shown strings.Builder
+	for _, ev := range events {
+		if ev[1] != "o" {
+			t.Fatalf("event %v", ev)
+		}
+		shown.WriteString(ev[2].(string))
+	}
+	if shown.String() != res.Combined {
+		t.Fatalf("recording shows %q, output is %q", shown.String(), res.Combined)
+	}
+	for _, p := range m.List() {
+		if p.ID == res.ID && (p.Recording == nil || p.Recording.Bytes == 0 || !p.MergeOutput) {
+			t.Fatalf("process info %+v", p)
+		}
+	}
+
+	plain, err := m.Launch(ctx, LaunchOptions{Command: "true", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Recording(plain.ID); err == nil {
+		t.Fatal("a process launched without record has a recording")
+	}
+}
+
+func TestRecordStdin(t *testing.T) {
+	if !ptySupported {
+		t.Skip("pseudo-terminals are not supported")
+	}
+	opts := DefaultOptions()
+	opts.ProcessLogDir = t.TempDir()
+	m := NewManager(t.TempDir(), opts)
+
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "cat", Record: true, KeepStdinOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.WriteInput(res.ID, "hi", WriteOptions{Line: true}); err != nil {
+		t.Fatal(err)
+	}
+	// ^D is end-of-file on a terminal.
+	if _, err := m.WriteInput(res.ID, "\x04", WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := m.Wait(ctx, res.ID)
+	if err != nil || out.State != StateExited {
+		t.Fatalf("wait: %+v, %v", out, err)
+	}
+	// The terminal echoes the input, then cat repeats it.
+	if strings.Count(out.Combined, "hi") != 2 {
+		t.Fatalf("combined output %q", out.Combined)
+	}
+}
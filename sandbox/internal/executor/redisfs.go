@@ -0,0 +1,128 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RedisFSLinkName is the workspace entry through which launches reach an
+// attached redis-fs mount: <workspace>/redis-fs.
+const RedisFSLinkName = "redis-fs"
+
+// redisFSProbeTimeout bounds the stat used to tell a live FUSE mount from
+// a dead one; a hung daemon can block it indefinitely.
+const redisFSProbeTimeout = 2 * time.Second
+
+// RedisFSStatus describes the attached redis-fs mount at the time it was
+// probed.
+type RedisFSStatus struct {
+	Mountpoint string `json:"mountpoint"`
+	Link       string `json:"link"`
+	Healthy    bool   `json:"healthy"`
+	Error      string `json:"error,omitempty"`
+}
+
+// AttachRedisFS exposes a live redis-fs FUSE mount to launches at
+// <workspace>/redis-fs. Launches whose working directory lies on it are
+// refused with a MountUnavailableError while the mount is down.
+func (m *Manager) AttachRedisFS(mountpoint string) error {
+	mountpoint, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return err
+	}
+	if err := probeRedisFS(mountpoint); err != nil {
+		return err
+	}
+
+	link := filepath.Join(m.workspace, RedisFSLinkName)
+	if target, err := os.Readlink(link); err == nil {
+		if target != mountpoint {
+			return fmt.Errorf("%s already links to %s", link, target)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s exists and is not a link to the mount", link)
+	} else if err := os.Symlink(mountpoint, link); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.redisFS = &RedisFSStatus{Mountpoint: mountpoint, Link: link}
+	m.mu.Unlock()
+	return nil
+}
+
+// RedisFS probes the attached mount and reports its health, or returns
+// nil when none is attached.
+func (m *Manager) RedisFS() *RedisFSStatus {
+	m.mu.RLock()
+	attached := m.redisFS
+	m.mu.RUnlock()
+	if attached == nil {
+		return nil
+	}
+	st := *attached
+	if err := probeRedisFS(st.Mountpoint); err != nil {
+		st.Error = err.Error()
+	} else {
+		st.Healthy = true
+	}
+	return &st
+}
+
+// checkRedisFSCwd refuses a working directory on the attached mount while
+// the mount is unhealthy.
+func (m *Manager) checkRedisFSCwd(cwd string) error {
+	m.mu.RLock()
+	attached := m.redisFS
+	m.mu.RUnlock()
+	if attached == nil {
+		return nil
+	}
+	cwd = filepath.Clean(cwd)
+	if !pathWithin(cwd, attached.Link) && !pathWithin(cwd, attached.Mountpoint) {
+		return nil
+	}
+	if err := probeRedisFS(attached.Mountpoint); err != nil {
+		return &MountUnavailableError{Mountpoint: attached.Mountpoint, Reason: err.Error()}
+	}
+	return nil
+}
+
+func pathWithin(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// probeRedisFS checks that a FUSE filesystem is mounted at path and
+// answers a stat. A daemon that died leaves the mount in the table but
+// fails every call with ENOTCONN.
+func probeRedisFS(path string) error {
+	fstype, mounted, err := mountFSType(path)
+	if err != nil {
+		return fmt.Errorf("read mount table: %w", err)
+	}
+	if !mounted {
+		return fmt.Errorf("%s is not a mountpoint", path)
+	}
+	if fstype != "fuse" && !strings.HasPrefix(fstype, "fuse.") {
+		return fmt.Errorf("%s is a %s mount, not FUSE", path, fstype)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := os.Stat(path)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("not responding: %w", err)
+		}
+		return nil
+	case <-time.After(redisFSProbeTimeout):
+		return fmt.Errorf("not responding within %s", redisFSProbeTimeout)
+	}
+}
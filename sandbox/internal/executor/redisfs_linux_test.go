@@ -0,0 +1,88 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeMount makes dir look like a redis-fs FUSE mount by listing it in a
+// fixture mount table, and returns a function that removes it again.
+func fakeMount(t *testing.T, dir string) (unmount func()) {
+	t.Helper()
+	table := filepath.Join(t.TempDir(), "mounts")
+	write := func(entries string) {
+		if err := os.WriteFile(table, []byte("proc /proc proc rw 0 0\n"+entries), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	escaped := strings.ReplaceAll(dir, " ", `\040`)
+	write("redis-fs:docs " + escaped + " fuse.redis-fs rw,nosuid,nodev 0 0\n")
+	old := mountTable
+	mountTable = table
+	t.Cleanup(func() { mountTable = old })
+	return func() { write("") }
+}
+
+func TestRedisFSMountLifecycle(t *testing.T) {
+	ws := t.TempDir()
+	mnt := filepath.Join(t.TempDir(), "redis fs")
+	if err := os.Mkdir(mnt, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mnt, "notes.txt"), []byte("stored in redis\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(ws, DefaultOptions())
+
+	if err := m.AttachRedisFS(mnt); err == nil {
+		t.Fatal("attached a directory that is not mounted")
+	}
+	unmount := fakeMount(t, mnt)
+	if err := m.AttachRedisFS(mnt); err != nil {
+		t.Fatal(err)
+	}
+	if st := m.RedisFS(); st == nil || !st.Healthy || st.Link != filepath.Join(ws, RedisFSLinkName) {
+		t.Fatalf("status %+v", st)
+	}
+
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "cat notes.txt", Cwd: RedisFSLinkName, Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stdout != "stored in redis\n" {
+		t.Fatalf("launch through the link: %+v", res)
+	}
+
+	unmount()
+	if st := m.RedisFS(); st.Healthy || st.Error == "" {
+		t.Fatalf("status after unmount %+v", st)
+	}
+	for _, cwd := range []string{RedisFSLinkName, RedisFSLinkName + "/sub", mnt} {
+		_, err := m.Launch(context.Background(), LaunchOptions{Command: "true", Cwd: cwd})
+		var merr *MountUnavailableError
+		if !errors.As(err, &merr) {
+			t.Errorf("cwd %s: err = %v, want MountUnavailableError", cwd, err)
+		}
+	}
+	// Launches elsewhere in the workspace are unaffected.
+	if _, err := m.Launch(context.Background(), LaunchOptions{Command: "true", Wait: true}); err != nil {
+		t.Fatalf("launch outside the mount: %v", err)
+	}
+}
+
+func TestMountFSTypeRejectsOtherFilesystems(t *testing.T) {
+	dir := t.TempDir()
+	table := filepath.Join(t.TempDir(), "mounts")
+	os.WriteFile(table, []byte("tmpfs "+dir+" tmpfs rw 0 0\n"), 0o644)
+	old := mountTable
+	mountTable = table
+	defer func() { mountTable = old }()
+
+	if err := probeRedisFS(dir); err == nil || !strings.Contains(err.Error(), "not FUSE") {
+		t.Fatalf("probe of a tmpfs mount: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package executor
+
+import "syscall"
+
+const auditArch = auditArchX8664
+
+// syscallNumbers names the syscalls a profile may deny. It is limited to
+// calls that are both meaningful to block and numbered on every supported
+// architecture.
+var syscallNumbers = map[string]int{
+	"accept":            syscall.SYS_ACCEPT,
+	"accept4":           syscall.SYS_ACCEPT4,
+	"acct":              syscall.SYS_ACCT,
+	"add_key":           syscall.SYS_ADD_KEY,
+	"bind":              syscall.SYS_BIND,
+	"chroot":            syscall.SYS_CHROOT,
+	"clock_settime":     syscall.SYS_CLOCK_SETTIME,
+	"connect":           syscall.SYS_CONNECT,
+	"delete_module":     syscall.SYS_DELETE_MODULE,
+	"init_module":       syscall.SYS_INIT_MODULE,
+	"kexec_load":        syscall.SYS_KEXEC_LOAD,
+	"keyctl":            syscall.SYS_KEYCTL,
+	"listen":            syscall.SYS_LISTEN,
+	"mount":             syscall.SYS_MOUNT,
+	"perf_event_open":   syscall.SYS_PERF_EVENT_OPEN,
+	"personality":       syscall.SYS_PERSONALITY,
+	"pivot_root":        syscall.SYS_PIVOT_ROOT,
+	"process_vm_readv":  310,
+	"process_vm_writev": 311,
+	"ptrace":            syscall.SYS_PTRACE,
+	"quotactl":          syscall.SYS_QUOTACTL,
+	"reboot":            syscall.SYS_REBOOT,
+	"recvfrom":          syscall.SYS_RECVFROM,
+	"recvmsg":           syscall.SYS_RECVMSG,
+	"request_key":       syscall.SYS_REQUEST_KEY,
+	"sendmsg":           syscall.SYS_SENDMSG,
+	"sendto":            syscall.SYS_SENDTO,
+	"setdomainname":     syscall.SYS_SETDOMAINNAME,
+	"sethostname":       syscall.SYS_SETHOSTNAME,
+	"setns":             308,
+	"settimeofday":      syscall.SYS_SETTIMEOFDAY,
+	"socket":            syscall.SYS_SOCKET,
+	"socketpair":        syscall.SYS_SOCKETPAIR,
+	"swapoff":           syscall.SYS_SWAPOFF,
+	"swapon":            syscall.SYS_SWAPON,
+	"umount2":           syscall.SYS_UMOUNT2,
+	"uname":             syscall.SYS_UNAME,
+	"unshare":           syscall.SYS_UNSHARE,
+}
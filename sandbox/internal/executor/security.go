@@ -0,0 +1,171 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// DefaultSecurityProfile is applied to launches that do not name a
+// profile, if the server defines one with this name.
+const DefaultSecurityProfile = "default"
+
+// SecurityProfile restricts what a launched process may do beyond its
+// resource limits. Profiles are declared by the operator; launches can
+// only select among them.
+type SecurityProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// RestrictWrites confines file writes, creation, and removal to the
+	// working directory, the temporary directory, /dev/null, and Writable,
+	// using Landlock. Reads are unaffected.
+	RestrictWrites bool     `json:"restrict_writes"`
+	Writable       []string `json:"writable,omitempty"`
+
+	// DenySyscalls are made to fail with EPERM by a seccomp filter.
+	DenySyscalls []string `json:"deny_syscalls,omitempty"`
+}
+
+// maxDeniedSyscalls keeps the seccomp filter's jump offsets within the
+// 8-bit range BPF allows.
+const maxDeniedSyscalls = 200
+
+var profileNameRE = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// LoadSecurityProfiles reads a JSON array of profiles and validates it.
+func LoadSecurityProfiles(path string) ([]SecurityProfile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []SecurityProfile
+	if err := json.Unmarshal(b, &profiles); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := ValidateSecurityProfiles(profiles); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return profiles, nil
+}
+
+// ValidateSecurityProfiles checks names are unique and every path and
+// syscall a profile mentions is usable.
+func ValidateSecurityProfiles(profiles []SecurityProfile) error {
+	seen := map[string]bool{}
+	for _, p := range profiles {
+		if !profileNameRE.MatchString(p.Name) {
+			return fmt.Errorf("profile name %q must be lowercase letters, digits, '-' or '_'", p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("profile %q is defined twice", p.Name)
+		}
+		seen[p.Name] = true
+
+		if len(p.Writable) > 0 && !p.RestrictWrites {
+			return fmt.Errorf("profile %q: writable requires restrict_writes", p.Name)
+		}
+		for _, w := range p.Writable {
+			if !filepath.IsAbs(w) {
+				return fmt.Errorf("profile %q: writable path %q must be absolute", p.Name, w)
+			}
+		}
+		if len(p.DenySyscalls) > maxDeniedSyscalls {
+			return fmt.Errorf("profile %q: at most %d syscalls may be denied", p.Name, maxDeniedSyscalls)
+		}
+		for _, name := range p.DenySyscalls {
+			if name == "execve" || name == "execveat" {
+				return fmt.Errorf("profile %q: denying %s would prevent the command from starting", p.Name, name)
+			}
+		}
+		if err := validateSyscallNames(p.DenySyscalls); err != nil {
+			return fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// Supported reports whether this host can enforce the profile.
+func (p SecurityProfile) Supported() error {
+	if p.RestrictWrites && !landlockSupported() {
+		return &UnsupportedError{Feature: "landlock", Message: fmt.Sprintf("security profile %q restricts writes, but Landlock is not available on this host", p.Name)}
+	}
+	if len(p.DenySyscalls) > 0 && !seccompSupported() {
+		return &UnsupportedError{Feature: "seccomp", Message: fmt.Sprintf("security profile %q filters syscalls, but seccomp is not available on this host", p.Name)}
+	}
+	return nil
+}
+
+// resolveSecurityProfile picks the profile for a launch: the one named,
+// or the server default when none is named.
+func (m *Manager) resolveSecurityProfile(name string) (*SecurityProfile, error) {
+	lookup := name
+	if lookup == "" {
+		lookup = DefaultSecurityProfile
+	}
+	for i := range m.opts.SecurityProfiles {
+		if p := &m.opts.SecurityProfiles[i]; p.Name == lookup {
+			if err := p.Supported(); err != nil {
+				return nil, err
+			}
+			return p, nil
+		}
+	}
+	if name == "" {
+		return nil, nil
+	}
+	return nil, invalid("security_profile", "unknown profile %q", name)
+}
+
+// securityHelperArg marks a re-execution of the server binary that applies
+// a profile to itself and then execs the command. Landlock and seccomp
+// restrict the calling thread, so they cannot be applied to a child from
+// the outside.
+const securityHelperArg = "__sandbox-exec"
+
+// helperSpec is what the parent passes to the helper on its command line.
+type helperSpec struct {
+	Writable     []string `json:"writable,omitempty"`
+	RestrictFS   bool     `json:"restrict_fs,omitempty"`
+	DenySyscalls []string `json:"deny_syscalls,omitempty"`
+}
+
+// securedArgs returns the argv that runs argv under profile.
+func securedArgs(p *SecurityProfile, cwd string, argv []string) ([]string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("locate server binary for security helper: %w", err)
+	}
+	spec := helperSpec{RestrictFS: p.RestrictWrites, DenySyscalls: p.DenySyscalls}
+	if p.RestrictWrites {
+		spec.Writable = append([]string{cwd, os.TempDir(), "/dev/null"}, p.Writable...)
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{self, securityHelperArg, string(b)}, argv...), nil
+}
+
+// MaybeRunSecurityHelper turns the process into the security helper when
+// it was started as one, and otherwise returns immediately. Binaries that
+// host a Manager with security profiles must call it first thing in main.
+func MaybeRunSecurityHelper() {
+	if len(os.Args) < 4 || os.Args[1] != securityHelperArg {
+		return
+	}
+	var spec helperSpec
+	if err := json.Unmarshal([]byte(os.Args[2]), &spec); err != nil {
+		helperFail(fmt.Errorf("bad spec: %w", err))
+	}
+	helperFail(runSecurityHelper(spec, os.Args[3:]))
+}
+
+// helperFail reports on the command's stderr, where the caller will see
+// it, and exits like a shell that could not run the command.
+func helperFail(err error) {
+	fmt.Fprintf(os.Stderr, "sandbox: security profile: %v\n", err)
+	os.Exit(126)
+}
@@ -0,0 +1,214 @@
+//go:build linux
+
+package executor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+
+	oPath = 0x200000 // O_PATH; not exported by package syscall
+
+	prSetNoNewPrivs = 38
+	prGetSeccomp    = 21
+	prSetSeccomp    = 22
+	seccompModeFilt = 2
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+	x32SyscallBit         = 0x40000000
+
+	auditArchX8664   = 0xc000003e
+	auditArchAArch64 = 0xc00000b7
+)
+
+// Landlock filesystem access rights that modify the tree.
+const (
+	llWriteFile  = 1 << 1
+	llRemoveDir  = 1 << 4
+	llRemoveFile = 1 << 5
+	llMakeChar   = 1 << 6
+	llMakeDir    = 1 << 7
+	llMakeReg    = 1 << 8
+	llMakeSock   = 1 << 9
+	llMakeFifo   = 1 << 10
+	llMakeBlock  = 1 << 11
+	llMakeSym    = 1 << 12
+	llRefer      = 1 << 13 // ABI 2
+	llTruncate   = 1 << 14 // ABI 3
+
+	llDirWrites  = llWriteFile | llRemoveDir | llRemoveFile | llMakeChar | llMakeDir | llMakeReg | llMakeSock | llMakeFifo | llMakeBlock | llMakeSym
+	llFileWrites = llWriteFile
+)
+
+// landlockABI returns the kernel's Landlock ABI version, or 0 when
+// Landlock is not built in or not enabled.
+func landlockABI() int {
+	v, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0
+	}
+	return int(v)
+}
+
+func landlockSupported() bool { return landlockABI() > 0 }
+
+func seccompSupported() bool {
+	if auditArch == 0 {
+		return false
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prGetSeccomp, 0, 0)
+	return errno == 0
+}
+
+func validateSyscallNames(names []string) error {
+	for _, n := range names {
+		if _, ok := syscallNumbers[n]; !ok {
+			return fmt.Errorf("unknown or unsupported syscall %q", n)
+		}
+	}
+	return nil
+}
+
+// runSecurityHelper restricts the current thread and execs argv on it, so
+// the command inherits the restrictions. It only returns on failure.
+func runSecurityHelper(spec helperSpec, argv []string) error {
+	runtime.LockOSThread()
+
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	if spec.RestrictFS {
+		if err := restrictWrites(spec.Writable); err != nil {
+			return fmt.Errorf("landlock: %w", err)
+		}
+	}
+	if len(spec.DenySyscalls) > 0 {
+		if err := denySyscalls(spec.DenySyscalls); err != nil {
+			return fmt.Errorf("seccomp: %w", err)
+		}
+	}
+
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, argv, syscall.Environ())
+}
+
+// restrictWrites installs a Landlock ruleset that handles every write
+// right the kernel knows, then grants them back beneath writable.
+func restrictWrites(writable []string) error {
+	abi := landlockABI()
+	if abi == 0 {
+		return syscall.ENOSYS
+	}
+	handled := uint64(llDirWrites)
+	if abi >= 2 {
+		handled |= llRefer
+	}
+	if abi >= 3 {
+		handled |= llTruncate
+	}
+
+	// struct landlock_ruleset_attr; only handled_access_fs is set, so the
+	// ABI 1 size is passed and later fields stay at their defaults.
+	attr := handled
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), 8, 0)
+	if errno != 0 {
+		return fmt.Errorf("create ruleset: %w", errno)
+	}
+	defer syscall.Close(int(fd))
+
+	for _, p := range writable {
+		if err := addPathRule(int(fd), p, handled); err != nil {
+			return fmt.Errorf("allow %s: %w", p, err)
+		}
+	}
+	if _, _, errno := syscall.Syscall(sysLandlockRestrictSelf, fd, 0, 0); errno != 0 {
+		return fmt.Errorf("restrict self: %w", errno)
+	}
+	return nil
+}
+
+func addPathRule(ruleset int, path string, handled uint64) error {
+	pfd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err == syscall.ENOENT {
+		return nil // nothing to grant on a path that does not exist
+	}
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(pfd)
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(pfd, &st); err != nil {
+		return err
+	}
+	allowed := handled
+	if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		// Directory rights on a file rule are rejected with EINVAL.
+		allowed &= llFileWrites | llTruncate
+	}
+
+	// struct landlock_path_beneath_attr is packed: u64 allowed_access
+	// followed by s32 parent_fd.
+	var attr [12]byte
+	binary.NativeEndian.PutUint64(attr[0:8], allowed)
+	binary.NativeEndian.PutUint32(attr[8:12], uint32(int32(pfd)))
+	_, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr[0])), 0, 0, 0)
+	runtime.KeepAlive(&attr)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// denySyscalls installs a seccomp filter that fails the named syscalls
+// with EPERM and allows everything else. Calls made under a foreign
+// architecture's ABI are killed rather than interpreted with the wrong
+// numbering.
+func denySyscalls(names []string) error {
+	n := len(names)
+	prog := []syscall.SockFilter{
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: 4}, // arch
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, K: auditArch, Jt: 1},
+		{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetKillProcess},
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: 0}, // nr
+	}
+	if auditArch == auditArchX8664 {
+		prog = append(prog, syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K, K: x32SyscallBit, Jt: uint8(n + 1)})
+	}
+	for i, name := range names {
+		prog = append(prog, syscall.SockFilter{
+			Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K,
+			K:    uint32(syscallNumbers[name]),
+			Jt:   uint8(n - i),
+		})
+	}
+	prog = append(prog,
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetAllow},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetErrno | uint32(syscall.EPERM)},
+	)
+
+	fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilt, uintptr(unsafe.Pointer(&fprog)))
+	runtime.KeepAlive(prog)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
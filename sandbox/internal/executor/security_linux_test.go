@@ -0,0 +1,79 @@
+//go:build linux
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestrictedProcessCannotWriteOutsideCwd(t *testing.T) {
+	if !landlockSupported() {
+		t.Skip("Landlock is not available")
+	}
+	ws := t.TempDir()
+	outside := t.TempDir()
+	// Keep the temporary directory, which the profile leaves writable,
+	// away from outside.
+	t.Setenv("TMPDIR", filepath.Join(ws, "tmp"))
+
+	opts := DefaultOptions()
+	opts.SecurityProfiles = []SecurityProfile{{Name: "default", RestrictWrites: true}}
+	m := NewManager(ws, opts)
+
+	res, err := m.Launch(context.Background(), LaunchOptions{
+		Command: "echo in > inside.txt; echo out > " + filepath.Join(outside, "escape.txt") + "; echo discarded > /dev/null",
+		Wait:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "inside.txt")); err != nil {
+		t.Errorf("write inside cwd failed: %v (stderr %q)", err, res.Stderr)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "escape.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("write outside cwd succeeded")
+	}
+	if !strings.Contains(res.Stderr, "Permission denied") {
+		t.Errorf("stderr = %q, want a permission error for the escaping write", res.Stderr)
+	}
+	if strings.Contains(res.Stderr, "/dev/null") {
+		t.Errorf("/dev/null was not writable: %q", res.Stderr)
+	}
+
+	// Without a profile name the default applies, and it is recorded.
+	for _, p := range m.List() {
+		if p.ID == res.ID && p.SecurityProfile != "default" {
+			t.Errorf("ProcessInfo.SecurityProfile = %q, want default", p.SecurityProfile)
+		}
+	}
+}
+
+func TestSecurityProfileDeniesSyscalls(t *testing.T) {
+	if !seccompSupported() {
+		t.Skip("seccomp is not available")
+	}
+	opts := DefaultOptions()
+	opts.SecurityProfiles = []SecurityProfile{{Name: "no-uname", DenySyscalls: []string{"uname"}}}
+	m := NewManager(t.TempDir(), opts)
+
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "uname -s", Wait: true, SecurityProfile: "no-uname"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode == 0 {
+		t.Fatalf("uname succeeded under a filter denying it: %q", res.Stdout)
+	}
+
+	res, err = m.Launch(context.Background(), LaunchOptions{Command: "uname -s", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 0 {
+		t.Fatalf("unprofiled uname failed: %q", res.Stderr)
+	}
+}
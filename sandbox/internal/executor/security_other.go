@@ -0,0 +1,17 @@
+//go:build !linux
+
+package executor
+
+import "errors"
+
+func landlockSupported() bool { return false }
+
+func seccompSupported() bool { return false }
+
+// Syscall names are not checked where seccomp is unavailable; such
+// profiles are rejected at launch instead.
+func validateSyscallNames(names []string) error { return nil }
+
+func runSecurityHelper(spec helperSpec, argv []string) error {
+	return errors.New("security profiles are not supported on this platform")
+}
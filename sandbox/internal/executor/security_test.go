@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+// Launches under a security profile re-execute the test binary as the
+// helper, just as the server binary is re-executed in production.
+func TestMain(m *testing.M) {
+	MaybeRunSecurityHelper()
+	os.Exit(m.Run())
+}
+
+func TestValidateSecurityProfiles(t *testing.T) {
+	bad := map[string][]SecurityProfile{
+		"bad name":          {{Name: "No Spaces"}},
+		"duplicate":         {{Name: "a"}, {Name: "a"}},
+		"relative writable": {{Name: "a", RestrictWrites: true, Writable: []string{"tmp"}}},
+		"writable unused":   {{Name: "a", Writable: []string{"/tmp"}}},
+		"deny execve":       {{Name: "a", DenySyscalls: []string{"execve"}}},
+	}
+	for name, profiles := range bad {
+		if err := ValidateSecurityProfiles(profiles); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	ok := []SecurityProfile{
+		{Name: "default", RestrictWrites: true},
+		{Name: "compute-only", RestrictWrites: true, Writable: []string{"/var/cache/build"}},
+	}
+	if err := ValidateSecurityProfiles(ok); err != nil {
+		t.Errorf("valid profiles rejected: %v", err)
+	}
+}
+
+func TestLaunchUnknownSecurityProfile(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	_, err := m.Launch(context.Background(), LaunchOptions{Command: "true", SecurityProfile: "missing"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Field != "security_profile" {
+		t.Fatalf("err = %v, want security_profile validation error", err)
+	}
+}
@@ -0,0 +1,113 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+)
+
+// StartSweeper periodically cross-checks running process records against
+// the OS process table until ctx is cancelled.
+func (m *Manager) StartSweeper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.sweep()
+			}
+		}
+	}()
+}
+
+// sweep marks running records whose process has vanished, been replaced by
+// an unrelated process, or sat unreaped as a zombie as lost, and releases
+// anyone waiting on them. A record whose monitor is still waiting is left
+// to the monitor, and a monitor that panics marks its record lost itself
+// (see recoverMonitor), so the sweep catches records no monitor is
+// waiting on. Live processes have their open descriptors counted.
+func (m *Manager) sweep() {
+	m.mu.RLock()
+	procs := make([]*Process, 0, len(m.processes))
+	for _, p := range m.processes {
+		procs = append(procs, p)
+	}
+	m.mu.RUnlock()
+
+	for _, proc := range procs {
+		if proc.cancel != nil {
+			continue // native processes such as tails have no pid to check
+		}
+		proc.mu.RLock()
+		running := proc.State == StateRunning || proc.State == StatePaused
+		pid, startTicks, monitored := proc.PID, proc.startTicks, proc.monitored
+		proc.mu.RUnlock()
+		if !running {
+			continue
+		}
+
+		reason := ""
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			reason = "process no longer exists"
+		} else if state, start, err := readProcStat(pid); err == nil {
+			switch {
+			case startTicks != 0 && start != startTicks:
+				reason = "pid now belongs to a different process"
+			case state == 'Z':
+				proc.mu.Lock()
+				if proc.zombieSweeps++; proc.zombieSweeps > 1 {
+					reason = "process exited but was never reaped"
+				}
+				proc.mu.Unlock()
+			}
+		}
+		// cmd.Wait reaps the pid before it finishes copying output
+		// from pipes a background grandchild may still hold open, so a
+		// gone or reused pid with its monitor still waiting has exited,
+		// not been lost; the monitor records how.
+		if reason != "" && monitored {
+			continue
+		}
+		if reason == "" {
+			proc.watchOOM()
+			if n, err := countOpenFDs(pid); err == nil {
+				proc.mu.Lock()
+				proc.OpenFDs = &n
+				proc.mu.Unlock()
+			}
+			continue
+		}
+
+		m.markLost(proc, reason)
+	}
+}
+
+// markLost records that proc was lost for reason and releases anyone
+// waiting on it. A record that has ended meanwhile is left as it is.
+func (m *Manager) markLost(proc *Process, reason string) {
+	proc.mu.Lock()
+	lost := proc.State == StateRunning || proc.State == StatePaused
+	var ran time.Duration
+	if lost {
+		now := time.Now()
+		proc.setState(StateLost, now)
+		proc.LostReason = reason
+		proc.EndedAt = &now
+		proc.ExitCode = -1
+		ran = proc.runTime(now)
+	}
+	proc.mu.Unlock()
+	proc.finish()
+	if lost {
+		m.stats.exited(ExitLost, ran)
+		m.changes.bump()
+		m.logger().Warn("process lost", proc.logAttrs("reason", reason)...)
+	}
+}
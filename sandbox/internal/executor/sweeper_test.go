@@ -0,0 +1,118 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSweepMarksVanishedProcessLost(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+
+	// A finished child whose record still claims to be running, as if the
+	// monitor goroutine had died before noticing the exit.
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "true", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := &Process{
+		ID:        "ghost",
+		Command:   "sleep 100",
+		State:     StateRunning,
+		StartedAt: time.Now(),
+		PID:       res.PID,
+		stdout:    newOutputBuffer(0),
+		stderr:    newOutputBuffer(0),
+		done:      make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.processes[proc.ID] = proc
+	m.mu.Unlock()
+
+	m.sweep()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := m.Wait(ctx, proc.ID)
+	if err != nil {
+		t.Fatalf("Wait on lost process: %v", err)
+	}
+	if got.State != StateLost || got.LostReason == "" {
+		t.Fatalf("state = %q reason = %q, want lost with reason", got.State, got.LostReason)
+	}
+}
+
+func TestSweepLeavesLiveProcessAlone(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "sleep 5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Kill(res.ID)
+
+	m.sweep()
+	m.sweep()
+
+	got, err := m.Read(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != StateRunning {
+		t.Fatalf("state = %q, want running", got.State)
+	}
+}
+
+func TestSweepLeavesReapedProcessToMonitor(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+
+	// sh exits at once, but the background sleep holds stdout open, so
+	// cmd.Wait has reaped the pid and is still copying output.
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "sleep 2 & echo hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	m.sweep()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := m.Wait(ctx, res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != StateExited || got.ExitCode != 0 || got.Stdout != "hi\n" {
+		t.Fatalf("state = %q exit = %d stdout = %q reason = %q, want exited 0 with hi", got.State, got.ExitCode, got.Stdout, got.LostReason)
+	}
+}
+
+func TestMonitorPanicMarksProcessLost(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	proc := &Process{
+		ID:        "panicky",
+		Command:   "sleep 100",
+		State:     StateRunning,
+		StartedAt: time.Now(),
+		stdout:    newOutputBuffer(0),
+		stderr:    newOutputBuffer(0),
+		done:      make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.processes[proc.ID] = proc
+	m.mu.Unlock()
+
+	func() {
+		defer m.recoverMonitor(proc)
+		panic("boom")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := m.Wait(ctx, proc.ID)
+	if err != nil {
+		t.Fatalf("Wait after the monitor panicked: %v", err)
+	}
+	if got.State != StateLost || !strings.Contains(got.LostReason, "boom") {
+		t.Fatalf("state = %q reason = %q, want lost with the panic", got.State, got.LostReason)
+	}
+}
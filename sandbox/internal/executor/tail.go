@@ -0,0 +1,241 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultTailLines is how many trailing lines a tail starts with when the
+// request does not say.
+const DefaultTailLines = 10
+
+// tailPollInterval is how often a follow checks its file for growth,
+// truncation, or replacement.
+const tailPollInterval = 250 * time.Millisecond
+
+// TailOptions configures a managed tail of a workspace file.
+type TailOptions struct {
+	Path   string `json:"path"`
+	Lines  int    `json:"lines,omitempty"`
+	Follow bool   `json:"follow,omitempty"`
+}
+
+// TailFile starts a native tail of a file inside the workspace. It is
+// tracked like any launched process, listed with the command
+// "tail:<path>", and its output is the file's content: streaming, reads,
+// and kill all work as usual. Without Follow it finishes once the initial
+// lines are emitted.
+func (m *Manager) TailFile(opts TailOptions) (*LaunchResult, error) {
+	path, err := m.workspacePath(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	lines := opts.Lines
+	if lines == 0 {
+		lines = DefaultTailLines
+	}
+	if lines < 0 {
+		return nil, invalid("lines", "must not be negative")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, invalid("path", "%s does not exist", opts.Path)
+		}
+		return nil, fmt.Errorf("open %s: %w", opts.Path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, invalid("path", "%s is not a regular file", opts.Path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	proc := &Process{
+		ID:        newProcessID(),
+		Command:   "tail:" + path,
+		Cwd:       m.workspace,
+		State:     StateRunning,
+		StartedAt: time.Now(),
+		stdout:    m.newOutput(),
+		stderr:    m.newOutput(),
+		done:      make(chan struct{}),
+		cancel:    cancel,
+	}
+
+	m.attachOutputs(proc)
+
+	offset := info.Size()
+	initial, err := lastLines(f, offset, lines)
+	if err != nil {
+		cancel()
+		f.Close()
+		return nil, fmt.Errorf("read %s: %w", opts.Path, err)
+	}
+	proc.stdout.Write(initial)
+
+	m.mu.Lock()
+	m.processes[proc.ID] = proc
+	m.mu.Unlock()
+	m.changes.bump()
+
+	result := &LaunchResult{ID: proc.ID, State: StateRunning}
+	if !opts.Follow {
+		f.Close()
+		m.endTail(proc, nil)
+		result.State = StateExited
+		result.Stdout = proc.stdout.String()
+		return result, nil
+	}
+	go m.follow(ctx, proc, path, f, info, offset)
+	return result, nil
+}
+
+// workspacePath resolves p, relative to the workspace unless absolute,
+// and rejects anything that lies outside the workspace once symlinks are
+// followed.
+func (m *Manager) workspacePath(p string) (string, error) {
+	if p == "" {
+		return "", invalid("path", "is required")
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(m.workspace, p)
+	}
+	root, err := filepath.EvalSymlinks(m.workspace)
+	if err != nil {
+		return "", fmt.Errorf("workspace: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", invalid("path", "%s does not exist", p)
+		}
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", invalid("path", "%s is outside the workspace", p)
+	}
+	return resolved, nil
+}
+
+// follow copies whatever is appended to path into proc's stdout until the
+// tail is killed. A truncated file is read again from the start and a
+// replaced one (log rotation) is reopened, as tail -F does.
+func (m *Manager) follow(ctx context.Context, proc *Process, path string, f *os.File, info os.FileInfo, offset int64) {
+	defer func() { f.Close() }()
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			m.endTail(proc, nil)
+			return
+		case <-ticker.C:
+		}
+
+		st, err := os.Stat(path)
+		if err != nil {
+			continue // rotated away; wait for the replacement
+		}
+		if !os.SameFile(st, info) {
+			nf, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			f.Close()
+			f, info, offset = nf, st, 0
+			fmt.Fprintf(proc.stderr, "tail: %s has been replaced; following the new file\n", path)
+		} else if st.Size() < offset {
+			offset = 0
+			fmt.Fprintf(proc.stderr, "tail: %s: file truncated\n", path)
+		}
+		if st.Size() > offset {
+			n, err := io.Copy(proc.stdout, io.NewSectionReader(f, offset, st.Size()-offset))
+			offset += n
+			if err != nil {
+				m.endTail(proc, err)
+				return
+			}
+		}
+	}
+}
+
+// endTail records how a tail finished and releases its waiters. A tail
+// that was killed keeps that state.
+func (m *Manager) endTail(proc *Process, err error) {
+	proc.mu.Lock()
+	now := time.Now()
+	proc.EndedAt = &now
+	if proc.State == StateRunning {
+		proc.setState(StateExited, now)
+		if err != nil {
+			fmt.Fprintf(proc.stderr, "tail: %v\n", err)
+			proc.ExitCode = 1
+		}
+	}
+	proc.mu.Unlock()
+	proc.cancel()
+	proc.finish()
+	m.changes.bump()
+}
+
+// lastLines returns the final n lines of the first size bytes of f,
+// reading backwards in chunks so large files are not read whole.
+func lastLines(f *os.File, size int64, n int) ([]byte, error) {
+	if n == 0 || size == 0 {
+		return nil, nil
+	}
+	const chunk = 64 << 10
+	var buf []byte
+	end := size
+	for end > 0 {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		part := make([]byte, end-start)
+		if _, err := f.ReadAt(part, start); err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = append(part, buf...)
+		end = start
+
+		// A trailing newline ends the last line rather than starting
+		// another one.
+		newlines := bytes.Count(buf, []byte{'\n'})
+		if buf[len(buf)-1] == '\n' {
+			newlines--
+		}
+		if newlines >= n {
+			break
+		}
+	}
+
+	cut := len(buf)
+	if buf[cut-1] == '\n' {
+		cut--
+	}
+	for i := 0; i < n; i++ {
+		j := bytes.LastIndexByte(buf[:cut], '\n')
+		if j < 0 {
+			return buf, nil
+		}
+		cut = j
+	}
+	return buf[cut+1:], nil
+}
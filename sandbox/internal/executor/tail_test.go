@@ -0,0 +1,129 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLastLines(t *testing.T) {
+	cases := []struct {
+		content string
+		n       int
+		want    string
+	}{
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"},
+		{"a\nb\n", 5, "a\nb\n"},
+		{"only", 1, "only"},
+		{"", 3, ""},
+		{"a\nb\n", 0, ""},
+	}
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), "f")
+		os.WriteFile(path, []byte(c.content), 0o644)
+		f, _ := os.Open(path)
+		got, err := lastLines(f, int64(len(c.content)), c.n)
+		f.Close()
+		if err != nil || string(got) != c.want {
+			t.Errorf("lastLines(%q, %d) = %q, %v; want %q", c.content, c.n, got, err, c.want)
+		}
+	}
+
+	// Lines spanning several read chunks.
+	var b strings.Builder
+	for i := 0; i < 20000; i++ {
+		b.WriteString("line of some length\n")
+	}
+	b.WriteString("second to last\nlast\n")
+	path := filepath.Join(t.TempDir(), "big")
+	os.WriteFile(path, []byte(b.String()), 0o644)
+	f, _ := os.Open(path)
+	defer f.Close()
+	if got, _ := lastLines(f, int64(b.Len()), 2); string(got) != "second to last\nlast\n" {
+		t.Fatalf("big file: %q", got)
+	}
+}
+
+func TestTailFileConfinedToWorkspace(t *testing.T) {
+	ws := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret")
+	os.WriteFile(outside, []byte("secret\n"), 0o644)
+	os.Symlink(outside, filepath.Join(ws, "escape"))
+	m := NewManager(ws, DefaultOptions())
+
+	for _, p := range []string{outside, "../secret", "escape", "missing.log", ""} {
+		_, err := m.TailFile(TailOptions{Path: p})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Field != "path" {
+			t.Errorf("TailFile(%q) = %v, want a path validation error", p, err)
+		}
+	}
+}
+
+func TestTailFileFollow(t *testing.T) {
+	ws := t.TempDir()
+	log := filepath.Join(ws, "app.log")
+	os.WriteFile(log, []byte("one\ntwo\nthree\n"), 0o644)
+	m := NewManager(ws, DefaultOptions())
+
+	res, err := m.TailFile(TailOptions{Path: "app.log", Lines: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.State != StateExited || res.Stdout != "two\nthree\n" {
+		t.Fatalf("non-follow tail: %+v", res)
+	}
+
+	res, err = m.TailFile(TailOptions{Path: "app.log", Lines: 1, Follow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := m.List(); len(list) != 2 || !strings.HasPrefix(list[0].Command, "tail:") {
+		t.Fatalf("list = %+v", list)
+	}
+
+	f, _ := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("four\n")
+	f.Close()
+	waitForOutput(t, m, res.ID, "three\nfour\n")
+
+	// Truncation starts over from the beginning of the file.
+	os.WriteFile(log, []byte("fresh\n"), 0o644)
+	waitForOutput(t, m, res.ID, "three\nfour\nfresh\n")
+
+	if _, err := m.Kill(res.ID); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := m.Wait(ctx, res.ID)
+	if err != nil {
+		t.Fatalf("Wait after kill: %v", err)
+	}
+	if got.State != StateKilled || !strings.Contains(got.Stderr, "truncated") {
+		t.Fatalf("after kill: %+v", got)
+	}
+}
+
+func waitForOutput(t *testing.T, m *Manager, id, want string) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		res, err := m.Read(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Stdout == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stdout = %q, want %q", res.Stdout, want)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,289 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A launch's cwd and env values may name template variables, written
+// {{.Name}}, which planLaunch expands before any other check. Expansion is
+// a single pass: a variable's value is inserted as is and never expanded
+// again, and a session ID may only hold characters that are safe in a
+// path component. Whatever a template expands to must still lie inside
+// the workspace.
+
+// TemplateVariable documents one variable a launch's cwd and env values
+// may use.
+type TemplateVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// TemplateVariables lists the variables in the order they are documented.
+var TemplateVariables = []TemplateVariable{
+	{"SessionID", "the launch's session_id"},
+	{"ProcessID", "the ID the process is given"},
+	{"Date", "the launch date in UTC, as 2006-01-02"},
+}
+
+// templateVariableNames is TemplateVariables written as they are used,
+// for error messages and descriptions.
+func templateVariableNames() string {
+	names := make([]string, len(TemplateVariables))
+	for i, v := range TemplateVariables {
+		names[i] = "{{." + v.Name + "}}"
+	}
+	return strings.Join(names, ", ")
+}
+
+// MaxSessionIDLength bounds a client-supplied session ID.
+const MaxSessionIDLength = 64
+
+// sessionIDRE admits IDs usable as a single path component: no '/', and
+// no leading '.' that would make "." or "..".
+var sessionIDRE = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+func validateSessionID(id string) error {
+	if id == "" {
+		return nil
+	}
+	if len(id) > MaxSessionIDLength {
+		return invalid("session_id", "is %d characters, exceeding the %d character limit", len(id), MaxSessionIDLength)
+	}
+	if !sessionIDRE.MatchString(id) {
+		return invalid("session_id", "may contain only letters, digits, '.', '_' and '-', and may not start with '.'")
+	}
+	return nil
+}
+
+// templateVars are the values a launch's templates expand to. A session
+// variable without a session is an error rather than an empty string, so
+// "{{.SessionID}}" never quietly becomes the workspace itself.
+func templateVars(sessionID, processID string, now time.Time) map[string]string {
+	vars := map[string]string{
+		"ProcessID": processID,
+		"Date":      now.UTC().Format("2006-01-02"),
+	}
+	if sessionID != "" {
+		vars["SessionID"] = sessionID
+	}
+	return vars
+}
+
+// hasTemplate reports whether s uses any template variable.
+func hasTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// expandTemplate replaces each {{.Name}} in s with its value in vars.
+// An unknown or malformed variable is a ValidationError on field.
+func expandTemplate(field, s string, vars map[string]string) (string, error) {
+	if !hasTemplate(s) {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		j := strings.Index(s[i:], "}}")
+		if j < 0 {
+			return "", invalid(field, "has an unclosed {{; valid variables are %s", templateVariableNames())
+		}
+		expr := strings.TrimSpace(s[i+2 : i+j])
+		name := strings.TrimPrefix(expr, ".")
+		if !known(name) || name == expr {
+			return "", invalid(field, "uses unknown template variable {{%s}}; valid variables are %s", expr, templateVariableNames())
+		}
+		v, ok := vars[name]
+		if !ok {
+			return "", invalid(field, "uses {{.%s}} but the launch has no session_id", name)
+		}
+		b.WriteString(v)
+		s = s[i+j+2:]
+	}
+}
+
+func known(name string) bool {
+	for _, v := range TemplateVariables {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTemplate reports any unknown variable in s without expanding it.
+func CheckTemplate(field, s string) error {
+	vars := templateVars("-", "-", time.Time{})
+	_, err := expandTemplate(field, s, vars)
+	return err
+}
+
+// expandEnv expands the templates in env's values. Names are checked
+// here too, since they are passed to exec as NAME=value.
+func expandEnv(env map[string]string, vars map[string]string) (map[string]string, error) {
+	if len(env) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string, len(env))
+	for name, value := range env {
+		if !envNameRE.MatchString(name) {
+			return nil, invalid("env", "%q is not a valid variable name", name)
+		}
+		if strings.IndexByte(value, 0) >= 0 {
+			return nil, invalid("env", "%s contains a NUL byte", name)
+		}
+		v, err := expandTemplate("env."+name, value, vars)
+		if err != nil {
+			return nil, err
+		}
+		out[name] = v
+	}
+	return out, nil
+}
+
+var envNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func sortedKeys(m map[string]string) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// environ is the server's environment with env laid over it, as exec
+// expects it.
+func environ(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	out := os.Environ()
+	for _, name := range sortedKeys(env) {
+		out = append(out, name+"="+env[name])
+	}
+	return out
+}
+
+// confine refuses a path outside the workspace, whether lexically or
+// through a symlink at or above it. The path need not exist yet.
+func (m *Manager) confine(field, p string) error {
+	p = filepath.Clean(p)
+	if !inside(p, filepath.Clean(m.workspace)) {
+		return invalid(field, "%s is outside the workspace", p)
+	}
+	root, err := filepath.EvalSymlinks(m.workspace)
+	if err != nil {
+		return fmt.Errorf("workspace: %w", err)
+	}
+	for dir := p; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			if !inside(resolved, root) {
+				return invalid(field, "%s resolves to %s, outside the workspace", p, resolved)
+			}
+			return nil
+		}
+		if dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
+
+// inside reports whether p is root or lies beneath it.
+func inside(p, root string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// SetSessionCwd sets the directory launches in session id start in when
+// they give no cwd, overriding Options.SessionCwd. cwd is a template
+// relative to the workspace; empty restores the server default.
+func (m *Manager) SetSessionCwd(id, cwd string) error {
+	if id == "" {
+		return invalid("session_id", "is required")
+	}
+	if err := validateSessionID(id); err != nil {
+		return err
+	}
+	if err := CheckTemplate("cwd", cwd); err != nil {
+		return err
+	}
+	if filepath.IsAbs(cwd) {
+		return invalid("cwd", "must be relative to the workspace")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cwd == "" {
+		delete(m.sessions, id)
+	} else {
+		m.sessions[id] = cwd
+	}
+	return nil
+}
+
+// SessionCwd is the cwd template of session id: its own, else the
+// server's default.
+func (m *Manager) SessionCwd(id string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if cwd, ok := m.sessions[id]; ok {
+		return cwd
+	}
+	return m.opts.SessionCwd
+}
+
+// resolveCwd expands the launch's cwd and makes it absolute. A relative
+// cwd is taken from the workspace, or in a session from the session's
+// directory, which is also where a launch without a cwd starts. A cwd
+// that used a template, or that a session decided, must stay inside the
+// workspace. create reports a session directory that does not exist yet.
+func (m *Manager) resolveCwd(opts LaunchOptions, vars map[string]string) (cwd string, create bool, err error) {
+	base, confined := m.workspace, hasTemplate(opts.Cwd)
+	if opts.SessionID != "" {
+		if tmpl := m.SessionCwd(opts.SessionID); tmpl != "" {
+			dir, err := expandTemplate("session cwd", tmpl, vars)
+			if err != nil {
+				return "", false, err
+			}
+			dir = filepath.Join(m.workspace, dir)
+			if err := m.confine("session cwd", dir); err != nil {
+				return "", false, err
+			}
+			base, confined = dir, true
+		}
+	}
+
+	cwd, err = expandTemplate("cwd", opts.Cwd, vars)
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case cwd == "":
+		cwd = base
+		if base != m.workspace {
+			_, statErr := os.Stat(base)
+			create = os.IsNotExist(statErr)
+		}
+	case cwd[0] != '/':
+		cwd = base + "/" + cwd
+	}
+	if confined {
+		if err := m.confine("cwd", cwd); err != nil {
+			return "", false, err
+		}
+	}
+	return cwd, create, nil
+}
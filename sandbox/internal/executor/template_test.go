@@ -0,0 +1,156 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	vars := templateVars("s1", "ab12cd34", time.Date(2024, 3, 9, 23, 30, 0, 0, time.FixedZone("x", -3600)))
+	cases := map[string]string{
+		"plain":                          "plain",
+		"work/{{.SessionID}}":            "work/s1",
+		"{{ .ProcessID }}-{{.Date}}.log": "ab12cd34-2024-03-10.log",
+	}
+	for in, want := range cases {
+		if got, err := expandTemplate("cwd", in, vars); err != nil || got != want {
+			t.Errorf("expand %q = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"{{.Home}}", "{{SessionID}}", "{{.SessionID", "{{printf \"x\"}}"} {
+		_, err := expandTemplate("cwd", in, vars)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Field != "cwd" || !strings.Contains(verr.Message, "{{.SessionID}}, {{.ProcessID}}, {{.Date}}") {
+			t.Errorf("expand %q: err = %v, want one listing the valid variables", in, err)
+		}
+	}
+
+	// Without a session, {{.SessionID}} is refused rather than left empty.
+	if _, err := expandTemplate("cwd", "{{.SessionID}}", templateVars("", "x", time.Now())); err == nil {
+		t.Error("expanded {{.SessionID}} without a session")
+	}
+}
+
+func TestTemplateInjection(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	ctx := context.Background()
+
+	for _, id := range []string{"..", "../etc", "a/b", ".hidden", "{{.ProcessID}}", "a-{{b}}", strings.Repeat("x", MaxSessionIDLength+1)} {
+		_, err := m.Launch(ctx, LaunchOptions{Command: "true", SessionID: id, Cwd: "{{.SessionID}}"})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Field != "session_id" {
+			t.Errorf("session %q: err = %v, want session_id ValidationError", id, err)
+		}
+	}
+
+	// Env values are passed to the process, never through the shell.
+	res, err := m.Launch(ctx, LaunchOptions{Command: `printf %s "$V"`, Env: map[string]string{"V": "id={{.ProcessID}}; $(touch pwned)"}, Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "id=" + res.ID + "; $(touch pwned)"; res.Stdout != want {
+		t.Fatalf("env V = %q, want %q", res.Stdout, want)
+	}
+
+	for name, env := range map[string]map[string]string{
+		"bad name": {"A=B": "x"},
+		"nul":      {"A": "x\x00y"},
+		"unknown":  {"A": "{{.Secret}}"},
+	} {
+		if _, err := m.Launch(ctx, LaunchOptions{Command: "true", Env: env}); !errors.As(err, new(*ValidationError)) {
+			t.Errorf("%s: err = %v, want ValidationError", name, err)
+		}
+	}
+}
+
+func TestTemplatedCwdConfinement(t *testing.T) {
+	ws := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(ws, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(ws, "s1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(ws, DefaultOptions())
+	ctx := context.Background()
+
+	for _, cwd := range []string{"{{.SessionID}}/../..", "/tmp/{{.SessionID}}", "escape/{{.SessionID}}"} {
+		_, err := m.Launch(ctx, LaunchOptions{Command: "true", SessionID: "s1", Cwd: cwd})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Field != "cwd" {
+			t.Errorf("cwd %q: err = %v, want cwd ValidationError", cwd, err)
+		}
+	}
+
+	res, err := m.Launch(ctx, LaunchOptions{Command: "pwd", SessionID: "s1", Cwd: "{{.SessionID}}", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(res.Stdout); got != filepath.Join(ws, "s1") {
+		t.Fatalf("pwd = %q, want %s", got, filepath.Join(ws, "s1"))
+	}
+}
+
+func TestSessionDefaultCwd(t *testing.T) {
+	ws := t.TempDir()
+	opts := DefaultOptions()
+	opts.SessionCwd = "sessions/{{.SessionID}}"
+	m := NewManager(ws, opts)
+	ctx := context.Background()
+
+	pwd := func(o LaunchOptions) string {
+		t.Helper()
+		o.Command, o.Wait = "pwd", true
+		res, err := m.Launch(ctx, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(res.Stdout)
+	}
+
+	// The session's directory is created on first use, and relative cwds
+	// are taken from it.
+	v, err := m.Validate(ctx, LaunchOptions{Command: "true", SessionID: "a"})
+	if err != nil || v.Options.Cwd != filepath.Join(ws, "sessions", "a") || len(v.Warnings) == 0 {
+		t.Fatalf("validate: %+v, %v", v, err)
+	}
+	if got := pwd(LaunchOptions{SessionID: "a"}); got != filepath.Join(ws, "sessions", "a") {
+		t.Fatalf("session a starts in %s", got)
+	}
+	os.Mkdir(filepath.Join(ws, "sessions", "a", "sub"), 0o755)
+	if got := pwd(LaunchOptions{SessionID: "a", Cwd: "sub"}); got != filepath.Join(ws, "sessions", "a", "sub") {
+		t.Fatalf("session a relative cwd is %s", got)
+	}
+	if _, err := m.Launch(ctx, LaunchOptions{Command: "true", SessionID: "a", Cwd: "../../.."}); !errors.As(err, new(*ValidationError)) {
+		t.Fatalf("session cwd escaping the workspace: err = %v", err)
+	}
+	if got := pwd(LaunchOptions{}); got != ws {
+		t.Fatalf("launch without a session starts in %s", got)
+	}
+
+	// A session's own directory overrides the server's.
+	if err := m.SetSessionCwd("b", "teams/{{.SessionID}}"); err != nil {
+		t.Fatal(err)
+	}
+	if got := pwd(LaunchOptions{SessionID: "b"}); got != filepath.Join(ws, "teams", "b") {
+		t.Fatalf("session b starts in %s", got)
+	}
+	for _, cwd := range []string{"/abs", "{{.User}}"} {
+		if err := m.SetSessionCwd("b", cwd); !errors.As(err, new(*ValidationError)) {
+			t.Errorf("session cwd %q: err = %v", cwd, err)
+		}
+	}
+	if err := m.SetSessionCwd("c", ".."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Launch(ctx, LaunchOptions{Command: "true", SessionID: "c"}); !errors.As(err, new(*ValidationError)) {
+		t.Fatalf("session cwd outside the workspace: err = %v", err)
+	}
+}
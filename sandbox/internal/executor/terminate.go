@@ -0,0 +1,68 @@
+package executor
+
+import (
+	"syscall"
+	"time"
+)
+
+// Two-phase termination. With a grace period a process group is first sent
+// SIGTERM, so a well-behaved child can flush its output and checkpoint, and
+// is SIGKILLed only if it is still running when the period runs out.
+// Without one it is SIGKILLed at once, as before grace periods existed.
+// Timeouts and Kill both stop a process this way, from its monitor.
+
+// Values of EndedBy: the signal that ended a process the server stopped.
+const (
+	EndedBySIGTERM = "sigterm" // it exited within the grace period
+	EndedBySIGKILL = "sigkill"
+)
+
+// stopRequest asks a process's monitor to stop it.
+type stopRequest struct {
+	grace time.Duration
+}
+
+// requestStop hands req to the monitor. A stop already pending or under
+// way is not replaced, though it is cut short: see terminate. The caller
+// holds p.mu.
+func (p *Process) requestStop(req stopRequest) {
+	select {
+	case p.stop <- req:
+	default:
+	}
+}
+
+// terminate stops proc's process group, waits for it to be reaped, and
+// returns which signal ended it along with Wait's error. It returns no
+// signal when the process had already exited. Another stop request during
+// the grace period SIGKILLs at once. Only the monitor calls it.
+func terminate(proc *Process, grace time.Duration, waitDone <-chan error) (string, error) {
+	select {
+	case err := <-waitDone:
+		return "", err
+	default:
+	}
+	if grace > 0 {
+		syscall.Kill(-proc.PID, syscall.SIGTERM)
+		// A paused process has to run to handle the signal.
+		syscall.Kill(-proc.PID, syscall.SIGCONT)
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case err := <-waitDone:
+			return EndedBySIGTERM, err
+		case <-timer.C:
+		case <-proc.stop:
+		}
+	}
+	syscall.Kill(-proc.PID, syscall.SIGKILL)
+	return EndedBySIGKILL, <-waitDone
+}
+
+// checkGrace rejects a grace period no timer can honour.
+func checkGrace(field string, grace time.Duration) error {
+	if grace < 0 {
+		return invalid(field, "must not be negative")
+	}
+	return nil
+}
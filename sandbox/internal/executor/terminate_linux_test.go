@@ -0,0 +1,121 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flushOnTerm prints a line, then on SIGTERM takes a moment to "flush"
+// before exiting cleanly.
+const flushOnTerm = `trap 'echo flushing; sleep 0.2; echo flushed; exit 0' TERM; echo started; while :; do sleep 0.05; done`
+
+// ignoresTerm prints a line and ignores SIGTERM.
+const ignoresTerm = `trap '' TERM; echo started; while :; do sleep 0.05; done`
+
+// launchStarted launches opts and waits for the command's first line.
+func launchStarted(t *testing.T, m *Manager, opts LaunchOptions) string {
+	t.Helper()
+	res, err := m.Launch(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		out, err := m.Read(res.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(out.Stdout, "started") {
+			return res.ID
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("command never started: %+v", out)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTimeoutGracePeriod(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+
+	id := launchStarted(t, m, LaunchOptions{Command: flushOnTerm, Timeout: 300 * time.Millisecond, GracePeriod: 5 * time.Second})
+	out := waitEnded(t, m, id)
+	if out.State != StateTimedOut || out.EndedBy != EndedBySIGTERM {
+		t.Fatalf("ended %s by %q, want timed_out by sigterm", out.State, out.EndedBy)
+	}
+	if !strings.Contains(out.Stdout, "flushing\nflushed\n") {
+		t.Fatalf("output written in the grace period was lost: %q", out.Stdout)
+	}
+
+	start := time.Now()
+	id = launchStarted(t, m, LaunchOptions{Command: ignoresTerm, Timeout: 200 * time.Millisecond, GracePeriod: 300 * time.Millisecond})
+	out = waitEnded(t, m, id)
+	if out.State != StateTimedOut || out.EndedBy != EndedBySIGKILL {
+		t.Fatalf("ended %s by %q, want timed_out by sigkill", out.State, out.EndedBy)
+	}
+	if took := time.Since(start); took < 500*time.Millisecond {
+		t.Fatalf("killed after %v, before the grace period ran out", took)
+	}
+
+	// Without a grace period the timeout kills at once, as it always has.
+	id = launchStarted(t, m, LaunchOptions{Command: flushOnTerm, Timeout: 200 * time.Millisecond})
+	out = waitEnded(t, m, id)
+	if out.State != StateTimedOut || out.EndedBy != EndedBySIGKILL || strings.Contains(out.Stdout, "flushing") {
+		t.Fatalf("ended %s by %q with %q, want an immediate sigkill", out.State, out.EndedBy, out.Stdout)
+	}
+}
+
+func TestTerminateGracePeriod(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+
+	id := launchStarted(t, m, LaunchOptions{Command: flushOnTerm})
+	state, err := m.Terminate(id, 5*time.Second)
+	if err != nil || state != StateKilled {
+		t.Fatalf("terminate: %s, %v", state, err)
+	}
+	out, _ := m.Read(id)
+	if out.EndedBy != EndedBySIGTERM || !strings.Contains(out.Stdout, "flushed\n") {
+		t.Fatalf("ended by %q with %q, want a flushed exit on sigterm", out.EndedBy, out.Stdout)
+	}
+
+	id = launchStarted(t, m, LaunchOptions{Command: flushOnTerm})
+	if state, err := m.Kill(id); err != nil || state != StateKilled {
+		t.Fatalf("kill: %s, %v", state, err)
+	}
+	if out, _ := m.Read(id); out.EndedBy != EndedBySIGKILL || out.TermSignal != "SIGKILL" || strings.Contains(out.Stdout, "flushing") {
+		t.Fatalf("kill without grace: %+v", out)
+	}
+
+	// A second kill cuts a grace period short.
+	id = launchStarted(t, m, LaunchOptions{Command: ignoresTerm})
+	done := make(chan ProcessState, 1)
+	go func() {
+		state, _ := m.Terminate(id, time.Minute)
+		done <- state
+	}()
+	time.Sleep(200 * time.Millisecond)
+	start := time.Now()
+	if state, err := m.Kill(id); err != nil || state != StateKilled {
+		t.Fatalf("second kill: %s, %v", state, err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Fatalf("second kill took %v", took)
+	}
+	if state := <-done; state != StateKilled {
+		t.Fatalf("first terminate returned %s", state)
+	}
+	if out, _ := m.Read(id); out.EndedBy != EndedBySIGKILL {
+		t.Fatalf("ended by %q", out.EndedBy)
+	}
+
+	var verr *ValidationError
+	if _, err := m.Terminate(id, -time.Second); !errors.As(err, &verr) {
+		t.Fatalf("negative grace: %v", err)
+	}
+	if _, err := m.Launch(context.Background(), LaunchOptions{Command: "true", GracePeriod: -time.Second}); !errors.As(err, &verr) {
+		t.Fatalf("negative launch grace: %v", err)
+	}
+}
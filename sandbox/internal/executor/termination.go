@@ -0,0 +1,80 @@
+package executor
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// termSignal returns the signal that ended a process, from Wait's error.
+func termSignal(err error) (syscall.Signal, bool) {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return 0, false
+	}
+	return status.Signal(), true
+}
+
+// signalNames spells the signals a process is commonly ended by.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGUSR1: "SIGUSR1",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGUSR2: "SIGUSR2",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGXFSZ: "SIGXFSZ",
+	syscall.SIGSYS:  "SIGSYS",
+}
+
+func signalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("SIG%d", int(sig))
+}
+
+// watchOOM notes the memory cgroup p runs in and how many OOM kills it
+// has counted so far, so that a later SIGKILL can be attributed to the
+// OOM killer. It is called at launch and on every sweep, which catches a
+// process that moves itself into another cgroup.
+func (p *Process) watchOOM() {
+	file, err := oomCounterFile(p.PID)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if file == p.oomFile {
+		return
+	}
+	if n, err := readOOMKills(file); err == nil {
+		p.oomFile, p.oomKills = file, n
+	}
+}
+
+// oomKilledSince reports whether the OOM killer has struck in p's memory
+// cgroup since watchOOM last looked. Another process sharing the cgroup
+// could have been the victim, but a SIGKILL nobody asked for at the same
+// moment is seldom anything else. The caller holds p.mu.
+func (p *Process) oomKilledSince() bool {
+	if p.oomFile == "" {
+		return false
+	}
+	n, err := readOOMKills(p.oomFile)
+	return err == nil && n > p.oomKills
+}
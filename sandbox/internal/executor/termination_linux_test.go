@@ -0,0 +1,113 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitEnded(t *testing.T, m *Manager, id string) *ReadResult {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := m.Wait(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSignalTerminationAnnotated(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	for _, sig := range []syscall.Signal{syscall.SIGKILL, syscall.SIGTERM} {
+		res, err := m.Launch(context.Background(), LaunchOptions{Command: "exec sleep 30"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Signalled from outside the sandbox, not through Kill.
+		if err := syscall.Kill(res.PID, sig); err != nil {
+			t.Fatal(err)
+		}
+		out := waitEnded(t, m, res.ID)
+		if out.State != StateExited || out.TermSignal != signalName(sig) || out.OOMKilled || out.ExitCode != -1 {
+			t.Fatalf("after %s: %+v", signalName(sig), out)
+		}
+	}
+	if n := m.Metrics().Counters.Exits[ExitSignaled]; n != 2 {
+		t.Fatalf("%d exits classed signaled, want 2", n)
+	}
+
+	// A process that exits by itself carries no signal.
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "exit 1", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TermSignal != "" || res.OOMKilled {
+		t.Fatalf("plain exit annotated: %+v", res)
+	}
+}
+
+// memoryCgroup creates a child of the test's own memory cgroup limited to
+// limit bytes, or skips the test when cgroups cannot be managed here.
+func memoryCgroup(t *testing.T, limit string) string {
+	t.Helper()
+	file, err := oomCounterFile(os.Getpid())
+	if err != nil {
+		t.Skipf("no memory cgroup: %v", err)
+	}
+	dir := filepath.Join(filepath.Dir(file), fmt.Sprintf("sandbox-oom-test-%d", os.Getpid()))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Skipf("cannot create a cgroup: %v", err)
+	}
+	t.Cleanup(func() {
+		// The cgroup can only be removed once its processes are gone.
+		for i := 0; i < 50 && os.Remove(dir) != nil; i++ {
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+	limits := []string{"memory.max", "memory.swap.max"}
+	if strings.HasSuffix(file, "memory.oom_control") {
+		limits = []string{"memory.limit_in_bytes", "memory.memsw.limit_in_bytes"}
+	}
+	if err := os.WriteFile(filepath.Join(dir, limits[0]), []byte(limit), 0o644); err != nil {
+		t.Skipf("cannot limit memory: %v", err)
+	}
+	// Without swap accounting the limit alone has to do.
+	value := limit
+	if limits[1] == "memory.swap.max" {
+		value = "0"
+	}
+	_ = os.WriteFile(filepath.Join(dir, limits[1]), []byte(value), 0o644)
+	return dir
+}
+
+func TestOOMKillAnnotated(t *testing.T) {
+	cg := memoryCgroup(t, "16777216")
+	m := NewManager(t.TempDir(), DefaultOptions())
+	// tail buffers its one endless line until the limit is hit.
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "read go; exec tail /dev/zero", KeepStdinOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Kill(res.ID)
+	if err := os.WriteFile(filepath.Join(cg, "cgroup.procs"), []byte(fmt.Sprint(res.PID)), 0o644); err != nil {
+		t.Skipf("cannot move the process into the cgroup: %v", err)
+	}
+	m.sweep() // notices the move
+	if _, err := m.WriteInput(res.ID, "\n", WriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := waitEnded(t, m, res.ID)
+	if !out.OOMKilled || out.TermSignal != "SIGKILL" || out.State != StateExited {
+		t.Fatalf("after OOM: %+v", out)
+	}
+	if n := m.Metrics().Counters.Exits[ExitOOM]; n != 1 {
+		t.Fatalf("%d exits classed oom, want 1", n)
+	}
+}
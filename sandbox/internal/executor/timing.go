@@ -0,0 +1,53 @@
+package executor
+
+import "time"
+
+// Timing reports how long a process has existed and run. It is computed
+// when a result is built, so clients need not subtract timestamps
+// themselves.
+type Timing struct {
+	// DurationMs is wall-clock run time: elapsed so far while the
+	// process runs, final once it has ended. Time spent paused is
+	// excluded.
+	DurationMs int64 `json:"duration_ms"`
+	// PausedMs is the time the process has spent paused.
+	PausedMs int64 `json:"paused_ms,omitempty"`
+	// AgeMs is the time since the process started, whatever its state.
+	AgeMs int64 `json:"age_ms"`
+
+	// UserCPUMs and SystemCPUMs are the CPU time the process and its
+	// waited-for children used, known once the process has been reaped.
+	UserCPUMs   *int64 `json:"user_cpu_ms,omitempty"`
+	SystemCPUMs *int64 `json:"system_cpu_ms,omitempty"`
+}
+
+// cpuTimes is the resource usage recorded when a process is reaped.
+type cpuTimes struct {
+	user, system time.Duration
+}
+
+// timing computes p's Timing as of now. The caller holds p.mu.
+func (p *Process) timing(now time.Time) Timing {
+	end := now
+	if p.EndedAt != nil {
+		end = *p.EndedAt
+	}
+	t := Timing{
+		DurationMs: p.runTime(end).Milliseconds(),
+		PausedMs:   p.paused(end).Milliseconds(),
+		AgeMs:      now.Sub(p.StartedAt).Milliseconds(),
+	}
+	if p.cpu != nil {
+		user, system := p.cpu.user.Milliseconds(), p.cpu.system.Milliseconds()
+		t.UserCPUMs, t.SystemCPUMs = &user, &system
+	}
+	return t
+}
+
+// recordUsage keeps the CPU time of a reaped process. The caller holds
+// p.mu.
+func (p *Process) recordUsage() {
+	if ps := p.cmd.ProcessState; ps != nil {
+		p.cpu = &cpuTimes{user: ps.UserTime(), system: ps.SystemTime()}
+	}
+}
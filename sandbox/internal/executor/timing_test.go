@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func infoFor(t *testing.T, m *Manager, id string) *ProcessInfo {
+	t.Helper()
+	for _, p := range m.List() {
+		if p.ID == id {
+			return p
+		}
+	}
+	t.Fatalf("process %s not listed", id)
+	return nil
+}
+
+func TestTimingWhileRunning(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "sleep 0.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DurationMs < 0 || res.AgeMs < res.DurationMs || res.UserCPUMs != nil {
+		t.Fatalf("launch timing = %+v", res.Timing)
+	}
+
+	prev := res.Timing
+	for i := 0; i < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+		r, err := m.Read(res.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.State != StateRunning {
+			t.Fatalf("state = %s", r.State)
+		}
+		if r.DurationMs < prev.DurationMs || r.AgeMs < prev.AgeMs {
+			t.Fatalf("timing went backwards: %+v after %+v", r.Timing, prev)
+		}
+		if r.DurationMs != r.AgeMs || r.UserCPUMs != nil {
+			t.Fatalf("running process timing = %+v", r.Timing)
+		}
+		prev = r.Timing
+	}
+	if prev.DurationMs < 60 {
+		t.Fatalf("duration %dms after 60ms of sleeps", prev.DurationMs)
+	}
+}
+
+func TestTimingAfterExit(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "sleep 0.1", Wait: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.State != StateExited || res.DurationMs < 100 {
+		t.Fatalf("launch = %s, timing %+v", res.State, res.Timing)
+	}
+	if res.UserCPUMs == nil || res.SystemCPUMs == nil {
+		t.Fatalf("no CPU times after exit: %+v", res.Timing)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	r, err := m.Read(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := infoFor(t, m, res.ID)
+	for _, got := range []Timing{r.Timing, info.Timing} {
+		// The duration is final; only the age keeps growing.
+		if got.DurationMs != res.DurationMs {
+			t.Fatalf("duration changed after exit: %d, was %d", got.DurationMs, res.DurationMs)
+		}
+		if got.AgeMs < res.AgeMs+30 || got.AgeMs < got.DurationMs {
+			t.Fatalf("age %dms, launch reported %dms", got.AgeMs, res.AgeMs)
+		}
+		if got.UserCPUMs == nil || *got.UserCPUMs != *res.UserCPUMs {
+			t.Fatalf("CPU times differ: %+v vs %+v", got, res.Timing)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// MaxTraceIDLength bounds a client-supplied trace ID.
+const MaxTraceIDLength = 128
+
+// traceIDRE admits W3C trace IDs, UUIDs, and the dotted or colon-separated
+// IDs other tracers use, but nothing that would need escaping in a log
+// line or header.
+var traceIDRE = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+func validateTraceID(id string) error {
+	if id == "" {
+		return nil
+	}
+	if len(id) > MaxTraceIDLength {
+		return invalid("trace_id", "is %d characters, exceeding the %d character limit", len(id), MaxTraceIDLength)
+	}
+	if !traceIDRE.MatchString(id) {
+		return invalid("trace_id", "may contain only letters, digits, '.', '_', ':' and '-'")
+	}
+	return nil
+}
+
+// TraceIDFromTraceparent extracts the trace ID from a W3C traceparent
+// header ("00-<32 hex>-<16 hex>-<2 hex>"). It reports false for a header
+// that is malformed or carries the invalid all-zero ID.
+func TraceIDFromTraceparent(h string) (string, bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", false
+	}
+	id := strings.ToLower(parts[1])
+	for _, c := range id {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return "", false
+		}
+	}
+	if strings.Trim(id, "0") == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// logger returns the Manager's structured logger; without one, lifecycle
+// events are discarded.
+func (m *Manager) logger() *slog.Logger {
+	if m.opts.Logger != nil {
+		return m.opts.Logger
+	}
+	return discardLogger
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// logAttrs identifies p in a log line, with its trace ID when it has one.
+func (p *Process) logAttrs(attrs ...any) []any {
+	out := []any{"process_id", p.ID}
+	if p.TraceID != "" {
+		out = append(out, "trace_id", p.TraceID)
+	}
+	return append(out, attrs...)
+}
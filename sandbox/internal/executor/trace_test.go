@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer lets the monitor goroutine log while the test reads.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestTraceIDFlowsToLogs(t *testing.T) {
+	var logs syncBuffer
+	opts := DefaultOptions()
+	opts.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	m := NewManager(t.TempDir(), opts)
+
+	res, err := m.Launch(context.Background(), LaunchOptions{Command: "exit 2", Wait: true, TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("launch result trace_id %q", res.TraceID)
+	}
+	for _, p := range m.List() {
+		if p.TraceID != res.TraceID {
+			t.Fatalf("ProcessInfo.TraceID = %q", p.TraceID)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		if rec["trace_id"] != res.TraceID || rec["process_id"] != res.ID {
+			t.Errorf("log line without the process's trace: %s", line)
+		}
+		seen[rec["msg"].(string)] = true
+	}
+	if !seen["process launched"] || !seen["process ended"] {
+		t.Fatalf("lifecycle lines %v in %s", seen, logs.String())
+	}
+}
+
+func TestTraceIDValidation(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	for _, id := range []string{"has space", "new\nline", strings.Repeat("a", MaxTraceIDLength+1)} {
+		_, err := m.Launch(context.Background(), LaunchOptions{Command: "true", TraceID: id})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Field != "trace_id" {
+			t.Errorf("trace_id %.20q: err = %v, want ValidationError", id, err)
+		}
+	}
+}
+
+func TestTraceIDFromTraceparent(t *testing.T) {
+	cases := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-00", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		got, ok := TraceIDFromTraceparent(c.header)
+		if got != c.want || ok != c.ok {
+			t.Errorf("TraceIDFromTraceparent(%q) = %q, %v; want %q, %v", c.header, got, ok, c.want, c.ok)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Transcript event kinds.
+const (
+	EventStart     = "start"
+	EventStdin     = "stdin"
+	EventStdout    = "stdout"
+	EventStderr    = "stderr"
+	EventCombined  = "combined" // stdout and stderr of a MergeOutput process
+	EventState     = "state"
+	EventExit      = "exit"
+	EventTruncated = "truncated"
+)
+
+// TranscriptEvent is one entry in a process transcript.
+type TranscriptEvent struct {
+	Seq  int       `json:"seq"`
+	At   time.Time `json:"at"`
+	Kind string    `json:"kind"`
+	Data string    `json:"data,omitempty"`
+	Tag  string    `json:"tag,omitempty"`
+
+	State    ProcessState `json:"state,omitempty"`
+	ExitCode *int         `json:"exit_code,omitempty"`
+
+	// Set on the start event only.
+	Command         string     `json:"command,omitempty"`
+	Cwd             string     `json:"cwd,omitempty"`
+	Env             []string   `json:"env,omitempty"`
+	Nice            *int       `json:"nice,omitempty"`
+	IONiceClass     string     `json:"ionice_class,omitempty"`
+	SecurityProfile string     `json:"security_profile,omitempty"`
+	Effective       *Effective `json:"effective,omitempty"`
+}
+
+// kindOrder breaks timestamp ties so that input precedes the output it
+// provoked and the exit follows everything else.
+var kindOrder = map[string]int{
+	EventStart: 0, EventTruncated: 1, EventStdin: 2, EventStdout: 3, EventStderr: 3, EventCombined: 3, EventState: 4, EventExit: 5,
+}
+
+// Transcript assembles the story of a process: its start, every stdin
+// write, its output, state changes and exit, ordered by time. Output is
+// timestamped per chunk, so writes on stdout and stderr less than
+// chunkGranularity apart may appear in either order; each stream's own
+// order is always preserved. A MergeOutput process has a single combined
+// stream, in the order it was written. Event data is bounded by the per-stream
+// output cap, dropping the oldest stdin and output events first.
+func (m *Manager) Transcript(id string) ([]TranscriptEvent, error) {
+	m.mu.RLock()
+	proc, ok := m.processes[id]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("process %s not found", id)
+	}
+
+	stdout, outDropped := proc.stdout.snapshot()
+	stderr, errDropped := proc.stderr.snapshot()
+	var combined []outputChunk
+	var combinedDropped int64
+	if proc.combined != nil {
+		combined, combinedDropped = proc.combined.snapshot()
+	}
+
+	proc.mu.RLock()
+	nice := proc.Nice
+	start := TranscriptEvent{
+		At:              proc.StartedAt,
+		Kind:            EventStart,
+		Command:         proc.Command,
+		Cwd:             proc.Cwd,
+		Env:             envNames(proc.envNames),
+		Nice:            &nice,
+		IONiceClass:     proc.IONiceClass,
+		SecurityProfile: proc.SecurityProfile,
+		Effective:       proc.effective,
+	}
+	var body []TranscriptEvent
+	for _, rec := range proc.inputs.records {
+		body = append(body, TranscriptEvent{At: rec.At, Kind: EventStdin, Data: rec.Data, Tag: rec.Tag})
+	}
+	inputsDropped := proc.inputs.dropped
+	var tail []TranscriptEvent
+	for _, t := range proc.transitions {
+		tail = append(tail, TranscriptEvent{At: t.at, Kind: EventState, State: t.state})
+	}
+	if proc.EndedAt != nil {
+		code := proc.ExitCode
+		tail = append(tail, TranscriptEvent{At: *proc.EndedAt, Kind: EventExit, State: proc.State, ExitCode: &code})
+	}
+	proc.mu.RUnlock()
+
+	for _, c := range stdout {
+		body = append(body, TranscriptEvent{At: c.start, Kind: EventStdout, Data: string(c.data)})
+	}
+	for _, c := range stderr {
+		body = append(body, TranscriptEvent{At: c.start, Kind: EventStderr, Data: string(c.data)})
+	}
+	for _, c := range combined {
+		body = append(body, TranscriptEvent{At: c.start, Kind: EventCombined, Data: string(c.data)})
+	}
+	sortEvents(body)
+
+	var notes []string
+	if outDropped > 0 {
+		notes = append(notes, fmt.Sprintf("%d bytes of stdout", outDropped))
+	}
+	if errDropped > 0 {
+		notes = append(notes, fmt.Sprintf("%d bytes of stderr", errDropped))
+	}
+	if combinedDropped > 0 {
+		notes = append(notes, fmt.Sprintf("%d bytes of combined output", combinedDropped))
+	}
+	if inputsDropped > 0 {
+		notes = append(notes, fmt.Sprintf("%d stdin writes", inputsDropped))
+	}
+	body, cut := capEvents(body, m.opts.MaxOutputBytes)
+	if cut > 0 {
+		notes = append(notes, fmt.Sprintf("%d earlier events", cut))
+	}
+
+	events := []TranscriptEvent{start}
+	if len(notes) > 0 {
+		at := start.At
+		if len(body) > 0 {
+			at = body[0].At
+		}
+		events = append(events, TranscriptEvent{At: at, Kind: EventTruncated, Data: "omitted " + strings.Join(notes, ", ")})
+	}
+	events = append(events, body...)
+	events = append(events, tail...)
+	sortEvents(events)
+	for i := range events {
+		events[i].Seq = i + 1
+	}
+	return events, nil
+}
+
+func sortEvents(events []TranscriptEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].At.Equal(events[j].At) {
+			return events[i].At.Before(events[j].At)
+		}
+		return kindOrder[events[i].Kind] < kindOrder[events[j].Kind]
+	})
+}
+
+// capEvents keeps the newest events whose data fits in max bytes and
+// returns how many older events it dropped. A max of 0 keeps everything.
+func capEvents(events []TranscriptEvent, max int) ([]TranscriptEvent, int) {
+	if max <= 0 {
+		return events, 0
+	}
+	total := 0
+	for i := len(events) - 1; i >= 0; i-- {
+		total += len(events[i].Data)
+		if total > max {
+			return events[i+1:], i + 1
+		}
+	}
+	return events, 0
+}
+
+// envNames lists the environment variables a launch saw: those it
+// inherited and set, the latter given. Values are left out since they
+// commonly hold credentials.
+func envNames(set []string) []string {
+	env := os.Environ()
+	seen := make(map[string]bool, len(env)+len(set))
+	names := make([]string, 0, len(env)+len(set))
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, kv := range env {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			add(kv[:i])
+		}
+	}
+	for _, name := range set {
+		add(name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenderTranscript formats events as plain text for reading.
+func RenderTranscript(events []TranscriptEvent) string {
+	var b strings.Builder
+	var origin time.Time
+	for _, ev := range events {
+		if ev.Kind == EventStart {
+			origin = ev.At
+		}
+		fmt.Fprintf(&b, "[%s +%s] ", ev.At.UTC().Format("15:04:05.000"), ev.At.Sub(origin).Round(time.Millisecond))
+		switch ev.Kind {
+		case EventStart:
+			fmt.Fprintf(&b, "$ %s\n", ev.Command)
+			fmt.Fprintf(&b, "    cwd: %s\n", ev.Cwd)
+			if ev.Effective != nil {
+				fmt.Fprintf(&b, "    argv: %q\n", ev.Effective.Argv)
+				fmt.Fprintf(&b, "    interpreter: %s\n", ev.Effective.Interpreter)
+				if ev.Effective.UID != nil {
+					fmt.Fprintf(&b, "    uid: %d, gid: %d\n", *ev.Effective.UID, *ev.Effective.GID)
+				}
+			}
+			if ev.Nice != nil {
+				fmt.Fprintf(&b, "    nice: %d", *ev.Nice)
+				if ev.IONiceClass != "" {
+					fmt.Fprintf(&b, ", ionice: %s", ev.IONiceClass)
+				}
+				b.WriteByte('\n')
+			}
+			if ev.SecurityProfile != "" {
+				fmt.Fprintf(&b, "    security profile: %s\n", ev.SecurityProfile)
+			}
+			fmt.Fprintf(&b, "    env: %d variables inherited\n", len(ev.Env))
+		case EventStdin, EventStdout, EventStderr, EventCombined:
+			label := ev.Kind
+			if ev.Tag != "" {
+				label += " (" + ev.Tag + ")"
+			}
+			b.WriteString(label + ":\n")
+			for _, ln := range strings.SplitAfter(ev.Data, "\n") {
+				if ln == "" {
+					continue
+				}
+				b.WriteString("    " + ln)
+				if !strings.HasSuffix(ln, "\n") {
+					b.WriteByte('\n')
+				}
+			}
+		case EventState:
+			fmt.Fprintf(&b, "state: %s\n", ev.State)
+		case EventExit:
+			fmt.Fprintf(&b, "exit: %s, code %d\n", ev.State, *ev.ExitCode)
+		case EventTruncated:
+			fmt.Fprintf(&b, "… %s\n", ev.Data)
+		}
+	}
+	return b.String()
+}
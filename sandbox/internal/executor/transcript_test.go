@@ -0,0 +1,158 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func kinds(events []TranscriptEvent) string {
+	var ks []string
+	for _, ev := range events {
+		ks = append(ks, ev.Kind)
+	}
+	return strings.Join(ks, " ")
+}
+
+func TestTranscriptOrdering(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := t0
+	now := func() time.Time { return clock }
+
+	proc := &Process{
+		ID:        "p1",
+		Command:   "cat",
+		State:     StateRunning,
+		StartedAt: t0,
+		stdout:    &outputBuffer{now: now},
+		stderr:    &outputBuffer{now: now},
+		done:      make(chan struct{}),
+	}
+	m.processes[proc.ID] = proc
+
+	// stdin and the output it provoked share a timestamp; input must
+	// come first. Output more than a chunk apart stays interleaved.
+	clock = t0.Add(time.Second)
+	proc.inputs.add(InputRecord{At: clock, Data: "one\n", Tag: "first"}, 0)
+	proc.stdout.Write([]byte("one\n"))
+	clock = t0.Add(2 * time.Second)
+	proc.stderr.Write([]byte("warn\n"))
+	clock = t0.Add(3 * time.Second)
+	proc.stdout.Write([]byte("two\n"))
+	proc.setState(StateKilled, clock)
+	proc.setState(StateExited, clock)
+	proc.ExitCode = -1
+	proc.EndedAt = &clock
+
+	events, err := m.Transcript("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "start stdin stdout stderr stdout state state exit"
+	if got := kinds(events); got != want {
+		t.Fatalf("kinds = %q, want %q", got, want)
+	}
+	for i, ev := range events {
+		if ev.Seq != i+1 {
+			t.Fatalf("event %d has seq %d", i, ev.Seq)
+		}
+		if i > 0 && ev.At.Before(events[i-1].At) {
+			t.Fatalf("event %d goes back in time", i)
+		}
+	}
+	if events[1].Tag != "first" || events[4].Data != "two\n" || *events[7].ExitCode != -1 {
+		t.Fatalf("events = %+v", events)
+	}
+	if events[5].State != StateKilled || events[6].State != StateExited {
+		t.Fatalf("transitions = %s, %s", events[5].State, events[6].State)
+	}
+
+	text := RenderTranscript(events)
+	for _, s := range []string{"$ cat", "stdin (first):", "    warn", "state: killed", "exit: exited, code -1"} {
+		if !strings.Contains(text, s) {
+			t.Fatalf("rendered transcript lacks %q:\n%s", s, text)
+		}
+	}
+}
+
+func TestTranscriptOfRealProcess(t *testing.T) {
+	m := NewManager(t.TempDir(), DefaultOptions())
+	ctx := context.Background()
+	res, err := m.Launch(ctx, LaunchOptions{
+		Command:       `read line; echo "got $line"; echo oops >&2; exit 3`,
+		KeepStdinOpen: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.WriteInput(res.ID, "hello", WriteOptions{Line: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Wait(ctx, res.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := m.Transcript(res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events[0].Kind != EventStart || events[len(events)-1].Kind != EventExit || *events[len(events)-1].ExitCode != 3 {
+		t.Fatalf("kinds = %s", kinds(events))
+	}
+	var stdin, stdout int
+	for i, ev := range events {
+		switch ev.Kind {
+		case EventStdin:
+			stdin = i
+		case EventStdout:
+			stdout = i
+			if ev.Data != "got hello\n" {
+				t.Fatalf("stdout = %q", ev.Data)
+			}
+		}
+	}
+	if stdin == 0 || stdout < stdin {
+		t.Fatalf("stdin at %d, its output at %d: %s", stdin, stdout, kinds(events))
+	}
+}
+
+func TestTranscriptIsCapped(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MaxOutputBytes = 16
+	m := NewManager(t.TempDir(), opts)
+	t0 := time.Now()
+	clock := t0
+	now := func() time.Time { return clock }
+	proc := &Process{
+		ID: "p1", State: StateRunning, StartedAt: t0,
+		stdout: &outputBuffer{max: 16, now: now},
+		stderr: &outputBuffer{max: 16, now: now},
+		done:   make(chan struct{}),
+	}
+	m.processes[proc.ID] = proc
+	for i := 0; i < 4; i++ {
+		clock = clock.Add(time.Second)
+		proc.stdout.Write([]byte("0123456789\n"))
+		proc.stderr.Write([]byte("abcdefghij\n"))
+	}
+
+	events, err := m.Transcript("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events[1].Kind != EventTruncated || !strings.Contains(events[1].Data, "bytes of stdout") {
+		t.Fatalf("no truncation note: %s", kinds(events))
+	}
+	total := 0
+	for _, ev := range events[2:] {
+		total += len(ev.Data)
+	}
+	if total > 16 {
+		t.Fatalf("transcript carries %d bytes of data, cap is 16", total)
+	}
+	if last := events[len(events)-1]; last.Kind != EventStderr || !strings.HasSuffix(last.Data, "j\n") {
+		t.Fatalf("newest output not kept: %+v", last)
+	}
+}
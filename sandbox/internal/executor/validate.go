@@ -0,0 +1,154 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// launchPlan is a launch request resolved against server policy: the
+// options with defaults filled in and the argv that would be executed.
+// Launch and Validate both build one, so a dry run cannot disagree with
+// the real thing about what is allowed.
+type launchPlan struct {
+	opts      LaunchOptions // Cwd absolute and Env expanded, Nice and MaxOpenFiles set, SecurityProfile resolved
+	profile   *SecurityProfile
+	argv      []string
+	warnings  []string
+	createCwd bool // Cwd is a session directory Launch must create
+}
+
+// planLaunch runs every check Launch makes before starting a process,
+// which will be given the ID id.
+func (m *Manager) planLaunch(opts LaunchOptions, id string) (*launchPlan, error) {
+	if err := m.validateCommand(opts.Command); err != nil {
+		return nil, err
+	}
+	if err := validateTraceID(opts.TraceID); err != nil {
+		return nil, err
+	}
+	if err := validateSessionID(opts.SessionID); err != nil {
+		return nil, err
+	}
+	vars := templateVars(opts.SessionID, id, time.Now())
+	cwd, createCwd, err := m.resolveCwd(opts, vars)
+	if err != nil {
+		return nil, err
+	}
+	env, err := expandEnv(opts.Env, vars)
+	if err != nil {
+		return nil, err
+	}
+	nice, ioClass, err := m.opts.Priority.resolvePriority(opts)
+	if err != nil {
+		return nil, err
+	}
+	openFiles, err := m.opts.OpenFiles.resolveOpenFiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := m.resolveSecurityProfile(opts.SecurityProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &launchPlan{opts: opts, profile: profile, createCwd: createCwd}
+	plan.opts.Env = env
+	plan.opts.Nice = &nice
+	plan.opts.MaxOpenFiles = &openFiles
+	plan.opts.IONiceClass = ioClass
+	if profile != nil {
+		plan.opts.SecurityProfile = profile.Name
+	}
+	if opts.Record {
+		if !ptySupported {
+			return nil, &UnsupportedError{Feature: "pty", Message: "record needs a pseudo-terminal, which this platform does not provide"}
+		}
+		// The terminal merges the streams; it also needs a TERM.
+		plan.opts.MergeOutput = true
+		if _, ok := env["TERM"]; !ok {
+			plan.opts.Env = map[string]string{"TERM": castTerm}
+			for name, value := range env {
+				plan.opts.Env[name] = value
+			}
+		}
+	}
+	if err := checkGrace("grace_period", opts.GracePeriod); err != nil {
+		return nil, err
+	}
+	if opts.Timeout < 0 {
+		plan.opts.Timeout = 0
+		plan.warnings = append(plan.warnings, "negative timeout ignored; the process runs until it exits or is killed")
+	}
+
+	if err := m.checkRedisFSCwd(cwd); err != nil {
+		return nil, err
+	}
+	plan.opts.Cwd = cwd
+
+	plan.argv = []string{"sh", "-c", opts.Command}
+	if profile != nil {
+		if plan.argv, err = securedArgs(profile, cwd, plan.argv); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// ValidationResult is the outcome of a dry-run launch: the options Launch
+// would use and anything about them worth a second look.
+type ValidationResult struct {
+	Options  LaunchOptions `json:"options"`
+	Argv     []string      `json:"argv"`
+	Warnings []string      `json:"warnings"`
+}
+
+// shellCheckTimeout bounds the sh -n parse of a dry-run command.
+const shellCheckTimeout = 2 * time.Second
+
+// Validate checks a launch without starting anything. It fails with the
+// same errors Launch would, and additionally reports the exec failures
+// Launch only discovers when it starts the process: a missing shell or
+// working directory. Problems that would not stop the launch, such as a
+// shell syntax error, are returned as warnings.
+func (m *Manager) Validate(ctx context.Context, opts LaunchOptions) (*ValidationResult, error) {
+	plan, err := m.planLaunch(opts, newProcessID())
+	if err != nil {
+		return nil, err
+	}
+	result := &ValidationResult{Options: plan.opts, Argv: plan.argv, Warnings: append([]string{}, plan.warnings...)}
+
+	if plan.createCwd {
+		result.Warnings = append(result.Warnings, "session directory "+plan.opts.Cwd+" does not exist yet; launch creates it")
+	} else if st, err := os.Stat(plan.opts.Cwd); err != nil {
+		return nil, classifyStartError(err)
+	} else if !st.IsDir() {
+		return nil, &ExecError{Cause: "ENOTDIR", Message: "working directory " + plan.opts.Cwd + " is not a directory"}
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		return nil, &ExecError{Cause: "ENOENT", Message: "shell does not exist (" + err.Error() + ")", Err: err}
+	}
+
+	// sh -n parses the command without running any of it.
+	checkCtx, cancel := context.WithTimeout(ctx, shellCheckTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(checkCtx, "sh", "-n", "-c", opts.Command).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && checkCtx.Err() == nil {
+		result.Warnings = append(result.Warnings, "shell syntax: "+strings.TrimSpace(string(out)))
+	}
+
+	if opts.Wait && opts.KeepStdinOpen {
+		result.Warnings = append(result.Warnings, "wait with keep_stdin_open returns only once the command exits; a command that reads stdin needs its input written from another request")
+	}
+	if opts.Wait && plan.opts.Timeout == 0 {
+		result.Warnings = append(result.Warnings, "wait without a timeout blocks until the command exits")
+	}
+	if plan.opts.GracePeriod > 0 && plan.opts.Timeout == 0 {
+		result.Warnings = append(result.Warnings, "grace period has no effect without a timeout; kill takes its own")
+	}
+	return result, nil
+}
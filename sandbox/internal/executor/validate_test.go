@@ -0,0 +1,144 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLaunchRejectsInvalidCommands(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MaxCommandBytes = 16
+	m := NewManager(t.TempDir(), opts)
+
+	cases := map[string]string{
+		"empty":    "",
+		"nul":      "echo a\x00b",
+		"too long": strings.Repeat("x", 17),
+	}
+	for name, cmd := range cases {
+		_, err := m.Launch(context.Background(), LaunchOptions{Command: cmd})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Field != "command" {
+			t.Errorf("%s: err = %v, want command ValidationError", name, err)
+		}
+	}
+}
+
+func TestLaunchClassifiesExecFailures(t *testing.T) {
+	m := NewManager(t.TempDir(), Options{Priority: DefaultPriorityPolicy()})
+
+	// sh receives the command as a single argv entry, which the kernel caps
+	// at MAX_ARG_STRLEN.
+	_, err := m.Launch(context.Background(), LaunchOptions{Command: "true #" + strings.Repeat("x", 256<<10)})
+	assertExecCause(t, err, "E2BIG")
+
+	_, err = m.Launch(context.Background(), LaunchOptions{Command: "true", Cwd: "does/not/exist"})
+	assertExecCause(t, err, "ENOENT")
+
+	// Root ignores directory permissions, so exercise EACCES directly.
+	err = classifyStartError(&os.PathError{Op: "chdir", Path: filepath.Join("x", "y"), Err: syscall.EACCES})
+	assertExecCause(t, err, "EACCES")
+
+	if err := classifyStartError(errors.New("boom")); errors.As(err, new(*ExecError)) {
+		t.Errorf("unrelated error classified as ExecError: %v", err)
+	}
+}
+
+func assertExecCause(t *testing.T, err error, cause string) {
+	t.Helper()
+	var xerr *ExecError
+	if !errors.As(err, &xerr) || xerr.Cause != cause {
+		t.Fatalf("err = %v, want ExecError with cause %s", err, cause)
+	}
+}
+
+func TestValidateMatchesLaunchPolicy(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.MaxCommandBytes = 64
+	opts.Priority.MinNice, opts.Priority.MaxNice = 0, 10
+	m := NewManager(dir, opts)
+	nice := func(n int) *int { return &n }
+
+	cases := []struct {
+		name    string
+		opts    LaunchOptions
+		field   string // ValidationError field, if rejected by policy
+		cause   string // ExecError cause, if exec would fail
+		cwd     string
+		warning string
+	}{
+		{name: "defaults", opts: LaunchOptions{Command: "true"}, cwd: dir},
+		{name: "relative cwd", opts: LaunchOptions{Command: "true", Cwd: "."}, cwd: dir + "/."},
+		{name: "empty", opts: LaunchOptions{}, field: "command"},
+		{name: "too long", opts: LaunchOptions{Command: strings.Repeat("x", 65)}, field: "command"},
+		{name: "nice below policy", opts: LaunchOptions{Command: "true", Nice: nice(-5)}, field: "nice"},
+		{name: "unknown profile", opts: LaunchOptions{Command: "true", SecurityProfile: "nope"}, field: "security_profile"},
+		{name: "missing cwd", opts: LaunchOptions{Command: "true", Cwd: "missing"}, cause: "ENOENT"},
+		{name: "cwd is a file", opts: LaunchOptions{Command: "true", Cwd: "file"}, cause: "ENOTDIR"},
+		{name: "syntax error", opts: LaunchOptions{Command: "if true; then"}, cwd: dir, warning: "shell syntax"},
+		{name: "negative timeout", opts: LaunchOptions{Command: "true", Timeout: -time.Second}, cwd: dir, warning: "negative timeout"},
+		{name: "wait without timeout", opts: LaunchOptions{Command: "true", Wait: true}, cwd: dir, warning: "without a timeout"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := m.Validate(context.Background(), c.opts)
+			var verr *ValidationError
+			var xerr *ExecError
+			switch {
+			case c.field != "":
+				if !errors.As(err, &verr) || verr.Field != c.field {
+					t.Fatalf("err = %v, want %s ValidationError", err, c.field)
+				}
+				// Launch must refuse the same request the same way.
+				if _, lerr := m.Launch(context.Background(), c.opts); lerr == nil || lerr.Error() != err.Error() {
+					t.Fatalf("Launch err = %v, Validate err = %v", lerr, err)
+				}
+				return
+			case c.cause != "":
+				if !errors.As(err, &xerr) || xerr.Cause != c.cause {
+					t.Fatalf("err = %v, want ExecError %s", err, c.cause)
+				}
+				return
+			case err != nil:
+				t.Fatal(err)
+			}
+			if result.Options.Cwd != c.cwd || result.Options.Nice == nil || *result.Options.Nice != opts.Priority.DefaultNice {
+				t.Errorf("options = %+v", result.Options)
+			}
+			if got := strings.Join(result.Argv, " "); got != "sh -c "+c.opts.Command {
+				t.Errorf("argv = %q", got)
+			}
+			found := c.warning == "" && len(result.Warnings) == 0
+			for _, w := range result.Warnings {
+				found = found || (c.warning != "" && strings.Contains(w, c.warning))
+			}
+			if !found {
+				t.Errorf("warnings = %q, want one containing %q", result.Warnings, c.warning)
+			}
+		})
+	}
+}
+
+func TestValidateStartsNothing(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(dir, DefaultOptions())
+	if _, err := m.Validate(context.Background(), LaunchOptions{Command: "touch ran"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran")); !os.IsNotExist(err) {
+		t.Fatalf("command ran during validation: %v", err)
+	}
+	if n := len(m.List()); n != 0 {
+		t.Fatalf("%d processes registered", n)
+	}
+}
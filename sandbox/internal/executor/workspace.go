@@ -0,0 +1,131 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WorkspaceOptions controls how the workspace is prepared at startup.
+type WorkspaceOptions struct {
+	// Create makes the workspace, and any missing parents, if it does
+	// not exist.
+	Create bool
+	// Mode is the permission set of a created workspace.
+	Mode os.FileMode
+	// Root, when set, is a directory the workspace must resolve inside
+	// of, so a symlinked workspace cannot point elsewhere.
+	Root string
+}
+
+// DefaultWorkspaceOptions creates a missing workspace with mode 0755 and
+// places no restriction on where it resolves.
+func DefaultWorkspaceOptions() WorkspaceOptions {
+	return WorkspaceOptions{Create: true, Mode: 0o755}
+}
+
+// WorkspaceStatus reports whether the workspace is usable.
+type WorkspaceStatus struct {
+	Path     string `json:"path"`
+	Resolved string `json:"resolved,omitempty"`
+	Ready    bool   `json:"ready"`
+	Error    string `json:"error,omitempty"`
+}
+
+// PrepareWorkspace creates the workspace if allowed and checks that it is
+// a writable directory within opts.Root. It returns the absolute path,
+// which is what the Manager should be given, and the path it resolves to
+// through any symlinks.
+func PrepareWorkspace(path string, opts WorkspaceOptions) (abs, resolved string, err error) {
+	abs, err = filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := os.Lstat(abs); errors.Is(err, os.ErrNotExist) {
+		if !opts.Create {
+			return "", "", fmt.Errorf("workspace %s does not exist", abs)
+		}
+		mode := opts.Mode
+		if mode == 0 {
+			mode = DefaultWorkspaceOptions().Mode
+		}
+		if err := os.MkdirAll(abs, mode); err != nil {
+			return "", "", fmt.Errorf("create workspace: %w", err)
+		}
+		// MkdirAll is subject to the umask; the mode asked for is meant.
+		if err := os.Chmod(abs, mode); err != nil {
+			return "", "", fmt.Errorf("create workspace: %w", err)
+		}
+	}
+
+	resolved, err = checkWorkspace(abs, opts.Root)
+	if err != nil {
+		return "", "", err
+	}
+	if err := probeWritable(resolved); err != nil {
+		return "", "", fmt.Errorf("workspace %s is not writable by uid %d: %w", abs, os.Geteuid(), err)
+	}
+	return abs, resolved, nil
+}
+
+// checkWorkspace verifies that path is, or links to, a directory inside
+// root, and returns the path it resolves to.
+func checkWorkspace(path, root string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			if _, lerr := os.Lstat(path); lerr == nil {
+				return "", fmt.Errorf("workspace %s is a symlink to a missing target", path)
+			}
+			return "", fmt.Errorf("workspace %s does not exist", path)
+		}
+		return "", fmt.Errorf("workspace %s: %w", path, err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("workspace %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("workspace %s is not a directory", path)
+	}
+	if root != "" {
+		rootResolved, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return "", fmt.Errorf("workspace root %s: %w", root, err)
+		}
+		if resolved != rootResolved && !strings.HasPrefix(resolved, rootResolved+string(filepath.Separator)) {
+			return "", fmt.Errorf("workspace %s resolves to %s, outside the allowed root %s", path, resolved, root)
+		}
+	}
+	return resolved, nil
+}
+
+// probeWritable creates and removes a file in dir. Permission bits alone
+// do not tell, given ACLs and read-only mounts.
+func probeWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".sandbox-probe-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// Workspace reports whether the workspace still exists as a directory
+// within the configured root. It does not write to it.
+func (m *Manager) Workspace() WorkspaceStatus {
+	st := WorkspaceStatus{Path: m.workspace}
+	resolved, err := checkWorkspace(m.workspace, m.opts.Workspace.Root)
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	if resolved != m.workspace {
+		st.Resolved = resolved
+	}
+	st.Ready = true
+	return st
+}
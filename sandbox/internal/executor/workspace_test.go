@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrepareWorkspaceCreates(t *testing.T) {
+	ws := filepath.Join(t.TempDir(), "a", "workspace")
+	abs, resolved, err := PrepareWorkspace(ws, WorkspaceOptions{Create: true, Mode: 0o750})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if abs != ws || resolved != ws {
+		t.Fatalf("paths = %s, %s", abs, resolved)
+	}
+	info, err := os.Stat(ws)
+	if err != nil || !info.IsDir() || info.Mode().Perm() != 0o750 {
+		t.Fatalf("created %v, %v", info, err)
+	}
+	if entries, _ := os.ReadDir(ws); len(entries) != 0 {
+		t.Fatalf("writability probe left %d entries behind", len(entries))
+	}
+}
+
+func TestPrepareWorkspaceFailures(t *testing.T) {
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "file")
+	os.WriteFile(file, nil, 0o644)
+	outside := filepath.Join(tmp, "outside")
+	root := filepath.Join(tmp, "root")
+	os.Mkdir(outside, 0o755)
+	os.Mkdir(root, 0o755)
+	escape := filepath.Join(root, "ws")
+	os.Symlink(outside, escape)
+	inside := filepath.Join(root, "real")
+	os.Mkdir(inside, 0o755)
+	linked := filepath.Join(root, "linked")
+	os.Symlink(inside, linked)
+	dangling := filepath.Join(tmp, "dangling")
+	os.Symlink(filepath.Join(tmp, "nowhere"), dangling)
+
+	cases := []struct {
+		name string
+		path string
+		opts WorkspaceOptions
+		want string // substring of the error; empty means success
+	}{
+		{"missing without create", filepath.Join(tmp, "missing"), WorkspaceOptions{}, "does not exist"},
+		{"not a directory", file, WorkspaceOptions{Create: true}, "not a directory"},
+		{"dangling symlink", dangling, WorkspaceOptions{Create: true}, "symlink to a missing target"},
+		{"symlink escaping root", escape, WorkspaceOptions{Root: root}, "outside the allowed root"},
+		{"symlink within root", linked, WorkspaceOptions{Root: root}, ""},
+		{"symlink without root", escape, WorkspaceOptions{}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := PrepareWorkspace(tc.path, tc.opts)
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPrepareWorkspaceNotWritable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to any directory")
+	}
+	ws := filepath.Join(t.TempDir(), "ro")
+	os.Mkdir(ws, 0o555)
+	t.Cleanup(func() { os.Chmod(ws, 0o755) })
+	if _, _, err := PrepareWorkspace(ws, DefaultWorkspaceOptions()); err == nil || !strings.Contains(err.Error(), "not writable") {
+		t.Fatalf("err = %v, want not writable", err)
+	}
+}
+
+func TestWorkspaceStatus(t *testing.T) {
+	ws := filepath.Join(t.TempDir(), "ws")
+	os.Mkdir(ws, 0o755)
+	m := NewManager(ws, DefaultOptions())
+	if st := m.Workspace(); !st.Ready || st.Error != "" {
+		t.Fatalf("status = %+v", st)
+	}
+	os.Remove(ws)
+	if st := m.Workspace(); st.Ready || !strings.Contains(st.Error, "does not exist") {
+		t.Fatalf("status after removal = %+v", st)
+	}
+}